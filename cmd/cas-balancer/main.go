@@ -1,86 +1,340 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 	"strings"
 	"time"
 
+	"loopfs/pkg/audit"
+	"loopfs/pkg/config"
 	"loopfs/pkg/log"
+	"loopfs/pkg/models"
 	"loopfs/pkg/server/balancer"
+	"loopfs/pkg/tracing"
+	"loopfs/pkg/webhook"
 )
 
 const (
-	defaultRetryMax             = 3
-	defaultRetryWaitMax         = 30 * time.Second
-	defaultRequestTimeout       = 30 * time.Second
-	gracefulShutdownTimeout     = 10 * time.Second
-	defaultHealthCheckInterval  = 5 * time.Second
-	defaultHealthCheckTimeout   = 5 * time.Second
+	defaultRetryMax            = 3
+	defaultRetryWaitMin        = 1 * time.Second
+	defaultRetryWaitMax        = 30 * time.Second
+	defaultRequestTimeout      = 30 * time.Second
+	defaultShutdownTimeout     = 10 * time.Second
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultTraceSampleRatio    = 1.0
+	tracingShutdownTimeout     = 5 * time.Second
 )
 
 func main() {
 	// Initialize logger
 	_ = log.Logger
 
-	// Parse command-line flags
-	var backends string
-	flag.StringVar(&backends, "backends", "", "Comma-separated list of CAS server URLs (e.g., http://server1:8080,http://server2:8080)")
-	addr := flag.String("addr", ":8081", "Load balancer listen address")
-	retryMax := flag.Int("retry-max", defaultRetryMax, "Maximum number of retries")
-	retryWaitMin := flag.Duration("retry-wait-min", 1*time.Second, "Minimum wait time between retries")
-	retryWaitMax := flag.Duration("retry-wait-max", defaultRetryWaitMax, "Maximum wait time between retries")
-	requestTimeout := flag.Duration("request-timeout", defaultRequestTimeout, "Request timeout")
-	healthCheckInterval := flag.Duration("health-check-interval", defaultHealthCheckInterval, "Interval between health checks")
-	healthCheckTimeout := flag.Duration("health-check-timeout", defaultHealthCheckTimeout, "Timeout for health check requests")
-	debug := flag.Bool("debug", false, "Enable debug logging")
-	debugAddr := flag.String("debug-addr", "localhost:6060", "Debug server address (pprof)")
-	dbPath := flag.String("db", "", "SQLite database path for bucket metadata (enables bucket API)")
+	// Flags override the configuration file and environment, the defaults are the flag defaults
+	cfg := defaultConfig()
+	configPath := flag.String("config", "", "YAML or TOML configuration file, reloaded on SIGHUP")
+	flag.Var(&cfg.Backends, "backends", "Comma-separated list of CAS server URLs (e.g., http://server1:8080,http://server2:8080)")
+	flag.StringVar(&cfg.BackendsFile, "backends-file", cfg.BackendsFile, "File listing CAS server URLs, one per line or comma-separated, watched for changes instead of -backends")
+	flag.StringVar(&cfg.BackendsSRV, "backends-srv", cfg.BackendsSRV, "DNS SRV name resolving to the CAS servers (e.g., _cas._tcp.example.com), watched instead of -backends")
+	flag.StringVar(&cfg.BackendsSRVScheme, "backends-srv-scheme", cfg.BackendsSRVScheme, "URL scheme of the CAS servers found through -backends-srv")
+	flag.DurationVar(&cfg.BackendsWatchInterval, "backends-watch-interval", cfg.BackendsWatchInterval, "Interval between reads of -backends-file or -backends-srv")
+	flag.StringVar(&cfg.Addr, "addr", cfg.Addr, "Load balancer listen address")
+	flag.IntVar(&cfg.RetryMax, "retry-max", cfg.RetryMax, "Maximum number of retries")
+	flag.DurationVar(&cfg.RetryWaitMin, "retry-wait-min", cfg.RetryWaitMin, "Minimum wait time between retries")
+	flag.DurationVar(&cfg.RetryWaitMax, "retry-wait-max", cfg.RetryWaitMax, "Maximum wait time between retries")
+	flag.DurationVar(&cfg.RequestTimeout, "request-timeout", cfg.RequestTimeout, "Request timeout")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "Time given to in-flight requests on shutdown")
+	flag.DurationVar(&cfg.HealthCheckInterval, "health-check-interval", cfg.HealthCheckInterval, "Interval between health checks")
+	flag.DurationVar(&cfg.HealthCheckTimeout, "health-check-timeout", cfg.HealthCheckTimeout, "Timeout for health check requests")
+	flag.DurationVar(&cfg.NodeInfoInterval, "node-info-interval", cfg.NodeInfoInterval, "Interval between node info refreshes; health checks in between only probe /healthz")
+	flag.DurationVar(&cfg.BreakerWindow, "breaker-window", cfg.BreakerWindow, "Sliding window of backend requests the circuit breaker error rate is computed over")
+	flag.IntVar(&cfg.BreakerMinRequests, "breaker-min-requests", cfg.BreakerMinRequests, "Requests in the window before the error rate can open a backend's circuit")
+	flag.Float64Var(&cfg.BreakerErrorRate, "breaker-error-rate", cfg.BreakerErrorRate, "Share of failed requests in the window (0-1) that opens a backend's circuit")
+	flag.DurationVar(&cfg.BreakerSlowThreshold, "breaker-slow-threshold", cfg.BreakerSlowThreshold, "Backend requests without a body slower than this count as failed (0 disables)")
+	flag.IntVar(&cfg.BreakerFailures, "breaker-failures", cfg.BreakerFailures, "Failed requests in a row that open a backend's circuit")
+	flag.DurationVar(&cfg.BreakerOpenTimeout, "breaker-open-timeout", cfg.BreakerOpenTimeout, "Time an open circuit waits before the backend is probed again")
+	flag.BoolVar(&cfg.Debug, "debug", cfg.Debug, "Enable debug logging")
+	flag.StringVar(&cfg.DebugAddr, "debug-addr", cfg.DebugAddr, "Debug server address (pprof)")
+	flag.StringVar(&cfg.DB, "db", cfg.DB, "SQLite database path for bucket metadata (enables bucket API)")
+	flag.StringVar(&cfg.DBDSN, "db-dsn", cfg.DBDSN, "PostgreSQL DSN for bucket metadata, instead of -db (enables bucket API)")
+	flag.StringVar(&cfg.MetadataAdvertise, "metadata-advertise", cfg.MetadataAdvertise, "URL the other balancers reach this one at to replicate bucket metadata (requires -db)")
+	flag.Var(&cfg.MetadataPeers, "metadata-peers", "Comma-separated URLs of the other balancers replicating bucket metadata")
+	flag.DurationVar(&cfg.MetadataHeartbeat, "metadata-heartbeat-interval", cfg.MetadataHeartbeat, "How often the metadata leader contacts each follower")
+	flag.DurationVar(&cfg.MetadataElection, "metadata-election-timeout", cfg.MetadataElection, "Time without a metadata leader before a balancer stands for election")
+	flag.DurationVar(&cfg.MetadataCommitTimeout, "metadata-commit-timeout", cfg.MetadataCommitTimeout, "Time a bucket change waits to be stored by a majority of balancers")
+	flag.IntVar(&cfg.MetadataLogRetention, "metadata-log-retention", cfg.MetadataLogRetention, "Metadata log entries kept for followers; followers further behind get a snapshot")
+	flag.StringVar(&cfg.AuditLog, "audit-log", cfg.AuditLog, "File to append JSON-lines audit entries of mutating operations to")
+	flag.StringVar(&cfg.AuditDB, "audit-db", cfg.AuditDB, "SQLite database path for the queryable audit log")
+	flag.Var(&cfg.WebhookURLs, "webhook-url", "Comma-separated webhook URLs notified of bucket and object changes (requires -db)")
+	flag.StringVar(&cfg.WebhookSecret, "webhook-secret", cfg.WebhookSecret, "Secret used to sign webhook deliveries with HMAC-SHA256")
+	flag.IntVar(&cfg.WebhookMaxAttempts, "webhook-max-attempts", cfg.WebhookMaxAttempts, "Delivery attempts before an event is moved to dead letters")
+	flag.DurationVar(&cfg.EventRetention, "event-retention", cfg.EventRetention, "How long delivered change events are kept (0 keeps them forever)")
+	flag.IntVar(&cfg.ReplicationFactor, "replication-factor", cfg.ReplicationFactor, "Number of distinct backends each upload is written to")
+	flag.IntVar(&cfg.WriteQuorum, "write-quorum", cfg.WriteQuorum, "Backends that must store an upload for it to succeed (0 means a majority of -replication-factor)")
+	flag.StringVar(&cfg.Placement, "placement", cfg.Placement, "Upload placement and read routing: broadcast (most free space, ask all backends) or rendezvous (hash owners by weighted rendezvous hashing, ask them first)")
+	flag.StringVar(&cfg.UploadPolicy, "upload-policy", cfg.UploadPolicy, "Backends chosen for uploads with broadcast placement: "+strings.Join(balancer.PlacementPolicies(), ", ")+" (buckets can select their own)")
+	flag.Float64Var(&cfg.HedgePercentile, "hedge-percentile", cfg.HedgePercentile, "Download latency percentile after which the next backend is asked as well (0 asks all backends at once)")
+	flag.IntVar(&cfg.LocationCacheSize, "location-cache-size", cfg.LocationCacheSize, "Number of hashes whose backend locations are cached to route repeat reads (0 disables the cache)")
+	flag.BoolVar(&cfg.LocationCachePersist, "location-cache-persist", cfg.LocationCachePersist, "Keep cached hash locations in the bucket store across restarts (requires -db)")
+	flag.DurationVar(&cfg.RepairInterval, "repair-interval", cfg.RepairInterval, "Interval between full anti-entropy scans of all backends (0 disables periodic scans)")
+	flag.DurationVar(&cfg.RepairQueueInterval, "repair-queue-interval", cfg.RepairQueueInterval, "Interval between retries of uploads queued as under-replicated (0 disables them)")
+	flag.Float64Var(&cfg.RepairRate, "repair-rate", cfg.RepairRate, "Backend requests per second made by the repair worker (0 means unlimited)")
+	flag.Int64Var(&cfg.RepairBandwidth, "repair-bandwidth", cfg.RepairBandwidth, "Bytes per second copied between backends by the repair worker (0 means unlimited)")
+	flag.Float64Var(&cfg.OwnerRequestRate, "owner-request-rate", cfg.OwnerRequestRate, "Requests per second each owner (X-Owner-ID) may make (0 means unlimited)")
+	flag.Int64Var(&cfg.OwnerByteRate, "owner-byte-rate", cfg.OwnerByteRate, "Bytes per second each owner may upload and download (0 means unlimited)")
+	flag.Float64Var(&cfg.BucketRequestRate, "bucket-request-rate", cfg.BucketRequestRate, "Requests per second to each bucket (0 means unlimited)")
+	flag.Int64Var(&cfg.BucketByteRate, "bucket-byte-rate", cfg.BucketByteRate, "Bytes per second uploaded to and downloaded from each bucket (0 means unlimited)")
+	flag.IntVar(&cfg.BackendConcurrency, "backend-concurrency", cfg.BackendConcurrency, "Requests sent to each backend at once, further ones wait (0 means unlimited)")
+	flag.StringVar(&cfg.AdminToken, "admin-token", cfg.AdminToken, "Bearer token required by the admin API (empty restricts it to loopback clients)")
+
+	flag.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "Log output format: console or json")
+	flag.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "Minimum log level: trace, debug, info, warn or error")
+
+	flag.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", cfg.OTLPEndpoint, "OTLP/HTTP collector URL for traces, e.g. http://localhost:4318 (empty disables tracing)")
+	flag.Float64Var(&cfg.TraceSampleRatio, "trace-sample-ratio", cfg.TraceSampleRatio, "Fraction of new traces to record (0-1)")
 
 	flag.Parse()
 
+	loader := config.NewLoader(*configPath, flag.CommandLine)
+	if err := loadConfig(loader, &cfg); err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+
 	// Configure logger
-	if *debug {
+	if err := log.Configure(cfg.LogFormat, cfg.LogLevel); err != nil {
+		log.Fatal().Err(err).Msg("Invalid logging configuration")
+	}
+	if cfg.Debug {
 		log.SetDebugMode()
 		log.Debug().Msg("Debug mode enabled")
 	}
 
-	// Validate backends
-	if backends == "" {
-		log.Fatal().Msg("At least one backend must be specified with -backends flag")
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		ServiceName: "cas-balancer",
+		Version:     "",
+		Endpoint:    cfg.OTLPEndpoint,
+		SampleRatio: cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize tracing")
 	}
 
-	backendList := strings.Split(backends, ",")
-	for i, backend := range backendList {
-		backendList[i] = strings.TrimSpace(backend)
-		if !strings.HasPrefix(backendList[i], "http://") && !strings.HasPrefix(backendList[i], "https://") {
-			log.Fatal().Str("backend", backendList[i]).Msg("Backend must start with http:// or https://")
-		}
+	// Watch the backends instead of using the configured list
+	var backendSource balancer.BackendSource
+	switch {
+	case cfg.BackendsFile != "":
+		backendSource = balancer.FileBackendSource{Path: cfg.BackendsFile}
+	case cfg.BackendsSRV != "":
+		backendSource = balancer.SRVBackendSource{Name: cfg.BackendsSRV, Scheme: cfg.BackendsSRVScheme}
 	}
 
 	log.Info().
-		Strs("backends", backendList).
-		Dur("health_check_interval", *healthCheckInterval).
-		Dur("health_check_timeout", *healthCheckTimeout).
-		Dur("request_timeout", *requestTimeout).
+		Strs("backends", cfg.Backends).
+		Dur("health_check_interval", cfg.HealthCheckInterval).
+		Dur("health_check_timeout", cfg.HealthCheckTimeout).
+		Dur("request_timeout", cfg.RequestTimeout).
 		Msg("Configured backends")
 
-	bServer := balancer.NewBalancerServer(
-		backendList,
-		*retryMax,
-		gracefulShutdownTimeout,
-		*retryWaitMin,
-		*retryWaitMax,
-		*requestTimeout,
-		*healthCheckInterval,
-		*healthCheckTimeout,
-		*debug,
-		*debugAddr,
-		*dbPath,
-	)
-	if err := bServer.Start(*addr); err != nil {
+	bServer := balancer.NewServer(balancer.ServerConfig{
+		Backends:                cfg.Backends,
+		RetryMax:                cfg.RetryMax,
+		RetryWaitMin:            cfg.RetryWaitMin,
+		RetryWaitMax:            cfg.RetryWaitMax,
+		RequestTimeout:          cfg.RequestTimeout,
+		GracefulShutdownTimeout: cfg.ShutdownTimeout,
+		HealthCheckInterval:     cfg.HealthCheckInterval,
+		HealthCheckTimeout:      cfg.HealthCheckTimeout,
+		Debug:                   cfg.Debug,
+		DebugAddr:               cfg.DebugAddr,
+		DBPath:                  cfg.DB,
+		DBDSN:                   cfg.DBDSN,
+	})
+	bServer.SetAdminToken(cfg.AdminToken)
+	if backendSource != nil {
+		bServer.SetBackendSource(backendSource, cfg.BackendsWatchInterval)
+	}
+	writeQuorum := cfg.WriteQuorum
+	if writeQuorum == 0 {
+		writeQuorum = cfg.ReplicationFactor/2 + 1
+	}
+	if backendSource == nil && cfg.ReplicationFactor > len(cfg.Backends) {
+		log.Warn().
+			Int("replication_factor", cfg.ReplicationFactor).
+			Int("backends", len(cfg.Backends)).
+			Msg("Replication factor exceeds the number of backends, uploads will be under-replicated")
+	}
+	bServer.SetReplication(cfg.ReplicationFactor, writeQuorum)
+	if err := bServer.SetPlacement(cfg.Placement); err != nil {
+		log.Fatal().Err(err).Msg("Invalid placement mode")
+	}
+	if err := bServer.SetUploadPolicy(cfg.UploadPolicy); err != nil {
+		log.Fatal().Err(err).Msg("Invalid upload placement policy")
+	}
+	bServer.SetHedging(cfg.HedgePercentile)
+	breakerConfig := balancer.DefaultBreakerConfig()
+	breakerConfig.Window = cfg.BreakerWindow
+	breakerConfig.MinRequests = cfg.BreakerMinRequests
+	breakerConfig.ErrorRate = cfg.BreakerErrorRate
+	breakerConfig.SlowThreshold = cfg.BreakerSlowThreshold
+	breakerConfig.ConsecutiveFailures = cfg.BreakerFailures
+	breakerConfig.OpenTimeout = cfg.BreakerOpenTimeout
+	bServer.SetBreakerConfig(breakerConfig)
+	bServer.SetNodeInfoInterval(cfg.NodeInfoInterval)
+	if err := bServer.SetAdmissionConfig(admissionConfig(&cfg)); err != nil {
+		log.Fatal().Err(err).Msg("Invalid admission limits")
+	}
+	bServer.SetLocationCache(cfg.LocationCacheSize, cfg.LocationCachePersist)
+	bServer.SetRepairConfig(balancer.RepairConfig{
+		Interval:      cfg.RepairInterval,
+		QueueInterval: cfg.RepairQueueInterval,
+		RequestRate:   cfg.RepairRate,
+		Bandwidth:     cfg.RepairBandwidth,
+	})
+	if err := bServer.SetMetadataReplication(balancer.MetadataReplicationConfig{
+		Self:              cfg.MetadataAdvertise,
+		Peers:             cfg.MetadataPeers,
+		HeartbeatInterval: cfg.MetadataHeartbeat,
+		ElectionTimeout:   cfg.MetadataElection,
+		CommitTimeout:     cfg.MetadataCommitTimeout,
+		LogRetention:      cfg.MetadataLogRetention,
+	}); err != nil {
+		log.Fatal().Err(err).Msg("Invalid metadata replication")
+	}
+	webhookConfig := webhook.DefaultConfig()
+	webhookConfig.URLs = cfg.WebhookURLs
+	webhookConfig.Secret = cfg.WebhookSecret
+	webhookConfig.MaxAttempts = cfg.WebhookMaxAttempts
+	webhookConfig.Retention = cfg.EventRetention
+	bServer.SetWebhookConfig(webhookConfig)
+	if auditLog := openAuditLog(cfg.AuditDB, cfg.AuditLog); auditLog != nil {
+		bServer.SetAuditLog(auditLog)
+	}
+
+	// Apply the settings that can change while serving on SIGHUP
+	stopReload := config.OnReload(func() {
+		reloaded := defaultConfig()
+		if err := loadConfig(loader, &reloaded); err != nil {
+			log.Error().Err(err).Str("config", loader.Path()).Msg("Configuration not reloaded")
+			return
+		}
+		if err := log.SetLevel(reloaded.LogLevel); err != nil {
+			log.Error().Err(err).Msg("Configuration not reloaded")
+			return
+		}
+		if reloaded.Debug {
+			log.SetDebugMode()
+		}
+		bServer.SetRequestTimeout(reloaded.RequestTimeout)
+		bServer.SetBackends(reloaded.Backends)
+		if err := bServer.SetAdmissionConfig(admissionConfig(&reloaded)); err != nil {
+			log.Error().Err(err).Msg("Admission limits not reloaded")
+		}
+		log.Info().
+			Str("config", loader.Path()).
+			Str("log_level", reloaded.LogLevel).
+			Strs("backends", reloaded.Backends).
+			Dur("request_timeout", reloaded.RequestTimeout).
+			Msg("Configuration reloaded")
+	})
+
+	if err := bServer.Start(cfg.Addr); err != nil {
 		log.Fatal().Err(err).Msg("Server failed to start")
 	}
+	stopReload()
+
+	// Flush spans of requests completed during shutdown
+	tracingCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	if err := shutdownTracing(tracingCtx); err != nil {
+		log.Warn().Err(err).Msg("Failed to flush traces")
+	}
+	cancel()
 
 	os.Exit(0)
 }
+
+// defaultConfig returns the configuration used for keys set neither on the command line
+// nor in the configuration file or environment.
+func defaultConfig() config.Balancer {
+	return config.Balancer{
+		Common: config.Common{
+			DebugAddr:        "localhost:6060",
+			LogFormat:        log.FormatConsole,
+			LogLevel:         "info",
+			TraceSampleRatio: defaultTraceSampleRatio,
+		},
+		Addr:                  ":8081",
+		BackendsSRVScheme:     "http",
+		BackendsWatchInterval: balancer.DefaultBackendWatchInterval,
+		RetryMax:              defaultRetryMax,
+		RetryWaitMin:          defaultRetryWaitMin,
+		RetryWaitMax:          defaultRetryWaitMax,
+		RequestTimeout:        defaultRequestTimeout,
+		ShutdownTimeout:       defaultShutdownTimeout,
+		HealthCheckInterval:   defaultHealthCheckInterval,
+		HealthCheckTimeout:    defaultHealthCheckTimeout,
+		NodeInfoInterval:      balancer.DefaultNodeInfoInterval,
+		BreakerWindow:         balancer.DefaultBreakerWindow,
+		BreakerMinRequests:    balancer.DefaultBreakerMinRequests,
+		BreakerErrorRate:      balancer.DefaultBreakerErrorRate,
+		BreakerSlowThreshold:  balancer.DefaultBreakerSlowThreshold,
+		BreakerFailures:       balancer.DefaultBreakerConsecutiveFailures,
+		BreakerOpenTimeout:    balancer.DefaultBreakerOpenTimeout,
+		MetadataHeartbeat:     balancer.DefaultMetadataHeartbeatInterval,
+		MetadataElection:      balancer.DefaultMetadataElectionTimeout,
+		MetadataCommitTimeout: balancer.DefaultMetadataCommitTimeout,
+		MetadataLogRetention:  balancer.DefaultMetadataLogRetention,
+		WebhookMaxAttempts:    webhook.DefaultConfig().MaxAttempts,
+		EventRetention:        webhook.DefaultConfig().Retention,
+		ReplicationFactor:     1,
+		Placement:             balancer.PlacementBroadcast,
+		UploadPolicy:          balancer.PolicyMostFree,
+		HedgePercentile:       balancer.DefaultHedgePercentile,
+		LocationCacheSize:     balancer.DefaultLocationCacheSize,
+		RepairInterval:        balancer.DefaultRepairConfig().Interval,
+		RepairQueueInterval:   balancer.DefaultRepairConfig().QueueInterval,
+		RepairRate:            balancer.DefaultRepairConfig().RequestRate,
+	}
+}
+
+// admissionConfig returns the rate limits and backend concurrency of cfg.
+func admissionConfig(cfg *config.Balancer) balancer.AdmissionConfig {
+	return balancer.AdmissionConfig{
+		Owner:              models.RateLimit{RequestsPerSecond: cfg.OwnerRequestRate, BytesPerSecond: cfg.OwnerByteRate},
+		Bucket:             models.RateLimit{RequestsPerSecond: cfg.BucketRequestRate, BytesPerSecond: cfg.BucketByteRate},
+		BackendConcurrency: cfg.BackendConcurrency,
+	}
+}
+
+// loadConfig loads cfg, holding the defaults, and validates it.
+func loadConfig(loader *config.Loader, cfg *config.Balancer) error {
+	if err := loader.Load(cfg); err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
+
+// openAuditLog opens the configured audit sinks. The SQLite sink is listed first so it serves queries.
+func openAuditLog(dbPath, filePath string) *audit.Log {
+	var sinks []audit.Sink
+	if dbPath != "" {
+		sink, err := audit.NewSQLiteSink(dbPath)
+		if err != nil {
+			log.Fatal().Err(err).Str("audit_db", dbPath).Msg("Failed to open audit database")
+		}
+		sinks = append(sinks, sink)
+	}
+	if filePath != "" {
+		sink, err := audit.NewFileSink(filePath)
+		if err != nil {
+			log.Fatal().Err(err).Str("audit_log", filePath).Msg("Failed to open audit log")
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil
+	}
+	log.Info().Str("audit_db", dbPath).Str("audit_log", filePath).Msg("Audit log enabled")
+	return audit.NewLog(sinks...)
+}
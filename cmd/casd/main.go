@@ -1,20 +1,29 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"flag"
 	"os"
 	"strings"
+	"time"
 
+	"loopfs/pkg/config"
 	"loopfs/pkg/log"
 	"loopfs/pkg/manager"
+	"loopfs/pkg/models"
 	"loopfs/pkg/server/casd"
 	"loopfs/pkg/store/loop"
+	"loopfs/pkg/tracing"
 )
 
 const (
 	oneGB          = 1024
+	oneMB          = 1024 * 1024 // Bytes per megabyte
 	storageDirPerm = 0750
+
+	defaultTraceSampleRatio = 1.0
+	tracingShutdownTimeout  = 5 * time.Second
 )
 
 //go:embed VERSION
@@ -24,63 +33,172 @@ func main() {
 	// Initialize logger first
 	_ = log.Logger
 
-	storageDir := flag.String("storage", "/data/cas", "Storage directory path")
-	webDir := flag.String("web", "web", "Web assets directory path")
-	addr := flag.String("addr", "127.0.0.1:8080", "Server addr")
-	loopFileSize := flag.Int64("loop-size", oneGB, "Loop file size in megabytes (defaults to 1024)")
-	debug := flag.Bool("debug", false, "Debug mode")
-	debugAddr := flag.String("debug-addr", "localhost:6060", "Debug server address (pprof)")
+	// Flags override the configuration file and environment, the defaults are the flag defaults
+	cfg := defaultConfig()
+	configPath := flag.String("config", "", "YAML or TOML configuration file, reloaded on SIGHUP")
+	flag.StringVar(&cfg.Storage, "storage", cfg.Storage, "Storage directory path")
+	flag.StringVar(&cfg.Web, "web", cfg.Web, "Web assets directory path")
+	flag.StringVar(&cfg.Addr, "addr", cfg.Addr, "Server addr")
+	flag.Int64Var(&cfg.LoopSize, "loop-size", cfg.LoopSize, "Loop file size in megabytes (defaults to 1024)")
+	flag.BoolVar(&cfg.Debug, "debug", cfg.Debug, "Debug mode")
+	flag.StringVar(&cfg.DebugAddr, "debug-addr", cfg.DebugAddr, "Debug server address (pprof)")
 
 	// Timeout configuration flags - use default values from the loop package
-	defaultTimeouts := loop.DefaultTimeoutConfig()
-	baseTimeout := flag.Duration("base-timeout", defaultTimeouts.BaseCommandTimeout, "Timeout for fast operations (mount, unmount, stat)")
-	ddTimeoutPerGB := flag.Duration("dd-timeout-per-gb", defaultTimeouts.DDTimeoutPerGB, "Timeout per GB for dd operations")
-	mkfsTimeoutPerGB := flag.Duration("mkfs-timeout-per-gb", defaultTimeouts.MkfsTimeoutPerGB, "Timeout per GB for mkfs operations")
-	rsyncTimeoutPerGB := flag.Duration("rsync-timeout-per-gb", defaultTimeouts.RsyncTimeoutPerGB, "Timeout per GB for rsync operations")
-	minLongTimeout := flag.Duration("min-long-timeout", defaultTimeouts.MinLongOpTimeout, "Minimum timeout for long operations")
-	maxLongTimeout := flag.Duration("max-long-timeout", defaultTimeouts.MaxLongOpTimeout, "Maximum timeout for long operations")
-	mountCacheTTL := flag.Duration("mount-ttl", loop.DefaultMountCacheTTL(), "Duration to keep loop mounts active after the last request")
+	flag.DurationVar(&cfg.BaseTimeout, "base-timeout", cfg.BaseTimeout, "Timeout for fast operations (mount, unmount, stat)")
+	flag.DurationVar(&cfg.DDTimeoutPerGB, "dd-timeout-per-gb", cfg.DDTimeoutPerGB, "Timeout per GB for dd operations")
+	flag.DurationVar(&cfg.MkfsTimeoutPerGB, "mkfs-timeout-per-gb", cfg.MkfsTimeoutPerGB, "Timeout per GB for mkfs operations")
+	flag.DurationVar(&cfg.RsyncTimeoutPerGB, "rsync-timeout-per-gb", cfg.RsyncTimeoutPerGB, "Timeout per GB for rsync operations")
+	flag.DurationVar(&cfg.MinLongTimeout, "min-long-timeout", cfg.MinLongTimeout, "Minimum timeout for long operations")
+	flag.DurationVar(&cfg.MaxLongTimeout, "max-long-timeout", cfg.MaxLongTimeout, "Maximum timeout for long operations")
+	flag.DurationVar(&cfg.MountTTL, "mount-ttl", cfg.MountTTL, "Duration to keep loop mounts active after the last request")
+	flag.Int64Var(&cfg.MaxObjectSize, "max-object-size", cfg.MaxObjectSize, "Maximum upload size in bytes (0 means unlimited)")
+	flag.Float64Var(&cfg.HighWaterMark, "high-water-mark", cfg.HighWaterMark, "Host disk usage in percent above which the node becomes read-only (0 disables)")
+	flag.StringVar(&cfg.Mode, "mode", cfg.Mode, "Node mode: normal, read-only or draining")
+	flag.StringVar(&cfg.AdminToken, "admin-token", cfg.AdminToken, "Bearer token required by the admin API (empty restricts it to loopback clients)")
+	flag.DurationVar(&cfg.FsckInterval, "fsck-interval", cfg.FsckInterval, "Interval between background filesystem checks of idle loop images (0 disables)")
+	flag.Int64Var(&cfg.PackThreshold, "pack-threshold", cfg.PackThreshold, "Blobs smaller than this many bytes are stored in a per-image pack file (0 disables packing)")
+
+	flag.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "Log output format: console or json")
+	flag.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "Minimum log level: trace, debug, info, warn or error")
+
+	flag.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", cfg.OTLPEndpoint, "OTLP/HTTP collector URL for traces, e.g. http://localhost:4318 (empty disables tracing)")
+	flag.Float64Var(&cfg.TraceSampleRatio, "trace-sample-ratio", cfg.TraceSampleRatio, "Fraction of new traces to record (0-1)")
 
 	flag.Parse()
 
+	loader := config.NewLoader(*configPath, flag.CommandLine)
+	if err := loadConfig(loader, &cfg); err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+
 	// Configure logger
-	if *debug {
+	if err := log.Configure(cfg.LogFormat, cfg.LogLevel); err != nil {
+		log.Fatal().Err(err).Msg("Invalid logging configuration")
+	}
+	if cfg.Debug {
 		log.SetDebugMode()
 		log.Debug().Msg("Debug mode enabled")
 	}
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		ServiceName: "casd",
+		Version:     strings.TrimSpace(Version),
+		Endpoint:    cfg.OTLPEndpoint,
+		SampleRatio: cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize tracing")
+	}
+
 	// Check if running as root
 	if os.Getuid() != 0 {
 		log.Fatal().Msg("casd must be run as root")
 	}
 
 	// Ensure a storage directory exists.
-	if err := os.MkdirAll(*storageDir, storageDirPerm); err != nil {
-		log.Fatal().Err(err).Str("storage_dir", *storageDir).Msg("Failed to create storage directory")
+	if err := os.MkdirAll(cfg.Storage, storageDirPerm); err != nil {
+		log.Fatal().Err(err).Str("storage_dir", cfg.Storage).Msg("Failed to create storage directory")
 	}
 
 	// Check if web directory exists
-	if _, err := os.Stat(*webDir); os.IsNotExist(err) {
-		log.Fatal().Str("web_dir", *webDir).Msg("Web directory does not exist")
-	}
-
-	// Create timeout configuration from command-line flags
-	timeoutConfig := loop.TimeoutConfig{
-		BaseCommandTimeout: *baseTimeout,
-		DDTimeoutPerGB:     *ddTimeoutPerGB,
-		MkfsTimeoutPerGB:   *mkfsTimeoutPerGB,
-		RsyncTimeoutPerGB:  *rsyncTimeoutPerGB,
-		MinLongOpTimeout:   *minLongTimeout,
-		MaxLongOpTimeout:   *maxLongTimeout,
+	if _, err := os.Stat(cfg.Web); os.IsNotExist(err) {
+		log.Fatal().Str("web_dir", cfg.Web).Msg("Web directory does not exist")
 	}
 
-	loopStore := loop.New(*storageDir, *loopFileSize, timeoutConfig, *mountCacheTTL)
+	loopStore := loop.New(cfg.Storage, cfg.LoopSize, timeoutConfig(&cfg), cfg.MountTTL)
+	loopStore.SetPackThreshold(cfg.PackThreshold)
+	loopStore.StartHealthChecks(cfg.FsckInterval)
 	// Initialize Store Manager with the default buffer size (128MB)
 	storeMgr := manager.New(loopStore, manager.DefaultBufferSize)
-	cas := casd.NewCASServer(*storageDir, *webDir, strings.TrimSpace(Version), storeMgr, *debug, *debugAddr)
+	storeMgr.EnableCapacityPlanning(cfg.Storage, cfg.LoopSize*oneMB)
+	storeMgr.SetHighWaterMark(cfg.HighWaterMark)
+	cas := casd.NewCASServer(cfg.Storage, cfg.Web, strings.TrimSpace(Version), storeMgr, cfg.Debug, cfg.DebugAddr)
+	cas.SetMaxObjectSize(cfg.MaxObjectSize)
+	cas.SetAdminToken(cfg.AdminToken)
+	if err := cas.SetMode(models.NodeMode(cfg.Mode)); err != nil {
+		log.Fatal().Err(err).Msg("Invalid node mode")
+	}
+
+	// Apply the settings that can change while serving on SIGHUP
+	stopReload := config.OnReload(func() {
+		reloaded := defaultConfig()
+		if err := loadConfig(loader, &reloaded); err != nil {
+			log.Error().Err(err).Str("config", loader.Path()).Msg("Configuration not reloaded")
+			return
+		}
+		if err := log.SetLevel(reloaded.LogLevel); err != nil {
+			log.Error().Err(err).Msg("Configuration not reloaded")
+			return
+		}
+		if reloaded.Debug {
+			log.SetDebugMode()
+		}
+		loopStore.SetTimeouts(timeoutConfig(&reloaded))
+		loopStore.SetMountTTL(reloaded.MountTTL)
+		log.Info().
+			Str("config", loader.Path()).
+			Str("log_level", reloaded.LogLevel).
+			Dur("mount_ttl", reloaded.MountTTL).
+			Msg("Configuration reloaded")
+	})
 
-	if err := cas.Start(*addr); err != nil {
+	if err := cas.Start(cfg.Addr); err != nil {
 		log.Fatal().Err(err).Msg("Server failed to start")
 	}
+	stopReload()
+
+	// Flush spans of requests completed during shutdown
+	tracingCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	if err := shutdownTracing(tracingCtx); err != nil {
+		log.Warn().Err(err).Msg("Failed to flush traces")
+	}
+	cancel()
 
 	os.Exit(0)
 }
+
+// defaultConfig returns the configuration used for keys set neither on the command line
+// nor in the configuration file or environment.
+func defaultConfig() config.CASD {
+	defaultTimeouts := loop.DefaultTimeoutConfig()
+	return config.CASD{
+		Common: config.Common{
+			DebugAddr:        "localhost:6060",
+			LogFormat:        log.FormatConsole,
+			LogLevel:         "info",
+			TraceSampleRatio: defaultTraceSampleRatio,
+		},
+		Addr:              "127.0.0.1:8080",
+		Storage:           "/data/cas",
+		Web:               "web",
+		LoopSize:          oneGB,
+		BaseTimeout:       defaultTimeouts.BaseCommandTimeout,
+		DDTimeoutPerGB:    defaultTimeouts.DDTimeoutPerGB,
+		MkfsTimeoutPerGB:  defaultTimeouts.MkfsTimeoutPerGB,
+		RsyncTimeoutPerGB: defaultTimeouts.RsyncTimeoutPerGB,
+		MinLongTimeout:    defaultTimeouts.MinLongOpTimeout,
+		MaxLongTimeout:    defaultTimeouts.MaxLongOpTimeout,
+		MountTTL:          loop.DefaultMountCacheTTL(),
+		Mode:              string(models.NodeModeNormal),
+		FsckInterval:      loop.DefaultFsckInterval,
+	}
+}
+
+// loadConfig loads cfg, holding the defaults, and validates it.
+func loadConfig(loader *config.Loader, cfg *config.CASD) error {
+	if err := loader.Load(cfg); err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
+
+// timeoutConfig returns the loop operation timeouts of cfg.
+func timeoutConfig(cfg *config.CASD) loop.TimeoutConfig {
+	return loop.TimeoutConfig{
+		BaseCommandTimeout: cfg.BaseTimeout,
+		DDTimeoutPerGB:     cfg.DDTimeoutPerGB,
+		MkfsTimeoutPerGB:   cfg.MkfsTimeoutPerGB,
+		RsyncTimeoutPerGB:  cfg.RsyncTimeoutPerGB,
+		MinLongOpTimeout:   cfg.MinLongTimeout,
+		MaxLongOpTimeout:   cfg.MaxLongTimeout,
+	}
+}
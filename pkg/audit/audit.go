@@ -0,0 +1,135 @@
+// Package audit records mutating operations in an append-only audit log.
+package audit
+
+import (
+	"errors"
+	"time"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionUpload       = "upload"
+	ActionDelete       = "delete"
+	ActionBucketCreate = "bucket_create"
+	ActionBucketDelete = "bucket_delete"
+	ActionObjectPut    = "object_put"
+	ActionObjectDelete = "object_delete"
+)
+
+// Results recorded in the audit log.
+const (
+	ResultSuccess = "success"
+	ResultDenied  = "denied"
+	ResultFailure = "failure"
+)
+
+const (
+	// DefaultQueryLimit is the number of entries returned when a query sets no limit.
+	DefaultQueryLimit = 100
+	// MaxQueryLimit is the largest number of entries a query returns.
+	MaxQueryLimit = 1000
+)
+
+// ErrQueryUnsupported is returned when no configured sink can be queried.
+var ErrQueryUnsupported = errors.New("audit log is not queryable")
+
+// Sink stores audit entries.
+type Sink interface {
+	Append(entry *models.AuditEntry) error
+	Close() error
+}
+
+// Querier is implemented by sinks that can search their entries.
+type Querier interface {
+	Query(filter Filter) ([]models.AuditEntry, error)
+}
+
+// Filter selects audit entries. Zero values match everything.
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	Bucket string
+	Actor  string
+	Action string
+	Limit  int
+}
+
+// limit returns the effective result limit.
+func (f *Filter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultQueryLimit
+	}
+	return min(f.Limit, MaxQueryLimit)
+}
+
+// matches reports whether entry passes the filter.
+func (f *Filter) matches(entry *models.AuditEntry) bool {
+	switch {
+	case !f.Since.IsZero() && entry.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !entry.Time.Before(f.Until):
+		return false
+	case f.Bucket != "" && entry.Bucket != f.Bucket:
+		return false
+	case f.Actor != "" && entry.Actor != f.Actor:
+		return false
+	case f.Action != "" && entry.Action != f.Action:
+		return false
+	}
+	return true
+}
+
+// Log writes audit entries to every configured sink.
+type Log struct {
+	sinks   []Sink
+	querier Querier
+}
+
+// NewLog creates an audit log writing to sinks. Queries are served by the first sink that implements Querier.
+func NewLog(sinks ...Sink) *Log {
+	auditLog := &Log{sinks: sinks}
+	for _, sink := range sinks {
+		if querier, ok := sink.(Querier); ok {
+			auditLog.querier = querier
+			break
+		}
+	}
+	return auditLog
+}
+
+// Record appends entry to every sink. Failures are logged rather than returned so that
+// an unavailable audit sink does not fail the operation being audited.
+func (l *Log) Record(entry *models.AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	for _, sink := range l.sinks {
+		if err := sink.Append(entry); err != nil {
+			log.Error().
+				Err(err).
+				Str("action", entry.Action).
+				Str("actor", entry.Actor).
+				Msg("Failed to write audit entry")
+		}
+	}
+}
+
+// Query returns entries matching filter, newest first.
+func (l *Log) Query(filter Filter) ([]models.AuditEntry, error) {
+	if l.querier == nil {
+		return nil, ErrQueryUnsupported
+	}
+	return l.querier.Query(filter)
+}
+
+// Close closes every sink.
+func (l *Log) Close() error {
+	var errs []error
+	for _, sink := range l.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// memorySink records entries in memory
+type memorySink struct {
+	entries []models.AuditEntry
+	err     error
+	closed  bool
+}
+
+func (m *memorySink) Append(entry *models.AuditEntry) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+func (m *memorySink) Close() error {
+	m.closed = true
+	return nil
+}
+
+// AuditTestSuite tests the audit log fan-out and filters
+type AuditTestSuite struct {
+	suite.Suite
+}
+
+// TestRecordWritesAllSinks tests that entries reach every sink even when one fails
+func (s *AuditTestSuite) TestRecordWritesAllSinks() {
+	failing := &memorySink{err: errors.New("disk full")}
+	working := &memorySink{}
+	auditLog := NewLog(failing, working)
+
+	auditLog.Record(&models.AuditEntry{Actor: "alice", Action: ActionDelete, Hash: "abc"})
+
+	s.Require().Len(working.entries, 1)
+	s.Equal("alice", working.entries[0].Actor)
+	s.False(working.entries[0].Time.IsZero())
+
+	s.NoError(auditLog.Close())
+	s.True(failing.closed)
+	s.True(working.closed)
+}
+
+// TestQueryUnsupported tests querying without a queryable sink
+func (s *AuditTestSuite) TestQueryUnsupported() {
+	_, err := NewLog(&memorySink{}).Query(Filter{})
+	s.ErrorIs(err, ErrQueryUnsupported)
+}
+
+// TestFilterMatches tests entry filtering
+func (s *AuditTestSuite) TestFilterMatches() {
+	now := time.Now()
+	entry := &models.AuditEntry{Time: now, Actor: "alice", Action: ActionObjectPut, Bucket: "photos"}
+
+	s.True((&Filter{}).matches(entry))
+	s.True((&Filter{Since: now, Until: now.Add(time.Second)}).matches(entry))
+	s.False((&Filter{Since: now.Add(time.Second)}).matches(entry))
+	s.False((&Filter{Until: now}).matches(entry), "until is exclusive")
+	s.True((&Filter{Bucket: "photos", Actor: "alice", Action: ActionObjectPut}).matches(entry))
+	s.False((&Filter{Bucket: "docs"}).matches(entry))
+	s.False((&Filter{Actor: "bob"}).matches(entry))
+	s.False((&Filter{Action: ActionObjectDelete}).matches(entry))
+}
+
+// TestFilterLimit tests limit defaults and bounds
+func (s *AuditTestSuite) TestFilterLimit() {
+	s.Equal(DefaultQueryLimit, (&Filter{}).limit())
+	s.Equal(5, (&Filter{Limit: 5}).limit())
+	s.Equal(MaxQueryLimit, (&Filter{Limit: MaxQueryLimit + 1}).limit())
+}
+
+// TestAuditTestSuite runs the audit test suite
+func TestAuditTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditTestSuite))
+}
@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"loopfs/pkg/models"
+)
+
+const (
+	// auditFilePerm restricts the audit file to its owner.
+	auditFilePerm = 0o600
+	// maxLineSize bounds the length of a single JSON line when reading the file back.
+	maxLineSize = 1 << 20
+)
+
+// FileSink appends audit entries to a file as JSON lines.
+type FileSink struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewFileSink opens path for appending, creating it if needed.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, auditFilePerm) //nolint:gosec // path is operator configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &FileSink{path: path, file: file}, nil
+}
+
+// Append writes entry as a single JSON line.
+func (f *FileSink) Append(entry *models.AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Query scans the file for entries matching filter, newest first.
+func (f *FileSink) Query(filter Filter) ([]models.AuditEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	limit := filter.limit()
+	entries := []models.AuditEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+	for scanner.Scan() {
+		var entry models.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Skip a torn trailing line rather than failing the whole query
+			continue
+		}
+		if !filter.matches(&entry) {
+			continue
+		}
+		entries = append(entries, entry)
+		if len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// Close closes the file.
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// FileSinkTestSuite tests the JSON-lines audit sink
+type FileSinkTestSuite struct {
+	suite.Suite
+	path string
+	sink *FileSink
+}
+
+// SetupTest opens a sink in a temporary directory
+func (s *FileSinkTestSuite) SetupTest() {
+	s.path = filepath.Join(s.T().TempDir(), "audit.log")
+	var err error
+	s.sink, err = NewFileSink(s.path)
+	s.Require().NoError(err)
+}
+
+// TearDownTest closes the sink
+func (s *FileSinkTestSuite) TearDownTest() {
+	_ = s.sink.Close()
+}
+
+// TestAppendAndQuery tests that entries are appended and returned newest first
+func (s *FileSinkTestSuite) TestAppendAndQuery() {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, actor := range []string{"alice", "bob", "alice"} {
+		s.Require().NoError(s.sink.Append(&models.AuditEntry{
+			Time:   start.Add(time.Duration(i) * time.Minute),
+			Actor:  actor,
+			Action: ActionUpload,
+			Hash:   "hash" + actor,
+			Status: 200,
+			Result: ResultSuccess,
+		}))
+	}
+
+	entries, err := s.sink.Query(Filter{Actor: "alice"})
+	s.Require().NoError(err)
+	s.Require().Len(entries, 2)
+	s.Equal(start.Add(2*time.Minute), entries[0].Time)
+	s.Equal(start, entries[1].Time)
+
+	entries, err = s.sink.Query(Filter{Limit: 2})
+	s.Require().NoError(err)
+	s.Require().Len(entries, 2)
+	s.Equal("alice", entries[0].Actor)
+	s.Equal("bob", entries[1].Actor)
+
+	entries, err = s.sink.Query(Filter{Since: start.Add(time.Minute), Until: start.Add(2 * time.Minute)})
+	s.Require().NoError(err)
+	s.Require().Len(entries, 1)
+	s.Equal("bob", entries[0].Actor)
+}
+
+// TestAppendOnly tests that reopening the file keeps existing entries and skips torn lines
+func (s *FileSinkTestSuite) TestAppendOnly() {
+	s.Require().NoError(s.sink.Append(&models.AuditEntry{Time: time.Now(), Actor: "alice", Action: ActionDelete}))
+	s.Require().NoError(s.sink.Close())
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0)
+	s.Require().NoError(err)
+	_, err = file.WriteString(`{"actor":"tor`)
+	s.Require().NoError(err)
+	s.Require().NoError(file.Close())
+
+	s.sink, err = NewFileSink(s.path)
+	s.Require().NoError(err)
+	entries, err := s.sink.Query(Filter{})
+	s.Require().NoError(err)
+	s.Require().Len(entries, 1)
+	s.Equal(ActionDelete, entries[0].Action)
+
+	info, err := os.Stat(s.path)
+	s.Require().NoError(err)
+	s.Equal(os.FileMode(auditFilePerm), info.Mode().Perm())
+}
+
+// TestFileSinkTestSuite runs the file sink test suite
+func TestFileSinkTestSuite(t *testing.T) {
+	suite.Run(t, new(FileSinkTestSuite))
+}
@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"loopfs/pkg/models"
+
+	_ "modernc.org/sqlite"
+)
+
+// schema creates the audit table. Timestamps are stored as Unix nanoseconds so range
+// queries compare integers.
+const schema = `
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    occurred_at INTEGER NOT NULL,
+    actor       TEXT NOT NULL,
+    action      TEXT NOT NULL,
+    bucket      TEXT NOT NULL DEFAULT '',
+    key         TEXT NOT NULL DEFAULT '',
+    hash        TEXT NOT NULL DEFAULT '',
+    source_ip   TEXT NOT NULL DEFAULT '',
+    request_id  TEXT NOT NULL DEFAULT '',
+    status      INTEGER NOT NULL,
+    result      TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_time ON audit_log(occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_bucket ON audit_log(bucket, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_actor ON audit_log(actor, occurred_at);
+`
+
+// SQLiteSink stores audit entries in an SQLite table.
+type SQLiteSink struct {
+	db *sql.DB
+}
+
+// NewSQLiteSink opens or creates the audit database at dbPath.
+func NewSQLiteSink(dbPath string) (*SQLiteSink, error) {
+	database, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit database: %w", err)
+	}
+
+	ctx := context.Background()
+	if _, err := database.ExecContext(ctx, "PRAGMA journal_mode = WAL"); err != nil {
+		_ = database.Close()
+		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
+	}
+	if _, err := database.ExecContext(ctx, schema); err != nil {
+		_ = database.Close()
+		return nil, fmt.Errorf("failed to create audit schema: %w", err)
+	}
+	return &SQLiteSink{db: database}, nil
+}
+
+// Append inserts entry and sets its ID.
+func (s *SQLiteSink) Append(entry *models.AuditEntry) error {
+	result, err := s.db.ExecContext(context.Background(), `
+		INSERT INTO audit_log (occurred_at, actor, action, bucket, key, hash, source_ip, request_id, status, result)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.Time.UnixNano(), entry.Actor, entry.Action, entry.Bucket, entry.Key, entry.Hash,
+		entry.SourceIP, entry.RequestID, entry.Status, entry.Result)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		entry.ID = id
+	}
+	return nil
+}
+
+// Query returns entries matching filter, newest first.
+func (s *SQLiteSink) Query(filter Filter) ([]models.AuditEntry, error) {
+	var conditions []string
+	var args []any
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "occurred_at >= ?")
+		args = append(args, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "occurred_at < ?")
+		args = append(args, filter.Until.UnixNano())
+	}
+	for column, value := range map[string]string{"bucket": filter.Bucket, "actor": filter.Actor, "action": filter.Action} {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+
+	query := `SELECT id, occurred_at, actor, action, bucket, key, hash, source_ip, request_id, status, result FROM audit_log`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY occurred_at DESC, id DESC LIMIT ?"
+	args = append(args, filter.limit())
+
+	rows, err := s.db.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var occurredAt int64
+		if err := rows.Scan(&entry.ID, &occurredAt, &entry.Actor, &entry.Action, &entry.Bucket, &entry.Key,
+			&entry.Hash, &entry.SourceIP, &entry.RequestID, &entry.Status, &entry.Result); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entry.Time = time.Unix(0, occurredAt).UTC()
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// Close closes the database.
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
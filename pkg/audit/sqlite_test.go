@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// SQLiteSinkTestSuite tests the SQLite audit sink
+type SQLiteSinkTestSuite struct {
+	suite.Suite
+	dbPath string
+	sink   *SQLiteSink
+}
+
+// SetupTest opens a sink in a temporary directory
+func (s *SQLiteSinkTestSuite) SetupTest() {
+	s.dbPath = filepath.Join(s.T().TempDir(), "audit.db")
+	var err error
+	s.sink, err = NewSQLiteSink(s.dbPath)
+	s.Require().NoError(err)
+}
+
+// TearDownTest closes the sink
+func (s *SQLiteSinkTestSuite) TearDownTest() {
+	_ = s.sink.Close()
+}
+
+// TestAppendAndQuery tests inserting and filtering entries
+func (s *SQLiteSinkTestSuite) TestAppendAndQuery() {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []models.AuditEntry{
+		{Actor: "alice", Action: ActionBucketCreate, Bucket: "photos", Status: 201, Result: ResultSuccess},
+		{Actor: "alice", Action: ActionObjectPut, Bucket: "photos", Key: "a.jpg", Hash: "h1", Status: 200, Result: ResultSuccess},
+		{Actor: "bob", Action: ActionObjectDelete, Bucket: "photos", Key: "a.jpg", Status: 403, Result: ResultDenied},
+		{Actor: "bob", Action: ActionDelete, Hash: "h1", SourceIP: "10.0.0.1", RequestID: "req-1", Status: 200, Result: ResultSuccess},
+	}
+	for i := range entries {
+		entries[i].Time = start.Add(time.Duration(i) * time.Minute)
+		s.Require().NoError(s.sink.Append(&entries[i]))
+		s.Equal(int64(i+1), entries[i].ID)
+	}
+
+	result, err := s.sink.Query(Filter{})
+	s.Require().NoError(err)
+	s.Require().Len(result, 4)
+	s.Equal(entries[3], result[0])
+	s.Equal(entries[0], result[3])
+
+	result, err = s.sink.Query(Filter{Bucket: "photos", Actor: "bob"})
+	s.Require().NoError(err)
+	s.Require().Len(result, 1)
+	s.Equal(ResultDenied, result[0].Result)
+
+	result, err = s.sink.Query(Filter{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)})
+	s.Require().NoError(err)
+	s.Require().Len(result, 2)
+	s.Equal(ActionObjectDelete, result[0].Action)
+	s.Equal(ActionObjectPut, result[1].Action)
+
+	result, err = s.sink.Query(Filter{Action: ActionDelete, Limit: 1})
+	s.Require().NoError(err)
+	s.Require().Len(result, 1)
+	s.Equal("h1", result[0].Hash)
+
+	result, err = s.sink.Query(Filter{Actor: "carol"})
+	s.Require().NoError(err)
+	s.NotNil(result)
+	s.Empty(result)
+}
+
+// TestReopen tests that entries survive reopening the database
+func (s *SQLiteSinkTestSuite) TestReopen() {
+	s.Require().NoError(s.sink.Append(&models.AuditEntry{Time: time.Now(), Actor: "alice", Action: ActionUpload}))
+	s.Require().NoError(s.sink.Close())
+
+	var err error
+	s.sink, err = NewSQLiteSink(s.dbPath)
+	s.Require().NoError(err)
+	result, err := s.sink.Query(Filter{})
+	s.Require().NoError(err)
+	s.Len(result, 1)
+}
+
+// TestSQLiteSinkTestSuite runs the SQLite sink test suite
+func TestSQLiteSinkTestSuite(t *testing.T) {
+	suite.Run(t, new(SQLiteSinkTestSuite))
+}
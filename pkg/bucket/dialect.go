@@ -0,0 +1,193 @@
+package bucket
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// dialect holds what differs between the databases a Store runs on. Queries are written with
+// ? placeholders in the SQL both databases accept.
+type dialect struct {
+	name           string // Database system, as named by OpenTelemetry
+	schema         string
+	numberedParams bool   // Placeholders are $1, $2, ... instead of ?
+	columnExists   string // Query reporting whether the table (first argument) has the column (second argument)
+	oldestEventID  string // Query for OldestEventID
+	beginTx        string // Statement run first in every transaction, empty for none
+	// syncSequence advances the ID sequence of a table, formatted in, past an ID inserted
+	// explicitly (the argument). Empty if the database does so by itself.
+	syncSequence string
+	// resetSequence are the statements making the next ID of a table, formatted in, follow
+	// the argument, even if the table had larger IDs.
+	resetSequence   []string
+	uniqueViolation func(err error) bool
+}
+
+// sqliteDialect is the dialect of SQLite databases.
+var sqliteDialect = &dialect{
+	name:         "sqlite",
+	schema:       Schema,
+	columnExists: `SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`,
+	oldestEventID: `SELECT COALESCE(
+		(SELECT MIN(id) FROM events),
+		(SELECT seq + 1 FROM sqlite_sequence WHERE name = 'events'),
+		0)`,
+	resetSequence: []string{
+		`UPDATE sqlite_sequence SET seq = ? WHERE name = '%[1]s'`,
+		`INSERT INTO sqlite_sequence (name, seq) SELECT '%[1]s', ?
+		 WHERE NOT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = '%[1]s')`,
+	},
+	uniqueViolation: func(err error) bool {
+		return strings.Contains(err.Error(), "UNIQUE constraint failed")
+	},
+}
+
+// postgresAdvisoryLock is the key of the advisory lock serializing the transactions of every
+// store sharing a PostgreSQL database, so events commit in ID order.
+const postgresAdvisoryLock = 0x6c6f6f7066730001
+
+// postgresDialect is the dialect of PostgreSQL databases.
+var postgresDialect = &dialect{
+	name:           "postgresql",
+	schema:         PostgresSchema,
+	numberedParams: true,
+	columnExists: `SELECT EXISTS(SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = CAST(? AS TEXT) AND column_name = CAST(? AS TEXT))`,
+	oldestEventID: `SELECT COALESCE(
+		(SELECT MIN(id) FROM events),
+		(SELECT last_value + 1 FROM events_id_seq WHERE is_called),
+		0)`,
+	beginTx:      `SELECT pg_advisory_xact_lock(` + strconv.FormatInt(postgresAdvisoryLock, 10) + `)`,
+	syncSequence: `SELECT setval('%[1]s_id_seq', GREATEST(last_value, ?)) FROM %[1]s_id_seq`,
+	// A sequence cannot be set to 0, so it is set to 1 as not yet used instead
+	resetSequence: []string{
+		`SELECT setval('%[1]s_id_seq', GREATEST(target.id, 1), target.id > 0) FROM (SELECT CAST(? AS BIGINT) AS id) AS target`,
+	},
+	uniqueViolation: func(err error) bool {
+		var pgErr *pgconn.PgError
+		return errors.As(err, &pgErr) && pgErr.Code == "23505"
+	},
+}
+
+// rebind rewrites the ? placeholders of query for the dialect. Question marks in string
+// literals are left alone.
+func (d *dialect) rebind(query string) string {
+	if !d.numberedParams || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var (
+		b       strings.Builder
+		n       int
+		inQuote bool
+	)
+	b.Grow(len(query) + 8)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+		case c == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// sqlDB is a database connection pool running queries in the store's dialect.
+type sqlDB struct {
+	db      *sql.DB
+	dialect *dialect
+}
+
+// ExecContext executes a query without returning rows.
+func (d *sqlDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.db.ExecContext(ctx, d.dialect.rebind(query), args...)
+}
+
+// QueryContext executes a query returning rows.
+func (d *sqlDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.db.QueryContext(ctx, d.dialect.rebind(query), args...)
+}
+
+// QueryRowContext executes a query returning at most one row.
+func (d *sqlDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.db.QueryRowContext(ctx, d.dialect.rebind(query), args...)
+}
+
+// BeginTx starts a transaction.
+func (d *sqlDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sqlTx, error) {
+	tx, err := d.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if d.dialect.beginTx != "" {
+		if _, err := tx.ExecContext(ctx, d.dialect.beginTx); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+	return &sqlTx{tx: tx, dialect: d.dialect}, nil
+}
+
+// Close closes the connection pool.
+func (d *sqlDB) Close() error {
+	return d.db.Close()
+}
+
+// sqlTx is a transaction running queries in the store's dialect.
+type sqlTx struct {
+	tx      *sql.Tx
+	dialect *dialect
+}
+
+// ExecContext executes a query without returning rows.
+func (t *sqlTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, t.dialect.rebind(query), args...)
+}
+
+// QueryRowContext executes a query returning at most one row.
+func (t *sqlTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.tx.QueryRowContext(ctx, t.dialect.rebind(query), args...)
+}
+
+// Commit commits the transaction.
+func (t *sqlTx) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback aborts the transaction.
+func (t *sqlTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// syncSequence makes IDs assigned to new rows of table follow id, which was inserted explicitly.
+func (t *sqlTx) syncSequence(ctx context.Context, table string, id int64) error {
+	if t.dialect.syncSequence == "" {
+		return nil
+	}
+	if _, err := t.ExecContext(ctx, fmt.Sprintf(t.dialect.syncSequence, table), id); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// resetSequence makes IDs assigned to new rows of table follow id, even if it had larger IDs.
+func (t *sqlTx) resetSequence(ctx context.Context, table string, id int64) error {
+	for _, statement := range t.dialect.resetSequence {
+		if _, err := t.ExecContext(ctx, fmt.Sprintf(statement, table), id); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+		}
+	}
+	return nil
+}
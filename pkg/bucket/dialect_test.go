@@ -0,0 +1,136 @@
+package bucket
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// postgresDSNEnv names the environment variable with the DSN of a PostgreSQL database the
+// store tests run against instead of SQLite.
+const postgresDSNEnv = "LOOPFS_TEST_POSTGRES_DSN"
+
+// testSchemas numbers the PostgreSQL schemas created by openTestStore.
+var testSchemas atomic.Int64
+
+// openTestStore opens an empty store for a test and closes it after the test. The store is in
+// a SQLite database in a temporary directory, or with LOOPFS_TEST_POSTGRES_DSN set, in a
+// PostgreSQL schema dropped after the test.
+func openTestStore(t *testing.T, name string) (*Store, error) {
+	t.Helper()
+
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		store, err := NewStore(filepath.Join(t.TempDir(), name+".db"))
+		if err == nil {
+			t.Cleanup(func() { _ = store.Close() })
+		}
+		return store, err
+	}
+
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = admin.Close() }()
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("loopfs_test_%d_%d_%s", os.Getpid(), testSchemas.Add(1), name)
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		admin, err := sql.Open("pgx", dsn)
+		if err != nil {
+			return
+		}
+		_, _ = admin.ExecContext(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+		_ = admin.Close()
+	})
+
+	store, err := NewPostgresStore(withSearchPath(dsn, schema))
+	if err == nil {
+		t.Cleanup(func() { _ = store.Close() })
+	}
+	return store, err
+}
+
+// withSearchPath returns dsn with schema as the search path of its connections.
+func withSearchPath(dsn, schema string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	parsed, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	query := parsed.Query()
+	query.Set("search_path", schema)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// DialectTestSuite tests the SQL differences between databases.
+type DialectTestSuite struct {
+	suite.Suite
+}
+
+// TestRebind tests that placeholders are numbered for PostgreSQL outside string literals.
+func (s *DialectTestSuite) TestRebind() {
+	query := `SELECT id FROM buckets WHERE name = ? AND owner_id = '?' AND is_public = ?`
+	s.Equal(query, sqliteDialect.rebind(query))
+	s.Equal(`SELECT id FROM buckets WHERE name = $1 AND owner_id = '?' AND is_public = $2`, postgresDialect.rebind(query))
+	s.Equal(`SELECT 1`, postgresDialect.rebind(`SELECT 1`))
+}
+
+// TestWithSearchPath tests that the schema is added to both DSN forms.
+func (s *DialectTestSuite) TestWithSearchPath() {
+	s.Equal("postgres://u:p@db/loopfs?search_path=test&sslmode=disable",
+		withSearchPath("postgres://u:p@db/loopfs?sslmode=disable", "test"))
+	s.Equal("host=db dbname=loopfs search_path=test", withSearchPath("host=db dbname=loopfs", "test"))
+}
+
+// TestStoreDialect tests that stores run queries in the dialect of their database.
+func (s *DialectTestSuite) TestStoreDialect() {
+	store, err := openTestStore(s.T(), "dialect")
+	s.Require().NoError(err)
+
+	want := sqliteDialect
+	if os.Getenv(postgresDSNEnv) != "" {
+		want = postgresDialect
+	}
+	s.Same(want, store.db.dialect)
+
+	// Explicit IDs, as inserted by replication, are not reused for new rows
+	tx, err := store.db.BeginTx(context.Background(), nil)
+	s.Require().NoError(err)
+	now := time.Now()
+	_, err = tx.ExecContext(context.Background(),
+		`INSERT INTO buckets (id, name, owner_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`, 41, "replicated", "alice", now, now)
+	s.Require().NoError(err)
+	s.Require().NoError(tx.syncSequence(context.Background(), "buckets", 41))
+	s.Require().NoError(tx.Commit())
+
+	bucket, err := store.CreateBucket(context.Background(), "created", "alice", nil)
+	s.Require().NoError(err)
+	s.Equal(int64(42), bucket.ID)
+}
+
+// TestNewPostgresStoreUnreachable tests that a PostgreSQL store fails to open without its server.
+func (s *DialectTestSuite) TestNewPostgresStoreUnreachable() {
+	_, err := NewPostgresStore("postgres://loopfs@127.0.0.1:1/loopfs?connect_timeout=1")
+	s.ErrorIs(err, ErrDatabaseError)
+}
+
+func TestDialectSuite(t *testing.T) {
+	suite.Run(t, new(DialectTestSuite))
+}
@@ -27,6 +27,15 @@ var (
 	// ErrAccessDenied is returned when the user does not have permission to perform the operation.
 	ErrAccessDenied = errors.New("access denied")
 
+	// ErrLogGap is returned when replicated log entries do not follow the last entry of the log.
+	ErrLogGap = errors.New("log entries do not follow the log")
+
+	// ErrLogConflict is returned when replicated log entries disagree with the entries in the log.
+	ErrLogConflict = errors.New("log entries conflict with the log")
+
+	// ErrLogPruned is returned when the requested log entries were pruned.
+	ErrLogPruned = errors.New("log entries were pruned")
+
 	// ErrDatabaseError is returned when a database operation fails.
 	ErrDatabaseError = errors.New("database error")
 )
@@ -0,0 +1,254 @@
+package bucket
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"loopfs/pkg/models"
+)
+
+// insertEvent appends event to the change log as part of tx and sets its ID. An event that
+// already has an ID, numbered by the metadata leader, is recorded under it.
+func insertEvent(ctx context.Context, tx *sqlTx, event *models.Event) error {
+	if event.ID > 0 {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO events (id, type, bucket, key, hash, size, previous_hash, occurred_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(id) DO UPDATE SET type = excluded.type, bucket = excluded.bucket, key = excluded.key,
+			 hash = excluded.hash, size = excluded.size, previous_hash = excluded.previous_hash, occurred_at = excluded.occurred_at`,
+			event.ID, event.Type, event.Bucket, event.Key, event.Hash, event.Size, event.PreviousHash, event.Time,
+		)
+		if err != nil {
+			return fmt.Errorf("%w: failed to record event: %w", ErrDatabaseError, err)
+		}
+		return tx.syncSequence(ctx, "events", event.ID)
+	}
+
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO events (type, bucket, key, hash, size, previous_hash, occurred_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		 RETURNING id`,
+		event.Type, event.Bucket, event.Key, event.Hash, event.Size, event.PreviousHash, event.Time,
+	).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to record event: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// EventsAfter returns up to limit events with an ID greater than afterID, oldest first.
+func (s *Store) EventsAfter(ctx context.Context, afterID int64, limit int) ([]models.Event, error) {
+	ctx, done := s.trackQuery(ctx, "events_after")
+	defer done()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, type, bucket, key, hash, size, previous_hash, occurred_at
+		 FROM events WHERE id > ? ORDER BY id LIMIT ?`,
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return scanEvents(rows)
+}
+
+// scanEvents reads and closes rows of events.
+func scanEvents(rows *sql.Rows) ([]models.Event, error) {
+	defer func() { _ = rows.Close() }()
+
+	var events []models.Event
+	for rows.Next() {
+		var event models.Event
+		if err := rows.Scan(&event.ID, &event.Type, &event.Bucket, &event.Key, &event.Hash,
+			&event.Size, &event.PreviousHash, &event.Time); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return events, nil
+}
+
+// BucketEventsAfter returns up to limit events of bucketName with an ID greater than afterID, oldest first.
+func (s *Store) BucketEventsAfter(ctx context.Context, bucketName string, afterID int64, limit int) ([]models.Event, error) {
+	ctx, done := s.trackQuery(ctx, "bucket_events_after")
+	defer done()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, type, bucket, key, hash, size, previous_hash, occurred_at
+		 FROM events WHERE bucket = ? AND id > ? ORDER BY id LIMIT ?`,
+		bucketName, afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return scanEvents(rows)
+}
+
+// OldestEventID returns the ID of the oldest retained event. When every event was pruned it
+// returns the ID the next event will get, and 0 if no event was ever recorded.
+func (s *Store) OldestEventID(ctx context.Context) (int64, error) {
+	ctx, done := s.trackQuery(ctx, "oldest_event_id")
+	defer done()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var oldest int64
+	err := s.db.QueryRowContext(ctx, s.db.dialect.oldestEventID).Scan(&oldest)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return oldest, nil
+}
+
+// LatestEventID returns the ID of the most recent event, or 0 if there are none.
+func (s *Store) LatestEventID(ctx context.Context) (int64, error) {
+	ctx, done := s.trackQuery(ctx, "latest_event_id")
+	defer done()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var latest int64
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM events`).Scan(&latest)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return latest, nil
+}
+
+// WebhookCursor returns the ID of the last event handled for the webhook at url.
+// A webhook seen for the first time starts at the latest event, so it only receives new changes.
+func (s *Store) WebhookCursor(ctx context.Context, url string) (int64, error) {
+	ctx, done := s.trackQuery(ctx, "webhook_cursor")
+	defer done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var cursor int64
+	err := s.db.QueryRowContext(ctx, `SELECT last_event_id FROM webhook_cursors WHERE url = ?`, url).Scan(&cursor)
+	if err == nil {
+		return cursor, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+
+	err = s.db.QueryRowContext(ctx,
+		`INSERT INTO webhook_cursors (url, last_event_id, updated_at)
+		 VALUES (?, (SELECT COALESCE(MAX(id), 0) FROM events), ?)
+		 RETURNING last_event_id`,
+		url, time.Now(),
+	).Scan(&cursor)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return cursor, nil
+}
+
+// SetWebhookCursor records that events up to eventID were handled for the webhook at url.
+func (s *Store) SetWebhookCursor(ctx context.Context, url string, eventID int64) error {
+	ctx, done := s.trackQuery(ctx, "set_webhook_cursor")
+	defer done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO webhook_cursors (url, last_event_id, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT(url) DO UPDATE SET last_event_id = excluded.last_event_id, updated_at = excluded.updated_at`,
+		url, eventID, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// DeadLetterWebhookEvent records an event that could not be delivered to url and advances the
+// webhook's cursor past it in one transaction.
+func (s *Store) DeadLetterWebhookEvent(ctx context.Context, url string, eventID int64, attempts int, lastErr error) error {
+	ctx, done := s.trackQuery(ctx, "dead_letter_webhook_event")
+	defer done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO webhook_dead_letters (url, event_id, attempts, last_error, failed_at) VALUES (?, ?, ?, ?, ?)`,
+		url, eventID, attempts, lastErr.Error(), now,
+	); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO webhook_cursors (url, last_event_id, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT(url) DO UPDATE SET last_event_id = excluded.last_event_id, updated_at = excluded.updated_at`,
+		url, eventID, now,
+	); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// PruneEvents deletes events that occurred before cutoff and were handled by every webhook
+// in activeURLs. It returns the number of events deleted.
+func (s *Store) PruneEvents(ctx context.Context, cutoff time.Time, activeURLs []string) (int64, error) {
+	ctx, done := s.trackQuery(ctx, "prune_events")
+	defer done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maxID := int64(-1)
+	for _, url := range activeURLs {
+		var cursor int64
+		err := s.db.QueryRowContext(ctx, `SELECT last_event_id FROM webhook_cursors WHERE url = ?`, url).Scan(&cursor)
+		if errors.Is(err, sql.ErrNoRows) {
+			// The webhook has not started yet and will begin at the latest event
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+		}
+		if maxID < 0 || cursor < maxID {
+			maxID = cursor
+		}
+	}
+
+	query := `DELETE FROM events WHERE occurred_at < ?`
+	args := []any{cutoff}
+	if maxID >= 0 {
+		query += ` AND id <= ?`
+		args = append(args, maxID)
+	}
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,222 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	eventHashA = "a1b2c3d4e5f67890123456789abcdef0123456789abcdef0123456789abcdef0"
+	eventHashB = "b1b2c3d4e5f67890123456789abcdef0123456789abcdef0123456789abcdef0"
+)
+
+// EventsTestSuite tests the change log and webhook bookkeeping.
+type EventsTestSuite struct {
+	suite.Suite
+	store *Store
+}
+
+// SetupTest creates an empty store.
+func (s *EventsTestSuite) SetupTest() {
+	var err error
+	s.store, err = openTestStore(s.T(), "events")
+	s.Require().NoError(err)
+}
+
+// allEvents returns every event in the log.
+func (s *EventsTestSuite) allEvents() []models.Event {
+	events, err := s.store.EventsAfter(context.Background(), 0, 1000)
+	s.Require().NoError(err)
+	return events
+}
+
+// TestMutationsRecordEvents tests that each change appends an event.
+func (s *EventsTestSuite) TestMutationsRecordEvents() {
+	_, err := s.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().NoError(err)
+	_, err = s.store.PutObject(context.Background(), "photos", "a.jpg", eventHashA, 10, "image/jpeg", nil)
+	s.Require().NoError(err)
+	_, err = s.store.PutObject(context.Background(), "photos", "a.jpg", eventHashB, 20, "image/jpeg", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(s.store.DeleteObject(context.Background(), "photos", "a.jpg"))
+	s.Require().NoError(s.store.DeleteBucket(context.Background(), "photos"))
+
+	events := s.allEvents()
+	s.Require().Len(events, 5)
+	s.Equal(models.EventBucketCreated, events[0].Type)
+	s.Equal("photos", events[0].Bucket)
+
+	s.Equal(models.EventObjectCreated, events[1].Type)
+	s.Equal("a.jpg", events[1].Key)
+	s.Equal(eventHashA, events[1].Hash)
+	s.Equal(int64(10), events[1].Size)
+	s.Empty(events[1].PreviousHash)
+
+	s.Equal(models.EventObjectOverwritten, events[2].Type)
+	s.Equal(eventHashB, events[2].Hash)
+	s.Equal(eventHashA, events[2].PreviousHash)
+
+	s.Equal(models.EventObjectDeleted, events[3].Type)
+	s.Equal(eventHashB, events[3].Hash)
+	s.Equal(int64(20), events[3].Size)
+
+	s.Equal(models.EventBucketDeleted, events[4].Type)
+	for i := 1; i < len(events); i++ {
+		s.Greater(events[i].ID, events[i-1].ID)
+		s.False(events[i].Time.IsZero())
+	}
+
+	latest, err := s.store.LatestEventID(context.Background())
+	s.Require().NoError(err)
+	s.Equal(events[4].ID, latest)
+}
+
+// TestFailedMutationsRecordNothing tests that rejected changes do not emit events.
+func (s *EventsTestSuite) TestFailedMutationsRecordNothing() {
+	_, err := s.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().NoError(err)
+	_, err = s.store.PutObject(context.Background(), "photos", "a.jpg", eventHashA, 10, "", nil)
+	s.Require().NoError(err)
+
+	_, err = s.store.CreateBucket(context.Background(), "photos", "bob", nil)
+	s.ErrorIs(err, ErrBucketExists)
+	s.ErrorIs(s.store.DeleteBucket(context.Background(), "photos"), ErrBucketNotEmpty)
+	s.ErrorIs(s.store.DeleteObject(context.Background(), "photos", "missing"), ErrObjectNotFound)
+	_, err = s.store.PutObject(context.Background(), "missing", "a.jpg", eventHashA, 10, "", nil)
+	s.ErrorIs(err, ErrBucketNotFound)
+
+	s.Len(s.allEvents(), 2)
+}
+
+// TestEventsAfterPaging tests reading the log in batches.
+func (s *EventsTestSuite) TestEventsAfterPaging() {
+	for _, name := range []string{"aaa", "bbb", "ccc"} {
+		_, err := s.store.CreateBucket(context.Background(), name, "alice", nil)
+		s.Require().NoError(err)
+	}
+
+	first, err := s.store.EventsAfter(context.Background(), 0, 2)
+	s.Require().NoError(err)
+	s.Require().Len(first, 2)
+	rest, err := s.store.EventsAfter(context.Background(), first[1].ID, 2)
+	s.Require().NoError(err)
+	s.Require().Len(rest, 1)
+	s.Equal("ccc", rest[0].Bucket)
+}
+
+// TestBucketEventsAfter tests reading the changes of one bucket.
+func (s *EventsTestSuite) TestBucketEventsAfter() {
+	for _, name := range []string{"aaa", "bbb"} {
+		_, err := s.store.CreateBucket(context.Background(), name, "alice", nil)
+		s.Require().NoError(err)
+		_, err = s.store.PutObject(context.Background(), name, "key", eventHashA, 1, "", nil)
+		s.Require().NoError(err)
+	}
+
+	events, err := s.store.BucketEventsAfter(context.Background(), "bbb", 0, 10)
+	s.Require().NoError(err)
+	s.Require().Len(events, 2)
+	s.Equal(models.EventBucketCreated, events[0].Type)
+	s.Equal(models.EventObjectCreated, events[1].Type)
+
+	events, err = s.store.BucketEventsAfter(context.Background(), "bbb", events[0].ID, 10)
+	s.Require().NoError(err)
+	s.Len(events, 1)
+}
+
+// TestOldestEventID tests the oldest retained sequence before and after pruning.
+func (s *EventsTestSuite) TestOldestEventID() {
+	oldest, err := s.store.OldestEventID(context.Background())
+	s.Require().NoError(err)
+	s.Zero(oldest)
+
+	for _, name := range []string{"aaa", "bbb"} {
+		_, err := s.store.CreateBucket(context.Background(), name, "alice", nil)
+		s.Require().NoError(err)
+	}
+	oldest, err = s.store.OldestEventID(context.Background())
+	s.Require().NoError(err)
+	s.Equal(int64(1), oldest)
+
+	_, err = s.store.PruneEvents(context.Background(), time.Now().Add(time.Hour), nil)
+	s.Require().NoError(err)
+	oldest, err = s.store.OldestEventID(context.Background())
+	s.Require().NoError(err)
+	s.Equal(int64(3), oldest, "with every event pruned the next sequence is reported")
+}
+
+// TestWebhookCursor tests that new webhooks start at the latest event and cursors persist.
+func (s *EventsTestSuite) TestWebhookCursor() {
+	_, err := s.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().NoError(err)
+	latest, err := s.store.LatestEventID(context.Background())
+	s.Require().NoError(err)
+
+	cursor, err := s.store.WebhookCursor(context.Background(), "http://hook")
+	s.Require().NoError(err)
+	s.Equal(latest, cursor)
+
+	_, err = s.store.CreateBucket(context.Background(), "videos", "alice", nil)
+	s.Require().NoError(err)
+	cursor, err = s.store.WebhookCursor(context.Background(), "http://hook")
+	s.Require().NoError(err)
+	s.Equal(latest, cursor, "an existing cursor must not move on its own")
+
+	s.Require().NoError(s.store.SetWebhookCursor(context.Background(), "http://hook", latest+1))
+	cursor, err = s.store.WebhookCursor(context.Background(), "http://hook")
+	s.Require().NoError(err)
+	s.Equal(latest+1, cursor)
+}
+
+// TestDeadLetterAdvancesCursor tests that dead-lettering an event moves the cursor past it.
+func (s *EventsTestSuite) TestDeadLetterAdvancesCursor() {
+	_, err := s.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.store.DeadLetterWebhookEvent(context.Background(), "http://hook", 1, 3, errors.New("status 500")))
+	cursor, err := s.store.WebhookCursor(context.Background(), "http://hook")
+	s.Require().NoError(err)
+	s.Equal(int64(1), cursor)
+
+	var attempts int
+	var lastError string
+	s.Require().NoError(s.store.db.QueryRowContext(context.Background(),
+		`SELECT attempts, last_error FROM webhook_dead_letters WHERE url = ? AND event_id = ?`, "http://hook", 1,
+	).Scan(&attempts, &lastError))
+	s.Equal(3, attempts)
+	s.Equal("status 500", lastError)
+}
+
+// TestPruneEvents tests that only old, delivered events are pruned.
+func (s *EventsTestSuite) TestPruneEvents() {
+	for _, name := range []string{"aaa", "bbb", "ccc"} {
+		_, err := s.store.CreateBucket(context.Background(), name, "alice", nil)
+		s.Require().NoError(err)
+	}
+	s.Require().NoError(s.store.SetWebhookCursor(context.Background(), "http://slow", 1))
+	s.Require().NoError(s.store.SetWebhookCursor(context.Background(), "http://fast", 3))
+
+	deleted, err := s.store.PruneEvents(context.Background(), time.Now().Add(-time.Hour), nil)
+	s.Require().NoError(err)
+	s.Zero(deleted, "recent events must be kept")
+
+	deleted, err = s.store.PruneEvents(context.Background(), time.Now().Add(time.Hour), []string{"http://slow", "http://fast", "http://new"})
+	s.Require().NoError(err)
+	s.Equal(int64(1), deleted, "events not yet delivered to every webhook must be kept")
+	s.Len(s.allEvents(), 2)
+
+	deleted, err = s.store.PruneEvents(context.Background(), time.Now().Add(time.Hour), nil)
+	s.Require().NoError(err)
+	s.Equal(int64(2), deleted)
+}
+
+// TestEventsTestSuite runs the events test suite.
+func TestEventsTestSuite(t *testing.T) {
+	suite.Run(t, new(EventsTestSuite))
+}
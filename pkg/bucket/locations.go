@@ -0,0 +1,91 @@
+package bucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"loopfs/pkg/models"
+)
+
+// SaveLocation records the backends storing a hash, replacing any earlier record.
+func (s *Store) SaveLocation(ctx context.Context, hash string, backends []string) error {
+	ctx, done := s.trackQuery(ctx, "save_location")
+	defer done()
+
+	encoded, err := json.Marshal(backends)
+	if err != nil {
+		return fmt.Errorf("%w: failed to serialize backends: %w", ErrDatabaseError, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO hash_locations (hash, backends, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT(hash) DO UPDATE SET backends = excluded.backends, updated_at = excluded.updated_at`,
+		hash, string(encoded), time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// DeleteLocation removes the location record of a hash.
+func (s *Store) DeleteLocation(ctx context.Context, hash string) error {
+	ctx, done := s.trackQuery(ctx, "delete_location")
+	defer done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM hash_locations WHERE hash = ?`, hash)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// ListLocations returns up to limit location records, most recently updated first. A limit of
+// zero or less returns all.
+func (s *Store) ListLocations(ctx context.Context, limit int) ([]models.HashLocation, error) {
+	ctx, done := s.trackQuery(ctx, "list_locations")
+	defer done()
+
+	query := `SELECT hash, backends, updated_at FROM hash_locations ORDER BY updated_at DESC, hash`
+	var args []any
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	locations := []models.HashLocation{}
+	for rows.Next() {
+		var (
+			location models.HashLocation
+			backends string
+		)
+		if err := rows.Scan(&location.Hash, &backends, &location.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+		}
+		if err := json.Unmarshal([]byte(backends), &location.Backends); err != nil {
+			return nil, fmt.Errorf("%w: failed to parse backends: %w", ErrDatabaseError, err)
+		}
+		locations = append(locations, location)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return locations, nil
+}
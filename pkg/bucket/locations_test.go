@@ -0,0 +1,62 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// LocationsTestSuite tests the persisted hash locations of the balancer location cache.
+type LocationsTestSuite struct {
+	suite.Suite
+	store *Store
+}
+
+// SetupTest creates an empty store.
+func (s *LocationsTestSuite) SetupTest() {
+	var err error
+	s.store, err = openTestStore(s.T(), "locations")
+	s.Require().NoError(err)
+}
+
+// TestSaveLocationUpserts tests that saving a hash again replaces its backends.
+func (s *LocationsTestSuite) TestSaveLocationUpserts() {
+	s.Require().NoError(s.store.SaveLocation(context.Background(), eventHashA, []string{"http://node1:8080"}))
+	s.Require().NoError(s.store.SaveLocation(context.Background(), eventHashA, []string{"http://node1:8080", "http://node2:8080"}))
+
+	locations, err := s.store.ListLocations(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Require().Len(locations, 1)
+	s.Equal(eventHashA, locations[0].Hash)
+	s.Equal([]string{"http://node1:8080", "http://node2:8080"}, locations[0].Backends)
+	s.False(locations[0].UpdatedAt.IsZero())
+}
+
+// TestListLocationsNewestFirst tests that the most recently updated locations are listed first.
+func (s *LocationsTestSuite) TestListLocationsNewestFirst() {
+	s.Require().NoError(s.store.SaveLocation(context.Background(), eventHashA, []string{"http://node1:8080"}))
+	time.Sleep(10 * time.Millisecond)
+	s.Require().NoError(s.store.SaveLocation(context.Background(), eventHashB, []string{"http://node2:8080"}))
+
+	locations, err := s.store.ListLocations(context.Background(), 1)
+	s.Require().NoError(err)
+	s.Require().Len(locations, 1)
+	s.Equal(eventHashB, locations[0].Hash)
+}
+
+// TestDeleteLocation tests that a deleted location is no longer listed.
+func (s *LocationsTestSuite) TestDeleteLocation() {
+	s.Require().NoError(s.store.SaveLocation(context.Background(), eventHashA, []string{"http://node1:8080"}))
+	s.Require().NoError(s.store.DeleteLocation(context.Background(), eventHashA))
+	s.Require().NoError(s.store.DeleteLocation(context.Background(), eventHashB))
+
+	locations, err := s.store.ListLocations(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Empty(locations)
+}
+
+func TestLocationsSuite(t *testing.T) {
+	suite.Run(t, new(LocationsTestSuite))
+}
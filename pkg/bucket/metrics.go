@@ -0,0 +1,29 @@
+package bucket
+
+import (
+	"context"
+	"time"
+
+	"loopfs/pkg/metrics"
+	"loopfs/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var queryDuration = metrics.NewHistogramVec("loopfs_bucket_query_duration_seconds",
+	"Latency of metadata store operations, including lock waits, by operation.",
+	metrics.ExponentialBuckets(0.0001, 4, 10), "operation")
+
+// trackQuery starts a span for a metadata store operation as a child of the span in ctx. It
+// returns the context holding the span and the function that ends it and records the
+// operation latency.
+func (s *Store) trackQuery(ctx context.Context, operation string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracing.StartSpan(ctx, s.db.dialect.name+" "+operation,
+		attribute.String("db.system.name", s.db.dialect.name),
+		attribute.String("db.operation.name", operation))
+	return ctx, func() {
+		span.End(nil)
+		queryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	}
+}
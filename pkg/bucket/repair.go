@@ -0,0 +1,286 @@
+package bucket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"loopfs/pkg/models"
+)
+
+// AddRepair queues an under-replicated object. An object already queued gets the new replica
+// set and error; its attempt count is kept.
+func (s *Store) AddRepair(ctx context.Context, item *models.RepairItem) error {
+	ctx, done := s.trackQuery(ctx, "add_repair")
+	defer done()
+
+	replicas, err := json.Marshal(item.Replicas)
+	if err != nil {
+		return fmt.Errorf("%w: failed to serialize replicas: %w", ErrDatabaseError, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO repair_queue (hash, size, replicas, wanted, last_error, attempts, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, 0, ?, ?)
+		 ON CONFLICT(hash) DO UPDATE SET
+		 replicas = excluded.replicas,
+		 wanted = excluded.wanted,
+		 last_error = excluded.last_error,
+		 updated_at = excluded.updated_at`,
+		item.Hash, item.Size, string(replicas), item.Wanted, item.LastError, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// ListRepairs returns up to limit queued repairs, oldest first. A limit of zero or less returns all.
+func (s *Store) ListRepairs(ctx context.Context, limit int) ([]models.RepairItem, error) {
+	ctx, done := s.trackQuery(ctx, "list_repairs")
+	defer done()
+
+	query := `SELECT hash, size, replicas, wanted, last_error, attempts, created_at, updated_at
+		 FROM repair_queue ORDER BY created_at, hash`
+	var args []any
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	items := []models.RepairItem{}
+	for rows.Next() {
+		var (
+			item     models.RepairItem
+			replicas string
+		)
+		if err := rows.Scan(&item.Hash, &item.Size, &replicas, &item.Wanted, &item.LastError,
+			&item.Attempts, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+		}
+		if err := json.Unmarshal([]byte(replicas), &item.Replicas); err != nil {
+			return nil, fmt.Errorf("%w: failed to parse replicas: %w", ErrDatabaseError, err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return items, nil
+}
+
+// RemoveRepair removes a repaired object from the queue.
+func (s *Store) RemoveRepair(ctx context.Context, hash string) error {
+	ctx, done := s.trackQuery(ctx, "remove_repair")
+	defer done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM repair_queue WHERE hash = ?`, hash)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// RecordRepairFailure counts a failed repair attempt of a queued object.
+func (s *Store) RecordRepairFailure(ctx context.Context, hash, lastError string) error {
+	ctx, done := s.trackQuery(ctx, "record_repair_failure")
+	defer done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE repair_queue SET attempts = attempts + 1, last_error = ?, updated_at = ? WHERE hash = ?`,
+		lastError, time.Now(), hash,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// AddTombstone records that a blob was deleted and drops its queued repair, so repairs do not
+// copy it back from backends that kept a replica. With replication it is a metadata change
+// and is only accepted by the leader.
+func (s *Store) AddTombstone(ctx context.Context, hash string) error {
+	ctx, done := s.trackQuery(ctx, "add_tombstone")
+	defer done()
+
+	term, err := s.leaderTerm()
+	if err != nil {
+		return err
+	}
+	seq, err := s.addTombstone(ctx, hash, term)
+	if err != nil {
+		return err
+	}
+	return s.waitReplicated(seq)
+}
+
+// addTombstone records a tombstone and returns the sequence number of its log entry.
+func (s *Store) addTombstone(ctx context.Context, hash string, term int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	entry := &models.MetadataLogEntry{Op: models.MetadataOpDeleteBlob, Hash: hash, Time: time.Now()}
+	if _, err := applyDeleteBlob(ctx, tx, entry); err != nil {
+		return 0, err
+	}
+	seq, err := s.logChange(ctx, tx, term, entry)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return seq, nil
+}
+
+// Tombstones returns when the blobs whose hash starts with prefix were deleted.
+func (s *Store) Tombstones(ctx context.Context, prefix string) (map[string]time.Time, error) {
+	ctx, done := s.trackQuery(ctx, "tombstones")
+	defer done()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT hash, deleted_at FROM blob_tombstones WHERE hash LIKE ? ESCAPE '\'`,
+		likeEscaper.Replace(prefix)+"%",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	tombstones := make(map[string]time.Time)
+	for rows.Next() {
+		var (
+			hash      string
+			deletedAt time.Time
+		)
+		if err := rows.Scan(&hash, &deletedAt); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+		}
+		tombstones[hash] = deletedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return tombstones, nil
+}
+
+// PurgeTombstones drops the tombstones of blobs deleted before cutoff and returns their number.
+// The repairer purges them once a scan of all backends found no replica left.
+func (s *Store) PurgeTombstones(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, done := s.trackQuery(ctx, "purge_tombstones")
+	defer done()
+
+	term, err := s.leaderTerm()
+	if err != nil {
+		return 0, err
+	}
+	purged, seq, err := s.purgeTombstones(ctx, cutoff, term)
+	if err != nil {
+		return 0, err
+	}
+	return purged, s.waitReplicated(seq)
+}
+
+// purgeTombstones drops tombstones older than cutoff and returns their number and the
+// sequence number of the log entry, which is only written if any were dropped.
+func (s *Store) purgeTombstones(ctx context.Context, cutoff time.Time, term int64) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	entry := &models.MetadataLogEntry{Op: models.MetadataOpPurgeTombstones, Time: cutoff}
+	purged, err := deleteTombstonesBefore(ctx, tx, entry.Time)
+	if err != nil || purged == 0 {
+		return 0, 0, err
+	}
+	seq, err := s.logChange(ctx, tx, term, entry)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return purged, seq, nil
+}
+
+// applyDeleteBlob records the tombstone of a delete_blob entry and drops the blob's queued
+// repair.
+func applyDeleteBlob(ctx context.Context, tx *sqlTx, entry *models.MetadataLogEntry) (*models.Event, error) {
+	if err := upsertTombstone(ctx, tx, entry.Hash, entry.Time); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM repair_queue WHERE hash = ?`, entry.Hash); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil, nil
+}
+
+// applyPurgeTombstones drops the tombstones older than the time of a purge_tombstones entry.
+func applyPurgeTombstones(ctx context.Context, tx *sqlTx, entry *models.MetadataLogEntry) (*models.Event, error) {
+	_, err := deleteTombstonesBefore(ctx, tx, entry.Time)
+	return nil, err
+}
+
+// upsertTombstone records that hash was deleted at deletedAt.
+func upsertTombstone(ctx context.Context, tx *sqlTx, hash string, deletedAt time.Time) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO blob_tombstones (hash, deleted_at) VALUES (?, ?)
+		 ON CONFLICT(hash) DO UPDATE SET deleted_at = excluded.deleted_at`,
+		hash, deletedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// deleteTombstonesBefore drops the tombstones older than cutoff and returns their number.
+func deleteTombstonesBefore(ctx context.Context, tx *sqlTx, cutoff time.Time) (int64, error) {
+	result, err := tx.ExecContext(ctx, `DELETE FROM blob_tombstones WHERE deleted_at < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return purged, nil
+}
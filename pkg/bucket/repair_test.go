@@ -0,0 +1,131 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// RepairTestSuite tests the repair queue of under-replicated objects.
+type RepairTestSuite struct {
+	suite.Suite
+	store *Store
+}
+
+// SetupTest creates an empty store.
+func (s *RepairTestSuite) SetupTest() {
+	var err error
+	s.store, err = openTestStore(s.T(), "repair")
+	s.Require().NoError(err)
+}
+
+// TestAddRepair tests that queued repairs are listed with their replicas.
+func (s *RepairTestSuite) TestAddRepair() {
+	s.Require().NoError(s.store.AddRepair(context.Background(), &models.RepairItem{
+		Hash: eventHashA, Size: 42, Replicas: []string{"http://node1:8080"}, Wanted: 3, LastError: "timeout",
+	}))
+
+	items, err := s.store.ListRepairs(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Require().Len(items, 1)
+	s.Equal(eventHashA, items[0].Hash)
+	s.Equal(int64(42), items[0].Size)
+	s.Equal([]string{"http://node1:8080"}, items[0].Replicas)
+	s.Equal(3, items[0].Wanted)
+	s.Equal("timeout", items[0].LastError)
+	s.Zero(items[0].Attempts)
+	s.False(items[0].CreatedAt.IsZero())
+}
+
+// TestAddRepairUpserts tests that queueing a hash again replaces its replicas.
+func (s *RepairTestSuite) TestAddRepairUpserts() {
+	s.Require().NoError(s.store.AddRepair(context.Background(), &models.RepairItem{
+		Hash: eventHashA, Size: 42, Replicas: []string{"http://node1:8080"}, Wanted: 3,
+	}))
+	s.Require().NoError(s.store.AddRepair(context.Background(), &models.RepairItem{
+		Hash: eventHashA, Size: 42, Replicas: []string{"http://node1:8080", "http://node2:8080"}, Wanted: 3,
+	}))
+	s.Require().NoError(s.store.AddRepair(context.Background(), &models.RepairItem{
+		Hash: eventHashB, Size: 7, Replicas: []string{"http://node2:8080"}, Wanted: 2,
+	}))
+
+	items, err := s.store.ListRepairs(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Require().Len(items, 2)
+	s.Equal(eventHashA, items[0].Hash)
+	s.Equal([]string{"http://node1:8080", "http://node2:8080"}, items[0].Replicas)
+
+	items, err = s.store.ListRepairs(context.Background(), 1)
+	s.Require().NoError(err)
+	s.Len(items, 1)
+}
+
+// TestRepairFailureAndRemoval tests counting failed attempts and removing repaired objects.
+func (s *RepairTestSuite) TestRepairFailureAndRemoval() {
+	s.Require().NoError(s.store.AddRepair(context.Background(), &models.RepairItem{
+		Hash: eventHashA, Size: 42, Replicas: []string{"http://node1:8080"}, Wanted: 2,
+	}))
+	s.Require().NoError(s.store.RecordRepairFailure(context.Background(), eventHashA, "no backend available"))
+	s.Require().NoError(s.store.RecordRepairFailure(context.Background(), eventHashA, "connection refused"))
+
+	items, err := s.store.ListRepairs(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Require().Len(items, 1)
+	s.Equal(2, items[0].Attempts)
+	s.Equal("connection refused", items[0].LastError)
+
+	// Queueing the object again keeps its attempt count
+	s.Require().NoError(s.store.AddRepair(context.Background(), &models.RepairItem{
+		Hash: eventHashA, Size: 42, Replicas: []string{"http://node1:8080"}, Wanted: 2,
+	}))
+	items, err = s.store.ListRepairs(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Equal(2, items[0].Attempts)
+
+	s.Require().NoError(s.store.RemoveRepair(context.Background(), eventHashA))
+	items, err = s.store.ListRepairs(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Empty(items)
+}
+
+// TestTombstones tests that a tombstone drops the queued repair, is found by prefix and is
+// purged once older than the cutoff.
+func (s *RepairTestSuite) TestTombstones() {
+	ctx := context.Background()
+	s.Require().NoError(s.store.AddRepair(ctx, &models.RepairItem{
+		Hash: eventHashA, Size: 42, Replicas: []string{"http://node1:8080"}, Wanted: 2,
+	}))
+	s.Require().NoError(s.store.AddTombstone(ctx, eventHashA))
+	s.Require().NoError(s.store.AddTombstone(ctx, eventHashB))
+
+	items, err := s.store.ListRepairs(ctx, 0)
+	s.Require().NoError(err)
+	s.Empty(items)
+
+	tombstones, err := s.store.Tombstones(ctx, eventHashA[:4])
+	s.Require().NoError(err)
+	s.Require().Len(tombstones, 1)
+	deletedAt := tombstones[eventHashA]
+	s.WithinDuration(time.Now(), deletedAt, time.Minute)
+	tombstones, err = s.store.Tombstones(ctx, "a_%")
+	s.Require().NoError(err)
+	s.Empty(tombstones)
+
+	purged, err := s.store.PurgeTombstones(ctx, deletedAt)
+	s.Require().NoError(err)
+	s.Zero(purged)
+	purged, err = s.store.PurgeTombstones(ctx, time.Now().Add(time.Second))
+	s.Require().NoError(err)
+	s.Equal(int64(2), purged)
+	tombstones, err = s.store.Tombstones(ctx, "")
+	s.Require().NoError(err)
+	s.Empty(tombstones)
+}
+
+func TestRepairSuite(t *testing.T) {
+	suite.Run(t, new(RepairTestSuite))
+}
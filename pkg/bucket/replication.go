@@ -0,0 +1,737 @@
+package bucket
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"loopfs/pkg/models"
+)
+
+// Keys of the replication_state table.
+const (
+	stateCurrentTerm = "current_term"
+	stateVotedFor    = "voted_for"
+	stateBaseSeq     = "log_base_seq"
+	stateBaseTerm    = "log_base_term"
+)
+
+// ReplicationHook replicates the changes of a store to other balancers. With a hook set,
+// every change is appended to the replication log in the transaction making it.
+type ReplicationHook interface {
+	// LeaderTerm returns the term new log entries are stamped with, or an error if this
+	// balancer may not change the metadata.
+	LeaderTerm() (int64, error)
+	// WaitReplicated blocks until the log entry seq is stored by a majority of balancers.
+	WaitReplicated(seq int64) error
+}
+
+// ReplicatedStore is a MetadataStore whose changes are replicated through a log of them.
+type ReplicatedStore interface {
+	MetadataStore
+
+	SetReplicationHook(hook ReplicationHook)
+	LastLogPosition(ctx context.Context) (seq, term int64, err error)
+	LogTerm(ctx context.Context, seq int64) (term int64, found bool, err error)
+	LogEntriesAfter(ctx context.Context, afterSeq int64, limit int) ([]models.MetadataLogEntry, error)
+	AppendLogEntries(ctx context.Context, prevSeq, prevTerm int64, entries []models.MetadataLogEntry) error
+	Snapshot(ctx context.Context) (*models.MetadataSnapshot, error)
+	RestoreSnapshot(ctx context.Context, snapshot *models.MetadataSnapshot) error
+	PruneLog(ctx context.Context, throughSeq int64) (int64, error)
+	ElectionState(ctx context.Context) (term int64, votedFor string, err error)
+	SetElectionState(ctx context.Context, term int64, votedFor string) error
+}
+
+var _ ReplicatedStore = (*Store)(nil)
+
+// SetReplicationHook enables the replication log. It must be called before the store is used.
+func (s *Store) SetReplicationHook(hook ReplicationHook) {
+	s.replication = hook
+}
+
+// leaderTerm returns the term of new log entries, or 0 without replication.
+func (s *Store) leaderTerm() (int64, error) {
+	if s.replication == nil {
+		return 0, nil
+	}
+	return s.replication.LeaderTerm()
+}
+
+// waitReplicated waits until the log entry seq is replicated. Changes not logged have seq 0.
+func (s *Store) waitReplicated(seq int64) error {
+	if s.replication == nil || seq == 0 {
+		return nil
+	}
+	return s.replication.WaitReplicated(seq)
+}
+
+// logChange appends entry to the replication log as part of tx and returns its sequence
+// number, or 0 without replication. s.mu must be held.
+func (s *Store) logChange(ctx context.Context, tx *sqlTx, term int64, entry *models.MetadataLogEntry) (int64, error) {
+	if s.replication == nil {
+		return 0, nil
+	}
+
+	last, _, err := lastLogPosition(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	entry.Seq = last + 1
+	entry.Term = term
+	if err := insertLogEntry(ctx, tx, entry); err != nil {
+		return 0, err
+	}
+	return entry.Seq, nil
+}
+
+// insertLogEntry stores entry in the replication log as part of tx.
+func insertLogEntry(ctx context.Context, tx *sqlTx, entry *models.MetadataLogEntry) error {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("%w: failed to serialize log entry: %w", ErrDatabaseError, err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO replication_log (seq, term, entry) VALUES (?, ?, ?)`,
+		entry.Seq, entry.Term, string(encoded),
+	); err != nil {
+		return fmt.Errorf("%w: failed to record log entry: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// querier is implemented by *sqlDB and *sqlTx.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// stateValue returns the value of key in the replication state, or def if it is unset.
+func stateValue(ctx context.Context, db querier, key, def string) (string, error) {
+	var value string
+	err := db.QueryRowContext(ctx, `SELECT value FROM replication_state WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return def, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return value, nil
+}
+
+// stateInt returns the integer value of key in the replication state, or 0 if it is unset.
+func stateInt(ctx context.Context, db querier, key string) (int64, error) {
+	value, err := stateValue(ctx, db, key, "0")
+	if err != nil {
+		return 0, err
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid %s: %w", ErrDatabaseError, key, err)
+	}
+	return number, nil
+}
+
+// setState sets key in the replication state.
+func setState(ctx context.Context, db querier, key, value string) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO replication_state (key, value) VALUES (?, ?)
+		 ON CONFLICT(key) DO UPDATE SET value = excluded.value`,
+		key, value,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// logBase returns the position the retained log starts after: the last pruned entry or the
+// installed snapshot.
+func logBase(ctx context.Context, db querier) (seq, term int64, err error) {
+	if seq, err = stateInt(ctx, db, stateBaseSeq); err != nil {
+		return 0, 0, err
+	}
+	if term, err = stateInt(ctx, db, stateBaseTerm); err != nil {
+		return 0, 0, err
+	}
+	return seq, term, nil
+}
+
+// lastLogPosition returns the sequence number and term of the last log entry.
+func lastLogPosition(ctx context.Context, db querier) (seq, term int64, err error) {
+	err = db.QueryRowContext(ctx, `SELECT seq, term FROM replication_log ORDER BY seq DESC LIMIT 1`).Scan(&seq, &term)
+	if errors.Is(err, sql.ErrNoRows) {
+		return logBase(ctx, db)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return seq, term, nil
+}
+
+// logTerm returns the term of the log entry seq. found is false if the entry was pruned or
+// is beyond the end of the log.
+func logTerm(ctx context.Context, db querier, seq int64) (term int64, found bool, err error) {
+	baseSeq, baseTerm, err := logBase(ctx, db)
+	if err != nil {
+		return 0, false, err
+	}
+	switch {
+	case seq == baseSeq:
+		return baseTerm, true, nil
+	case seq < baseSeq:
+		return 0, false, nil
+	}
+
+	err = db.QueryRowContext(ctx, `SELECT term FROM replication_log WHERE seq = ?`, seq).Scan(&term)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return term, true, nil
+}
+
+// LastLogPosition returns the sequence number and term of the last entry of the replication
+// log, or of the snapshot it starts from.
+func (s *Store) LastLogPosition(ctx context.Context) (seq, term int64, err error) {
+	ctx, done := s.trackQuery(ctx, "last_log_position")
+	defer done()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return lastLogPosition(ctx, s.db)
+}
+
+// LogTerm returns the term of the log entry seq. found is false if the entry was pruned or
+// is beyond the end of the log.
+func (s *Store) LogTerm(ctx context.Context, seq int64) (term int64, found bool, err error) {
+	ctx, done := s.trackQuery(ctx, "log_term")
+	defer done()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return logTerm(ctx, s.db, seq)
+}
+
+// LogEntriesAfter returns up to limit log entries following afterSeq, oldest first. It
+// returns ErrLogPruned if entries following afterSeq were pruned.
+func (s *Store) LogEntriesAfter(ctx context.Context, afterSeq int64, limit int) ([]models.MetadataLogEntry, error) {
+	ctx, done := s.trackQuery(ctx, "log_entries_after")
+	defer done()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	baseSeq, _, err := logBase(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	if afterSeq < baseSeq {
+		return nil, ErrLogPruned
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT entry FROM replication_log WHERE seq > ? ORDER BY seq LIMIT ?`, afterSeq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries []models.MetadataLogEntry
+	for rows.Next() {
+		var (
+			encoded string
+			entry   models.MetadataLogEntry
+		)
+		if err := rows.Scan(&encoded); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+		}
+		if err := json.Unmarshal([]byte(encoded), &entry); err != nil {
+			return nil, fmt.Errorf("%w: failed to parse log entry: %w", ErrDatabaseError, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return entries, nil
+}
+
+// AppendLogEntries applies log entries received from the leader and appends them to the log.
+// The entry prevSeq must be in the log with prevTerm. Entries already in the log are skipped.
+// It returns ErrLogGap if the log ends before prevSeq, and ErrLogConflict if it holds other
+// entries than the leader's; applied changes cannot be undone, so the follower then needs a
+// snapshot.
+func (s *Store) AppendLogEntries(ctx context.Context, prevSeq, prevTerm int64, entries []models.MetadataLogEntry) error {
+	ctx, done := s.trackQuery(ctx, "append_log_entries")
+	defer done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lastSeq, _, err := lastLogPosition(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	if prevSeq > lastSeq {
+		return ErrLogGap
+	}
+	term, found, err := logTerm(ctx, s.db, prevSeq)
+	if err != nil {
+		return err
+	}
+	if !found || term != prevTerm {
+		return ErrLogConflict
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Seq <= lastSeq {
+			term, found, err := logTerm(ctx, s.db, entry.Seq)
+			if err != nil {
+				return err
+			}
+			if !found || term != entry.Term {
+				return ErrLogConflict
+			}
+			continue
+		}
+		if entry.Seq != lastSeq+1 {
+			return ErrLogGap
+		}
+
+		if err := s.applyLogEntry(ctx, entry); err != nil {
+			return err
+		}
+		lastSeq = entry.Seq
+	}
+	return nil
+}
+
+// applyLogEntry makes the change of entry, records its event and appends it to the log in
+// one transaction. s.mu must be held.
+func (s *Store) applyLogEntry(ctx context.Context, entry *models.MetadataLogEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var event *models.Event
+	switch entry.Op {
+	case models.MetadataOpCreateBucket:
+		event, err = applyCreateBucket(ctx, tx, entry)
+	case models.MetadataOpDeleteBucket:
+		event, err = applyDeleteBucket(ctx, tx, entry)
+	case models.MetadataOpPutObject:
+		event, err = applyPutObject(ctx, tx, entry)
+	case models.MetadataOpDeleteObject:
+		event, err = applyDeleteObject(ctx, tx, entry)
+	case models.MetadataOpDeleteBlob:
+		event, err = applyDeleteBlob(ctx, tx, entry)
+	case models.MetadataOpPurgeTombstones:
+		event, err = applyPurgeTombstones(ctx, tx, entry)
+	default:
+		err = fmt.Errorf("%w: unknown log operation %q", ErrDatabaseError, entry.Op)
+	}
+	if err != nil {
+		return err
+	}
+
+	if event != nil {
+		event.ID = entry.EventID
+		if err := insertEvent(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+	if err := insertLogEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// applyCreateBucket inserts the bucket of a create_bucket entry with the leader's ID.
+func applyCreateBucket(ctx context.Context, tx *sqlTx, entry *models.MetadataLogEntry) (*models.Event, error) {
+	record := entry.Record
+	if record == nil {
+		return nil, fmt.Errorf("%w: create_bucket entry %d without bucket", ErrDatabaseError, entry.Seq)
+	}
+	if err := insertBucketRecord(ctx, tx, record); err != nil {
+		return nil, err
+	}
+	return &models.Event{Type: models.EventBucketCreated, Bucket: entry.Bucket, Time: entry.Time}, nil
+}
+
+// insertBucketRecord inserts a bucket with its ID.
+func insertBucketRecord(ctx context.Context, tx *sqlTx, record *models.Bucket) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO buckets (id, name, owner_id, created_at, updated_at, is_public, quota_bytes, placement_policy)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.ID, record.Name, record.OwnerID, record.CreatedAt, record.UpdatedAt, record.IsPublic,
+		record.QuotaBytes, record.PlacementPolicy,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return tx.syncSequence(ctx, "buckets", record.ID)
+}
+
+// applyDeleteBucket deletes the bucket of a delete_bucket entry.
+func applyDeleteBucket(ctx context.Context, tx *sqlTx, entry *models.MetadataLogEntry) (*models.Event, error) {
+	result, err := tx.ExecContext(ctx, `DELETE FROM buckets WHERE name = ?`, entry.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	if deleted == 0 {
+		// The bucket is already gone; the log still advances
+		return nil, nil
+	}
+	return &models.Event{Type: models.EventBucketDeleted, Bucket: entry.Bucket, Time: entry.Time}, nil
+}
+
+// applyPutObject upserts the object of a put_object entry with the leader's ID.
+func applyPutObject(ctx context.Context, tx *sqlTx, entry *models.MetadataLogEntry) (*models.Event, error) {
+	obj := entry.Object
+	if obj == nil {
+		return nil, fmt.Errorf("%w: put_object entry %d without object", ErrDatabaseError, entry.Seq)
+	}
+
+	var bucketID int64
+	err := tx.QueryRowContext(ctx, `SELECT id FROM buckets WHERE name = ?`, entry.Bucket).Scan(&bucketID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: put_object entry %d: %w", ErrDatabaseError, entry.Seq, ErrBucketNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	obj.BucketID = bucketID
+
+	event := &models.Event{
+		Type: models.EventObjectCreated, Bucket: entry.Bucket, Key: obj.Key, Hash: obj.Hash, Size: obj.Size, Time: entry.Time,
+	}
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM objects WHERE bucket_id = ? AND key = ?`, bucketID, obj.Key).
+		Scan(&event.PreviousHash)
+	switch {
+	case err == nil:
+		event.Type = models.EventObjectOverwritten
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+
+	if err := upsertObjectRecord(ctx, tx, obj); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// upsertObjectRecord inserts an object with its ID, or updates the object at its key.
+func upsertObjectRecord(ctx context.Context, tx *sqlTx, obj *models.BucketObject) error {
+	var metadataJSON []byte
+	if len(obj.Metadata) > 0 {
+		var err error
+		if metadataJSON, err = json.Marshal(obj.Metadata); err != nil {
+			return fmt.Errorf("%w: failed to serialize metadata: %w", ErrDatabaseError, err)
+		}
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO objects (id, bucket_id, key, hash, size, content_type, metadata, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(bucket_id, key) DO UPDATE SET
+		 hash = excluded.hash,
+		 size = excluded.size,
+		 content_type = excluded.content_type,
+		 metadata = excluded.metadata,
+		 updated_at = excluded.updated_at`,
+		obj.ID, obj.BucketID, obj.Key, obj.Hash, obj.Size, obj.ContentType, string(metadataJSON), obj.CreatedAt, obj.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return tx.syncSequence(ctx, "objects", obj.ID)
+}
+
+// applyDeleteObject deletes the object of a delete_object entry.
+func applyDeleteObject(ctx context.Context, tx *sqlTx, entry *models.MetadataLogEntry) (*models.Event, error) {
+	event := &models.Event{Type: models.EventObjectDeleted, Bucket: entry.Bucket, Key: entry.Key, Time: entry.Time}
+	err := tx.QueryRowContext(ctx,
+		`DELETE FROM objects WHERE key = ? AND bucket_id = (SELECT id FROM buckets WHERE name = ?) RETURNING hash, size`,
+		entry.Key, entry.Bucket,
+	).Scan(&event.Hash, &event.Size)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The object is already gone; the log still advances
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return event, nil
+}
+
+// Snapshot returns all buckets, objects and tombstones with the log position they include.
+func (s *Store) Snapshot(ctx context.Context) (*models.MetadataSnapshot, error) {
+	ctx, done := s.trackQuery(ctx, "snapshot")
+	defer done()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot := &models.MetadataSnapshot{Buckets: []models.SnapshotBucket{}}
+	var err error
+	if snapshot.Seq, snapshot.Term, err = lastLogPosition(ctx, s.db); err != nil {
+		return nil, err
+	}
+	if snapshot.EventSeq, err = s.lastEventSeq(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, owner_id, created_at, updated_at, is_public, quota_bytes, placement_policy FROM buckets ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	index := make(map[int64]int)
+	for rows.Next() {
+		var record models.SnapshotBucket
+		if err := rows.Scan(&record.ID, &record.Name, &record.OwnerID, &record.CreatedAt, &record.UpdatedAt,
+			&record.IsPublic, &record.QuotaBytes, &record.PlacementPolicy); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+		}
+		record.Objects = []models.BucketObject{}
+		index[record.ID] = len(snapshot.Buckets)
+		snapshot.Buckets = append(snapshot.Buckets, record)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+
+	rows, err = s.db.QueryContext(ctx,
+		`SELECT id, bucket_id, key, hash, size, content_type, metadata, created_at, updated_at FROM objects ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	for rows.Next() {
+		var (
+			obj            models.BucketObject
+			objContentType sql.NullString
+			metadataJSON   sql.NullString
+		)
+		if err := rows.Scan(&obj.ID, &obj.BucketID, &obj.Key, &obj.Hash, &obj.Size, &objContentType, &metadataJSON,
+			&obj.CreatedAt, &obj.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+		}
+		obj.ContentType = objContentType.String
+		if metadataJSON.String != "" {
+			if err := json.Unmarshal([]byte(metadataJSON.String), &obj.Metadata); err != nil {
+				return nil, fmt.Errorf("%w: failed to parse metadata: %w", ErrDatabaseError, err)
+			}
+		}
+		if i, ok := index[obj.BucketID]; ok {
+			snapshot.Buckets[i].Objects = append(snapshot.Buckets[i].Objects, obj)
+		}
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+
+	rows, err = s.db.QueryContext(ctx, `SELECT hash, deleted_at FROM blob_tombstones ORDER BY hash`)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var tombstone models.Tombstone
+		if err := rows.Scan(&tombstone.Hash, &tombstone.DeletedAt); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+		}
+		snapshot.Tombstones = append(snapshot.Tombstones, tombstone)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return snapshot, nil
+}
+
+// lastEventSeq returns the ID of the latest event, or of the last one recorded if every event
+// was pruned. s.mu must be held.
+func (s *Store) lastEventSeq(ctx context.Context) (int64, error) {
+	var latest, oldest int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM events`).Scan(&latest); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	if latest > 0 {
+		return latest, nil
+	}
+	if err := s.db.QueryRowContext(ctx, s.db.dialect.oldestEventID).Scan(&oldest); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return max(oldest-1, 0), nil
+}
+
+// RestoreSnapshot replaces all buckets, objects, tombstones and the replication log with
+// snapshot. The log continues after the snapshot's position. No events are recorded for the
+// changes: the balancer's events are dropped and new ones continue after the snapshot's event
+// sequence, so they are numbered like the leader's. Webhook cursors move to that sequence,
+// since the events before it are not on this balancer.
+func (s *Store) RestoreSnapshot(ctx context.Context, snapshot *models.MetadataSnapshot) error {
+	ctx, done := s.trackQuery(ctx, "restore_snapshot")
+	defer done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, statement := range []string{
+		`DELETE FROM objects`, `DELETE FROM buckets`, `DELETE FROM replication_log`, `DELETE FROM events`,
+		`DELETE FROM blob_tombstones`,
+	} {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+		}
+	}
+	if err := tx.resetSequence(ctx, "events", snapshot.EventSeq); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE webhook_cursors SET last_event_id = ?, updated_at = ?`,
+		snapshot.EventSeq, time.Now()); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	for i := range snapshot.Buckets {
+		record := &snapshot.Buckets[i]
+		if err := insertBucketRecord(ctx, tx, &record.Bucket); err != nil {
+			return err
+		}
+		for j := range record.Objects {
+			obj := &record.Objects[j]
+			obj.BucketID = record.ID
+			if err := upsertObjectRecord(ctx, tx, obj); err != nil {
+				return err
+			}
+		}
+	}
+	for _, tombstone := range snapshot.Tombstones {
+		if err := upsertTombstone(ctx, tx, tombstone.Hash, tombstone.DeletedAt); err != nil {
+			return err
+		}
+	}
+	if err := setState(ctx, tx, stateBaseSeq, strconv.FormatInt(snapshot.Seq, 10)); err != nil {
+		return err
+	}
+	if err := setState(ctx, tx, stateBaseTerm, strconv.FormatInt(snapshot.Term, 10)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
+
+// PruneLog deletes the log entries up to and including throughSeq. Followers further behind
+// need a snapshot. It returns the number of entries deleted.
+func (s *Store) PruneLog(ctx context.Context, throughSeq int64) (int64, error) {
+	ctx, done := s.trackQuery(ctx, "prune_log")
+	defer done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	term, found, err := logTerm(ctx, s.db, throughSeq)
+	if err != nil || !found {
+		return 0, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM replication_log WHERE seq <= ?`, throughSeq)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	if err := setState(ctx, tx, stateBaseSeq, strconv.FormatInt(throughSeq, 10)); err != nil {
+		return 0, err
+	}
+	if err := setState(ctx, tx, stateBaseTerm, strconv.FormatInt(term, 10)); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return deleted, nil
+}
+
+// ElectionState returns the latest election term this balancer has seen and the candidate it
+// voted for in that term.
+func (s *Store) ElectionState(ctx context.Context) (term int64, votedFor string, err error) {
+	ctx, done := s.trackQuery(ctx, "election_state")
+	defer done()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if term, err = stateInt(ctx, s.db, stateCurrentTerm); err != nil {
+		return 0, "", err
+	}
+	if votedFor, err = stateValue(ctx, s.db, stateVotedFor, ""); err != nil {
+		return 0, "", err
+	}
+	return term, votedFor, nil
+}
+
+// SetElectionState records the election term and vote, which must survive restarts so a
+// balancer never votes twice in a term.
+func (s *Store) SetElectionState(ctx context.Context, term int64, votedFor string) error {
+	ctx, done := s.trackQuery(ctx, "set_election_state")
+	defer done()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := setState(ctx, tx, stateCurrentTerm, strconv.FormatInt(term, 10)); err != nil {
+		return err
+	}
+	if err := setState(ctx, tx, stateVotedFor, votedFor); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %w", ErrDatabaseError, err)
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// testHook is a replication hook with a fixed term.
+type testHook struct {
+	term    int64
+	err     error
+	waited  []int64
+	waitErr error
+}
+
+func (h *testHook) LeaderTerm() (int64, error) {
+	return h.term, h.err
+}
+
+func (h *testHook) WaitReplicated(seq int64) error {
+	h.waited = append(h.waited, seq)
+	return h.waitErr
+}
+
+// ReplicationTestSuite tests the replication log, snapshots and election state.
+type ReplicationTestSuite struct {
+	suite.Suite
+	leader   *Store
+	follower *Store
+	hook     *testHook
+}
+
+// SetupTest creates a leader store with the replication log enabled and an empty follower.
+func (s *ReplicationTestSuite) SetupTest() {
+	var err error
+	s.leader, err = openTestStore(s.T(), "leader")
+	s.Require().NoError(err)
+	s.hook = &testHook{term: 1}
+	s.leader.SetReplicationHook(s.hook)
+
+	s.follower, err = openTestStore(s.T(), "follower")
+	s.Require().NoError(err)
+	s.follower.SetReplicationHook(&testHook{err: errors.New("not the leader")})
+}
+
+// makeChanges creates a bucket with two objects, overwrites one and deletes the other.
+func (s *ReplicationTestSuite) makeChanges() {
+	_, err := s.leader.CreateBucket(context.Background(), "photos", "alice", &BucketOptions{PlacementPolicy: "most-free"})
+	s.Require().NoError(err)
+	_, err = s.leader.PutObject(context.Background(), "photos", "a.jpg", eventHashA, 10, "image/jpeg", map[string]string{"album": "trip"})
+	s.Require().NoError(err)
+	_, err = s.leader.PutObject(context.Background(), "photos", "b.jpg", eventHashB, 20, "image/jpeg", nil)
+	s.Require().NoError(err)
+	_, err = s.leader.PutObject(context.Background(), "photos", "a.jpg", eventHashB, 20, "image/png", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(s.leader.DeleteObject(context.Background(), "photos", "b.jpg"))
+}
+
+// TestChangesAreLogged tests that each change is logged with the leader's term and waited for.
+func (s *ReplicationTestSuite) TestChangesAreLogged() {
+	s.makeChanges()
+
+	s.Equal([]int64{1, 2, 3, 4, 5}, s.hook.waited)
+	entries, err := s.leader.LogEntriesAfter(context.Background(), 0, 100)
+	s.Require().NoError(err)
+	s.Require().Len(entries, 5)
+	s.Equal(models.MetadataOpCreateBucket, entries[0].Op)
+	s.Equal("alice", entries[0].Record.OwnerID)
+	s.Equal(models.MetadataOpPutObject, entries[3].Op)
+	s.Equal(entries[1].Object.ID, entries[3].Object.ID, "overwrites keep the object ID")
+	s.Equal(models.MetadataOpDeleteObject, entries[4].Op)
+	s.Equal(int64(1), entries[4].Term)
+
+	seq, term, err := s.leader.LastLogPosition(context.Background())
+	s.Require().NoError(err)
+	s.Equal(int64(5), seq)
+	s.Equal(int64(1), term)
+}
+
+// TestNotLeader tests that a store whose hook refuses changes does not make them.
+func (s *ReplicationTestSuite) TestNotLeader() {
+	_, err := s.follower.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().Error(err)
+	exists, err := s.follower.BucketExists(context.Background(), "photos")
+	s.Require().NoError(err)
+	s.False(exists)
+}
+
+// TestAppendLogEntries tests that followers end up with identical records and events.
+func (s *ReplicationTestSuite) TestAppendLogEntries() {
+	s.makeChanges()
+	entries, err := s.leader.LogEntriesAfter(context.Background(), 0, 100)
+	s.Require().NoError(err)
+
+	s.ErrorIs(s.follower.AppendLogEntries(context.Background(), 2, 1, entries[2:]), ErrLogGap)
+	s.Require().NoError(s.follower.AppendLogEntries(context.Background(), 0, 0, entries[:2]))
+	// Resending entries the follower already has is harmless
+	s.Require().NoError(s.follower.AppendLogEntries(context.Background(), 0, 0, entries))
+
+	want, err := s.leader.GetObject(context.Background(), "photos", "a.jpg")
+	s.Require().NoError(err)
+	got, err := s.follower.GetObject(context.Background(), "photos", "a.jpg")
+	s.Require().NoError(err)
+	s.Equal(want.ID, got.ID)
+	s.Equal(eventHashB, got.Hash)
+	s.Equal("image/png", got.ContentType)
+	_, err = s.follower.GetObject(context.Background(), "photos", "b.jpg")
+	s.ErrorIs(err, ErrObjectNotFound)
+
+	events, err := s.follower.EventsAfter(context.Background(), 0, 100)
+	s.Require().NoError(err)
+	s.Require().Len(events, 5)
+	s.Equal(models.EventObjectOverwritten, events[3].Type)
+	s.Equal(eventHashA, events[3].PreviousHash)
+
+	seq, _, err := s.follower.LastLogPosition(context.Background())
+	s.Require().NoError(err)
+	s.Equal(int64(5), seq)
+}
+
+// TestAppendConflict tests that entries from another term at the same position are rejected.
+func (s *ReplicationTestSuite) TestAppendConflict() {
+	s.makeChanges()
+	entries, err := s.leader.LogEntriesAfter(context.Background(), 0, 100)
+	s.Require().NoError(err)
+	s.Require().NoError(s.follower.AppendLogEntries(context.Background(), 0, 0, entries[:3]))
+
+	s.ErrorIs(s.follower.AppendLogEntries(context.Background(), 3, 2, entries[3:]), ErrLogConflict)
+
+	diverged := entries[2]
+	diverged.Term = 2
+	s.ErrorIs(s.follower.AppendLogEntries(context.Background(), 1, 1, []models.MetadataLogEntry{entries[1], diverged}), ErrLogConflict)
+}
+
+// TestSnapshot tests restoring a snapshot and continuing the log after it.
+func (s *ReplicationTestSuite) TestSnapshot() {
+	s.makeChanges()
+	snapshot, err := s.leader.Snapshot(context.Background())
+	s.Require().NoError(err)
+	s.Equal(int64(5), snapshot.Seq)
+	s.Require().Len(snapshot.Buckets, 1)
+	s.Require().Len(snapshot.Buckets[0].Objects, 1)
+	s.Equal(map[string]string(nil), snapshot.Buckets[0].Objects[0].Metadata)
+
+	// The follower's own unrelated data is replaced
+	s.Require().NoError(s.follower.AppendLogEntries(context.Background(), 0, 0, []models.MetadataLogEntry{{
+		Seq: 1, Term: 7, Op: models.MetadataOpCreateBucket, Bucket: "stale",
+		Record: &models.Bucket{ID: 1, Name: "stale", OwnerID: "bob"},
+	}}))
+	s.Require().NoError(s.follower.RestoreSnapshot(context.Background(), snapshot))
+
+	exists, err := s.follower.BucketExists(context.Background(), "stale")
+	s.Require().NoError(err)
+	s.False(exists)
+	got, err := s.follower.GetBucket(context.Background(), "photos")
+	s.Require().NoError(err)
+	s.Equal("most-free", got.PlacementPolicy)
+	s.Equal(int64(1), got.ObjectCount)
+
+	seq, term, err := s.follower.LastLogPosition(context.Background())
+	s.Require().NoError(err)
+	s.Equal(int64(5), seq)
+	s.Equal(int64(1), term)
+
+	_, err = s.leader.CreateBucket(context.Background(), "videos", "alice", nil)
+	s.Require().NoError(err)
+	entries, err := s.leader.LogEntriesAfter(context.Background(), 5, 100)
+	s.Require().NoError(err)
+	s.Require().NoError(s.follower.AppendLogEntries(context.Background(), 5, 1, entries))
+	exists, err = s.follower.BucketExists(context.Background(), "videos")
+	s.Require().NoError(err)
+	s.True(exists)
+}
+
+// TestSnapshotResequencesEvents tests that a restored follower numbers its events like the
+// leader and drops the ones it recorded before
+func (s *ReplicationTestSuite) TestSnapshotResequencesEvents() {
+	ctx := context.Background()
+	s.makeChanges()
+
+	// The follower recorded more events of its own than the leader has
+	s.Require().NoError(s.follower.AppendLogEntries(ctx, 0, 0, []models.MetadataLogEntry{
+		{Seq: 1, Term: 7, Op: models.MetadataOpCreateBucket, Bucket: "stale", Record: &models.Bucket{ID: 1, Name: "stale", OwnerID: "bob"}},
+		{Seq: 2, Term: 7, Op: models.MetadataOpDeleteBucket, Bucket: "stale"},
+		{Seq: 3, Term: 7, Op: models.MetadataOpCreateBucket, Bucket: "stale", Record: &models.Bucket{ID: 2, Name: "stale", OwnerID: "bob"}},
+		{Seq: 4, Term: 7, Op: models.MetadataOpDeleteBucket, Bucket: "stale"},
+		{Seq: 5, Term: 7, Op: models.MetadataOpCreateBucket, Bucket: "stale", Record: &models.Bucket{ID: 3, Name: "stale", OwnerID: "bob"}},
+		{Seq: 6, Term: 7, Op: models.MetadataOpDeleteBucket, Bucket: "stale"},
+	}))
+	s.Require().NoError(s.follower.SetWebhookCursor(ctx, "http://hook", 6))
+
+	snapshot, err := s.leader.Snapshot(ctx)
+	s.Require().NoError(err)
+	s.Equal(int64(5), snapshot.EventSeq)
+	s.Require().NoError(s.follower.RestoreSnapshot(ctx, snapshot))
+
+	events, err := s.follower.EventsAfter(ctx, 0, 100)
+	s.Require().NoError(err)
+	s.Empty(events)
+	oldest, err := s.follower.OldestEventID(ctx)
+	s.Require().NoError(err)
+	s.Equal(int64(6), oldest)
+	cursor, err := s.follower.WebhookCursor(ctx, "http://hook")
+	s.Require().NoError(err)
+	s.Equal(int64(5), cursor)
+
+	_, err = s.leader.CreateBucket(ctx, "videos", "alice", nil)
+	s.Require().NoError(err)
+	entries, err := s.leader.LogEntriesAfter(ctx, 5, 100)
+	s.Require().NoError(err)
+	s.Require().NoError(s.follower.AppendLogEntries(ctx, 5, 1, entries))
+
+	want, err := s.leader.EventsAfter(ctx, 5, 100)
+	s.Require().NoError(err)
+	got, err := s.follower.EventsAfter(ctx, 0, 100)
+	s.Require().NoError(err)
+	s.Require().Len(got, 1)
+	s.Equal(want[0].ID, got[0].ID)
+	s.Equal(models.EventBucketCreated, got[0].Type)
+	s.Equal("videos", got[0].Bucket)
+}
+
+// TestTombstonesReplicated tests that tombstones reach followers through the log and snapshots
+func (s *ReplicationTestSuite) TestTombstonesReplicated() {
+	ctx := context.Background()
+	s.Require().NoError(s.leader.AddTombstone(ctx, eventHashA))
+	s.Require().NoError(s.leader.AddTombstone(ctx, eventHashB))
+	entries, err := s.leader.LogEntriesAfter(ctx, 0, 100)
+	s.Require().NoError(err)
+	s.Require().Len(entries, 2)
+	s.Equal(models.MetadataOpDeleteBlob, entries[0].Op)
+	s.Equal(eventHashA, entries[0].Hash)
+
+	s.Require().NoError(s.follower.AddRepair(ctx, &models.RepairItem{Hash: eventHashA, Size: 1, Wanted: 2}))
+	s.Require().NoError(s.follower.AppendLogEntries(ctx, 0, 0, entries))
+	tombstones, err := s.follower.Tombstones(ctx, "")
+	s.Require().NoError(err)
+	s.Len(tombstones, 2)
+	items, err := s.follower.ListRepairs(ctx, 0)
+	s.Require().NoError(err)
+	s.Empty(items)
+
+	// A purge is replicated, and a snapshot carries the remaining tombstones
+	s.Require().NoError(s.leader.AddTombstone(ctx, eventHashA))
+	purged, err := s.leader.PurgeTombstones(ctx, entries[1].Time.Add(time.Nanosecond))
+	s.Require().NoError(err)
+	s.Equal(int64(1), purged)
+	entries, err = s.leader.LogEntriesAfter(ctx, 2, 100)
+	s.Require().NoError(err)
+	s.Require().NoError(s.follower.AppendLogEntries(ctx, 2, 1, entries))
+	tombstones, err = s.follower.Tombstones(ctx, "")
+	s.Require().NoError(err)
+	s.Len(tombstones, 1)
+	s.Contains(tombstones, eventHashA)
+
+	snapshot, err := s.leader.Snapshot(ctx)
+	s.Require().NoError(err)
+	s.Require().Len(snapshot.Tombstones, 1)
+	restored, err := openTestStore(s.T(), "restored")
+	s.Require().NoError(err)
+	s.Require().NoError(restored.AddTombstone(ctx, eventHashB))
+	s.Require().NoError(restored.RestoreSnapshot(ctx, snapshot))
+	tombstones, err = restored.Tombstones(ctx, "")
+	s.Require().NoError(err)
+	s.Len(tombstones, 1)
+	s.Contains(tombstones, eventHashA)
+}
+
+// TestPruneLog tests that pruned entries are no longer served but the position is kept.
+func (s *ReplicationTestSuite) TestPruneLog() {
+	s.makeChanges()
+
+	deleted, err := s.leader.PruneLog(context.Background(), 3)
+	s.Require().NoError(err)
+	s.Equal(int64(3), deleted)
+
+	_, err = s.leader.LogEntriesAfter(context.Background(), 2, 100)
+	s.ErrorIs(err, ErrLogPruned)
+	entries, err := s.leader.LogEntriesAfter(context.Background(), 3, 100)
+	s.Require().NoError(err)
+	s.Len(entries, 2)
+
+	term, found, err := s.leader.LogTerm(context.Background(), 3)
+	s.Require().NoError(err)
+	s.True(found)
+	s.Equal(int64(1), term)
+
+	// New entries continue the sequence after pruning everything
+	_, err = s.leader.PruneLog(context.Background(), 5)
+	s.Require().NoError(err)
+	_, err = s.leader.CreateBucket(context.Background(), "videos", "alice", nil)
+	s.Require().NoError(err)
+	seq, _, err := s.leader.LastLogPosition(context.Background())
+	s.Require().NoError(err)
+	s.Equal(int64(6), seq)
+}
+
+// TestElectionState tests that the term and vote are persisted.
+func (s *ReplicationTestSuite) TestElectionState() {
+	term, votedFor, err := s.leader.ElectionState(context.Background())
+	s.Require().NoError(err)
+	s.Zero(term)
+	s.Empty(votedFor)
+
+	s.Require().NoError(s.leader.SetElectionState(context.Background(), 3, "http://lb2:8081"))
+	term, votedFor, err = s.leader.ElectionState(context.Background())
+	s.Require().NoError(err)
+	s.Equal(int64(3), term)
+	s.Equal("http://lb2:8081", votedFor)
+}
+
+func TestReplicationSuite(t *testing.T) {
+	suite.Run(t, new(ReplicationTestSuite))
+}
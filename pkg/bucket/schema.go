@@ -10,7 +10,8 @@ CREATE TABLE IF NOT EXISTS buckets (
     created_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
     is_public   BOOLEAN DEFAULT FALSE,
-    quota_bytes INTEGER DEFAULT 0
+    quota_bytes INTEGER DEFAULT 0,
+    placement_policy TEXT NOT NULL DEFAULT ''
 );
 
 -- Objects table: maps names to CAS hashes within buckets
@@ -28,14 +29,191 @@ CREATE TABLE IF NOT EXISTS objects (
     UNIQUE (bucket_id, key)
 );
 
+-- Events table: change log written in the same transaction as each change.
+-- It is the outbox for webhook deliveries.
+CREATE TABLE IF NOT EXISTS events (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    type          TEXT NOT NULL,
+    bucket        TEXT NOT NULL,
+    key           TEXT NOT NULL DEFAULT '',
+    hash          TEXT NOT NULL DEFAULT '',
+    size          INTEGER NOT NULL DEFAULT 0,
+    previous_hash TEXT NOT NULL DEFAULT '',
+    occurred_at   DATETIME NOT NULL
+);
+
+-- Webhook cursors: last event delivered (or dead-lettered) per webhook URL
+CREATE TABLE IF NOT EXISTS webhook_cursors (
+    url           TEXT PRIMARY KEY,
+    last_event_id INTEGER NOT NULL,
+    updated_at    DATETIME NOT NULL
+);
+
+-- Webhook dead letters: events that could not be delivered after all retries
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    url        TEXT NOT NULL,
+    event_id   INTEGER NOT NULL,
+    attempts   INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    failed_at  DATETIME NOT NULL
+);
+
+-- Repair queue: objects stored on fewer backends than the replication factor
+CREATE TABLE IF NOT EXISTS repair_queue (
+    hash       TEXT PRIMARY KEY,
+    size       INTEGER NOT NULL,
+    replicas   TEXT NOT NULL,
+    wanted     INTEGER NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+-- Blob tombstones: deleted hashes, so repairs do not copy them back from backends that
+-- kept a replica
+CREATE TABLE IF NOT EXISTS blob_tombstones (
+    hash       TEXT PRIMARY KEY,
+    deleted_at DATETIME NOT NULL
+);
+
+-- Location cache: backends known to store a hash
+CREATE TABLE IF NOT EXISTS hash_locations (
+    hash       TEXT PRIMARY KEY,
+    backends   TEXT NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+-- Replication log: changes shipped to the other balancers, written only with metadata
+-- replication enabled. Each entry holds the JSON of a models.MetadataLogEntry.
+CREATE TABLE IF NOT EXISTS replication_log (
+    seq   INTEGER PRIMARY KEY,
+    term  INTEGER NOT NULL,
+    entry TEXT NOT NULL
+);
+
+-- Replication state: election term and vote, and the log position pruned entries ended at
+CREATE TABLE IF NOT EXISTS replication_state (
+    key   TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
 -- Indexes for performance
 CREATE INDEX IF NOT EXISTS idx_buckets_owner ON buckets(owner_id);
 CREATE INDEX IF NOT EXISTS idx_buckets_name ON buckets(name);
 CREATE INDEX IF NOT EXISTS idx_objects_bucket ON objects(bucket_id);
 CREATE INDEX IF NOT EXISTS idx_objects_hash ON objects(hash);
 CREATE INDEX IF NOT EXISTS idx_objects_key ON objects(bucket_id, key);
+CREATE INDEX IF NOT EXISTS idx_events_bucket ON events(bucket, id);
+CREATE INDEX IF NOT EXISTS idx_events_time ON events(occurred_at);
+CREATE INDEX IF NOT EXISTS idx_hash_locations_updated ON hash_locations(updated_at);
+CREATE INDEX IF NOT EXISTS idx_blob_tombstones_deleted ON blob_tombstones(deleted_at);
+`
+
+// PostgresSchema contains the SQL statements to create the bucket database schema in
+// PostgreSQL. It has the tables of Schema with PostgreSQL types.
+const PostgresSchema = `
+CREATE TABLE IF NOT EXISTS buckets (
+    id          BIGSERIAL PRIMARY KEY,
+    name        TEXT UNIQUE NOT NULL,
+    owner_id    TEXT NOT NULL,
+    created_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    is_public   BOOLEAN DEFAULT FALSE,
+    quota_bytes BIGINT DEFAULT 0,
+    placement_policy TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS objects (
+    id           BIGSERIAL PRIMARY KEY,
+    bucket_id    BIGINT NOT NULL REFERENCES buckets(id) ON DELETE CASCADE,
+    key          TEXT NOT NULL,
+    hash         TEXT NOT NULL,
+    size         BIGINT NOT NULL,
+    content_type TEXT,
+    metadata     TEXT,
+    created_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at   TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (bucket_id, key)
+);
+
+CREATE TABLE IF NOT EXISTS events (
+    id            BIGSERIAL PRIMARY KEY,
+    type          TEXT NOT NULL,
+    bucket        TEXT NOT NULL,
+    key           TEXT NOT NULL DEFAULT '',
+    hash          TEXT NOT NULL DEFAULT '',
+    size          BIGINT NOT NULL DEFAULT 0,
+    previous_hash TEXT NOT NULL DEFAULT '',
+    occurred_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_cursors (
+    url           TEXT PRIMARY KEY,
+    last_event_id BIGINT NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+    id         BIGSERIAL PRIMARY KEY,
+    url        TEXT NOT NULL,
+    event_id   BIGINT NOT NULL,
+    attempts   INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    failed_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS repair_queue (
+    hash       TEXT PRIMARY KEY,
+    size       BIGINT NOT NULL,
+    replicas   TEXT NOT NULL,
+    wanted     INTEGER NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS blob_tombstones (
+    hash       TEXT PRIMARY KEY,
+    deleted_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS hash_locations (
+    hash       TEXT PRIMARY KEY,
+    backends   TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS replication_log (
+    seq   BIGINT PRIMARY KEY,
+    term  BIGINT NOT NULL,
+    entry TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS replication_state (
+    key   TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_buckets_owner ON buckets(owner_id);
+CREATE INDEX IF NOT EXISTS idx_objects_bucket ON objects(bucket_id);
+CREATE INDEX IF NOT EXISTS idx_objects_hash ON objects(hash);
+CREATE INDEX IF NOT EXISTS idx_events_bucket ON events(bucket, id);
+CREATE INDEX IF NOT EXISTS idx_events_time ON events(occurred_at);
+CREATE INDEX IF NOT EXISTS idx_hash_locations_updated ON hash_locations(updated_at);
+CREATE INDEX IF NOT EXISTS idx_blob_tombstones_deleted ON blob_tombstones(deleted_at);
 `
 
+// columnMigrations adds columns introduced after a table was first created to databases
+// created before, keyed by table and column.
+var columnMigrations = []struct {
+	table, column, definition string
+}{
+	{"buckets", "placement_policy", "TEXT NOT NULL DEFAULT ''"},
+}
+
 // bucketNameMinLength is the minimum length for a bucket name.
 const bucketNameMinLength = 3
 
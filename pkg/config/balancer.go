@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Common holds the logging and tracing settings shared by casd and cas-balancer.
+type Common struct {
+	Debug            bool    `config:"debug"`
+	DebugAddr        string  `config:"debug_addr"`
+	LogFormat        string  `config:"log_format"`
+	LogLevel         string  `config:"log_level"`
+	OTLPEndpoint     string  `config:"otlp_endpoint"`
+	TraceSampleRatio float64 `config:"trace_sample_ratio"`
+}
+
+// Balancer is the configuration of cas-balancer. Backends, the request timeout, the admission
+// limits and the log settings can be reloaded while it runs.
+type Balancer struct {
+	Common
+
+	Addr                  string        `config:"addr"`
+	Backends              StringList    `config:"backends"`
+	BackendsFile          string        `config:"backends_file"`
+	BackendsSRV           string        `config:"backends_srv"`
+	BackendsSRVScheme     string        `config:"backends_srv_scheme"`
+	BackendsWatchInterval time.Duration `config:"backends_watch_interval"`
+	RetryMax              int           `config:"retry_max"`
+	RetryWaitMin          time.Duration `config:"retry_wait_min"`
+	RetryWaitMax          time.Duration `config:"retry_wait_max"`
+	RequestTimeout        time.Duration `config:"request_timeout"`
+	ShutdownTimeout       time.Duration `config:"shutdown_timeout"`
+	HealthCheckInterval   time.Duration `config:"health_check_interval"`
+	HealthCheckTimeout    time.Duration `config:"health_check_timeout"`
+	NodeInfoInterval      time.Duration `config:"node_info_interval"`
+	BreakerWindow         time.Duration `config:"breaker_window"`
+	BreakerMinRequests    int           `config:"breaker_min_requests"`
+	BreakerErrorRate      float64       `config:"breaker_error_rate"`
+	BreakerSlowThreshold  time.Duration `config:"breaker_slow_threshold"`
+	BreakerFailures       int           `config:"breaker_failures"`
+	BreakerOpenTimeout    time.Duration `config:"breaker_open_timeout"`
+	DB                    string        `config:"db"`
+	DBDSN                 string        `config:"db_dsn"`
+	MetadataAdvertise     string        `config:"metadata_advertise"`
+	MetadataPeers         StringList    `config:"metadata_peers"`
+	MetadataHeartbeat     time.Duration `config:"metadata_heartbeat_interval"`
+	MetadataElection      time.Duration `config:"metadata_election_timeout"`
+	MetadataCommitTimeout time.Duration `config:"metadata_commit_timeout"`
+	MetadataLogRetention  int           `config:"metadata_log_retention"`
+	AuditLog              string        `config:"audit_log"`
+	AuditDB               string        `config:"audit_db"`
+	WebhookURLs           StringList    `config:"webhook_url"`
+	WebhookSecret         string        `config:"webhook_secret"`
+	WebhookMaxAttempts    int           `config:"webhook_max_attempts"`
+	EventRetention        time.Duration `config:"event_retention"`
+	ReplicationFactor     int           `config:"replication_factor"`
+	WriteQuorum           int           `config:"write_quorum"` // 0 means a majority of ReplicationFactor
+	Placement             string        `config:"placement"`
+	UploadPolicy          string        `config:"upload_policy"`
+	HedgePercentile       float64       `config:"hedge_percentile"`
+	LocationCacheSize     int           `config:"location_cache_size"`
+	LocationCachePersist  bool          `config:"location_cache_persist"`
+	RepairInterval        time.Duration `config:"repair_interval"`
+	RepairQueueInterval   time.Duration `config:"repair_queue_interval"`
+	RepairRate            float64       `config:"repair_rate"`
+	RepairBandwidth       int64         `config:"repair_bandwidth"`
+	AdminToken            string        `config:"admin_token"`
+	OwnerRequestRate      float64       `config:"owner_request_rate"`
+	OwnerByteRate         int64         `config:"owner_byte_rate"`
+	BucketRequestRate     float64       `config:"bucket_request_rate"`
+	BucketByteRate        int64         `config:"bucket_byte_rate"`
+	BackendConcurrency    int           `config:"backend_concurrency"`
+}
+
+// Validate checks that the configuration is complete and consistent.
+func (c *Balancer) Validate() error {
+	switch {
+	case c.BackendsFile != "" && c.BackendsSRV != "":
+		return fmt.Errorf("%w: only one of backends_file and backends_srv can be set", ErrInvalidConfig)
+	case c.BackendsSRV != "" && c.BackendsSRVScheme != "http" && c.BackendsSRVScheme != "https":
+		return fmt.Errorf("%w: backends_srv_scheme must be http or https", ErrInvalidConfig)
+	case c.BackendsFile == "" && c.BackendsSRV == "" && len(c.Backends) == 0:
+		return fmt.Errorf("%w: at least one backend must be set with backends, backends_file or backends_srv",
+			ErrInvalidConfig)
+	}
+	for _, backend := range c.Backends {
+		if !isHTTPURL(backend) {
+			return fmt.Errorf("%w: backend %q must start with http:// or https://", ErrInvalidConfig, backend)
+		}
+	}
+
+	if c.ReplicationFactor < 1 {
+		return fmt.Errorf("%w: replication_factor must be at least 1", ErrInvalidConfig)
+	}
+	if c.WriteQuorum < 0 || c.WriteQuorum > c.ReplicationFactor {
+		return fmt.Errorf("%w: write_quorum must be between 1 and the replication factor", ErrInvalidConfig)
+	}
+	if c.HedgePercentile < 0 || c.HedgePercentile > 1 {
+		return fmt.Errorf("%w: hedge_percentile must be between 0 and 1", ErrInvalidConfig)
+	}
+	if c.LocationCacheSize < 0 {
+		return fmt.Errorf("%w: location_cache_size must not be negative", ErrInvalidConfig)
+	}
+	if c.DB != "" && c.DBDSN != "" {
+		return fmt.Errorf("%w: set only one of db and db_dsn", ErrInvalidConfig)
+	}
+	if c.LocationCachePersist && !c.hasBucketStore() {
+		return fmt.Errorf("%w: location_cache_persist requires the bucket store, set db or db_dsn", ErrInvalidConfig)
+	}
+	if c.BreakerErrorRate < 0 || c.BreakerErrorRate > 1 {
+		return fmt.Errorf("%w: breaker_error_rate must be between 0 and 1", ErrInvalidConfig)
+	}
+	if c.OwnerRequestRate < 0 || c.OwnerByteRate < 0 || c.BucketRequestRate < 0 || c.BucketByteRate < 0 ||
+		c.BackendConcurrency < 0 {
+		return fmt.Errorf("%w: rate limits and backend_concurrency must not be negative", ErrInvalidConfig)
+	}
+	if c.RepairInterval < 0 || c.RepairQueueInterval < 0 || c.RepairRate < 0 || c.RepairBandwidth < 0 {
+		return fmt.Errorf("%w: repair intervals and limits must not be negative", ErrInvalidConfig)
+	}
+
+	if err := c.validateMetadataReplication(); err != nil {
+		return err
+	}
+
+	for _, url := range c.WebhookURLs {
+		if !isHTTPURL(url) {
+			return fmt.Errorf("%w: webhook URL %q must start with http:// or https://", ErrInvalidConfig, url)
+		}
+	}
+	if len(c.WebhookURLs) > 0 && !c.hasBucketStore() {
+		return fmt.Errorf("%w: webhooks require the bucket store, set db or db_dsn", ErrInvalidConfig)
+	}
+	if c.WebhookMaxAttempts < 1 {
+		return fmt.Errorf("%w: webhook_max_attempts must be at least 1", ErrInvalidConfig)
+	}
+	return c.Common.validate()
+}
+
+// hasBucketStore reports whether a SQLite or PostgreSQL bucket store is configured.
+func (c *Balancer) hasBucketStore() bool {
+	return c.DB != "" || c.DBDSN != ""
+}
+
+// validateMetadataReplication checks the replication of bucket metadata between balancers.
+func (c *Balancer) validateMetadataReplication() error {
+	if c.MetadataAdvertise == "" {
+		if len(c.MetadataPeers) > 0 {
+			return fmt.Errorf("%w: metadata_peers require metadata_advertise", ErrInvalidConfig)
+		}
+		return nil
+	}
+	if !c.hasBucketStore() {
+		return fmt.Errorf("%w: metadata replication requires the bucket store, set db or db_dsn", ErrInvalidConfig)
+	}
+	if c.AdminToken == "" {
+		return fmt.Errorf("%w: metadata replication requires admin_token to authenticate the balancers", ErrInvalidConfig)
+	}
+	for _, url := range append([]string{c.MetadataAdvertise}, c.MetadataPeers...) {
+		if !isHTTPURL(url) {
+			return fmt.Errorf("%w: metadata URL %q must start with http:// or https://", ErrInvalidConfig, url)
+		}
+	}
+	if c.MetadataHeartbeat < 0 || c.MetadataElection < 0 || c.MetadataCommitTimeout < 0 || c.MetadataLogRetention < 0 {
+		return fmt.Errorf("%w: metadata replication intervals and retention must not be negative", ErrInvalidConfig)
+	}
+	if c.MetadataHeartbeat > 0 && c.MetadataElection > 0 && c.MetadataElection <= 2*c.MetadataHeartbeat {
+		return fmt.Errorf("%w: metadata_election_timeout must be more than twice metadata_heartbeat_interval",
+			ErrInvalidConfig)
+	}
+	return nil
+}
+
+// validate checks the shared settings.
+func (c *Common) validate() error {
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		return fmt.Errorf("%w: trace_sample_ratio must be between 0 and 1", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// isHTTPURL reports whether url starts with http:// or https://.
+func isHTTPURL(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
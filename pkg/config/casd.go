@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// CASD is the configuration of casd. The mount TTL, the loop operation timeouts and the log
+// settings can be reloaded while it runs.
+type CASD struct {
+	Common
+
+	Addr              string        `config:"addr"`
+	Storage           string        `config:"storage"`
+	Web               string        `config:"web"`
+	LoopSize          int64         `config:"loop_size"` // Megabytes
+	BaseTimeout       time.Duration `config:"base_timeout"`
+	DDTimeoutPerGB    time.Duration `config:"dd_timeout_per_gb"`
+	MkfsTimeoutPerGB  time.Duration `config:"mkfs_timeout_per_gb"`
+	RsyncTimeoutPerGB time.Duration `config:"rsync_timeout_per_gb"`
+	MinLongTimeout    time.Duration `config:"min_long_timeout"`
+	MaxLongTimeout    time.Duration `config:"max_long_timeout"`
+	MountTTL          time.Duration `config:"mount_ttl"`
+	MaxObjectSize     int64         `config:"max_object_size"`
+	HighWaterMark     float64       `config:"high_water_mark"`
+	Mode              string        `config:"mode"`
+	AdminToken        string        `config:"admin_token"`
+	FsckInterval      time.Duration `config:"fsck_interval"`
+	PackThreshold     int64         `config:"pack_threshold"`
+}
+
+// Validate checks that the configuration is complete and consistent.
+func (c *CASD) Validate() error {
+	if c.Storage == "" {
+		return fmt.Errorf("%w: storage must be set", ErrInvalidConfig)
+	}
+	if c.LoopSize <= 0 {
+		return fmt.Errorf("%w: loop_size must be positive", ErrInvalidConfig)
+	}
+	if c.BaseTimeout <= 0 || c.DDTimeoutPerGB <= 0 || c.MkfsTimeoutPerGB <= 0 || c.RsyncTimeoutPerGB <= 0 {
+		return fmt.Errorf("%w: loop operation timeouts must be positive", ErrInvalidConfig)
+	}
+	if c.MinLongTimeout <= 0 || c.MaxLongTimeout < c.MinLongTimeout {
+		return fmt.Errorf("%w: min_long_timeout must be positive and not above max_long_timeout", ErrInvalidConfig)
+	}
+	if c.MountTTL < 0 || c.FsckInterval < 0 {
+		return fmt.Errorf("%w: mount_ttl and fsck_interval must not be negative", ErrInvalidConfig)
+	}
+	if c.MaxObjectSize < 0 || c.PackThreshold < 0 {
+		return fmt.Errorf("%w: max_object_size and pack_threshold must not be negative", ErrInvalidConfig)
+	}
+	if c.HighWaterMark < 0 || c.HighWaterMark > 100 {
+		return fmt.Errorf("%w: high_water_mark must be between 0 and 100", ErrInvalidConfig)
+	}
+	return c.Common.validate()
+}
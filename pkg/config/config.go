@@ -0,0 +1,225 @@
+// Package config loads the settings of casd and cas-balancer. Values come from the defaults,
+// a YAML or TOML file, LOOPFS_ environment variables and command-line flags, each overriding
+// the ones before. Keys are the flag names with dashes replaced by underscores, so the flag
+// -request-timeout is request_timeout in a file and LOOPFS_REQUEST_TIMEOUT in the environment.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+)
+
+// EnvPrefix is the prefix of environment variables overriding configuration keys.
+const EnvPrefix = "LOOPFS_"
+
+// configFlag is the flag naming the configuration file, which is not a configuration key.
+const configFlag = "config"
+
+var (
+	// ErrUnknownKey is returned for a key that is not part of the configuration.
+	ErrUnknownKey = errors.New("unknown configuration key")
+	// ErrInvalidValue is returned for a value that cannot be parsed into its key's type.
+	ErrInvalidValue = errors.New("invalid configuration value")
+	// ErrUnsupportedFormat is returned for a configuration file that is neither YAML nor TOML.
+	ErrUnsupportedFormat = errors.New("unsupported configuration file format")
+	// ErrInvalidConfig is returned when a loaded configuration fails validation.
+	ErrInvalidConfig = errors.New("invalid configuration")
+)
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// StringList is a list of strings given as a comma-separated string in flags and
+// environment variables and as a list or a comma-separated string in files.
+type StringList []string
+
+// String joins the list with commas.
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set replaces the list with the non-empty items of a comma-separated string.
+func (l *StringList) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// Loader loads a configuration from a file, the environment and the flags given on the
+// command line. It can be called again to reload the file and environment, for example on
+// SIGHUP; the command-line flags keep overriding them.
+type Loader struct {
+	path  string
+	flags map[string]string // Values of the flags set on the command line by name
+}
+
+// NewLoader creates a loader for the file at path, which may be empty, keeping the values
+// of the flags in flags that were set on the command line.
+func NewLoader(path string, flags *flag.FlagSet) *Loader {
+	loader := &Loader{path: path, flags: make(map[string]string)}
+	if flags != nil {
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name != configFlag {
+				loader.flags[f.Name] = f.Value.String()
+			}
+		})
+	}
+	return loader
+}
+
+// Path returns the path of the configuration file, empty if there is none.
+func (l *Loader) Path() string {
+	return l.path
+}
+
+// Load fills cfg, a pointer to a struct with config tags holding the defaults, from the
+// file, the environment and the command-line flags in that order.
+func (l *Loader) Load(cfg any) error {
+	fields := fieldsByKey(reflect.ValueOf(cfg).Elem())
+
+	if l.path != "" {
+		values, err := readFile(l.path)
+		if err != nil {
+			return err
+		}
+		for key, value := range values {
+			if err := setKey(fields, key, value); err != nil {
+				return fmt.Errorf("%s: %w", l.path, err)
+			}
+		}
+	}
+
+	for key, field := range fields {
+		if value, ok := os.LookupEnv(EnvPrefix + strings.ToUpper(key)); ok {
+			if err := setField(field, value); err != nil {
+				return fmt.Errorf("%s%s: %w", EnvPrefix, strings.ToUpper(key), err)
+			}
+		}
+	}
+
+	for name, value := range l.flags {
+		if err := setKey(fields, strings.ReplaceAll(name, "-", "_"), value); err != nil {
+			return fmt.Errorf("flag -%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// readFile decodes a YAML or TOML file, chosen by its extension, into values by key.
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	values := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// fieldsByKey maps the config tags of a struct, including embedded structs, to its fields.
+func fieldsByKey(value reflect.Value) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for key, embedded := range fieldsByKey(value.Field(i)) {
+				fields[key] = embedded
+			}
+			continue
+		}
+		if key := field.Tag.Get("config"); key != "" {
+			fields[key] = value.Field(i)
+		}
+	}
+	return fields
+}
+
+// setKey sets the field of key to a value decoded from a file or given as a string.
+func setKey(fields map[string]reflect.Value, key string, value any) error {
+	field, ok := fields[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, key)
+	}
+
+	switch value := value.(type) {
+	case string:
+		return setField(field, value)
+	case []any:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			items = append(items, fmt.Sprint(item))
+		}
+		return setField(field, strings.Join(items, ","))
+	case map[string]any:
+		return fmt.Errorf("%w: %s must not be a table", ErrInvalidValue, key)
+	default:
+		return setField(field, fmt.Sprint(value))
+	}
+}
+
+// setField parses value into the type of field.
+func setField(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	if field.Type() == durationType {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidValue, err)
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.Kind() { //nolint:exhaustive // Only the kinds used by configuration structs
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidValue, err)
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidValue, err)
+		}
+		field.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidValue, err)
+		}
+		field.SetFloat(parsed)
+	case reflect.Slice:
+		var list StringList
+		_ = list.Set(value)
+		field.Set(reflect.ValueOf([]string(list)).Convert(field.Type()))
+	default:
+		return fmt.Errorf("%w: unsupported type %s", ErrInvalidValue, field.Type())
+	}
+	return nil
+}
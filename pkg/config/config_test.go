@@ -0,0 +1,231 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// ConfigTestSuite tests loading configuration from files, the environment and flags
+type ConfigTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (s *ConfigTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+}
+
+func (s *ConfigTestSuite) writeFile(name, content string) string {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// defaultBalancer returns a valid balancer configuration
+func defaultBalancer() Balancer {
+	return Balancer{
+		Common:             Common{LogLevel: "info", TraceSampleRatio: 1},
+		Addr:               ":8081",
+		Backends:           StringList{"http://localhost:8080"},
+		RetryMax:           3,
+		RequestTimeout:     30 * time.Second,
+		ReplicationFactor:  1,
+		WebhookMaxAttempts: 5,
+	}
+}
+
+// TestLoadYAML tests that a YAML file overrides the defaults
+func (s *ConfigTestSuite) TestLoadYAML() {
+	path := s.writeFile("balancer.yaml", `
+addr: ":9000"
+backends:
+  - http://a:8080
+  - http://b:8080
+request_timeout: 5s
+replication_factor: 2
+hedge_percentile: 0.9
+location_cache_persist: true
+log_level: debug
+`)
+
+	cfg := defaultBalancer()
+	s.Require().NoError(NewLoader(path, nil).Load(&cfg))
+
+	s.Equal(":9000", cfg.Addr)
+	s.Equal(StringList{"http://a:8080", "http://b:8080"}, cfg.Backends)
+	s.Equal(5*time.Second, cfg.RequestTimeout)
+	s.Equal(2, cfg.ReplicationFactor)
+	s.InDelta(0.9, cfg.HedgePercentile, 1e-9)
+	s.True(cfg.LocationCachePersist)
+	s.Equal("debug", cfg.LogLevel)
+	s.Equal(3, cfg.RetryMax)
+}
+
+// TestLoadTOML tests that a TOML file overrides the defaults
+func (s *ConfigTestSuite) TestLoadTOML() {
+	path := s.writeFile("casd.toml", `
+storage = "/srv/cas"
+loop_size = 2048
+mount_ttl = "1m"
+high_water_mark = 90
+`)
+
+	cfg := CASD{Storage: "/data/cas", LoopSize: 1024, MountTTL: 5 * time.Minute}
+	s.Require().NoError(NewLoader(path, nil).Load(&cfg))
+
+	s.Equal("/srv/cas", cfg.Storage)
+	s.Equal(int64(2048), cfg.LoopSize)
+	s.Equal(time.Minute, cfg.MountTTL)
+	s.InDelta(90.0, cfg.HighWaterMark, 1e-9)
+}
+
+// TestPrecedence tests that the environment overrides the file and flags override both
+func (s *ConfigTestSuite) TestPrecedence() {
+	path := s.writeFile("balancer.yml", "addr: \":9000\"\nrequest_timeout: 5s\nretry_max: 7\n")
+	s.T().Setenv("LOOPFS_REQUEST_TIMEOUT", "10s")
+	s.T().Setenv("LOOPFS_BACKENDS", "http://env1:8080, http://env2:8080")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.String("config", "", "")
+	flags.String("addr", "", "")
+	flags.String("request-timeout", "", "")
+	s.Require().NoError(flags.Parse([]string{"-config", path, "-request-timeout", "20s"}))
+
+	cfg := defaultBalancer()
+	s.Require().NoError(NewLoader(path, flags).Load(&cfg))
+
+	s.Equal(":9000", cfg.Addr)
+	s.Equal(7, cfg.RetryMax)
+	s.Equal(StringList{"http://env1:8080", "http://env2:8080"}, cfg.Backends)
+	s.Equal(20*time.Second, cfg.RequestTimeout)
+}
+
+// TestReload tests that loading again picks up a changed file
+func (s *ConfigTestSuite) TestReload() {
+	path := s.writeFile("casd.yaml", "mount_ttl: 1m\n")
+	loader := NewLoader(path, nil)
+
+	cfg := CASD{}
+	s.Require().NoError(loader.Load(&cfg))
+	s.Equal(time.Minute, cfg.MountTTL)
+
+	s.writeFile("casd.yaml", "mount_ttl: 2m\n")
+	cfg = CASD{}
+	s.Require().NoError(loader.Load(&cfg))
+	s.Equal(2*time.Minute, cfg.MountTTL)
+	s.Equal(path, loader.Path())
+}
+
+// TestLoadErrors tests unknown keys, invalid values and unsupported formats
+func (s *ConfigTestSuite) TestLoadErrors() {
+	cfg := defaultBalancer()
+
+	err := NewLoader(s.writeFile("unknown.yaml", "no_such_key: 1\n"), nil).Load(&cfg)
+	s.ErrorIs(err, ErrUnknownKey)
+
+	err = NewLoader(s.writeFile("invalid.yaml", "request_timeout: soon\n"), nil).Load(&cfg)
+	s.ErrorIs(err, ErrInvalidValue)
+
+	err = NewLoader(s.writeFile("table.toml", "[addr]\nport = 1\n"), nil).Load(&cfg)
+	s.ErrorIs(err, ErrInvalidValue)
+
+	err = NewLoader(s.writeFile("balancer.json", "{}"), nil).Load(&cfg)
+	s.ErrorIs(err, ErrUnsupportedFormat)
+
+	err = NewLoader(filepath.Join(s.dir, "missing.yaml"), nil).Load(&cfg)
+	s.Error(err)
+
+	s.T().Setenv("LOOPFS_RETRY_MAX", "many")
+	err = NewLoader("", nil).Load(&cfg)
+	s.ErrorIs(err, ErrInvalidValue)
+}
+
+// TestBalancerValidate tests validation of the balancer configuration
+func (s *ConfigTestSuite) TestBalancerValidate() {
+	cfg := defaultBalancer()
+	s.NoError(cfg.Validate())
+
+	tests := []struct {
+		name   string
+		modify func(cfg *Balancer)
+	}{
+		{"no backends", func(cfg *Balancer) { cfg.Backends = nil }},
+		{"backend without scheme", func(cfg *Balancer) { cfg.Backends = StringList{"localhost:8080"} }},
+		{"file and srv", func(cfg *Balancer) { cfg.BackendsFile, cfg.BackendsSRV = "backends", "_cas._tcp" }},
+		{"srv scheme", func(cfg *Balancer) { cfg.BackendsSRV, cfg.BackendsSRVScheme = "_cas._tcp", "ftp" }},
+		{"replication factor", func(cfg *Balancer) { cfg.ReplicationFactor = 0 }},
+		{"write quorum", func(cfg *Balancer) { cfg.WriteQuorum = 2 }},
+		{"hedge percentile", func(cfg *Balancer) { cfg.HedgePercentile = 1.5 }},
+		{"breaker error rate", func(cfg *Balancer) { cfg.BreakerErrorRate = 2 }},
+		{"owner rate", func(cfg *Balancer) { cfg.OwnerByteRate = -1 }},
+		{"db and db_dsn", func(cfg *Balancer) { cfg.DB, cfg.DBDSN = "buckets.db", "postgres://db/loopfs" }},
+		{"persist without db", func(cfg *Balancer) { cfg.LocationCachePersist = true }},
+		{"webhook without db", func(cfg *Balancer) { cfg.WebhookURLs = StringList{"http://hook"} }},
+		{"webhook attempts", func(cfg *Balancer) { cfg.WebhookMaxAttempts = 0 }},
+		{"metadata peers without advertise", func(cfg *Balancer) { cfg.MetadataPeers = StringList{"http://lb2:8081"} }},
+		{"metadata without db", func(cfg *Balancer) { cfg.MetadataAdvertise = "http://lb1:8081" }},
+		{"metadata without token", func(cfg *Balancer) { cfg.MetadataAdvertise, cfg.DB = "http://lb1:8081", "buckets.db" }},
+		{"trace sample ratio", func(cfg *Balancer) { cfg.TraceSampleRatio = 2 }},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			cfg := defaultBalancer()
+			tt.modify(&cfg)
+			s.ErrorIs(cfg.Validate(), ErrInvalidConfig)
+		})
+	}
+
+	cfg = defaultBalancer()
+	cfg.Backends = nil
+	cfg.BackendsFile = "backends"
+	s.NoError(cfg.Validate())
+
+	cfg = defaultBalancer()
+	cfg.DBDSN = "postgres://db/loopfs"
+	cfg.WebhookURLs = StringList{"http://hook"}
+	s.NoError(cfg.Validate())
+}
+
+// TestCASDValidate tests validation of the casd configuration
+func (s *ConfigTestSuite) TestCASDValidate() {
+	valid := CASD{
+		Storage:           "/data/cas",
+		LoopSize:          1024,
+		BaseTimeout:       time.Minute,
+		DDTimeoutPerGB:    time.Minute,
+		MkfsTimeoutPerGB:  time.Minute,
+		RsyncTimeoutPerGB: time.Minute,
+		MinLongTimeout:    time.Minute,
+		MaxLongTimeout:    time.Hour,
+	}
+	s.NoError(valid.Validate())
+
+	cfg := valid
+	cfg.LoopSize = 0
+	s.ErrorIs(cfg.Validate(), ErrInvalidConfig)
+
+	cfg = valid
+	cfg.MaxLongTimeout = time.Second
+	s.ErrorIs(cfg.Validate(), ErrInvalidConfig)
+
+	cfg = valid
+	cfg.HighWaterMark = 101
+	s.ErrorIs(cfg.Validate(), ErrInvalidConfig)
+}
+
+// TestStringList tests parsing of comma-separated lists
+func (s *ConfigTestSuite) TestStringList() {
+	var list StringList
+	s.Require().NoError(list.Set(" a ,,b, "))
+	s.Equal(StringList{"a", "b"}, list)
+	s.Equal("a,b", list.String())
+}
+
+func TestConfigSuite(t *testing.T) {
+	suite.Run(t, new(ConfigTestSuite))
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// OnReload calls reload each time the process receives SIGHUP until the returned function
+// is called.
+func OnReload(reload func()) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				reload()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -1,6 +1,8 @@
 package log
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"sync"
@@ -16,6 +18,14 @@ const (
 	minStackTraceLen = 12
 	// Number of characters to skip: "goroutine " (10 chars).
 	goroutinePrefixLen = 10
+	// consoleTimeFormat is the timestamp format of console output.
+	consoleTimeFormat = "15:04:05"
+)
+
+// Output formats accepted by Configure.
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
 )
 
 var (
@@ -71,20 +81,69 @@ func init() {
 	// Configure zerolog with console writer for colored output
 	output := zerolog.ConsoleWriter{
 		Out:        os.Stderr,
-		TimeFormat: "15:04:05",
+		TimeFormat: consoleTimeFormat,
 	}
 
-	Logger = zerolog.New(output).
-		Level(zerolog.InfoLevel).
+	Logger = newLogger(output)
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	// Set global logger
+	log.Logger = Logger
+}
+
+// newLogger creates a logger that tags every event with the goroutine ID. It logs every
+// level; the minimum level is zerolog's global level, which can change while other
+// goroutines log.
+func newLogger(output io.Writer) zerolog.Logger {
+	return zerolog.New(output).
+		Level(zerolog.TraceLevel).
 		With().
 		Timestamp().
 		Logger().
 		Hook(zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, msg string) {
 			e.Str("goid", getGoroutineIDOptimized())
 		}))
+}
 
-	// Set global logger
+// Configure replaces the logger with one writing format ("console" or "json") to stderr at level.
+// It must be called at startup, before other goroutines log; use SetLevel afterwards.
+func Configure(format, level string) error {
+	parsedLevel, err := zerolog.ParseLevel(level)
+	if err != nil || parsedLevel == zerolog.NoLevel {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	var output io.Writer
+	switch format {
+	case FormatConsole:
+		output = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: consoleTimeFormat}
+	case FormatJSON:
+		output = os.Stderr
+	default:
+		return fmt.Errorf("invalid log format %q (must be %s or %s)", format, FormatConsole, FormatJSON)
+	}
+
+	Logger = newLogger(output)
 	log.Logger = Logger
+	zerolog.SetGlobalLevel(parsedLevel)
+	return nil
+}
+
+// SetLevel changes the minimum level of the logger, keeping its format. It is safe to call
+// while other goroutines log.
+func SetLevel(level string) error {
+	parsedLevel, err := zerolog.ParseLevel(level)
+	if err != nil || parsedLevel == zerolog.NoLevel {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	zerolog.SetGlobalLevel(parsedLevel)
+	return nil
+}
+
+// Level returns the minimum level of the logger.
+func Level() zerolog.Level {
+	return zerolog.GlobalLevel()
 }
 
 // Info logs an info message with goroutine ID.
@@ -112,8 +171,7 @@ func Fatal() *zerolog.Event {
 	return Logger.Fatal()
 }
 
-// SetDebugMode switches the logger to debug level.
+// SetDebugMode switches the logger to debug level. It is safe to call while other goroutines log.
 func SetDebugMode() {
-	Logger = Logger.Level(zerolog.DebugLevel)
-	log.Logger = Logger
+	zerolog.SetGlobalLevel(zerolog.DebugLevel)
 }
@@ -0,0 +1,134 @@
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// RequestIDHeader carries the request ID between clients, the balancer and backends.
+	RequestIDHeader = "X-Request-ID"
+	// maxRequestIDLen bounds request IDs accepted from clients.
+	maxRequestIDLen = 128
+	// requestIDBytes is the number of random bytes in a generated request ID.
+	requestIDBytes = 16
+	// serverErrorStatus is the lowest status code logged as a warning.
+	serverErrorStatus = 500
+)
+
+// requestIDKey is the context key for the request ID.
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// Ctx returns the request-scoped logger carried by ctx, which tags every event with the
+// request ID, or the package logger when ctx carries none.
+func Ctx(ctx context.Context) *zerolog.Logger {
+	if logger := zerolog.Ctx(ctx); logger.GetLevel() != zerolog.Disabled {
+		return logger
+	}
+	return &Logger
+}
+
+// NewRequestID generates a random request ID.
+func NewRequestID() string {
+	buf := make([]byte, requestIDBytes)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// validRequestID reports whether a client-supplied request ID is safe to log and forward.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLen {
+		return false
+	}
+	for _, char := range requestID {
+		if char <= ' ' || char > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware returns Echo middleware that assigns each request an ID, taken from the
+// X-Request-ID header when present, stores it and a logger tagged with it in the request
+// context, echoes it in the response and logs the completed request.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			req := ctx.Request()
+
+			requestID := req.Header.Get(RequestIDHeader)
+			if !validRequestID(requestID) {
+				requestID = NewRequestID()
+			}
+			logger := Logger.With().Str("request_id", requestID).Logger()
+			ctx.SetRequest(req.WithContext(logger.WithContext(WithRequestID(req.Context(), requestID))))
+			ctx.Response().Header().Set(RequestIDHeader, requestID)
+
+			err := next(ctx)
+			if err != nil {
+				ctx.Error(err)
+			}
+
+			status := ctx.Response().Status
+			event := logger.Info()
+			if status >= serverErrorStatus {
+				event = logger.Warn()
+			}
+			if err != nil {
+				event = event.Err(err)
+			}
+			event.
+				Str("method", req.Method).
+				Str("uri", req.RequestURI).
+				Str("remote_ip", ctx.RealIP()).
+				Int("status", status).
+				Int64("bytes_out", ctx.Response().Size).
+				Dur("latency", time.Since(start)).
+				Msg("Request completed")
+			return err
+		}
+	}
+}
+
+// transport forwards the request ID of the request context to backends.
+type transport struct {
+	next http.RoundTripper
+}
+
+// Transport wraps next so outbound requests carry the X-Request-ID of their context.
+// A nil next uses http.DefaultTransport.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestID := RequestIDFromContext(req.Context())
+	if requestID == "" || req.Header.Get(RequestIDHeader) != "" {
+		return t.next.RoundTrip(req)
+	}
+	outbound := req.Clone(req.Context())
+	outbound.Header.Set(RequestIDHeader, requestID)
+	return t.next.RoundTrip(outbound)
+}
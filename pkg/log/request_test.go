@@ -0,0 +1,176 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/suite"
+)
+
+// RequestTestSuite tests request IDs and request logging
+type RequestTestSuite struct {
+	suite.Suite
+	originalLogger zerolog.Logger
+	originalLevel  zerolog.Level
+	testOutput     *syncBuffer
+}
+
+// SetupTest replaces the logger with a JSON logger writing to a buffer
+func (s *RequestTestSuite) SetupTest() {
+	s.originalLogger = Logger
+	s.originalLevel = Level()
+	s.testOutput = &syncBuffer{}
+	Logger = newLogger(s.testOutput)
+	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+}
+
+// TearDownTest restores the original logger
+func (s *RequestTestSuite) TearDownTest() {
+	Logger = s.originalLogger
+	zlog.Logger = s.originalLogger
+	zerolog.SetGlobalLevel(s.originalLevel)
+}
+
+// events decodes the logged JSON events
+func (s *RequestTestSuite) events() []map[string]any {
+	var events []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(s.testOutput.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		event := map[string]any{}
+		s.Require().NoError(json.Unmarshal([]byte(line), &event))
+		events = append(events, event)
+	}
+	return events
+}
+
+// TestCtx tests that the context logger tags events with the request ID in any goroutine
+func (s *RequestTestSuite) TestCtx() {
+	Ctx(s.T().Context()).Info().Msg("no logger")
+
+	logger := Logger.With().Str("request_id", "req-1").Logger()
+	ctx := logger.WithContext(s.T().Context())
+	Ctx(ctx).Info().Msg("request")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Ctx(ctx).Info().Msg("other goroutine")
+	}()
+	<-done
+	Info().Msg("package logger")
+
+	events := s.events()
+	s.Require().Len(events, 4)
+	s.NotContains(events[0], "request_id")
+	s.Equal("req-1", events[1]["request_id"])
+	s.Equal("req-1", events[2]["request_id"])
+	s.NotContains(events[3], "request_id")
+}
+
+// TestMiddlewarePropagatesRequestID tests that an incoming request ID is reused
+func (s *RequestTestSuite) TestMiddlewarePropagatesRequestID() {
+	e := echo.New()
+	e.Use(Middleware())
+	var contextID string
+	e.GET("/file/:hash/info", func(ctx echo.Context) error {
+		contextID = RequestIDFromContext(ctx.Request().Context())
+		Ctx(ctx.Request().Context()).Info().Msg("inside handler")
+		return ctx.NoContent(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/file/abc/info", nil)
+	req.Header.Set(RequestIDHeader, "client-id-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	s.Equal("client-id-1", rec.Header().Get(RequestIDHeader))
+	s.Equal("client-id-1", contextID)
+	events := s.events()
+	s.Require().Len(events, 2)
+	s.Equal("inside handler", events[0]["message"])
+	s.Equal("client-id-1", events[0]["request_id"])
+	s.Equal("Request completed", events[1]["message"])
+	s.Equal("client-id-1", events[1]["request_id"])
+	s.InDelta(http.StatusNoContent, events[1]["status"], 0)
+	s.Equal("/file/abc/info", events[1]["uri"])
+}
+
+// TestMiddlewareGeneratesRequestID tests that missing or invalid request IDs are replaced
+func (s *RequestTestSuite) TestMiddlewareGeneratesRequestID() {
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/fail", func(_ echo.Context) error {
+		return echo.NewHTTPError(http.StatusInternalServerError, "boom")
+	})
+
+	for _, header := range []string{"", "bad id\n", strings.Repeat("x", maxRequestIDLen+1)} {
+		s.testOutput.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/fail", nil)
+		if header != "" {
+			req.Header.Set(RequestIDHeader, header)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		requestID := rec.Header().Get(RequestIDHeader)
+		s.Len(requestID, 2*requestIDBytes)
+		s.NotEqual(header, requestID)
+		s.Equal(http.StatusInternalServerError, rec.Code)
+
+		events := s.events()
+		s.Require().Len(events, 1)
+		s.Equal("warn", events[0]["level"])
+		s.Equal(requestID, events[0]["request_id"])
+	}
+}
+
+// TestTransportForwardsRequestID tests that outbound requests carry the context's request ID
+func (s *RequestTestSuite) TestTransportForwardsRequestID() {
+	var received []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get(RequestIDHeader))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	client := &http.Client{Transport: Transport(nil)}
+
+	req, err := http.NewRequestWithContext(WithRequestID(s.T().Context(), "req-42"), http.MethodGet, backend.URL, nil)
+	s.Require().NoError(err)
+	resp, err := client.Do(req)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	s.Empty(req.Header.Get(RequestIDHeader), "the caller's request must not be modified")
+
+	req, err = http.NewRequestWithContext(s.T().Context(), http.MethodGet, backend.URL, nil)
+	s.Require().NoError(err)
+	resp, err = client.Do(req)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+
+	s.Equal([]string{"req-42", ""}, received)
+}
+
+// TestConfigure tests format and level validation
+func (s *RequestTestSuite) TestConfigure() {
+	s.Require().NoError(Configure(FormatJSON, "warn"))
+	s.Equal(zerolog.WarnLevel, Level())
+	s.Require().NoError(Configure(FormatConsole, "debug"))
+	s.Equal(zerolog.DebugLevel, Level())
+
+	s.Error(Configure("xml", "info"))
+	s.Error(Configure(FormatJSON, "loud"))
+	s.Error(Configure(FormatJSON, ""))
+}
+
+// TestRequestTestSuite runs the request test suite
+func TestRequestTestSuite(t *testing.T) {
+	suite.Run(t, new(RequestTestSuite))
+}
@@ -0,0 +1,194 @@
+package manager
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+)
+
+const percentMax = 100
+
+var (
+	// ErrInsufficientCapacity is returned when the host filesystem cannot hold a new or resized block.
+	ErrInsufficientCapacity = errors.New("insufficient host capacity for block")
+	// ErrReadOnly is returned when the node is above its high-water mark and refuses new data.
+	ErrReadOnly = errors.New("node is read-only: storage above high-water mark")
+)
+
+// capacityPlanner tracks host filesystem capacity for the directory holding the loop images.
+// Space claimed by resizes in progress is counted as used until the resize finishes,
+// since a resize needs room for the full new image while the old one still exists.
+// Likewise, space for a block that does not exist yet is counted as used from the
+// verification of the upload that creates it until that upload finishes.
+type capacityPlanner struct {
+	mu            sync.Mutex // Serializes capacity checks of concurrent resizes and block creations
+	storageDir    string
+	newBlockSize  int64 // Size in bytes of a freshly created block
+	highWaterMark atomic.Uint64
+	pendingResize atomic.Int64
+	pendingCreate atomic.Int64
+	creating      map[string]int // Reserved block creations by upload hash, guarded by mu
+	statfs        func(path string) (total, available uint64, err error)
+}
+
+// hostStatfs returns the total and available bytes of the filesystem holding path.
+func hostStatfs(path string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	blockSize := uint64(stat.Bsize) // #nosec G115 - syscall values are system dependent
+	return stat.Blocks * blockSize, stat.Bavail * blockSize, nil
+}
+
+// EnableCapacityPlanning makes the manager check the host filesystem under storageDir before
+// creating or resizing blocks. newBlockSize is the size in bytes of a freshly created block.
+func (m *Manager) EnableCapacityPlanning(storageDir string, newBlockSize int64) {
+	m.capacity.storageDir = storageDir
+	m.capacity.newBlockSize = newBlockSize
+	if m.capacity.statfs == nil {
+		m.capacity.statfs = hostStatfs
+	}
+}
+
+// SetHighWaterMark sets the host usage, in percent, above which the node becomes read-only.
+// A value of zero or less disables the high-water mark.
+func (m *Manager) SetHighWaterMark(percent float64) {
+	if percent <= 0 {
+		m.capacity.highWaterMark.Store(0)
+		return
+	}
+	// Stored in hundredths of a percent so it fits an atomic integer
+	m.capacity.highWaterMark.Store(uint64(min(percent, percentMax) * percentMax))
+}
+
+// ProjectedCapacity returns the host capacity as it will be once in-flight resizes and block
+// creations complete.
+// It returns nil if capacity planning is not enabled.
+func (m *Manager) ProjectedCapacity() (*models.CapacityInfo, error) {
+	if m.capacity.storageDir == "" {
+		return nil, nil //nolint:nilnil // capacity planning disabled
+	}
+
+	total, available, err := m.capacity.statfs(m.capacity.storageDir)
+	if err != nil {
+		log.Error().Err(err).Str("storage_dir", m.capacity.storageDir).Msg("Failed to read host capacity")
+		return nil, err
+	}
+
+	pendingResize := uint64(max(m.capacity.pendingResize.Load(), 0))
+	pendingCreate := uint64(max(m.capacity.pendingCreate.Load(), 0))
+	pending := pendingResize + pendingCreate
+	projected := uint64(0)
+	if available > pending {
+		projected = available - pending
+	}
+
+	var usedPercent float64
+	if total > 0 {
+		usedPercent = float64(total-projected) * percentMax / float64(total)
+	}
+
+	highWaterMark := float64(m.capacity.highWaterMark.Load()) / percentMax
+	return &models.CapacityInfo{
+		HostTotal:          total,
+		HostAvailable:      available,
+		PendingResize:      pendingResize,
+		PendingCreate:      pendingCreate,
+		ProjectedAvailable: projected,
+		UsedPercent:        usedPercent,
+		HighWaterMark:      highWaterMark,
+		ReadOnly:           highWaterMark > 0 && usedPercent >= highWaterMark,
+	}, nil
+}
+
+// ReadOnly reports whether the node is above its high-water mark.
+func (m *Manager) ReadOnly() bool {
+	capacity, err := m.ProjectedCapacity()
+	return err == nil && capacity != nil && capacity.ReadOnly
+}
+
+// checkCapacity verifies that the host can take required more bytes on top of pending resizes
+// and block creations.
+func (m *Manager) checkCapacity(required int64) error {
+	capacity, err := m.ProjectedCapacity()
+	if err != nil || capacity == nil {
+		return err
+	}
+
+	if capacity.ReadOnly {
+		log.Warn().
+			Float64("used_percent", capacity.UsedPercent).
+			Float64("high_water_mark", capacity.HighWaterMark).
+			Msg("Node above high-water mark, refusing new data")
+		return ErrReadOnly
+	}
+
+	if required > 0 && uint64(required) > capacity.ProjectedAvailable {
+		log.Warn().
+			Int64("required", required).
+			Uint64("projected_available", capacity.ProjectedAvailable).
+			Uint64("pending_resize", capacity.PendingResize).
+			Uint64("pending_create", capacity.PendingCreate).
+			Msg("Not enough host capacity for block")
+		return ErrInsufficientCapacity
+	}
+	return nil
+}
+
+// reserveResize checks capacity for a resize to newSize bytes and counts it as pending until released.
+func (m *Manager) reserveResize(newSize int64) (func(), error) {
+	m.capacity.mu.Lock()
+	defer m.capacity.mu.Unlock()
+
+	if err := m.checkCapacity(newSize); err != nil {
+		return nil, err
+	}
+	m.capacity.pendingResize.Add(newSize)
+	pendingResizeBytes.Add(float64(newSize))
+	return func() {
+		m.capacity.pendingResize.Add(-newSize)
+		pendingResizeBytes.Add(-float64(newSize))
+	}, nil
+}
+
+// reserveNewBlock checks capacity for the block an upload of hash will create and counts it
+// as pending until releaseNewBlock is called for the same hash.
+func (m *Manager) reserveNewBlock(hash string) error {
+	m.capacity.mu.Lock()
+	defer m.capacity.mu.Unlock()
+
+	if err := m.checkCapacity(m.capacity.newBlockSize); err != nil {
+		return err
+	}
+	if m.capacity.storageDir == "" {
+		return nil
+	}
+	if m.capacity.creating == nil {
+		m.capacity.creating = make(map[string]int)
+	}
+	m.capacity.creating[hash]++
+	m.capacity.pendingCreate.Add(m.capacity.newBlockSize)
+	pendingCreateBytes.Add(float64(m.capacity.newBlockSize))
+	return nil
+}
+
+// releaseNewBlock releases one block creation reserved for hash, if any.
+func (m *Manager) releaseNewBlock(hash string) {
+	m.capacity.mu.Lock()
+	defer m.capacity.mu.Unlock()
+
+	if m.capacity.creating[hash] == 0 {
+		return
+	}
+	m.capacity.creating[hash]--
+	if m.capacity.creating[hash] == 0 {
+		delete(m.capacity.creating, hash)
+	}
+	m.capacity.pendingCreate.Add(-m.capacity.newBlockSize)
+	pendingCreateBytes.Add(-float64(m.capacity.newBlockSize))
+}
@@ -0,0 +1,202 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+
+	"loopfs/pkg/models"
+	"loopfs/pkg/store"
+)
+
+// CapacityTestSuite tests host capacity planning in the store manager
+type CapacityTestSuite struct {
+	suite.Suite
+	mockStore     *MockResizableStore
+	manager       *Manager
+	testHash      string
+	tempFile      string
+	hostTotal     uint64
+	hostAvailable uint64
+	statfsErr     error
+}
+
+// SetupTest runs before each test
+func (s *CapacityTestSuite) SetupTest() {
+	s.testHash = "a1b2c3d4e5f67890123456789abcdef0123456789abcdef0123456789abcdef0"
+	s.tempFile = s.T().TempDir() + "/upload.tmp"
+	s.Require().NoError(os.WriteFile(s.tempFile, []byte("capacity test content"), 0600))
+
+	s.hostTotal = 10000
+	s.hostAvailable = 5000
+	s.statfsErr = nil
+
+	s.mockStore = new(MockResizableStore)
+	s.manager = New(s.mockStore, 100)
+	s.manager.capacity.statfs = func(string) (uint64, uint64, error) {
+		return s.hostTotal, s.hostAvailable, s.statfsErr
+	}
+	s.manager.EnableCapacityPlanning("/storage", 1000)
+}
+
+// TearDownTest runs after each test
+func (s *CapacityTestSuite) TearDownTest() {
+	s.mockStore.AssertExpectations(s.T())
+}
+
+// TestProjectedCapacityDisabled tests that no capacity is reported without planning
+func (s *CapacityTestSuite) TestProjectedCapacityDisabled() {
+	manager := New(s.mockStore, DefaultBufferSize)
+
+	capacity, err := manager.ProjectedCapacity()
+	s.NoError(err)
+	s.Nil(capacity)
+	s.False(manager.ReadOnly())
+}
+
+// TestProjectedCapacity tests the reported capacity figures
+func (s *CapacityTestSuite) TestProjectedCapacity() {
+	s.manager.SetHighWaterMark(90)
+	s.manager.capacity.pendingResize.Store(1000)
+
+	capacity, err := s.manager.ProjectedCapacity()
+	s.Require().NoError(err)
+	s.Equal(uint64(10000), capacity.HostTotal)
+	s.Equal(uint64(5000), capacity.HostAvailable)
+	s.Equal(uint64(1000), capacity.PendingResize)
+	s.Equal(uint64(4000), capacity.ProjectedAvailable)
+	s.InDelta(60.0, capacity.UsedPercent, 0.001)
+	s.InDelta(90.0, capacity.HighWaterMark, 0.001)
+	s.False(capacity.ReadOnly)
+}
+
+// TestProjectedCapacityStatfsError tests that host stat failures are returned
+func (s *CapacityTestSuite) TestProjectedCapacityStatfsError() {
+	s.statfsErr = errors.New("statfs failed")
+
+	_, err := s.manager.ProjectedCapacity()
+	s.Error(err)
+	s.False(s.manager.ReadOnly())
+}
+
+// TestHighWaterMark tests that the node becomes read-only above the high-water mark
+func (s *CapacityTestSuite) TestHighWaterMark() {
+	s.manager.SetHighWaterMark(50)
+	s.True(s.manager.ReadOnly())
+
+	s.hostAvailable = 6000
+	s.False(s.manager.ReadOnly())
+
+	s.manager.SetHighWaterMark(0)
+	s.hostAvailable = 0
+	s.False(s.manager.ReadOnly())
+}
+
+// TestVerifyBlockReadOnly tests that VerifyBlock refuses new data above the high-water mark
+func (s *CapacityTestSuite) TestVerifyBlockReadOnly() {
+	s.manager.SetHighWaterMark(40)
+	diskUsage := &models.DiskUsage{SpaceAvailable: 100000, TotalSpace: 200000}
+	s.mockStore.On("GetDiskUsage", s.testHash).Return(diskUsage, nil)
+
+	err := s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash)
+	s.ErrorIs(err, ErrReadOnly)
+}
+
+// TestVerifyBlockNewBlockCapacity tests the capacity check for blocks that do not exist yet
+func (s *CapacityTestSuite) TestVerifyBlockNewBlockCapacity() {
+	s.mockStore.On("GetDiskUsage", s.testHash).Return(nil, store.FileNotFoundError{Hash: s.testHash})
+
+	s.NoError(s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash))
+
+	s.hostAvailable = 999
+	err := s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash)
+	s.ErrorIs(err, ErrInsufficientCapacity)
+}
+
+// TestVerifyBlockNewBlockCountsAsPending tests that concurrent uploads creating blocks cannot
+// claim the same host space, and that the space is released once the uploads finish
+func (s *CapacityTestSuite) TestVerifyBlockNewBlockCountsAsPending() {
+	const uploads = 10
+	s.mockStore.On("GetDiskUsage", mock.Anything).Return(nil, store.FileNotFoundError{Hash: s.testHash})
+	s.mockStore.On("UploadWithHash", s.tempFile, mock.Anything, "upload.tmp").
+		Return(&models.UploadResponse{Hash: s.testHash}, nil)
+
+	hashes := make([]string, uploads)
+	errs := make([]error, uploads)
+	var wg sync.WaitGroup
+	for i := range uploads {
+		hashes[i] = fmt.Sprintf("%064x", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.manager.VerifyBlock(context.Background(), s.tempFile, hashes[i])
+		}()
+	}
+	wg.Wait()
+
+	// 5000 bytes available hold five blocks of 1000 bytes
+	var admitted []string
+	for i, err := range errs {
+		if err == nil {
+			admitted = append(admitted, hashes[i])
+			continue
+		}
+		s.ErrorIs(err, ErrInsufficientCapacity)
+	}
+	s.Len(admitted, 5)
+
+	capacity, err := s.manager.ProjectedCapacity()
+	s.Require().NoError(err)
+	s.Equal(uint64(5000), capacity.PendingCreate)
+	s.Equal(uint64(0), capacity.ProjectedAvailable)
+
+	for _, hash := range admitted {
+		_, err := s.manager.UploadWithHash(context.Background(), s.tempFile, hash, "upload.tmp")
+		s.Require().NoError(err)
+	}
+	s.Equal(int64(0), s.manager.capacity.pendingCreate.Load())
+	s.Empty(s.manager.capacity.creating)
+
+	// Uploads that did not reserve a block release nothing
+	_, err = s.manager.UploadWithHash(context.Background(), s.tempFile, hashes[0], "upload.tmp")
+	s.Require().NoError(err)
+	s.Equal(int64(0), s.manager.capacity.pendingCreate.Load())
+}
+
+// TestVerifyBlockResizeRefused tests that a resize the host cannot hold is refused
+func (s *CapacityTestSuite) TestVerifyBlockResizeRefused() {
+	diskUsage := &models.DiskUsage{SpaceAvailable: 10, TotalSpace: 6000}
+	s.mockStore.On("GetDiskUsage", s.testHash).Return(diskUsage, nil)
+
+	err := s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash)
+	s.ErrorIs(err, ErrInsufficientCapacity)
+	s.mockStore.AssertNotCalled(s.T(), "ResizeBlock", mock.Anything, mock.Anything)
+}
+
+// TestVerifyBlockResizeCountsAsPending tests that a resize in progress reduces projected capacity
+func (s *CapacityTestSuite) TestVerifyBlockResizeCountsAsPending() {
+	diskUsage := &models.DiskUsage{SpaceAvailable: 10, TotalSpace: 1000}
+	s.mockStore.On("GetDiskUsage", s.testHash).Return(diskUsage, nil)
+
+	var pendingDuringResize uint64
+	s.mockStore.On("ResizeBlock", s.testHash, mock.AnythingOfType("int64")).Run(func(mock.Arguments) {
+		capacity, err := s.manager.ProjectedCapacity()
+		s.Require().NoError(err)
+		pendingDuringResize = capacity.PendingResize
+	}).Return(nil)
+
+	s.Require().NoError(s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash))
+	s.Positive(pendingDuringResize)
+	s.Equal(int64(0), s.manager.capacity.pendingResize.Load())
+}
+
+// TestCapacityTestSuite runs the capacity test suite
+func TestCapacityTestSuite(t *testing.T) {
+	suite.Run(t, new(CapacityTestSuite))
+}
@@ -1,13 +1,18 @@
 package manager
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
+	"time"
 
 	"loopfs/pkg/log"
 	"loopfs/pkg/models"
 	"loopfs/pkg/store"
+	"loopfs/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -20,13 +25,14 @@ const (
 // ResizableStore extends the Store interface with resize capability.
 type ResizableStore interface {
 	store.Store
-	ResizeBlock(hash string, newSize int64) error
+	ResizeBlock(ctx context.Context, hash string, newSize int64) error
 }
 
 // Manager manages storage operations with automatic block resizing.
 type Manager struct {
 	store      ResizableStore
 	bufferSize int64 // Buffer size in bytes for block operations
+	capacity   capacityPlanner
 }
 
 // New creates a new Store Manager with the given store and buffer size.
@@ -42,9 +48,17 @@ func New(store ResizableStore, bufferSize int64) *Manager {
 
 // VerifyBlock verifies that a block has enough space for the incoming file.
 // If not enough space, it resizes the block to accommodate the file.
+// If the block does not exist yet, the host space for creating it stays reserved until
+// UploadWithHash for the same hash returns.
 // sourceFile is the path to the file to be uploaded.
 // hash is the content hash of the file (if available, otherwise empty string).
-func (m *Manager) VerifyBlock(sourceFile string, hash string) error {
+func (m *Manager) VerifyBlock(ctx context.Context, sourceFile string, hash string) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "manager.VerifyBlock", attribute.String("loopfs.hash", hash))
+	defer func() {
+		verifyTotal.WithLabelValues(verifyResult(err)).Inc()
+		span.End(err)
+	}()
+
 	// Get file info to determine size
 	fileInfo, err := os.Stat(sourceFile)
 	if err != nil {
@@ -63,13 +77,13 @@ func (m *Manager) VerifyBlock(sourceFile string, hash string) error {
 	}
 
 	// Get current disk usage for the block
-	diskUsage, err := m.store.GetDiskUsage(hash)
+	diskUsage, err := m.store.GetDiskUsage(ctx, hash)
 	if err != nil {
 		// If the block doesn't exist yet, that's okay - it will be created during upload
 		var fileNotFoundErr store.FileNotFoundError
 		if errors.As(err, &fileNotFoundErr) {
 			log.Debug().Str("hash", hash).Msg("Block does not exist yet, will be created during upload")
-			return nil
+			return m.reserveNewBlock(hash)
 		}
 		log.Error().Err(err).Str("hash", hash).Msg("Failed to get disk usage")
 		return err
@@ -77,52 +91,66 @@ func (m *Manager) VerifyBlock(sourceFile string, hash string) error {
 
 	// Check if there's enough space (file size + buffer)
 	requiredSpace := fileSize + m.bufferSize
-	if diskUsage.SpaceAvailable < requiredSpace {
-		// Calculate new size: original disk size + file size * ResizeFactor + buffer
-		newSize := diskUsage.TotalSpace + fileSize*ResizeFactor + m.bufferSize
-
-		log.Debug().
-			Str("hash", hash).
-			Int64("current_available", diskUsage.SpaceAvailable).
-			Int64("required_space", requiredSpace).
-			Int64("new_size", newSize).
-			Msg("Resizing block to accommodate file")
-
-		// Resize the block
-		if err := m.store.ResizeBlock(hash, newSize); err != nil {
-			log.Error().Err(err).Str("hash", hash).Int64("new_size", newSize).Msg("Failed to resize block")
-			return err
-		}
+	if diskUsage.SpaceAvailable >= requiredSpace {
+		return m.checkCapacity(0)
+	}
 
-		log.Debug().Str("hash", hash).Int64("new_size", newSize).Msg("Block resized successfully")
+	// Calculate new size: original disk size + file size * ResizeFactor + buffer
+	newSize := diskUsage.TotalSpace + fileSize*ResizeFactor + m.bufferSize
+
+	log.Debug().
+		Str("hash", hash).
+		Int64("current_available", diskUsage.SpaceAvailable).
+		Int64("required_space", requiredSpace).
+		Int64("new_size", newSize).
+		Msg("Resizing block to accommodate file")
+
+	// The host must hold the new image next to the old one until the resize completes
+	release, err := m.reserveResize(newSize)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Resize the block
+	start := time.Now()
+	err = m.store.ResizeBlock(ctx, hash, newSize)
+	resizeDuration.WithLabelValues(resizeResult(err)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		log.Error().Err(err).Str("hash", hash).Int64("new_size", newSize).Msg("Failed to resize block")
+		return err
 	}
 
+	log.Debug().Str("hash", hash).Int64("new_size", newSize).Msg("Block resized successfully")
+
 	return nil
 }
 
 // Upload delegates to the underlying store's Upload method.
-func (m *Manager) Upload(reader io.Reader, filename string) (*models.UploadResponse, error) {
-	return m.store.Upload(reader, filename)
+func (m *Manager) Upload(ctx context.Context, reader io.Reader, filename string) (*models.UploadResponse, error) {
+	return m.store.Upload(ctx, reader, filename)
 }
 
 // UploadWithHash delegates to the underlying store's UploadWithHash method.
-func (m *Manager) UploadWithHash(tempFilePath, hash, filename string) (*models.UploadResponse, error) {
-	return m.store.UploadWithHash(tempFilePath, hash, filename)
+// It releases the block creation reserved by VerifyBlock for hash once the block exists.
+func (m *Manager) UploadWithHash(ctx context.Context, tempFilePath, hash, filename string) (*models.UploadResponse, error) {
+	defer m.releaseNewBlock(hash)
+	return m.store.UploadWithHash(ctx, tempFilePath, hash, filename)
 }
 
 // DownloadStream delegates to the underlying store's DownloadStream method.
-func (m *Manager) DownloadStream(hash string) (io.ReadCloser, error) {
-	return m.store.DownloadStream(hash)
+func (m *Manager) DownloadStream(ctx context.Context, hash string) (io.ReadCloser, error) {
+	return m.store.DownloadStream(ctx, hash)
 }
 
 // GetFileInfo delegates to the underlying store's GetFileInfo method.
-func (m *Manager) GetFileInfo(hash string) (*models.FileInfo, error) {
-	return m.store.GetFileInfo(hash)
+func (m *Manager) GetFileInfo(ctx context.Context, hash string) (*models.FileInfo, error) {
+	return m.store.GetFileInfo(ctx, hash)
 }
 
 // Exists delegates to the underlying store's Exists method.
-func (m *Manager) Exists(hash string) (bool, error) {
-	return m.store.Exists(hash)
+func (m *Manager) Exists(ctx context.Context, hash string) (bool, error) {
+	return m.store.Exists(ctx, hash)
 }
 
 // ValidateHash delegates to the underlying store's ValidateHash method.
@@ -131,13 +159,13 @@ func (m *Manager) ValidateHash(hash string) bool {
 }
 
 // Delete delegates to the underlying store's Delete method.
-func (m *Manager) Delete(hash string) error {
-	return m.store.Delete(hash)
+func (m *Manager) Delete(ctx context.Context, hash string) error {
+	return m.store.Delete(ctx, hash)
 }
 
 // GetDiskUsage delegates to the underlying store's GetDiskUsage method.
-func (m *Manager) GetDiskUsage(hash string) (*models.DiskUsage, error) {
-	return m.store.GetDiskUsage(hash)
+func (m *Manager) GetDiskUsage(ctx context.Context, hash string) (*models.DiskUsage, error) {
+	return m.store.GetDiskUsage(ctx, hash)
 }
 
 // GetStore returns the underlying store instance.
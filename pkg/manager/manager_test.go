@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
@@ -20,7 +21,7 @@ type MockResizableStore struct {
 	mock.Mock
 }
 
-func (m *MockResizableStore) Upload(reader io.Reader, filename string) (*models.UploadResponse, error) {
+func (m *MockResizableStore) Upload(_ context.Context, reader io.Reader, filename string) (*models.UploadResponse, error) {
 	args := m.Called(reader, filename)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -28,7 +29,7 @@ func (m *MockResizableStore) Upload(reader io.Reader, filename string) (*models.
 	return args.Get(0).(*models.UploadResponse), args.Error(1)
 }
 
-func (m *MockResizableStore) UploadWithHash(tempFilePath, hash, filename string) (*models.UploadResponse, error) {
+func (m *MockResizableStore) UploadWithHash(_ context.Context, tempFilePath, hash, filename string) (*models.UploadResponse, error) {
 	args := m.Called(tempFilePath, hash, filename)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -36,7 +37,7 @@ func (m *MockResizableStore) UploadWithHash(tempFilePath, hash, filename string)
 	return args.Get(0).(*models.UploadResponse), args.Error(1)
 }
 
-func (m *MockResizableStore) DownloadStream(hash string) (io.ReadCloser, error) {
+func (m *MockResizableStore) DownloadStream(_ context.Context, hash string) (io.ReadCloser, error) {
 	args := m.Called(hash)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -44,7 +45,7 @@ func (m *MockResizableStore) DownloadStream(hash string) (io.ReadCloser, error)
 	return args.Get(0).(io.ReadCloser), args.Error(1)
 }
 
-func (m *MockResizableStore) GetFileInfo(hash string) (*models.FileInfo, error) {
+func (m *MockResizableStore) GetFileInfo(_ context.Context, hash string) (*models.FileInfo, error) {
 	args := m.Called(hash)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -52,7 +53,7 @@ func (m *MockResizableStore) GetFileInfo(hash string) (*models.FileInfo, error)
 	return args.Get(0).(*models.FileInfo), args.Error(1)
 }
 
-func (m *MockResizableStore) Exists(hash string) (bool, error) {
+func (m *MockResizableStore) Exists(_ context.Context, hash string) (bool, error) {
 	args := m.Called(hash)
 	return args.Bool(0), args.Error(1)
 }
@@ -62,12 +63,12 @@ func (m *MockResizableStore) ValidateHash(hash string) bool {
 	return args.Bool(0)
 }
 
-func (m *MockResizableStore) Delete(hash string) error {
+func (m *MockResizableStore) Delete(_ context.Context, hash string) error {
 	args := m.Called(hash)
 	return args.Error(0)
 }
 
-func (m *MockResizableStore) GetDiskUsage(hash string) (*models.DiskUsage, error) {
+func (m *MockResizableStore) GetDiskUsage(_ context.Context, hash string) (*models.DiskUsage, error) {
 	args := m.Called(hash)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -75,7 +76,7 @@ func (m *MockResizableStore) GetDiskUsage(hash string) (*models.DiskUsage, error
 	return args.Get(0).(*models.DiskUsage), args.Error(1)
 }
 
-func (m *MockResizableStore) ResizeBlock(hash string, newSize int64) error {
+func (m *MockResizableStore) ResizeBlock(_ context.Context, hash string, newSize int64) error {
 	args := m.Called(hash, newSize)
 	return args.Error(0)
 }
@@ -144,7 +145,7 @@ func (s *ManagerTestSuite) TestNew() {
 
 // TestVerifyBlockNoHash tests VerifyBlock with empty hash
 func (s *ManagerTestSuite) TestVerifyBlockNoHash() {
-	err := s.manager.VerifyBlock(s.tempFile, "")
+	err := s.manager.VerifyBlock(context.Background(), s.tempFile, "")
 	s.NoError(err) // Should succeed and skip verification
 }
 
@@ -152,7 +153,7 @@ func (s *ManagerTestSuite) TestVerifyBlockNoHash() {
 func (s *ManagerTestSuite) TestVerifyBlockFileStatError() {
 	nonExistentFile := "/nonexistent/file.txt"
 
-	err := s.manager.VerifyBlock(nonExistentFile, s.testHash)
+	err := s.manager.VerifyBlock(context.Background(), nonExistentFile, s.testHash)
 	s.Error(err)
 	s.Contains(err.Error(), "no such file or directory")
 }
@@ -162,7 +163,7 @@ func (s *ManagerTestSuite) TestVerifyBlockFileNotFound() {
 	// Mock GetDiskUsage to return FileNotFoundError
 	s.mockStore.On("GetDiskUsage", s.testHash).Return(nil, store.FileNotFoundError{Hash: s.testHash})
 
-	err := s.manager.VerifyBlock(s.tempFile, s.testHash)
+	err := s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash)
 	s.NoError(err) // Should succeed when block doesn't exist yet
 }
 
@@ -171,7 +172,7 @@ func (s *ManagerTestSuite) TestVerifyBlockGetDiskUsageError() {
 	// Mock GetDiskUsage to return a different error
 	s.mockStore.On("GetDiskUsage", s.testHash).Return(nil, errors.New("disk usage error"))
 
-	err := s.manager.VerifyBlock(s.tempFile, s.testHash)
+	err := s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash)
 	s.Error(err)
 	s.Contains(err.Error(), "disk usage error")
 }
@@ -191,7 +192,7 @@ func (s *ManagerTestSuite) TestVerifyBlockSufficientSpace() {
 	}
 	s.mockStore.On("GetDiskUsage", s.testHash).Return(diskUsage, nil)
 
-	err = s.manager.VerifyBlock(s.tempFile, s.testHash)
+	err = s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash)
 	s.NoError(err) // Should succeed without resize
 }
 
@@ -214,7 +215,7 @@ func (s *ManagerTestSuite) TestVerifyBlockInsufficientSpace() {
 	expectedNewSize := diskUsage.TotalSpace + fileSize*ResizeFactor + DefaultBufferSize
 	s.mockStore.On("ResizeBlock", s.testHash, expectedNewSize).Return(nil)
 
-	err = s.manager.VerifyBlock(s.tempFile, s.testHash)
+	err = s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash)
 	s.NoError(err) // Should succeed after resize
 }
 
@@ -237,7 +238,7 @@ func (s *ManagerTestSuite) TestVerifyBlockResizeError() {
 	expectedNewSize := diskUsage.TotalSpace + fileSize*ResizeFactor + DefaultBufferSize
 	s.mockStore.On("ResizeBlock", s.testHash, expectedNewSize).Return(errors.New("resize failed"))
 
-	err = s.manager.VerifyBlock(s.tempFile, s.testHash)
+	err = s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash)
 	s.Error(err)
 	s.Contains(err.Error(), "resize failed")
 }
@@ -250,7 +251,7 @@ func (s *ManagerTestSuite) TestUpload() {
 
 	s.mockStore.On("Upload", reader, filename).Return(expectedResult, nil)
 
-	result, err := s.manager.Upload(reader, filename)
+	result, err := s.manager.Upload(context.Background(), reader, filename)
 	s.NoError(err)
 	s.Equal(expectedResult, result)
 }
@@ -262,7 +263,7 @@ func (s *ManagerTestSuite) TestUploadError() {
 
 	s.mockStore.On("Upload", reader, filename).Return(nil, errors.New("upload error"))
 
-	result, err := s.manager.Upload(reader, filename)
+	result, err := s.manager.Upload(context.Background(), reader, filename)
 	s.Error(err)
 	s.Nil(result)
 	s.Contains(err.Error(), "upload error")
@@ -274,7 +275,7 @@ func (s *ManagerTestSuite) TestDownloadStream() {
 
 	s.mockStore.On("DownloadStream", s.testHash).Return(mockReader, nil)
 
-	reader, err := s.manager.DownloadStream(s.testHash)
+	reader, err := s.manager.DownloadStream(context.Background(), s.testHash)
 	s.NoError(err)
 	s.Equal(mockReader, reader)
 }
@@ -283,7 +284,7 @@ func (s *ManagerTestSuite) TestDownloadStream() {
 func (s *ManagerTestSuite) TestDownloadStreamError() {
 	s.mockStore.On("DownloadStream", s.testHash).Return(nil, errors.New("download stream error"))
 
-	reader, err := s.manager.DownloadStream(s.testHash)
+	reader, err := s.manager.DownloadStream(context.Background(), s.testHash)
 	s.Error(err)
 	s.Nil(reader)
 	s.Contains(err.Error(), "download stream error")
@@ -299,7 +300,7 @@ func (s *ManagerTestSuite) TestGetFileInfo() {
 
 	s.mockStore.On("GetFileInfo", s.testHash).Return(expectedFileInfo, nil)
 
-	fileInfo, err := s.manager.GetFileInfo(s.testHash)
+	fileInfo, err := s.manager.GetFileInfo(context.Background(), s.testHash)
 	s.NoError(err)
 	s.Equal(expectedFileInfo, fileInfo)
 }
@@ -308,7 +309,7 @@ func (s *ManagerTestSuite) TestGetFileInfo() {
 func (s *ManagerTestSuite) TestGetFileInfoError() {
 	s.mockStore.On("GetFileInfo", s.testHash).Return(nil, errors.New("get file info error"))
 
-	fileInfo, err := s.manager.GetFileInfo(s.testHash)
+	fileInfo, err := s.manager.GetFileInfo(context.Background(), s.testHash)
 	s.Error(err)
 	s.Nil(fileInfo)
 	s.Contains(err.Error(), "get file info error")
@@ -318,7 +319,7 @@ func (s *ManagerTestSuite) TestGetFileInfoError() {
 func (s *ManagerTestSuite) TestExists() {
 	s.mockStore.On("Exists", s.testHash).Return(true, nil)
 
-	exists, err := s.manager.Exists(s.testHash)
+	exists, err := s.manager.Exists(context.Background(), s.testHash)
 	s.NoError(err)
 	s.True(exists)
 }
@@ -327,7 +328,7 @@ func (s *ManagerTestSuite) TestExists() {
 func (s *ManagerTestSuite) TestExistsError() {
 	s.mockStore.On("Exists", s.testHash).Return(false, errors.New("exists error"))
 
-	exists, err := s.manager.Exists(s.testHash)
+	exists, err := s.manager.Exists(context.Background(), s.testHash)
 	s.Error(err)
 	s.False(exists)
 	s.Contains(err.Error(), "exists error")
@@ -354,7 +355,7 @@ func (s *ManagerTestSuite) TestValidateHashInvalid() {
 func (s *ManagerTestSuite) TestDelete() {
 	s.mockStore.On("Delete", s.testHash).Return(nil)
 
-	err := s.manager.Delete(s.testHash)
+	err := s.manager.Delete(context.Background(), s.testHash)
 	s.NoError(err)
 }
 
@@ -362,7 +363,7 @@ func (s *ManagerTestSuite) TestDelete() {
 func (s *ManagerTestSuite) TestDeleteError() {
 	s.mockStore.On("Delete", s.testHash).Return(errors.New("delete error"))
 
-	err := s.manager.Delete(s.testHash)
+	err := s.manager.Delete(context.Background(), s.testHash)
 	s.Error(err)
 	s.Contains(err.Error(), "delete error")
 }
@@ -377,7 +378,7 @@ func (s *ManagerTestSuite) TestGetDiskUsage() {
 
 	s.mockStore.On("GetDiskUsage", s.testHash).Return(expectedDiskUsage, nil)
 
-	diskUsage, err := s.manager.GetDiskUsage(s.testHash)
+	diskUsage, err := s.manager.GetDiskUsage(context.Background(), s.testHash)
 	s.NoError(err)
 	s.Equal(expectedDiskUsage, diskUsage)
 }
@@ -386,7 +387,7 @@ func (s *ManagerTestSuite) TestGetDiskUsage() {
 func (s *ManagerTestSuite) TestGetDiskUsageError() {
 	s.mockStore.On("GetDiskUsage", s.testHash).Return(nil, errors.New("get disk usage error"))
 
-	diskUsage, err := s.manager.GetDiskUsage(s.testHash)
+	diskUsage, err := s.manager.GetDiskUsage(context.Background(), s.testHash)
 	s.Error(err)
 	s.Nil(diskUsage)
 	s.Contains(err.Error(), "get disk usage error")
@@ -440,7 +441,7 @@ func (s *ManagerTestSuite) TestVerifyBlockCustomBufferSize() {
 	expectedNewSize := diskUsage.TotalSpace + fileSize*ResizeFactor + customBufferSize
 	s.mockStore.On("ResizeBlock", s.testHash, expectedNewSize).Return(nil)
 
-	err = customManager.VerifyBlock(s.tempFile, s.testHash)
+	err = customManager.VerifyBlock(context.Background(), s.tempFile, s.testHash)
 	s.NoError(err) // Should succeed after resize
 }
 
@@ -460,7 +461,7 @@ func (s *ManagerTestSuite) TestVerifyBlockExactSpaceMatch() {
 	}
 	s.mockStore.On("GetDiskUsage", s.testHash).Return(diskUsage, nil)
 
-	err = s.manager.VerifyBlock(s.tempFile, s.testHash)
+	err = s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash)
 	s.NoError(err) // Should succeed without resize
 }
 
@@ -491,7 +492,7 @@ func (s *ManagerTestSuite) TestVerifyBlockLargeFile() {
 	expectedNewSize := diskUsage.TotalSpace + fileSize*ResizeFactor + DefaultBufferSize
 	s.mockStore.On("ResizeBlock", s.testHash, expectedNewSize).Return(nil)
 
-	err = s.manager.VerifyBlock(largeFile.Name(), s.testHash)
+	err = s.manager.VerifyBlock(context.Background(), largeFile.Name(), s.testHash)
 	s.NoError(err) // Should succeed after resize
 }
 
@@ -526,7 +527,7 @@ func (s *ManagerTestSuite) TestDownloadStreamUsage() {
 
 	s.mockStore.On("DownloadStream", s.testHash).Return(mockReader, nil)
 
-	reader, err := s.manager.DownloadStream(s.testHash)
+	reader, err := s.manager.DownloadStream(context.Background(), s.testHash)
 	s.NoError(err)
 	s.NotNil(reader)
 
@@ -560,7 +561,7 @@ func (s *ManagerTestSuite) TestVerifyBlockEdgeCases() {
 	}
 	s.mockStore.On("GetDiskUsage", s.testHash).Return(diskUsage, nil)
 
-	err = s.manager.VerifyBlock(emptyFile.Name(), s.testHash)
+	err = s.manager.VerifyBlock(context.Background(), emptyFile.Name(), s.testHash)
 	s.NoError(err)
 }
 
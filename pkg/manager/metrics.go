@@ -0,0 +1,41 @@
+package manager
+
+import (
+	"errors"
+
+	"loopfs/pkg/metrics"
+)
+
+var (
+	verifyTotal = metrics.NewCounterVec("loopfs_manager_verify_block_total",
+		"Block verifications by result: ok, read_only, insufficient_capacity or error.", "result")
+	resizeDuration = metrics.NewHistogramVec("loopfs_manager_resize_duration_seconds",
+		"Duration of block resizes requested by the manager, including lock waits, by result.",
+		metrics.ExponentialBuckets(1, 2, 12), "result")
+	pendingResizeBytes = metrics.NewGauge("loopfs_manager_pending_resize_bytes",
+		"Bytes of new loop images reserved by resizes in progress.")
+	pendingCreateBytes = metrics.NewGauge("loopfs_manager_pending_create_bytes",
+		"Bytes of new loop images reserved by uploads creating a block.")
+)
+
+// verifyResult maps a VerifyBlock error to a metric result label.
+func verifyResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrReadOnly):
+		return "read_only"
+	case errors.Is(err, ErrInsufficientCapacity):
+		return "insufficient_capacity"
+	default:
+		return "error"
+	}
+}
+
+// resizeResult maps a ResizeBlock error to a metric result label.
+func resizeResult(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
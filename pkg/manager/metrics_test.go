@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+
+	"loopfs/pkg/models"
+)
+
+// MetricsTestSuite tests store manager instrumentation
+type MetricsTestSuite struct {
+	suite.Suite
+	mockStore *MockResizableStore
+	manager   *Manager
+	testHash  string
+	tempFile  string
+}
+
+// SetupTest runs before each test
+func (s *MetricsTestSuite) SetupTest() {
+	s.testHash = "a1b2c3d4e5f67890123456789abcdef0123456789abcdef0123456789abcdef0"
+	s.tempFile = s.T().TempDir() + "/upload.tmp"
+	s.Require().NoError(os.WriteFile(s.tempFile, []byte("metrics test content"), 0600))
+
+	s.mockStore = new(MockResizableStore)
+	s.manager = New(s.mockStore, 100)
+}
+
+// TearDownTest runs after each test
+func (s *MetricsTestSuite) TearDownTest() {
+	s.mockStore.AssertExpectations(s.T())
+}
+
+// TestVerifyResult tests the mapping of errors to result labels
+func (s *MetricsTestSuite) TestVerifyResult() {
+	s.Equal("ok", verifyResult(nil))
+	s.Equal("read_only", verifyResult(fmt.Errorf("upload: %w", ErrReadOnly)))
+	s.Equal("insufficient_capacity", verifyResult(ErrInsufficientCapacity))
+	s.Equal("error", verifyResult(errors.New("disk failure")))
+}
+
+// TestVerifyBlockCounted tests that verifications and resizes are recorded
+func (s *MetricsTestSuite) TestVerifyBlockCounted() {
+	diskUsage := &models.DiskUsage{SpaceAvailable: 10, TotalSpace: 1000}
+	s.mockStore.On("GetDiskUsage", s.testHash).Return(diskUsage, nil)
+	s.mockStore.On("ResizeBlock", s.testHash, mock.AnythingOfType("int64")).Return(nil)
+
+	verified := verifyTotal.WithLabelValues("ok").Value()
+	resized := resizeDuration.WithLabelValues("success").Count()
+
+	s.Require().NoError(s.manager.VerifyBlock(context.Background(), s.tempFile, s.testHash))
+
+	s.InDelta(verified+1, verifyTotal.WithLabelValues("ok").Value(), 0.0001)
+	s.Equal(resized+1, resizeDuration.WithLabelValues("success").Count())
+	s.InDelta(0, pendingResizeBytes.Value(), 0.0001)
+}
+
+// TestMetricsTestSuite runs the metrics test suite
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(MetricsTestSuite))
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// unmatchedRoute labels requests that did not match any registered route.
+const unmatchedRoute = "unmatched"
+
+// EchoMiddleware counts requests by method, route and status code in requests and observes
+// their latency by method and route in duration. The route pattern rather than the URL is
+// used as label so path parameters such as hashes do not create new series.
+func EchoMiddleware(requests *CounterVec, duration *HistogramVec) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			err := next(ctx)
+
+			status := ctx.Response().Status
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) {
+				status = httpErr.Code
+			}
+			route := ctx.Path()
+			if route == "" {
+				route = unmatchedRoute
+			}
+			method := ctx.Request().Method
+
+			requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+			duration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+// EchoTestSuite tests the Echo request instrumentation middleware
+type EchoTestSuite struct {
+	suite.Suite
+	requests *CounterVec
+	duration *HistogramVec
+	echo     *echo.Echo
+}
+
+// SetupTest runs before each test
+func (s *EchoTestSuite) SetupTest() {
+	registry := NewRegistry()
+	s.requests = registry.NewCounterVec("test_requests_total", "", "method", "route", "code")
+	s.duration = registry.NewHistogramVec("test_request_duration_seconds", "", DefBuckets, "method", "route")
+
+	s.echo = echo.New()
+	s.echo.Use(EchoMiddleware(s.requests, s.duration))
+	s.echo.GET("/file/:hash/info", func(ctx echo.Context) error {
+		return ctx.String(http.StatusOK, "ok")
+	})
+	s.echo.GET("/fail", func(echo.Context) error {
+		return echo.NewHTTPError(http.StatusTeapot, "teapot")
+	})
+}
+
+// serve sends a GET request through the router
+func (s *EchoTestSuite) serve(path string) {
+	s.echo.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+// TestRouteLabel tests that requests are labelled by route pattern
+func (s *EchoTestSuite) TestRouteLabel() {
+	s.serve("/file/abc/info")
+	s.serve("/file/def/info")
+
+	s.InDelta(2, s.requests.WithLabelValues(http.MethodGet, "/file/:hash/info", "200").Value(), 0.0001)
+	s.Equal(uint64(2), s.duration.WithLabelValues(http.MethodGet, "/file/:hash/info").Count())
+}
+
+// TestHTTPErrorStatus tests that the status of returned HTTP errors is used
+func (s *EchoTestSuite) TestHTTPErrorStatus() {
+	s.serve("/fail")
+
+	s.InDelta(1, s.requests.WithLabelValues(http.MethodGet, "/fail", "418").Value(), 0.0001)
+}
+
+// TestUnmatchedRoute tests that unknown paths share one label value
+func (s *EchoTestSuite) TestUnmatchedRoute() {
+	s.serve("/does/not/exist")
+	s.serve("/neither/does/this")
+
+	var total float64
+	s.requests.each(func(values []string, counter *Counter) {
+		s.NotContains(values[1], "exist")
+		total += counter.Value()
+	})
+	s.InDelta(2, total, 0.0001)
+}
+
+// TestEchoTestSuite runs the Echo middleware test suite
+func TestEchoTestSuite(t *testing.T) {
+	suite.Run(t, new(EchoTestSuite))
+}
@@ -0,0 +1,235 @@
+// Package metrics implements the small subset of Prometheus instrumentation used by loopfs:
+// counters, gauges and histograms, optionally partitioned by labels, exposed in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// metricType is the Prometheus type reported in the # TYPE line.
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+// labelSeparator joins label values into a single map key; it cannot appear in valid UTF-8 text.
+const labelSeparator = "\xff"
+
+// DefBuckets are the default histogram buckets, suited to request latencies in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ExponentialBuckets returns count buckets starting at start, each factor times the previous one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// atomicFloat is a float64 updated with compare-and-swap.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) add(delta float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(value float64) {
+	f.bits.Store(math.Float64bits(value))
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	value atomicFloat
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.value.add(1)
+}
+
+// Add increments the counter by delta. Negative deltas are ignored.
+func (c *Counter) Add(delta float64) {
+	if delta > 0 {
+		c.value.add(delta)
+	}
+}
+
+// Value returns the current counter value.
+func (c *Counter) Value() float64 {
+	return c.value.load()
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	value atomicFloat
+}
+
+// Set sets the gauge to value.
+func (g *Gauge) Set(value float64) {
+	g.value.set(value)
+}
+
+// Inc increments the gauge by one.
+func (g *Gauge) Inc() {
+	g.value.add(1)
+}
+
+// Dec decrements the gauge by one.
+func (g *Gauge) Dec() {
+	g.value.add(-1)
+}
+
+// Add adds delta to the gauge.
+func (g *Gauge) Add(delta float64) {
+	g.value.add(delta)
+}
+
+// Value returns the current gauge value.
+func (g *Gauge) Value() float64 {
+	return g.value.load()
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	upperBounds []float64
+	counts      []atomic.Uint64 // One per bucket plus the +Inf bucket
+	sum         atomicFloat
+	count       atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	upperBounds := append([]float64(nil), buckets...)
+	sort.Float64s(upperBounds)
+	return &Histogram{
+		upperBounds: upperBounds,
+		counts:      make([]atomic.Uint64, len(upperBounds)+1),
+	}
+}
+
+// Observe records a single observation.
+func (h *Histogram) Observe(value float64) {
+	index := sort.SearchFloat64s(h.upperBounds, value)
+	h.counts[index].Add(1)
+	h.sum.add(value)
+	h.count.Add(1)
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+// Sum returns the sum of all observations.
+func (h *Histogram) Sum() float64 {
+	return h.sum.load()
+}
+
+// vec holds one child metric per combination of label values.
+type vec[T any] struct {
+	labelNames []string
+	newChild   func() *T
+	mu         sync.RWMutex
+	children   map[string]*T
+}
+
+func newVec[T any](labelNames []string, newChild func() *T) *vec[T] {
+	return &vec[T]{
+		labelNames: labelNames,
+		newChild:   newChild,
+		children:   make(map[string]*T),
+	}
+}
+
+// with returns the child for the given label values, creating it on first use.
+// Missing values are treated as empty and extra values are ignored.
+func (v *vec[T]) with(values []string) *T {
+	normalized := make([]string, len(v.labelNames))
+	copy(normalized, values)
+	key := strings.Join(normalized, labelSeparator)
+
+	v.mu.RLock()
+	child, exists := v.children[key]
+	v.mu.RUnlock()
+	if exists {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, exists = v.children[key]; exists {
+		return child
+	}
+	child = v.newChild()
+	v.children[key] = child
+	return child
+}
+
+// each calls fn for every child in label value order.
+func (v *vec[T]) each(fn func(values []string, child *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	children := make(map[string]*T, len(v.children))
+	for key, child := range v.children {
+		children[key] = child
+	}
+	v.mu.RUnlock()
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		fn(strings.Split(key, labelSeparator), children[key])
+	}
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	*vec[Counter]
+}
+
+// WithLabelValues returns the counter for the given label values.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.with(values)
+}
+
+// GaugeVec is a set of gauges partitioned by label values.
+type GaugeVec struct {
+	*vec[Gauge]
+}
+
+// WithLabelValues returns the gauge for the given label values.
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.with(values)
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	*vec[Histogram]
+}
+
+// WithLabelValues returns the histogram for the given label values.
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.with(values)
+}
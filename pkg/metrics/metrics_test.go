@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// MetricsTestSuite tests counters, gauges and histograms
+type MetricsTestSuite struct {
+	suite.Suite
+}
+
+// TestCounter tests counter increments
+func (s *MetricsTestSuite) TestCounter() {
+	counter := &Counter{}
+	counter.Inc()
+	counter.Add(2.5)
+	counter.Add(-1)
+	s.InDelta(3.5, counter.Value(), 0.0001)
+}
+
+// TestCounterConcurrent tests that concurrent increments are not lost
+func (s *MetricsTestSuite) TestCounterConcurrent() {
+	counter := &Counter{}
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				counter.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	s.InDelta(5000, counter.Value(), 0.0001)
+}
+
+// TestGauge tests gauge updates
+func (s *MetricsTestSuite) TestGauge() {
+	gauge := &Gauge{}
+	gauge.Set(10)
+	gauge.Inc()
+	gauge.Dec()
+	gauge.Dec()
+	gauge.Add(-4)
+	s.InDelta(5, gauge.Value(), 0.0001)
+}
+
+// TestHistogram tests bucket placement, sum and count
+func (s *MetricsTestSuite) TestHistogram() {
+	histogram := newHistogram([]float64{5, 1})
+	histogram.Observe(0.5)
+	histogram.Observe(1)
+	histogram.Observe(3)
+	histogram.Observe(10)
+
+	s.Equal([]float64{1, 5}, histogram.upperBounds)
+	s.Equal(uint64(2), histogram.counts[0].Load())
+	s.Equal(uint64(1), histogram.counts[1].Load())
+	s.Equal(uint64(1), histogram.counts[2].Load())
+	s.Equal(uint64(4), histogram.Count())
+	s.InDelta(14.5, histogram.Sum(), 0.0001)
+}
+
+// TestExponentialBuckets tests bucket generation
+func (s *MetricsTestSuite) TestExponentialBuckets() {
+	s.Equal([]float64{1, 2, 4, 8}, ExponentialBuckets(1, 2, 4))
+}
+
+// TestVecChildren tests that label values select stable children
+func (s *MetricsTestSuite) TestVecChildren() {
+	counters := &CounterVec{newVec([]string{"a", "b"}, func() *Counter { return &Counter{} })}
+	counters.WithLabelValues("x", "y").Inc()
+	counters.WithLabelValues("x", "y").Inc()
+	counters.WithLabelValues("x").Inc()
+
+	s.InDelta(2, counters.WithLabelValues("x", "y").Value(), 0.0001)
+	s.InDelta(1, counters.WithLabelValues("x", "").Value(), 0.0001)
+}
+
+// TestMetricsTestSuite runs the metrics test suite
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(MetricsTestSuite))
+}
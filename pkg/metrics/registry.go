@@ -0,0 +1,254 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// Default is the registry used by the package-level constructors and served by Handler.
+var Default = NewRegistry()
+
+// family is a registered metric with its name, help text and sample writer.
+type family struct {
+	name  string
+	help  string
+	kind  metricType
+	write func(w *bufio.Writer, name string)
+}
+
+// Registry holds metrics and writes them in the Prometheus text format.
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
+
+// register adds a metric family. It panics on invalid or duplicate names,
+// which are programming errors caught at package initialisation.
+func (r *Registry) register(f *family, labelNames []string) {
+	if !metricNameRe.MatchString(f.name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", f.name))
+	}
+	for _, label := range labelNames {
+		if !labelNameRe.MatchString(label) || label == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q for %s", label, f.name))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.families[f.name]; exists {
+		panic(fmt.Sprintf("metrics: duplicate metric %s", f.name))
+	}
+	r.families[f.name] = f
+}
+
+// NewCounter creates and registers a counter.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	counter := &Counter{}
+	r.register(&family{name: name, help: help, kind: typeCounter, write: func(w *bufio.Writer, name string) {
+		writeSample(w, name, nil, nil, counter.Value())
+	}}, nil)
+	return counter
+}
+
+// NewCounterVec creates and registers a counter partitioned by labelNames.
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	counters := &CounterVec{newVec(labelNames, func() *Counter { return &Counter{} })}
+	r.register(&family{name: name, help: help, kind: typeCounter, write: func(w *bufio.Writer, name string) {
+		counters.each(func(values []string, counter *Counter) {
+			writeSample(w, name, labelNames, values, counter.Value())
+		})
+	}}, labelNames)
+	return counters
+}
+
+// NewGauge creates and registers a gauge.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	gauge := &Gauge{}
+	r.register(&family{name: name, help: help, kind: typeGauge, write: func(w *bufio.Writer, name string) {
+		writeSample(w, name, nil, nil, gauge.Value())
+	}}, nil)
+	return gauge
+}
+
+// NewGaugeVec creates and registers a gauge partitioned by labelNames.
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	gauges := &GaugeVec{newVec(labelNames, func() *Gauge { return &Gauge{} })}
+	r.register(&family{name: name, help: help, kind: typeGauge, write: func(w *bufio.Writer, name string) {
+		gauges.each(func(values []string, gauge *Gauge) {
+			writeSample(w, name, labelNames, values, gauge.Value())
+		})
+	}}, labelNames)
+	return gauges
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by fn at collection time.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&family{name: name, help: help, kind: typeGauge, write: func(w *bufio.Writer, name string) {
+		writeSample(w, name, nil, nil, fn())
+	}}, nil)
+}
+
+// NewHistogram creates and registers a histogram with the given bucket upper bounds.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	histogram := newHistogram(buckets)
+	r.register(&family{name: name, help: help, kind: typeHistogram, write: func(w *bufio.Writer, name string) {
+		writeHistogram(w, name, nil, nil, histogram)
+	}}, nil)
+	return histogram
+}
+
+// NewHistogramVec creates and registers a histogram partitioned by labelNames.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	histograms := &HistogramVec{newVec(labelNames, func() *Histogram { return newHistogram(buckets) })}
+	r.register(&family{name: name, help: help, kind: typeHistogram, write: func(w *bufio.Writer, name string) {
+		histograms.each(func(values []string, histogram *Histogram) {
+			writeHistogram(w, name, labelNames, values, histogram)
+		})
+	}}, labelNames)
+	return histograms
+}
+
+// WriteText writes all registered metrics in the Prometheus text format, ordered by name.
+func (r *Registry) WriteText(out io.Writer) error {
+	r.mu.RLock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	w := bufio.NewWriter(out)
+	for _, f := range families {
+		if f.help != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n", f.name, helpEscaper.Replace(f.help))
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+		f.write(w, f.name)
+	}
+	return w.Flush()
+}
+
+// Handler returns an HTTP handler serving the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_ = r.WriteText(w)
+	})
+}
+
+// writeHistogram writes the cumulative buckets, sum and count of a histogram.
+func writeHistogram(w *bufio.Writer, name string, labelNames, values []string, h *Histogram) {
+	bucketLabels := append(append([]string{}, labelNames...), "le")
+	var cumulative uint64
+	for i, upperBound := range h.upperBounds {
+		cumulative += h.counts[i].Load()
+		writeSample(w, name+"_bucket", bucketLabels, append(append([]string{}, values...), formatFloat(upperBound)),
+			float64(cumulative))
+	}
+	cumulative += h.counts[len(h.upperBounds)].Load()
+	writeSample(w, name+"_bucket", bucketLabels, append(append([]string{}, values...), "+Inf"), float64(cumulative))
+	writeSample(w, name+"_sum", labelNames, values, h.Sum())
+	writeSample(w, name+"_count", labelNames, values, float64(cumulative))
+}
+
+// writeSample writes a single sample line.
+func writeSample(w *bufio.Writer, name string, labelNames, values []string, value float64) {
+	w.WriteString(name)
+	if len(labelNames) > 0 {
+		w.WriteByte('{')
+		for i, label := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			var labelValue string
+			if i < len(values) {
+				labelValue = values[i]
+			}
+			fmt.Fprintf(w, `%s="%s"`, label, labelValueEscaper.Replace(labelValue))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+// formatFloat formats a sample value the way Prometheus expects.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// NewCounter creates a counter in the default registry.
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+// NewCounterVec creates a labelled counter in the default registry.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labelNames...)
+}
+
+// NewGauge creates a gauge in the default registry.
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+// NewGaugeVec creates a labelled gauge in the default registry.
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labelNames...)
+}
+
+// NewHistogram creates a histogram in the default registry.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return Default.NewHistogram(name, help, buckets)
+}
+
+// NewHistogramVec creates a labelled histogram in the default registry.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, buckets, labelNames...)
+}
+
+// Handler serves the default registry.
+func Handler() http.Handler {
+	return Default.Handler()
+}
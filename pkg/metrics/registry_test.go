@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// RegistryTestSuite tests registration and the text exposition format
+type RegistryTestSuite struct {
+	suite.Suite
+	registry *Registry
+}
+
+// SetupTest runs before each test
+func (s *RegistryTestSuite) SetupTest() {
+	s.registry = NewRegistry()
+}
+
+// text returns the registry contents in the text format
+func (s *RegistryTestSuite) text() string {
+	var out strings.Builder
+	s.Require().NoError(s.registry.WriteText(&out))
+	return out.String()
+}
+
+// TestWriteCounterAndGauge tests the output of unlabelled metrics
+func (s *RegistryTestSuite) TestWriteCounterAndGauge() {
+	s.registry.NewCounter("test_requests_total", "Requests served.").Add(3)
+	s.registry.NewGauge("test_temperature", "Current temperature.").Set(-1.5)
+
+	s.Equal(`# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total 3
+# HELP test_temperature Current temperature.
+# TYPE test_temperature gauge
+test_temperature -1.5
+`, s.text())
+}
+
+// TestWriteLabels tests label ordering and escaping
+func (s *RegistryTestSuite) TestWriteLabels() {
+	counters := s.registry.NewCounterVec("test_errors_total", "Errors.", "kind", "path")
+	counters.WithLabelValues("b", "/x").Inc()
+	counters.WithLabelValues("a", "say \"hi\"\n\\").Inc()
+
+	text := s.text()
+	s.Contains(text, `test_errors_total{kind="a",path="say \"hi\"\n\\"} 1`+"\n")
+	s.Contains(text, `test_errors_total{kind="b",path="/x"} 1`+"\n")
+	s.Less(strings.Index(text, `kind="a"`), strings.Index(text, `kind="b"`))
+}
+
+// TestWriteHistogram tests cumulative buckets, sum and count
+func (s *RegistryTestSuite) TestWriteHistogram() {
+	histograms := s.registry.NewHistogramVec("test_duration_seconds", "Durations.", []float64{0.1, 1}, "op")
+	histograms.WithLabelValues("read").Observe(0.05)
+	histograms.WithLabelValues("read").Observe(0.5)
+	histograms.WithLabelValues("read").Observe(2)
+
+	s.Equal(`# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{op="read",le="0.1"} 1
+test_duration_seconds_bucket{op="read",le="1"} 2
+test_duration_seconds_bucket{op="read",le="+Inf"} 3
+test_duration_seconds_sum{op="read"} 2.55
+test_duration_seconds_count{op="read"} 3
+`, s.text())
+}
+
+// TestGaugeFunc tests that gauge functions are evaluated at collection time
+func (s *RegistryTestSuite) TestGaugeFunc() {
+	value := 1.0
+	s.registry.NewGaugeFunc("test_dynamic", "", func() float64 { return value })
+	value = 7
+
+	s.Equal("# TYPE test_dynamic gauge\ntest_dynamic 7\n", s.text())
+}
+
+// TestRegisterInvalid tests that invalid and duplicate registrations panic
+func (s *RegistryTestSuite) TestRegisterInvalid() {
+	s.Panics(func() { s.registry.NewCounter("bad-name", "") })
+	s.Panics(func() { s.registry.NewCounterVec("test_labels", "", "bad-label") })
+	s.Panics(func() { s.registry.NewHistogramVec("test_le", "", DefBuckets, "le") })
+
+	s.registry.NewCounter("test_once", "")
+	s.Panics(func() { s.registry.NewGauge("test_once", "") })
+}
+
+// TestHandler tests the HTTP handler
+func (s *RegistryTestSuite) TestHandler() {
+	s.registry.NewCounter("test_handler_total", "").Inc()
+
+	rec := httptest.NewRecorder()
+	s.registry.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(ContentType, rec.Header().Get("Content-Type"))
+	s.Contains(rec.Body.String(), "test_handler_total 1\n")
+}
+
+// TestRegistryTestSuite runs the registry test suite
+func TestRegistryTestSuite(t *testing.T) {
+	suite.Run(t, new(RegistryTestSuite))
+}
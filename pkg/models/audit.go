@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// AuditEntry records a mutating operation handled by the load balancer.
+type AuditEntry struct {
+	ID        int64     `json:"id,omitempty"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Bucket    string    `json:"bucket,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	Hash      string    `json:"hash,omitempty"`
+	SourceIP  string    `json:"source_ip"`
+	RequestID string    `json:"request_id,omitempty"`
+	Status    int       `json:"status"`
+	Result    string    `json:"result"`
+}
+
+// AuditResponse is the response of the audit query endpoint.
+type AuditResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	Count   int          `json:"count"`
+}
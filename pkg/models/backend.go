@@ -4,12 +4,65 @@ import "time"
 
 // BackendStatus represents the health status of a backend server.
 type BackendStatus struct {
-	URL           string    `json:"url"`
-	Online        bool      `json:"online"`
-	LastCheck     time.Time `json:"last_check"`
-	LastError     string    `json:"last_error,omitempty"`
-	Latency       int64     `json:"latency_ms"`
-	ConsecFails   int       `json:"consecutive_failures"`
-	NodeInfo      *NodeInfo `json:"node_info,omitempty"`
-	AvailableSpace uint64   `json:"available_space"`
+	URL            string        `json:"url"`
+	Online         bool          `json:"online"`           // The circuit is not open
+	Draining       bool          `json:"draining"`         // Serves reads but receives no new uploads
+	Weight         float64       `json:"weight,omitempty"` // Placement weight set by an operator, 0 derives it from capacity
+	LastCheck      time.Time     `json:"last_check"`
+	LastError      string        `json:"last_error,omitempty"`
+	Latency        int64         `json:"latency_ms"`
+	ConsecFails    int           `json:"consecutive_failures"`
+	NodeInfo       *NodeInfo     `json:"node_info,omitempty"`
+	AvailableSpace uint64        `json:"available_space"`
+	Circuit        CircuitStatus `json:"circuit"`
+}
+
+// CircuitState is the state of the circuit breaker guarding a backend.
+type CircuitState string
+
+const (
+	// CircuitClosed lets all requests through while the error rate stays low.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen sends no requests to the backend until a probe after the cool-down succeeds.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets requests through on trial: a few successes close the circuit, any
+	// failure opens it again.
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitStatus describes the circuit breaker of a backend and the requests in its window.
+type CircuitStatus struct {
+	State     CircuitState `json:"state"`
+	Requests  int          `json:"window_requests"`
+	Failures  int          `json:"window_failures"`
+	ErrorRate float64      `json:"error_rate"`
+	Trips     int          `json:"trips"`               // Times the circuit opened
+	Reason    string       `json:"reason,omitempty"`    // Why the circuit last opened
+	OpenedAt  *time.Time   `json:"opened_at,omitempty"` // Set while open or half-open
+	RetryAt   *time.Time   `json:"retry_at,omitempty"`  // Next probe of an open circuit
+}
+
+// BackendUpdate is a request to add a backend to the balancer or change one. Fields left
+// out of an update keep their value.
+type BackendUpdate struct {
+	URL      string   `json:"url"`
+	Draining *bool    `json:"draining,omitempty"`
+	Weight   *float64 `json:"weight,omitempty"`
+}
+
+// RateLimit limits the throughput of an owner or a bucket. Zero values are unlimited.
+type RateLimit struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	BytesPerSecond    int64   `json:"bytes_per_second"`
+}
+
+// Limits describes the admission limits of the balancer: the default limit of every owner
+// and bucket, the overrides of single owners and buckets, and the number of requests each
+// backend is sent at once.
+type Limits struct {
+	Owner              RateLimit            `json:"owner"`
+	Bucket             RateLimit            `json:"bucket"`
+	BackendConcurrency int                  `json:"backend_concurrency"` // 0 is unlimited
+	Owners             map[string]RateLimit `json:"owners"`
+	Buckets            map[string]RateLimit `json:"buckets"`
 }
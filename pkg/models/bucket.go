@@ -4,13 +4,14 @@ import "time"
 
 // Bucket represents a logical container for objects.
 type Bucket struct {
-	ID         int64     `json:"id"`
-	Name       string    `json:"name"`
-	OwnerID    string    `json:"owner_id"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
-	IsPublic   bool      `json:"is_public"`
-	QuotaBytes int64     `json:"quota_bytes,omitempty"`
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	OwnerID         string    `json:"owner_id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	IsPublic        bool      `json:"is_public"`
+	QuotaBytes      int64     `json:"quota_bytes,omitempty"`
+	PlacementPolicy string    `json:"placement_policy,omitempty"` // Empty uses the balancer's upload policy
 
 	// Computed fields (not stored in database).
 	ObjectCount int64 `json:"object_count,omitempty"`
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Event types emitted for bucket and object changes.
+const (
+	EventObjectCreated     = "object.created"
+	EventObjectOverwritten = "object.overwritten"
+	EventObjectDeleted     = "object.deleted"
+	EventBucketCreated     = "bucket.created"
+	EventBucketDeleted     = "bucket.deleted"
+)
+
+// Event describes a change to a bucket or object. Events are numbered in commit order.
+type Event struct {
+	ID           int64     `json:"id"`
+	Type         string    `json:"type"`
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key,omitempty"`
+	Hash         string    `json:"hash,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	PreviousHash string    `json:"previous_hash,omitempty"`
+	Time         time.Time `json:"time"`
+}
@@ -10,3 +10,14 @@ type FileInfo struct {
 	SpaceUsed      uint64    `json:"space_used,omitempty"`
 	SpaceAvailable uint64    `json:"space_available,omitempty"`
 }
+
+// PrefixListResponse lists the hash prefixes a node has loop images for.
+type PrefixListResponse struct {
+	Prefixes []string `json:"prefixes"`
+}
+
+// HashListResponse lists the hashes stored in the loop image for a prefix.
+type HashListResponse struct {
+	Prefix string   `json:"prefix"`
+	Hashes []string `json:"hashes"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// ImageInfo describes a single loop image on a CAS node.
+type ImageInfo struct {
+	Prefix      string       `json:"prefix"`
+	Path        string       `json:"path"`
+	Size        int64        `json:"size"` // Size of the image file in bytes
+	Mounted     bool         `json:"mounted"`
+	MountPoint  string       `json:"mount_point"`
+	RefCount    int          `json:"ref_count"`             // Operations currently using the mount
+	UnmountAt   *time.Time   `json:"unmount_at,omitempty"`  // Scheduled idle unmount, if any
+	SpaceUsed   int64        `json:"space_used,omitempty"`  // Only reported while mounted
+	SpaceTotal  int64        `json:"space_total,omitempty"` // Only reported while mounted
+	Utilization float64      `json:"utilization,omitempty"` // Percent of the filesystem in use, only while mounted
+	BlobCount   *int64       `json:"blob_count,omitempty"`  // Only reported while mounted
+	Health      *ImageHealth `json:"health,omitempty"`      // Last filesystem check, if any
+}
+
+// ImageHealth records the last filesystem check of a loop image.
+type ImageHealth struct {
+	Prefix    string    `json:"prefix"`
+	LastCheck time.Time `json:"last_check"`
+	Clean     bool      `json:"clean"`
+	ExitCode  int       `json:"exit_code"`
+	Degraded  bool      `json:"degraded"` // The check found errors that were not corrected
+}
+
+// ImageListResponse represents the list of loop images on a node.
+type ImageListResponse struct {
+	Images []ImageInfo `json:"images"`
+}
+
+// FsckResult represents the outcome of a filesystem check of a loop image.
+type FsckResult struct {
+	Prefix   string `json:"prefix"`
+	Clean    bool   `json:"clean"`
+	ExitCode int    `json:"exit_code"`
+	Output   string `json:"output"`
+	Duration string `json:"duration"`
+}
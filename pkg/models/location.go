@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// HashLocation lists the backends known to store a hash.
+type HashLocation struct {
+	Hash      string    `json:"hash"`
+	Backends  []string  `json:"backends"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -2,11 +2,44 @@ package models
 
 // NodeInfo represents system information for a CAS node.
 type NodeInfo struct {
-	Uptime        string       `json:"uptime"`
-	UptimeSeconds int64        `json:"uptime_seconds"`
-	LoadAverages  LoadAverages `json:"load_averages"`
-	Memory        MemoryInfo   `json:"memory"`
-	Storage       StorageInfo  `json:"storage"`
+	Uptime        string        `json:"uptime"`
+	UptimeSeconds int64         `json:"uptime_seconds"`
+	LoadAverages  LoadAverages  `json:"load_averages"`
+	Memory        MemoryInfo    `json:"memory"`
+	Storage       StorageInfo   `json:"storage"`
+	Uploads       UploadInfo    `json:"uploads"`
+	Capacity      *CapacityInfo `json:"capacity,omitempty"`
+	Mode          NodeMode      `json:"mode,omitempty"`
+	AcceptsWrites bool          `json:"accepts_writes"`
+	Degraded      []ImageHealth `json:"degraded_images,omitempty"`
+}
+
+// NodeMode controls which operations a CAS node accepts.
+type NodeMode string
+
+const (
+	// NodeModeNormal accepts reads, uploads and deletes.
+	NodeModeNormal NodeMode = "normal"
+	// NodeModeReadOnly serves reads only; uploads and deletes are rejected.
+	NodeModeReadOnly NodeMode = "read-only"
+	// NodeModeDraining serves reads and deletes but rejects uploads, e.g. before decommissioning.
+	NodeModeDraining NodeMode = "draining"
+)
+
+// Valid reports whether m is a known node mode.
+func (m NodeMode) Valid() bool {
+	switch m {
+	case NodeModeNormal, NodeModeReadOnly, NodeModeDraining:
+		return true
+	default:
+		return false
+	}
+}
+
+// AcceptsUploads reports whether the node takes new uploads.
+// Nodes that do not report a mode predate node modes and are treated as normal.
+func (n *NodeInfo) AcceptsUploads() bool {
+	return n.Mode == "" || n.Mode == NodeModeNormal
 }
 
 // LoadAverages represents system load information.
@@ -29,3 +62,22 @@ type StorageInfo struct {
 	Used      uint64 `json:"used"`
 	Available uint64 `json:"available"`
 }
+
+// UploadInfo represents upload admission limits and the space reserved by in-flight uploads.
+type UploadInfo struct {
+	MaxObjectSize      int64  `json:"max_object_size"` // 0 means unlimited
+	ReservedBytes      uint64 `json:"reserved_bytes"`
+	ActiveReservations int    `json:"active_reservations"`
+}
+
+// CapacityInfo represents host filesystem capacity as projected by the store manager.
+type CapacityInfo struct {
+	HostTotal          uint64  `json:"host_total"`
+	HostAvailable      uint64  `json:"host_available"`
+	PendingResize      uint64  `json:"pending_resize"`      // Bytes claimed by resizes in progress
+	PendingCreate      uint64  `json:"pending_create"`      // Bytes claimed by uploads creating a new block
+	ProjectedAvailable uint64  `json:"projected_available"` // Available bytes once pending resizes and creations complete
+	UsedPercent        float64 `json:"used_percent"`
+	HighWaterMark      float64 `json:"high_water_mark"` // 0 means disabled
+	ReadOnly           bool    `json:"read_only"`
+}
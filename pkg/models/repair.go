@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// RepairItem is an object stored on fewer backends than the replication factor.
+type RepairItem struct {
+	Hash      string    `json:"hash"`
+	Size      int64     `json:"size"`
+	Replicas  []string  `json:"replicas"`
+	Wanted    int       `json:"wanted"`
+	LastError string    `json:"last_error,omitempty"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Tombstone records that a blob was deleted, so repairs do not copy it back from backends
+// that kept a replica.
+type Tombstone struct {
+	Hash      string    `json:"hash"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// RepairProgress counts the work done by a repair run.
+type RepairProgress struct {
+	QueuedChecked   int   `json:"queued_checked"`
+	PrefixesTotal   int   `json:"prefixes_total"`
+	PrefixesScanned int   `json:"prefixes_scanned"`
+	BlobsChecked    int64 `json:"blobs_checked"`
+	UnderReplicated int64 `json:"under_replicated"`
+	CopiesDone      int64 `json:"copies_done"`
+	CopiesFailed    int64 `json:"copies_failed"`
+	BytesCopied     int64 `json:"bytes_copied"`
+	ReplicasDeleted int64 `json:"replicas_deleted"` // Left behind by deletes of blobs
+}
+
+// RepairStatus reports the state of the balancer's repair worker.
+type RepairStatus struct {
+	Running           bool           `json:"running"`
+	FullScan          bool           `json:"full_scan"`
+	ReplicationFactor int            `json:"replication_factor"`
+	StartedAt         *time.Time     `json:"started_at,omitempty"`
+	FinishedAt        *time.Time     `json:"finished_at,omitempty"`
+	NextScanAt        *time.Time     `json:"next_scan_at,omitempty"`
+	Progress          RepairProgress `json:"progress"`
+	LastError         string         `json:"last_error,omitempty"`
+	Queue             []RepairItem   `json:"queue"`
+}
@@ -0,0 +1,117 @@
+package models
+
+import "time"
+
+// Metadata log operations replicated between balancers.
+const (
+	MetadataOpCreateBucket = "create_bucket"
+	MetadataOpDeleteBucket = "delete_bucket"
+	MetadataOpPutObject    = "put_object"
+	MetadataOpDeleteObject = "delete_object"
+	// MetadataOpDeleteBlob records the tombstone of a deleted blob.
+	MetadataOpDeleteBlob = "delete_blob"
+	// MetadataOpPurgeTombstones drops the tombstones of blobs deleted before the entry's time.
+	MetadataOpPurgeTombstones = "purge_tombstones"
+)
+
+// Roles of a balancer in metadata replication.
+const (
+	ReplicaFollower  = "follower"
+	ReplicaCandidate = "candidate"
+	ReplicaLeader    = "leader"
+)
+
+// MetadataLogEntry is one change in the replicated metadata log. Entries carry the resulting
+// records, including their IDs, so every replica stores identical rows.
+type MetadataLogEntry struct {
+	Seq    int64         `json:"seq"`
+	Term   int64         `json:"term"`
+	Op     string        `json:"op"`
+	Bucket string        `json:"bucket"`
+	Key    string        `json:"key,omitempty"`
+	Hash   string        `json:"hash,omitempty"`   // delete_blob
+	Record *Bucket       `json:"record,omitempty"` // create_bucket
+	Object *BucketObject `json:"object,omitempty"` // put_object
+	Time   time.Time     `json:"time"`
+	// EventID is the ID of the change event the leader recorded, which followers record the
+	// event under so change-feed sequences are the same on every balancer.
+	EventID int64 `json:"event_id,omitempty"`
+}
+
+// SnapshotBucket is a bucket and its objects in a metadata snapshot.
+type SnapshotBucket struct {
+	Bucket
+	Objects []BucketObject `json:"objects"`
+}
+
+// MetadataSnapshot is the complete bucket metadata as of a log position.
+type MetadataSnapshot struct {
+	Seq     int64            `json:"seq"`
+	Term    int64            `json:"term"`
+	Buckets []SnapshotBucket `json:"buckets"`
+	// EventSeq is the ID of the leader's latest change event. Events of the restored balancer
+	// are dropped and new ones continue after it.
+	EventSeq int64 `json:"event_seq"`
+	// Tombstones are the blobs deleted since the last purge.
+	Tombstones []Tombstone `json:"tombstones,omitempty"`
+}
+
+// VoteRequest asks a peer to vote for a candidate in an election.
+type VoteRequest struct {
+	Term      int64  `json:"term"`
+	Candidate string `json:"candidate"`
+	LastSeq   int64  `json:"last_seq"`
+	LastTerm  int64  `json:"last_term"`
+}
+
+// VoteResponse answers a VoteRequest.
+type VoteResponse struct {
+	Term    int64 `json:"term"`
+	Granted bool  `json:"granted"`
+}
+
+// AppendRequest sends log entries following PrevSeq from the leader to a follower. Without
+// entries it is a heartbeat.
+type AppendRequest struct {
+	Term     int64              `json:"term"`
+	Leader   string             `json:"leader"`
+	PrevSeq  int64              `json:"prev_seq"`
+	PrevTerm int64              `json:"prev_term"`
+	Entries  []MetadataLogEntry `json:"entries,omitempty"`
+}
+
+// InstallSnapshotRequest replaces the metadata of a follower whose log diverged from the
+// leader's or is too far behind it.
+type InstallSnapshotRequest struct {
+	Term     int64            `json:"term"`
+	Leader   string           `json:"leader"`
+	Snapshot MetadataSnapshot `json:"snapshot"`
+}
+
+// AppendResponse answers an AppendRequest or InstallSnapshotRequest. LastSeq is the last
+// entry of the follower's log; NeedSnapshot asks the leader to send a snapshot.
+type AppendResponse struct {
+	Term         int64 `json:"term"`
+	Success      bool  `json:"success"`
+	LastSeq      int64 `json:"last_seq"`
+	NeedSnapshot bool  `json:"need_snapshot,omitempty"`
+}
+
+// ReplicaPeer is the replication state of a peer as seen by this balancer.
+type ReplicaPeer struct {
+	URL         string     `json:"url"`
+	MatchSeq    int64      `json:"match_seq"`
+	LastContact *time.Time `json:"last_contact,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// ReplicationStatus describes the metadata replication state of a balancer.
+type ReplicationStatus struct {
+	Self     string        `json:"self"`
+	Role     string        `json:"role"`
+	Term     int64         `json:"term"`
+	Leader   string        `json:"leader,omitempty"`
+	LastSeq  int64         `json:"last_seq"`
+	LastTerm int64         `json:"last_term"`
+	Peers    []ReplicaPeer `json:"peers,omitempty"` // Only reported by the leader
+}
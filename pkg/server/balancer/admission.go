@@ -0,0 +1,601 @@
+package balancer
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+// Scopes and kinds of admission limits, used in responses and metrics.
+const (
+	limitScopeOwner   = "owner"
+	limitScopeBucket  = "bucket"
+	limitScopeBackend = "backend"
+
+	limitRequests    = "requests"
+	limitBytes       = "bytes"
+	limitConcurrency = "concurrency"
+)
+
+const (
+	// maxLimiters bounds the limiters kept for owners and buckets. Beyond it, the least
+	// recently used limiter is dropped.
+	maxLimiters = 10000
+	// saturatedRetryAfter is the Retry-After sent when all backends are at their concurrency limit.
+	saturatedRetryAfter = time.Second
+)
+
+// AdmissionConfig configures which requests the balancer admits. Limits of zero are unlimited.
+type AdmissionConfig struct {
+	// Owner is the rate limit of each owner, identified by X-Owner-ID.
+	Owner models.RateLimit
+	// Bucket is the rate limit of each bucket.
+	Bucket models.RateLimit
+	// BackendConcurrency is the number of requests sent to each backend at once. Further
+	// requests wait for a slot.
+	BackendConcurrency int
+}
+
+// validate checks that no limit is negative.
+func (c AdmissionConfig) validate() error {
+	if !validRateLimit(c.Owner) || !validRateLimit(c.Bucket) || c.BackendConcurrency < 0 {
+		return ErrInvalidLimit
+	}
+	return nil
+}
+
+// validRateLimit reports whether a rate limit has no negative values.
+func validRateLimit(limit models.RateLimit) bool {
+	return limit.RequestsPerSecond >= 0 && limit.BytesPerSecond >= 0
+}
+
+// Admission enforces per-owner and per-bucket rate limits on client requests and limits the
+// requests sent to each backend at once. Requests are limited with token buckets; the bytes
+// a request uploads or downloads are charged while they stream, so a client over its byte
+// rate is rejected on its next request. Rejected requests get 429 with Retry-After.
+//
+// Owners are identified by the X-Owner-ID header, which clients set themselves. Until
+// owners are authenticated, per-owner limits cannot be enforced against a client that
+// changes its owner ID: each new ID gets a fresh limiter, and enough of them evict the
+// limiters of other owners.
+type Admission struct {
+	mu       sync.Mutex
+	config   AdmissionConfig
+	owners   map[string]models.RateLimit // Overrides of single owners
+	buckets  map[string]models.RateLimit // Overrides of single buckets
+	limiters map[string]*list.Element
+	order    *list.List // Limiters, most recently used first
+	slots    map[string]*backendSlots
+	online   func() []string
+}
+
+// throughputLimiter holds the token buckets of one owner or bucket.
+type throughputLimiter struct {
+	key      string
+	scope    string
+	limit    models.RateLimit
+	requests *rate.Limiter // nil if requests are unlimited
+	bytes    *rate.Limiter // nil if bytes are unlimited
+}
+
+// backendSlots counts the requests in flight to one backend.
+type backendSlots struct {
+	inFlight int
+	released chan struct{} // Closed and replaced whenever a slot is released
+}
+
+// NewAdmission creates an admission controller. online returns the URLs of the backends
+// able to serve requests, used to reject requests when all of them are saturated.
+func NewAdmission(config AdmissionConfig, online func() []string) *Admission {
+	return &Admission{
+		config:   config,
+		owners:   make(map[string]models.RateLimit),
+		buckets:  make(map[string]models.RateLimit),
+		limiters: make(map[string]*list.Element),
+		order:    list.New(),
+		slots:    make(map[string]*backendSlots),
+		online:   online,
+	}
+}
+
+// SetConfig changes the default limits and the backend concurrency. Overrides of single
+// owners and buckets are kept.
+func (a *Admission) SetConfig(config AdmissionConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.config = config
+	for _, slots := range a.slots {
+		slots.release()
+	}
+	return nil
+}
+
+// SetOwnerLimit overrides the rate limit of one owner.
+func (a *Admission) SetOwnerLimit(owner string, limit models.RateLimit) error {
+	return a.setOverride(a.owners, owner, limit)
+}
+
+// RemoveOwnerLimit makes an owner use the default rate limit again.
+func (a *Admission) RemoveOwnerLimit(owner string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.owners, owner)
+}
+
+// SetBucketLimit overrides the rate limit of one bucket.
+func (a *Admission) SetBucketLimit(bucketName string, limit models.RateLimit) error {
+	return a.setOverride(a.buckets, bucketName, limit)
+}
+
+// RemoveBucketLimit makes a bucket use the default rate limit again.
+func (a *Admission) RemoveBucketLimit(bucketName string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.buckets, bucketName)
+}
+
+// setOverride sets the limit of name in overrides.
+func (a *Admission) setOverride(overrides map[string]models.RateLimit, name string, limit models.RateLimit) error {
+	if !validRateLimit(limit) {
+		return ErrInvalidLimit
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	overrides[name] = limit
+	return nil
+}
+
+// Limits returns the configured limits and overrides.
+func (a *Admission) Limits() models.Limits {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	limits := models.Limits{
+		Owner:              a.config.Owner,
+		Bucket:             a.config.Bucket,
+		BackendConcurrency: a.config.BackendConcurrency,
+		Owners:             make(map[string]models.RateLimit, len(a.owners)),
+		Buckets:            make(map[string]models.RateLimit, len(a.buckets)),
+	}
+	for owner, limit := range a.owners {
+		limits.Owners[owner] = limit
+	}
+	for bucketName, limit := range a.buckets {
+		limits.Buckets[bucketName] = limit
+	}
+	return limits
+}
+
+// SetLimits replaces the configured limits and all overrides.
+func (a *Admission) SetLimits(limits models.Limits) error {
+	config := AdmissionConfig{Owner: limits.Owner, Bucket: limits.Bucket, BackendConcurrency: limits.BackendConcurrency}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	for _, limit := range limits.Owners {
+		if !validRateLimit(limit) {
+			return ErrInvalidLimit
+		}
+	}
+	for _, limit := range limits.Buckets {
+		if !validRateLimit(limit) {
+			return ErrInvalidLimit
+		}
+	}
+
+	if err := a.SetConfig(config); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.owners = make(map[string]models.RateLimit, len(limits.Owners))
+	for owner, limit := range limits.Owners {
+		a.owners[owner] = limit
+	}
+	a.buckets = make(map[string]models.RateLimit, len(limits.Buckets))
+	for bucketName, limit := range limits.Buckets {
+		a.buckets[bucketName] = limit
+	}
+	return nil
+}
+
+// Middleware returns route middleware admitting requests by the rate limits of their owner
+// and, on bucket routes, their bucket. A nil Admission admits everything.
+func (a *Admission) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if a == nil {
+			return next
+		}
+		return func(ctx echo.Context) error {
+			if a.saturated() {
+				return tooManyRequests(ctx, ErrBackendsSaturated, saturatedRetryAfter, limitScopeBackend, limitConcurrency)
+			}
+			owner := getOwnerFromContext(ctx)
+			limiters, retryAfter, scope, limit := a.admit(time.Now(), owner, ctx.Param("name"))
+			if limit != "" {
+				log.Debug().Str("owner", owner).Str("scope", scope).Str("limit", limit).Msg("Request rate limited")
+				return tooManyRequests(ctx, ErrRateLimited, retryAfter, scope, limit)
+			}
+
+			if charge := a.byteCharger(limiters); charge != nil {
+				req := ctx.Request()
+				if req.Body != nil && req.Body != http.NoBody {
+					req.Body = &chargingReader{ReadCloser: req.Body, charge: charge}
+				}
+				ctx.Response().Writer = &chargingWriter{ResponseWriter: ctx.Response().Writer, charge: charge}
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// tooManyRequests writes a 429 response telling the client when to retry.
+func tooManyRequests(ctx echo.Context, err error, retryAfter time.Duration, scope, limit string) error {
+	admissionRejectionsTotal.WithLabelValues(scope, limit).Inc()
+	ctx.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(max(retryAfter, time.Second).Seconds()))))
+	return ctx.JSON(http.StatusTooManyRequests, map[string]string{
+		"error": err.Error(),
+		"scope": scope,
+		"limit": limit,
+	})
+}
+
+// admit takes a request token from the limiters of owner and bucketName, or from none of
+// them if one is exhausted. It returns the limiters to charge transferred bytes to, or how
+// long to wait and which limit rejected the request.
+func (a *Admission) admit(now time.Time, owner, bucketName string) (
+	limiters []*throughputLimiter, retryAfter time.Duration, scope, limit string,
+) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if limiter := a.limiterLocked(limitScopeOwner, owner, a.ownerLimitLocked(owner)); limiter != nil {
+		limiters = append(limiters, limiter)
+	}
+	if bucketName != "" {
+		if limiter := a.limiterLocked(limitScopeBucket, bucketName, a.bucketLimitLocked(bucketName)); limiter != nil {
+			limiters = append(limiters, limiter)
+		}
+	}
+
+	reservations := make([]*rate.Reservation, 0, len(limiters))
+	reject := func(limiter *throughputLimiter, wait time.Duration, kind string) (
+		[]*throughputLimiter, time.Duration, string, string,
+	) {
+		for _, reservation := range reservations {
+			reservation.CancelAt(now)
+		}
+		return nil, wait, limiter.scope, kind
+	}
+	for _, limiter := range limiters {
+		if limiter.bytes != nil {
+			// Bytes are charged after they were transferred, so the bucket can be in debt
+			if tokens := limiter.bytes.TokensAt(now); tokens < 1 {
+				return reject(limiter, time.Duration((1-tokens)/float64(limiter.bytes.Limit())*float64(time.Second)), limitBytes)
+			}
+		}
+		if limiter.requests != nil {
+			reservation := limiter.requests.ReserveN(now, 1)
+			if delay := reservation.DelayFrom(now); delay > 0 {
+				reservation.CancelAt(now)
+				return reject(limiter, delay, limitRequests)
+			}
+			reservations = append(reservations, reservation)
+		}
+	}
+	return limiters, 0, "", ""
+}
+
+// ownerLimitLocked returns the rate limit of owner. a.mu must be held.
+func (a *Admission) ownerLimitLocked(owner string) models.RateLimit {
+	if limit, ok := a.owners[owner]; ok {
+		return limit
+	}
+	return a.config.Owner
+}
+
+// bucketLimitLocked returns the rate limit of a bucket. a.mu must be held.
+func (a *Admission) bucketLimitLocked(bucketName string) models.RateLimit {
+	if limit, ok := a.buckets[bucketName]; ok {
+		return limit
+	}
+	return a.config.Bucket
+}
+
+// limiterLocked returns the limiter of name in scope, creating it or replacing it if its
+// limit changed, and evicting the least recently used limiter when there are too many. It
+// returns nil if the limit is unlimited. a.mu must be held.
+func (a *Admission) limiterLocked(scope, name string, limit models.RateLimit) *throughputLimiter {
+	key := scope + ":" + name
+	element, exists := a.limiters[key]
+	if limit == (models.RateLimit{}) {
+		if exists {
+			a.order.Remove(element)
+			delete(a.limiters, key)
+		}
+		return nil
+	}
+	if exists {
+		a.order.MoveToFront(element)
+		if limiter := element.Value.(*throughputLimiter); limiter.limit == limit {
+			return limiter
+		}
+	}
+
+	limiter := &throughputLimiter{key: key, scope: scope, limit: limit}
+	if limit.RequestsPerSecond > 0 {
+		limiter.requests = rate.NewLimiter(rate.Limit(limit.RequestsPerSecond), max(int(math.Ceil(limit.RequestsPerSecond)), 1))
+	}
+	if limit.BytesPerSecond > 0 {
+		// One second of transfer can be used at once
+		limiter.bytes = rate.NewLimiter(rate.Limit(limit.BytesPerSecond), int(min(limit.BytesPerSecond, math.MaxInt32)))
+	}
+	if exists {
+		element.Value = limiter
+		return limiter
+	}
+
+	a.limiters[key] = a.order.PushFront(limiter)
+	if a.order.Len() > maxLimiters {
+		oldest := a.order.Back()
+		a.order.Remove(oldest)
+		delete(a.limiters, oldest.Value.(*throughputLimiter).key)
+	}
+	return limiter
+}
+
+// byteCharger returns a function charging transferred bytes to the byte limits of limiters,
+// or nil if none of them limits bytes.
+func (a *Admission) byteCharger(limiters []*throughputLimiter) func(n int) {
+	var bytes []*rate.Limiter
+	for _, limiter := range limiters {
+		if limiter.bytes != nil {
+			bytes = append(bytes, limiter.bytes)
+		}
+	}
+	if len(bytes) == 0 {
+		return nil
+	}
+
+	return func(n int) {
+		now := time.Now()
+		for _, limiter := range bytes {
+			// Reservations are never cancelled, which puts the bucket in debt for the bytes
+			// beyond its tokens; ReserveN takes at most the burst at once
+			for remaining := n; remaining > 0; remaining -= limiter.Burst() {
+				limiter.ReserveN(now, min(remaining, limiter.Burst()))
+			}
+		}
+	}
+}
+
+// saturated reports whether every online backend is at its concurrency limit.
+func (a *Admission) saturated() bool {
+	a.mu.Lock()
+	limit := a.config.BackendConcurrency
+	a.mu.Unlock()
+	if limit <= 0 {
+		return false
+	}
+
+	backends := a.online()
+	if len(backends) == 0 {
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, backendURL := range backends {
+		slots, ok := a.slots[backendKey(backendURL)]
+		if !ok || slots.inFlight < limit {
+			return false
+		}
+	}
+	return true
+}
+
+// backendKey returns the key of the slots of a backend: its scheme and host, as seen by
+// the transport.
+func backendKey(backendURL string) string {
+	parsed, err := url.Parse(backendURL)
+	if err != nil {
+		return backendURL
+	}
+	return backendLabel(parsed)
+}
+
+// acquireBackend waits for a free slot of a backend and returns the function releasing it.
+func (a *Admission) acquireBackend(ctx context.Context, backend string) (func(), error) {
+	for {
+		a.mu.Lock()
+		slots, ok := a.slots[backend]
+		if !ok {
+			slots = &backendSlots{released: make(chan struct{})}
+			a.slots[backend] = slots
+		}
+		if a.config.BackendConcurrency <= 0 || slots.inFlight < a.config.BackendConcurrency {
+			slots.inFlight++
+			backendInFlight.WithLabelValues(backend).Set(float64(slots.inFlight))
+			a.mu.Unlock()
+
+			var once sync.Once
+			return func() {
+				once.Do(func() {
+					a.mu.Lock()
+					defer a.mu.Unlock()
+					slots.inFlight--
+					backendInFlight.WithLabelValues(backend).Set(float64(slots.inFlight))
+					slots.release()
+				})
+			}, nil
+		}
+		released := slots.released
+		a.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// release wakes the requests waiting for a slot. a.mu must be held.
+func (s *backendSlots) release() {
+	close(s.released)
+	s.released = make(chan struct{})
+}
+
+// LimitsHandler handles GET /admin/limits.
+func (a *Admission) LimitsHandler(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, a.Limits())
+}
+
+// SetLimitsHandler handles PUT /admin/limits, replacing all limits and overrides.
+func (a *Admission) SetLimitsHandler(ctx echo.Context) error {
+	var limits models.Limits
+	if err := ctx.Bind(&limits); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+	if err := a.SetLimits(limits); err != nil {
+		return limitErrorResponse(ctx, err)
+	}
+	return ctx.JSON(http.StatusOK, a.Limits())
+}
+
+// SetOwnerLimitHandler handles PUT /admin/limits/owners/:owner.
+func (a *Admission) SetOwnerLimitHandler(ctx echo.Context) error {
+	return a.setOverrideHandler(ctx, ctx.Param("owner"), a.SetOwnerLimit)
+}
+
+// RemoveOwnerLimitHandler handles DELETE /admin/limits/owners/:owner.
+func (a *Admission) RemoveOwnerLimitHandler(ctx echo.Context) error {
+	a.RemoveOwnerLimit(ctx.Param("owner"))
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// SetBucketLimitHandler handles PUT /admin/limits/buckets/:name.
+func (a *Admission) SetBucketLimitHandler(ctx echo.Context) error {
+	return a.setOverrideHandler(ctx, ctx.Param("name"), a.SetBucketLimit)
+}
+
+// RemoveBucketLimitHandler handles DELETE /admin/limits/buckets/:name.
+func (a *Admission) RemoveBucketLimitHandler(ctx echo.Context) error {
+	a.RemoveBucketLimit(ctx.Param("name"))
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// setOverrideHandler binds a rate limit and sets it as the override of name.
+func (a *Admission) setOverrideHandler(ctx echo.Context, name string, set func(string, models.RateLimit) error) error {
+	var limit models.RateLimit
+	if err := ctx.Bind(&limit); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Invalid request body",
+		})
+	}
+	if err := set(name, limit); err != nil {
+		return limitErrorResponse(ctx, err)
+	}
+	return ctx.JSON(http.StatusOK, limit)
+}
+
+// limitErrorResponse maps a limit error to an HTTP response.
+func limitErrorResponse(ctx echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	if errors.Is(err, ErrInvalidLimit) {
+		status = http.StatusBadRequest
+	}
+	return ctx.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
+
+// admissionTransport holds a slot of the backend for the duration of each backend request,
+// until its response body is closed.
+type admissionTransport struct {
+	next      http.RoundTripper
+	admission *Admission
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *admissionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.admission.acquireBackend(req.Context(), backendLabel(req.URL))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody releases a backend slot when the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close implements io.Closer.
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// chargingReader charges the bytes read from a request body to byte rate limits.
+type chargingReader struct {
+	io.ReadCloser
+	charge func(n int)
+}
+
+// Read implements io.Reader.
+func (r *chargingReader) Read(buf []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buf)
+	if n > 0 {
+		r.charge(n)
+	}
+	return n, err
+}
+
+// chargingWriter charges the bytes written to a response to byte rate limits.
+type chargingWriter struct {
+	http.ResponseWriter
+	charge func(n int)
+}
+
+// Write implements io.Writer.
+func (w *chargingWriter) Write(buf []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(buf)
+	if n > 0 {
+		w.charge(n)
+	}
+	return n, err
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController.
+func (w *chargingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
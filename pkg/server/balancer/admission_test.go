@@ -0,0 +1,227 @@
+package balancer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+// AdmissionTestSuite tests rate limiting and backend concurrency limits
+type AdmissionTestSuite struct {
+	suite.Suite
+	admission *Admission
+	online    []string
+	echo      *echo.Echo
+}
+
+// SetupTest routes a download-like and a bucket endpoint through the admission middleware
+func (s *AdmissionTestSuite) SetupTest() {
+	s.online = nil
+	s.admission = NewAdmission(AdmissionConfig{}, func() []string { return s.online })
+
+	s.echo = echo.New()
+	admit := s.admission.Middleware()
+	s.echo.GET("/file/:hash/download", func(ctx echo.Context) error {
+		size, _ := strconv.Atoi(ctx.QueryParam("size"))
+		return ctx.Blob(http.StatusOK, "application/octet-stream", make([]byte, size))
+	}, admit)
+	s.echo.GET("/bucket/:name", func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusOK)
+	}, admit)
+
+	admin := s.echo.Group("/admin")
+	admin.GET("/limits", s.admission.LimitsHandler)
+	admin.PUT("/limits", s.admission.SetLimitsHandler)
+	admin.PUT("/limits/owners/:owner", s.admission.SetOwnerLimitHandler)
+	admin.DELETE("/limits/owners/:owner", s.admission.RemoveOwnerLimitHandler)
+	admin.PUT("/limits/buckets/:name", s.admission.SetBucketLimitHandler)
+}
+
+// request sends a request as owner
+func (s *AdmissionTestSuite) request(method, path, owner, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if owner != "" {
+		req.Header.Set("X-Owner-ID", owner)
+	}
+	rec := httptest.NewRecorder()
+	s.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestOwnerRequestRate tests that owners are limited independently and told when to retry
+func (s *AdmissionTestSuite) TestOwnerRequestRate() {
+	s.Require().NoError(s.admission.SetConfig(AdmissionConfig{Owner: models.RateLimit{RequestsPerSecond: 0.5}}))
+
+	s.Equal(http.StatusOK, s.request(http.MethodGet, "/file/abc/download", "alice", "").Code)
+
+	rec := s.request(http.MethodGet, "/file/abc/download", "alice", "")
+	s.Equal(http.StatusTooManyRequests, rec.Code)
+	s.Equal("2", rec.Header().Get("Retry-After"))
+	var body map[string]string
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &body))
+	s.Equal(limitScopeOwner, body["scope"])
+	s.Equal(limitRequests, body["limit"])
+
+	s.Equal(http.StatusOK, s.request(http.MethodGet, "/file/abc/download", "bob", "").Code)
+}
+
+// TestBucketLimit tests that a bucket override rejects without using up the owner's tokens
+func (s *AdmissionTestSuite) TestBucketLimit() {
+	s.Require().NoError(s.admission.SetConfig(AdmissionConfig{Owner: models.RateLimit{RequestsPerSecond: 2}}))
+	s.Require().NoError(s.admission.SetBucketLimit("photos", models.RateLimit{RequestsPerSecond: 0.1}))
+
+	s.Equal(http.StatusOK, s.request(http.MethodGet, "/bucket/photos", "alice", "").Code)
+	rec := s.request(http.MethodGet, "/bucket/photos", "alice", "")
+	s.Equal(http.StatusTooManyRequests, rec.Code)
+	s.Equal("10", rec.Header().Get("Retry-After"))
+
+	// The rejected request did not count against alice
+	s.Equal(http.StatusOK, s.request(http.MethodGet, "/bucket/logs", "alice", "").Code)
+	s.Equal(http.StatusTooManyRequests, s.request(http.MethodGet, "/bucket/logs", "alice", "").Code)
+}
+
+// TestByteRate tests that transferred bytes are charged and reject the next request
+func (s *AdmissionTestSuite) TestByteRate() {
+	s.Require().NoError(s.admission.SetConfig(AdmissionConfig{Owner: models.RateLimit{BytesPerSecond: 1000}}))
+
+	rec := s.request(http.MethodGet, "/file/abc/download?size=5000", "alice", "")
+	s.Require().Equal(http.StatusOK, rec.Code)
+	s.Equal(5000, rec.Body.Len())
+
+	rec = s.request(http.MethodGet, "/file/abc/download", "alice", "")
+	s.Equal(http.StatusTooManyRequests, rec.Code)
+	var body map[string]string
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &body))
+	s.Equal(limitBytes, body["limit"])
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	s.Require().NoError(err)
+	s.InDelta(5, retryAfter, 1, "4000 bytes of debt take about four seconds to pay back")
+}
+
+// TestBackendConcurrency tests waiting for backend slots and rejecting requests when all backends are busy
+func (s *AdmissionTestSuite) TestBackendConcurrency() {
+	s.Require().NoError(s.admission.SetConfig(AdmissionConfig{BackendConcurrency: 1}))
+	s.online = []string{"http://a:8080", "http://b:8080"}
+
+	releaseA, err := s.admission.acquireBackend(context.Background(), "http://a:8080")
+	s.Require().NoError(err)
+	s.False(s.admission.saturated())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = s.admission.acquireBackend(ctx, "http://a:8080")
+	s.ErrorIs(err, context.DeadlineExceeded)
+
+	releaseB, err := s.admission.acquireBackend(context.Background(), "http://b:8080")
+	s.Require().NoError(err)
+	s.True(s.admission.saturated())
+
+	rec := s.request(http.MethodGet, "/file/abc/download", "alice", "")
+	s.Equal(http.StatusTooManyRequests, rec.Code)
+	s.Contains(rec.Body.String(), ErrBackendsSaturated.Error())
+
+	// A waiting request gets the slot once it is released
+	acquired := make(chan func())
+	go func() {
+		release, _ := s.admission.acquireBackend(context.Background(), "http://a:8080")
+		acquired <- release
+	}()
+	releaseA()
+	releaseA() // Releasing twice frees only one slot
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		s.Fail("waiting request did not get the released slot")
+	}
+	releaseB()
+	s.False(s.admission.saturated())
+}
+
+// TestTransportReleasesSlot tests that a backend slot is held until the response body is closed
+func (s *AdmissionTestSuite) TestTransportReleasesSlot() {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer backend.Close()
+	s.Require().NoError(s.admission.SetConfig(AdmissionConfig{BackendConcurrency: 1}))
+	s.online = []string{backend.URL}
+
+	client := &http.Client{Transport: &admissionTransport{next: http.DefaultTransport, admission: s.admission}}
+	resp, err := client.Get(backend.URL + "/file/abc/download")
+	s.Require().NoError(err)
+	s.True(s.admission.saturated())
+
+	data, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Equal("data", string(data))
+	s.Require().NoError(resp.Body.Close())
+	s.False(s.admission.saturated())
+}
+
+// TestAdminLimits tests changing limits through the admin API
+func (s *AdmissionTestSuite) TestAdminLimits() {
+	rec := s.request(http.MethodPut, "/admin/limits/owners/alice", "", `{"requests_per_second":5,"bytes_per_second":1024}`)
+	s.Require().Equal(http.StatusOK, rec.Code)
+
+	rec = s.request(http.MethodPut, "/admin/limits/buckets/photos", "", `{"requests_per_second":-1}`)
+	s.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = s.request(http.MethodGet, "/admin/limits", "", "")
+	s.Require().Equal(http.StatusOK, rec.Code)
+	var limits models.Limits
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &limits))
+	s.Equal(models.RateLimit{RequestsPerSecond: 5, BytesPerSecond: 1024}, limits.Owners["alice"])
+	s.Empty(limits.Buckets)
+
+	rec = s.request(http.MethodPut, "/admin/limits", "", `{"owner":{"requests_per_second":1},"backend_concurrency":4}`)
+	s.Require().Equal(http.StatusOK, rec.Code)
+	limits = s.admission.Limits()
+	s.InDelta(1.0, limits.Owner.RequestsPerSecond, 1e-9)
+	s.Equal(4, limits.BackendConcurrency)
+	s.Empty(limits.Owners, "replacing the limits drops the overrides")
+
+	s.Require().NoError(s.admission.SetOwnerLimit("alice", models.RateLimit{RequestsPerSecond: 1}))
+	rec = s.request(http.MethodDelete, "/admin/limits/owners/alice", "", "")
+	s.Equal(http.StatusNoContent, rec.Code)
+	s.Empty(s.admission.Limits().Owners)
+}
+
+// TestEvictLimiters tests that the least recently used limiter is dropped once there are
+// too many
+func (s *AdmissionTestSuite) TestEvictLimiters() {
+	limit := models.RateLimit{RequestsPerSecond: 1}
+	s.admission.mu.Lock()
+	defer s.admission.mu.Unlock()
+
+	busy := s.admission.limiterLocked(limitScopeOwner, "busy", limit)
+	s.admission.limiterLocked(limitScopeOwner, "idle", limit)
+	for i := range maxLimiters - 1 {
+		s.Same(busy, s.admission.limiterLocked(limitScopeOwner, "busy", limit))
+		s.admission.limiterLocked(limitScopeOwner, strconv.Itoa(i), limit)
+	}
+	s.Len(s.admission.limiters, maxLimiters)
+	s.Equal(maxLimiters, s.admission.order.Len())
+	s.Contains(s.admission.limiters, limitScopeOwner+":busy")
+	s.NotContains(s.admission.limiters, limitScopeOwner+":idle")
+
+	s.Nil(s.admission.limiterLocked(limitScopeOwner, "busy", models.RateLimit{}))
+	s.Len(s.admission.limiters, maxLimiters-1)
+	s.Equal(maxLimiters-1, s.admission.order.Len())
+}
+
+func TestAdmissionSuite(t *testing.T) {
+	suite.Run(t, new(AdmissionTestSuite))
+}
@@ -0,0 +1,177 @@
+package balancer
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"loopfs/pkg/audit"
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// auditHashKey is the echo context key handlers use to report the hash an operation affected.
+const auditHashKey = "audit_hash"
+
+// setAuditHash records the hash affected by the current request in its audit entry.
+func setAuditHash(ctx echo.Context, hash string) {
+	ctx.Set(auditHashKey, hash)
+}
+
+// auditResult classifies an HTTP status code for the audit log.
+func auditResult(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return audit.ResultDenied
+	case status >= http.StatusBadRequest:
+		return audit.ResultFailure
+	default:
+		return audit.ResultSuccess
+	}
+}
+
+// auditOperation returns route middleware recording action in auditLog once the request completes.
+// It does nothing when auditLog is nil.
+func auditOperation(auditLog *audit.Log, action string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if auditLog == nil {
+			return next
+		}
+		return func(ctx echo.Context) error {
+			err := next(ctx)
+			if err != nil {
+				ctx.Error(err)
+			}
+
+			hash, _ := ctx.Get(auditHashKey).(string)
+			if hash == "" {
+				hash = ctx.Param("hash")
+			}
+			status := ctx.Response().Status
+			auditLog.Record(&models.AuditEntry{
+				Actor:     getOwnerFromContext(ctx),
+				Action:    action,
+				Bucket:    ctx.Param("name"),
+				Key:       ctx.Param("*"),
+				Hash:      hash,
+				SourceIP:  ctx.RealIP(),
+				RequestID: log.RequestIDFromContext(ctx.Request().Context()),
+				Status:    status,
+				Result:    auditResult(status),
+			})
+			return err
+		}
+	}
+}
+
+// SetAuditLog enables recording of mutating operations and the GET /admin/audit endpoint.
+// The server closes the log on shutdown.
+func (b *Server) SetAuditLog(auditLog *audit.Log) {
+	b.auditLog = auditLog
+}
+
+// SetAdminToken sets the bearer token required by the admin API. Without a token the admin API
+// only serves loopback clients.
+func (b *Server) SetAdminToken(token string) {
+	b.adminToken = token
+}
+
+// adminAuth requires the configured bearer token on admin endpoints. Without a token, only
+// requests whose connection comes from a loopback address are let through.
+func (b *Server) adminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if b.adminToken == "" {
+			if loopbackClient(ctx.Request()) {
+				return next(ctx)
+			}
+			log.Warn().
+				Str("path", ctx.Request().URL.Path).
+				Str("remote_addr", ctx.Request().RemoteAddr).
+				Msg("Refusing admin request from a non-loopback client without an admin token")
+			return ctx.JSON(http.StatusForbidden, map[string]string{
+				"error": "admin API is only served to loopback clients when no admin token is set",
+			})
+		}
+
+		token, found := strings.CutPrefix(ctx.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(b.adminToken)) != 1 {
+			log.Warn().Str("path", ctx.Request().URL.Path).Msg("Unauthorized admin request")
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{
+				"error": "unauthorized",
+			})
+		}
+		return next(ctx)
+	}
+}
+
+// loopbackClient reports whether the connection of req comes from a loopback address.
+// Forwarding headers are ignored since any client can set them.
+func loopbackClient(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// parseAuditFilter reads an audit filter from query parameters.
+func parseAuditFilter(ctx echo.Context) (audit.Filter, error) {
+	filter := audit.Filter{
+		Bucket: ctx.QueryParam("bucket"),
+		Actor:  ctx.QueryParam("actor"),
+		Action: ctx.QueryParam("action"),
+	}
+
+	var err error
+	if since := ctx.QueryParam("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return filter, errors.New("invalid since: must be an RFC 3339 timestamp")
+		}
+	}
+	if until := ctx.QueryParam("until"); until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return filter, errors.New("invalid until: must be an RFC 3339 timestamp")
+		}
+	}
+	if limit := ctx.QueryParam("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 {
+			return filter, errors.New("invalid limit: must be a positive integer")
+		}
+	}
+	return filter, nil
+}
+
+// getAudit handles GET /admin/audit.
+func (b *Server) getAudit(ctx echo.Context) error {
+	filter, err := parseAuditFilter(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	entries, err := b.auditLog.Query(filter)
+	if err != nil {
+		if errors.Is(err, audit.ErrQueryUnsupported) {
+			return ctx.JSON(http.StatusNotImplemented, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Msg("Failed to query audit log")
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "Failed to query audit log",
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, models.AuditResponse{
+		Entries: entries,
+		Count:   len(entries),
+	})
+}
@@ -0,0 +1,223 @@
+package balancer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"loopfs/pkg/audit"
+	"loopfs/pkg/bucket"
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	testAdminToken = "secret"
+	testAuditHash  = "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3a94a8fe5ccb19ba61c4c0873"
+	testHeldHash   = "b94a8fe5ccb19ba61c4c0873d391e987982fbbd3a94a8fe5ccb19ba61c4c0873"
+)
+
+// AuditTestSuite tests audit recording and the audit query endpoint
+type AuditTestSuite struct {
+	suite.Suite
+	backend   *httptest.Server
+	server    *Server
+	auditPath string
+	held      chan struct{} // Receives a value when the backend holds a request for testHeldHash
+	release   chan struct{} // Closed to let held backend requests finish
+}
+
+// SetupTest creates a balancer with a bucket store and an SQLite audit log
+func (s *AuditTestSuite) SetupTest() {
+	s.held = make(chan struct{}, 1)
+	s.release = make(chan struct{})
+	s.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, testHeldHash) {
+			s.held <- struct{}{}
+			<-s.release
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"message":"ok"}`))
+	}))
+
+	dir := s.T().TempDir()
+	s.server = NewBalancerServer([]string{s.backend.URL}, 0, time.Second, time.Millisecond, time.Millisecond,
+		5*time.Second, time.Hour, time.Second, false, "", "")
+	var err error
+	s.server.bucketStore, err = bucket.NewStore(filepath.Join(dir, "buckets.db"))
+	s.Require().NoError(err)
+	s.auditPath = filepath.Join(dir, "audit.db")
+	sink, err := audit.NewSQLiteSink(s.auditPath)
+	s.Require().NoError(err)
+	s.server.SetAuditLog(audit.NewLog(sink))
+	s.server.SetAdminToken(testAdminToken)
+
+	s.server.backendManager = NewBackendManager([]string{s.backend.URL}, time.Hour, time.Second)
+	s.server.setupRoutes(NewBalancer(s.server.backendManager, 0, time.Millisecond, time.Millisecond, 5*time.Second))
+}
+
+// TearDownTest releases the server resources
+func (s *AuditTestSuite) TearDownTest() {
+	select {
+	case <-s.release:
+	default:
+		close(s.release)
+	}
+	s.backend.Close()
+	_ = s.server.bucketStore.Close()
+	_ = s.server.auditLog.Close()
+}
+
+// do sends a request through the balancer router
+func (s *AuditTestSuite) do(method, target, owner string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if owner != "" {
+		req.Header.Set("X-Owner-ID", owner)
+	}
+	req.Header.Set(log.RequestIDHeader, "req-"+owner)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+testAdminToken)
+	rec := httptest.NewRecorder()
+	s.server.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+// queryAudit fetches entries from the audit endpoint
+func (s *AuditTestSuite) queryAudit(query string) []models.AuditEntry {
+	rec := s.do(http.MethodGet, "/admin/audit?"+query, "")
+	s.Require().Equal(http.StatusOK, rec.Code, rec.Body.String())
+	var response models.AuditResponse
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &response))
+	s.Equal(len(response.Entries), response.Count)
+	return response.Entries
+}
+
+// TestMutationsRecorded tests that mutating operations are recorded with actor and result
+func (s *AuditTestSuite) TestMutationsRecorded() {
+	s.Equal(http.StatusCreated, s.do(http.MethodPost, "/bucket/photos", "alice").Code)
+	s.Equal(http.StatusForbidden, s.do(http.MethodDelete, "/bucket/photos", "bob").Code)
+	s.do(http.MethodDelete, "/file/"+testAuditHash+"/delete", "alice")
+	s.Equal(http.StatusOK, s.do(http.MethodGet, "/bucket/photos", "alice").Code)
+
+	entries := s.queryAudit("")
+	s.Require().Len(entries, 3, "reads must not be audited")
+
+	deleteEntry := entries[0]
+	s.Equal(audit.ActionDelete, deleteEntry.Action)
+	s.Equal(testAuditHash, deleteEntry.Hash)
+	s.Equal("alice", deleteEntry.Actor)
+
+	denied := entries[1]
+	s.Equal(audit.ActionBucketDelete, denied.Action)
+	s.Equal("bob", denied.Actor)
+	s.Equal("photos", denied.Bucket)
+	s.Equal(http.StatusForbidden, denied.Status)
+	s.Equal(audit.ResultDenied, denied.Result)
+	s.Equal("req-bob", denied.RequestID)
+	s.NotEmpty(denied.SourceIP)
+
+	created := entries[2]
+	s.Equal(audit.ActionBucketCreate, created.Action)
+	s.Equal(audit.ResultSuccess, created.Result)
+
+	s.Len(s.queryAudit("actor=bob"), 1)
+	s.Len(s.queryAudit("bucket=photos"), 2)
+	s.Len(s.queryAudit("action=bucket_create"), 1)
+	s.Len(s.queryAudit("limit=1"), 1)
+	s.Empty(s.queryAudit("since=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339)))
+	s.Len(s.queryAudit("until="+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)), 3)
+}
+
+// TestAuditEndpointValidation tests authentication and parameter validation
+func (s *AuditTestSuite) TestAuditEndpointValidation() {
+	req := httptest.NewRequest(http.MethodGet, "/admin/audit", nil)
+	rec := httptest.NewRecorder()
+	s.server.echo.ServeHTTP(rec, req)
+	s.Equal(http.StatusUnauthorized, rec.Code)
+
+	for _, query := range []string{"since=yesterday", "until=2026-13-01", "limit=0", "limit=abc"} {
+		s.Equal(http.StatusBadRequest, s.do(http.MethodGet, "/admin/audit?"+query, "").Code, query)
+	}
+}
+
+// TestAdminWithoutToken tests that the admin API only serves loopback clients without a token
+func (s *AuditTestSuite) TestAdminWithoutToken() {
+	s.server.SetAdminToken("")
+
+	request := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(echo.HeaderXForwardedFor, "127.0.0.1")
+		rec := httptest.NewRecorder()
+		s.server.echo.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	s.Equal(http.StatusOK, request("127.0.0.1:40000"))
+	s.Equal(http.StatusOK, request("[::1]:40000"))
+	s.Equal(http.StatusForbidden, request("192.0.2.10:40000"))
+	s.Equal(http.StatusForbidden, request("invalid"))
+}
+
+// TestShutdownRecordsInFlightRequests tests that shutdown drains requests before closing the audit log
+func (s *AuditTestSuite) TestShutdownRecordsInFlightRequests() {
+	go func() { _ = s.server.echo.Start("127.0.0.1:0") }()
+	s.Require().Eventually(func() bool { return s.server.echo.ListenerAddr() != nil }, 5*time.Second, 10*time.Millisecond)
+
+	responses := make(chan int, 1)
+	go func() {
+		req, err := http.NewRequest(http.MethodDelete,
+			"http://"+s.server.echo.ListenerAddr().String()+"/file/"+testHeldHash+"/delete", nil)
+		if err != nil {
+			responses <- 0
+			return
+		}
+		req.Header.Set("X-Owner-ID", "alice")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			responses <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		responses <- resp.StatusCode
+	}()
+	<-s.held
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.server.Shutdown() }()
+	// Give the shutdown time to reach the audit log if it did not wait for the request
+	time.Sleep(100 * time.Millisecond)
+	close(s.release)
+
+	s.Equal(http.StatusOK, <-responses)
+	s.Require().NoError(<-shutdown)
+
+	sink, err := audit.NewSQLiteSink(s.auditPath)
+	s.Require().NoError(err)
+	defer sink.Close()
+	entries, err := sink.Query(audit.Filter{Action: audit.ActionDelete})
+	s.Require().NoError(err)
+	s.Require().Len(entries, 1)
+	s.Equal(testHeldHash, entries[0].Hash)
+}
+
+// TestAuditResult tests status classification
+func (s *AuditTestSuite) TestAuditResult() {
+	s.Equal(audit.ResultSuccess, auditResult(http.StatusOK))
+	s.Equal(audit.ResultSuccess, auditResult(http.StatusCreated))
+	s.Equal(audit.ResultDenied, auditResult(http.StatusUnauthorized))
+	s.Equal(audit.ResultDenied, auditResult(http.StatusForbidden))
+	s.Equal(audit.ResultFailure, auditResult(http.StatusNotFound))
+	s.Equal(audit.ResultFailure, auditResult(http.StatusServiceUnavailable))
+}
+
+// TestAuditTestSuite runs the audit test suite
+func TestAuditTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditTestSuite))
+}
@@ -3,13 +3,18 @@ package balancer
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"loopfs/pkg/log"
 	"loopfs/pkg/models"
+	"loopfs/pkg/tracing"
 
 	"github.com/hashicorp/go-retryablehttp"
 )
@@ -17,20 +22,35 @@ import (
 const (
 	defaultHealthCheckInterval = 5 * time.Second
 	defaultHealthCheckTimeout  = 5 * time.Second
-	maxConsecutiveFailures     = 3
+	// DefaultNodeInfoInterval is how often the node info of a backend is refreshed. Health
+	// checks in between only probe /healthz.
+	DefaultNodeInfoInterval = 15 * time.Second
 )
 
 // BackendManager manages backend servers and their health status.
 type BackendManager struct {
 	backends            map[string]*models.BackendStatus
+	health              map[string]*backendHealth
 	mu                  sync.RWMutex
 	client              *http.Client
 	healthCheckInterval time.Duration
 	healthCheckTimeout  time.Duration
+	nodeInfoInterval    time.Duration
+	breakerConfig       BreakerConfig
+	adminAdded          map[string]bool // Backends added through the admin API, kept by ReloadBackends
+	adminRemoved        map[string]bool // Backends removed through the admin API, not restored by ReloadBackends
 	stopCh              chan struct{}
 	wg                  sync.WaitGroup
 }
 
+// backendHealth is the health check state of a backend.
+type backendHealth struct {
+	mu         sync.Mutex // Guards breaker under a read lock of bm.mu; the write lock is enough alone
+	breaker    *circuitBreaker
+	nodeInfoAt time.Time // Last time the node info was fetched
+	noHealthz  bool      // The backend predates /healthz and is probed with /node/info
+}
+
 // NewBackendManager creates a new backend manager with the given backend URLs.
 func NewBackendManager(backendURLs []string, healthCheckInterval, healthCheckTimeout time.Duration) *BackendManager {
 	if healthCheckInterval <= 0 {
@@ -40,21 +60,74 @@ func NewBackendManager(backendURLs []string, healthCheckInterval, healthCheckTim
 		healthCheckTimeout = defaultHealthCheckTimeout
 	}
 
-	backends := make(map[string]*models.BackendStatus, len(backendURLs))
-	for _, url := range backendURLs {
-		backends[url] = &models.BackendStatus{
-			URL:    url,
-			Online: true, // Assume online until proven otherwise
-		}
-	}
-
-	return &BackendManager{
-		backends:            backends,
+	bm := &BackendManager{
+		backends:            make(map[string]*models.BackendStatus, len(backendURLs)),
+		health:              make(map[string]*backendHealth, len(backendURLs)),
 		client:              &http.Client{Timeout: healthCheckTimeout},
 		healthCheckInterval: healthCheckInterval,
 		healthCheckTimeout:  healthCheckTimeout,
+		nodeInfoInterval:    DefaultNodeInfoInterval,
+		breakerConfig:       DefaultBreakerConfig(),
+		adminAdded:          make(map[string]bool),
+		adminRemoved:        make(map[string]bool),
 		stopCh:              make(chan struct{}),
 	}
+	for _, url := range backendURLs {
+		// Assume online until proven otherwise
+		bm.addBackendLocked(url, models.CircuitClosed)
+	}
+	return bm
+}
+
+// addBackendLocked adds a backend whose circuit starts in state. A backend starting with an
+// open circuit is offline until its first probe succeeds. bm.mu must be held.
+func (bm *BackendManager) addBackendLocked(backendURL string, state models.CircuitState) {
+	breaker := newCircuitBreaker(bm.breakerConfig, state, "")
+	if state == models.CircuitOpen {
+		breaker.reason = circuitReasonAdded
+	}
+	status := &models.BackendStatus{
+		URL:     backendURL,
+		Online:  state != models.CircuitOpen,
+		Circuit: breaker.status(time.Now()),
+	}
+	bm.backends[backendURL] = status
+	bm.health[backendURL] = &backendHealth{breaker: breaker}
+	observeCircuitState(backendURL, state)
+	if status.Online {
+		backendOnline.WithLabelValues(backendURL).Set(1)
+	} else {
+		backendOnline.WithLabelValues(backendURL).Set(0)
+	}
+}
+
+// removeBackendLocked removes a backend. bm.mu must be held.
+func (bm *BackendManager) removeBackendLocked(backendURL string) {
+	delete(bm.backends, backendURL)
+	delete(bm.health, backendURL)
+	backendOnline.WithLabelValues(backendURL).Set(0)
+	circuitState.WithLabelValues(backendURL).Set(0)
+}
+
+// SetBreakerConfig configures the circuit breakers of all backends. Unset settings use their
+// defaults. Breakers keep their state and window.
+func (bm *BackendManager) SetBreakerConfig(config BreakerConfig) {
+	config = config.withDefaults()
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.breakerConfig = config
+	for _, health := range bm.health {
+		health.breaker.config = config
+	}
+}
+
+// SetNodeInfoInterval sets how often the node info of each backend is refreshed. Values
+// below the health check interval refresh it with every health check.
+func (bm *BackendManager) SetNodeInfoInterval(interval time.Duration) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.nodeInfoInterval = interval
 }
 
 // Start begins the background health check goroutines.
@@ -79,7 +152,8 @@ func (bm *BackendManager) Stop() {
 	log.Info().Msg("Backend manager stopped")
 }
 
-// MarkBackendDead immediately marks a backend as offline.
+// MarkBackendDead immediately opens the circuit of a backend, taking it offline until a
+// probe after the cool-down succeeds.
 func (bm *BackendManager) MarkBackendDead(backendURL string, err error) {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
@@ -89,17 +163,132 @@ func (bm *BackendManager) MarkBackendDead(backendURL string, err error) {
 		return
 	}
 
-	if status.Online {
-		log.Warn().
-			Str("backend", backendURL).
-			Err(err).
-			Msg("Backend marked dead due to request failure")
+	now := time.Now()
+	status.LastError = err.Error()
+	status.LastCheck = now
+	bm.updateCircuitLocked(status, now, err, func(breaker *circuitBreaker) {
+		breaker.open(now, circuitReasonForced)
+	})
+}
+
+// RecordRequest records the outcome of a request sent to a backend with the backend's
+// circuit breaker. Requests to unknown backends are ignored. The breaker is updated under
+// its own lock; the manager's write lock is only taken when a failure or a change of the
+// circuit's state has to be reflected in the backend's status.
+func (bm *BackendManager) RecordRequest(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+	bm.mu.RLock()
+	backendURL, health := bm.backendForLocked(req.URL.String())
+	counted, failed := bm.breakerConfig.requestFailed(req, resp, err, elapsed)
+	if health == nil || !counted {
+		bm.mu.RUnlock()
+		return
 	}
+	now := time.Now()
+	health.mu.Lock()
+	before := health.breaker.state
+	health.breaker.record(now, failed)
+	changed := health.breaker.state != before
+	health.mu.Unlock()
+	bm.mu.RUnlock()
 
-	status.Online = false
-	status.ConsecFails = maxConsecutiveFailures
-	status.LastError = err.Error()
-	status.LastCheck = time.Now()
+	if !failed && !changed {
+		return
+	}
+	if failed && err == nil {
+		err = &BackendError{StatusCode: resp.StatusCode}
+		if !isServerFailure(resp.StatusCode) {
+			err = fmt.Errorf("%w: %s %s took %s", ErrSlowResponse, req.Method, req.URL.Path, elapsed.Round(time.Millisecond))
+		}
+	}
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	// The backend may have been removed, and added again, since the request was recorded
+	status, exists := bm.backends[backendURL]
+	if !exists || bm.health[backendURL] != health {
+		return
+	}
+	if failed {
+		status.LastError = err.Error()
+	}
+	bm.syncCircuitLocked(status, health.breaker, before, now, err)
+}
+
+// backendForLocked returns the backend a request URL belongs to: the one whose URL is the
+// longest prefix of the request URL ending at a path boundary. It looks up each such prefix
+// instead of scanning the backends. bm.mu must be held.
+func (bm *BackendManager) backendForLocked(requestURL string) (string, *backendHealth) {
+	candidate, _, _ := strings.Cut(requestURL, "?")
+	for {
+		if health, exists := bm.health[candidate]; exists {
+			return candidate, health
+		}
+		slash := strings.LastIndexByte(candidate, '/')
+		if slash < 0 {
+			return "", nil
+		}
+		candidate = candidate[:slash]
+	}
+}
+
+// updateCircuitLocked applies change to the circuit breaker of a backend and brings the
+// backend's status, logs and metrics in line with the new state. bm.mu must be held for
+// writing.
+func (bm *BackendManager) updateCircuitLocked(status *models.BackendStatus, now time.Time, err error, change func(*circuitBreaker)) {
+	breaker := bm.health[status.URL].breaker
+	before := breaker.state
+	change(breaker)
+	bm.syncCircuitLocked(status, breaker, before, now, err)
+}
+
+// syncCircuitLocked brings the backend's status, logs and metrics in line with its circuit
+// breaker, which was in state before. bm.mu must be held for writing.
+func (bm *BackendManager) syncCircuitLocked(status *models.BackendStatus, breaker *circuitBreaker, before models.CircuitState, now time.Time, err error) {
+	status.ConsecFails = breaker.consecutive
+	status.Circuit = breaker.status(now)
+	if breaker.state == before {
+		return
+	}
+
+	wasOnline := status.Online
+	status.Online = breaker.state != models.CircuitOpen
+	observeCircuitState(status.URL, breaker.state)
+
+	event := log.Info()
+	reason := circuitReasonRecovered
+	switch breaker.state {
+	case models.CircuitOpen:
+		event = log.Warn().Err(err).Int("consecutive_failures", breaker.consecutive)
+		reason = breaker.reason
+	case models.CircuitHalfOpen:
+		reason = circuitReasonProbe
+	case models.CircuitClosed:
+	}
+	event.
+		Str("backend", status.URL).
+		Str("from", string(before)).
+		Str("to", string(breaker.state)).
+		Str("reason", reason).
+		Msg("Backend circuit changed state")
+	circuitTransitionsTotal.WithLabelValues(status.URL, string(breaker.state), reason).Inc()
+
+	if wasOnline != status.Online {
+		observeBackendState(status.URL, status.Online, reason)
+	}
+}
+
+// statusOf returns a copy of the status of a backend with the current state of its circuit
+// breaker. bm.mu must be held.
+func (bm *BackendManager) statusOf(status *models.BackendStatus, now time.Time) models.BackendStatus {
+	health := bm.health[status.URL]
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	statusCopy := *status
+	statusCopy.ConsecFails = health.breaker.consecutive
+	statusCopy.Circuit = health.breaker.status(now)
+	return statusCopy
 }
 
 // GetOnlineBackends returns a list of online backend URLs sorted by available space (descending).
@@ -143,38 +332,65 @@ func (bm *BackendManager) GetOnlineBackends() []string {
 // GetBackendForUpload returns the best backend for uploading a file of the given size.
 // It returns the online backend with the most available space that can fit the file.
 func (bm *BackendManager) GetBackendForUpload(fileSize int64) (string, error) {
-	bm.mu.RLock()
-	defer bm.mu.RUnlock()
+	backends, err := bm.GetBackendsForUpload(fileSize, 1)
+	if err != nil {
+		return "", err
+	}
+	return backends[0], nil
+}
 
-	var bestBackend string
-	var maxAvailable uint64
+// GetBackendsForUpload returns up to count distinct backends that can store a file of the given
+// size, ordered by available space, most first.
+func (bm *BackendManager) GetBackendsForUpload(fileSize int64, count int) ([]string, error) {
+	return bm.GetBackendsWithPolicy(PlacementPolicyFunc(selectMostFree), fileSize, count)
+}
 
-	for url, status := range bm.backends {
-		if !status.Online {
-			continue
+// GetBackendsWithPolicy returns up to count distinct backends that can store a file of the
+// given size, chosen and ordered by policy. The policy runs on a copy of the backend states.
+func (bm *BackendManager) GetBackendsWithPolicy(policy PlacementPolicy, fileSize int64, count int) ([]string, error) {
+	bm.mu.RLock()
+	candidates := make([]models.BackendStatus, 0, len(bm.backends))
+	for _, status := range bm.backends {
+		if acceptsUpload(status, fileSize) {
+			candidates = append(candidates, *status)
 		}
+	}
+	bm.mu.RUnlock()
 
-		// Check if file will fit
-		if fileSize > 0 && status.AvailableSpace < uint64(fileSize) {
-			log.Debug().
-				Str("backend", url).
-				Int64("file_size", fileSize).
-				Uint64("available", status.AvailableSpace).
-				Msg("Backend does not have enough space")
-			continue
-		}
+	if len(candidates) == 0 {
+		return nil, ErrNoBackendAvailable
+	}
 
-		if status.AvailableSpace > maxAvailable {
-			maxAvailable = status.AvailableSpace
-			bestBackend = url
-		}
+	backends := policy.Select(candidates, count)
+	if len(backends) == 0 {
+		return nil, ErrNoBackendAvailable
+	}
+	return backends, nil
+}
+
+// acceptsUpload reports whether the backend can take a new file of the given size.
+func acceptsUpload(status *models.BackendStatus, fileSize int64) bool {
+	if !status.Online || status.Draining {
+		return false
 	}
 
-	if bestBackend == "" {
-		return "", ErrNoBackendAvailable
+	if status.NodeInfo != nil && !status.NodeInfo.AcceptsUploads() {
+		log.Debug().Str("backend", status.URL).Str("mode", string(status.NodeInfo.Mode)).Msg("Backend does not accept uploads")
+		return false
 	}
 
-	return bestBackend, nil
+	// Check if file will fit
+	if fileSize > 0 && status.AvailableSpace < uint64(fileSize) {
+		log.Debug().
+			Str("backend", status.URL).
+			Int64("file_size", fileSize).
+			Uint64("available", status.AvailableSpace).
+			Msg("Backend does not have enough space")
+		return false
+	}
+
+	// Backends that have not reported any free space yet are not written to
+	return status.AvailableSpace > 0
 }
 
 // GetAllBackendStatus returns status information for all backends.
@@ -182,9 +398,10 @@ func (bm *BackendManager) GetAllBackendStatus() []models.BackendStatus {
 	bm.mu.RLock()
 	defer bm.mu.RUnlock()
 
+	now := time.Now()
 	statuses := make([]models.BackendStatus, 0, len(bm.backends))
 	for _, status := range bm.backends {
-		statuses = append(statuses, *status)
+		statuses = append(statuses, bm.statusOf(status, now))
 	}
 
 	return statuses
@@ -201,7 +418,7 @@ func (bm *BackendManager) GetBackendStatus(backendURL string) (*models.BackendSt
 	}
 
 	// Return a copy to avoid race conditions
-	statusCopy := *status
+	statusCopy := bm.statusOf(status, time.Now())
 	return &statusCopy, true
 }
 
@@ -274,61 +491,108 @@ func (bm *BackendManager) checkAllBackends() {
 	waitGroup.Wait()
 }
 
-// checkBackend performs a health check on a single backend.
+// checkBackend performs a health check on a single backend. Backends with an open circuit
+// are only probed once their cool-down has passed. The node info is fetched with the probe
+// when it is older than the node info interval.
 func (bm *BackendManager) checkBackend(backendURL string) {
+	bm.mu.Lock()
+	status, exists := bm.backends[backendURL]
+	if !exists {
+		bm.mu.Unlock()
+		return
+	}
+	health := bm.health[backendURL]
+	if !health.breaker.probeDue(time.Now()) {
+		bm.mu.Unlock()
+		return
+	}
+	refresh := status.NodeInfo == nil || health.noHealthz || time.Since(health.nodeInfoAt) >= bm.nodeInfoInterval
+	bm.mu.Unlock()
+
 	ctx, cancel := context.WithTimeout(context.Background(), bm.healthCheckTimeout)
 	defer cancel()
 
 	start := time.Now()
-	nodeInfo, err := bm.fetchNodeInfo(ctx, backendURL)
+	nodeInfo, noHealthz, err := bm.probe(ctx, backendURL, refresh)
 	latency := time.Since(start)
 
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
 
-	status, exists := bm.backends[backendURL]
-	if !exists {
+	// The backend may have been removed, and added again, while it was probed
+	if status, exists = bm.backends[backendURL]; !exists || bm.health[backendURL] != health {
 		return
 	}
 
-	status.LastCheck = time.Now()
+	now := time.Now()
+	status.LastCheck = now
 	status.Latency = latency.Milliseconds()
+	health.noHealthz = noHealthz
 
 	if err != nil {
 		status.LastError = err.Error()
-
-		// Only increment failure count for timeout/connection errors, not HTTP errors
-		// HTTP errors (404, 500, etc.) mean the backend is reachable but returned an error
-		if isTimeoutOrConnectionError(err) {
-			status.ConsecFails++
-			if status.ConsecFails >= maxConsecutiveFailures {
-				if status.Online {
-					log.Warn().
-						Str("backend", backendURL).
-						Int("consecutive_failures", status.ConsecFails).
-						Err(err).
-						Msg("Backend marked offline")
-				}
-				status.Online = false
-			}
-		}
+		bm.updateCircuitLocked(status, now, err, func(breaker *circuitBreaker) {
+			breaker.probe(now, true)
+		})
 		return
 	}
 
-	// Success - reset failure count and update info
-	wasOffline := !status.Online
-	status.Online = true
-	status.ConsecFails = 0
 	status.LastError = ""
-	status.NodeInfo = nodeInfo
-	status.AvailableSpace = nodeInfo.Storage.Available
+	if nodeInfo != nil {
+		health.nodeInfoAt = now
+		status.NodeInfo = nodeInfo
+		// Space already reserved by in-flight uploads on the node is not available to new ones
+		status.AvailableSpace = nodeInfo.Storage.Available
+		if nodeInfo.Uploads.ReservedBytes >= status.AvailableSpace {
+			status.AvailableSpace = 0
+		} else {
+			status.AvailableSpace -= nodeInfo.Uploads.ReservedBytes
+		}
+	}
+	bm.updateCircuitLocked(status, now, nil, func(breaker *circuitBreaker) {
+		breaker.probe(now, false)
+	})
+}
+
+// probe checks a backend with its /healthz endpoint and fetches its node info if refresh is
+// set. Backends answering /healthz with 404 predate it and are probed with /node/info,
+// reported by noHealthz.
+func (bm *BackendManager) probe(ctx context.Context, backendURL string, refresh bool) (nodeInfo *models.NodeInfo, noHealthz bool, err error) {
+	err = bm.fetchHealthz(ctx, backendURL)
+	var backendErr *BackendError
+	if errors.As(err, &backendErr) && backendErr.StatusCode == http.StatusNotFound {
+		noHealthz, refresh, err = true, true, nil
+	}
+	if err != nil || !refresh {
+		return nil, noHealthz, err
+	}
 
-	if wasOffline {
-		log.Info().
-			Str("backend", backendURL).
-			Int64("latency_ms", status.Latency).
-			Msg("Backend back online")
+	nodeInfo, err = bm.fetchNodeInfo(ctx, backendURL)
+	return nodeInfo, noHealthz, err
+}
+
+// fetchHealthz probes the /healthz endpoint of a backend.
+func (bm *BackendManager) fetchHealthz(ctx context.Context, backendURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, backendURL+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := bm.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("Failed to close health check response body")
+		}
+	}()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return &BackendError{StatusCode: resp.StatusCode}
 	}
+	return nil
 }
 
 // fetchNodeInfo fetches node information from a backend.
@@ -379,6 +643,9 @@ func CreateRetryableClient(retryMax int, retryWaitMin, retryWaitMax time.Duratio
 	// Custom retry policy: only retry on connection/timeout errors, not HTTP errors
 	// This ensures we forward backend error responses instead of retrying them
 	client.CheckRetry = customRetryPolicy
+	// Propagate the trace of the incoming request to the backend
+	client.HTTPClient.Transport = tracing.Transport(log.Transport(client.HTTPClient.Transport))
+	instrumentClient(client)
 	return client
 }
 
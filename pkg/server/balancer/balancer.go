@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
@@ -11,20 +12,94 @@ import (
 
 // Balancer manages multiple CAS server backends.
 type Balancer struct {
-	backendManager *BackendManager
-	client         *retryablehttp.Client
-	requestTimeout time.Duration
+	backendManager    *BackendManager
+	client            *retryablehttp.Client
+	requestTimeout    atomic.Int64    // Nanoseconds, changed at runtime by SetRequestTimeout
+	replicationFactor int             // Backends each upload is written to
+	writeQuorum       int             // Backends that must store an upload for it to succeed
+	repairQueue       RepairQueue     // Receives under-replicated uploads, nil only logs them
+	placement         string          // PlacementBroadcast or PlacementRendezvous
+	uploadPolicy      PlacementPolicy // Chooses upload backends with broadcast placement
+	locations         *LocationCache  // Backends known to store each hash, nil disables the cache
+	hedgePercentile   float64         // Download latency percentile after which to hedge, 0 disables
+	downloadLatency   *latencyWindow  // Recent times until a backend returned download headers
 }
 
 // NewBalancer creates a new load balancer instance.
 func NewBalancer(backendManager *BackendManager, retryMax int, retryWaitMin, retryWaitMax, requestTimeout time.Duration) *Balancer {
 	client := CreateRetryableClient(retryMax, retryWaitMin, retryWaitMax)
+	// Every attempt, including retries, is recorded by the circuit breaker of its backend
+	client.HTTPClient.Transport = &breakerTransport{next: client.HTTPClient.Transport, manager: backendManager}
+
+	balancer := &Balancer{
+		backendManager:    backendManager,
+		client:            client,
+		replicationFactor: 1,
+		writeQuorum:       1,
+		placement:         PlacementBroadcast,
+		uploadPolicy:      PlacementPolicyFunc(selectMostFree),
+		hedgePercentile:   DefaultHedgePercentile,
+		downloadLatency:   &latencyWindow{},
+	}
+	balancer.SetRequestTimeout(requestTimeout)
+	return balancer
+}
+
+// SetAdmission limits the requests sent to each backend at once with admission. Time spent
+// waiting for a slot is not seen by the circuit breakers.
+func (b *Balancer) SetAdmission(admission *Admission) {
+	b.client.HTTPClient.Transport = &admissionTransport{next: b.client.HTTPClient.Transport, admission: admission}
+}
+
+// SetRequestTimeout sets the timeout of each backend request. It can be changed while
+// serving; requests already sent keep their timeout.
+func (b *Balancer) SetRequestTimeout(timeout time.Duration) {
+	b.requestTimeout.Store(int64(timeout))
+}
+
+// RequestTimeout returns the timeout of each backend request.
+func (b *Balancer) RequestTimeout() time.Duration {
+	return time.Duration(b.requestTimeout.Load())
+}
+
+// SetReplication configures how many backends each upload is written to and how many of
+// them must store it for the upload to succeed. A quorum of zero means a majority.
+func (b *Balancer) SetReplication(factor, quorum int) {
+	if factor < 1 {
+		factor = 1
+	}
+	if quorum <= 0 {
+		quorum = factor/2 + 1
+	}
+	b.replicationFactor = factor
+	b.writeQuorum = min(quorum, factor)
+}
+
+// SetRepairQueue sets the queue that records uploads stored on fewer backends than the
+// replication factor.
+func (b *Balancer) SetRepairQueue(queue RepairQueue) {
+	b.repairQueue = queue
+}
+
+// SetPlacement selects how uploads are placed and reads are routed: PlacementBroadcast or
+// PlacementRendezvous.
+func (b *Balancer) SetPlacement(mode string) error {
+	if err := validatePlacement(mode); err != nil {
+		return err
+	}
+	b.placement = mode
+	return nil
+}
 
-	return &Balancer{
-		backendManager: backendManager,
-		client:         client,
-		requestTimeout: requestTimeout,
+// SetUploadPolicy selects the registered placement policy choosing the backends of uploads
+// with broadcast placement. Buckets can select their own.
+func (b *Balancer) SetUploadPolicy(name string) error {
+	policy, err := LookupPlacementPolicy(name)
+	if err != nil {
+		return err
 	}
+	b.uploadPolicy = policy
+	return nil
 }
 
 // BackendManager returns the backend manager for this balancer.
@@ -47,8 +122,10 @@ type BackendRequestFunc[T any] func(ctx context.Context, backend string) (T, int
 // executeBackendRequests executes requests across specified backends in parallel using waitgroups.
 // It returns a channel that will be closed when all requests complete.
 // If cancelOnSuccess is true, other requests will be cancelled when the first successful response is received.
+// requestFunc must have read the response body before it returns, as all request contexts are
+// cancelled once the requests complete; streaming downloads use hedgedRequest instead.
 //
-//nolint:govet,cyclop // cancel is intentionally not called on all paths to avoid canceling streaming downloads
+//nolint:cyclop // parallel requests with early cancellation
 func executeBackendRequests[T any](
 	ctx context.Context,
 	backends []string,
@@ -57,6 +134,7 @@ func executeBackendRequests[T any](
 	cancelOnSuccess bool,
 ) <-chan RequestResult[T] {
 	results := make(chan RequestResult[T], len(backends))
+	fanoutBackends.Observe(float64(len(backends)))
 
 	if len(backends) == 0 {
 		close(results)
@@ -104,14 +182,11 @@ func executeBackendRequests[T any](
 		}(backend)
 	}
 
-	// Close channel when all goroutines complete
+	// Close channel and release the request contexts when all goroutines complete
 	go func() {
 		waitGroup.Wait()
 		close(results)
-		// Note: We intentionally don't call cancel() here because handlers may still
-		// be using the response (e.g., streaming download response body). The context
-		// will be cleaned up when the parent HTTP request context is done.
-		// Individual handlers are responsible for calling their reqCancel functions.
+		cancel()
 	}()
 
 	return results
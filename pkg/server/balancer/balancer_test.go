@@ -112,7 +112,7 @@ func (s *BalancerTestSuite) TestNewBalancer() {
 
 	s.NotNil(balancer)
 	s.Equal(bm, balancer.backendManager)
-	s.Equal(requestTimeout, balancer.requestTimeout)
+	s.Equal(requestTimeout, balancer.RequestTimeout())
 	s.NotNil(balancer.client)
 }
 
@@ -191,6 +191,93 @@ func (s *BalancerTestSuite) TestBackendManagerMultipleBackends() {
 	s.Equal(s.mockServer.URL, backend)
 }
 
+// TestBackendManagerGetBackendsForUpload tests that replicas are chosen by available space
+func (s *BalancerTestSuite) TestBackendManagerGetBackendsForUpload() {
+	smallServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/node/info") {
+			nodeInfo := models.NodeInfo{Storage: models.StorageInfo{Available: 5000}}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(nodeInfo)
+		}
+	}))
+	defer smallServer.Close()
+
+	bm := NewBackendManager([]string{smallServer.URL, s.mockServer.URL}, 100*time.Millisecond, 5*time.Second)
+	bm.Start()
+	defer bm.Stop()
+
+	time.Sleep(200 * time.Millisecond)
+
+	backends, err := bm.GetBackendsForUpload(1024, 3)
+	s.NoError(err)
+	s.Equal([]string{s.mockServer.URL, smallServer.URL}, backends)
+
+	backends, err = bm.GetBackendsForUpload(1024, 1)
+	s.NoError(err)
+	s.Equal([]string{s.mockServer.URL}, backends)
+
+	// Backends without room for the file are not replicas
+	backends, err = bm.GetBackendsForUpload(10000, 3)
+	s.NoError(err)
+	s.Equal([]string{s.mockServer.URL}, backends)
+}
+
+// TestBackendManagerReservedSpace tests that space reserved by in-flight uploads is not offered to new uploads
+func (s *BalancerTestSuite) TestBackendManagerReservedSpace() {
+	reservedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/node/info") {
+			nodeInfo := models.NodeInfo{
+				Storage: models.StorageInfo{Available: 10000},
+				Uploads: models.UploadInfo{ReservedBytes: 9000, ActiveReservations: 3},
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(nodeInfo)
+		}
+	}))
+	defer reservedServer.Close()
+
+	bm := NewBackendManager([]string{reservedServer.URL}, 100*time.Millisecond, 5*time.Second)
+	bm.Start()
+	defer bm.Stop()
+
+	time.Sleep(200 * time.Millisecond)
+
+	backend, err := bm.GetBackendForUpload(500)
+	s.NoError(err)
+	s.Equal(reservedServer.URL, backend)
+
+	_, err = bm.GetBackendForUpload(2000)
+	s.ErrorIs(err, ErrNoBackendAvailable)
+}
+
+// TestBackendManagerSkipsDrainingBackend tests that backends not accepting writes are skipped for uploads
+func (s *BalancerTestSuite) TestBackendManagerSkipsDrainingBackend() {
+	drainingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/node/info") {
+			nodeInfo := models.NodeInfo{
+				Storage: models.StorageInfo{Available: 1000000000000},
+				Mode:    models.NodeModeDraining,
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(nodeInfo)
+		}
+	}))
+	defer drainingServer.Close()
+
+	bm := NewBackendManager([]string{drainingServer.URL, s.mockServer.URL}, 100*time.Millisecond, 5*time.Second)
+	bm.Start()
+	defer bm.Stop()
+
+	time.Sleep(200 * time.Millisecond)
+
+	backend, err := bm.GetBackendForUpload(1024)
+	s.NoError(err)
+	s.Equal(s.mockServer.URL, backend)
+
+	// Draining backends keep serving reads
+	s.Contains(bm.GetOnlineBackends(), drainingServer.URL)
+}
+
 // TestBackendManagerWithTimeout tests backend selection with timeout
 func (s *BalancerTestSuite) TestBackendManagerWithTimeout() {
 	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,311 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"loopfs/pkg/models"
+)
+
+// Default circuit breaker settings.
+const (
+	DefaultBreakerWindow              = 30 * time.Second
+	DefaultBreakerMinRequests         = 20
+	DefaultBreakerErrorRate           = 0.5
+	DefaultBreakerSlowThreshold       = 10 * time.Second
+	DefaultBreakerConsecutiveFailures = 3
+	DefaultBreakerOpenTimeout         = 10 * time.Second
+	DefaultBreakerHalfOpenSuccesses   = 2
+)
+
+// breakerBuckets is the number of buckets the error rate window is split into.
+const breakerBuckets = 10
+
+// Reasons a circuit changes state, used in logs, metrics and the backend status.
+const (
+	circuitReasonConsecutive = "consecutive_failures"
+	circuitReasonErrorRate   = "error_rate"
+	circuitReasonHalfOpen    = "half_open_failure"
+	circuitReasonForced      = "request_failure"
+	circuitReasonAdded       = "added"
+	circuitReasonProbe       = "probe"
+	circuitReasonRecovered   = "recovered"
+)
+
+// BreakerConfig configures the circuit breakers guarding the backends. Every request the
+// balancer sends to a backend and every health check probe is recorded by the breaker of
+// the backend.
+type BreakerConfig struct {
+	// Window is the sliding window the error rate is computed over.
+	Window time.Duration
+	// MinRequests is the number of requests in the window before the error rate can open
+	// the circuit.
+	MinRequests int
+	// ErrorRate is the share of failed requests in the window, from 0 to 1, that opens the
+	// circuit.
+	ErrorRate float64
+	// SlowThreshold counts requests without a body whose response headers take longer as
+	// failed. Zero disables it.
+	SlowThreshold time.Duration
+	// ConsecutiveFailures opens the circuit after this many failed requests in a row.
+	ConsecutiveFailures int
+	// OpenTimeout is how long an open circuit waits before the backend is probed again.
+	OpenTimeout time.Duration
+	// HalfOpenSuccesses is the number of successful requests that close a half-open circuit.
+	HalfOpenSuccesses int
+}
+
+// DefaultBreakerConfig returns the default circuit breaker settings.
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		Window:              DefaultBreakerWindow,
+		MinRequests:         DefaultBreakerMinRequests,
+		ErrorRate:           DefaultBreakerErrorRate,
+		SlowThreshold:       DefaultBreakerSlowThreshold,
+		ConsecutiveFailures: DefaultBreakerConsecutiveFailures,
+		OpenTimeout:         DefaultBreakerOpenTimeout,
+		HalfOpenSuccesses:   DefaultBreakerHalfOpenSuccesses,
+	}
+}
+
+// withDefaults replaces unset settings with their defaults.
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	defaults := DefaultBreakerConfig()
+	if c.Window <= 0 {
+		c.Window = defaults.Window
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = defaults.MinRequests
+	}
+	if c.ErrorRate <= 0 || c.ErrorRate > 1 {
+		c.ErrorRate = defaults.ErrorRate
+	}
+	if c.SlowThreshold < 0 {
+		c.SlowThreshold = 0
+	}
+	if c.ConsecutiveFailures <= 0 {
+		c.ConsecutiveFailures = defaults.ConsecutiveFailures
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = defaults.OpenTimeout
+	}
+	if c.HalfOpenSuccesses <= 0 {
+		c.HalfOpenSuccesses = defaults.HalfOpenSuccesses
+	}
+	return c
+}
+
+// requestFailed classifies a backend request for the circuit breaker. counted is false for
+// requests canceled by the balancer, such as the losers of a hedged download, which say
+// nothing about the backend.
+func (c BreakerConfig) requestFailed(req *http.Request, resp *http.Response, err error, elapsed time.Duration) (counted, failed bool) {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false, false
+		}
+		return true, true
+	}
+	if isServerFailure(resp.StatusCode) {
+		return true, true
+	}
+	// Uploads take as long as their body, so only requests without one can be slow
+	slow := c.SlowThreshold > 0 && elapsed > c.SlowThreshold && (req.Body == nil || req.Body == http.NoBody)
+	return true, slow
+}
+
+// isServerFailure reports whether a status code means the backend failed. 503 is not a
+// failure: casd answers with it when its mode or free space rejects a request, which it
+// does while healthy. 501 and 507 are answers about the request, not the backend.
+func isServerFailure(code int) bool {
+	switch code {
+	case http.StatusNotImplemented, http.StatusServiceUnavailable, http.StatusInsufficientStorage:
+		return false
+	default:
+		return code >= http.StatusInternalServerError
+	}
+}
+
+// breakerBucket counts the requests of one slice of the error rate window.
+type breakerBucket struct {
+	start    int64 // Unix nanoseconds the bucket started
+	requests int
+	failures int
+}
+
+// circuitBreaker is the state machine guarding one backend. It is not safe for concurrent
+// use; the backend manager guards it with the lock of the backend's health state.
+type circuitBreaker struct {
+	config      BreakerConfig
+	state       models.CircuitState
+	buckets     [breakerBuckets]breakerBucket
+	consecutive int // Failed requests in a row
+	successes   int // Successful requests since the circuit half-opened
+	trips       int
+	reason      string
+	openedAt    time.Time
+	retryAt     time.Time
+}
+
+// newCircuitBreaker returns a breaker in the given state. An open breaker created this way
+// is probed right away.
+func newCircuitBreaker(config BreakerConfig, state models.CircuitState, reason string) *circuitBreaker {
+	return &circuitBreaker{config: config, state: state, reason: reason}
+}
+
+// bucket returns the window bucket now falls into, resetting it if it holds an older slice.
+func (cb *circuitBreaker) bucket(now time.Time) *breakerBucket {
+	width := max(int64(cb.config.Window)/breakerBuckets, 1)
+	start := now.UnixNano() / width * width
+	bucket := &cb.buckets[(start/width)%breakerBuckets]
+	if bucket.start != start {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+// counts returns the requests and failures in the window ending at now.
+func (cb *circuitBreaker) counts(now time.Time) (requests, failures int) {
+	oldest := now.UnixNano() - int64(cb.config.Window)
+	for _, bucket := range cb.buckets {
+		if bucket.start > oldest {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return requests, failures
+}
+
+// record counts a request. A failure opens a half-open circuit, and a closed one once too
+// many requests failed in a row or in the window. Enough successes close a half-open circuit.
+func (cb *circuitBreaker) record(now time.Time, failed bool) {
+	bucket := cb.bucket(now)
+	bucket.requests++
+
+	if !failed {
+		cb.consecutive = 0
+		if cb.state == models.CircuitHalfOpen {
+			cb.successes++
+			if cb.successes >= cb.config.HalfOpenSuccesses {
+				cb.close()
+			}
+		}
+		return
+	}
+
+	bucket.failures++
+	cb.consecutive++
+	switch cb.state {
+	case models.CircuitHalfOpen:
+		cb.open(now, circuitReasonHalfOpen)
+	case models.CircuitClosed:
+		if cb.consecutive >= cb.config.ConsecutiveFailures {
+			cb.open(now, circuitReasonConsecutive)
+			return
+		}
+		requests, failures := cb.counts(now)
+		if requests >= cb.config.MinRequests && float64(failures) >= cb.config.ErrorRate*float64(requests) {
+			cb.open(now, circuitReasonErrorRate)
+		}
+	case models.CircuitOpen:
+		// Requests sent before the circuit opened do not change it
+	}
+}
+
+// probe records a health check. A successful probe of an open circuit half-opens it; a
+// failed one restarts the cool-down.
+func (cb *circuitBreaker) probe(now time.Time, failed bool) {
+	if cb.state != models.CircuitOpen {
+		cb.record(now, failed)
+		return
+	}
+
+	cb.bucket(now).requests++
+	if failed {
+		cb.bucket(now).failures++
+		cb.consecutive++
+		cb.retryAt = now.Add(cb.config.OpenTimeout)
+		return
+	}
+
+	cb.consecutive = 0
+	cb.state = models.CircuitHalfOpen
+	cb.successes = 1
+	if cb.successes >= cb.config.HalfOpenSuccesses {
+		cb.close()
+	}
+}
+
+// probeDue reports whether the backend should be health checked: always unless the circuit
+// is open and cooling down.
+func (cb *circuitBreaker) probeDue(now time.Time) bool {
+	return cb.state != models.CircuitOpen || !now.Before(cb.retryAt)
+}
+
+// open opens the circuit and schedules the next probe.
+func (cb *circuitBreaker) open(now time.Time, reason string) {
+	if cb.state != models.CircuitOpen {
+		cb.trips++
+		cb.openedAt = now
+	}
+	cb.state = models.CircuitOpen
+	cb.reason = reason
+	cb.successes = 0
+	cb.retryAt = now.Add(cb.config.OpenTimeout)
+}
+
+// close closes the circuit and forgets the failures that opened it.
+func (cb *circuitBreaker) close() {
+	cb.state = models.CircuitClosed
+	cb.buckets = [breakerBuckets]breakerBucket{}
+	cb.consecutive = 0
+	cb.successes = 0
+	cb.openedAt = time.Time{}
+	cb.retryAt = time.Time{}
+}
+
+// status describes the breaker at now.
+func (cb *circuitBreaker) status(now time.Time) models.CircuitStatus {
+	requests, failures := cb.counts(now)
+	status := models.CircuitStatus{
+		State:    cb.state,
+		Requests: requests,
+		Failures: failures,
+		Trips:    cb.trips,
+		Reason:   cb.reason,
+	}
+	if requests > 0 {
+		status.ErrorRate = float64(failures) / float64(requests)
+	}
+	if !cb.openedAt.IsZero() {
+		openedAt := cb.openedAt
+		status.OpenedAt = &openedAt
+	}
+	if cb.state == models.CircuitOpen && !cb.retryAt.IsZero() {
+		retryAt := cb.retryAt
+		status.RetryAt = &retryAt
+	}
+	return status
+}
+
+// breakerTransport records the outcome of every backend request with the backend's circuit
+// breaker.
+type breakerTransport struct {
+	next    http.RoundTripper
+	manager *BackendManager
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	// Failures caused by canceling the request, such as a failed read of an upload body
+	// whose client went away, are marked as such so they are not held against the backend
+	if err != nil && !errors.Is(err, context.Canceled) && errors.Is(req.Context().Err(), context.Canceled) {
+		err = fmt.Errorf("%w: %w", context.Canceled, err)
+	}
+	t.manager.RecordRequest(req, resp, err, time.Since(start))
+	return resp, err
+}
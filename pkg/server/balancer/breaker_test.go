@@ -0,0 +1,349 @@
+package balancer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// BreakerTestSuite tests the backend circuit breakers and health probes
+type BreakerTestSuite struct {
+	suite.Suite
+}
+
+// testBreakerConfig returns a breaker configuration with small thresholds
+func testBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		Window:              time.Minute,
+		MinRequests:         4,
+		ErrorRate:           0.5,
+		SlowThreshold:       time.Second,
+		ConsecutiveFailures: 3,
+		OpenTimeout:         time.Minute,
+		HalfOpenSuccesses:   2,
+	}
+}
+
+// roundTripFunc adapts a function to an http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TestConsecutiveFailures tests that failures in a row open the circuit and a success resets them
+func (s *BreakerTestSuite) TestConsecutiveFailures() {
+	now := time.Now()
+	config := testBreakerConfig()
+	config.MinRequests = 100
+	cb := newCircuitBreaker(config, models.CircuitClosed, "")
+
+	cb.record(now, true)
+	cb.record(now, true)
+	cb.record(now, false)
+	cb.record(now, true)
+	s.Equal(models.CircuitClosed, cb.state)
+
+	cb.record(now, true)
+	cb.record(now, true)
+	s.Equal(models.CircuitOpen, cb.state)
+	s.Equal(circuitReasonConsecutive, cb.reason)
+	s.Equal(1, cb.trips)
+}
+
+// TestErrorRate tests that the error rate opens the circuit once enough requests were seen
+func (s *BreakerTestSuite) TestErrorRate() {
+	now := time.Now()
+	config := testBreakerConfig()
+	config.ConsecutiveFailures = 100
+	cb := newCircuitBreaker(config, models.CircuitClosed, "")
+
+	cb.record(now, true)
+	cb.record(now, true)
+	s.Equal(models.CircuitClosed, cb.state, "below the minimum number of requests")
+
+	cb.record(now, false)
+	cb.record(now, true)
+	s.Equal(models.CircuitOpen, cb.state)
+	s.Equal(circuitReasonErrorRate, cb.reason)
+
+	status := cb.status(now)
+	s.Equal(4, status.Requests)
+	s.Equal(3, status.Failures)
+	s.InDelta(0.75, status.ErrorRate, 1e-9)
+	s.Require().NotNil(status.RetryAt)
+	s.Equal(now.Add(config.OpenTimeout), *status.RetryAt)
+}
+
+// TestWindowExpires tests that failures older than the window are forgotten
+func (s *BreakerTestSuite) TestWindowExpires() {
+	now := time.Now()
+	config := testBreakerConfig()
+	config.ConsecutiveFailures = 100
+	cb := newCircuitBreaker(config, models.CircuitClosed, "")
+
+	for range 3 {
+		cb.record(now, true)
+	}
+	later := now.Add(config.Window + time.Second)
+	requests, failures := cb.counts(later)
+	s.Zero(requests)
+	s.Zero(failures)
+
+	cb.record(later, true)
+	s.Equal(models.CircuitClosed, cb.state)
+}
+
+// TestHalfOpen tests probing an open circuit, closing it after successes and reopening it on failure
+func (s *BreakerTestSuite) TestHalfOpen() {
+	now := time.Now()
+	config := testBreakerConfig()
+	cb := newCircuitBreaker(config, models.CircuitClosed, "")
+	cb.open(now, circuitReasonForced)
+
+	s.False(cb.probeDue(now.Add(config.OpenTimeout / 2)))
+	now = now.Add(config.OpenTimeout)
+	s.True(cb.probeDue(now))
+
+	// A failed probe restarts the cool-down
+	cb.probe(now, true)
+	s.Equal(models.CircuitOpen, cb.state)
+	s.False(cb.probeDue(now.Add(time.Second)))
+
+	now = now.Add(config.OpenTimeout)
+	cb.probe(now, false)
+	s.Equal(models.CircuitHalfOpen, cb.state)
+
+	// Any failure while half-open opens the circuit again
+	cb.record(now, true)
+	s.Equal(models.CircuitOpen, cb.state)
+	s.Equal(circuitReasonHalfOpen, cb.reason)
+	s.Equal(2, cb.trips)
+
+	now = now.Add(config.OpenTimeout)
+	cb.probe(now, false)
+	cb.record(now, false)
+	s.Equal(models.CircuitClosed, cb.state)
+	s.Zero(cb.status(now).Requests, "closing forgets the window")
+	s.Nil(cb.status(now).OpenedAt)
+}
+
+// TestRequestFailed tests which backend responses count as failures
+func (s *BreakerTestSuite) TestRequestFailed() {
+	config := testBreakerConfig()
+	get := httptest.NewRequest(http.MethodGet, "http://backend/file/abc/download", nil)
+	post := httptest.NewRequest(http.MethodPost, "http://backend/file/upload", strings.NewReader("data"))
+	response := func(code int) *http.Response { return &http.Response{StatusCode: code} }
+
+	tests := []struct {
+		name    string
+		req     *http.Request
+		resp    *http.Response
+		err     error
+		elapsed time.Duration
+		counted bool
+		failed  bool
+	}{
+		{"ok", get, response(http.StatusOK), nil, 0, true, false},
+		{"not found", get, response(http.StatusNotFound), nil, 0, true, false},
+		{"internal error", get, response(http.StatusInternalServerError), nil, 0, true, true},
+		{"bad gateway", get, response(http.StatusBadGateway), nil, 0, true, true},
+		{"mode rejection", post, response(http.StatusServiceUnavailable), nil, 0, true, false},
+		{"full", post, response(http.StatusInsufficientStorage), nil, 0, true, false},
+		{"slow read", get, response(http.StatusOK), nil, 2 * time.Second, true, true},
+		{"slow upload", post, response(http.StatusOK), nil, 2 * time.Second, true, false},
+		{"connection refused", get, nil, errors.New("dial tcp: connection refused"), 0, true, true},
+		{"timeout", get, nil, context.DeadlineExceeded, 0, true, true},
+		{"canceled", get, nil, context.Canceled, 0, false, false},
+		{"wrapped canceled", get, nil, fmt.Errorf("upload aborted: %w", context.Canceled), 0, false, false},
+	}
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			counted, failed := config.requestFailed(tt.req, tt.resp, tt.err, tt.elapsed)
+			s.Equal(tt.counted, counted)
+			s.Equal(tt.failed, failed)
+		})
+	}
+}
+
+// TestServerErrorsOpenCircuit tests that 5xx responses to balancer requests take a backend offline
+func (s *BreakerTestSuite) TestServerErrorsOpenCircuit() {
+	var failing atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/node/info":
+			_ = json.NewEncoder(w).Encode(models.NodeInfo{Storage: models.StorageInfo{Available: 1000}})
+		case failing.Load():
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer backend.Close()
+
+	config := testBreakerConfig()
+	config.MinRequests = 100
+	manager := NewBackendManager([]string{backend.URL}, time.Hour, time.Second)
+	manager.SetBreakerConfig(config)
+	manager.Start()
+	defer manager.Stop()
+	balancer := NewBalancer(manager, 0, time.Millisecond, time.Millisecond, time.Second)
+
+	get := func() {
+		resp, err := balancer.client.Get(backend.URL + "/file/abc/info")
+		s.Require().NoError(err)
+		s.Require().NoError(resp.Body.Close())
+	}
+
+	get()
+	failing.Store(true)
+	get()
+	get()
+	s.True(manager.HasOnlineBackends(), "two failures in a row keep the circuit closed")
+
+	get()
+	s.False(manager.HasOnlineBackends())
+	status, ok := manager.GetBackendStatus(backend.URL)
+	s.Require().True(ok)
+	s.Equal(models.CircuitOpen, status.Circuit.State)
+	s.Equal(circuitReasonConsecutive, status.Circuit.Reason)
+	s.Equal(3, status.ConsecFails)
+	s.Contains(status.LastError, "Internal Server Error")
+
+	// The health check leaves the circuit open during its cool-down
+	manager.checkBackend(backend.URL)
+	s.False(manager.HasOnlineBackends())
+}
+
+// TestHealthProbe tests probing /healthz, refreshing node info and falling back for older backends
+func (s *BreakerTestSuite) TestHealthProbe() {
+	var healthz, nodeInfo atomic.Int32
+	var healthzStatus atomic.Int32
+	healthzStatus.Store(http.StatusOK)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			healthz.Add(1)
+			w.WriteHeader(int(healthzStatus.Load()))
+		case "/node/info":
+			nodeInfo.Add(1)
+			_ = json.NewEncoder(w).Encode(models.NodeInfo{Storage: models.StorageInfo{Available: 1000}})
+		}
+	}))
+	defer backend.Close()
+
+	manager := NewBackendManager([]string{backend.URL}, time.Hour, time.Second)
+	manager.SetNodeInfoInterval(time.Hour)
+	manager.checkBackend(backend.URL)
+	manager.checkBackend(backend.URL)
+	s.Equal(int32(2), healthz.Load())
+	s.Equal(int32(1), nodeInfo.Load(), "node info is only fetched when stale")
+
+	status, _ := manager.GetBackendStatus(backend.URL)
+	s.Equal(uint64(1000), status.AvailableSpace)
+
+	// An unhealthy probe counts as a failure
+	healthzStatus.Store(http.StatusServiceUnavailable)
+	for range 3 {
+		manager.checkBackend(backend.URL)
+	}
+	s.False(manager.HasOnlineBackends())
+
+	// Backends without /healthz are probed with /node/info
+	healthzStatus.Store(http.StatusNotFound)
+	manager.mu.Lock()
+	manager.health[backend.URL].breaker.retryAt = time.Now()
+	manager.mu.Unlock()
+	manager.checkBackend(backend.URL)
+	s.True(manager.HasOnlineBackends())
+	s.Equal(int32(2), nodeInfo.Load())
+
+	status, _ = manager.GetBackendStatus(backend.URL)
+	s.Equal(models.CircuitHalfOpen, status.Circuit.State)
+}
+
+// TestAddedBackendStartsOpen tests that a backend added at runtime is offline until probed
+func (s *BreakerTestSuite) TestAddedBackendStartsOpen() {
+	manager := NewBackendManager(nil, time.Hour, time.Second)
+	manager.mu.Lock()
+	manager.addBackendLocked("http://added:8080", models.CircuitOpen)
+	manager.mu.Unlock()
+
+	status, ok := manager.GetBackendStatus("http://added:8080")
+	s.Require().True(ok)
+	s.False(status.Online)
+	s.Equal(models.CircuitOpen, status.Circuit.State)
+	s.Equal(circuitReasonAdded, status.Circuit.Reason)
+	s.Nil(status.Circuit.RetryAt)
+	s.Zero(status.Circuit.Trips)
+}
+
+// TestRecordRequestBackendLookup tests that requests are recorded with the backend whose URL
+// is the longest prefix of theirs
+func (s *BreakerTestSuite) TestRecordRequestBackendLookup() {
+	config := testBreakerConfig()
+	config.ConsecutiveFailures = 1
+	manager := NewBackendManager([]string{"http://node:8080", "http://node:8080/cas"}, time.Hour, time.Second)
+	manager.SetBreakerConfig(config)
+
+	fail := func(requestURL string) {
+		req := httptest.NewRequest(http.MethodGet, requestURL, nil)
+		manager.RecordRequest(req, nil, errors.New("connection reset"), 0)
+	}
+	fail("http://node:8080/cas/file/abc/info?attempt=1")
+	fail("http://other:8080/file/abc/info")
+
+	status, ok := manager.GetBackendStatus("http://node:8080/cas")
+	s.Require().True(ok)
+	s.False(status.Online)
+	s.Equal("connection reset", status.LastError)
+	s.Equal(1, status.ConsecFails)
+
+	status, ok = manager.GetBackendStatus("http://node:8080")
+	s.Require().True(ok)
+	s.True(status.Online)
+	s.Empty(status.LastError)
+}
+
+// TestTransportIgnoresCanceledRequests tests that errors of canceled requests are not held
+// against the backend, even when the transport does not wrap context.Canceled
+func (s *BreakerTestSuite) TestTransportIgnoresCanceledRequests() {
+	config := testBreakerConfig()
+	config.ConsecutiveFailures = 1
+	manager := NewBackendManager([]string{"http://node:8080"}, time.Hour, time.Second)
+	manager.SetBreakerConfig(config)
+	transport := &breakerTransport{
+		next: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("io: read/write on closed pipe")
+		}),
+		manager: manager,
+	}
+
+	ctx, cancel := context.WithCancel(s.T().Context())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "http://node:8080/file/upload", nil).WithContext(ctx)
+	_, err := transport.RoundTrip(req) //nolint:bodyclose // no response on error
+	s.Require().ErrorIs(err, context.Canceled)
+	s.ErrorContains(err, "closed pipe")
+
+	status, ok := manager.GetBackendStatus("http://node:8080")
+	s.Require().True(ok)
+	s.True(status.Online)
+	s.Zero(status.Circuit.Requests)
+}
+
+func TestBreakerSuite(t *testing.T) {
+	suite.Run(t, new(BreakerTestSuite))
+}
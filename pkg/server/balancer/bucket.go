@@ -12,11 +12,11 @@ import (
 
 // BucketHandlers contains handlers for bucket management operations.
 type BucketHandlers struct {
-	store *bucket.Store
+	store bucket.MetadataStore
 }
 
 // NewBucketHandlers creates a new BucketHandlers instance.
-func NewBucketHandlers(store *bucket.Store) *BucketHandlers {
+func NewBucketHandlers(store bucket.MetadataStore) *BucketHandlers {
 	return &BucketHandlers{store: store}
 }
 
@@ -42,8 +42,15 @@ func (h *BucketHandlers) CreateBucketHandler(ctx echo.Context) error {
 		// Ignore binding errors - use defaults
 		opts = bucket.BucketOptions{}
 	}
+	if opts.PlacementPolicy != "" {
+		if _, err := LookupPlacementPolicy(opts.PlacementPolicy); err != nil {
+			return ctx.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+	}
 
-	bucketRecord, err := h.store.CreateBucket(name, ownerID, &opts)
+	bucketRecord, err := h.store.CreateBucket(ctx.Request().Context(), name, ownerID, &opts)
 	if err != nil {
 		if errors.Is(err, bucket.ErrBucketExists) {
 			return ctx.JSON(http.StatusConflict, map[string]string{
@@ -55,6 +62,9 @@ func (h *BucketHandlers) CreateBucketHandler(ctx echo.Context) error {
 				"error": "Invalid bucket name. Must be 3-63 characters, lowercase alphanumeric with hyphens.",
 			})
 		}
+		if isReplicationError(err) {
+			return metadataNotCommitted(ctx, err)
+		}
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to create bucket",
 		})
@@ -69,7 +79,7 @@ func (h *BucketHandlers) GetBucketHandler(ctx echo.Context) error {
 	name := ctx.Param("name")
 	ownerID := getOwnerFromContext(ctx)
 
-	bucketRecord, err := h.store.GetBucket(name)
+	bucketRecord, err := h.store.GetBucket(ctx.Request().Context(), name)
 	if err != nil {
 		if errors.Is(err, bucket.ErrBucketNotFound) {
 			return ctx.JSON(http.StatusNotFound, map[string]string{
@@ -82,7 +92,7 @@ func (h *BucketHandlers) GetBucketHandler(ctx echo.Context) error {
 	}
 
 	// Check access (read access for public buckets or owner)
-	if err := h.store.CheckAccess(name, ownerID); err != nil {
+	if err := h.store.CheckAccess(ctx.Request().Context(), name, ownerID); err != nil {
 		if errors.Is(err, bucket.ErrAccessDenied) {
 			return ctx.JSON(http.StatusForbidden, map[string]string{
 				"error": "Access denied",
@@ -100,7 +110,7 @@ func (h *BucketHandlers) DeleteBucketHandler(ctx echo.Context) error {
 	ownerID := getOwnerFromContext(ctx)
 
 	// Verify ownership
-	bucketRecord, err := h.store.GetBucket(name)
+	bucketRecord, err := h.store.GetBucket(ctx.Request().Context(), name)
 	if err != nil {
 		if errors.Is(err, bucket.ErrBucketNotFound) {
 			return ctx.JSON(http.StatusNotFound, map[string]string{
@@ -118,13 +128,16 @@ func (h *BucketHandlers) DeleteBucketHandler(ctx echo.Context) error {
 		})
 	}
 
-	err = h.store.DeleteBucket(name)
+	err = h.store.DeleteBucket(ctx.Request().Context(), name)
 	if err != nil {
 		if errors.Is(err, bucket.ErrBucketNotEmpty) {
 			return ctx.JSON(http.StatusConflict, map[string]string{
 				"error": "Bucket is not empty. Delete all objects first.",
 			})
 		}
+		if isReplicationError(err) {
+			return metadataNotCommitted(ctx, err)
+		}
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to delete bucket",
 		})
@@ -141,7 +154,7 @@ func (h *BucketHandlers) DeleteBucketHandler(ctx echo.Context) error {
 func (h *BucketHandlers) ListBucketsHandler(ctx echo.Context) error {
 	ownerID := getOwnerFromContext(ctx)
 
-	buckets, err := h.store.ListBuckets(ownerID)
+	buckets, err := h.store.ListBuckets(ctx.Request().Context(), ownerID)
 	if err != nil {
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to list buckets",
@@ -1,8 +1,6 @@
 package balancer
 
 import (
-	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -15,19 +13,18 @@ import (
 	"loopfs/pkg/log"
 	"loopfs/pkg/models"
 
-	"github.com/hashicorp/go-retryablehttp"
 	"github.com/labstack/echo/v4"
 )
 
 // ObjectHandlers contains handlers for bucket object operations.
 type ObjectHandlers struct {
-	bucketStore    *bucket.Store
+	bucketStore    bucket.MetadataStore
 	balancer       *Balancer
 	requestTimeout time.Duration
 }
 
 // NewObjectHandlers creates a new ObjectHandlers instance.
-func NewObjectHandlers(bucketStore *bucket.Store, balancer *Balancer, requestTimeout time.Duration) *ObjectHandlers {
+func NewObjectHandlers(bucketStore bucket.MetadataStore, balancer *Balancer, requestTimeout time.Duration) *ObjectHandlers {
 	return &ObjectHandlers{
 		bucketStore:    bucketStore,
 		balancer:       balancer,
@@ -42,7 +39,7 @@ func (h *ObjectHandlers) BucketUploadHandler(ctx echo.Context) error {
 	ownerID := getOwnerFromContext(ctx)
 
 	// Verify bucket exists and user has write access
-	bucketRecord, err := h.bucketStore.GetBucket(bucketName)
+	bucketRecord, err := h.bucketStore.GetBucket(ctx.Request().Context(), bucketName)
 	if err != nil {
 		if errors.Is(err, bucket.ErrBucketNotFound) {
 			return ctx.JSON(http.StatusNotFound, map[string]string{
@@ -82,18 +79,23 @@ func (h *ObjectHandlers) BucketUploadHandler(ctx echo.Context) error {
 	}
 
 	// Perform CAS upload
-	hash, size, err := h.performCASUpload(ctx, file)
+	hash, size, err := h.performCASUpload(ctx, file, bucketRecord)
 	if err != nil {
-		log.Error().Err(err).Str("bucket", bucketName).Str("key", key).Msg("CAS upload failed")
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Str("bucket", bucketName).Str("key", key).Msg("CAS upload failed")
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Upload failed: " + err.Error(),
 		})
 	}
 
+	setAuditHash(ctx, hash)
+
 	// Create object record in bucket
-	obj, err := h.bucketStore.PutObject(bucketName, key, hash, size, contentType, nil)
+	obj, err := h.bucketStore.PutObject(ctx.Request().Context(), bucketName, key, hash, size, contentType, nil)
 	if err != nil {
-		log.Error().Err(err).Str("bucket", bucketName).Str("key", key).Msg("Failed to create object record")
+		if isReplicationError(err) {
+			return metadataNotCommitted(ctx, err)
+		}
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Str("bucket", bucketName).Str("key", key).Msg("Failed to create object record")
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to create object record",
 		})
@@ -107,75 +109,49 @@ func (h *ObjectHandlers) BucketUploadHandler(ctx echo.Context) error {
 	})
 }
 
-// performCASUpload forwards the file upload to a CAS backend and returns the hash.
+// bucketPolicy returns the placement policy selected for a bucket, or nil to use the
+// balancer's. A policy that is no longer registered falls back to the balancer's.
+func bucketPolicy(bucketRecord *models.Bucket) PlacementPolicy {
+	if bucketRecord.PlacementPolicy == "" {
+		return nil
+	}
+	policy, err := LookupPlacementPolicy(bucketRecord.PlacementPolicy)
+	if err != nil {
+		log.Warn().Err(err).Str("bucket", bucketRecord.Name).Msg("Using the default placement policy")
+		return nil
+	}
+	return policy
+}
+
+// performCASUpload replicates the file upload to the CAS backends and returns the hash.
 //
 //nolint:cyclop,funcorder // Complex but necessary logic for CAS upload; placed near caller for readability
-func (h *ObjectHandlers) performCASUpload(ctx echo.Context, file *multipart.FileHeader) (string, int64, error) {
+func (h *ObjectHandlers) performCASUpload(
+	ctx echo.Context, file *multipart.FileHeader, bucketRecord *models.Bucket,
+) (string, int64, error) {
 	// Check if any backends are online
 	if !h.balancer.backendManager.HasOnlineBackends() {
 		return "", 0, ErrAllBackendsDown
 	}
 
-	fileSize := file.Size
-
-	// Select backend with most available space
-	backend, err := h.balancer.backendManager.GetBackendForUpload(fileSize)
+	outcome, err := h.balancer.replicatedUpload(ctx.Request().Context(), file, bucketPolicy(bucketRecord))
 	if err != nil {
 		return "", 0, err
 	}
-
-	reqCtx, cancel := context.WithTimeout(ctx.Request().Context(), h.requestTimeout)
-	defer cancel()
-
-	// Prepare streaming multipart request (reuse function from upload.go)
-	boundary := fmt.Sprintf("loopfs-%d", time.Now().UnixNano())
-	uploadBody, contentType, err := createStreamingBody(reqCtx, file, boundary)
-	if err != nil {
-		return "", 0, fmt.Errorf("failed to prepare upload body: %w", err)
-	}
-	defer func() {
-		if closeErr := uploadBody.Close(); closeErr != nil && !errors.Is(closeErr, io.ErrClosedPipe) {
-			log.Warn().Err(closeErr).Msg("Failed to close upload body")
+	if !outcome.quorumReached(h.balancer.writeQuorum) {
+		if len(outcome.stored) == 0 {
+			return "", 0, fmt.Errorf("upload request failed: %s", outcome.failure().replicaError())
 		}
-	}()
-
-	// Create request
-	req, err := retryablehttp.NewRequestWithContext(reqCtx, "POST", backend+"/file/upload", uploadBody)
-	if err != nil {
-		return "", 0, fmt.Errorf("failed to create request: %w", err)
+		return "", 0, fmt.Errorf("%w: stored on %d of %d required backends",
+			ErrWriteQuorumNotReached, len(outcome.stored), h.balancer.writeQuorum)
 	}
-	req.Header.Set("Content-Type", contentType)
-
-	// Execute request
-	resp, err := h.balancer.client.Do(req)
-	if err != nil {
-		if isTimeoutOrConnectionError(err) {
-			h.balancer.backendManager.MarkBackendDead(backend, err)
-		}
-		return "", 0, fmt.Errorf("upload request failed: %w", err)
+	if outcome.hash == "" {
+		return "", 0, fmt.Errorf("failed to parse response: %w", ErrMissingUploadHash)
 	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			log.Warn().Err(closeErr).Msg("Failed to close upload response body")
-		}
-	}()
 
-	// Parse response
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
-		return "", 0, fmt.Errorf("backend returned status %d", resp.StatusCode)
-	}
-
-	var uploadResp struct {
-		Hash string `json:"hash"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&uploadResp); err != nil {
-		return "", 0, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	return uploadResp.Hash, fileSize, nil
+	return outcome.hash, file.Size, nil
 }
 
-
 // GetObjectHandler handles object download by key.
 // GET /bucket/:name/object/*.
 func (h *ObjectHandlers) GetObjectHandler(ctx echo.Context) error {
@@ -184,7 +160,7 @@ func (h *ObjectHandlers) GetObjectHandler(ctx echo.Context) error {
 	ownerID := getOwnerFromContext(ctx)
 
 	// Look up object to get hash
-	obj, err := h.bucketStore.GetObject(bucketName, key)
+	obj, err := h.bucketStore.GetObject(ctx.Request().Context(), bucketName, key)
 	if err != nil {
 		if errors.Is(err, bucket.ErrBucketNotFound) {
 			return ctx.JSON(http.StatusNotFound, map[string]string{
@@ -202,7 +178,7 @@ func (h *ObjectHandlers) GetObjectHandler(ctx echo.Context) error {
 	}
 
 	// Check access
-	if err := h.bucketStore.CheckAccess(bucketName, ownerID); err != nil {
+	if err := h.bucketStore.CheckAccess(ctx.Request().Context(), bucketName, ownerID); err != nil {
 		if errors.Is(err, bucket.ErrAccessDenied) {
 			return ctx.JSON(http.StatusForbidden, map[string]string{
 				"error": "Access denied",
@@ -216,7 +192,7 @@ func (h *ObjectHandlers) GetObjectHandler(ctx echo.Context) error {
 
 // downloadByHash performs the CAS download using the hash.
 //
-//nolint:cyclop,bodyclose,funcorder // Complex but necessary logic for parallel backend requests; body is closed in for loop; placed near caller for readability
+//nolint:funcorder // placed near caller for readability
 func (h *ObjectHandlers) downloadByHash(ctx echo.Context, hash, contentType string) error {
 	backendURLs := h.balancer.backendManager.GetOnlineBackends()
 	if len(backendURLs) == 0 {
@@ -225,62 +201,36 @@ func (h *ObjectHandlers) downloadByHash(ctx echo.Context, hash, contentType stri
 		})
 	}
 
-	// Execute parallel download requests
-	results := executeBackendRequests(
-		ctx.Request().Context(),
-		backendURLs,
-		h.requestTimeout,
-		func(reqCtx context.Context, backend string) (*http.Response, int, error) {
-			req, err := retryablehttp.NewRequestWithContext(reqCtx, "GET", backend+"/file/"+hash+"/download", nil)
-			if err != nil {
-				return nil, 0, err
-			}
-
-			resp, err := h.balancer.client.Do(req)
-			if err != nil {
-				return nil, 0, err
-			}
-
-			return resp, resp.StatusCode, nil
-		},
-		true, // Cancel other requests on success
-	)
-
-	// Wait for first successful response
-	for result := range results {
-		if result.Error == nil && result.Status == http.StatusOK {
-			resp := result.Data
-			defer func() {
-				if closeErr := resp.Body.Close(); closeErr != nil {
-					log.Warn().Err(closeErr).Msg("Failed to close download response body")
-				}
-			}()
-
-			// Set content type if known
-			if contentType != "" {
-				ctx.Response().Header().Set(echo.HeaderContentType, contentType)
-			} else if ct := resp.Header.Get(echo.HeaderContentType); ct != "" {
-				ctx.Response().Header().Set(echo.HeaderContentType, ct)
-			}
-
-			// Stream response
-			ctx.Response().WriteHeader(http.StatusOK)
-			_, err := io.Copy(ctx.Response(), resp.Body)
-			if err != nil {
-				log.Warn().Err(err).Msg("Error streaming download response")
-			}
-			return nil
-		}
+	// Ask a cached location or the owners of the hash first and hedge to the other backends
+	var misses readMisses
+	result, source, ok := h.balancer.hedgedDownload(ctx.Request().Context(), h.balancer.readGroups(hash, backendURLs), hash, &misses)
+	if !ok {
+		observeLookup(lookupMiss)
+		return ctx.JSON(http.StatusNotFound, map[string]string{
+			"error": "Object not found in storage",
+		})
+	}
+	observeLookup(source)
 
-		// Clean up failed response
-		if result.Data != nil {
-			_ = result.Data.Body.Close()
-		}
+	resp := result.Data.resp
+	defer func() {
+		closeDownloadBody(resp)
+		result.CtxCancel()
+	}()
+
+	// Set content type if known
+	if contentType != "" {
+		ctx.Response().Header().Set(echo.HeaderContentType, contentType)
+	} else if ct := resp.Header.Get(echo.HeaderContentType); ct != "" {
+		ctx.Response().Header().Set(echo.HeaderContentType, ct)
 	}
 
-	return ctx.JSON(http.StatusNotFound, map[string]string{
-		"error": "Object not found in storage",
-	})
+	// Stream response
+	ctx.Response().WriteHeader(http.StatusOK)
+	if _, err := io.Copy(ctx.Response(), resp.Body); err != nil {
+		log.Ctx(ctx.Request().Context()).Warn().Err(err).Msg("Error streaming download response")
+	}
+	return nil
 }
 
 // PutObjectHandler handles object upload at a specific key.
@@ -291,7 +241,7 @@ func (h *ObjectHandlers) PutObjectHandler(ctx echo.Context) error {
 	ownerID := getOwnerFromContext(ctx)
 
 	// Verify bucket exists and user has write access
-	bucketRecord, err := h.bucketStore.GetBucket(bucketName)
+	bucketRecord, err := h.bucketStore.GetBucket(ctx.Request().Context(), bucketName)
 	if err != nil {
 		if errors.Is(err, bucket.ErrBucketNotFound) {
 			return ctx.JSON(http.StatusNotFound, map[string]string{
@@ -323,18 +273,23 @@ func (h *ObjectHandlers) PutObjectHandler(ctx echo.Context) error {
 	}
 
 	// Perform CAS upload
-	hash, size, err := h.performCASUpload(ctx, file)
+	hash, size, err := h.performCASUpload(ctx, file, bucketRecord)
 	if err != nil {
-		log.Error().Err(err).Str("bucket", bucketName).Str("key", key).Msg("CAS upload failed")
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Str("bucket", bucketName).Str("key", key).Msg("CAS upload failed")
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Upload failed: " + err.Error(),
 		})
 	}
 
+	setAuditHash(ctx, hash)
+
 	// Create/update object record
-	obj, err := h.bucketStore.PutObject(bucketName, key, hash, size, contentType, nil)
+	obj, err := h.bucketStore.PutObject(ctx.Request().Context(), bucketName, key, hash, size, contentType, nil)
 	if err != nil {
-		log.Error().Err(err).Str("bucket", bucketName).Str("key", key).Msg("Failed to create object record")
+		if isReplicationError(err) {
+			return metadataNotCommitted(ctx, err)
+		}
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Str("bucket", bucketName).Str("key", key).Msg("Failed to create object record")
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to create object record",
 		})
@@ -355,7 +310,7 @@ func (h *ObjectHandlers) HeadObjectHandler(ctx echo.Context) error {
 	key := ctx.Param("*")
 	ownerID := getOwnerFromContext(ctx)
 
-	obj, err := h.bucketStore.GetObject(bucketName, key)
+	obj, err := h.bucketStore.GetObject(ctx.Request().Context(), bucketName, key)
 	if err != nil {
 		if errors.Is(err, bucket.ErrBucketNotFound) {
 			return ctx.NoContent(http.StatusNotFound)
@@ -367,7 +322,7 @@ func (h *ObjectHandlers) HeadObjectHandler(ctx echo.Context) error {
 	}
 
 	// Check access
-	if err := h.bucketStore.CheckAccess(bucketName, ownerID); err != nil {
+	if err := h.bucketStore.CheckAccess(ctx.Request().Context(), bucketName, ownerID); err != nil {
 		if errors.Is(err, bucket.ErrAccessDenied) {
 			return ctx.NoContent(http.StatusForbidden)
 		}
@@ -393,7 +348,7 @@ func (h *ObjectHandlers) DeleteObjectHandler(ctx echo.Context) error {
 	ownerID := getOwnerFromContext(ctx)
 
 	// Verify ownership
-	bucketRecord, err := h.bucketStore.GetBucket(bucketName)
+	bucketRecord, err := h.bucketStore.GetBucket(ctx.Request().Context(), bucketName)
 	if err != nil {
 		if errors.Is(err, bucket.ErrBucketNotFound) {
 			return ctx.JSON(http.StatusNotFound, map[string]string{
@@ -411,13 +366,20 @@ func (h *ObjectHandlers) DeleteObjectHandler(ctx echo.Context) error {
 		})
 	}
 
-	err = h.bucketStore.DeleteObject(bucketName, key)
+	if obj, err := h.bucketStore.GetObject(ctx.Request().Context(), bucketName, key); err == nil {
+		setAuditHash(ctx, obj.Hash)
+	}
+
+	err = h.bucketStore.DeleteObject(ctx.Request().Context(), bucketName, key)
 	if err != nil {
 		if errors.Is(err, bucket.ErrObjectNotFound) {
 			return ctx.JSON(http.StatusNotFound, map[string]string{
 				"error": "Object not found",
 			})
 		}
+		if isReplicationError(err) {
+			return metadataNotCommitted(ctx, err)
+		}
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to delete object",
 		})
@@ -440,7 +402,7 @@ func (h *ObjectHandlers) ListObjectsHandler(ctx echo.Context) error {
 	ownerID := getOwnerFromContext(ctx)
 
 	// Check access
-	if err := h.bucketStore.CheckAccess(bucketName, ownerID); err != nil {
+	if err := h.bucketStore.CheckAccess(ctx.Request().Context(), bucketName, ownerID); err != nil {
 		if errors.Is(err, bucket.ErrBucketNotFound) {
 			return ctx.JSON(http.StatusNotFound, map[string]string{
 				"error": "Bucket not found",
@@ -466,7 +428,7 @@ func (h *ObjectHandlers) ListObjectsHandler(ctx echo.Context) error {
 		}
 	}
 
-	result, err := h.bucketStore.ListObjects(bucketName, opts)
+	result, err := h.bucketStore.ListObjects(ctx.Request().Context(), bucketName, opts)
 	if err != nil {
 		if errors.Is(err, bucket.ErrBucketNotFound) {
 			return ctx.JSON(http.StatusNotFound, map[string]string{
@@ -485,4 +447,3 @@ func (h *ObjectHandlers) ListObjectsHandler(ctx echo.Context) error {
 
 	return ctx.JSON(http.StatusOK, result)
 }
-
@@ -0,0 +1,175 @@
+package balancer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"loopfs/pkg/bucket"
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// changeFeedBatchSize is the number of events read from the store at a time.
+	changeFeedBatchSize = 100
+	// defaultChangePollInterval is how often the store is polled for new events.
+	defaultChangePollInterval = 500 * time.Millisecond
+	// defaultChangeHeartbeatInterval is how often an idle stream sends a comment to keep proxies from closing it.
+	defaultChangeHeartbeatInterval = 15 * time.Second
+	// headerLastEventID is sent by EventSource clients when they reconnect.
+	headerLastEventID = "Last-Event-ID"
+)
+
+// ChangeFeed streams bucket change events over Server-Sent Events.
+type ChangeFeed struct {
+	store             bucket.MetadataStore
+	pollInterval      time.Duration
+	heartbeatInterval time.Duration
+}
+
+// NewChangeFeed creates a change feed reading events from store.
+func NewChangeFeed(store bucket.MetadataStore) *ChangeFeed {
+	return &ChangeFeed{
+		store:             store,
+		pollInterval:      defaultChangePollInterval,
+		heartbeatInterval: defaultChangeHeartbeatInterval,
+	}
+}
+
+// changeCursor returns the sequence to stream from: the since query parameter, else the
+// Last-Event-ID header, else -1 to start at the latest change.
+func changeCursor(ctx echo.Context) (int64, error) {
+	value := ctx.QueryParam("since")
+	if value == "" {
+		value = ctx.Request().Header.Get(headerLastEventID)
+	}
+	if value == "" {
+		return -1, nil
+	}
+	since, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || since < 0 {
+		return 0, errors.New("invalid since: must be a non-negative change sequence")
+	}
+	return since, nil
+}
+
+// ChangesHandler streams the changes of a bucket after a sequence.
+// GET /bucket/:name/changes.
+//
+//nolint:cyclop,funlen // Streaming loop with access checks and resume handling
+func (f *ChangeFeed) ChangesHandler(ctx echo.Context) error {
+	name := ctx.Param("name")
+	ownerID := getOwnerFromContext(ctx)
+
+	if err := f.store.CheckAccess(ctx.Request().Context(), name, ownerID); err != nil {
+		switch {
+		case errors.Is(err, bucket.ErrBucketNotFound):
+			return ctx.JSON(http.StatusNotFound, map[string]string{
+				"error": "Bucket not found",
+			})
+		case errors.Is(err, bucket.ErrAccessDenied):
+			return ctx.JSON(http.StatusForbidden, map[string]string{
+				"error": "Access denied",
+			})
+		default:
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Failed to check bucket access",
+			})
+		}
+	}
+
+	since, err := changeCursor(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if since < 0 {
+		if since, err = f.store.LatestEventID(ctx.Request().Context()); err != nil {
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Failed to read change sequence",
+			})
+		}
+	} else {
+		oldest, err := f.store.OldestEventID(ctx.Request().Context())
+		if err != nil {
+			return ctx.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Failed to read change sequence",
+			})
+		}
+		if since < oldest-1 {
+			// Changes the client has not seen were pruned; it has to list the bucket again
+			return ctx.JSON(http.StatusGone, map[string]string{
+				"error":  "Changes since the requested sequence are no longer retained",
+				"oldest": strconv.FormatInt(oldest, 10),
+			})
+		}
+	}
+
+	response := ctx.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	response.Flush()
+
+	done := ctx.Request().Context().Done()
+	poll := time.NewTicker(f.pollInterval)
+	defer poll.Stop()
+	lastWrite := time.Now()
+
+	for {
+		events, err := f.store.BucketEventsAfter(ctx.Request().Context(), name, since, changeFeedBatchSize)
+		if err != nil {
+			log.Ctx(ctx.Request().Context()).Error().Err(err).Str("bucket", name).Msg("Failed to read bucket changes")
+		}
+
+		for i := range events {
+			if err := writeChangeEvent(response, &events[i]); err != nil {
+				return nil //nolint:nilerr // the client went away
+			}
+			since = events[i].ID
+			lastWrite = time.Now()
+			if events[i].Type == models.EventBucketDeleted {
+				return nil
+			}
+		}
+		if len(events) > 0 {
+			response.Flush()
+		}
+		if len(events) == changeFeedBatchSize {
+			continue
+		}
+
+		if time.Since(lastWrite) >= f.heartbeatInterval {
+			if _, err := fmt.Fprint(response, ": keepalive\n\n"); err != nil {
+				return nil //nolint:nilerr // the client went away
+			}
+			response.Flush()
+			lastWrite = time.Now()
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-poll.C:
+		}
+	}
+}
+
+// writeChangeEvent writes event as a Server-Sent Event whose ID is its change sequence.
+func writeChangeEvent(response *echo.Response, event *models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	_, err = fmt.Fprintf(response, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,210 @@
+package balancer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"loopfs/pkg/bucket"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+const changeTestHash = "a1b2c3d4e5f67890123456789abcdef0123456789abcdef0123456789abcdef0"
+
+// sseEvent is a parsed Server-Sent Event
+type sseEvent struct {
+	id    string
+	event string
+	data  models.Event
+}
+
+// ChangesTestSuite tests the SSE change feed
+type ChangesTestSuite struct {
+	suite.Suite
+	store  *bucket.Store
+	server *httptest.Server
+}
+
+// SetupTest serves the change feed over a real HTTP server
+func (s *ChangesTestSuite) SetupTest() {
+	var err error
+	s.store, err = bucket.NewStore(filepath.Join(s.T().TempDir(), "buckets.db"))
+	s.Require().NoError(err)
+	_, err = s.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().NoError(err)
+
+	feed := NewChangeFeed(s.store)
+	feed.pollInterval = 5 * time.Millisecond
+	feed.heartbeatInterval = 20 * time.Millisecond
+	e := echo.New()
+	e.GET("/bucket/:name/changes", feed.ChangesHandler)
+	s.server = httptest.NewServer(e)
+}
+
+// TearDownTest releases resources
+func (s *ChangesTestSuite) TearDownTest() {
+	s.server.Close()
+	_ = s.store.Close()
+}
+
+// open starts a change stream and returns the response
+func (s *ChangesTestSuite) open(ctx context.Context, query string, header http.Header) *http.Response {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.server.URL+"/bucket/photos/changes"+query, nil)
+	s.Require().NoError(err)
+	req.Header.Set("X-Owner-ID", "alice")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	return resp
+}
+
+// readEvents reads count events from an SSE stream, skipping comments
+func (s *ChangesTestSuite) readEvents(reader *bufio.Reader, count int) []sseEvent {
+	var events []sseEvent
+	current := sseEvent{}
+	for len(events) < count {
+		line, err := reader.ReadString('\n')
+		s.Require().NoError(err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if current.id != "" {
+				events = append(events, current)
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			current.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			current.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			s.Require().NoError(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &current.data))
+		}
+	}
+	return events
+}
+
+// TestStreamsNewChanges tests that changes made after connecting are streamed
+func (s *ChangesTestSuite) TestStreamsNewChanges() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp := s.open(ctx, "", nil)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("text/event-stream", resp.Header.Get(echo.HeaderContentType))
+
+	_, err := s.store.CreateBucket(context.Background(), "videos", "alice", nil)
+	s.Require().NoError(err)
+	_, err = s.store.PutObject(context.Background(), "photos", "a.jpg", changeTestHash, 3, "", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(s.store.DeleteObject(context.Background(), "photos", "a.jpg"))
+
+	events := s.readEvents(bufio.NewReader(resp.Body), 2)
+	s.Equal(models.EventObjectCreated, events[0].event)
+	s.Equal("a.jpg", events[0].data.Key)
+	s.Equal(strconv.FormatInt(events[0].data.ID, 10), events[0].id)
+	s.Equal(models.EventObjectDeleted, events[1].event)
+	s.Greater(events[1].data.ID, events[0].data.ID)
+}
+
+// TestResume tests resuming from the since parameter and the Last-Event-ID header
+func (s *ChangesTestSuite) TestResume() {
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := s.store.PutObject(context.Background(), "photos", key, changeTestHash, 1, "", nil)
+		s.Require().NoError(err)
+	}
+	all, err := s.store.BucketEventsAfter(context.Background(), "photos", 0, 10)
+	s.Require().NoError(err)
+	s.Require().Len(all, 4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp := s.open(ctx, "?since="+strconv.FormatInt(all[1].ID, 10), nil)
+	events := s.readEvents(bufio.NewReader(resp.Body), 2)
+	resp.Body.Close()
+	s.Equal("b", events[0].data.Key)
+	s.Equal("c", events[1].data.Key)
+
+	resp = s.open(ctx, "", http.Header{headerLastEventID: {strconv.FormatInt(all[2].ID, 10)}})
+	events = s.readEvents(bufio.NewReader(resp.Body), 1)
+	resp.Body.Close()
+	s.Equal("c", events[0].data.Key)
+}
+
+// TestBucketDeletedEndsStream tests that the stream ends after the bucket is deleted
+func (s *ChangesTestSuite) TestBucketDeletedEndsStream() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp := s.open(ctx, "?since=0", nil)
+	defer resp.Body.Close()
+	s.Require().NoError(s.store.DeleteBucket(context.Background(), "photos"))
+
+	reader := bufio.NewReader(resp.Body)
+	events := s.readEvents(reader, 2)
+	s.Equal(models.EventBucketCreated, events[0].event)
+	s.Equal(models.EventBucketDeleted, events[1].event)
+	_, err := reader.ReadString('\n')
+	s.Error(err, "the server must close the stream")
+}
+
+// TestHeartbeat tests that idle streams receive keepalive comments
+func (s *ChangesTestSuite) TestHeartbeat() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp := s.open(ctx, "", nil)
+	defer resp.Body.Close()
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	s.Require().NoError(err)
+	s.Equal(": keepalive\n", line)
+}
+
+// TestRejectedRequests tests access, validation and pruned-sequence errors
+func (s *ChangesTestSuite) TestRejectedRequests() {
+	ctx := context.Background()
+
+	resp := s.open(ctx, "?since=abc", nil)
+	resp.Body.Close()
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.server.URL+"/bucket/photos/changes", nil)
+	s.Require().NoError(err)
+	req.Header.Set("X-Owner-ID", "bob")
+	resp, err = http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, s.server.URL+"/bucket/missing/changes", nil)
+	s.Require().NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	resp.Body.Close()
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+
+	for _, key := range []string{"a", "b"} {
+		_, err := s.store.PutObject(context.Background(), "photos", key, changeTestHash, 1, "", nil)
+		s.Require().NoError(err)
+	}
+	_, err = s.store.PruneEvents(context.Background(), time.Now().Add(time.Hour), nil)
+	s.Require().NoError(err)
+	resp = s.open(ctx, "?since=1", nil)
+	resp.Body.Close()
+	s.Equal(http.StatusGone, resp.StatusCode)
+}
+
+// TestChangesTestSuite runs the change feed test suite
+func TestChangesTestSuite(t *testing.T) {
+	suite.Run(t, new(ChangesTestSuite))
+}
@@ -2,6 +2,7 @@ package balancer
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
 
@@ -32,8 +33,29 @@ func (b *Balancer) DeleteHandler(ctx echo.Context) error {
 		})
 	}
 
-	// Execute delete request across online backends
-	results := executeBackendRequests(ctx.Request().Context(), backends, b.requestTimeout,
+	// Record the delete before making it, so repairs do not copy the blob back from backends
+	// that are offline now or receive a copy while the delete runs
+	if b.repairQueue != nil {
+		if err := b.repairQueue.AddTombstone(ctx.Request().Context(), hash); err != nil {
+			switch {
+			case errors.Is(err, ErrNotReplicated):
+				// Recorded by the leader; a majority stores it once reachable
+				log.Ctx(ctx.Request().Context()).Warn().Err(err).Str("hash", hash).Msg("Blob tombstone not replicated yet")
+			case isReplicationError(err):
+				return metadataUnavailable(ctx, err)
+			default:
+				log.Ctx(ctx.Request().Context()).Error().Err(err).Str("hash", hash).Msg("Failed to record blob tombstone")
+				return ctx.JSON(http.StatusInternalServerError, map[string]string{
+					"error": "Failed to record delete",
+				})
+			}
+		}
+	}
+
+	// Execute delete request across all online backends, also with rendezvous placement:
+	// copies made by the repair worker and blobs written before placement was enabled live on
+	// other backends and would otherwise be served again
+	results := executeBackendRequests(ctx.Request().Context(), backends, b.RequestTimeout(),
 		func(reqCtx context.Context, backend string) (deleteData, int, error) {
 			return b.executeDeleteRequest(reqCtx, backend, hash)
 		},
@@ -51,10 +73,6 @@ func (b *Balancer) executeDeleteRequest(reqCtx context.Context, backend, hash st
 
 	resp, err := b.client.Do(req)
 	if err != nil {
-		// Mark backend as dead on timeout or connection errors
-		if isTimeoutOrConnectionError(err) {
-			b.backendManager.MarkBackendDead(backend, err)
-		}
 		return deleteData{}, 0, err
 	}
 	defer func() {
@@ -63,6 +81,10 @@ func (b *Balancer) executeDeleteRequest(reqCtx context.Context, backend, hash st
 		}
 	}()
 
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotFound {
+		b.forgetLocation(hash, backend)
+	}
+
 	body, _ := io.ReadAll(resp.Body)
 	return deleteData{body: body}, resp.StatusCode, nil
 }
@@ -85,7 +107,7 @@ func (b *Balancer) processDeleteResults(ctx echo.Context, results <-chan Request
 
 		if result.Error != nil {
 			lastError = result.Error
-			log.Warn().Err(result.Error).Str("backend", result.Backend).Msg("Delete failed")
+			log.Ctx(ctx.Request().Context()).Warn().Err(result.Error).Str("backend", result.Backend).Msg("Delete failed")
 			continue
 		}
 
@@ -33,15 +33,15 @@ func (b *Balancer) DownloadHandler(ctx echo.Context) error {
 		})
 	}
 
-	// Execute download request across online backends
-	results := executeBackendRequests(ctx.Request().Context(), backends, b.requestTimeout,
-		func(reqCtx context.Context, backend string) (downloadData, int, error) {
-			return b.executeDownloadRequest(reqCtx, backend, hash)
-		},
-		false, // Don't cancel on success - we need to stream the response body first
-	)
+	// Ask a cached location or the owners of the hash first and hedge to the other backends
+	var misses readMisses
+	if result, source, ok := b.hedgedDownload(ctx.Request().Context(), b.readGroups(hash, backends), hash, &misses); ok {
+		observeLookup(source)
+		return b.streamDownloadResponse(ctx, result)
+	}
+	observeLookup(lookupMiss)
 
-	return b.processDownloadResults(ctx, results)
+	return b.buildDownloadErrorResponse(ctx, misses.notFound, b.backendManager.BackendCount(), misses.lastError)
 }
 
 func (b *Balancer) executeDownloadRequest(reqCtx context.Context, backend, hash string) (downloadData, int, error) {
@@ -52,17 +52,17 @@ func (b *Balancer) executeDownloadRequest(reqCtx context.Context, backend, hash
 
 	resp, err := b.client.Do(req)
 	if err != nil {
-		// Mark backend as dead on timeout or connection errors
-		if isTimeoutOrConnectionError(err) {
-			b.backendManager.MarkBackendDead(backend, err)
-		}
 		return downloadData{}, 0, err
 	}
 
 	if resp.StatusCode == http.StatusOK {
+		b.rememberLocation(hash, backend)
 		// Return response without closing body - it will be streamed to the client
 		return downloadData{resp: resp}, resp.StatusCode, nil
 	}
+	if resp.StatusCode == http.StatusNotFound {
+		b.forgetLocation(hash, backend)
+	}
 
 	// Close body for non-success responses
 	if closeErr := resp.Body.Close(); closeErr != nil {
@@ -72,35 +72,56 @@ func (b *Balancer) executeDownloadRequest(reqCtx context.Context, backend, hash
 	return downloadData{}, resp.StatusCode, nil
 }
 
-func (b *Balancer) processDownloadResults(ctx echo.Context, results <-chan RequestResult[downloadData]) error {
-	var lastError error
-	notFoundCount := 0
-	backendCount := b.backendManager.BackendCount()
-
-	for result := range results {
-		if result.Error != nil {
-			lastError = result.Error
-			log.Warn().Err(result.Error).Str("backend", result.Backend).Msg("Download failed")
-			continue
+// hedgedDownload asks the read groups for hash, preferred backend first, and hedges to the
+// next one after the hedge delay. The first backend to return headers wins and the requests
+// to the others are cancelled. It returns the winner and the source of its read group, and
+// records failed and not-found answers in misses.
+func (b *Balancer) hedgedDownload(ctx context.Context, groups []readGroup, hash string, misses *readMisses) (RequestResult[downloadData], string, bool) {
+	ordered := make([][]string, len(groups))
+	sources := make(map[string]string)
+	for i, group := range groups {
+		ordered[i] = group.backends
+		if group.source == lookupBroadcast {
+			ordered[i] = b.backendManager.SortByLatency(group.backends)
 		}
-
-		if result.Status == http.StatusOK && result.Data.resp != nil {
-			return b.streamDownloadResponse(ctx, result, results)
+		for _, backend := range group.backends {
+			sources[backend] = group.source
 		}
+	}
 
-		if result.Status == http.StatusNotFound {
-			notFoundCount++
+	result, failed, ok := hedgedRequest(ctx, ordered, b.RequestTimeout(), b.hedgeDelay(), b.downloadLatency,
+		func(reqCtx context.Context, backend string) (downloadData, int, error) {
+			return b.executeDownloadRequest(reqCtx, backend, hash)
+		},
+		func(data downloadData) { closeDownloadBody(data.resp) },
+	)
+
+	for _, miss := range failed {
+		if miss.Error != nil {
+			misses.lastError = miss.Error
+			log.Ctx(ctx).Warn().Err(miss.Error).Str("backend", miss.Backend).Msg("Download failed")
+		} else if miss.Status == http.StatusNotFound {
+			misses.notFound++
 		}
 	}
+	return result, sources[result.Backend], ok
+}
 
-	return b.buildDownloadErrorResponse(ctx, notFoundCount, backendCount, lastError)
+// closeDownloadBody closes the body of a download response that is not streamed to the client.
+func closeDownloadBody(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	if closeErr := resp.Body.Close(); closeErr != nil {
+		log.Warn().Err(closeErr).Msg("Failed to close download response body")
+	}
 }
 
-func (b *Balancer) streamDownloadResponse(ctx echo.Context, result RequestResult[downloadData], results <-chan RequestResult[downloadData]) error {
+func (b *Balancer) streamDownloadResponse(ctx echo.Context, result RequestResult[downloadData]) error {
 	resp := result.Data.resp
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
-			log.Warn().Err(closeErr).Str("backend", result.Backend).Msg("Failed to close download response body")
+			log.Ctx(ctx.Request().Context()).Warn().Err(closeErr).Str("backend", result.Backend).Msg("Failed to close download response body")
 		}
 		// Clean up the request context after streaming is complete
 		if result.CtxCancel != nil {
@@ -111,9 +132,6 @@ func (b *Balancer) streamDownloadResponse(ctx echo.Context, result RequestResult
 	b.copyResponseHeaders(ctx, resp)
 	ctx.Response().WriteHeader(http.StatusOK)
 
-	// Drain remaining results in background to prevent goroutine leaks
-	go b.drainRemainingResults(results)
-
 	if _, err := io.Copy(ctx.Response().Writer, resp.Body); err != nil {
 		return ctx.JSON(http.StatusServiceUnavailable, map[string]string{
 			"error": "Download failed: " + err.Error(),
@@ -135,20 +153,6 @@ func (b *Balancer) copyResponseHeaders(ctx echo.Context, resp *http.Response) {
 	}
 }
 
-func (b *Balancer) drainRemainingResults(results <-chan RequestResult[downloadData]) {
-	for result := range results {
-		// Clean up any remaining cancel functions
-		if result.CtxCancel != nil {
-			result.CtxCancel()
-		}
-		if result.Data.resp != nil {
-			if closeErr := result.Data.resp.Body.Close(); closeErr != nil {
-				log.Warn().Err(closeErr).Str("backend", result.Backend).Msg("Failed to close download response body in drain")
-			}
-		}
-	}
-}
-
 func (b *Balancer) buildDownloadErrorResponse(ctx echo.Context, notFoundCount, backendCount int, lastError error) error {
 	// If all backends returned not found, return 404
 	if notFoundCount == backendCount {
@@ -11,4 +11,85 @@ var (
 
 	// ErrNoBackendWithSpace is returned when no backend has enough space for the upload.
 	ErrNoBackendWithSpace = errors.New("no backend has enough space")
+
+	// ErrWriteQuorumNotReached is returned when fewer backends stored an upload than the write quorum.
+	ErrWriteQuorumNotReached = errors.New("write quorum not reached")
+
+	// ErrMissingUploadHash is returned when a backend accepts an upload without reporting its hash.
+	ErrMissingUploadHash = errors.New("backend response has no hash")
+
+	// ErrUnexpectedStatus is returned when a backend answers a repair request with an unexpected status.
+	ErrUnexpectedStatus = errors.New("unexpected backend status")
+
+	// ErrNoReplicaOnline is returned when no online backend holds a blob queued for repair.
+	ErrNoReplicaOnline = errors.New("no online backend holds the blob")
+
+	// ErrRepairHashMismatch is returned when a repaired copy is stored under a different hash.
+	ErrRepairHashMismatch = errors.New("copied blob hash mismatch")
+
+	// ErrRepairRunning is returned when a repair run is requested while one is running or pending.
+	ErrRepairRunning = errors.New("repair already running")
+
+	// ErrRepairInactive is returned when a repair run is requested from a balancer that does not
+	// repair, as only the metadata leader does with metadata replication.
+	ErrRepairInactive = errors.New("repairs run on the metadata leader")
+
+	// ErrBlobDeleted is returned when a blob was deleted while the repair copied it.
+	ErrBlobDeleted = errors.New("blob was deleted")
+
+	// ErrUnknownPlacement is returned when an unsupported placement mode is configured.
+	ErrUnknownPlacement = errors.New("unknown placement mode")
+
+	// ErrUnknownPlacementPolicy is returned when an upload placement policy is not registered.
+	ErrUnknownPlacementPolicy = errors.New("unknown placement policy")
+
+	// ErrInvalidBackendURL is returned when a backend URL is not an absolute http or https URL.
+	ErrInvalidBackendURL = errors.New("backend URL must be an absolute http or https URL")
+
+	// ErrBackendExists is returned when adding a backend that is already configured.
+	ErrBackendExists = errors.New("backend already exists")
+
+	// ErrBackendNotFound is returned when changing or removing a backend that is not configured.
+	ErrBackendNotFound = errors.New("backend not found")
+
+	// ErrInvalidWeight is returned when a backend weight is negative.
+	ErrInvalidWeight = errors.New("backend weight must not be negative")
+
+	// ErrSlowResponse is recorded by a circuit breaker when a backend answered slower than
+	// the slow threshold.
+	ErrSlowResponse = errors.New("slow backend response")
+
+	// ErrRateLimited is returned when an owner or bucket exceeds its rate limit.
+	ErrRateLimited = errors.New("rate limit exceeded")
+
+	// ErrBackendsSaturated is returned when every online backend is at its concurrency limit.
+	ErrBackendsSaturated = errors.New("all backends are at their concurrency limit")
+
+	// ErrInvalidLimit is returned when a rate or concurrency limit is negative.
+	ErrInvalidLimit = errors.New("limits must not be negative")
+
+	// ErrInvalidPeerURL is returned when a metadata replication URL is not an absolute http or
+	// https URL, or the peers are configured without the URL of this balancer.
+	ErrInvalidPeerURL = errors.New("invalid metadata replication peer URL")
+
+	// ErrReplicationWithoutStore is returned when metadata replication is configured without
+	// the bucket store.
+	ErrReplicationWithoutStore = errors.New("metadata replication requires the bucket store")
+
+	// ErrReplicationWithoutToken is returned when metadata replication is configured without
+	// the token the balancers authenticate to each other with.
+	ErrReplicationWithoutToken = errors.New("metadata replication requires a token")
+
+	// ErrNotLeader is returned when bucket metadata is changed on a balancer that is not the
+	// metadata leader.
+	ErrNotLeader = errors.New("not the metadata leader")
+
+	// ErrNotReplicated is returned when a metadata change was not stored by a majority of
+	// balancers in time. The leader already applied it, so it may still take effect, but it
+	// is lost if another balancer is elected without it.
+	ErrNotReplicated = errors.New("metadata change not replicated to a majority")
+
+	// ErrNoLeader is returned when a metadata change cannot be forwarded because no leader is
+	// known.
+	ErrNoLeader = errors.New("no metadata leader")
 )
@@ -0,0 +1,247 @@
+package balancer
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHedgePercentile is the percentile of recent download latencies after which a
+	// hedge request is sent to the next backend.
+	DefaultHedgePercentile = 0.95
+
+	latencyWindowSize = 256                    // Download latencies kept for the hedge delay
+	minLatencySamples = 16                     // Samples needed before the percentile is used
+	defaultHedgeDelay = 100 * time.Millisecond // Hedge delay until enough samples were seen
+	minimumHedgeDelay = 5 * time.Millisecond
+	maximumHedgeDelay = 5 * time.Second
+)
+
+// Reasons for asking the next backend, used as metric labels.
+const (
+	hedgeTriggerTimer    = "timer"
+	hedgeTriggerFailure  = "failure"
+	hedgeTriggerNotFound = "not_found"
+)
+
+// latencyWindow keeps the most recent latencies of successful requests.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// observe records a latency, replacing the oldest one once the window is full. A nil window
+// ignores it.
+func (w *latencyWindow) observe(latency time.Duration) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+// percentile returns the latency below which the given fraction of samples fall, and false
+// while there are too few samples.
+func (w *latencyWindow) percentile(fraction float64) (time.Duration, bool) {
+	w.mu.Lock()
+	sorted := slices.Clone(w.samples)
+	w.mu.Unlock()
+
+	if len(sorted) < minLatencySamples {
+		return 0, false
+	}
+	slices.Sort(sorted)
+	index := min(len(sorted)-1, int(fraction*float64(len(sorted))))
+	return sorted[index], true
+}
+
+// SetHedging configures hedged downloads. A backend that has not returned response headers
+// within the given percentile of recent download latencies gets a hedge request sent to the
+// next backend. A percentile of zero disables hedging and asks all backends at once.
+func (b *Balancer) SetHedging(percentile float64) {
+	b.hedgePercentile = min(max(percentile, 0), 1)
+}
+
+// hedgeDelay returns how long to wait for a backend before hedging to the next one.
+func (b *Balancer) hedgeDelay() time.Duration {
+	if b.hedgePercentile == 0 {
+		return 0
+	}
+
+	delay, ok := b.downloadLatency.percentile(b.hedgePercentile)
+	if !ok {
+		return defaultHedgeDelay
+	}
+	return min(max(delay, minimumHedgeDelay), maximumHedgeDelay)
+}
+
+// SortByLatency orders backends by their last health check latency, fastest first.
+func (bm *BackendManager) SortByLatency(backends []string) []string {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+
+	sorted := slices.Clone(backends)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		var left, right int64
+		if status, ok := bm.backends[sorted[i]]; ok {
+			left = status.Latency
+		}
+		if status, ok := bm.backends[sorted[j]]; ok {
+			right = status.Latency
+		}
+		return left < right
+	})
+	return sorted
+}
+
+// hedgedRequest asks the backends of groups in order until one answers with 200 OK. The next
+// backend is asked when the previous ones have not answered within hedgeDelay or have all
+// failed. A delay of zero asks all backends of a group at once and the next group only when
+// they all failed. A 404 means the preferred backends did not have the data, so all remaining
+// backends are asked at once instead of one round trip after another. As soon as one backend
+// answers, the requests to all others are cancelled and release is called for any late
+// successful data. The time until the winner answered is recorded in latency.
+//
+// It returns the winning result, whose CtxCancel must be called once its data is consumed,
+// and the failed and not-found results. ok is false if no backend answered with 200 OK.
+//
+//nolint:cyclop // hedging, failure and cancellation paths share the launch state
+func hedgedRequest[T any](
+	ctx context.Context,
+	groups [][]string,
+	requestTimeout, hedgeDelay time.Duration,
+	latency *latencyWindow,
+	requestFunc BackendRequestFunc[T],
+	release func(T),
+) (winner RequestResult[T], misses []RequestResult[T], ok bool) {
+	var (
+		backends  []string
+		groupEnds []int // Index after the last backend of each group
+	)
+	for _, group := range groups {
+		backends = append(backends, group...)
+		groupEnds = append(groupEnds, len(backends))
+	}
+	fanoutBackends.Observe(float64(len(backends)))
+	if len(backends) == 0 {
+		return winner, nil, false
+	}
+
+	results := make(chan RequestResult[T], len(backends))
+	cancels := make(map[string]context.CancelFunc, len(backends))
+	started := make(map[string]time.Time, len(backends))
+	hedged := make(map[string]bool, len(backends))
+	launched := 0
+	launch := func() {
+		backend := backends[launched]
+		launched++
+
+		reqCtx, reqCancel := context.WithTimeout(ctx, requestTimeout)
+		cancels[backend] = reqCancel
+		started[backend] = time.Now()
+		go func() {
+			data, status, err := requestFunc(reqCtx, backend)
+			results <- RequestResult[T]{Backend: backend, Data: data, Status: status, Error: err, CtxCancel: reqCancel}
+		}()
+	}
+
+	// launchNext asks the next backend, or without hedging all backends of the next group
+	launchNext := func() {
+		end := launched + 1
+		if hedgeDelay == 0 {
+			for _, groupEnd := range groupEnds {
+				if groupEnd > launched {
+					end = groupEnd
+					break
+				}
+			}
+		}
+		for launched < end {
+			launch()
+		}
+	}
+
+	launchNext()
+
+	timer := time.NewTimer(hedgeDelay)
+	defer timer.Stop()
+
+	for len(misses) < launched {
+		select {
+		case result := <-results:
+			if result.Error == nil && result.Status == http.StatusOK {
+				latency.observe(time.Since(started[result.Backend]))
+				if hedged[result.Backend] {
+					downloadHedgeWinsTotal.Inc()
+				}
+				cancelLosers(cancels, result.Backend, results, launched-len(misses)-1, release)
+				return result, misses, true
+			}
+
+			result.CtxCancel()
+			result.CtxCancel = nil
+			misses = append(misses, result)
+
+			if result.Error == nil && result.Status == http.StatusNotFound && launched < len(backends) {
+				downloadHedgesTotal.WithLabelValues(hedgeTriggerNotFound).Add(float64(len(backends) - launched))
+				for launched < len(backends) {
+					launch()
+				}
+			}
+
+			// A failed backend is replaced at once instead of waiting for the hedge delay
+			if len(misses) == launched && launched < len(backends) {
+				downloadHedgesTotal.WithLabelValues(hedgeTriggerFailure).Inc()
+				launchNext()
+				timer.Reset(hedgeDelay)
+			}
+		case <-timer.C:
+			if hedgeDelay > 0 && launched < len(backends) {
+				downloadHedgesTotal.WithLabelValues(hedgeTriggerTimer).Inc()
+				hedged[backends[launched]] = true
+				launchNext()
+				timer.Reset(hedgeDelay)
+			}
+		}
+	}
+
+	return winner, misses, false
+}
+
+// cancelLosers cancels every request except the winner's and, in the background, waits for
+// the pending results and releases the data of any that still succeeded.
+func cancelLosers[T any](
+	cancels map[string]context.CancelFunc,
+	winner string,
+	results <-chan RequestResult[T],
+	pending int,
+	release func(T),
+) {
+	for backend, cancel := range cancels {
+		if backend != winner {
+			cancel()
+		}
+	}
+
+	go func() {
+		for range pending {
+			result := <-results
+			if result.Error == nil && result.Status == http.StatusOK {
+				release(result.Data)
+			}
+		}
+	}()
+}
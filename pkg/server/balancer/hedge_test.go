@@ -0,0 +1,247 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+// HedgeTestSuite tests hedged first-byte-wins requests
+type HedgeTestSuite struct {
+	suite.Suite
+}
+
+// fakeBackend describes how a fake backend answers a hedged request
+type fakeBackend struct {
+	delay  time.Duration
+	status int
+	err    error
+}
+
+// fakeRequests returns a request function answering as configured per backend and records
+// which backends were asked and which requests were cancelled
+func fakeRequests(backends map[string]fakeBackend, asked, cancelled *sync.Map) BackendRequestFunc[string] {
+	return func(ctx context.Context, backend string) (string, int, error) {
+		asked.Store(backend, true)
+		fake := backends[backend]
+		select {
+		case <-time.After(fake.delay):
+			return backend, fake.status, fake.err
+		case <-ctx.Done():
+			cancelled.Store(backend, true)
+			return "", 0, ctx.Err()
+		}
+	}
+}
+
+// TestHedgeAfterDelay tests that a slow backend is hedged and loses to the next one
+func (s *HedgeTestSuite) TestHedgeAfterDelay() {
+	var asked, cancelled sync.Map
+	requests := fakeRequests(map[string]fakeBackend{
+		"slow": {delay: time.Second, status: http.StatusOK},
+		"fast": {delay: 10 * time.Millisecond, status: http.StatusOK},
+		"idle": {delay: 10 * time.Millisecond, status: http.StatusOK},
+	}, &asked, &cancelled)
+
+	latency := &latencyWindow{}
+	start := time.Now()
+	winner, misses, ok := hedgedRequest(context.Background(), [][]string{{"slow", "fast", "idle"}},
+		5*time.Second, 50*time.Millisecond, latency, requests, func(string) {})
+	s.Require().True(ok)
+	defer winner.CtxCancel()
+
+	s.Equal("fast", winner.Data)
+	s.Empty(misses)
+	s.Less(time.Since(start), 500*time.Millisecond)
+	s.Len(latency.samples, 1)
+
+	// The idle backend was never asked and the slow one is cancelled
+	_, idleAsked := asked.Load("idle")
+	s.False(idleAsked)
+	s.Eventually(func() bool {
+		_, ok := cancelled.Load("slow")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+// TestFailureAsksNextAtOnce tests that a failed backend is replaced without waiting for the hedge delay
+func (s *HedgeTestSuite) TestFailureAsksNextAtOnce() {
+	var asked, cancelled sync.Map
+	requests := fakeRequests(map[string]fakeBackend{
+		"missing": {status: http.StatusNotFound},
+		"broken":  {err: errors.New("connection refused")},
+		"holder":  {status: http.StatusOK},
+	}, &asked, &cancelled)
+
+	start := time.Now()
+	winner, misses, ok := hedgedRequest(context.Background(), [][]string{{"broken"}, {"missing", "holder"}},
+		5*time.Second, time.Second, nil, requests, func(string) {})
+	s.Require().True(ok)
+	defer winner.CtxCancel()
+
+	s.Equal("holder", winner.Data)
+	s.Less(time.Since(start), 500*time.Millisecond)
+	s.Require().Len(misses, 2)
+	s.Error(misses[0].Error)
+	s.Equal(http.StatusNotFound, misses[1].Status)
+}
+
+// TestNotFoundAsksRemainingAtOnce tests that a miss across many backends costs one round trip, not one per backend
+func (s *HedgeTestSuite) TestNotFoundAsksRemainingAtOnce() {
+	const backendCount = 8
+	var asked, cancelled sync.Map
+	fakes := make(map[string]fakeBackend, backendCount)
+	groups := make([][]string, 0, backendCount)
+	for i := range backendCount {
+		backend := fmt.Sprintf("backend-%d", i)
+		fakes[backend] = fakeBackend{delay: 50 * time.Millisecond, status: http.StatusNotFound}
+		groups = append(groups, []string{backend})
+	}
+	requests := fakeRequests(fakes, &asked, &cancelled)
+
+	start := time.Now()
+	_, misses, ok := hedgedRequest(context.Background(), groups, 5*time.Second, time.Second, nil, requests, func(string) {})
+	s.False(ok)
+	s.Len(misses, backendCount)
+	// Serial requests would take 400ms, the first answer and the rest asked together about 100ms
+	s.Less(time.Since(start), 300*time.Millisecond)
+}
+
+// TestAllMissing tests that no winner is returned when every backend misses
+func (s *HedgeTestSuite) TestAllMissing() {
+	var asked, cancelled sync.Map
+	requests := fakeRequests(map[string]fakeBackend{
+		"a": {status: http.StatusNotFound},
+		"b": {status: http.StatusNotFound},
+	}, &asked, &cancelled)
+
+	_, misses, ok := hedgedRequest(context.Background(), [][]string{{"a"}, {"b"}},
+		time.Second, 10*time.Millisecond, nil, requests, func(string) {})
+	s.False(ok)
+	s.Len(misses, 2)
+}
+
+// TestZeroDelayRacesAllAndReleasesLosers tests that without hedging all backends are asked and late successes are released
+func (s *HedgeTestSuite) TestZeroDelayRacesAllAndReleasesLosers() {
+	var asked sync.Map
+	var released atomic.Int32
+	requests := func(ctx context.Context, backend string) (string, int, error) {
+		asked.Store(backend, true)
+		if backend == "second" {
+			// Ignores cancellation, like a backend whose headers already arrived
+			time.Sleep(50 * time.Millisecond)
+		}
+		return backend, http.StatusOK, nil
+	}
+
+	winner, _, ok := hedgedRequest(context.Background(), [][]string{{"first", "second"}, {"third"}},
+		time.Second, 0, nil, requests, func(string) { released.Add(1) })
+	s.Require().True(ok)
+	defer winner.CtxCancel()
+
+	s.Equal("first", winner.Data)
+	s.Eventually(func() bool {
+		_, secondAsked := asked.Load("second")
+		return secondAsked
+	}, time.Second, time.Millisecond)
+	_, thirdAsked := asked.Load("third")
+	s.False(thirdAsked)
+	s.Eventually(func() bool { return released.Load() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+// TestHedgeDelayFollowsPercentile tests the hedge delay before and after enough samples
+func (s *HedgeTestSuite) TestHedgeDelayFollowsPercentile() {
+	balancer := NewBalancer(nil, 0, time.Millisecond, time.Millisecond, time.Second)
+	s.Equal(defaultHedgeDelay, balancer.hedgeDelay())
+
+	for i := 1; i <= 100; i++ {
+		balancer.downloadLatency.observe(time.Duration(i) * time.Millisecond)
+	}
+	s.Equal(96*time.Millisecond, balancer.hedgeDelay())
+
+	balancer.SetHedging(0.5)
+	s.Equal(51*time.Millisecond, balancer.hedgeDelay())
+
+	balancer.SetHedging(0)
+	s.Zero(balancer.hedgeDelay())
+}
+
+// TestLatencyWindowKeepsRecentSamples tests that the window replaces its oldest samples
+func (s *HedgeTestSuite) TestLatencyWindowKeepsRecentSamples() {
+	window := &latencyWindow{}
+	for range latencyWindowSize {
+		window.observe(time.Second)
+	}
+	for range latencyWindowSize {
+		window.observe(time.Millisecond)
+	}
+
+	p, ok := window.percentile(1)
+	s.True(ok)
+	s.Equal(time.Millisecond, p)
+}
+
+// TestDownloadCancelsSlowBackend tests that a download is served by the hedge and the slow backend's request is cancelled
+func (s *HedgeTestSuite) TestDownloadCancelsSlowBackend() {
+	var slowCancelled atomic.Bool
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/node/info" {
+			w.Write([]byte(`{"storage":{"available":1000}}`))
+			return
+		}
+		select {
+		case <-time.After(2 * time.Second):
+			w.Write([]byte("slow content"))
+		case <-r.Context().Done():
+			slowCancelled.Store(true)
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/node/info" {
+			w.Write([]byte(`{"storage":{"available":1000}}`))
+			return
+		}
+		w.Write([]byte("fast content"))
+	}))
+	defer fast.Close()
+
+	manager := NewBackendManager([]string{slow.URL, fast.URL}, time.Minute, 5*time.Second)
+	manager.Start()
+	defer manager.Stop()
+
+	balancer := NewBalancer(manager, 0, time.Millisecond, time.Millisecond, 5*time.Second)
+	for range minLatencySamples {
+		balancer.downloadLatency.observe(20 * time.Millisecond)
+	}
+
+	// The cached location makes the slow backend the first one asked
+	balancer.SetLocationCache(NewLocationCache(10, nil))
+	hash := "abcdef1234567890abcdef1234567890abcdef1234567890abcdef1234567890"
+	balancer.locations.Add(hash, slow.URL)
+
+	rec := httptest.NewRecorder()
+	ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/file/"+hash+"/download", nil), rec)
+	ctx.SetParamNames("hash")
+	ctx.SetParamValues(hash)
+
+	start := time.Now()
+	s.Require().NoError(balancer.DownloadHandler(ctx))
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("fast content", rec.Body.String())
+	s.Less(time.Since(start), time.Second)
+	s.Eventually(slowCancelled.Load, time.Second, 10*time.Millisecond)
+}
+
+func TestHedgeSuite(t *testing.T) {
+	suite.Run(t, new(HedgeTestSuite))
+}
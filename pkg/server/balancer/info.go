@@ -33,15 +33,24 @@ func (b *Balancer) FileInfoHandler(ctx echo.Context) error {
 		})
 	}
 
-	// Execute info request across online backends with early cancellation on success
-	results := executeBackendRequests(ctx.Request().Context(), backends, b.requestTimeout,
-		func(reqCtx context.Context, backend string) (infoData, int, error) {
-			return b.executeInfoRequest(reqCtx, backend, hash)
-		},
-		true, // Cancel on success - we only need one response
-	)
-
-	return b.processInfoResults(ctx, results)
+	// Ask the owners of the hash first and the remaining backends only on a miss
+	var misses readMisses
+	for _, group := range b.readGroups(hash, backends) {
+		results := executeBackendRequests(ctx.Request().Context(), group.backends, b.RequestTimeout(),
+			func(reqCtx context.Context, backend string) (infoData, int, error) {
+				return b.executeInfoRequest(reqCtx, backend, hash)
+			},
+			true, // Cancel on success - we only need one response
+		)
+
+		if info := b.processInfoResults(results, &misses); info != nil {
+			observeLookup(group.source)
+			return ctx.JSON(http.StatusOK, info)
+		}
+	}
+	observeLookup(lookupMiss)
+
+	return b.buildInfoErrorResponse(ctx, misses.notFound, b.backendManager.BackendCount(), misses.lastError)
 }
 
 func (b *Balancer) executeInfoRequest(reqCtx context.Context, backend, hash string) (infoData, int, error) {
@@ -52,10 +61,6 @@ func (b *Balancer) executeInfoRequest(reqCtx context.Context, backend, hash stri
 
 	resp, err := b.client.Do(req)
 	if err != nil {
-		// Mark backend as dead on timeout or connection errors
-		if isTimeoutOrConnectionError(err) {
-			b.backendManager.MarkBackendDead(backend, err)
-		}
 		return infoData{}, 0, err
 	}
 	defer func() {
@@ -69,17 +74,19 @@ func (b *Balancer) executeInfoRequest(reqCtx context.Context, backend, hash stri
 		if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
 			return infoData{}, resp.StatusCode, err
 		}
+		b.rememberLocation(hash, backend)
 		return infoData{info: &info}, resp.StatusCode, nil
 	}
+	if resp.StatusCode == http.StatusNotFound {
+		b.forgetLocation(hash, backend)
+	}
 
 	return infoData{}, resp.StatusCode, nil
 }
 
-func (b *Balancer) processInfoResults(ctx echo.Context, results <-chan RequestResult[infoData]) error {
-	var lastError error
-	notFoundCount := 0
-	backendCount := b.backendManager.BackendCount()
-
+// processInfoResults returns the first file info received, recording failed and not-found
+// answers in misses.
+func (b *Balancer) processInfoResults(results <-chan RequestResult[infoData], misses *readMisses) *models.FileInfo {
 	for result := range results {
 		// Clean up cancel function if present
 		if result.CtxCancel != nil {
@@ -87,21 +94,21 @@ func (b *Balancer) processInfoResults(ctx echo.Context, results <-chan RequestRe
 		}
 
 		if result.Error != nil {
-			lastError = result.Error
+			misses.lastError = result.Error
 			log.Warn().Err(result.Error).Str("backend", result.Backend).Msg("Info request failed")
 			continue
 		}
 
 		if result.Status == http.StatusOK && result.Data.info != nil {
-			return ctx.JSON(http.StatusOK, result.Data.info)
+			return result.Data.info
 		}
 
 		if result.Status == http.StatusNotFound {
-			notFoundCount++
+			misses.notFound++
 		}
 	}
 
-	return b.buildInfoErrorResponse(ctx, notFoundCount, backendCount, lastError)
+	return nil
 }
 
 func (b *Balancer) buildInfoErrorResponse(ctx echo.Context, notFoundCount, backendCount int, lastError error) error {
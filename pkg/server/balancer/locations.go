@@ -0,0 +1,203 @@
+package balancer
+
+import (
+	"container/list"
+	"context"
+	"slices"
+	"sync"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+)
+
+// DefaultLocationCacheSize is the default number of hashes whose locations are cached.
+const DefaultLocationCacheSize = 100000
+
+// LocationStore persists the location cache across restarts.
+type LocationStore interface {
+	SaveLocation(ctx context.Context, hash string, backends []string) error
+	DeleteLocation(ctx context.Context, hash string) error
+	ListLocations(ctx context.Context, limit int) ([]models.HashLocation, error)
+}
+
+// locationEntry holds the backends known to store a hash, most recently confirmed first.
+type locationEntry struct {
+	hash     string
+	backends []string
+}
+
+// LocationCache is a bounded LRU cache of the backends storing each hash, so repeat reads
+// go to a backend known to have the file instead of asking all of them.
+type LocationCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List    // Most recently used first
+	store    LocationStore // nil keeps the cache in memory only
+}
+
+// NewLocationCache creates a location cache holding up to capacity hashes. With a store,
+// every change is written through so the cache survives restarts.
+func NewLocationCache(capacity int, store LocationStore) *LocationCache {
+	return &LocationCache{
+		capacity: max(1, capacity),
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		store:    store,
+	}
+}
+
+// Load fills the cache with the most recently updated locations of the store.
+func (c *LocationCache) Load() error {
+	if c.store == nil {
+		return nil
+	}
+
+	locations, err := c.store.ListLocations(context.Background(), c.capacity)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, location := range locations {
+		if _, exists := c.entries[location.Hash]; exists || len(location.Backends) == 0 {
+			continue
+		}
+		c.entries[location.Hash] = c.order.PushBack(&locationEntry{hash: location.Hash, backends: location.Backends})
+	}
+	locationCacheEntries.Set(float64(c.order.Len()))
+	return nil
+}
+
+// Get returns the backends known to store hash, most recently confirmed first, or nil.
+func (c *LocationCache) Get(hash string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[hash]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return slices.Clone(element.Value.(*locationEntry).backends)
+}
+
+// Add records that backend stores hash, evicting the least recently used hash when full.
+func (c *LocationCache) Add(hash, backend string) {
+	c.mu.Lock()
+	var (
+		backends []string
+		evicted  string
+	)
+	if element, ok := c.entries[hash]; ok {
+		c.order.MoveToFront(element)
+		entry := element.Value.(*locationEntry)
+		if len(entry.backends) > 0 && entry.backends[0] == backend {
+			c.mu.Unlock()
+			return
+		}
+		entry.backends = slices.DeleteFunc(entry.backends, func(b string) bool { return b == backend })
+		entry.backends = slices.Insert(entry.backends, 0, backend)
+		backends = slices.Clone(entry.backends)
+	} else {
+		backends = []string{backend}
+		c.entries[hash] = c.order.PushFront(&locationEntry{hash: hash, backends: slices.Clone(backends)})
+		if c.order.Len() > c.capacity {
+			oldest := c.order.Back()
+			evicted = oldest.Value.(*locationEntry).hash
+			c.order.Remove(oldest)
+			delete(c.entries, evicted)
+		}
+	}
+	locationCacheEntries.Set(float64(c.order.Len()))
+	c.mu.Unlock()
+
+	c.save(hash, backends)
+	if evicted != "" {
+		c.save(evicted, nil)
+	}
+}
+
+// Remove records that backend no longer stores hash.
+func (c *LocationCache) Remove(hash, backend string) {
+	c.mu.Lock()
+	element, ok := c.entries[hash]
+	if !ok || !slices.Contains(element.Value.(*locationEntry).backends, backend) {
+		c.mu.Unlock()
+		return
+	}
+
+	entry := element.Value.(*locationEntry)
+	entry.backends = slices.DeleteFunc(entry.backends, func(b string) bool { return b == backend })
+	backends := slices.Clone(entry.backends)
+	if len(backends) == 0 {
+		c.order.Remove(element)
+		delete(c.entries, hash)
+	}
+	locationCacheEntries.Set(float64(c.order.Len()))
+	c.mu.Unlock()
+
+	c.save(hash, backends)
+}
+
+// Forget drops all known locations of hash.
+func (c *LocationCache) Forget(hash string) {
+	c.mu.Lock()
+	element, ok := c.entries[hash]
+	if ok {
+		c.order.Remove(element)
+		delete(c.entries, hash)
+	}
+	locationCacheEntries.Set(float64(c.order.Len()))
+	c.mu.Unlock()
+
+	if ok {
+		c.save(hash, nil)
+	}
+}
+
+// Len returns the number of cached hashes.
+func (c *LocationCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// save writes the backends of hash to the store, deleting the record when there are none.
+// Failures are only logged; the cache is a hint and reads fall back to asking all backends.
+func (c *LocationCache) save(hash string, backends []string) {
+	if c.store == nil {
+		return
+	}
+
+	var err error
+	if len(backends) == 0 {
+		err = c.store.DeleteLocation(context.Background(), hash)
+	} else {
+		err = c.store.SaveLocation(context.Background(), hash, backends)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("hash", hash).Msg("Failed to persist hash location")
+	}
+}
+
+// SetLocationCache sets the cache of hash locations used to route reads. nil disables it.
+func (b *Balancer) SetLocationCache(cache *LocationCache) {
+	b.locations = cache
+}
+
+// rememberLocation records a backend that answered for hash.
+func (b *Balancer) rememberLocation(hash, backend string) {
+	if b.locations != nil && hash != "" {
+		b.locations.Add(hash, backend)
+	}
+}
+
+// forgetLocation records a backend that no longer has hash.
+func (b *Balancer) forgetLocation(hash, backend string) {
+	if b.locations != nil {
+		b.locations.Remove(hash, backend)
+	}
+}
@@ -0,0 +1,215 @@
+package balancer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+// memoryLocationStore is an in-memory LocationStore
+type memoryLocationStore struct {
+	mu        sync.Mutex
+	locations map[string][]string
+}
+
+func (m *memoryLocationStore) SaveLocation(_ context.Context, hash string, backends []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.locations[hash] = backends
+	return nil
+}
+
+func (m *memoryLocationStore) DeleteLocation(_ context.Context, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.locations, hash)
+	return nil
+}
+
+func (m *memoryLocationStore) ListLocations(_ context.Context, limit int) ([]models.HashLocation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	locations := []models.HashLocation{}
+	for hash, backends := range m.locations {
+		if limit > 0 && len(locations) == limit {
+			break
+		}
+		locations = append(locations, models.HashLocation{Hash: hash, Backends: backends})
+	}
+	return locations, nil
+}
+
+// LocationCacheTestSuite tests the LRU cache of hash locations and cached read routing
+type LocationCacheTestSuite struct {
+	suite.Suite
+	backends []*blobBackend
+	manager  *BackendManager
+}
+
+// TearDownTest stops the backend manager and the backends
+func (s *LocationCacheTestSuite) TearDownTest() {
+	if s.manager != nil {
+		s.manager.Stop()
+		s.manager = nil
+	}
+	for _, backend := range s.backends {
+		backend.server.Close()
+	}
+	s.backends = nil
+}
+
+// newBalancer starts three in-memory backends and a balancer with a location cache
+func (s *LocationCacheTestSuite) newBalancer(cache *LocationCache) *Balancer {
+	s.backends = []*blobBackend{newBlobBackend(), newBlobBackend(), newBlobBackend()}
+	urls := make([]string, 0, len(s.backends))
+	for _, backend := range s.backends {
+		urls = append(urls, backend.server.URL)
+	}
+	s.manager = NewBackendManager(urls, 100*time.Millisecond, 5*time.Second)
+	s.manager.Start()
+	time.Sleep(200 * time.Millisecond)
+
+	balancer := NewBalancer(s.manager, 0, time.Millisecond, time.Millisecond, 5*time.Second)
+	balancer.SetLocationCache(cache)
+	return balancer
+}
+
+// downloads returns the download requests each backend received and resets the counts
+func (s *LocationCacheTestSuite) downloads() []int {
+	counts := make([]int, len(s.backends))
+	for i, backend := range s.backends {
+		backend.mu.Lock()
+		counts[i] = backend.downloads
+		backend.downloads = 0
+		backend.mu.Unlock()
+	}
+	return counts
+}
+
+// request sends a request for hash through handler
+func (s *LocationCacheTestSuite) request(handler echo.HandlerFunc, method, hash string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ctx := echo.New().NewContext(httptest.NewRequest(method, "/file/"+hash, nil), rec)
+	ctx.SetParamNames("hash")
+	ctx.SetParamValues(hash)
+	s.Require().NoError(handler(ctx))
+	return rec
+}
+
+// TestEvictsLeastRecentlyUsed tests that the cache drops the least recently used hash when full
+func (s *LocationCacheTestSuite) TestEvictsLeastRecentlyUsed() {
+	store := &memoryLocationStore{locations: map[string][]string{}}
+	cache := NewLocationCache(2, store)
+	cache.Add("a", "http://node1")
+	cache.Add("b", "http://node1")
+	s.NotNil(cache.Get("a"))
+	cache.Add("c", "http://node2")
+
+	s.Equal(2, cache.Len())
+	s.Nil(cache.Get("b"))
+	s.Equal([]string{"http://node1"}, cache.Get("a"))
+	s.Equal([]string{"http://node2"}, cache.Get("c"))
+	s.NotContains(store.locations, "b")
+	s.Len(store.locations, 2)
+}
+
+// TestAddPutsLatestBackendFirst tests that the most recently confirmed backend is returned first
+func (s *LocationCacheTestSuite) TestAddPutsLatestBackendFirst() {
+	cache := NewLocationCache(10, nil)
+	cache.Add("a", "http://node1")
+	cache.Add("a", "http://node2")
+	cache.Add("a", "http://node1")
+	s.Equal([]string{"http://node1", "http://node2"}, cache.Get("a"))
+}
+
+// TestRemoveAndForget tests that removed backends and forgotten hashes are dropped
+func (s *LocationCacheTestSuite) TestRemoveAndForget() {
+	store := &memoryLocationStore{locations: map[string][]string{}}
+	cache := NewLocationCache(10, store)
+	cache.Add("a", "http://node1")
+	cache.Add("a", "http://node2")
+	cache.Add("b", "http://node1")
+
+	cache.Remove("a", "http://node2")
+	s.Equal([]string{"http://node1"}, cache.Get("a"))
+	s.Equal([]string{"http://node1"}, store.locations["a"])
+
+	cache.Remove("a", "http://node1")
+	s.Nil(cache.Get("a"))
+	s.NotContains(store.locations, "a")
+
+	cache.Forget("b")
+	s.Zero(cache.Len())
+	s.Empty(store.locations)
+}
+
+// TestLoadRestoresPersistedLocations tests that a new cache starts with the persisted locations
+func (s *LocationCacheTestSuite) TestLoadRestoresPersistedLocations() {
+	store := &memoryLocationStore{locations: map[string][]string{}}
+	NewLocationCache(10, store).Add("a", "http://node1")
+
+	cache := NewLocationCache(10, store)
+	s.Require().NoError(cache.Load())
+	s.Equal([]string{"http://node1"}, cache.Get("a"))
+}
+
+// TestRepeatReadHitsCachedBackend tests that a read after a broadcast goes to the backend that answered
+func (s *LocationCacheTestSuite) TestRepeatReadHitsCachedBackend() {
+	cache := NewLocationCache(10, nil)
+	balancer := s.newBalancer(cache)
+	hash := s.backends[1].put("cached location")
+
+	s.Equal(http.StatusOK, s.request(balancer.DownloadHandler, http.MethodGet, hash).Code)
+	s.Equal(1, s.downloads()[1])
+	s.Equal([]string{s.backends[1].server.URL}, cache.Get(hash))
+
+	rec := s.request(balancer.DownloadHandler, http.MethodGet, hash)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal("cached location", rec.Body.String())
+	s.Equal([]int{0, 1, 0}, s.downloads())
+}
+
+// TestStaleLocationFallsBack tests that a cached backend answering 404 is dropped and the others are asked
+func (s *LocationCacheTestSuite) TestStaleLocationFallsBack() {
+	cache := NewLocationCache(10, nil)
+	balancer := s.newBalancer(cache)
+	content := "moved to another backend"
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	s.backends[2].put(content)
+	cache.Add(hash, s.backends[0].server.URL)
+
+	s.Equal(http.StatusOK, s.request(balancer.FileInfoHandler, http.MethodGet, hash).Code)
+	s.Equal([]string{s.backends[2].server.URL}, cache.Get(hash))
+
+	missing := fmt.Sprintf("%064x", 1)
+	cache.Add(missing, s.backends[0].server.URL)
+	s.Equal(http.StatusNotFound, s.request(balancer.FileInfoHandler, http.MethodGet, missing).Code)
+	s.Nil(cache.Get(missing))
+}
+
+// TestDeleteForgetsLocation tests that deleting a hash drops its cached locations
+func (s *LocationCacheTestSuite) TestDeleteForgetsLocation() {
+	cache := NewLocationCache(10, nil)
+	balancer := s.newBalancer(cache)
+	hash := fmt.Sprintf("%064x", 2)
+	cache.Add(hash, s.backends[0].server.URL)
+
+	s.request(balancer.DeleteHandler, http.MethodDelete, hash)
+	s.Nil(cache.Get(hash))
+}
+
+func TestLocationCacheSuite(t *testing.T) {
+	suite.Run(t, new(LocationCacheTestSuite))
+}
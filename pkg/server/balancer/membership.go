@@ -0,0 +1,261 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NormalizeBackendURL trims whitespace and trailing slashes from a backend URL and checks
+// that it is an absolute http or https URL.
+func NormalizeBackendURL(backendURL string) (string, error) {
+	backendURL = strings.TrimRight(strings.TrimSpace(backendURL), "/")
+	parsed, err := url.Parse(backendURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalidBackendURL, backendURL)
+	}
+	return backendURL, nil
+}
+
+// AddBackend adds a backend at runtime. Its circuit starts open, so it is offline until its
+// first health check, which runs right away, succeeds. ReloadBackends keeps the backend.
+func (bm *BackendManager) AddBackend(backendURL string) error {
+	bm.mu.Lock()
+	if _, exists := bm.backends[backendURL]; exists {
+		bm.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrBackendExists, backendURL)
+	}
+	bm.addBackendLocked(backendURL, models.CircuitOpen)
+	bm.adminAdded[backendURL] = true
+	delete(bm.adminRemoved, backendURL)
+	bm.mu.Unlock()
+
+	log.Info().Str("backend", backendURL).Msg("Backend added")
+	go bm.checkBackend(backendURL)
+	return nil
+}
+
+// RemoveBackend removes a backend at runtime. Requests already sent to it are not affected.
+// ReloadBackends does not add the backend back.
+func (bm *BackendManager) RemoveBackend(backendURL string) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if _, exists := bm.backends[backendURL]; !exists {
+		return fmt.Errorf("%w: %s", ErrBackendNotFound, backendURL)
+	}
+	bm.removeBackendLocked(backendURL)
+	delete(bm.adminAdded, backendURL)
+	bm.adminRemoved[backendURL] = true
+
+	log.Info().Str("backend", backendURL).Msg("Backend removed")
+	return nil
+}
+
+// SetDraining sets whether a backend is draining. A draining backend still serves reads and
+// deletes but is not chosen for new uploads or repair copies.
+func (bm *BackendManager) SetDraining(backendURL string, draining bool) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	status, exists := bm.backends[backendURL]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrBackendNotFound, backendURL)
+	}
+	status.Draining = draining
+
+	log.Info().Str("backend", backendURL).Bool("draining", draining).Msg("Backend drain state changed")
+	return nil
+}
+
+// SetWeight sets the placement weight of a backend. Zero derives it from the capacity the
+// node reports again.
+func (bm *BackendManager) SetWeight(backendURL string, weight float64) error {
+	if weight < 0 {
+		return fmt.Errorf("%w: %g", ErrInvalidWeight, weight)
+	}
+
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	status, exists := bm.backends[backendURL]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrBackendNotFound, backendURL)
+	}
+	status.Weight = weight
+
+	log.Info().Str("backend", backendURL).Float64("weight", weight).Msg("Backend weight changed")
+	return nil
+}
+
+// SyncBackends makes the configured backends match backendURLs, keeping the state of
+// backends present in both. It returns the added and removed backends.
+func (bm *BackendManager) SyncBackends(backendURLs []string) (added, removed []string) {
+	bm.mu.Lock()
+	for _, backendURL := range backendURLs {
+		if _, exists := bm.backends[backendURL]; !exists && !slices.Contains(added, backendURL) {
+			bm.addBackendLocked(backendURL, models.CircuitOpen)
+			added = append(added, backendURL)
+		}
+	}
+	for backendURL := range bm.backends {
+		if !slices.Contains(backendURLs, backendURL) {
+			bm.removeBackendLocked(backendURL)
+			removed = append(removed, backendURL)
+		}
+	}
+	bm.mu.Unlock()
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	if len(added) > 0 || len(removed) > 0 {
+		log.Info().Strs("added", added).Strs("removed", removed).Msg("Backends synchronized")
+	}
+	for _, backendURL := range added {
+		go bm.checkBackend(backendURL)
+	}
+	return added, removed
+}
+
+// ReloadBackends syncs the backends with a reloaded configuration listing backendURLs. Changes
+// made through the admin API since startup win over the configuration: backends added with
+// AddBackend are kept and backends removed with RemoveBackend stay removed.
+func (bm *BackendManager) ReloadBackends(backendURLs []string) (added, removed []string) {
+	bm.mu.RLock()
+	wanted := make([]string, 0, len(backendURLs)+len(bm.adminAdded))
+	for _, backendURL := range backendURLs {
+		if !bm.adminRemoved[backendURL] {
+			wanted = append(wanted, backendURL)
+		}
+	}
+	for backendURL := range bm.adminAdded {
+		wanted = append(wanted, backendURL)
+	}
+	bm.mu.RUnlock()
+
+	return bm.SyncBackends(wanted)
+}
+
+// ListBackendsHandler handles GET /admin/backends.
+func (bm *BackendManager) ListBackendsHandler(ctx echo.Context) error {
+	statuses := bm.GetAllBackendStatus()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].URL < statuses[j].URL })
+	return ctx.JSON(http.StatusOK, map[string]interface{}{
+		"backends": statuses,
+	})
+}
+
+// AddBackendHandler handles POST /admin/backends.
+func (bm *BackendManager) AddBackendHandler(ctx echo.Context) error {
+	update, err := bindBackendUpdate(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if update.Weight != nil && *update.Weight < 0 {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": ErrInvalidWeight.Error(),
+		})
+	}
+
+	if err := bm.AddBackend(update.URL); err != nil {
+		return ctx.JSON(http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if err := bm.applyBackendUpdate(update); err != nil {
+		return backendErrorResponse(ctx, err)
+	}
+
+	status, _ := bm.GetBackendStatus(update.URL)
+	return ctx.JSON(http.StatusCreated, status)
+}
+
+// UpdateBackendHandler handles PATCH /admin/backends.
+func (bm *BackendManager) UpdateBackendHandler(ctx echo.Context) error {
+	update, err := bindBackendUpdate(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := bm.applyBackendUpdate(update); err != nil {
+		return backendErrorResponse(ctx, err)
+	}
+
+	status, exists := bm.GetBackendStatus(update.URL)
+	if !exists {
+		return backendErrorResponse(ctx, ErrBackendNotFound)
+	}
+	return ctx.JSON(http.StatusOK, status)
+}
+
+// RemoveBackendHandler handles DELETE /admin/backends?url=.
+func (bm *BackendManager) RemoveBackendHandler(ctx echo.Context) error {
+	backendURL, err := NormalizeBackendURL(ctx.QueryParam("url"))
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if err := bm.RemoveBackend(backendURL); err != nil {
+		return backendErrorResponse(ctx, err)
+	}
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// applyBackendUpdate sets the drain state and weight given in an update.
+func (bm *BackendManager) applyBackendUpdate(update *models.BackendUpdate) error {
+	if update.Weight != nil {
+		if err := bm.SetWeight(update.URL, *update.Weight); err != nil {
+			return err
+		}
+	}
+	if update.Draining != nil {
+		if err := bm.SetDraining(update.URL, *update.Draining); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindBackendUpdate parses a backend update from the request body and normalizes its URL.
+func bindBackendUpdate(ctx echo.Context) (*models.BackendUpdate, error) {
+	var update models.BackendUpdate
+	if err := ctx.Bind(&update); err != nil {
+		return nil, fmt.Errorf("invalid request body: %w", err)
+	}
+
+	backendURL, err := NormalizeBackendURL(update.URL)
+	if err != nil {
+		return nil, err
+	}
+	update.URL = backendURL
+	return &update, nil
+}
+
+// backendErrorResponse maps a membership error to its HTTP response.
+func backendErrorResponse(ctx echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrBackendNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrInvalidWeight):
+		status = http.StatusBadRequest
+	}
+	return ctx.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
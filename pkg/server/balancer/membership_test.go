@@ -0,0 +1,222 @@
+package balancer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+// MembershipTestSuite tests changing the backends of a running balancer
+type MembershipTestSuite struct {
+	suite.Suite
+	backends []*blobBackend
+	manager  *BackendManager
+	echo     *echo.Echo
+}
+
+// SetupTest starts two in-memory backends of which only the first is configured
+func (s *MembershipTestSuite) SetupTest() {
+	s.backends = []*blobBackend{newBlobBackend(), newBlobBackend()}
+	s.manager = NewBackendManager([]string{s.backends[0].server.URL}, time.Minute, 5*time.Second)
+	s.manager.Start()
+
+	s.echo = echo.New()
+	s.echo.GET("/admin/backends", s.manager.ListBackendsHandler)
+	s.echo.POST("/admin/backends", s.manager.AddBackendHandler)
+	s.echo.PATCH("/admin/backends", s.manager.UpdateBackendHandler)
+	s.echo.DELETE("/admin/backends", s.manager.RemoveBackendHandler)
+}
+
+// TearDownTest stops the backend manager and the backends
+func (s *MembershipTestSuite) TearDownTest() {
+	s.manager.Stop()
+	for _, backend := range s.backends {
+		backend.server.Close()
+	}
+}
+
+// request sends an admin request with an optional JSON body
+func (s *MembershipTestSuite) request(method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	s.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+// online reports whether the manager considers backendURL online
+func (s *MembershipTestSuite) online(backendURL string) bool {
+	status, ok := s.manager.GetBackendStatus(backendURL)
+	return ok && status.Online
+}
+
+// TestAddBackendComesOnline tests that an added backend is health checked and then used
+func (s *MembershipTestSuite) TestAddBackendComesOnline() {
+	added := s.backends[1].server.URL
+	s.Require().NoError(s.manager.AddBackend(added))
+	s.ErrorIs(s.manager.AddBackend(added), ErrBackendExists)
+
+	s.Eventually(func() bool { return s.online(added) }, time.Second, 10*time.Millisecond)
+	s.ElementsMatch([]string{s.backends[0].server.URL, added}, s.manager.GetOnlineBackends())
+}
+
+// TestRemoveBackend tests that a removed backend is no longer used
+func (s *MembershipTestSuite) TestRemoveBackend() {
+	removed := s.backends[0].server.URL
+	s.Require().NoError(s.manager.RemoveBackend(removed))
+	s.ErrorIs(s.manager.RemoveBackend(removed), ErrBackendNotFound)
+
+	s.Empty(s.manager.GetOnlineBackends())
+	s.Zero(s.manager.BackendCount())
+
+	// A health check still running for the removed backend does not bring it back
+	s.manager.checkBackend(removed)
+	s.Zero(s.manager.BackendCount())
+}
+
+// TestDrainingExcludesUploadsOnly tests that a draining backend keeps serving reads but gets no uploads
+func (s *MembershipTestSuite) TestDrainingExcludesUploadsOnly() {
+	drained := s.backends[0].server.URL
+	s.Require().NoError(s.manager.SetDraining(drained, true))
+
+	_, err := s.manager.GetBackendsForUpload(10, 1)
+	s.ErrorIs(err, ErrNoBackendAvailable)
+	s.Equal([]string{drained}, s.manager.GetOnlineBackends())
+
+	// Health checks keep the drain state
+	s.manager.checkBackend(drained)
+	status, _ := s.manager.GetBackendStatus(drained)
+	s.True(status.Draining)
+
+	s.Require().NoError(s.manager.SetDraining(drained, false))
+	backends, err := s.manager.GetBackendsForUpload(10, 1)
+	s.Require().NoError(err)
+	s.Equal([]string{drained}, backends)
+
+	s.ErrorIs(s.manager.SetDraining("http://unknown:8080", true), ErrBackendNotFound)
+}
+
+// TestSetWeightOverridesCapacity tests that an operator weight replaces the capacity-derived one
+func (s *MembershipTestSuite) TestSetWeightOverridesCapacity() {
+	backendURL := s.backends[0].server.URL
+	s.Require().NoError(s.manager.SetWeight(backendURL, 2.5))
+	status, _ := s.manager.GetBackendStatus(backendURL)
+	s.InDelta(2.5, backendWeight(status), 0)
+
+	s.Require().NoError(s.manager.SetWeight(backendURL, 0))
+	status, _ = s.manager.GetBackendStatus(backendURL)
+	s.InDelta(1.0, backendWeight(status), 0)
+
+	s.ErrorIs(s.manager.SetWeight(backendURL, -1), ErrInvalidWeight)
+}
+
+// TestSyncBackends tests that syncing adds missing backends, removes extra ones and keeps the state of the rest
+func (s *MembershipTestSuite) TestSyncBackends() {
+	kept := s.backends[0].server.URL
+	added := s.backends[1].server.URL
+	s.Require().NoError(s.manager.SetDraining(kept, true))
+	s.Require().NoError(s.manager.AddBackend("http://stale:8080"))
+
+	addedURLs, removedURLs := s.manager.SyncBackends([]string{kept, added, added})
+	s.Equal([]string{added}, addedURLs)
+	s.Equal([]string{"http://stale:8080"}, removedURLs)
+
+	status, _ := s.manager.GetBackendStatus(kept)
+	s.True(status.Draining)
+	s.Eventually(func() bool { return s.online(added) }, time.Second, 10*time.Millisecond)
+
+	addedURLs, removedURLs = s.manager.SyncBackends([]string{kept, added})
+	s.Empty(addedURLs)
+	s.Empty(removedURLs)
+}
+
+// TestReloadBackendsKeepsAdminChanges tests that a configuration reload keeps the backends
+// added and removed through the admin API
+func (s *MembershipTestSuite) TestReloadBackendsKeepsAdminChanges() {
+	configured := s.backends[0].server.URL
+	removed := s.backends[1].server.URL
+	added := "http://added:8080"
+	s.Require().NoError(s.manager.AddBackend(added))
+	s.Require().NoError(s.manager.AddBackend(removed))
+	s.Require().NoError(s.manager.RemoveBackend(removed))
+
+	addedURLs, removedURLs := s.manager.ReloadBackends([]string{configured, removed})
+	s.Empty(addedURLs)
+	s.Empty(removedURLs)
+	s.ElementsMatch([]string{configured, added}, s.manager.AllBackendURLs())
+
+	// Adding the removed backend back through the admin API lets the configuration keep it
+	s.Require().NoError(s.manager.AddBackend(removed))
+	s.Require().NoError(s.manager.RemoveBackend(added))
+	s.manager.ReloadBackends([]string{configured, removed})
+	s.ElementsMatch([]string{configured, removed}, s.manager.AllBackendURLs())
+}
+
+// TestNormalizeBackendURL tests backend URL validation
+func (s *MembershipTestSuite) TestNormalizeBackendURL() {
+	backendURL, err := NormalizeBackendURL(" http://server1:8080/ ")
+	s.Require().NoError(err)
+	s.Equal("http://server1:8080", backendURL)
+
+	for _, invalid := range []string{"", "server1:8080", "ftp://server1", "http://"} {
+		_, err := NormalizeBackendURL(invalid)
+		s.ErrorIs(err, ErrInvalidBackendURL, invalid)
+	}
+}
+
+// TestAdminHandlers tests adding, changing, listing and removing backends over HTTP
+func (s *MembershipTestSuite) TestAdminHandlers() {
+	added := s.backends[1].server.URL
+
+	rec := s.request(http.MethodPost, "/admin/backends", `{"url":"`+added+`/","draining":true,"weight":3}`)
+	s.Require().Equal(http.StatusCreated, rec.Code, rec.Body.String())
+	var status models.BackendStatus
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &status))
+	s.Equal(added, status.URL)
+	s.True(status.Draining)
+	s.InDelta(3.0, status.Weight, 0)
+
+	rec = s.request(http.MethodPost, "/admin/backends", `{"url":"`+added+`"}`)
+	s.Equal(http.StatusConflict, rec.Code)
+	rec = s.request(http.MethodPost, "/admin/backends", `{"url":"not a url"}`)
+	s.Equal(http.StatusBadRequest, rec.Code)
+	rec = s.request(http.MethodPost, "/admin/backends", `{"url":"http://other:8080","weight":-1}`)
+	s.Equal(http.StatusBadRequest, rec.Code)
+	_, exists := s.manager.GetBackendStatus("http://other:8080")
+	s.False(exists)
+
+	rec = s.request(http.MethodPatch, "/admin/backends", `{"url":"`+added+`","draining":false}`)
+	s.Require().Equal(http.StatusOK, rec.Code, rec.Body.String())
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &status))
+	s.False(status.Draining)
+	s.InDelta(3.0, status.Weight, 0)
+
+	rec = s.request(http.MethodPatch, "/admin/backends", `{"url":"http://unknown:8080","draining":true}`)
+	s.Equal(http.StatusNotFound, rec.Code)
+
+	rec = s.request(http.MethodGet, "/admin/backends", "")
+	s.Require().Equal(http.StatusOK, rec.Code)
+	var list struct {
+		Backends []models.BackendStatus `json:"backends"`
+	}
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &list))
+	s.Len(list.Backends, 2)
+
+	rec = s.request(http.MethodDelete, "/admin/backends?url="+added, "")
+	s.Equal(http.StatusNoContent, rec.Code)
+	rec = s.request(http.MethodDelete, "/admin/backends?url="+added, "")
+	s.Equal(http.StatusNotFound, rec.Code)
+	s.Equal(1, s.manager.BackendCount())
+}
+
+func TestMembershipSuite(t *testing.T) {
+	suite.Run(t, new(MembershipTestSuite))
+}
@@ -0,0 +1,987 @@
+package balancer
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"loopfs/pkg/bucket"
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Default metadata replication settings.
+const (
+	DefaultMetadataHeartbeatInterval = 500 * time.Millisecond
+	DefaultMetadataElectionTimeout   = 3 * time.Second
+	DefaultMetadataCommitTimeout     = 5 * time.Second
+	DefaultMetadataLogRetention      = 10000
+)
+
+const (
+	// metadataAppendBatch is the number of log entries sent to a follower at a time.
+	metadataAppendBatch = 500
+	// metadataSnapshotTimeout bounds sending a snapshot to a follower.
+	metadataSnapshotTimeout = time.Minute
+	// metadataPruneInterval is how often the replication log is pruned.
+	metadataPruneInterval = time.Minute
+	// forwardedByHeader marks bucket requests a follower forwarded to the leader.
+	forwardedByHeader = "X-LoopFS-Forwarded-By"
+)
+
+// MetadataReplicationConfig configures the replication of bucket metadata between balancers.
+type MetadataReplicationConfig struct {
+	// Self is the URL the other balancers reach this one at. Empty disables replication.
+	Self string
+	// Peers are the URLs of the other balancers.
+	Peers []string
+	// Token is sent as bearer token to the peers and required on this balancer's replication
+	// endpoints. Replication does not start without it.
+	Token string
+	// HeartbeatInterval is how often the leader contacts each follower.
+	HeartbeatInterval time.Duration
+	// ElectionTimeout is how long a follower waits for the leader before standing for
+	// election, and how long the leader keeps leading without reaching a majority.
+	ElectionTimeout time.Duration
+	// CommitTimeout is how long a change waits to be stored by a majority before it fails.
+	CommitTimeout time.Duration
+	// LogRetention is the number of log entries kept; followers further behind get a snapshot.
+	LogRetention int
+}
+
+// Enabled reports whether metadata replication is configured.
+func (c MetadataReplicationConfig) Enabled() bool {
+	return c.Self != ""
+}
+
+// withDefaults replaces unset settings with their defaults.
+func (c MetadataReplicationConfig) withDefaults() MetadataReplicationConfig {
+	if c.HeartbeatInterval <= 0 {
+		c.HeartbeatInterval = DefaultMetadataHeartbeatInterval
+	}
+	if c.ElectionTimeout <= 0 {
+		c.ElectionTimeout = DefaultMetadataElectionTimeout
+	}
+	if c.CommitTimeout <= 0 {
+		c.CommitTimeout = DefaultMetadataCommitTimeout
+	}
+	if c.LogRetention <= 0 {
+		c.LogRetention = DefaultMetadataLogRetention
+	}
+	return c
+}
+
+// normalize trims the URLs and checks that they are absolute http or https URLs and that
+// this balancer is not among its peers.
+func (c MetadataReplicationConfig) normalize() (MetadataReplicationConfig, error) {
+	if !c.Enabled() {
+		if len(c.Peers) > 0 {
+			return c, fmt.Errorf("%w: peers require the URL of this balancer", ErrInvalidPeerURL)
+		}
+		return c, nil
+	}
+	self, err := NormalizeBackendURL(c.Self)
+	if err != nil {
+		return c, fmt.Errorf("%w: %q", ErrInvalidPeerURL, c.Self)
+	}
+	peers := make([]string, 0, len(c.Peers))
+	for _, peer := range c.Peers {
+		normalized, err := NormalizeBackendURL(peer)
+		if err != nil {
+			return c, fmt.Errorf("%w: %q", ErrInvalidPeerURL, peer)
+		}
+		if normalized == self {
+			return c, fmt.Errorf("%w: peers must not include this balancer", ErrInvalidPeerURL)
+		}
+		if !slices.Contains(peers, normalized) {
+			peers = append(peers, normalized)
+		}
+	}
+	c.Self = self
+	c.Peers = peers
+	return c, nil
+}
+
+// metadataPeer is the leader's view of one follower.
+type metadataPeer struct {
+	url          string
+	nextSeq      int64 // Next log entry to send
+	matchSeq     int64 // Last log entry known to be stored by the peer
+	needSnapshot bool
+	lastAck      time.Time // When the last acknowledged request was sent
+	lastError    string
+}
+
+// MetadataReplicator replicates the bucket store between balancers so each of them can serve
+// the bucket API. The balancers elect a leader by majority vote; the leader makes all changes
+// and ships its replication log to the followers, which forward changes they receive to it.
+// A change succeeds once a majority of balancers store it, so it survives the loss of the
+// leader. A leader that cannot reach a majority for the election timeout stops accepting
+// changes, so a partitioned minority never diverges.
+type MetadataReplicator struct {
+	store  bucket.ReplicatedStore
+	config MetadataReplicationConfig
+	client *http.Client
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	// stateMu serializes saving the election state, which is written without holding mu so
+	// heartbeats and votes do not wait for the store
+	stateMu   sync.Mutex
+	savedTerm int64
+	savedVote string
+
+	mu               sync.Mutex
+	role             string
+	term             int64
+	votedFor         string
+	leader           string
+	lastContact      time.Time // When the leader was last heard from
+	electionDeadline time.Time
+	peers            []*metadataPeer
+	progress         chan struct{} // Closed and replaced when a peer stores more entries or the role changes
+	appendSignal     chan struct{} // Closed and replaced to send new entries to the followers
+}
+
+// NewMetadataReplicator creates a replicator for store. It must be set as the store's
+// replication hook before the store is used.
+func NewMetadataReplicator(store bucket.ReplicatedStore, config MetadataReplicationConfig) (*MetadataReplicator, error) {
+	config, err := config.normalize()
+	if err != nil {
+		return nil, err
+	}
+	config = config.withDefaults()
+	if config.Enabled() && config.Token == "" {
+		return nil, ErrReplicationWithoutToken
+	}
+
+	r := &MetadataReplicator{
+		store:        store,
+		config:       config,
+		client:       &http.Client{},
+		stop:         make(chan struct{}),
+		role:         models.ReplicaFollower,
+		progress:     make(chan struct{}),
+		appendSignal: make(chan struct{}),
+	}
+	for _, peer := range config.Peers {
+		r.peers = append(r.peers, &metadataPeer{url: peer})
+	}
+	return r, nil
+}
+
+// Start loads the election state and starts the election timer and the follower updates.
+// A balancer without peers leads right away.
+func (r *MetadataReplicator) Start() error {
+	term, votedFor, err := r.store.ElectionState(context.Background())
+	if err != nil {
+		return err
+	}
+
+	r.stateMu.Lock()
+	r.savedTerm, r.savedVote = term, votedFor
+	r.stateMu.Unlock()
+	r.mu.Lock()
+	r.term = term
+	r.votedFor = votedFor
+	r.resetElectionDeadlineLocked(time.Now())
+	r.mu.Unlock()
+	metadataTerm.Set(float64(term))
+
+	if len(r.peers) == 0 {
+		r.startElection()
+	}
+
+	r.wg.Add(1)
+	go r.run()
+	for _, peer := range r.peers {
+		r.wg.Add(1)
+		go r.replicateLoop(peer)
+	}
+	log.Info().Str("self", r.config.Self).Strs("peers", r.config.Peers).Int64("term", term).
+		Msg("Metadata replication started")
+	return nil
+}
+
+// Stop stops replicating and waits for requests to the peers to finish.
+func (r *MetadataReplicator) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.role = models.ReplicaFollower
+	r.leader = ""
+	r.notifyProgressLocked()
+}
+
+// run starts elections when the leader is silent, steps down when a majority is unreachable
+// and prunes the replication log.
+func (r *MetadataReplicator) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.config.HeartbeatInterval)
+	defer ticker.Stop()
+	prune := time.NewTicker(metadataPruneInterval)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-prune.C:
+			r.pruneLog()
+		case now := <-ticker.C:
+			r.mu.Lock()
+			switch {
+			case r.role == models.ReplicaLeader && !r.leaseValidLocked(now):
+				log.Warn().Int64("term", r.term).Msg("Metadata leader lost contact with a majority, stepping down")
+				r.becomeFollowerLocked(r.term)
+				r.resetElectionDeadlineLocked(now)
+			case r.role != models.ReplicaLeader && now.After(r.electionDeadline):
+				r.mu.Unlock()
+				r.startElection()
+				continue
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// majority returns the number of balancers, including this one, that form a majority.
+func (r *MetadataReplicator) majority() int {
+	return (len(r.peers)+1)/2 + 1
+}
+
+// resetElectionDeadlineLocked schedules the next election after a randomized timeout, so
+// followers rarely stand at the same time. r.mu must be held.
+func (r *MetadataReplicator) resetElectionDeadlineLocked(now time.Time) {
+	timeout := r.config.ElectionTimeout + rand.N(r.config.ElectionTimeout) //nolint:gosec // Jitter only
+	r.electionDeadline = now.Add(timeout)
+}
+
+// leaseValidLocked reports whether a majority acknowledged the leader within the election
+// timeout. Followers do not vote for another candidate while they hear from the leader, so
+// no other leader can be elected meanwhile. r.mu must be held.
+func (r *MetadataReplicator) leaseValidLocked(now time.Time) bool {
+	acks := 1
+	for _, peer := range r.peers {
+		if now.Sub(peer.lastAck) < r.config.ElectionTimeout {
+			acks++
+		}
+	}
+	return acks >= r.majority()
+}
+
+// notifyProgressLocked wakes changes waiting to be replicated. r.mu must be held.
+func (r *MetadataReplicator) notifyProgressLocked() {
+	close(r.progress)
+	r.progress = make(chan struct{})
+}
+
+// signalAppendLocked wakes the follower updates to send new entries. r.mu must be held.
+func (r *MetadataReplicator) signalAppendLocked() {
+	close(r.appendSignal)
+	r.appendSignal = make(chan struct{})
+}
+
+// setTermLocked moves to a newer term, forgetting the vote of the old one. r.mu must be held.
+// The new state must be saved with saveElectionState before a peer is answered or asked for
+// its vote.
+func (r *MetadataReplicator) setTermLocked(term int64, votedFor string) {
+	r.term = term
+	r.votedFor = votedFor
+	metadataTerm.Set(float64(term))
+}
+
+// saveElectionState writes the current term and vote to the store unless they are saved
+// already. r.mu must not be held.
+func (r *MetadataReplicator) saveElectionState() error {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	r.mu.Lock()
+	term, votedFor := r.term, r.votedFor
+	r.mu.Unlock()
+	if term == r.savedTerm && votedFor == r.savedVote {
+		return nil
+	}
+	if err := r.store.SetElectionState(context.Background(), term, votedFor); err != nil {
+		log.Error().Err(err).Int64("term", term).Msg("Failed to save metadata election state")
+		return err
+	}
+	r.savedTerm, r.savedVote = term, votedFor
+	return nil
+}
+
+// becomeFollowerLocked follows in term, which is at least the current term. r.mu must be held.
+func (r *MetadataReplicator) becomeFollowerLocked(term int64) {
+	if term > r.term {
+		r.setTermLocked(term, "")
+	}
+	if r.role == models.ReplicaLeader {
+		log.Info().Int64("term", term).Msg("No longer the metadata leader")
+	}
+	if r.role != models.ReplicaFollower {
+		r.role = models.ReplicaFollower
+		r.leader = ""
+		r.notifyProgressLocked()
+	}
+	metadataLeader.Set(0)
+}
+
+// startElection stands for election in a new term and becomes leader if a majority votes for
+// this balancer.
+func (r *MetadataReplicator) startElection() {
+	lastSeq, lastTerm, err := r.store.LastLogPosition(context.Background())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to read the metadata log position")
+		return
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	r.role = models.ReplicaCandidate
+	r.leader = ""
+	r.setTermLocked(r.term+1, r.config.Self)
+	r.resetElectionDeadlineLocked(now)
+	term := r.term
+	r.mu.Unlock()
+	if err := r.saveElectionState(); err != nil {
+		return
+	}
+	log.Info().Int64("term", term).Msg("Standing for metadata leader election")
+
+	request := models.VoteRequest{Term: term, Candidate: r.config.Self, LastSeq: lastSeq, LastTerm: lastTerm}
+	var (
+		wg      sync.WaitGroup
+		granted []*metadataPeer
+		grantMu sync.Mutex
+	)
+	for _, peer := range r.peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var response models.VoteResponse
+			ctx, cancel := context.WithTimeout(context.Background(), r.config.ElectionTimeout/2)
+			defer cancel()
+			if err := r.call(ctx, peer.url, "/replication/vote", request, &response); err != nil {
+				log.Debug().Err(err).Str("peer", peer.url).Msg("Vote request failed")
+				return
+			}
+			r.observeTerm(response.Term)
+			if response.Granted {
+				grantMu.Lock()
+				granted = append(granted, peer)
+				grantMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.role != models.ReplicaCandidate || r.term != term {
+		return
+	}
+	if len(granted)+1 < r.majority() {
+		metadataElectionsTotal.WithLabelValues("lost").Inc()
+		log.Info().Int64("term", term).Int("votes", len(granted)+1).Msg("Metadata leader election lost")
+		return
+	}
+
+	metadataElectionsTotal.WithLabelValues("won").Inc()
+	r.role = models.ReplicaLeader
+	r.leader = r.config.Self
+	for _, peer := range r.peers {
+		peer.nextSeq = lastSeq + 1
+		peer.matchSeq = 0
+		peer.needSnapshot = false
+		peer.lastAck = time.Time{}
+	}
+	for _, peer := range granted {
+		// A vote is an acknowledgement: the voter ignores other candidates for a while
+		peer.lastAck = now
+	}
+	r.notifyProgressLocked()
+	r.signalAppendLocked()
+	metadataLeader.Set(1)
+	log.Info().Int64("term", term).Int("votes", len(granted)+1).Msg("Elected metadata leader")
+}
+
+// observeTerm follows a newer term seen in a peer's response.
+func (r *MetadataReplicator) observeTerm(term int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if term > r.term {
+		r.becomeFollowerLocked(term)
+		r.resetElectionDeadlineLocked(time.Now())
+	}
+}
+
+// replicateLoop keeps one follower up to date while this balancer leads.
+func (r *MetadataReplicator) replicateLoop(peer *metadataPeer) {
+	defer r.wg.Done()
+
+	for {
+		r.mu.Lock()
+		signal := r.appendSignal
+		leading := r.role == models.ReplicaLeader
+		term := r.term
+		r.mu.Unlock()
+
+		more := false
+		if leading {
+			more = r.replicateTo(peer, term)
+		}
+		if more {
+			continue
+		}
+
+		timer := time.NewTimer(r.config.HeartbeatInterval)
+		select {
+		case <-r.stop:
+			timer.Stop()
+			return
+		case <-signal:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// replicateTo sends the follower the log entries it is missing, a heartbeat if there are none,
+// or a snapshot if its log diverged or the entries were pruned. It reports whether more
+// entries are waiting.
+func (r *MetadataReplicator) replicateTo(peer *metadataPeer, term int64) bool {
+	r.mu.Lock()
+	prevSeq := peer.nextSeq - 1
+	needSnapshot := peer.needSnapshot
+	r.mu.Unlock()
+
+	if needSnapshot {
+		r.sendSnapshot(peer, term)
+		return false
+	}
+
+	prevTerm, found, err := r.store.LogTerm(context.Background(), prevSeq)
+	if err != nil {
+		r.recordPeerError(peer, err)
+		return false
+	}
+	var entries []models.MetadataLogEntry
+	if found {
+		entries, err = r.store.LogEntriesAfter(context.Background(), prevSeq, metadataAppendBatch)
+	}
+	if !found || errors.Is(err, bucket.ErrLogPruned) {
+		r.sendSnapshot(peer, term)
+		return false
+	}
+	if err != nil {
+		r.recordPeerError(peer, err)
+		return false
+	}
+
+	lastSeq, _, err := r.store.LastLogPosition(context.Background())
+	if err != nil {
+		r.recordPeerError(peer, err)
+		return false
+	}
+
+	request := models.AppendRequest{
+		Term: term, Leader: r.config.Self, PrevSeq: prevSeq, PrevTerm: prevTerm, Entries: entries,
+	}
+	var response models.AppendResponse
+	sent := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.ElectionTimeout/2)
+	defer cancel()
+	if err := r.call(ctx, peer.url, "/replication/append", request, &response); err != nil {
+		r.recordPeerError(peer, err)
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.acceptResponseLocked(peer, term, response.Term, sent) {
+		return false
+	}
+	switch {
+	case response.Success && response.LastSeq > lastSeq:
+		// The follower kept entries of an old term that never reached a majority
+		peer.needSnapshot = true
+		return true
+	case response.Success:
+		r.advancePeerLocked(peer, prevSeq+int64(len(entries)))
+		return len(entries) == metadataAppendBatch
+	case response.NeedSnapshot:
+		peer.needSnapshot = true
+		return true
+	default:
+		// The follower's log ends before prevSeq; continue after its last entry
+		peer.nextSeq = min(response.LastSeq, prevSeq-1) + 1
+		return true
+	}
+}
+
+// sendSnapshot replaces the follower's metadata with a snapshot of this balancer's.
+func (r *MetadataReplicator) sendSnapshot(peer *metadataPeer, term int64) {
+	snapshot, err := r.store.Snapshot(context.Background())
+	if err != nil {
+		r.recordPeerError(peer, err)
+		return
+	}
+
+	request := models.InstallSnapshotRequest{Term: term, Leader: r.config.Self, Snapshot: *snapshot}
+	var response models.AppendResponse
+	sent := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), metadataSnapshotTimeout)
+	defer cancel()
+	if err := r.call(ctx, peer.url, "/replication/snapshot", request, &response); err != nil {
+		r.recordPeerError(peer, err)
+		return
+	}
+	metadataSnapshotsSentTotal.Inc()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.acceptResponseLocked(peer, term, response.Term, sent) || !response.Success {
+		return
+	}
+	peer.needSnapshot = false
+	r.advancePeerLocked(peer, snapshot.Seq)
+	log.Info().Str("peer", peer.url).Int64("seq", snapshot.Seq).Msg("Sent metadata snapshot to follower")
+}
+
+// acceptResponseLocked handles the term of a follower's response and records the
+// acknowledgement. It reports false if this balancer no longer leads in term. r.mu must be held.
+func (r *MetadataReplicator) acceptResponseLocked(peer *metadataPeer, term, responseTerm int64, sent time.Time) bool {
+	if responseTerm > r.term {
+		r.becomeFollowerLocked(responseTerm)
+		r.resetElectionDeadlineLocked(time.Now())
+		return false
+	}
+	if r.role != models.ReplicaLeader || r.term != term {
+		return false
+	}
+	peer.lastAck = sent
+	peer.lastError = ""
+	return true
+}
+
+// advancePeerLocked records that the follower stores the log up to seq. r.mu must be held.
+func (r *MetadataReplicator) advancePeerLocked(peer *metadataPeer, seq int64) {
+	if seq > peer.matchSeq {
+		peer.matchSeq = seq
+		r.notifyProgressLocked()
+	}
+	peer.nextSeq = peer.matchSeq + 1
+	if lastSeq, _, err := r.store.LastLogPosition(context.Background()); err == nil {
+		metadataPeerLag.WithLabelValues(peer.url).Set(float64(lastSeq - peer.matchSeq))
+	}
+}
+
+// recordPeerError remembers the last error of a follower for the status.
+func (r *MetadataReplicator) recordPeerError(peer *metadataPeer, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if peer.lastError != err.Error() {
+		log.Warn().Err(err).Str("peer", peer.url).Msg("Metadata replication to peer failed")
+	}
+	peer.lastError = err.Error()
+}
+
+// call posts request as JSON to a peer and decodes its JSON response.
+func (r *MetadataReplicator) call(ctx context.Context, peer, path string, request, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+r.config.Token)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// pruneLog drops log entries beyond the retention.
+func (r *MetadataReplicator) pruneLog() {
+	lastSeq, _, err := r.store.LastLogPosition(context.Background())
+	if err != nil || lastSeq <= int64(r.config.LogRetention) {
+		return
+	}
+	deleted, err := r.store.PruneLog(context.Background(), lastSeq-int64(r.config.LogRetention))
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to prune metadata log")
+		return
+	}
+	if deleted > 0 {
+		log.Debug().Int64("deleted", deleted).Msg("Pruned metadata log")
+	}
+}
+
+// LeaderTerm implements bucket.ReplicationHook: changes are only made by a leader holding
+// its lease.
+func (r *MetadataReplicator) LeaderTerm() (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.role != models.ReplicaLeader || !r.leaseValidLocked(time.Now()) {
+		return 0, ErrNotLeader
+	}
+	return r.term, nil
+}
+
+// WaitReplicated implements bucket.ReplicationHook. It sends the entry to the followers right
+// away and waits until a majority, counting this balancer, stores it.
+func (r *MetadataReplicator) WaitReplicated(seq int64) error {
+	timer := time.NewTimer(r.config.CommitTimeout)
+	defer timer.Stop()
+
+	r.mu.Lock()
+	r.signalAppendLocked()
+	for {
+		if r.role != models.ReplicaLeader {
+			r.mu.Unlock()
+			return fmt.Errorf("%w: lost leadership before entry %d was replicated", ErrNotReplicated, seq)
+		}
+		stored := 1
+		for _, peer := range r.peers {
+			if peer.matchSeq >= seq {
+				stored++
+			}
+		}
+		if stored >= r.majority() {
+			r.mu.Unlock()
+			return nil
+		}
+		progress := r.progress
+		r.mu.Unlock()
+
+		select {
+		case <-progress:
+		case <-timer.C:
+			return fmt.Errorf("%w: entry %d", ErrNotReplicated, seq)
+		}
+		r.mu.Lock()
+	}
+}
+
+// IsLeader reports whether this balancer leads. Webhooks are only delivered by the leader.
+func (r *MetadataReplicator) IsLeader() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.role == models.ReplicaLeader
+}
+
+// Status describes the replication state of this balancer.
+func (r *MetadataReplicator) Status() models.ReplicationStatus {
+	lastSeq, lastTerm, err := r.store.LastLogPosition(context.Background())
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read the metadata log position")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := models.ReplicationStatus{
+		Self:     r.config.Self,
+		Role:     r.role,
+		Term:     r.term,
+		Leader:   r.leader,
+		LastSeq:  lastSeq,
+		LastTerm: lastTerm,
+	}
+	if r.role == models.ReplicaLeader {
+		for _, peer := range r.peers {
+			replica := models.ReplicaPeer{URL: peer.url, MatchSeq: peer.matchSeq, LastError: peer.lastError}
+			if !peer.lastAck.IsZero() {
+				lastAck := peer.lastAck
+				replica.LastContact = &lastAck
+			}
+			status.Peers = append(status.Peers, replica)
+		}
+	}
+	return status
+}
+
+// vote answers a candidate's vote request.
+func (r *MetadataReplicator) vote(ctx context.Context, request *models.VoteRequest) (models.VoteResponse, error) {
+	lastSeq, lastTerm, err := r.store.LastLogPosition(ctx)
+	if err != nil {
+		return models.VoteResponse{}, err
+	}
+
+	response := r.decideVote(request, lastSeq, lastTerm)
+	if err := r.saveElectionState(); err != nil {
+		return models.VoteResponse{}, err
+	}
+	return response, nil
+}
+
+// decideVote decides a candidate's vote request given the last position of this balancer's
+// log. It locks r.mu.
+func (r *MetadataReplicator) decideVote(request *models.VoteRequest, lastSeq, lastTerm int64) models.VoteResponse {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Ignore candidates while the leader is alive, so a balancer that was cut off cannot
+	// depose it when it returns
+	leaderAlive := (r.role == models.ReplicaFollower && r.leader != "" &&
+		now.Sub(r.lastContact) < r.config.ElectionTimeout) ||
+		(r.role == models.ReplicaLeader && r.leaseValidLocked(now))
+	if leaderAlive {
+		return models.VoteResponse{Term: r.term}
+	}
+
+	if request.Term > r.term {
+		r.becomeFollowerLocked(request.Term)
+	}
+	upToDate := request.LastTerm > lastTerm || (request.LastTerm == lastTerm && request.LastSeq >= lastSeq)
+	if request.Term < r.term || (r.votedFor != "" && r.votedFor != request.Candidate) || !upToDate {
+		return models.VoteResponse{Term: r.term}
+	}
+
+	r.setTermLocked(r.term, request.Candidate)
+	r.resetElectionDeadlineLocked(now)
+	return models.VoteResponse{Term: r.term, Granted: true}
+}
+
+// followLocked accepts a request of the leader of term, following it. It reports false if
+// the request is from an older term. r.mu must be held.
+func (r *MetadataReplicator) followLocked(term int64, leader string) bool {
+	if term < r.term {
+		return false
+	}
+	if term > r.term || r.role != models.ReplicaFollower {
+		r.becomeFollowerLocked(term)
+	}
+	if r.leader != leader {
+		log.Info().Str("leader", leader).Int64("term", term).Msg("Following metadata leader")
+	}
+	now := time.Now()
+	r.leader = leader
+	r.lastContact = now
+	r.resetElectionDeadlineLocked(now)
+	return true
+}
+
+// appendEntries applies the leader's log entries. The term is checked under r.mu, but the
+// entries are written without it, so a slow store does not hold up elections and heartbeats.
+func (r *MetadataReplicator) appendEntries(ctx context.Context, request *models.AppendRequest) (models.AppendResponse, error) {
+	term, ok, err := r.follow(request.Term, request.Leader)
+	if err != nil {
+		return models.AppendResponse{}, err
+	}
+	if !ok {
+		return models.AppendResponse{Term: term}, nil
+	}
+
+	err = r.store.AppendLogEntries(ctx, request.PrevSeq, request.PrevTerm, request.Entries)
+	response := models.AppendResponse{Success: err == nil}
+	switch {
+	case errors.Is(err, bucket.ErrLogConflict):
+		log.Ctx(ctx).Warn().Int64("prev_seq", request.PrevSeq).Msg("Metadata log diverged from the leader, requesting a snapshot")
+		response.NeedSnapshot = true
+	case err != nil && !errors.Is(err, bucket.ErrLogGap):
+		return models.AppendResponse{}, err
+	}
+	if response.LastSeq, _, err = r.store.LastLogPosition(ctx); err != nil {
+		return models.AppendResponse{}, err
+	}
+
+	var current bool
+	if response.Term, current = r.stillFollowing(request.Term); !current {
+		return models.AppendResponse{Term: response.Term}, nil
+	}
+	return response, nil
+}
+
+// installSnapshot replaces the metadata with the leader's snapshot. Like appendEntries, it
+// does not hold r.mu while writing the store.
+func (r *MetadataReplicator) installSnapshot(ctx context.Context, request *models.InstallSnapshotRequest) (models.AppendResponse, error) {
+	term, ok, err := r.follow(request.Term, request.Leader)
+	if err != nil {
+		return models.AppendResponse{}, err
+	}
+	if !ok {
+		return models.AppendResponse{Term: term}, nil
+	}
+
+	if err := r.store.RestoreSnapshot(ctx, &request.Snapshot); err != nil {
+		return models.AppendResponse{}, err
+	}
+	log.Ctx(ctx).Info().Int64("seq", request.Snapshot.Seq).Int("buckets", len(request.Snapshot.Buckets)).
+		Msg("Installed metadata snapshot from leader")
+
+	var current bool
+	term, current = r.stillFollowing(request.Term)
+	if !current {
+		return models.AppendResponse{Term: term}, nil
+	}
+	return models.AppendResponse{Term: term, Success: true, LastSeq: request.Snapshot.Seq}, nil
+}
+
+// follow accepts a request of the leader of term, following it, and saves the new term. It
+// returns the current term and false if the request is from an older term.
+func (r *MetadataReplicator) follow(term int64, leader string) (int64, bool, error) {
+	r.mu.Lock()
+	ok := r.followLocked(term, leader)
+	current := r.term
+	r.mu.Unlock()
+	return current, ok, r.saveElectionState()
+}
+
+// stillFollowing returns the current term and reports whether it is still term, so a reply
+// written after the store was updated does not acknowledge a deposed leader.
+func (r *MetadataReplicator) stillFollowing(term int64) (int64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.term, r.term == term
+}
+
+// PeerAuth requires the replication token on the endpoints the other balancers call. Unlike
+// the admin API, the endpoints are never open: they can replace all bucket metadata.
+func (r *MetadataReplicator) PeerAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		token, found := strings.CutPrefix(ctx.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if !found || r.config.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(r.config.Token)) != 1 {
+			log.Warn().Str("path", ctx.Request().URL.Path).Msg("Unauthorized replication request")
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		}
+		return next(ctx)
+	}
+}
+
+// VoteHandler handles POST /replication/vote.
+func (r *MetadataReplicator) VoteHandler(ctx echo.Context) error {
+	var request models.VoteRequest
+	if err := ctx.Bind(&request); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	response, err := r.vote(ctx.Request().Context(), &request)
+	return replicationResponse(ctx, response, err)
+}
+
+// AppendHandler handles POST /replication/append.
+func (r *MetadataReplicator) AppendHandler(ctx echo.Context) error {
+	var request models.AppendRequest
+	if err := ctx.Bind(&request); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	response, err := r.appendEntries(ctx.Request().Context(), &request)
+	return replicationResponse(ctx, response, err)
+}
+
+// InstallSnapshotHandler handles POST /replication/snapshot.
+func (r *MetadataReplicator) InstallSnapshotHandler(ctx echo.Context) error {
+	var request models.InstallSnapshotRequest
+	if err := ctx.Bind(&request); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	response, err := r.installSnapshot(ctx.Request().Context(), &request)
+	return replicationResponse(ctx, response, err)
+}
+
+// replicationResponse writes the response to a peer, or a 500 if the store failed.
+func replicationResponse(ctx echo.Context, response any, err error) error {
+	if err != nil {
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Str("path", ctx.Path()).Msg("Metadata replication request failed")
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// isReplicationError reports whether a metadata change failed because this balancer does not
+// lead or could not reach a majority.
+func isReplicationError(err error) bool {
+	return errors.Is(err, ErrNotLeader) || errors.Is(err, ErrNotReplicated)
+}
+
+// metadataUnavailable answers a metadata change that failed for lack of a leader or majority
+// with 503, so clients retry once a leader is elected.
+func metadataUnavailable(ctx echo.Context, err error) error {
+	log.Ctx(ctx.Request().Context()).Warn().Err(err).Str("path", ctx.Request().URL.Path).Msg("Metadata change not accepted")
+	ctx.Response().Header().Set("Retry-After", strconv.Itoa(1))
+	return ctx.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+}
+
+// metadataNotCommitted answers a metadata change that failed replication. A change this
+// balancer applied but a majority did not store in time is answered 202, since it is visible
+// here and may still commit; a change that was not applied is answered 503.
+func metadataNotCommitted(ctx echo.Context, err error) error {
+	if !errors.Is(err, ErrNotReplicated) {
+		return metadataUnavailable(ctx, err)
+	}
+	log.Ctx(ctx.Request().Context()).Warn().Err(err).Str("path", ctx.Request().URL.Path).Msg("Metadata change applied, commit pending")
+	return ctx.JSON(http.StatusAccepted, map[string]string{
+		"status":  "commit_pending",
+		"message": "Change applied by the metadata leader, waiting for a majority of balancers to store it",
+	})
+}
+
+// StatusHandler handles GET /admin/replication.
+func (r *MetadataReplicator) StatusHandler(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, r.Status())
+}
+
+// Forward sends requests changing metadata, bucket changes and blob deletes, to the leader.
+// On the leader, and without replication, requests pass through. Without a known leader, or
+// for a request another balancer already forwarded, it answers 503 with Retry-After.
+func (r *MetadataReplicator) Forward() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if r == nil {
+			return next
+		}
+		return func(ctx echo.Context) error {
+			r.mu.Lock()
+			leading := r.role == models.ReplicaLeader
+			leader := r.leader
+			r.mu.Unlock()
+			if leading {
+				return next(ctx)
+			}
+
+			req := ctx.Request()
+			target, err := url.Parse(leader)
+			if leader == "" || err != nil || req.Header.Get(forwardedByHeader) != "" {
+				return metadataUnavailable(ctx, ErrNoLeader)
+			}
+
+			req.Header.Set(forwardedByHeader, r.config.Self)
+			proxy := httputil.NewSingleHostReverseProxy(target)
+			proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+				log.Warn().Err(err).Str("leader", leader).Str("path", req.URL.Path).Msg("Failed to forward request to metadata leader")
+				w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				w.WriteHeader(http.StatusBadGateway)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "metadata leader unreachable"})
+			}
+			metadataForwardsTotal.Inc()
+			proxy.ServeHTTP(ctx.Response(), req)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,480 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loopfs/pkg/bucket"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	// metadataTestToken authenticates the replicas of a metadata replication test to each other
+	metadataTestToken = "replication-secret"
+	// metadataTestElectionTimeout leaves room for scheduling delays under the race detector
+	metadataTestElectionTimeout = time.Second
+	// metadataTestWait bounds how long a test waits for an election or a change
+	metadataTestWait = 10 * time.Second
+)
+
+// errPartitioned fails the requests a partitioned replica sends
+var errPartitioned = errors.New("replica is partitioned")
+
+// partitionTransport fails the requests of a replica while it is partitioned, so a partition
+// cuts both directions
+type partitionTransport struct {
+	replica *testReplica
+}
+
+// RoundTrip implements http.RoundTripper
+func (t partitionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.replica.partitioned.Load() {
+		return nil, errPartitioned
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// testReplica is a balancer replicating its bucket store in a metadata replication test
+type testReplica struct {
+	store       *bucket.Store
+	replicator  *MetadataReplicator
+	server      *httptest.Server
+	partitioned atomic.Bool
+}
+
+// MetadataReplicationTestSuite tests leader election and replication between three balancers
+type MetadataReplicationTestSuite struct {
+	suite.Suite
+	replicas []*testReplica
+}
+
+// SetupTest starts three replicas with short timeouts
+func (s *MetadataReplicationTestSuite) SetupTest() {
+	s.replicas = make([]*testReplica, 3)
+	urls := make([]string, len(s.replicas))
+	for i := range s.replicas {
+		replica := &testReplica{}
+		replica.server = httptest.NewUnstartedServer(nil)
+		urls[i] = "http://" + replica.server.Listener.Addr().String()
+		s.replicas[i] = replica
+	}
+
+	for i, replica := range s.replicas {
+		var err error
+		replica.store, err = bucket.NewStore(filepath.Join(s.T().TempDir(), "buckets.db"))
+		s.Require().NoError(err)
+
+		var peers []string
+		for j, url := range urls {
+			if j != i {
+				peers = append(peers, url)
+			}
+		}
+		replica.replicator, err = NewMetadataReplicator(replica.store, MetadataReplicationConfig{
+			Self:              urls[i],
+			Peers:             peers,
+			Token:             metadataTestToken,
+			HeartbeatInterval: 50 * time.Millisecond,
+			ElectionTimeout:   metadataTestElectionTimeout,
+			CommitTimeout:     2 * time.Second,
+			LogRetention:      1,
+		})
+		s.Require().NoError(err)
+		replica.replicator.client = &http.Client{Transport: partitionTransport{replica: replica}}
+		replica.store.SetReplicationHook(replica.replicator)
+
+		e := echo.New()
+		e.POST("/replication/vote", replica.replicator.VoteHandler, replica.replicator.PeerAuth)
+		e.POST("/replication/append", replica.replicator.AppendHandler, replica.replicator.PeerAuth)
+		e.POST("/replication/snapshot", replica.replicator.InstallSnapshotHandler, replica.replicator.PeerAuth)
+		e.POST("/bucket/:name", NewBucketHandlers(replica.store).CreateBucketHandler, replica.replicator.Forward())
+		replica.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if replica.partitioned.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			e.ServeHTTP(w, req)
+		})
+		replica.server.Start()
+	}
+	for _, replica := range s.replicas {
+		s.Require().NoError(replica.replicator.Start())
+	}
+}
+
+// TearDownTest stops the replicas
+func (s *MetadataReplicationTestSuite) TearDownTest() {
+	for _, replica := range s.replicas {
+		replica.replicator.Stop()
+	}
+	for _, replica := range s.replicas {
+		replica.server.Close()
+		_ = replica.store.Close()
+	}
+}
+
+// leader waits until exactly one reachable replica leads and the others acknowledged its term
+func (s *MetadataReplicationTestSuite) leader() *testReplica {
+	var leader *testReplica
+	s.Require().Eventually(func() bool {
+		leader = nil
+		for _, replica := range s.replicas {
+			if replica.partitioned.Load() || !replica.replicator.IsLeader() {
+				continue
+			}
+			if leader != nil {
+				return false
+			}
+			leader = replica
+		}
+		if leader == nil {
+			return false
+		}
+		status := leader.replicator.Status()
+		for _, replica := range s.followers(leader) {
+			if replica.partitioned.Load() {
+				continue
+			}
+			following := replica.replicator.Status()
+			if following.Role != models.ReplicaFollower || following.Term != status.Term || following.Leader != status.Self {
+				return false
+			}
+		}
+		return true
+	}, metadataTestWait, 10*time.Millisecond)
+	return leader
+}
+
+// change applies a change on the leader, retrying on a new leader if it lost leadership
+// first, and returns the leader that made it
+func (s *MetadataReplicationTestSuite) change(apply func(leader *testReplica) error) *testReplica {
+	deadline := time.Now().Add(metadataTestWait)
+	for {
+		leader := s.leader()
+		err := apply(leader)
+		if !errors.Is(err, ErrNotLeader) || time.Now().After(deadline) {
+			s.Require().NoError(err)
+			return leader
+		}
+	}
+}
+
+// createBucket creates a bucket through the leader and returns the leader that created it
+func (s *MetadataReplicationTestSuite) createBucket(name string) *testReplica {
+	return s.change(func(leader *testReplica) error {
+		_, err := leader.store.CreateBucket(context.Background(), name, "alice", nil)
+		return err
+	})
+}
+
+// followers returns the replicas other than leader
+func (s *MetadataReplicationTestSuite) followers(leader *testReplica) []*testReplica {
+	var followers []*testReplica
+	for _, replica := range s.replicas {
+		if replica != leader {
+			followers = append(followers, replica)
+		}
+	}
+	return followers
+}
+
+// hasBucket reports whether replica stores the bucket name
+func (s *MetadataReplicationTestSuite) hasBucket(replica *testReplica, name string) bool {
+	exists, err := replica.store.BucketExists(context.Background(), name)
+	s.Require().NoError(err)
+	return exists
+}
+
+// TestElection tests that one leader is elected and followers refuse changes
+func (s *MetadataReplicationTestSuite) TestElection() {
+	leader := s.leader()
+
+	status := leader.replicator.Status()
+	s.Equal(models.ReplicaLeader, status.Role)
+	s.Positive(status.Term)
+	s.Len(status.Peers, 2)
+
+	for _, follower := range s.followers(leader) {
+		s.Equal(models.ReplicaFollower, follower.replicator.Status().Role)
+		_, err := follower.store.CreateBucket(context.Background(), "photos", "alice", nil)
+		s.ErrorIs(err, ErrNotLeader)
+	}
+}
+
+// TestReplicatesChanges tests that the leader's changes reach every follower
+func (s *MetadataReplicationTestSuite) TestReplicatesChanges() {
+	s.createBucket("photos")
+	leader := s.change(func(leader *testReplica) error {
+		_, err := leader.store.PutObject(context.Background(), "photos", "a.jpg", changeTestHash, 10, "image/jpeg", nil)
+		return err
+	})
+
+	want, err := leader.store.GetObject(context.Background(), "photos", "a.jpg")
+	s.Require().NoError(err)
+	for _, follower := range s.followers(leader) {
+		s.Eventually(func() bool { return s.hasBucket(follower, "photos") }, metadataTestWait, 10*time.Millisecond)
+		s.Eventually(func() bool {
+			got, err := follower.store.GetObject(context.Background(), "photos", "a.jpg")
+			return err == nil && got.ID == want.ID && got.Hash == want.Hash
+		}, metadataTestWait, 10*time.Millisecond)
+	}
+}
+
+// TestReplicatesTombstones tests that blob tombstones reach every follower, so a new leader
+// does not repair deleted blobs
+func (s *MetadataReplicationTestSuite) TestReplicatesTombstones() {
+	leader := s.change(func(leader *testReplica) error {
+		return leader.store.AddTombstone(context.Background(), changeTestHash)
+	})
+
+	for _, follower := range s.followers(leader) {
+		s.Eventually(func() bool {
+			tombstones, err := follower.store.Tombstones(context.Background(), changeTestHash)
+			return err == nil && len(tombstones) == 1
+		}, metadataTestWait, 10*time.Millisecond)
+	}
+}
+
+// TestForwardsToLeader tests that a follower forwards bucket changes to the leader
+func (s *MetadataReplicationTestSuite) TestForwardsToLeader() {
+	// Without a leader, or while a new one is elected, the follower answers 503 to retry
+	var leader, follower *testReplica
+	status := http.StatusServiceUnavailable
+	for deadline := time.Now().Add(metadataTestWait); status == http.StatusServiceUnavailable && time.Now().Before(deadline); {
+		leader = s.leader()
+		follower = s.followers(leader)[0]
+
+		req, err := http.NewRequest(http.MethodPost, follower.server.URL+"/bucket/photos", http.NoBody)
+		s.Require().NoError(err)
+		req.Header.Set("X-Owner-ID", "alice")
+		resp, err := http.DefaultClient.Do(req)
+		s.Require().NoError(err)
+		_ = resp.Body.Close()
+		status = resp.StatusCode
+	}
+	s.Equal(http.StatusCreated, status)
+
+	for _, replica := range []*testReplica{leader, follower} {
+		s.Eventually(func() bool { return s.hasBucket(replica, "photos") }, metadataTestWait, 10*time.Millisecond)
+	}
+
+	// A request forwarded once is not forwarded again
+	req, err := http.NewRequest(http.MethodPost, follower.server.URL+"/bucket/videos", http.NoBody)
+	s.Require().NoError(err)
+	req.Header.Set(forwardedByHeader, "http://elsewhere")
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	_ = resp.Body.Close()
+	s.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+	s.NotEmpty(resp.Header.Get("Retry-After"))
+}
+
+// TestMinorityStepsDown tests that a leader cut off from both followers stops accepting changes
+func (s *MetadataReplicationTestSuite) TestMinorityStepsDown() {
+	leader := s.leader()
+	for _, follower := range s.followers(leader) {
+		follower.partitioned.Store(true)
+	}
+
+	s.Eventually(func() bool { return !leader.replicator.IsLeader() }, metadataTestWait, 10*time.Millisecond)
+	_, err := leader.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.ErrorIs(err, ErrNotLeader)
+	s.False(s.hasBucket(leader, "photos"))
+}
+
+// TestCommitTimeoutAccepted tests that a change the leader applied but could not replicate in
+// time is answered as accepted with its commit pending
+func (s *MetadataReplicationTestSuite) TestCommitTimeoutAccepted() {
+	leader := s.leader()
+	leader.replicator.config.CommitTimeout = 50 * time.Millisecond
+	for _, follower := range s.followers(leader) {
+		follower.partitioned.Store(true)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, leader.server.URL+"/bucket/photos", http.NoBody)
+	s.Require().NoError(err)
+	req.Header.Set("X-Owner-ID", "alice")
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer func() { _ = resp.Body.Close() }()
+	s.Equal(http.StatusAccepted, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err)
+	s.Contains(string(body), "commit_pending")
+	s.True(s.hasBucket(leader, "photos"))
+}
+
+// TestFailover tests that the remaining majority elects a new leader that has every change
+func (s *MetadataReplicationTestSuite) TestFailover() {
+	leader := s.createBucket("photos")
+
+	leader.partitioned.Store(true)
+	leader.replicator.Stop()
+	s.replicas = s.followers(leader)
+	defer func() {
+		leader.server.Close()
+		_ = leader.store.Close()
+	}()
+
+	newLeader := s.leader()
+	s.True(s.hasBucket(newLeader, "photos"))
+	s.createBucket("videos")
+}
+
+// TestSnapshotCatchUp tests that a follower behind the pruned log receives a snapshot
+func (s *MetadataReplicationTestSuite) TestSnapshotCatchUp() {
+	leader := s.leader()
+	lagging := s.followers(leader)[0]
+	lagging.partitioned.Store(true)
+
+	for _, name := range []string{"photos", "videos", "music"} {
+		leader = s.createBucket(name)
+	}
+	for _, replica := range s.replicas {
+		replica.replicator.pruneLog()
+	}
+	_, err := leader.store.LogEntriesAfter(context.Background(), 0, 10)
+	s.Require().ErrorIs(err, bucket.ErrLogPruned)
+
+	lagging.partitioned.Store(false)
+	s.Eventually(func() bool {
+		return s.hasBucket(lagging, "photos") && s.hasBucket(lagging, "music")
+	}, metadataTestWait, 10*time.Millisecond)
+}
+
+// TestPeerAuth tests that the replication endpoints require the token
+func (s *MetadataReplicationTestSuite) TestPeerAuth() {
+	replica := s.replicas[0]
+	for _, token := range []string{"", "wrong"} {
+		req, err := http.NewRequest(http.MethodPost, replica.server.URL+"/replication/snapshot", strings.NewReader(`{"term":1000}`))
+		s.Require().NoError(err)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		s.Require().NoError(err)
+		_ = resp.Body.Close()
+		s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	}
+	term, _, err := replica.store.ElectionState(context.Background())
+	s.Require().NoError(err)
+	s.Less(term, int64(1000))
+
+	_, err = NewMetadataReplicator(replica.store, MetadataReplicationConfig{Self: "http://lb1:8081"})
+	s.ErrorIs(err, ErrReplicationWithoutToken)
+}
+
+// blockingLogStore holds AppendLogEntries until released
+type blockingLogStore struct {
+	*bucket.Store
+	appending chan struct{}
+	release   chan struct{}
+}
+
+// AppendLogEntries signals the test and waits for it before appending
+func (b *blockingLogStore) AppendLogEntries(ctx context.Context, prevSeq, prevTerm int64, entries []models.MetadataLogEntry) error {
+	close(b.appending)
+	<-b.release
+	return b.Store.AppendLogEntries(ctx, prevSeq, prevTerm, entries)
+}
+
+// TestAppendWithoutLock tests that a follower writes entries without holding its lock and
+// does not acknowledge them to a leader deposed meanwhile
+func (s *MetadataReplicationTestSuite) TestAppendWithoutLock() {
+	store, err := bucket.NewStore(filepath.Join(s.T().TempDir(), "buckets.db"))
+	s.Require().NoError(err)
+	defer func() { _ = store.Close() }()
+	blocking := &blockingLogStore{Store: store, appending: make(chan struct{}), release: make(chan struct{})}
+	replicator, err := NewMetadataReplicator(blocking, MetadataReplicationConfig{
+		Self:  "http://lb1:8081",
+		Peers: []string{"http://lb2:8081", "http://lb3:8081"},
+		Token: metadataTestToken,
+	})
+	s.Require().NoError(err)
+
+	responses := make(chan models.AppendResponse, 1)
+	go func() {
+		response, err := replicator.appendEntries(context.Background(), &models.AppendRequest{Term: 5, Leader: "http://lb2:8081"})
+		s.NoError(err)
+		responses <- response
+	}()
+	<-blocking.appending
+
+	// A newer leader is followed while the older one's entries are still being written
+	term, ok, err := replicator.follow(6, "http://lb3:8081")
+	s.Require().NoError(err)
+	s.True(ok)
+	s.Equal(int64(6), term)
+	close(blocking.release)
+
+	response := <-responses
+	s.False(response.Success)
+	s.Equal(int64(6), response.Term)
+}
+
+// blockingStateStore holds SetElectionState until released
+type blockingStateStore struct {
+	*bucket.Store
+	saving  chan struct{}
+	release chan struct{}
+}
+
+// SetElectionState signals the test and waits for it before saving
+func (b *blockingStateStore) SetElectionState(ctx context.Context, term int64, votedFor string) error {
+	close(b.saving)
+	<-b.release
+	return b.Store.SetElectionState(ctx, term, votedFor)
+}
+
+// TestSaveTermWithoutLock tests that a follower saves a new term without holding its lock and
+// before answering the leader
+func (s *MetadataReplicationTestSuite) TestSaveTermWithoutLock() {
+	store, err := bucket.NewStore(filepath.Join(s.T().TempDir(), "buckets.db"))
+	s.Require().NoError(err)
+	defer func() { _ = store.Close() }()
+	blocking := &blockingStateStore{Store: store, saving: make(chan struct{}), release: make(chan struct{})}
+	replicator, err := NewMetadataReplicator(blocking, MetadataReplicationConfig{
+		Self:  "http://lb1:8081",
+		Peers: []string{"http://lb2:8081", "http://lb3:8081"},
+		Token: metadataTestToken,
+	})
+	s.Require().NoError(err)
+
+	responses := make(chan models.AppendResponse, 1)
+	go func() {
+		response, err := replicator.appendEntries(context.Background(), &models.AppendRequest{Term: 5, Leader: "http://lb2:8081"})
+		s.NoError(err)
+		responses <- response
+	}()
+	<-blocking.saving
+
+	// The state is readable while the term is being saved, but the leader is not answered yet
+	status := replicator.Status()
+	s.Equal(int64(5), status.Term)
+	s.Equal("http://lb2:8081", status.Leader)
+	s.Empty(responses)
+	close(blocking.release)
+
+	response := <-responses
+	s.True(response.Success)
+	term, votedFor, err := store.ElectionState(context.Background())
+	s.Require().NoError(err)
+	s.Equal(int64(5), term)
+	s.Empty(votedFor)
+}
+
+func TestMetadataReplicationSuite(t *testing.T) {
+	suite.Run(t, new(MetadataReplicationTestSuite))
+}
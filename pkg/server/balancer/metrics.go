@@ -0,0 +1,163 @@
+package balancer
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"loopfs/pkg/metrics"
+	"loopfs/pkg/models"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/labstack/echo/v4"
+)
+
+// Backend states used as metric labels.
+const (
+	backendStateOnline  = "online"
+	backendStateOffline = "offline"
+)
+
+var (
+	httpRequestsTotal = metrics.NewCounterVec("loopfs_balancer_http_requests_total",
+		"HTTP requests by method, route and status code.", "method", "route", "code")
+	httpRequestDuration = metrics.NewHistogramVec("loopfs_balancer_http_request_duration_seconds",
+		"HTTP request latency by method and route.", metrics.DefBuckets, "method", "route")
+	backendRequestsTotal = metrics.NewCounterVec("loopfs_balancer_backend_requests_total",
+		"Requests sent to backends by backend, method and status code, or error if no response was received.",
+		"backend", "method", "code")
+	backendRequestDuration = metrics.NewHistogramVec("loopfs_balancer_backend_request_duration_seconds",
+		"Time until backend response headers were received, by backend and method.",
+		metrics.DefBuckets, "backend", "method")
+	backendRetriesTotal = metrics.NewCounterVec("loopfs_balancer_backend_retries_total",
+		"Requests retried by the HTTP client after a connection or timeout error, by backend.", "backend")
+	backendTransitionsTotal = metrics.NewCounterVec("loopfs_balancer_backend_transitions_total",
+		"Backend state changes by backend, new state and reason.", "backend", "state", "reason")
+	backendOnline = metrics.NewGaugeVec("loopfs_balancer_backend_online",
+		"Whether the balancer considers a backend online (1) or offline (0).", "backend")
+	circuitState = metrics.NewGaugeVec("loopfs_balancer_backend_circuit_state",
+		"State of the circuit breaker of a backend: 0 closed, 1 half-open, 2 open.", "backend")
+	circuitTransitionsTotal = metrics.NewCounterVec("loopfs_balancer_circuit_transitions_total",
+		"Circuit breaker state changes by backend, new state and reason.", "backend", "state", "reason")
+	fanoutBackends = metrics.NewHistogram("loopfs_balancer_fanout_backends",
+		"Number of backends a request was fanned out to.", []float64{1, 2, 3, 5, 8, 13, 21, 34})
+	underReplicatedUploadsTotal = metrics.NewCounter("loopfs_balancer_under_replicated_uploads_total",
+		"Uploads stored on fewer backends than the replication factor and queued for repair.")
+	writeQuorumFailuresTotal = metrics.NewCounter("loopfs_balancer_write_quorum_failures_total",
+		"Uploads rejected because fewer backends stored them than the write quorum.")
+	repairCopiesTotal = metrics.NewCounterVec("loopfs_balancer_repair_copies_total",
+		"Blob copies between backends made by the repair worker, by result.", "result")
+	repairBytesTotal = metrics.NewCounter("loopfs_balancer_repair_bytes_total",
+		"Bytes copied between backends by the repair worker.")
+	placementLookupsTotal = metrics.NewCounterVec("loopfs_balancer_placement_lookups_total",
+		"Reads by the backends that had the file: a cached location, the hash owners, a fallback or broadcast backend, or a miss.",
+		"result")
+	downloadHedgesTotal = metrics.NewCounterVec("loopfs_balancer_download_hedges_total",
+		"Download requests sent to a further backend, by trigger: timer (previous backends slower than the hedge delay), failure or not_found.",
+		"trigger")
+	downloadHedgeWinsTotal = metrics.NewCounter("loopfs_balancer_download_hedge_wins_total",
+		"Downloads served by a hedge request instead of the backend asked first.")
+	locationCacheEntries = metrics.NewGauge("loopfs_balancer_location_cache_entries",
+		"Hashes whose backend locations are cached.")
+	admissionRejectionsTotal = metrics.NewCounterVec("loopfs_balancer_admission_rejections_total",
+		"Requests rejected with 429 by scope (owner, bucket or backend) and limit (requests, bytes or concurrency).",
+		"scope", "limit")
+	backendInFlight = metrics.NewGaugeVec("loopfs_balancer_backend_in_flight",
+		"Requests in flight to a backend, limited by the backend concurrency.", "backend")
+	bucketOperationsTotal = metrics.NewCounterVec("loopfs_balancer_bucket_operations_total",
+		"Bucket API operations by operation and status code.", "operation", "code")
+	metadataLeader = metrics.NewGauge("loopfs_balancer_metadata_leader",
+		"Whether this balancer is the metadata leader (1) or not (0).")
+	metadataTerm = metrics.NewGauge("loopfs_balancer_metadata_term",
+		"Current metadata replication term.")
+	metadataElectionsTotal = metrics.NewCounterVec("loopfs_balancer_metadata_elections_total",
+		"Metadata leader elections this balancer stood in, by result.", "result")
+	metadataPeerLag = metrics.NewGaugeVec("loopfs_balancer_metadata_peer_lag",
+		"Metadata log entries a follower is behind the leader, reported by the leader.", "peer")
+	metadataSnapshotsSentTotal = metrics.NewCounter("loopfs_balancer_metadata_snapshots_sent_total",
+		"Metadata snapshots the leader sent to followers.")
+	metadataForwardsTotal = metrics.NewCounter("loopfs_balancer_metadata_forwards_total",
+		"Bucket changes a follower forwarded to the metadata leader.")
+)
+
+// backendLabel returns the backend base URL a request was sent to.
+func backendLabel(target *url.URL) string {
+	return target.Scheme + "://" + target.Host
+}
+
+// instrumentedTransport records request counts and latencies per backend.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	backend := backendLabel(req.URL)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	backendRequestsTotal.WithLabelValues(backend, req.Method, code).Inc()
+	backendRequestDuration.WithLabelValues(backend, req.Method).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// instrumentClient adds request and retry metrics to a retryable client.
+func instrumentClient(client *retryablehttp.Client) {
+	transport := client.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	client.HTTPClient.Transport = &instrumentedTransport{next: transport}
+	client.RequestLogHook = func(_ retryablehttp.Logger, req *http.Request, attempt int) {
+		if attempt > 0 {
+			backendRetriesTotal.WithLabelValues(backendLabel(req.URL)).Inc()
+		}
+	}
+}
+
+// observeBackendState records a backend state change.
+func observeBackendState(backendURL string, online bool, reason string) {
+	state := backendStateOffline
+	value := 0.0
+	if online {
+		state = backendStateOnline
+		value = 1
+	}
+	backendTransitionsTotal.WithLabelValues(backendURL, state, reason).Inc()
+	backendOnline.WithLabelValues(backendURL).Set(value)
+}
+
+// observeCircuitState records the circuit breaker state of a backend.
+func observeCircuitState(backendURL string, state models.CircuitState) {
+	value := 0.0
+	switch state {
+	case models.CircuitHalfOpen:
+		value = 1
+	case models.CircuitOpen:
+		value = 2
+	case models.CircuitClosed:
+	}
+	circuitState.WithLabelValues(backendURL).Set(value)
+}
+
+// bucketOperation returns route middleware counting a bucket API operation by status code.
+func bucketOperation(operation string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			err := next(ctx)
+			bucketOperationsTotal.WithLabelValues(operation, strconv.Itoa(ctx.Response().Status)).Inc()
+			return err
+		}
+	}
+}
+
+// getMetrics handles the GET /metrics endpoint.
+func getMetrics(ctx echo.Context) error {
+	ctx.Response().Header().Set(echo.HeaderContentType, metrics.ContentType)
+	return metrics.Default.WriteText(ctx.Response())
+}
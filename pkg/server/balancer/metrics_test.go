@@ -0,0 +1,130 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"loopfs/pkg/metrics"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+// MetricsTestSuite tests balancer instrumentation
+type MetricsTestSuite struct {
+	suite.Suite
+	backend *httptest.Server
+}
+
+// SetupTest runs before each test
+func (s *MetricsTestSuite) SetupTest() {
+	s.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+}
+
+// TearDownTest runs after each test
+func (s *MetricsTestSuite) TearDownTest() {
+	s.backend.Close()
+}
+
+// TestBackendRequestsCounted tests that client requests are counted per backend
+func (s *MetricsTestSuite) TestBackendRequestsCounted() {
+	client := CreateRetryableClient(0, time.Millisecond, time.Millisecond)
+	counter := backendRequestsTotal.WithLabelValues(s.backend.URL, http.MethodGet, "404")
+	latency := backendRequestDuration.WithLabelValues(s.backend.URL, http.MethodGet)
+	before, observed := counter.Value(), latency.Count()
+
+	resp, err := client.Get(s.backend.URL + "/file/abc/info")
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+
+	s.InDelta(before+1, counter.Value(), 0.0001)
+	s.Equal(observed+1, latency.Count())
+}
+
+// TestRetriesCounted tests that retries after connection errors are counted
+func (s *MetricsTestSuite) TestRetriesCounted() {
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	client := CreateRetryableClient(2, time.Millisecond, time.Millisecond)
+	retries := backendRetriesTotal.WithLabelValues(unreachable.URL)
+	failures := backendRequestsTotal.WithLabelValues(unreachable.URL, http.MethodGet, "error")
+	beforeRetries, beforeFailures := retries.Value(), failures.Value()
+
+	_, err := client.Get(unreachable.URL + "/node/info") //nolint:bodyclose // no response on connection errors
+	s.Error(err)
+
+	s.InDelta(beforeRetries+2, retries.Value(), 0.0001)
+	s.InDelta(beforeFailures+3, failures.Value(), 0.0001)
+}
+
+// TestMarkBackendDeadTransition tests that only the online to offline change is counted
+func (s *MetricsTestSuite) TestMarkBackendDeadTransition() {
+	backendURL := "http://metrics-dead-backend:8080"
+	manager := NewBackendManager([]string{backendURL}, time.Second, time.Second)
+	s.InDelta(1, backendOnline.WithLabelValues(backendURL).Value(), 0.0001)
+
+	manager.MarkBackendDead(backendURL, errors.New("connection refused"))
+	manager.MarkBackendDead(backendURL, errors.New("connection refused"))
+
+	s.InDelta(1, backendTransitionsTotal.WithLabelValues(backendURL, backendStateOffline, "request_failure").Value(), 0.0001)
+	s.InDelta(0, backendOnline.WithLabelValues(backendURL).Value(), 0.0001)
+}
+
+// TestFanoutObserved tests that fan-out sizes are recorded
+func (s *MetricsTestSuite) TestFanoutObserved() {
+	before := fanoutBackends.Count()
+	sum := fanoutBackends.Sum()
+
+	results := executeBackendRequests(context.Background(), []string{"a", "b", "c"}, time.Second,
+		func(context.Context, string) (struct{}, int, error) {
+			return struct{}{}, http.StatusNotFound, nil
+		}, false)
+	for result := range results {
+		s.Equal(http.StatusNotFound, result.Status)
+	}
+
+	s.Equal(before+1, fanoutBackends.Count())
+	s.InDelta(sum+3, fanoutBackends.Sum(), 0.0001)
+}
+
+// TestBucketOperation tests that bucket operations are counted by status code
+func (s *MetricsTestSuite) TestBucketOperation() {
+	e := echo.New()
+	e.GET("/bucket/:name", func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusNotFound)
+	}, bucketOperation("get_bucket"))
+	counter := bucketOperationsTotal.WithLabelValues("get_bucket", "404")
+	before := counter.Value()
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/bucket/photos", nil))
+
+	s.InDelta(before+1, counter.Value(), 0.0001)
+}
+
+// TestMetricsEndpoint tests that the balancer serves metrics
+func (s *MetricsTestSuite) TestMetricsEndpoint() {
+	server := NewBalancerServer([]string{s.backend.URL}, 0, time.Second, time.Millisecond, time.Millisecond,
+		time.Second, time.Second, time.Second, false, "", "")
+	server.backendManager = NewBackendManager([]string{s.backend.URL}, time.Second, time.Second)
+	server.setupRoutes(NewBalancer(server.backendManager, 0, time.Millisecond, time.Millisecond, time.Second))
+
+	rec := httptest.NewRecorder()
+	server.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(metrics.ContentType, rec.Header().Get("Content-Type"))
+	s.Contains(rec.Body.String(), "# TYPE loopfs_balancer_backend_requests_total counter")
+	s.Contains(rec.Body.String(), "# TYPE loopfs_bucket_query_duration_seconds histogram")
+}
+
+// TestMetricsTestSuite runs the metrics test suite
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(MetricsTestSuite))
+}
@@ -0,0 +1,222 @@
+package balancer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"slices"
+	"sort"
+
+	"loopfs/pkg/models"
+)
+
+// Placement modes deciding where uploads are written and where reads look first.
+const (
+	// PlacementBroadcast writes to the backends with the most free space and asks every
+	// online backend on reads.
+	PlacementBroadcast = "broadcast"
+	// PlacementRendezvous writes to the backends owning a hash by weighted rendezvous hashing
+	// and asks them first on reads, falling back to the other backends on a miss.
+	PlacementRendezvous = "rendezvous"
+)
+
+const bytesPerWeight = 1 << 30 // One unit of placement weight per GiB of capacity
+
+// Read lookup sources and results used as metric labels.
+const (
+	lookupCache     = "cache"
+	lookupOwner     = "owner"
+	lookupFallback  = "fallback"
+	lookupBroadcast = "broadcast"
+	lookupMiss      = "miss"
+)
+
+// validatePlacement checks that mode is a known placement mode.
+func validatePlacement(mode string) error {
+	switch mode {
+	case PlacementBroadcast, PlacementRendezvous:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownPlacement, mode)
+	}
+}
+
+// backendWeight returns the placement weight of a backend: the weight set by an operator, or
+// one derived from its host capacity or, when the node does not report one, from the size of
+// its loop images. Backends that have not reported any capacity yet get the minimum weight.
+func backendWeight(status *models.BackendStatus) float64 {
+	if status.Weight > 0 {
+		return status.Weight
+	}
+	if status.NodeInfo == nil {
+		return 1
+	}
+
+	capacity := status.NodeInfo.Storage.Total
+	if status.NodeInfo.Capacity != nil && status.NodeInfo.Capacity.HostTotal > 0 {
+		capacity = status.NodeInfo.Capacity.HostTotal
+	}
+	return max(1, float64(capacity)/bytesPerWeight)
+}
+
+// rendezvousScore returns the weighted rendezvous score of a backend for a hash. The backend
+// with the highest score owns the hash; each backend owns a share of all hashes proportional
+// to its weight.
+func rendezvousScore(backendURL, hash string, weight float64) float64 {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write([]byte(backendURL))
+	_, _ = hasher.Write([]byte{0})
+	_, _ = hasher.Write([]byte(hash))
+
+	// Map the mixed hash to (0, 1) so the logarithm is finite
+	unit := (float64(mix64(hasher.Sum64())>>11) + 0.5) / (1 << 53)
+	return weight / -math.Log(unit)
+}
+
+// mix64 is the finalizer of MurmurHash3; it spreads FNV's weak low bits across the whole word.
+func mix64(value uint64) uint64 {
+	value ^= value >> 33
+	value *= 0xff51afd7ed558ccd
+	value ^= value >> 33
+	value *= 0xc4ceb9fe1a85ec53
+	value ^= value >> 33
+	return value
+}
+
+// rankedStatuses returns the given backends ordered by rendezvous score for hash, highest first.
+// The caller must hold bm.mu.
+func rankedStatuses(statuses []*models.BackendStatus, hash string) []*models.BackendStatus {
+	scores := make(map[string]float64, len(statuses))
+	for _, status := range statuses {
+		scores[status.URL] = rendezvousScore(status.URL, hash, backendWeight(status))
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if scores[statuses[i].URL] != scores[statuses[j].URL] {
+			return scores[statuses[i].URL] > scores[statuses[j].URL]
+		}
+		return statuses[i].URL < statuses[j].URL
+	})
+	return statuses
+}
+
+// RankBackends returns all configured backends ordered by rendezvous score for hash, so the
+// first ones are the owners of the hash.
+func (bm *BackendManager) RankBackends(hash string) []string {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+
+	statuses := make([]*models.BackendStatus, 0, len(bm.backends))
+	for _, status := range bm.backends {
+		statuses = append(statuses, status)
+	}
+
+	ranked := rankedStatuses(statuses, hash)
+	backends := make([]string, len(ranked))
+	for i, status := range ranked {
+		backends[i] = status.URL
+	}
+	return backends
+}
+
+// GetBackendsForHash returns up to count distinct backends that can store a file of the given
+// size, in rendezvous order for hash. Backends that cannot take the file are skipped, so the
+// next backends in the ranking stand in for them.
+func (bm *BackendManager) GetBackendsForHash(hash string, fileSize int64, count int) ([]string, error) {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+
+	candidates := make([]*models.BackendStatus, 0, len(bm.backends))
+	for _, status := range bm.backends {
+		if acceptsUpload(status, fileSize) {
+			candidates = append(candidates, status)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrNoBackendAvailable
+	}
+
+	ranked := rankedStatuses(candidates, hash)
+	backends := make([]string, 0, min(count, len(ranked)))
+	for _, status := range ranked[:min(count, len(ranked))] {
+		backends = append(backends, status.URL)
+	}
+	return backends, nil
+}
+
+// uploadBackends returns the backends a file should be written to. With rendezvous placement
+// and a known hash these are the owners of the hash, otherwise the backends chosen by policy,
+// or by the balancer's upload policy when policy is nil.
+func (b *Balancer) uploadBackends(hash string, fileSize int64, count int, policy PlacementPolicy) ([]string, error) {
+	if b.placement == PlacementRendezvous && hash != "" {
+		return b.backendManager.GetBackendsForHash(hash, fileSize, count)
+	}
+	if policy == nil {
+		policy = b.uploadPolicy
+	}
+	return b.backendManager.GetBackendsWithPolicy(policy, fileSize, count)
+}
+
+// readGroup is a set of backends a read asks at once, labelled by why they were chosen.
+type readGroup struct {
+	backends []string
+	source   string
+}
+
+// readGroups splits the online backends into the groups a read of hash asks in turn. A
+// backend the location cache knows to store the hash is asked alone first. With rendezvous
+// placement the owners of the hash come next and the remaining backends are only asked on a
+// miss; blobs written before placement was enabled or copied by the repair worker may live
+// anywhere. Broadcast placement asks all remaining online backends at once.
+func (b *Balancer) readGroups(hash string, online []string) []readGroup {
+	var groups []readGroup
+	if b.locations != nil {
+		for _, backend := range b.locations.Get(hash) {
+			if slices.Contains(online, backend) {
+				groups = append(groups, readGroup{backends: []string{backend}, source: lookupCache})
+				online = slices.DeleteFunc(slices.Clone(online), func(url string) bool { return url == backend })
+				break
+			}
+		}
+	}
+
+	if b.placement != PlacementRendezvous {
+		if len(online) > 0 {
+			groups = append(groups, readGroup{backends: online, source: lookupBroadcast})
+		}
+		return groups
+	}
+
+	owners := make([]string, 0, b.replicationFactor)
+	others := make([]string, 0, len(online))
+	for _, backend := range b.backendManager.RankBackends(hash) {
+		if !slices.Contains(online, backend) {
+			continue
+		}
+		if len(owners) < b.replicationFactor {
+			owners = append(owners, backend)
+		} else {
+			others = append(others, backend)
+		}
+	}
+
+	if len(owners) > 0 {
+		groups = append(groups, readGroup{backends: owners, source: lookupOwner})
+	}
+	if len(others) > 0 {
+		groups = append(groups, readGroup{backends: others, source: lookupFallback})
+	}
+	return groups
+}
+
+// readMisses accumulates the not-found answers and errors of a read across backend groups.
+type readMisses struct {
+	notFound  int
+	lastError error
+}
+
+// observeLookup records which group of backends answered a read, or lookupMiss if none had the file.
+func observeLookup(result string) {
+	placementLookupsTotal.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,218 @@
+package balancer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+// PlacementTestSuite tests rendezvous placement of uploads and owner-first reads
+type PlacementTestSuite struct {
+	suite.Suite
+	backends []*blobBackend
+	manager  *BackendManager
+	balancer *Balancer
+}
+
+// SetupTest starts three in-memory backends and a balancer with rendezvous placement
+func (s *PlacementTestSuite) SetupTest() {
+	s.backends = []*blobBackend{newBlobBackend(), newBlobBackend(), newBlobBackend()}
+	urls := make([]string, 0, len(s.backends))
+	for _, backend := range s.backends {
+		urls = append(urls, backend.server.URL)
+	}
+	s.manager = NewBackendManager(urls, 100*time.Millisecond, 5*time.Second)
+	s.manager.Start()
+	time.Sleep(200 * time.Millisecond)
+
+	s.balancer = NewBalancer(s.manager, 0, time.Millisecond, time.Millisecond, 5*time.Second)
+	s.Require().NoError(s.balancer.SetPlacement(PlacementRendezvous))
+}
+
+// TearDownTest stops the backend manager and the backends
+func (s *PlacementTestSuite) TearDownTest() {
+	s.manager.Stop()
+	for _, backend := range s.backends {
+		backend.server.Close()
+	}
+}
+
+// backend returns the mock backend with the given URL
+func (s *PlacementTestSuite) backend(url string) *blobBackend {
+	for _, backend := range s.backends {
+		if backend.server.URL == url {
+			return backend
+		}
+	}
+	s.FailNow("unknown backend " + url)
+	return nil
+}
+
+// get sends a GET request for path through handler
+func (s *PlacementTestSuite) get(handler echo.HandlerFunc, path, hash string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ctx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, path, nil), rec)
+	ctx.SetParamNames("hash")
+	ctx.SetParamValues(hash)
+	s.Require().NoError(handler(ctx))
+	return rec
+}
+
+// TestSetPlacementRejectsUnknownMode tests that only known placement modes are accepted
+func (s *PlacementTestSuite) TestSetPlacementRejectsUnknownMode() {
+	s.ErrorIs(s.balancer.SetPlacement("random"), ErrUnknownPlacement)
+	s.Equal(PlacementRendezvous, s.balancer.placement)
+	s.Equal(PlacementBroadcast, NewBalancer(s.manager, 0, time.Millisecond, time.Millisecond, time.Second).placement)
+}
+
+// TestBackendWeight tests that weights follow the reported capacity
+func (s *PlacementTestSuite) TestBackendWeight() {
+	s.InDelta(1.0, backendWeight(&models.BackendStatus{}), 0)
+	s.InDelta(4.0, backendWeight(&models.BackendStatus{
+		NodeInfo: &models.NodeInfo{Storage: models.StorageInfo{Total: 4 << 30}},
+	}), 0)
+	s.InDelta(8.0, backendWeight(&models.BackendStatus{
+		NodeInfo: &models.NodeInfo{
+			Storage:  models.StorageInfo{Total: 4 << 30},
+			Capacity: &models.CapacityInfo{HostTotal: 8 << 30},
+		},
+	}), 0)
+	s.InDelta(1.0, backendWeight(&models.BackendStatus{
+		NodeInfo: &models.NodeInfo{Storage: models.StorageInfo{Total: 1 << 20}},
+	}), 0)
+}
+
+// TestRankBackendsIsDeterministic tests that every hash ranks all backends the same way each time
+func (s *PlacementTestSuite) TestRankBackendsIsDeterministic() {
+	owners := map[string]int{}
+	for i := range 300 {
+		hash := fmt.Sprintf("%064x", i)
+		ranked := s.manager.RankBackends(hash)
+		s.Len(ranked, len(s.backends))
+		s.Equal(ranked, s.manager.RankBackends(hash))
+		owners[ranked[0]]++
+	}
+
+	// Equal weights spread the hashes over all backends
+	s.Len(owners, len(s.backends))
+}
+
+// TestRendezvousScoreFollowsWeight tests that a backend owns a share of hashes proportional to its weight
+func (s *PlacementTestSuite) TestRendezvousScoreFollowsWeight() {
+	const hashes = 4000
+	heavy := 0
+	for i := range hashes {
+		hash := fmt.Sprintf("%064x", i)
+		if rendezvousScore("http://heavy", hash, 3) > rendezvousScore("http://light", hash, 1) {
+			heavy++
+		}
+	}
+	s.InDelta(0.75, float64(heavy)/hashes, 0.03)
+}
+
+// TestGetBackendsForHashSkipsIneligible tests that the next backends in rank order replace ones that cannot store the file
+func (s *PlacementTestSuite) TestGetBackendsForHashSkipsIneligible() {
+	hash := fmt.Sprintf("%064x", 42)
+	ranked := s.manager.RankBackends(hash)
+
+	backends, err := s.manager.GetBackendsForHash(hash, 10, 2)
+	s.Require().NoError(err)
+	s.Equal(ranked[:2], backends)
+
+	s.manager.MarkBackendDead(ranked[0], io.ErrUnexpectedEOF)
+	backends, err = s.manager.GetBackendsForHash(hash, 10, 2)
+	s.Require().NoError(err)
+	s.Equal(ranked[1:], backends)
+
+	_, err = s.manager.GetBackendsForHash(hash, 2<<30, 2)
+	s.ErrorIs(err, ErrNoBackendAvailable)
+}
+
+// TestUploadGoesToOwners tests that uploads are written to the owners of the content hash
+func (s *PlacementTestSuite) TestUploadGoesToOwners() {
+	s.balancer.SetReplication(2, 0)
+	content := []byte("placed by rendezvous hashing")
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "placed.txt")
+	s.Require().NoError(err)
+	_, err = part.Write(content)
+	s.Require().NoError(err)
+	s.Require().NoError(writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/file/upload", &body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	s.Require().NoError(s.balancer.UploadHandler(echo.New().NewContext(req, rec)))
+	s.Require().Equal(http.StatusOK, rec.Code)
+
+	ranked := s.manager.RankBackends(hash)
+	s.True(s.backend(ranked[0]).has(hash))
+	s.True(s.backend(ranked[1]).has(hash))
+	s.False(s.backend(ranked[2]).has(hash))
+}
+
+// TestReadGroupsPutOwnersFirst tests that reads ask the owners before the other online backends
+func (s *PlacementTestSuite) TestReadGroupsPutOwnersFirst() {
+	hash := fmt.Sprintf("%064x", 7)
+	ranked := s.manager.RankBackends(hash)
+	online := s.manager.GetOnlineBackends()
+
+	s.Equal([]readGroup{
+		{backends: ranked[:1], source: lookupOwner},
+		{backends: ranked[1:], source: lookupFallback},
+	}, s.balancer.readGroups(hash, online))
+
+	s.balancer.SetReplication(3, 0)
+	s.Equal([]readGroup{{backends: ranked, source: lookupOwner}}, s.balancer.readGroups(hash, online))
+
+	s.Require().NoError(s.balancer.SetPlacement(PlacementBroadcast))
+	s.Equal([]readGroup{{backends: online, source: lookupBroadcast}}, s.balancer.readGroups(hash, online))
+}
+
+// TestReadFallsBackOnMiss tests that a blob missing on its owner is found on another backend
+func (s *PlacementTestSuite) TestReadFallsBackOnMiss() {
+	content := "written before placement was enabled"
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	ranked := s.manager.RankBackends(hash)
+	s.backend(ranked[2]).put(content)
+
+	rec := s.get(s.balancer.DownloadHandler, "/file/"+hash+"/download", hash)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(content, rec.Body.String())
+
+	rec = s.get(s.balancer.FileInfoHandler, "/file/"+hash+"/info", hash)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), hash)
+}
+
+// TestReadMissOnAllBackends tests that a blob stored nowhere is reported as not found
+func (s *PlacementTestSuite) TestReadMissOnAllBackends() {
+	hash := fmt.Sprintf("%064x", 99)
+
+	rec := s.get(s.balancer.DownloadHandler, "/file/"+hash+"/download", hash)
+	s.Equal(http.StatusNotFound, rec.Code)
+
+	rec = s.get(s.balancer.FileInfoHandler, "/file/"+hash+"/info", hash)
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+func TestPlacementSuite(t *testing.T) {
+	suite.Run(t, new(PlacementTestSuite))
+}
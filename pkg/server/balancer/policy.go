@@ -0,0 +1,177 @@
+package balancer
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"sync"
+
+	"loopfs/pkg/models"
+)
+
+// Upload placement policies choosing the backends a new file is written to with broadcast
+// placement. Rendezvous placement always writes to the owners of the hash.
+const (
+	// PolicyMostFree writes to the backends with the most available space.
+	PolicyMostFree = "most-free"
+	// PolicyWeightedRandom picks backends at random with a probability proportional to their
+	// available space, spreading uploads over all backends instead of herding them onto the emptiest.
+	PolicyWeightedRandom = "weighted-random"
+	// PolicyLeastLoaded writes to the backends with the lowest one-minute load average, then
+	// the lowest health check latency.
+	PolicyLeastLoaded = "least-loaded"
+	// PolicyPowerOfTwo picks two backends at random and writes to the less loaded one.
+	PolicyPowerOfTwo = "power-of-two"
+)
+
+// PlacementPolicy chooses the backends an upload is written to.
+type PlacementPolicy interface {
+	// Select returns the URLs of up to count distinct candidates in the order the upload is
+	// written to them. Every candidate is online, accepts uploads and has room for the file.
+	Select(candidates []models.BackendStatus, count int) []string
+}
+
+// PlacementPolicyFunc adapts a function to a PlacementPolicy.
+type PlacementPolicyFunc func(candidates []models.BackendStatus, count int) []string
+
+// Select calls f.
+func (f PlacementPolicyFunc) Select(candidates []models.BackendStatus, count int) []string {
+	return f(candidates, count)
+}
+
+var (
+	policiesMu sync.RWMutex
+	policies   = map[string]PlacementPolicy{
+		PolicyMostFree:       PlacementPolicyFunc(selectMostFree),
+		PolicyWeightedRandom: PlacementPolicyFunc(selectWeightedRandom),
+		PolicyLeastLoaded:    PlacementPolicyFunc(selectLeastLoaded),
+		PolicyPowerOfTwo:     PlacementPolicyFunc(selectPowerOfTwo),
+	}
+)
+
+// RegisterPlacementPolicy makes policy selectable by name for the balancer and for buckets,
+// replacing any policy registered under the same name.
+func RegisterPlacementPolicy(name string, policy PlacementPolicy) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	policies[name] = policy
+}
+
+// LookupPlacementPolicy returns the policy registered under name.
+func LookupPlacementPolicy(name string) (PlacementPolicy, error) {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+
+	policy, ok := policies[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPlacementPolicy, name)
+	}
+	return policy, nil
+}
+
+// PlacementPolicies returns the names of all registered policies, sorted.
+func PlacementPolicies() []string {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// statusURLs returns the URLs of the first count statuses.
+func statusURLs(statuses []models.BackendStatus, count int) []string {
+	urls := make([]string, 0, min(count, len(statuses)))
+	for _, status := range statuses[:min(count, len(statuses))] {
+		urls = append(urls, status.URL)
+	}
+	return urls
+}
+
+// selectMostFree orders candidates by available space, most first.
+func selectMostFree(candidates []models.BackendStatus, count int) []string {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].AvailableSpace != candidates[j].AvailableSpace {
+			return candidates[i].AvailableSpace > candidates[j].AvailableSpace
+		}
+		return candidates[i].URL < candidates[j].URL
+	})
+	return statusURLs(candidates, count)
+}
+
+// selectWeightedRandom draws candidates without replacement with a probability proportional to
+// their available space. Each candidate gets an exponentially distributed key with its space as
+// rate; ordering by key is equivalent to drawing one backend after another.
+func selectWeightedRandom(candidates []models.BackendStatus, count int) []string {
+	keys := make(map[string]float64, len(candidates))
+	for _, status := range candidates {
+		//nolint:gosec // Placement needs no cryptographic randomness
+		keys[status.URL] = -math.Log(1-rand.Float64()) / float64(max(status.AvailableSpace, 1))
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return keys[candidates[i].URL] < keys[candidates[j].URL]
+	})
+	return statusURLs(candidates, count)
+}
+
+// selectLeastLoaded orders candidates from the least to the most loaded.
+func selectLeastLoaded(candidates []models.BackendStatus, count int) []string {
+	sort.Slice(candidates, func(i, j int) bool {
+		return lessLoaded(&candidates[i], &candidates[j])
+	})
+	return statusURLs(candidates, count)
+}
+
+// selectPowerOfTwo fills each slot with the less loaded of two candidates drawn at random from
+// the ones not chosen yet.
+func selectPowerOfTwo(candidates []models.BackendStatus, count int) []string {
+	remaining := slices.Clone(candidates)
+	urls := make([]string, 0, min(count, len(candidates)))
+	for len(urls) < count && len(remaining) > 0 {
+		chosen := 0
+		if len(remaining) > 1 {
+			//nolint:gosec // Placement needs no cryptographic randomness
+			first, second := rand.IntN(len(remaining)), rand.IntN(len(remaining)-1)
+			if second >= first {
+				second++
+			}
+			chosen = first
+			if lessLoaded(&remaining[second], &remaining[first]) {
+				chosen = second
+			}
+		}
+		urls = append(urls, remaining[chosen].URL)
+		remaining = slices.Delete(remaining, chosen, chosen+1)
+	}
+	return urls
+}
+
+// lessLoaded reports whether backend a is less loaded than b: a lower one-minute load
+// average, then a lower health check latency, then more available space. Backends that do
+// not report a load average count as the most loaded.
+func lessLoaded(a, b *models.BackendStatus) bool {
+	if loadA, loadB := backendLoad(a), backendLoad(b); loadA != loadB {
+		return loadA < loadB
+	}
+	if a.Latency != b.Latency {
+		return a.Latency < b.Latency
+	}
+	if a.AvailableSpace != b.AvailableSpace {
+		return a.AvailableSpace > b.AvailableSpace
+	}
+	return a.URL < b.URL
+}
+
+// backendLoad returns the one-minute load average a backend reported.
+func backendLoad(status *models.BackendStatus) float64 {
+	if status.NodeInfo == nil {
+		return math.Inf(1)
+	}
+	return status.NodeInfo.LoadAverages.Load1
+}
@@ -0,0 +1,181 @@
+package balancer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"loopfs/pkg/bucket"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// PolicyTestSuite tests the upload placement policies
+type PolicyTestSuite struct {
+	suite.Suite
+}
+
+// candidates returns backend states with the given available space and load averages
+func candidates(space []uint64, loads []float64) []models.BackendStatus {
+	statuses := make([]models.BackendStatus, len(space))
+	for i := range space {
+		statuses[i] = models.BackendStatus{
+			URL:            string(rune('a' + i)),
+			Online:         true,
+			AvailableSpace: space[i],
+			NodeInfo:       &models.NodeInfo{LoadAverages: models.LoadAverages{Load1: loads[i]}},
+		}
+	}
+	return statuses
+}
+
+// TestRegistry tests looking up built-in and registered policies
+func (s *PolicyTestSuite) TestRegistry() {
+	s.Equal([]string{PolicyLeastLoaded, PolicyMostFree, PolicyPowerOfTwo, PolicyWeightedRandom}, PlacementPolicies())
+
+	_, err := LookupPlacementPolicy("fastest")
+	s.ErrorIs(err, ErrUnknownPlacementPolicy)
+
+	RegisterPlacementPolicy("first", PlacementPolicyFunc(func(candidates []models.BackendStatus, _ int) []string {
+		return []string{candidates[0].URL}
+	}))
+	defer func() {
+		policiesMu.Lock()
+		delete(policies, "first")
+		policiesMu.Unlock()
+	}()
+
+	policy, err := LookupPlacementPolicy("first")
+	s.Require().NoError(err)
+	s.Equal([]string{"a"}, policy.Select(candidates([]uint64{1, 2}, []float64{0, 0}), 2))
+}
+
+// TestMostFree tests ordering by available space
+func (s *PolicyTestSuite) TestMostFree() {
+	s.Equal([]string{"b", "c"}, selectMostFree(candidates([]uint64{1, 9, 5}, []float64{0, 0, 0}), 2))
+}
+
+// TestWeightedRandom tests that picks follow available space without herding onto the emptiest backend
+func (s *PolicyTestSuite) TestWeightedRandom() {
+	picks := make(map[string]int)
+	for range 2000 {
+		selected := selectWeightedRandom(candidates([]uint64{1000, 3000}, []float64{0, 0}), 1)
+		s.Require().Len(selected, 1)
+		picks[selected[0]]++
+	}
+
+	// b has three times the space of a, so it is picked about 75% of the time
+	s.InDelta(1500, picks["b"], 150)
+	s.Positive(picks["a"])
+
+	selected := selectWeightedRandom(candidates([]uint64{1, 2, 3}, []float64{0, 0, 0}), 3)
+	s.ElementsMatch([]string{"a", "b", "c"}, selected)
+}
+
+// TestLeastLoaded tests ordering by load average, then latency
+func (s *PolicyTestSuite) TestLeastLoaded() {
+	statuses := candidates([]uint64{9, 1, 1, 1}, []float64{4, 0.5, 0.5, 2})
+	statuses[1].Latency = 30
+	statuses[2].Latency = 10
+	statuses[3].NodeInfo = nil
+
+	s.Equal([]string{"c", "b", "a", "d"}, selectLeastLoaded(statuses, 4))
+}
+
+// TestPowerOfTwo tests that the most loaded backend is never the first choice and picks are distinct
+func (s *PolicyTestSuite) TestPowerOfTwo() {
+	for range 200 {
+		selected := selectPowerOfTwo(candidates([]uint64{1, 1, 1}, []float64{1, 2, 9}), 3)
+		s.Require().Len(selected, 3)
+		s.ElementsMatch([]string{"a", "b", "c"}, selected)
+		s.NotEqual("c", selected[0])
+	}
+
+	s.Equal([]string{"a"}, selectPowerOfTwo(candidates([]uint64{1}, []float64{0}), 2))
+}
+
+// TestGetBackendsWithPolicy tests that policies only see backends able to take the upload
+func (s *PolicyTestSuite) TestGetBackendsWithPolicy() {
+	bm := NewBackendManager([]string{"http://a", "http://b", "http://c"}, time.Hour, time.Second)
+	bm.backends["http://a"].AvailableSpace = 100
+	bm.backends["http://b"].AvailableSpace = 10
+	bm.backends["http://c"].AvailableSpace = 1000
+	bm.backends["http://c"].Online = false
+
+	var seen []string
+	policy := PlacementPolicyFunc(func(candidates []models.BackendStatus, count int) []string {
+		for _, status := range candidates {
+			seen = append(seen, status.URL)
+		}
+		return selectMostFree(candidates, count)
+	})
+
+	backends, err := bm.GetBackendsWithPolicy(policy, 50, 2)
+	s.Require().NoError(err)
+	s.Equal([]string{"http://a"}, backends)
+	s.Equal([]string{"http://a"}, seen)
+
+	_, err = bm.GetBackendsWithPolicy(policy, 500, 1)
+	s.ErrorIs(err, ErrNoBackendAvailable)
+}
+
+// TestSetUploadPolicy tests selecting the balancer's upload policy
+func (s *PolicyTestSuite) TestSetUploadPolicy() {
+	bm := NewBackendManager([]string{"http://a"}, time.Hour, time.Second)
+	balancer := NewBalancer(bm, 0, time.Millisecond, time.Millisecond, time.Second)
+
+	s.ErrorIs(balancer.SetUploadPolicy("fastest"), ErrUnknownPlacementPolicy)
+	s.Require().NoError(balancer.SetUploadPolicy(PolicyLeastLoaded))
+
+	server := NewServer(ServerConfig{})
+	s.Equal(PolicyMostFree, server.uploadPolicy)
+	s.ErrorIs(server.SetUploadPolicy("fastest"), ErrUnknownPlacementPolicy)
+	s.Require().NoError(server.SetUploadPolicy(PolicyPowerOfTwo))
+	s.Equal(PolicyPowerOfTwo, server.uploadPolicy)
+}
+
+// TestBucketPolicy tests resolving the policy of a bucket
+func (s *PolicyTestSuite) TestBucketPolicy() {
+	s.Nil(bucketPolicy(&models.Bucket{Name: "photos"}))
+	s.Nil(bucketPolicy(&models.Bucket{Name: "photos", PlacementPolicy: "removed"}))
+	s.NotNil(bucketPolicy(&models.Bucket{Name: "photos", PlacementPolicy: PolicyLeastLoaded}))
+}
+
+// TestCreateBucketPlacementPolicy tests that buckets only accept registered policies
+func (s *PolicyTestSuite) TestCreateBucketPlacementPolicy() {
+	store, err := bucket.NewStore(filepath.Join(s.T().TempDir(), "buckets.db"))
+	s.Require().NoError(err)
+	defer func() { _ = store.Close() }()
+	handlers := NewBucketHandlers(store)
+
+	create := func(name, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/bucket/"+name, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, rec)
+		ctx.SetParamNames("name")
+		ctx.SetParamValues(name)
+		s.Require().NoError(handlers.CreateBucketHandler(ctx))
+		return rec
+	}
+
+	rec := create("photos", `{"placement_policy":"fastest"}`)
+	s.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = create("photos", `{"placement_policy":"weighted-random"}`)
+	s.Require().Equal(http.StatusCreated, rec.Code)
+	var created models.Bucket
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &created))
+	s.Equal(PolicyWeightedRandom, created.PlacementPolicy)
+}
+
+func TestPolicySuite(t *testing.T) {
+	suite.Run(t, new(PolicyTestSuite))
+}
@@ -0,0 +1,144 @@
+package balancer
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"loopfs/pkg/models"
+)
+
+// RepairQueue records objects stored on fewer backends than the replication factor, and
+// tombstones of deleted objects so repairs do not copy them back.
+type RepairQueue interface {
+	AddRepair(ctx context.Context, item *models.RepairItem) error
+	ListRepairs(ctx context.Context, limit int) ([]models.RepairItem, error)
+	RemoveRepair(ctx context.Context, hash string) error
+	RecordRepairFailure(ctx context.Context, hash, lastError string) error
+
+	AddTombstone(ctx context.Context, hash string) error
+	Tombstones(ctx context.Context, prefix string) (map[string]time.Time, error)
+	PurgeTombstones(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// MemoryRepairQueue is a RepairQueue kept in memory, used when no bucket store is configured.
+// Queued repairs and tombstones are lost on restart.
+type MemoryRepairQueue struct {
+	mu         sync.Mutex
+	items      map[string]*models.RepairItem
+	tombstones map[string]time.Time
+}
+
+// NewMemoryRepairQueue creates an empty in-memory repair queue.
+func NewMemoryRepairQueue() *MemoryRepairQueue {
+	return &MemoryRepairQueue{
+		items:      make(map[string]*models.RepairItem),
+		tombstones: make(map[string]time.Time),
+	}
+}
+
+// AddRepair queues an under-replicated object, replacing the replica set of an already queued one.
+func (q *MemoryRepairQueue) AddRepair(_ context.Context, item *models.RepairItem) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	queued := *item
+	queued.Replicas = append([]string(nil), item.Replicas...)
+	queued.UpdatedAt = now
+	if existing, ok := q.items[item.Hash]; ok {
+		queued.CreatedAt = existing.CreatedAt
+		queued.Attempts = existing.Attempts
+	} else {
+		queued.CreatedAt = now
+		queued.Attempts = 0
+	}
+	q.items[item.Hash] = &queued
+	return nil
+}
+
+// ListRepairs returns up to limit queued repairs, oldest first. A limit of zero or less returns all.
+func (q *MemoryRepairQueue) ListRepairs(_ context.Context, limit int) ([]models.RepairItem, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := make([]models.RepairItem, 0, len(q.items))
+	for _, item := range q.items {
+		copied := *item
+		copied.Replicas = append([]string(nil), item.Replicas...)
+		items = append(items, copied)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].CreatedAt.Before(items[j].CreatedAt)
+		}
+		return items[i].Hash < items[j].Hash
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+// RemoveRepair removes a repaired object from the queue.
+func (q *MemoryRepairQueue) RemoveRepair(_ context.Context, hash string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.items, hash)
+	return nil
+}
+
+// RecordRepairFailure counts a failed repair attempt of a queued object.
+func (q *MemoryRepairQueue) RecordRepairFailure(_ context.Context, hash, lastError string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if item, ok := q.items[hash]; ok {
+		item.Attempts++
+		item.LastError = lastError
+		item.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+// AddTombstone records that an object was deleted and drops its queued repair.
+func (q *MemoryRepairQueue) AddTombstone(_ context.Context, hash string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.tombstones[hash] = time.Now()
+	delete(q.items, hash)
+	return nil
+}
+
+// Tombstones returns when the objects whose hash starts with prefix were deleted.
+func (q *MemoryRepairQueue) Tombstones(_ context.Context, prefix string) (map[string]time.Time, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tombstones := make(map[string]time.Time)
+	for hash, deletedAt := range q.tombstones {
+		if strings.HasPrefix(hash, prefix) {
+			tombstones[hash] = deletedAt
+		}
+	}
+	return tombstones, nil
+}
+
+// PurgeTombstones drops the tombstones of objects deleted before cutoff and returns their number.
+func (q *MemoryRepairQueue) PurgeTombstones(_ context.Context, cutoff time.Time) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var purged int64
+	for hash, deletedAt := range q.tombstones {
+		if deletedAt.Before(cutoff) {
+			delete(q.tombstones, hash)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,83 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// RepairQueueTestSuite tests the in-memory repair queue
+type RepairQueueTestSuite struct {
+	suite.Suite
+	queue *MemoryRepairQueue
+}
+
+// SetupTest creates an empty queue
+func (s *RepairQueueTestSuite) SetupTest() {
+	s.queue = NewMemoryRepairQueue()
+}
+
+// TestAddRepairReplacesReplicas tests that queueing a hash again updates its replicas
+func (s *RepairQueueTestSuite) TestAddRepairReplacesReplicas() {
+	s.NoError(s.queue.AddRepair(context.Background(), &models.RepairItem{Hash: "aaa", Size: 10, Replicas: []string{"http://a"}, Wanted: 3}))
+	items, err := s.queue.ListRepairs(context.Background(), 0)
+	s.NoError(err)
+	s.Require().Len(items, 1)
+	createdAt := items[0].CreatedAt
+
+	s.NoError(s.queue.AddRepair(context.Background(), &models.RepairItem{
+		Hash: "aaa", Size: 10, Replicas: []string{"http://a", "http://b"}, Wanted: 3, LastError: "timeout",
+	}))
+	items, err = s.queue.ListRepairs(context.Background(), 0)
+	s.NoError(err)
+	s.Require().Len(items, 1)
+	s.Equal([]string{"http://a", "http://b"}, items[0].Replicas)
+	s.Equal("timeout", items[0].LastError)
+	s.Equal(createdAt, items[0].CreatedAt)
+}
+
+// TestListRepairsOldestFirst tests ordering and limits
+func (s *RepairQueueTestSuite) TestListRepairsOldestFirst() {
+	s.NoError(s.queue.AddRepair(context.Background(), &models.RepairItem{Hash: "first", Wanted: 2}))
+	time.Sleep(time.Millisecond)
+	s.NoError(s.queue.AddRepair(context.Background(), &models.RepairItem{Hash: "second", Wanted: 2}))
+	time.Sleep(time.Millisecond)
+	s.NoError(s.queue.AddRepair(context.Background(), &models.RepairItem{Hash: "third", Wanted: 2}))
+
+	items, err := s.queue.ListRepairs(context.Background(), 2)
+	s.NoError(err)
+	s.Require().Len(items, 2)
+	s.Equal("first", items[0].Hash)
+	s.Equal("second", items[1].Hash)
+}
+
+// TestTombstones tests that a tombstone drops the queued repair and is purged once older than
+// the cutoff
+func (s *RepairQueueTestSuite) TestTombstones() {
+	s.NoError(s.queue.AddRepair(context.Background(), &models.RepairItem{Hash: "aaa", Wanted: 2}))
+	s.NoError(s.queue.AddTombstone(context.Background(), "aaa"))
+	s.NoError(s.queue.AddTombstone(context.Background(), "bbb"))
+	items, err := s.queue.ListRepairs(context.Background(), 0)
+	s.NoError(err)
+	s.Empty(items)
+
+	tombstones, err := s.queue.Tombstones(context.Background(), "a")
+	s.NoError(err)
+	s.Len(tombstones, 1)
+	s.Contains(tombstones, "aaa")
+
+	purged, err := s.queue.PurgeTombstones(context.Background(), time.Now().Add(time.Second))
+	s.NoError(err)
+	s.Equal(int64(2), purged)
+	tombstones, err = s.queue.Tombstones(context.Background(), "")
+	s.NoError(err)
+	s.Empty(tombstones)
+}
+
+func TestRepairQueueSuite(t *testing.T) {
+	suite.Run(t, new(RepairQueueTestSuite))
+}
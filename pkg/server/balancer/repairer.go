@@ -0,0 +1,747 @@
+package balancer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRepairInterval      = time.Hour
+	defaultRepairQueueInterval = time.Minute
+	defaultRepairRequestRate   = 20
+	// repairBatchSize is the number of queued repairs handled per run.
+	repairBatchSize = 100
+	// repairStatusQueueLimit is the number of queued repairs shown by the status endpoint.
+	repairStatusQueueLimit = 100
+	// repairResultSuccess and repairResultFailure label repair copy metrics.
+	repairResultSuccess = "success"
+	repairResultFailure = "failure"
+)
+
+// RepairConfig configures the background repair of under-replicated blobs.
+type RepairConfig struct {
+	Interval      time.Duration // Between full scans of all backends, 0 disables periodic scans
+	QueueInterval time.Duration // Between passes over the repair queue, 0 disables them
+	RequestRate   float64       // Backend requests per second, 0 means unlimited
+	Bandwidth     int64         // Bytes per second copied between backends, 0 means unlimited
+}
+
+// DefaultRepairConfig returns the repair settings used by the balancer.
+func DefaultRepairConfig() RepairConfig {
+	return RepairConfig{
+		Interval:      defaultRepairInterval,
+		QueueInterval: defaultRepairQueueInterval,
+		RequestRate:   defaultRepairRequestRate,
+	}
+}
+
+// Repairer restores the replication factor of blobs. It retries uploads queued as
+// under-replicated and periodically compares the hash listings of all online backends,
+// copying blobs with too few replicas backend-to-backend.
+type Repairer struct {
+	balancer  *Balancer
+	queue     RepairQueue
+	config    RepairConfig
+	requests  *rate.Limiter
+	bandwidth *rate.Limiter
+	trigger   chan struct{}
+	active    func() bool
+	ctx       context.Context //nolint:containedctx // Cancelled by Stop to abort running copies
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	mu     sync.Mutex
+	status models.RepairStatus
+}
+
+// NewRepairer creates a repairer placing replicas through the balancer's backends.
+func NewRepairer(balancer *Balancer, queue RepairQueue, config RepairConfig) *Repairer {
+	requests := rate.NewLimiter(rate.Inf, 1)
+	if config.RequestRate > 0 {
+		requests = rate.NewLimiter(rate.Limit(config.RequestRate), 1)
+	}
+	bandwidth := rate.NewLimiter(rate.Inf, 0)
+	if config.Bandwidth > 0 {
+		bandwidth = rate.NewLimiter(rate.Limit(config.Bandwidth), int(config.Bandwidth))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Repairer{
+		balancer:  balancer,
+		queue:     queue,
+		config:    config,
+		requests:  requests,
+		bandwidth: bandwidth,
+		trigger:   make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// SetActive makes the repairer run only while active reports true. It must be called before
+// Start.
+func (r *Repairer) SetActive(active func() bool) {
+	r.active = active
+}
+
+// isActive reports whether the repairer runs.
+func (r *Repairer) isActive() bool {
+	return r.active == nil || r.active()
+}
+
+// Start runs queued repairs and periodic full scans in the background.
+func (r *Repairer) Start() {
+	r.wg.Add(1)
+	go r.loop()
+}
+
+// Stop aborts the running repair and waits for the worker to exit.
+func (r *Repairer) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// Trigger requests a full repair run. It reports false if a run is already in progress or pending.
+func (r *Repairer) Trigger() bool {
+	r.mu.Lock()
+	running := r.status.Running
+	r.mu.Unlock()
+	if running {
+		return false
+	}
+
+	select {
+	case r.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Status returns the progress of the current or last repair run and the head of the queue.
+func (r *Repairer) Status() models.RepairStatus {
+	r.mu.Lock()
+	status := r.status
+	r.mu.Unlock()
+
+	status.ReplicationFactor = r.balancer.replicationFactor
+	status.Queue = []models.RepairItem{}
+	items, err := r.queue.ListRepairs(context.Background(), repairStatusQueueLimit)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to list repair queue")
+	} else {
+		status.Queue = items
+	}
+	return status
+}
+
+// loop runs repairs until the repairer is stopped.
+func (r *Repairer) loop() {
+	defer r.wg.Done()
+
+	var queueTick, scanTick <-chan time.Time
+	if r.config.QueueInterval > 0 {
+		ticker := time.NewTicker(r.config.QueueInterval)
+		defer ticker.Stop()
+		queueTick = ticker.C
+	}
+	if r.config.Interval > 0 {
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+		scanTick = ticker.C
+		r.setNextScan(time.Now().Add(r.config.Interval))
+	}
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-queueTick:
+			_ = r.run(r.ctx, false)
+		case <-scanTick:
+			r.setNextScan(time.Now().Add(r.config.Interval))
+			_ = r.run(r.ctx, true)
+		case <-r.trigger:
+			_ = r.run(r.ctx, true)
+		}
+	}
+}
+
+// run repairs queued blobs and, for a full scan, every under-replicated blob on the backends.
+// A queue pass with nothing queued, and any run while inactive, leaves the status of the last
+// run untouched.
+func (r *Repairer) run(ctx context.Context, fullScan bool) error {
+	if !r.isActive() {
+		return nil
+	}
+	items, err := r.queue.ListRepairs(context.Background(), repairBatchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list repair queue")
+		return err
+	}
+	if len(items) == 0 && !fullScan {
+		return nil
+	}
+
+	r.begin(fullScan)
+	r.repairQueued(ctx, items)
+	if fullScan && r.balancer.replicationFactor > 1 && ctx.Err() == nil {
+		err = r.scan(ctx)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	r.finish(err)
+	return err
+}
+
+// repairQueued places the missing replicas of queued blobs and removes them once complete.
+func (r *Repairer) repairQueued(ctx context.Context, items []models.RepairItem) {
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		r.update(func(progress *models.RepairProgress) { progress.QueuedChecked++ })
+
+		holders, size := r.locate(ctx, item.Hash)
+		if size == 0 {
+			size = item.Size
+		}
+		deletedAt, deleted, err := r.deletedAt(ctx, item.Hash)
+		if err == nil && deleted {
+			holders, err = r.dropDeleted(ctx, item.Hash, deletedAt, holders)
+		}
+		switch {
+		case err != nil:
+		case deleted && len(holders) == 0:
+			// Deleted everywhere, nothing to repair
+		case len(holders) >= r.balancer.replicationFactor:
+		case len(holders) == 0:
+			err = ErrNoReplicaOnline
+		default:
+			r.update(func(progress *models.RepairProgress) { progress.UnderReplicated++ })
+			err = r.replicate(ctx, item.Hash, size, holders)
+		}
+
+		if err != nil && !errors.Is(err, ErrBlobDeleted) {
+			if recordErr := r.queue.RecordRepairFailure(context.Background(), item.Hash, err.Error()); recordErr != nil {
+				log.Warn().Err(recordErr).Str("hash", item.Hash).Msg("Failed to record repair failure")
+			}
+			continue
+		}
+		if removeErr := r.queue.RemoveRepair(context.Background(), item.Hash); removeErr != nil {
+			log.Warn().Err(removeErr).Str("hash", item.Hash).Msg("Failed to remove repaired blob from queue")
+		}
+	}
+}
+
+// scan compares the hash listings of all online backends prefix by prefix and replicates
+// blobs held by fewer backends than the replication factor. A backend whose prefixes cannot
+// be listed aborts the scan, since its blobs would otherwise look under-replicated. Replicas
+// of deleted blobs are deleted; once a scan of all backends succeeded, the tombstones of
+// blobs deleted before it are purged.
+func (r *Repairer) scan(ctx context.Context) error {
+	started := time.Now()
+	online := r.balancer.backendManager.GetOnlineBackends()
+	backendsByPrefix := make(map[string][]string)
+	for _, backend := range online {
+		var listing models.PrefixListResponse
+		if err := r.getJSON(ctx, backend+"/file/list", &listing); err != nil {
+			return fmt.Errorf("failed to list prefixes of %s: %w", backend, err)
+		}
+		for _, prefix := range listing.Prefixes {
+			backendsByPrefix[prefix] = append(backendsByPrefix[prefix], backend)
+		}
+	}
+
+	prefixes := make([]string, 0, len(backendsByPrefix))
+	for prefix := range backendsByPrefix {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	r.update(func(progress *models.RepairProgress) { progress.PrefixesTotal = len(prefixes) })
+
+	var scanErr error
+	for _, prefix := range prefixes {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := r.scanPrefix(ctx, prefix, backendsByPrefix[prefix]); err != nil {
+			log.Warn().Err(err).Str("prefix", prefix).Msg("Repair scan of prefix failed")
+			scanErr = err
+		}
+		r.update(func(progress *models.RepairProgress) { progress.PrefixesScanned++ })
+	}
+
+	// A backend offline now may still hold blobs deleted meanwhile
+	if scanErr != nil || len(online) < r.balancer.backendManager.BackendCount() {
+		return scanErr
+	}
+	purged, err := r.queue.PurgeTombstones(context.WithoutCancel(ctx), started)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to purge blob tombstones")
+		return nil
+	}
+	if purged > 0 {
+		log.Info().Int64("purged", purged).Msg("Purged blob tombstones")
+	}
+	return nil
+}
+
+// scanPrefix replicates the under-replicated blobs of one prefix and deletes the replicas of
+// deleted ones.
+func (r *Repairer) scanPrefix(ctx context.Context, prefix string, backends []string) error {
+	tombstones, err := r.queue.Tombstones(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to read tombstones: %w", err)
+	}
+	holders := make(map[string][]string)
+	for _, backend := range backends {
+		var listing models.HashListResponse
+		if err := r.getJSON(ctx, backend+"/file/list/"+prefix, &listing); err != nil {
+			return fmt.Errorf("failed to list hashes of %s: %w", backend, err)
+		}
+		for _, hash := range listing.Hashes {
+			holders[hash] = append(holders[hash], backend)
+		}
+	}
+
+	hashes := make([]string, 0, len(holders))
+	for hash := range holders {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	var dropErr error
+	for _, hash := range hashes {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r.update(func(progress *models.RepairProgress) { progress.BlobsChecked++ })
+		if deletedAt, deleted := tombstones[hash]; deleted {
+			live, err := r.dropDeleted(ctx, hash, deletedAt, holders[hash])
+			if err != nil {
+				dropErr = err
+			}
+			if len(live) == 0 {
+				continue
+			}
+			holders[hash] = live
+		}
+		if len(holders[hash]) >= r.balancer.replicationFactor {
+			continue
+		}
+		r.update(func(progress *models.RepairProgress) { progress.UnderReplicated++ })
+
+		var info models.FileInfo
+		if err := r.getJSON(ctx, holders[hash][0]+"/file/"+hash+"/info", &info); err != nil {
+			log.Warn().Err(err).Str("hash", hash).Msg("Failed to get size of under-replicated blob")
+			continue
+		}
+		if err := r.replicate(ctx, hash, info.Size, holders[hash]); err != nil && !errors.Is(err, ErrBlobDeleted) {
+			log.Warn().Err(err).Str("hash", hash).Strs("replicas", holders[hash]).Msg("Failed to repair blob")
+		}
+	}
+	return dropErr
+}
+
+// deletedAt returns when hash was deleted, and false if it has no tombstone.
+func (r *Repairer) deletedAt(ctx context.Context, hash string) (time.Time, bool, error) {
+	tombstones, err := r.queue.Tombstones(ctx, hash)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to read tombstones: %w", err)
+	}
+	deletedAt, deleted := tombstones[hash]
+	return deletedAt, deleted, nil
+}
+
+// dropDeleted deletes the replicas of a deleted blob stored before its delete and returns the
+// holders of replicas uploaded again after it. Replicas whose age is unknown are kept.
+func (r *Repairer) dropDeleted(ctx context.Context, hash string, deletedAt time.Time, holders []string) ([]string, error) {
+	var (
+		live    []string
+		dropErr error
+	)
+	for _, holder := range holders {
+		var info models.FileInfo
+		if err := r.getJSON(ctx, holder+"/file/"+hash+"/info", &info); err != nil {
+			log.Warn().Err(err).Str("hash", hash).Str("backend", holder).Msg("Failed to get age of deleted blob")
+			dropErr = err
+			continue
+		}
+		if info.CreatedAt.After(deletedAt) {
+			live = append(live, holder)
+			continue
+		}
+		if err := r.deleteReplica(ctx, hash, holder); err != nil {
+			log.Warn().Err(err).Str("hash", hash).Str("backend", holder).Msg("Failed to delete replica of deleted blob")
+			dropErr = err
+		}
+	}
+	return live, dropErr
+}
+
+// deleteReplica deletes the replica of a deleted blob from backend.
+func (r *Repairer) deleteReplica(ctx context.Context, hash, backend string) error {
+	if err := r.requests.Wait(ctx); err != nil {
+		return err
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, r.balancer.RequestTimeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodDelete, backend+"/file/"+hash+"/delete", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.balancer.client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if closeErr := resp.Body.Close(); closeErr != nil {
+		log.Warn().Err(closeErr).Msg("Failed to close repair delete response body")
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("%w: %s returned status %d", ErrUnexpectedStatus, backend, resp.StatusCode)
+	}
+
+	r.balancer.forgetLocation(hash, backend)
+	r.update(func(progress *models.RepairProgress) { progress.ReplicasDeleted++ })
+	log.Info().Str("hash", hash).Str("backend", backend).Msg("Deleted replica of deleted blob")
+	return nil
+}
+
+// locate returns the online backends holding hash and the blob size reported by them.
+func (r *Repairer) locate(ctx context.Context, hash string) ([]string, int64) {
+	var (
+		holders []string
+		size    int64
+	)
+	for _, backend := range r.balancer.backendManager.GetOnlineBackends() {
+		var info models.FileInfo
+		if err := r.getJSON(ctx, backend+"/file/"+hash+"/info", &info); err != nil {
+			continue
+		}
+		holders = append(holders, backend)
+		size = info.Size
+	}
+	return holders, size
+}
+
+// replicate copies the blob from its holders to new backends until it reaches the replication factor.
+func (r *Repairer) replicate(ctx context.Context, hash string, size int64, holders []string) error {
+	missing := r.balancer.replicationFactor - len(holders)
+	candidates, err := r.balancer.uploadBackends(hash, size, r.balancer.backendManager.BackendCount(), nil)
+	if err != nil {
+		return err
+	}
+
+	placed := 0
+	var copyErr error
+	for _, target := range candidates {
+		if placed == missing || ctx.Err() != nil {
+			break
+		}
+		if slices.Contains(holders, target) {
+			continue
+		}
+		if err := r.copyBlob(ctx, hash, size, holders, target); err != nil {
+			if errors.Is(err, ErrBlobDeleted) {
+				return err
+			}
+			log.Warn().Err(err).Str("hash", hash).Str("target", target).Msg("Failed to copy blob")
+			copyErr = err
+			continue
+		}
+		placed++
+	}
+
+	switch {
+	case placed == missing:
+		return nil
+	case copyErr != nil:
+		return copyErr
+	case ctx.Err() != nil:
+		return ctx.Err()
+	default:
+		return fmt.Errorf("%w: placed %d of %d missing replicas", ErrNoBackendAvailable, placed, missing)
+	}
+}
+
+// copyBlob copies the blob to target from the first source that can provide it. A copy of a
+// blob deleted meanwhile is deleted again and ErrBlobDeleted returned, since the delete may
+// have missed it.
+func (r *Repairer) copyBlob(ctx context.Context, hash string, size int64, sources []string, target string) error {
+	started := time.Now()
+	var err error
+	for _, source := range sources {
+		var copied int64
+		copied, err = r.copyFrom(ctx, hash, size, source, target)
+		if err == nil {
+			if err = r.undoIfDeleted(ctx, hash, target, started); err != nil {
+				return err
+			}
+			repairCopiesTotal.WithLabelValues(repairResultSuccess).Inc()
+			r.balancer.rememberLocation(hash, target)
+			repairBytesTotal.Add(float64(copied))
+			r.update(func(progress *models.RepairProgress) {
+				progress.CopiesDone++
+				progress.BytesCopied += copied
+			})
+			log.Info().Str("hash", hash).Str("source", source).Str("target", target).Int64("bytes", copied).Msg("Blob replicated")
+			return nil
+		}
+	}
+
+	repairCopiesTotal.WithLabelValues(repairResultFailure).Inc()
+	r.update(func(progress *models.RepairProgress) { progress.CopiesFailed++ })
+	return err
+}
+
+// undoIfDeleted deletes the copy of hash on target if the blob was deleted since started, and
+// returns ErrBlobDeleted then.
+func (r *Repairer) undoIfDeleted(ctx context.Context, hash, target string, started time.Time) error {
+	deletedAt, deleted, err := r.deletedAt(context.WithoutCancel(ctx), hash)
+	if err != nil {
+		log.Warn().Err(err).Str("hash", hash).Msg("Failed to check repaired blob for a delete")
+		return nil
+	}
+	if !deleted || deletedAt.Before(started) {
+		return nil
+	}
+	if err := r.deleteReplica(context.WithoutCancel(ctx), hash, target); err != nil {
+		log.Error().Err(err).Str("hash", hash).Str("target", target).Msg("Failed to delete copy of blob deleted while repairing")
+		return fmt.Errorf("%w: failed to delete the copy on %s: %w", ErrBlobDeleted, target, err)
+	}
+	return ErrBlobDeleted
+}
+
+// copyFrom streams the blob from source's download straight into target's upload and
+// verifies the hash computed by target. It returns the number of bytes copied.
+func (r *Repairer) copyFrom(ctx context.Context, hash string, size int64, source, target string) (int64, error) {
+	copyCtx, cancel := context.WithTimeout(ctx, r.copyTimeout(size))
+	defer cancel()
+
+	if err := r.requests.Wait(copyCtx); err != nil {
+		return 0, err
+	}
+	downloadReq, err := http.NewRequestWithContext(copyCtx, http.MethodGet, source+"/file/"+hash+"/download", nil)
+	if err != nil {
+		return 0, err
+	}
+	download, err := r.balancer.client.HTTPClient.Do(downloadReq)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := download.Body.Close(); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("Failed to close repair download body")
+		}
+	}()
+	if download.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%w: %s returned status %d", ErrUnexpectedStatus, source, download.StatusCode)
+	}
+
+	reader := &throttledReader{ctx: copyCtx, reader: download.Body, limiter: r.bandwidth}
+	boundary := fmt.Sprintf("loopfs-repair-%d", time.Now().UnixNano())
+	uploadBody, contentType, err := streamMultipart(copyCtx, hash, func() (io.ReadCloser, error) {
+		return io.NopCloser(reader), nil
+	}, boundary)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := uploadBody.Close(); closeErr != nil && !errors.Is(closeErr, io.ErrClosedPipe) {
+			log.Warn().Err(closeErr).Msg("Failed to close repair upload body")
+		}
+	}()
+
+	if err := r.requests.Wait(copyCtx); err != nil {
+		return 0, err
+	}
+	uploadReq, err := http.NewRequestWithContext(copyCtx, http.MethodPost, target+"/file/upload", uploadBody)
+	if err != nil {
+		return 0, err
+	}
+	uploadReq.Header.Set("Content-Type", contentType)
+	upload, err := r.balancer.client.HTTPClient.Do(uploadReq)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := upload.Body.Close(); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("Failed to close repair upload response body")
+		}
+	}()
+
+	body, err := io.ReadAll(upload.Body)
+	if err != nil {
+		return 0, err
+	}
+	result := replicaResult{backend: target, status: upload.StatusCode, body: body}
+	if !result.stored() {
+		return 0, fmt.Errorf("%w: %s returned status %d", ErrUnexpectedStatus, target, upload.StatusCode)
+	}
+	if uploaded := uploadedHash(body); uploaded != hash {
+		return 0, fmt.Errorf("%w: %s stored hash %q", ErrRepairHashMismatch, target, uploaded)
+	}
+	return reader.read.Load(), nil
+}
+
+// copyTimeout bounds a copy by the request timeout plus the time the bandwidth limit needs for size bytes.
+func (r *Repairer) copyTimeout(size int64) time.Duration {
+	timeout := r.balancer.RequestTimeout()
+	if r.config.Bandwidth > 0 {
+		timeout += time.Duration(size/r.config.Bandwidth+1) * time.Second
+	}
+	return timeout
+}
+
+// getJSON fetches url and decodes a 200 response into target.
+func (r *Repairer) getJSON(ctx context.Context, url string, target any) error {
+	if err := r.requests.Wait(ctx); err != nil {
+		return err
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, r.balancer.RequestTimeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := r.balancer.client.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("Failed to close repair response body")
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned status %d", ErrUnexpectedStatus, url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// begin resets the progress for a new run.
+func (r *Repairer) begin(fullScan bool) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status.Running = true
+	r.status.FullScan = fullScan
+	r.status.StartedAt = &now
+	r.status.FinishedAt = nil
+	r.status.Progress = models.RepairProgress{}
+	r.status.LastError = ""
+}
+
+// finish records the end of a run.
+func (r *Repairer) finish(err error) {
+	now := time.Now()
+	r.mu.Lock()
+	r.status.Running = false
+	r.status.FinishedAt = &now
+	if err != nil {
+		r.status.LastError = err.Error()
+	}
+	progress := r.status.Progress
+	fullScan := r.status.FullScan
+	r.mu.Unlock()
+
+	event := log.Info()
+	if err != nil {
+		event = log.Warn().Err(err)
+	}
+	event.
+		Bool("full_scan", fullScan).
+		Int("queued_checked", progress.QueuedChecked).
+		Int("prefixes_scanned", progress.PrefixesScanned).
+		Int64("blobs_checked", progress.BlobsChecked).
+		Int64("under_replicated", progress.UnderReplicated).
+		Int64("copies_done", progress.CopiesDone).
+		Int64("copies_failed", progress.CopiesFailed).
+		Int64("bytes_copied", progress.BytesCopied).
+		Int64("replicas_deleted", progress.ReplicasDeleted).
+		Msg("Repair run finished")
+}
+
+// update changes the progress of the running repair.
+func (r *Repairer) update(change func(progress *models.RepairProgress)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(&r.status.Progress)
+}
+
+// setNextScan records when the next periodic full scan starts.
+func (r *Repairer) setNextScan(next time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.NextScanAt = &next
+}
+
+// StatusHandler handles GET /admin/repair.
+func (r *Repairer) StatusHandler(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, r.Status())
+}
+
+// RunHandler handles POST /admin/repair/run by starting a full repair run.
+func (r *Repairer) RunHandler(ctx echo.Context) error {
+	if !r.isActive() {
+		return ctx.JSON(http.StatusConflict, map[string]string{
+			"error": ErrRepairInactive.Error(),
+		})
+	}
+	if !r.Trigger() {
+		return ctx.JSON(http.StatusConflict, map[string]string{
+			"error": ErrRepairRunning.Error(),
+		})
+	}
+	return ctx.JSON(http.StatusAccepted, map[string]string{
+		"message": "repair run started",
+	})
+}
+
+// throttledReader limits the rate at which a reader is consumed and counts the bytes read.
+type throttledReader struct {
+	ctx     context.Context //nolint:containedctx // Bounds waits for the limiter during a copy
+	reader  io.Reader
+	limiter *rate.Limiter
+	read    atomic.Int64
+}
+
+// Read implements io.Reader.
+func (t *throttledReader) Read(buf []byte) (int, error) {
+	limited := t.limiter.Limit() != rate.Inf
+	if limited && len(buf) > t.limiter.Burst() {
+		buf = buf[:t.limiter.Burst()]
+	}
+
+	n, err := t.reader.Read(buf)
+	t.read.Add(int64(n))
+	if limited && n > 0 {
+		if waitErr := t.limiter.WaitN(t.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,419 @@
+package balancer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/time/rate"
+)
+
+// blobBackend is an in-memory CAS backend serving the endpoints used by the repairer
+type blobBackend struct {
+	server     *httptest.Server
+	mu         sync.Mutex
+	blobs      map[string][]byte
+	created    map[string]time.Time
+	corrupt    bool   // Serve downloads with altered content
+	downloads  int    // Download requests received
+	onDownload func() // Called while serving a download
+}
+
+// newBlobBackend starts an in-memory CAS backend
+func newBlobBackend() *blobBackend {
+	backend := &blobBackend{blobs: make(map[string][]byte), created: make(map[string]time.Time)}
+	backend.server = httptest.NewServer(http.HandlerFunc(backend.serve))
+	return backend
+}
+
+// put stores content and returns its hash
+func (b *blobBackend) put(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	b.mu.Lock()
+	b.blobs[hash] = []byte(content)
+	b.created[hash] = time.Now()
+	b.mu.Unlock()
+	return hash
+}
+
+// has reports whether the backend stores hash
+func (b *blobBackend) has(hash string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.blobs[hash]
+	return ok
+}
+
+// serve implements the node info, listing, info, download, upload and delete endpoints
+func (b *blobBackend) serve(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	path := r.URL.Path
+	switch {
+	case path == "/node/info":
+		json.NewEncoder(w).Encode(models.NodeInfo{Storage: models.StorageInfo{Available: 1 << 30}})
+	case path == "/file/list":
+		prefixes := map[string]bool{}
+		for hash := range b.blobs {
+			prefixes[hash[:4]] = true
+		}
+		response := models.PrefixListResponse{Prefixes: []string{}}
+		for prefix := range prefixes {
+			response.Prefixes = append(response.Prefixes, prefix)
+		}
+		sort.Strings(response.Prefixes)
+		json.NewEncoder(w).Encode(response)
+	case strings.HasPrefix(path, "/file/list/"):
+		prefix := strings.TrimPrefix(path, "/file/list/")
+		response := models.HashListResponse{Prefix: prefix, Hashes: []string{}}
+		for hash := range b.blobs {
+			if strings.HasPrefix(hash, prefix) {
+				response.Hashes = append(response.Hashes, hash)
+			}
+		}
+		json.NewEncoder(w).Encode(response)
+	case strings.HasSuffix(path, "/info"):
+		hash := strings.TrimSuffix(strings.TrimPrefix(path, "/file/"), "/info")
+		content, ok := b.blobs[hash]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(models.FileInfo{Hash: hash, Size: int64(len(content)), CreatedAt: b.created[hash]})
+	case strings.HasSuffix(path, "/download"):
+		hash := strings.TrimSuffix(strings.TrimPrefix(path, "/file/"), "/download")
+		b.downloads++
+		if b.onDownload != nil {
+			b.onDownload()
+		}
+		content, ok := b.blobs[hash]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if b.corrupt {
+			content = append([]byte("corrupted "), content...)
+		}
+		w.Write(content)
+	case path == "/file/upload":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+		if _, exists := b.blobs[hash]; exists {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "file already exists", "hash": hash})
+			return
+		}
+		b.blobs[hash] = content
+		b.created[hash] = time.Now()
+		json.NewEncoder(w).Encode(models.UploadResponse{Hash: hash})
+	case strings.HasSuffix(path, "/delete") && r.Method == http.MethodDelete:
+		hash := strings.TrimSuffix(strings.TrimPrefix(path, "/file/"), "/delete")
+		if _, ok := b.blobs[hash]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(b.blobs, hash)
+		delete(b.created, hash)
+		json.NewEncoder(w).Encode(map[string]string{"message": "File deleted successfully", "hash": hash})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// RepairerTestSuite tests anti-entropy repair of under-replicated blobs
+type RepairerTestSuite struct {
+	suite.Suite
+	backends []*blobBackend
+	manager  *BackendManager
+	balancer *Balancer
+	queue    *MemoryRepairQueue
+	repairer *Repairer
+}
+
+// SetupTest starts three in-memory backends and a repairer with a replication factor of two
+func (s *RepairerTestSuite) SetupTest() {
+	s.backends = []*blobBackend{newBlobBackend(), newBlobBackend(), newBlobBackend()}
+	urls := make([]string, 0, len(s.backends))
+	for _, backend := range s.backends {
+		urls = append(urls, backend.server.URL)
+	}
+	s.manager = NewBackendManager(urls, 100*time.Millisecond, 5*time.Second)
+	s.manager.Start()
+	time.Sleep(200 * time.Millisecond)
+
+	s.balancer = NewBalancer(s.manager, 0, time.Millisecond, time.Millisecond, 5*time.Second)
+	s.balancer.SetReplication(2, 0)
+	s.queue = NewMemoryRepairQueue()
+	s.balancer.SetRepairQueue(s.queue)
+	s.repairer = NewRepairer(s.balancer, s.queue, RepairConfig{})
+}
+
+// TearDownTest stops the repairer, the backend manager and the backends
+func (s *RepairerTestSuite) TearDownTest() {
+	s.repairer.Stop()
+	s.manager.Stop()
+	for _, backend := range s.backends {
+		backend.server.Close()
+	}
+}
+
+// replicas counts the backends storing hash
+func (s *RepairerTestSuite) replicas(hash string) int {
+	count := 0
+	for _, backend := range s.backends {
+		if backend.has(hash) {
+			count++
+		}
+	}
+	return count
+}
+
+// TestScanReplicatesMissingBlobs tests that a full scan copies blobs below the replication factor
+func (s *RepairerTestSuite) TestScanReplicatesMissingBlobs() {
+	single := s.backends[0].put("only on the first backend")
+	replicated := s.backends[0].put("on two backends")
+	s.backends[1].put("on two backends")
+
+	s.Require().NoError(s.repairer.run(context.Background(), true))
+	s.Equal(2, s.replicas(single))
+	s.Equal(2, s.replicas(replicated))
+
+	status := s.repairer.Status()
+	s.False(status.Running)
+	s.True(status.FullScan)
+	s.Equal(2, status.ReplicationFactor)
+	s.NotNil(status.FinishedAt)
+	s.Empty(status.LastError)
+	s.Equal(int64(2), status.Progress.BlobsChecked)
+	s.Equal(int64(1), status.Progress.UnderReplicated)
+	s.Equal(int64(1), status.Progress.CopiesDone)
+	s.Equal(int64(len("only on the first backend")), status.Progress.BytesCopied)
+	s.Equal(status.Progress.PrefixesTotal, status.Progress.PrefixesScanned)
+}
+
+// TestRepairQueuedBlob tests that a queued blob is replicated and removed from the queue
+func (s *RepairerTestSuite) TestRepairQueuedBlob() {
+	hash := s.backends[1].put("queued after a partial upload")
+	s.Require().NoError(s.queue.AddRepair(context.Background(), &models.RepairItem{
+		Hash: hash, Size: int64(len("queued after a partial upload")),
+		Replicas: []string{s.backends[1].server.URL}, Wanted: 2,
+	}))
+
+	s.Require().NoError(s.repairer.run(context.Background(), false))
+	s.Equal(2, s.replicas(hash))
+
+	items, err := s.queue.ListRepairs(context.Background(), 0)
+	s.NoError(err)
+	s.Empty(items)
+	s.Equal(1, s.repairer.Status().Progress.QueuedChecked)
+}
+
+// TestQueuedBlobWithoutReplica tests that a queued blob no online backend holds stays queued
+func (s *RepairerTestSuite) TestQueuedBlobWithoutReplica() {
+	hash := strings.Repeat("ab", 32)
+	s.Require().NoError(s.queue.AddRepair(context.Background(), &models.RepairItem{Hash: hash, Size: 10, Wanted: 2}))
+
+	s.Require().NoError(s.repairer.run(context.Background(), false))
+
+	items, err := s.queue.ListRepairs(context.Background(), 0)
+	s.NoError(err)
+	s.Require().Len(items, 1)
+	s.Equal(1, items[0].Attempts)
+	s.Equal(ErrNoReplicaOnline.Error(), items[0].LastError)
+}
+
+// TestEmptyQueuePass tests that a queue pass with nothing queued does not replace the last run
+func (s *RepairerTestSuite) TestEmptyQueuePass() {
+	s.Require().NoError(s.repairer.run(context.Background(), false))
+	s.Nil(s.repairer.Status().StartedAt)
+}
+
+// TestCopyRejectsHashMismatch tests that a copy stored under a different hash fails
+func (s *RepairerTestSuite) TestCopyRejectsHashMismatch() {
+	hash := s.backends[0].put("will be corrupted in transit")
+	s.backends[0].mu.Lock()
+	s.backends[0].corrupt = true
+	s.backends[0].mu.Unlock()
+
+	s.Require().NoError(s.repairer.run(context.Background(), true))
+	s.Equal(1, s.replicas(hash))
+
+	progress := s.repairer.Status().Progress
+	s.Zero(progress.CopiesDone)
+	s.Equal(int64(2), progress.CopiesFailed)
+}
+
+// TestRunHandler tests starting a run through the admin endpoint
+func (s *RepairerTestSuite) TestRunHandler() {
+	e := echo.New()
+	e.GET("/admin/repair", s.repairer.StatusHandler)
+	e.POST("/admin/repair/run", s.repairer.RunHandler)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/repair/run", nil))
+	s.Equal(http.StatusAccepted, rec.Code)
+
+	// The worker is not started, so the first run is still pending
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/repair/run", nil))
+	s.Equal(http.StatusConflict, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/repair", nil))
+	s.Equal(http.StatusOK, rec.Code)
+
+	var status models.RepairStatus
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &status))
+	s.Equal(2, status.ReplicationFactor)
+	s.NotNil(status.Queue)
+}
+
+// TestWorkerRunsTriggeredScan tests that the background worker picks up a triggered run
+func (s *RepairerTestSuite) TestWorkerRunsTriggeredScan() {
+	hash := s.backends[2].put("repaired in the background")
+	s.repairer.Start()
+	s.True(s.repairer.Trigger())
+
+	s.Eventually(func() bool {
+		return s.replicas(hash) == 2 && !s.repairer.Status().Running
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+// TestDeleteWhileBackendOffline tests that a scan deletes the replica a backend kept because
+// it was offline during the delete, and purges the tombstone afterwards
+func (s *RepairerTestSuite) TestDeleteWhileBackendOffline() {
+	hash := s.backends[0].put("deleted while a backend was offline")
+	s.backends[1].put("deleted while a backend was offline")
+	offline := s.backends[1].server.URL
+	s.Require().NoError(s.manager.RemoveBackend(offline))
+
+	e := echo.New()
+	e.DELETE("/file/:hash/delete", s.balancer.DeleteHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/file/"+hash+"/delete", nil))
+	s.Require().Equal(http.StatusOK, rec.Code)
+	s.Equal(1, s.replicas(hash))
+
+	s.Require().NoError(s.manager.AddBackend(offline))
+	s.Eventually(func() bool {
+		return len(s.manager.GetOnlineBackends()) == len(s.backends)
+	}, 5*time.Second, 20*time.Millisecond)
+
+	s.Require().NoError(s.repairer.run(context.Background(), true))
+	s.Zero(s.replicas(hash))
+	progress := s.repairer.Status().Progress
+	s.Equal(int64(1), progress.ReplicasDeleted)
+	s.Zero(progress.CopiesDone)
+
+	tombstones, err := s.queue.Tombstones(context.Background(), "")
+	s.Require().NoError(err)
+	s.Empty(tombstones)
+}
+
+// TestDeleteDuringCopy tests that a copy of a blob deleted while it was copied is deleted again
+func (s *RepairerTestSuite) TestDeleteDuringCopy() {
+	hash := s.backends[0].put("deleted while being copied")
+	s.backends[0].mu.Lock()
+	s.backends[0].onDownload = func() {
+		s.NoError(s.queue.AddTombstone(context.Background(), hash))
+	}
+	s.backends[0].mu.Unlock()
+
+	s.Require().NoError(s.repairer.run(context.Background(), true))
+	s.False(s.backends[1].has(hash))
+	s.False(s.backends[2].has(hash))
+	progress := s.repairer.Status().Progress
+	s.Zero(progress.CopiesDone)
+	s.Equal(int64(1), progress.ReplicasDeleted)
+}
+
+// TestQueuedDeletedBlob tests that a queued repair of a deleted blob deletes its remaining
+// replica instead of copying it
+func (s *RepairerTestSuite) TestQueuedDeletedBlob() {
+	hash := s.backends[2].put("queued, then deleted")
+	s.Require().NoError(s.queue.AddTombstone(context.Background(), hash))
+	s.Require().NoError(s.queue.AddRepair(context.Background(), &models.RepairItem{
+		Hash: hash, Size: int64(len("queued, then deleted")), Replicas: []string{s.backends[2].server.URL}, Wanted: 2,
+	}))
+
+	s.Require().NoError(s.repairer.run(context.Background(), false))
+	s.Zero(s.replicas(hash))
+	items, err := s.queue.ListRepairs(context.Background(), 0)
+	s.NoError(err)
+	s.Empty(items)
+}
+
+// TestUploadAfterDelete tests that a blob uploaded again after its delete is repaired
+func (s *RepairerTestSuite) TestUploadAfterDelete() {
+	content := "uploaded again after a delete"
+	sum := sha256.Sum256([]byte(content))
+	s.Require().NoError(s.queue.AddTombstone(context.Background(), hex.EncodeToString(sum[:])))
+	time.Sleep(time.Millisecond)
+	hash := s.backends[0].put(content)
+
+	s.Require().NoError(s.repairer.run(context.Background(), true))
+	s.Equal(2, s.replicas(hash))
+	s.Zero(s.repairer.Status().Progress.ReplicasDeleted)
+}
+
+// TestInactive tests that an inactive repairer neither runs nor accepts runs
+func (s *RepairerTestSuite) TestInactive() {
+	hash := s.backends[0].put("not repaired by a follower")
+	s.repairer.SetActive(func() bool { return false })
+
+	s.Require().NoError(s.repairer.run(context.Background(), true))
+	s.Equal(1, s.replicas(hash))
+	s.Nil(s.repairer.Status().StartedAt)
+
+	e := echo.New()
+	e.POST("/admin/repair/run", s.repairer.RunHandler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/repair/run", nil))
+	s.Equal(http.StatusConflict, rec.Code)
+	s.Contains(rec.Body.String(), ErrRepairInactive.Error())
+}
+
+// TestThrottledReader tests that reads are limited to the configured bandwidth
+func (s *RepairerTestSuite) TestThrottledReader() {
+	content := bytes.Repeat([]byte("x"), 3000)
+	reader := &throttledReader{
+		ctx:     context.Background(),
+		reader:  bytes.NewReader(content),
+		limiter: rate.NewLimiter(10000, 1000),
+	}
+
+	start := time.Now()
+	data, err := io.ReadAll(reader)
+	s.NoError(err)
+	s.Equal(content, data)
+	s.Equal(int64(len(content)), reader.read.Load())
+	s.GreaterOrEqual(time.Since(start), 150*time.Millisecond)
+}
+
+func TestRepairerSuite(t *testing.T) {
+	suite.Run(t, new(RepairerTestSuite))
+}
@@ -0,0 +1,236 @@
+package balancer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sync"
+	"time"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+)
+
+// replicaResult is the outcome of uploading a file to one backend.
+type replicaResult struct {
+	backend     string
+	status      int
+	contentType string
+	body        []byte
+	err         error
+}
+
+// stored reports whether the backend holds the file, either newly uploaded or already present.
+func (r replicaResult) stored() bool {
+	return r.err == nil &&
+		(r.status >= http.StatusOK && r.status < http.StatusMultipleChoices || r.status == http.StatusConflict)
+}
+
+// replicationOutcome summarizes the replica uploads of one file.
+type replicationOutcome struct {
+	results []replicaResult // In backend preference order
+	stored  []replicaResult
+	hash    string
+}
+
+// quorumReached reports whether enough replicas stored the file.
+func (o *replicationOutcome) quorumReached(quorum int) bool {
+	return len(o.stored) >= quorum
+}
+
+// failure returns the first failed replica, or nil if every replica stored the file.
+func (o *replicationOutcome) failure() *replicaResult {
+	for i := range o.results {
+		if !o.results[i].stored() {
+			return &o.results[i]
+		}
+	}
+	return nil
+}
+
+// replicaError describes why a replica did not store the file.
+func (r replicaResult) replicaError() string {
+	if r.err != nil {
+		return r.err.Error()
+	}
+	return fmt.Sprintf("backend returned status %d", r.status)
+}
+
+// uploadedHash extracts the hash from a backend upload response.
+func uploadedHash(body []byte) string {
+	var uploaded struct {
+		Hash string `json:"hash"`
+	}
+	if json.Unmarshal(body, &uploaded) != nil {
+		return ""
+	}
+	return uploaded.Hash
+}
+
+// spooledHash returns the SHA256 hash of an uploaded file, which placement needs before the
+// file is sent to any backend.
+func spooledHash(file *multipart.FileHeader) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer func() {
+		if closeErr := src.Close(); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("Failed to close uploaded file")
+		}
+	}()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, src); err != nil {
+		return "", fmt.Errorf("failed to hash uploaded file: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// uploadToBackend streams the file to a single backend and reads its response. The request
+// bypasses the retrying client, which would read the whole body into memory to replay it.
+func (b *Balancer) uploadToBackend(ctx context.Context, backend string, file *multipart.FileHeader) replicaResult {
+	result := replicaResult{backend: backend}
+
+	reqCtx, cancel := context.WithTimeout(ctx, b.RequestTimeout())
+	defer cancel()
+
+	// Prepare streaming multipart request
+	boundary := fmt.Sprintf("loopfs-%d", time.Now().UnixNano())
+	uploadBody, contentType, err := createStreamingBody(reqCtx, file, boundary)
+	if err != nil {
+		result.err = fmt.Errorf("failed to prepare upload body: %w", err)
+		return result
+	}
+	defer func() {
+		if closeErr := uploadBody.Close(); closeErr != nil && !errors.Is(closeErr, io.ErrClosedPipe) {
+			log.Ctx(ctx).Warn().Err(closeErr).Msg("Failed to close upload body")
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, backend+"/file/upload", uploadBody)
+	if err != nil {
+		result.err = fmt.Errorf("failed to create request: %w", err)
+		return result
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := b.client.HTTPClient.Do(req)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Ctx(ctx).Warn().Err(closeErr).Msg("Failed to close upload response body")
+		}
+	}()
+
+	result.status = resp.StatusCode
+	result.contentType = resp.Header.Get("Content-Type")
+	result.body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		result.err = fmt.Errorf("failed to read response: %w", err)
+	}
+	return result
+}
+
+// replicatedUpload uploads the file to up to replicationFactor backends in parallel, each
+// streaming its own copy of the body. It fails without uploading when fewer backends than
+// the write quorum can take the file. Under-replicated uploads are queued for repair. A nil
+// policy uses the balancer's upload policy.
+func (b *Balancer) replicatedUpload(
+	ctx context.Context, file *multipart.FileHeader, policy PlacementPolicy,
+) (*replicationOutcome, error) {
+	var hash string
+	if b.placement == PlacementRendezvous {
+		var err error
+		if hash, err = spooledHash(file); err != nil {
+			return nil, err
+		}
+	}
+
+	backends, err := b.uploadBackends(hash, file.Size, b.replicationFactor, policy)
+	if err != nil {
+		return nil, err
+	}
+	if len(backends) < b.writeQuorum {
+		writeQuorumFailuresTotal.Inc()
+		return nil, fmt.Errorf("%w: %d of %d required backends available",
+			ErrWriteQuorumNotReached, len(backends), b.writeQuorum)
+	}
+	fanoutBackends.Observe(float64(len(backends)))
+
+	outcome := &replicationOutcome{results: make([]replicaResult, len(backends))}
+	var waitGroup sync.WaitGroup
+	for i, backend := range backends {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			outcome.results[i] = b.uploadToBackend(ctx, backend, file)
+		}()
+	}
+	waitGroup.Wait()
+
+	for _, result := range outcome.results {
+		if result.stored() {
+			outcome.stored = append(outcome.stored, result)
+			if outcome.hash == "" {
+				outcome.hash = uploadedHash(result.body)
+			}
+		}
+	}
+
+	for _, result := range outcome.stored {
+		b.rememberLocation(outcome.hash, result.backend)
+	}
+
+	if !outcome.quorumReached(b.writeQuorum) {
+		writeQuorumFailuresTotal.Inc()
+	}
+	if len(outcome.stored) > 0 && len(outcome.stored) < b.replicationFactor {
+		b.queueRepair(ctx, outcome, file.Size)
+	}
+	return outcome, nil
+}
+
+// queueRepair records an upload stored on fewer backends than the replication factor. The
+// repair is queued even if the request was cancelled meanwhile.
+func (b *Balancer) queueRepair(ctx context.Context, outcome *replicationOutcome, size int64) {
+	underReplicatedUploadsTotal.Inc()
+
+	replicas := make([]string, 0, len(outcome.stored))
+	for _, result := range outcome.stored {
+		replicas = append(replicas, result.backend)
+	}
+	item := &models.RepairItem{
+		Hash:     outcome.hash,
+		Size:     size,
+		Replicas: replicas,
+		Wanted:   b.replicationFactor,
+	}
+	if failed := outcome.failure(); failed != nil {
+		item.LastError = failed.replicaError()
+	}
+
+	logger := log.Ctx(ctx).Warn().
+		Str("hash", item.Hash).
+		Strs("replicas", replicas).
+		Int("wanted", item.Wanted).
+		Str("last_error", item.LastError)
+	if item.Hash == "" || b.repairQueue == nil {
+		logger.Msg("Upload is under-replicated and cannot be queued for repair")
+		return
+	}
+	if err := b.repairQueue.AddRepair(context.WithoutCancel(ctx), item); err != nil {
+		logger.AnErr("queue_error", err).Msg("Failed to queue under-replicated upload for repair")
+		return
+	}
+	logger.Msg("Upload is under-replicated, queued for repair")
+}
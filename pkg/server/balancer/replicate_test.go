@@ -0,0 +1,283 @@
+package balancer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+)
+
+const testReplicaHash = "abcdef1234567890abcdef1234567890abcdef1234567890abcdef1234567890"
+
+// ReplicationTestSuite tests replicated uploads and write quorums
+type ReplicationTestSuite struct {
+	suite.Suite
+	servers []*httptest.Server
+	manager *BackendManager
+}
+
+// replicaBackend is a mock backend counting the uploads and bytes it received
+type replicaBackend struct {
+	server   *httptest.Server
+	uploads  atomic.Int32
+	received atomic.Int64
+}
+
+// newReplicaBackend starts a mock backend that stores uploads or fails them with a 500
+func (s *ReplicationTestSuite) newReplicaBackend(available uint64, fail bool) *replicaBackend {
+	backend := &replicaBackend{}
+	backend.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/node/info"):
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(models.NodeInfo{Storage: models.StorageInfo{Available: available}})
+		case strings.HasSuffix(r.URL.Path, "/file/upload"):
+			backend.uploads.Add(1)
+			// The file part is streamed rather than parsed into memory like FormFile would
+			reader, err := r.MultipartReader()
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			part, err := reader.NextPart()
+			if err != nil || part.FormName() != "file" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received, err := io.Copy(io.Discard, part)
+			backend.received.Add(received)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if fail {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"error": "disk failure"})
+				return
+			}
+			json.NewEncoder(w).Encode(models.UploadResponse{Hash: testReplicaHash})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	s.servers = append(s.servers, backend.server)
+	return backend
+}
+
+// newBalancer starts health checks for the backends and returns a balancer replicating uploads
+func (s *ReplicationTestSuite) newBalancer(factor, quorum int, backends ...*replicaBackend) (*Balancer, *MemoryRepairQueue) {
+	urls := make([]string, 0, len(backends))
+	for _, backend := range backends {
+		urls = append(urls, backend.server.URL)
+	}
+	s.manager = NewBackendManager(urls, 100*time.Millisecond, 5*time.Second)
+	s.manager.Start()
+	time.Sleep(200 * time.Millisecond)
+
+	queue := NewMemoryRepairQueue()
+	balancer := NewBalancer(s.manager, 0, 10*time.Millisecond, 50*time.Millisecond, 5*time.Second)
+	balancer.SetReplication(factor, quorum)
+	balancer.SetRepairQueue(queue)
+	return balancer, queue
+}
+
+// upload sends a file through the balancer upload handler
+func (s *ReplicationTestSuite) upload(balancer *Balancer) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "replicated.txt")
+	s.Require().NoError(err)
+	_, err = part.Write([]byte("replicated content"))
+	s.Require().NoError(err)
+	s.Require().NoError(writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/file/upload", &body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	s.Require().NoError(balancer.UploadHandler(echo.New().NewContext(req, rec)))
+	return rec
+}
+
+// spooledFile returns an uploaded file of size bytes spooled to disk, as the upload handler
+// receives it
+func (s *ReplicationTestSuite) spooledFile(size int) *multipart.FileHeader {
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	go func() {
+		part, err := writer.CreateFormFile("file", "large.bin")
+		if err != nil {
+			pipeWriter.CloseWithError(err)
+			return
+		}
+		chunk := bytes.Repeat([]byte("loopfs"), 10000)
+		for written := 0; written < size; written += len(chunk) {
+			if _, err := part.Write(chunk[:min(len(chunk), size-written)]); err != nil {
+				pipeWriter.CloseWithError(err)
+				return
+			}
+		}
+		pipeWriter.CloseWithError(writer.Close())
+	}()
+
+	form, err := multipart.NewReader(pipeReader, writer.Boundary()).ReadForm(1 << 20)
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = form.RemoveAll() })
+	s.Require().Len(form.File["file"], 1)
+	return form.File["file"][0]
+}
+
+// TearDownTest stops the backend manager and mock backends
+func (s *ReplicationTestSuite) TearDownTest() {
+	if s.manager != nil {
+		s.manager.Stop()
+		s.manager = nil
+	}
+	for _, server := range s.servers {
+		server.Close()
+	}
+	s.servers = nil
+}
+
+// TestSetReplicationDefaultsToMajority tests that a zero quorum means a majority
+func (s *ReplicationTestSuite) TestSetReplicationDefaultsToMajority() {
+	balancer := NewBalancer(nil, 0, time.Millisecond, time.Millisecond, time.Second)
+	s.Equal(1, balancer.replicationFactor)
+	s.Equal(1, balancer.writeQuorum)
+
+	balancer.SetReplication(3, 0)
+	s.Equal(2, balancer.writeQuorum)
+
+	balancer.SetReplication(4, 0)
+	s.Equal(3, balancer.writeQuorum)
+
+	balancer.SetReplication(2, 5)
+	s.Equal(2, balancer.writeQuorum)
+}
+
+// TestUploadWritesAllReplicas tests that every replica receives the upload
+func (s *ReplicationTestSuite) TestUploadWritesAllReplicas() {
+	backends := []*replicaBackend{
+		s.newReplicaBackend(3000000, false),
+		s.newReplicaBackend(2000000, false),
+		s.newReplicaBackend(1000000, false),
+	}
+	balancer, queue := s.newBalancer(3, 2, backends...)
+
+	rec := s.upload(balancer)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), testReplicaHash)
+	for _, backend := range backends {
+		s.Equal(int32(1), backend.uploads.Load())
+	}
+
+	items, err := queue.ListRepairs(context.Background(), 0)
+	s.NoError(err)
+	s.Empty(items)
+}
+
+// TestUploadQueuesRepairForFailedReplica tests that an upload meeting the quorum is queued for repair
+func (s *ReplicationTestSuite) TestUploadQueuesRepairForFailedReplica() {
+	first := s.newReplicaBackend(3000000, false)
+	failing := s.newReplicaBackend(2000000, true)
+	third := s.newReplicaBackend(1000000, false)
+	balancer, queue := s.newBalancer(3, 2, first, failing, third)
+
+	rec := s.upload(balancer)
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), testReplicaHash)
+
+	items, err := queue.ListRepairs(context.Background(), 0)
+	s.NoError(err)
+	s.Require().Len(items, 1)
+	s.Equal(testReplicaHash, items[0].Hash)
+	s.Equal([]string{first.server.URL, third.server.URL}, items[0].Replicas)
+	s.Equal(3, items[0].Wanted)
+	s.Equal(int64(len("replicated content")), items[0].Size)
+	s.Contains(items[0].LastError, "500")
+}
+
+// TestUploadStreamsReplicas tests that the replicas of a large upload are streamed from the
+// spooled file instead of each being read into memory
+func (s *ReplicationTestSuite) TestUploadStreamsReplicas() {
+	const size = 32 << 20
+	backends := []*replicaBackend{
+		s.newReplicaBackend(1<<30, false),
+		s.newReplicaBackend(1<<30, false),
+		s.newReplicaBackend(1<<30, false),
+	}
+	balancer, _ := s.newBalancer(3, 3, backends...)
+	file := s.spooledFile(size)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	outcome, err := balancer.replicatedUpload(context.Background(), file, nil)
+	runtime.ReadMemStats(&after)
+
+	s.Require().NoError(err)
+	s.Len(outcome.stored, 3)
+	for _, backend := range backends {
+		s.Equal(int64(size), backend.received.Load())
+	}
+	s.Less(after.TotalAlloc-before.TotalAlloc, uint64(size/4), "replica uploads were buffered in memory")
+}
+
+// TestUploadFailsWithoutQuorum tests that an upload stored on fewer backends than the quorum fails
+func (s *ReplicationTestSuite) TestUploadFailsWithoutQuorum() {
+	stored := s.newReplicaBackend(3000000, false)
+	balancer, queue := s.newBalancer(3, 2, stored,
+		s.newReplicaBackend(2000000, true), s.newReplicaBackend(1000000, true))
+
+	rec := s.upload(balancer)
+	s.Equal(http.StatusServiceUnavailable, rec.Code)
+	s.Contains(rec.Body.String(), ErrWriteQuorumNotReached.Error())
+
+	// The stored copy is still recorded so it can be repaired
+	items, err := queue.ListRepairs(context.Background(), 0)
+	s.NoError(err)
+	s.Require().Len(items, 1)
+	s.Equal([]string{stored.server.URL}, items[0].Replicas)
+}
+
+// TestUploadFailsWithTooFewBackends tests that no replica is written when the quorum cannot be reached
+func (s *ReplicationTestSuite) TestUploadFailsWithTooFewBackends() {
+	backends := []*replicaBackend{s.newReplicaBackend(2000000, false), s.newReplicaBackend(1000000, false)}
+	balancer, _ := s.newBalancer(3, 3, backends...)
+
+	rec := s.upload(balancer)
+	s.Equal(http.StatusServiceUnavailable, rec.Code)
+	s.Contains(rec.Body.String(), ErrWriteQuorumNotReached.Error())
+	for _, backend := range backends {
+		s.Zero(backend.uploads.Load())
+	}
+}
+
+// TestUploadForwardsBackendError tests that a failed single replica forwards the backend response
+func (s *ReplicationTestSuite) TestUploadForwardsBackendError() {
+	balancer, queue := s.newBalancer(1, 1, s.newReplicaBackend(1000000, true))
+
+	rec := s.upload(balancer)
+	s.Equal(http.StatusInternalServerError, rec.Code)
+	s.Contains(rec.Body.String(), "disk failure")
+
+	items, err := queue.ListRepairs(context.Background(), 0)
+	s.NoError(err)
+	s.Empty(items)
+}
+
+func TestReplicationSuite(t *testing.T) {
+	suite.Run(t, new(ReplicationTestSuite))
+}
@@ -7,17 +7,40 @@ import (
 	_ "net/http/pprof" //nolint:gosec
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"loopfs/pkg/audit"
 	"loopfs/pkg/bucket"
 	"loopfs/pkg/log"
+	"loopfs/pkg/metrics"
+	"loopfs/pkg/tracing"
+	"loopfs/pkg/webhook"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// ServerConfig holds the settings a balancer server is created with. The backends and the
+// request timeout can be changed later with SetBackends and SetRequestTimeout.
+type ServerConfig struct {
+	Backends                []string
+	RetryMax                int
+	RetryWaitMin            time.Duration
+	RetryWaitMax            time.Duration
+	RequestTimeout          time.Duration
+	GracefulShutdownTimeout time.Duration
+	HealthCheckInterval     time.Duration
+	HealthCheckTimeout      time.Duration
+	Debug                   bool
+	DebugAddr               string
+	DBPath                  string // SQLite database for bucket metadata, empty disables the bucket API
+	DBDSN                   string // PostgreSQL database for bucket metadata, used instead of DBPath
+}
+
 type Server struct {
+	mu                      sync.Mutex // Guards backendURLs, requestTimeout, admissionConfig, backendManager, admission and balancer
 	backendURLs             []string
 	retryMax                int
 	gracefulShutdownTimeout time.Duration
@@ -26,14 +49,42 @@ type Server struct {
 	requestTimeout          time.Duration
 	healthCheckInterval     time.Duration
 	healthCheckTimeout      time.Duration
+	nodeInfoInterval        time.Duration
+	breakerConfig           BreakerConfig
+	admissionConfig         AdmissionConfig
+	admission               *Admission
 	echo                    *echo.Echo
 	backendManager          *BackendManager
-	bucketStore             *bucket.Store
+	balancer                *Balancer
+	backendSource           BackendSource
+	backendWatchInterval    time.Duration
+	backendWatcher          *BackendWatcher
+	bucketStore             bucket.MetadataStore
+	locationStore           LocationStore
+	metadataReplication     MetadataReplicationConfig
+	metadataReplicator      *MetadataReplicator
+	auditLog                *audit.Log
+	webhookConfig           webhook.Config
+	dispatcher              *webhook.Dispatcher
+	repairQueue             RepairQueue
+	repairConfig            RepairConfig
+	repairer                *Repairer
+	replicationFactor       int
+	writeQuorum             int
+	placement               string
+	uploadPolicy            string
+	locationCacheSize       int
+	persistLocations        bool
+	hedgePercentile         float64
+	adminToken              string
 	debug                   bool
 	debugAddr               string
 	dbPath                  string
+	dbDSN                   string
 }
 
+// NewBalancerServer creates a balancer server from positional settings. NewServer names
+// each setting and is preferred.
 func NewBalancerServer(
 	backendURLs []string,
 	retryMax int,
@@ -41,39 +92,130 @@ func NewBalancerServer(
 	healthCheckInterval, healthCheckTimeout time.Duration,
 	debug bool, debugAddr, dbPath string,
 ) *Server {
+	return NewServer(ServerConfig{
+		Backends:                backendURLs,
+		RetryMax:                retryMax,
+		RetryWaitMin:            retryWaitMin,
+		RetryWaitMax:            retryWaitMax,
+		RequestTimeout:          requestTimeout,
+		GracefulShutdownTimeout: gracefulShutdownTimeout,
+		HealthCheckInterval:     healthCheckInterval,
+		HealthCheckTimeout:      healthCheckTimeout,
+		Debug:                   debug,
+		DebugAddr:               debugAddr,
+		DBPath:                  dbPath,
+	})
+}
+
+// NewServer creates a balancer server from config.
+func NewServer(config ServerConfig) *Server {
 	return &Server{
-		backendURLs:             backendURLs,
-		retryMax:                retryMax,
-		gracefulShutdownTimeout: gracefulShutdownTimeout,
-		retryWaitMin:            retryWaitMin,
-		retryWaitMax:            retryWaitMax,
-		requestTimeout:          requestTimeout,
-		healthCheckInterval:     healthCheckInterval,
-		healthCheckTimeout:      healthCheckTimeout,
+		backendURLs:             config.Backends,
+		retryMax:                config.RetryMax,
+		gracefulShutdownTimeout: config.GracefulShutdownTimeout,
+		retryWaitMin:            config.RetryWaitMin,
+		retryWaitMax:            config.RetryWaitMax,
+		requestTimeout:          config.RequestTimeout,
+		healthCheckInterval:     config.HealthCheckInterval,
+		healthCheckTimeout:      config.HealthCheckTimeout,
+		nodeInfoInterval:        DefaultNodeInfoInterval,
+		breakerConfig:           DefaultBreakerConfig(),
 		echo:                    echo.New(),
-		debug:                   debug,
-		debugAddr:               debugAddr,
-		dbPath:                  dbPath,
+		webhookConfig:           webhook.DefaultConfig(),
+		replicationFactor:       1,
+		writeQuorum:             1,
+		placement:               PlacementBroadcast,
+		uploadPolicy:            PolicyMostFree,
+		locationCacheSize:       DefaultLocationCacheSize,
+		hedgePercentile:         DefaultHedgePercentile,
+		repairConfig:            DefaultRepairConfig(),
+		debug:                   config.Debug,
+		debugAddr:               config.DebugAddr,
+		dbPath:                  config.DBPath,
+		dbDSN:                   config.DBDSN,
 	}
 }
 
 func (b *Server) Start(addr string) error {
 	// Create backend manager and start health checks
+	b.mu.Lock()
 	b.backendManager = NewBackendManager(b.backendURLs, b.healthCheckInterval, b.healthCheckTimeout)
+	b.backendManager.SetBreakerConfig(b.breakerConfig)
+	b.backendManager.SetNodeInfoInterval(b.nodeInfoInterval)
+	b.mu.Unlock()
+	if b.backendSource != nil {
+		// The first sync runs before the initial health check so watched backends start online
+		b.backendWatcher = NewBackendWatcher(b.backendManager, b.backendSource, b.backendWatchInterval)
+		b.backendWatcher.Start()
+	}
 	b.backendManager.Start()
 
-	// Initialize bucket store if database path is provided
-	if b.dbPath != "" {
-		var err error
-		b.bucketStore, err = bucket.NewStore(b.dbPath)
+	// Under-replicated uploads survive restarts only with the bucket store
+	b.repairQueue = NewMemoryRepairQueue()
+
+	// Initialize bucket store if a database is provided
+	if b.dbPath != "" || b.dbDSN != "" {
+		store, err := b.openBucketStore()
 		if err != nil {
 			return err
 		}
-		log.Info().Str("db_path", b.dbPath).Msg("Bucket store initialized")
+		b.bucketStore = store
+		b.locationStore = store
+		b.repairQueue = store
+
+		// Replicate bucket metadata between balancers
+		if b.metadataReplication.Enabled() {
+			config := b.metadataReplication
+			if config.Token == "" {
+				config.Token = b.adminToken
+			}
+			b.metadataReplicator, err = NewMetadataReplicator(store, config)
+			if err != nil {
+				return err
+			}
+			store.SetReplicationHook(b.metadataReplicator)
+			if err := b.metadataReplicator.Start(); err != nil {
+				return err
+			}
+		}
+
+		// Deliver change events to webhooks and prune the event outbox; with replication
+		// only the leader delivers
+		b.dispatcher = webhook.NewDispatcher(store, b.webhookConfig)
+		if b.metadataReplicator != nil {
+			b.dispatcher.SetActive(b.metadataReplicator.IsLeader)
+		}
+		b.dispatcher.Start()
 	}
 
 	// Create casBalancer
+	b.mu.Lock()
 	casBalancer := NewBalancer(b.backendManager, b.retryMax, b.retryWaitMin, b.retryWaitMax, b.requestTimeout)
+	b.balancer = casBalancer
+	b.admission = NewAdmission(b.admissionConfig, b.backendManager.GetOnlineBackends)
+	casBalancer.SetAdmission(b.admission)
+	b.mu.Unlock()
+	casBalancer.SetReplication(b.replicationFactor, b.writeQuorum)
+	casBalancer.SetRepairQueue(b.repairQueue)
+	if err := casBalancer.SetPlacement(b.placement); err != nil {
+		return err
+	}
+	if err := casBalancer.SetUploadPolicy(b.uploadPolicy); err != nil {
+		return err
+	}
+	casBalancer.SetHedging(b.hedgePercentile)
+	if b.locationCacheSize > 0 {
+		casBalancer.SetLocationCache(b.newLocationCache())
+	}
+
+	// Restore the replication factor of queued and under-replicated blobs; with replication
+	// only the leader repairs, as it holds the tombstones of every delete
+	b.repairer = NewRepairer(casBalancer, b.repairQueue, b.repairConfig)
+	if b.metadataReplicator != nil {
+		b.repairer.SetActive(b.metadataReplicator.IsLeader)
+	}
+	b.repairer.Start()
+
 	b.setupRoutes(casBalancer)
 
 	// Start pprof server if in debug mode
@@ -102,23 +244,211 @@ func (b *Server) Start(addr string) error {
 func (b *Server) Shutdown() error {
 	log.Info().Msg("Shutting down server...")
 
+	// Drain in-flight HTTP requests first, since they use everything stopped and closed below
+	ctx, cancel := context.WithTimeout(context.Background(), b.gracefulShutdownTimeout)
+	defer cancel()
+	err := b.echo.Shutdown(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to drain HTTP requests")
+	}
+
+	// Stop watching the backend source before stopping the manager it updates
+	if b.backendWatcher != nil {
+		b.backendWatcher.Stop()
+	}
+
 	// Stop backend manager
 	if b.backendManager != nil {
 		b.backendManager.Stop()
 	}
 
+	// Stop repairs before closing the store holding the repair queue
+	if b.repairer != nil {
+		b.repairer.Stop()
+	}
+
+	// Stop replicating before closing the store it replicates
+	if b.metadataReplicator != nil {
+		b.metadataReplicator.Stop()
+	}
+
+	// Stop webhook deliveries before closing the store they read from
+	if b.dispatcher != nil {
+		b.dispatcher.Stop()
+	}
+
 	// Close bucket store
 	if b.bucketStore != nil {
-		if err := b.bucketStore.Close(); err != nil {
-			log.Warn().Err(err).Msg("Failed to close bucket store")
+		if closeErr := b.bucketStore.Close(); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("Failed to close bucket store")
 		}
 	}
 
-	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), b.gracefulShutdownTimeout)
-	defer cancel()
+	// Close audit log last, once no request can record an entry
+	if b.auditLog != nil {
+		if closeErr := b.auditLog.Close(); closeErr != nil {
+			log.Warn().Err(closeErr).Msg("Failed to close audit log")
+		}
+	}
+
+	return err
+}
+
+// SetWebhookConfig configures delivery of bucket and object change events.
+// Webhooks require the bucket store (-db).
+func (b *Server) SetWebhookConfig(config webhook.Config) {
+	b.webhookConfig = config
+}
+
+// SetReplication configures how many backends each upload is written to and how many of
+// them must store it. A quorum of zero means a majority of the replication factor.
+func (b *Server) SetReplication(factor, quorum int) {
+	b.replicationFactor = factor
+	b.writeQuorum = quorum
+}
+
+// SetPlacement selects how uploads are placed and reads are routed: PlacementBroadcast or
+// PlacementRendezvous.
+func (b *Server) SetPlacement(mode string) error {
+	if err := validatePlacement(mode); err != nil {
+		return err
+	}
+	b.placement = mode
+	return nil
+}
+
+// SetUploadPolicy selects the registered placement policy choosing the backends of uploads
+// with broadcast placement. Buckets can select their own.
+func (b *Server) SetUploadPolicy(name string) error {
+	if _, err := LookupPlacementPolicy(name); err != nil {
+		return err
+	}
+	b.uploadPolicy = name
+	return nil
+}
+
+// SetHedging configures the download latency percentile after which a hedge request is sent
+// to the next backend. Zero asks all backends at once.
+func (b *Server) SetHedging(percentile float64) {
+	b.hedgePercentile = percentile
+}
 
-	return b.echo.Shutdown(ctx)
+// SetBreakerConfig configures the circuit breakers guarding the backends.
+func (b *Server) SetBreakerConfig(config BreakerConfig) {
+	b.breakerConfig = config
+}
+
+// SetNodeInfoInterval sets how often the node info of each backend is refreshed; health
+// checks in between only probe /healthz.
+func (b *Server) SetNodeInfoInterval(interval time.Duration) {
+	b.nodeInfoInterval = interval
+}
+
+// SetLocationCache configures the cache of hash locations. A size of zero disables it; with
+// persist, locations are kept in the bucket store (-db) across restarts.
+func (b *Server) SetLocationCache(size int, persist bool) {
+	b.locationCacheSize = size
+	b.persistLocations = persist
+}
+
+// openBucketStore opens the PostgreSQL bucket store if a DSN is configured, the SQLite one otherwise.
+func (b *Server) openBucketStore() (*bucket.Store, error) {
+	if b.dbDSN != "" {
+		store, err := bucket.NewPostgresStore(b.dbDSN)
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Str("db", "postgresql").Msg("Bucket store initialized")
+		return store, nil
+	}
+
+	store, err := bucket.NewStore(b.dbPath)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("db_path", b.dbPath).Msg("Bucket store initialized")
+	return store, nil
+}
+
+// newLocationCache creates the location cache, loading persisted locations if enabled.
+func (b *Server) newLocationCache() *LocationCache {
+	if !b.persistLocations || b.locationStore == nil {
+		return NewLocationCache(b.locationCacheSize, nil)
+	}
+
+	cache := NewLocationCache(b.locationCacheSize, b.locationStore)
+	if err := cache.Load(); err != nil {
+		log.Warn().Err(err).Msg("Failed to load persisted hash locations")
+	}
+	log.Info().Int("locations", cache.Len()).Msg("Location cache loaded")
+	return cache
+}
+
+// SetBackendSource makes the backend list follow source, read again every interval. The
+// backends given to NewBalancerServer are replaced on the first sync.
+func (b *Server) SetBackendSource(source BackendSource, interval time.Duration) {
+	b.backendSource = source
+	b.backendWatchInterval = interval
+}
+
+// SetBackends replaces the backend list, also while serving. Backends in both lists keep
+// their health state, and backends added or removed through the admin API keep that
+// membership. The list is ignored once a backend source is set, as the source owns it.
+func (b *Server) SetBackends(backendURLs []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.backendURLs = backendURLs
+	if b.backendManager != nil && b.backendSource == nil {
+		b.backendManager.ReloadBackends(backendURLs)
+	}
+}
+
+// SetRequestTimeout changes the timeout of each backend request, also while serving.
+// Requests already sent keep their timeout.
+func (b *Server) SetRequestTimeout(timeout time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.requestTimeout = timeout
+	if b.balancer != nil {
+		b.balancer.SetRequestTimeout(timeout)
+	}
+}
+
+// SetAdmissionConfig configures the rate limits of owners and buckets and the concurrency
+// of each backend, also while serving. Overrides set through the admin API are kept.
+func (b *Server) SetAdmissionConfig(config AdmissionConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.admissionConfig = config
+	if b.admission != nil {
+		return b.admission.SetConfig(config)
+	}
+	return nil
+}
+
+// SetMetadataReplication replicates the bucket metadata between balancers, which elect a
+// leader to make all changes. Replication requires the bucket store (-db or -db-dsn).
+func (b *Server) SetMetadataReplication(config MetadataReplicationConfig) error {
+	config, err := config.normalize()
+	if err != nil {
+		return err
+	}
+	if config.Enabled() && b.dbPath == "" && b.dbDSN == "" {
+		return ErrReplicationWithoutStore
+	}
+	b.metadataReplication = config
+	return nil
+}
+
+// SetRepairConfig configures the background repair of under-replicated blobs.
+func (b *Server) SetRepairConfig(config RepairConfig) {
+	b.repairConfig = config
 }
 
 // BackendManager returns the backend manager for this server.
@@ -132,15 +462,57 @@ func (b *Server) setupRoutes(casBalancer *Balancer) {
 	b.echo.HidePort = true
 
 	// Add middleware
-	b.echo.Use(middleware.Logger())
+	b.echo.Use(log.Middleware())
 	b.echo.Use(middleware.Recover())
 	b.echo.Use(middleware.CORS())
+	b.echo.Use(tracing.Middleware())
+	b.echo.Use(metrics.EchoMiddleware(httpRequestsTotal, httpRequestDuration))
+
+	b.echo.GET("/metrics", getMetrics)
 
 	// Register CAS routes (unchanged for backward compatibility)
-	b.echo.POST("/file/upload", casBalancer.UploadHandler)
-	b.echo.GET("/file/:hash/download", casBalancer.DownloadHandler)
-	b.echo.GET("/file/:hash/info", casBalancer.FileInfoHandler)
-	b.echo.DELETE("/file/:hash/delete", casBalancer.DeleteHandler)
+	admit := b.admission.Middleware()
+	b.echo.POST("/file/upload", casBalancer.UploadHandler, admit, auditOperation(b.auditLog, audit.ActionUpload))
+	b.echo.GET("/file/:hash/download", casBalancer.DownloadHandler, admit)
+	b.echo.GET("/file/:hash/info", casBalancer.FileInfoHandler, admit)
+	// Deletes record a tombstone, a metadata change made by the leader with replication
+	b.echo.DELETE("/file/:hash/delete", casBalancer.DeleteHandler, b.metadataReplicator.Forward(), admit,
+		auditOperation(b.auditLog, audit.ActionDelete))
+
+	// Audit log query endpoint (only if an audit log is configured)
+	if b.auditLog != nil {
+		b.echo.GET("/admin/audit", b.getAudit, b.adminAuth)
+	}
+
+	// Repair worker status and manual runs
+	if b.repairer != nil {
+		b.echo.GET("/admin/repair", b.repairer.StatusHandler, b.adminAuth)
+		b.echo.POST("/admin/repair/run", b.repairer.RunHandler, b.adminAuth)
+	}
+
+	// Runtime backend membership
+	b.echo.GET("/admin/backends", b.backendManager.ListBackendsHandler, b.adminAuth)
+	b.echo.POST("/admin/backends", b.backendManager.AddBackendHandler, b.adminAuth)
+	b.echo.PATCH("/admin/backends", b.backendManager.UpdateBackendHandler, b.adminAuth)
+	b.echo.DELETE("/admin/backends", b.backendManager.RemoveBackendHandler, b.adminAuth)
+
+	// Rate limits and backend concurrency
+	if b.admission != nil {
+		b.echo.GET("/admin/limits", b.admission.LimitsHandler, b.adminAuth)
+		b.echo.PUT("/admin/limits", b.admission.SetLimitsHandler, b.adminAuth)
+		b.echo.PUT("/admin/limits/owners/:owner", b.admission.SetOwnerLimitHandler, b.adminAuth)
+		b.echo.DELETE("/admin/limits/owners/:owner", b.admission.RemoveOwnerLimitHandler, b.adminAuth)
+		b.echo.PUT("/admin/limits/buckets/:name", b.admission.SetBucketLimitHandler, b.adminAuth)
+		b.echo.DELETE("/admin/limits/buckets/:name", b.admission.RemoveBucketLimitHandler, b.adminAuth)
+	}
+
+	// Metadata replication between balancers
+	if b.metadataReplicator != nil {
+		b.echo.POST("/replication/vote", b.metadataReplicator.VoteHandler, b.metadataReplicator.PeerAuth)
+		b.echo.POST("/replication/append", b.metadataReplicator.AppendHandler, b.metadataReplicator.PeerAuth)
+		b.echo.POST("/replication/snapshot", b.metadataReplicator.InstallSnapshotHandler, b.metadataReplicator.PeerAuth)
+		b.echo.GET("/admin/replication", b.metadataReplicator.StatusHandler, b.adminAuth)
+	}
 
 	// Backend status endpoint
 	b.echo.GET("/backends/status", func(ctx echo.Context) error {
@@ -155,20 +527,30 @@ func (b *Server) setupRoutes(casBalancer *Balancer) {
 	if b.bucketStore != nil {
 		bucketHandlers := NewBucketHandlers(b.bucketStore)
 		objectHandlers := NewObjectHandlers(b.bucketStore, casBalancer, b.requestTimeout)
+		changeFeed := NewChangeFeed(b.bucketStore)
+		// Changes go through forward before admit, so a request a follower forwards is only
+		// charged against the limits of the leader that executes it
+		forward := b.metadataReplicator.Forward()
 
 		// Bucket management
-		b.echo.POST("/bucket/:name", bucketHandlers.CreateBucketHandler)
-		b.echo.GET("/bucket/:name", bucketHandlers.GetBucketHandler)
-		b.echo.DELETE("/bucket/:name", bucketHandlers.DeleteBucketHandler)
-		b.echo.GET("/buckets", bucketHandlers.ListBucketsHandler)
+		b.echo.POST("/bucket/:name", bucketHandlers.CreateBucketHandler, bucketOperation("create_bucket"), forward, admit,
+			auditOperation(b.auditLog, audit.ActionBucketCreate))
+		b.echo.GET("/bucket/:name", bucketHandlers.GetBucketHandler, bucketOperation("get_bucket"), admit)
+		b.echo.DELETE("/bucket/:name", bucketHandlers.DeleteBucketHandler, bucketOperation("delete_bucket"), forward, admit,
+			auditOperation(b.auditLog, audit.ActionBucketDelete))
+		b.echo.GET("/buckets", bucketHandlers.ListBucketsHandler, bucketOperation("list_buckets"), admit)
+		b.echo.GET("/bucket/:name/changes", changeFeed.ChangesHandler, bucketOperation("changes"), admit)
 
 		// Object operations
-		b.echo.POST("/bucket/:name/upload", objectHandlers.BucketUploadHandler)
-		b.echo.PUT("/bucket/:name/object/*", objectHandlers.PutObjectHandler)
-		b.echo.GET("/bucket/:name/object/*", objectHandlers.GetObjectHandler)
-		b.echo.HEAD("/bucket/:name/object/*", objectHandlers.HeadObjectHandler)
-		b.echo.DELETE("/bucket/:name/object/*", objectHandlers.DeleteObjectHandler)
-		b.echo.GET("/bucket/:name/objects", objectHandlers.ListObjectsHandler)
+		b.echo.POST("/bucket/:name/upload", objectHandlers.BucketUploadHandler, bucketOperation("upload_object"), forward, admit,
+			auditOperation(b.auditLog, audit.ActionObjectPut))
+		b.echo.PUT("/bucket/:name/object/*", objectHandlers.PutObjectHandler, bucketOperation("put_object"), forward, admit,
+			auditOperation(b.auditLog, audit.ActionObjectPut))
+		b.echo.GET("/bucket/:name/object/*", objectHandlers.GetObjectHandler, bucketOperation("get_object"), admit)
+		b.echo.HEAD("/bucket/:name/object/*", objectHandlers.HeadObjectHandler, bucketOperation("head_object"), admit)
+		b.echo.DELETE("/bucket/:name/object/*", objectHandlers.DeleteObjectHandler, bucketOperation("delete_object"), forward, admit,
+			auditOperation(b.auditLog, audit.ActionObjectDelete))
+		b.echo.GET("/bucket/:name/objects", objectHandlers.ListObjectsHandler, bucketOperation("list_objects"), admit)
 
 		log.Info().Msg("Bucket API routes enabled")
 	}
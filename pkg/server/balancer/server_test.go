@@ -79,6 +79,48 @@ func (s *ServerTestSuite) TestNewBalancerServer() {
 	s.IsType(&echo.Echo{}, server.echo)
 }
 
+// TestNewServer tests the constructor taking a ServerConfig
+func (s *ServerTestSuite) TestNewServer() {
+	server := NewServer(ServerConfig{
+		Backends:                []string{"http://backend1:8080"},
+		RetryMax:                2,
+		RetryWaitMin:            time.Millisecond,
+		RetryWaitMax:            time.Second,
+		RequestTimeout:          3 * time.Second,
+		GracefulShutdownTimeout: 4 * time.Second,
+		HealthCheckInterval:     5 * time.Second,
+		HealthCheckTimeout:      6 * time.Second,
+		DBPath:                  "buckets.db",
+		DBDSN:                   "postgres://localhost/loopfs",
+	})
+
+	s.Equal([]string{"http://backend1:8080"}, server.backendURLs)
+	s.Equal(2, server.retryMax)
+	s.Equal(3*time.Second, server.requestTimeout)
+	s.Equal(4*time.Second, server.gracefulShutdownTimeout)
+	s.Equal(6*time.Second, server.healthCheckTimeout)
+	s.Equal("buckets.db", server.dbPath)
+	s.Equal("postgres://localhost/loopfs", server.dbDSN)
+	s.Equal(DefaultHedgePercentile, server.hedgePercentile)
+}
+
+// TestSetBackendsAndRequestTimeout tests changing backends and the request timeout while serving
+func (s *ServerTestSuite) TestSetBackendsAndRequestTimeout() {
+	s.server.backendManager = NewBackendManager(s.server.backendURLs, time.Hour, time.Second)
+	s.server.balancer = NewBalancer(s.server.backendManager, 0, time.Millisecond, time.Millisecond, time.Second)
+
+	s.server.SetRequestTimeout(7 * time.Second)
+	s.Equal(7*time.Second, s.server.balancer.RequestTimeout())
+
+	s.server.SetBackends([]string{s.mockBackend.URL, "http://added:8080"})
+	s.ElementsMatch([]string{s.mockBackend.URL, "http://added:8080"}, s.server.backendManager.AllBackendURLs())
+
+	// A backend source owns the list
+	s.server.SetBackendSource(FileBackendSource{Path: "backends"}, time.Minute)
+	s.server.SetBackends([]string{s.mockBackend.URL})
+	s.Equal(2, s.server.backendManager.BackendCount())
+}
+
 // TestServerDefaultSettings tests server with default-like settings
 func (s *ServerTestSuite) TestServerDefaultSettings() {
 	server := NewBalancerServer(
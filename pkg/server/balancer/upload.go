@@ -7,11 +7,9 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
-	"time"
 
 	"loopfs/pkg/log"
 
-	"github.com/hashicorp/go-retryablehttp"
 	"github.com/labstack/echo/v4"
 )
 
@@ -34,11 +32,7 @@ func (b *Balancer) UploadHandler(ctx echo.Context) error {
 		})
 	}
 
-	// Read file into buffer to determine size
-	fileSize := file.Size
-
-	// Select backend with most available space
-	backend, err := b.backendManager.GetBackendForUpload(fileSize)
+	outcome, err := b.replicatedUpload(ctx.Request().Context(), file, nil)
 	if err != nil {
 		if errors.Is(err, ErrNoBackendAvailable) {
 			return ctx.JSON(http.StatusServiceUnavailable, map[string]string{
@@ -50,62 +44,43 @@ func (b *Balancer) UploadHandler(ctx echo.Context) error {
 		})
 	}
 
-	reqCtx, cancel := context.WithTimeout(ctx.Request().Context(), b.requestTimeout)
-	defer cancel()
-
-	// Prepare streaming multipart request
-	boundary := fmt.Sprintf("loopfs-%d", time.Now().UnixNano())
-	uploadBody, contentType, err := createStreamingBody(reqCtx, file, boundary)
-	if err != nil {
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to prepare upload body",
-		})
-	}
-	defer func() {
-		if closeErr := uploadBody.Close(); closeErr != nil && !errors.Is(closeErr, io.ErrClosedPipe) {
-			log.Warn().Err(closeErr).Msg("Failed to close upload body")
-		}
-	}()
-
-	// Create request
-	req, err := retryablehttp.NewRequestWithContext(reqCtx, "POST", backend+"/file/upload", uploadBody)
-	if err != nil {
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to create request",
-		})
-	}
-	req.Header.Set("Content-Type", contentType)
-
-	// Execute request
-	resp, err := b.client.Do(req)
-	if err != nil {
-		// Mark backend as dead on timeout or connection errors
-		if isTimeoutOrConnectionError(err) {
-			b.backendManager.MarkBackendDead(backend, err)
-		}
-		return ctx.JSON(http.StatusServiceUnavailable, map[string]string{
-			"error": "Upload failed: " + err.Error(),
-		})
-	}
-	defer func() {
-		if closeErr := resp.Body.Close(); closeErr != nil {
-			log.Warn().Err(closeErr).Msg("Failed to close upload response body")
+	if !outcome.quorumReached(b.writeQuorum) {
+		failed := outcome.failure()
+		switch {
+		case len(outcome.stored) > 0:
+			return ctx.JSON(http.StatusServiceUnavailable, map[string]string{
+				"error": fmt.Sprintf("%s: stored on %d of %d required backends",
+					ErrWriteQuorumNotReached, len(outcome.stored), b.writeQuorum),
+			})
+		case failed.err == nil:
+			// Forward the backend's own error response
+			ctx.Response().Header().Set(echo.HeaderContentType, failed.contentType)
+			return ctx.JSONBlob(failed.status, failed.body)
+		default:
+			return ctx.JSON(http.StatusServiceUnavailable, map[string]string{
+				"error": "Upload failed: " + failed.err.Error(),
+			})
 		}
-	}()
-
-	// Forward response
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to read response",
-		})
 	}
 
-	ctx.Response().Header().Set(echo.HeaderContentType, resp.Header.Get(echo.HeaderContentType))
-	return ctx.JSONBlob(resp.StatusCode, respBody)
+	// Forward the response of the most preferred backend that stored the file
+	stored := outcome.stored[0]
+	setAuditHash(ctx, outcome.hash)
+	ctx.Response().Header().Set(echo.HeaderContentType, stored.contentType)
+	return ctx.JSONBlob(stored.status, stored.body)
 }
 
 func createStreamingBody(ctx context.Context, file *multipart.FileHeader, boundary string) (io.ReadCloser, string, error) {
+	return streamMultipart(ctx, file.Filename, func() (io.ReadCloser, error) {
+		return file.Open()
+	}, boundary)
+}
+
+// streamMultipart returns a multipart body with a single file part whose content is streamed
+// from the reader returned by open, and the matching content type.
+func streamMultipart(
+	ctx context.Context, filename string, open func() (io.ReadCloser, error), boundary string,
+) (io.ReadCloser, string, error) {
 	if err := validateBoundary(boundary); err != nil {
 		return nil, "", err
 	}
@@ -116,7 +91,7 @@ func createStreamingBody(ctx context.Context, file *multipart.FileHeader, bounda
 	go func() {
 		defer func() {
 			if closeErr := pipeWriter.Close(); closeErr != nil && !errors.Is(closeErr, io.ErrClosedPipe) {
-				log.Warn().Err(closeErr).Msg("Failed to close pipe writer")
+				log.Ctx(ctx).Warn().Err(closeErr).Msg("Failed to close pipe writer")
 			}
 		}()
 
@@ -126,20 +101,20 @@ func createStreamingBody(ctx context.Context, file *multipart.FileHeader, bounda
 			return
 		}
 
-		part, err := writer.CreateFormFile("file", file.Filename)
+		part, err := writer.CreateFormFile("file", filename)
 		if err != nil {
 			pipeWriter.CloseWithError(err)
 			return
 		}
 
-		src, err := file.Open()
+		src, err := open()
 		if err != nil {
 			pipeWriter.CloseWithError(err)
 			return
 		}
 		defer func() {
 			if closeErr := src.Close(); closeErr != nil {
-				log.Warn().Err(closeErr).Msg("Failed to close uploaded file reader")
+				log.Ctx(ctx).Warn().Err(closeErr).Msg("Failed to close uploaded file reader")
 			}
 		}()
 
@@ -0,0 +1,150 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"loopfs/pkg/log"
+)
+
+// DefaultBackendWatchInterval is how often a watched backend source is read again.
+const DefaultBackendWatchInterval = 30 * time.Second
+
+// BackendSource provides the backend URLs the balancer should use.
+type BackendSource interface {
+	Backends(ctx context.Context) ([]string, error)
+}
+
+// FileBackendSource reads backend URLs from a file, one per line or separated by commas.
+// Blank lines and lines starting with # are ignored.
+type FileBackendSource struct {
+	Path string
+}
+
+// Backends reads and normalizes the backend URLs listed in the file.
+func (s FileBackendSource) Backends(_ context.Context) ([]string, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backends file: %w", err)
+	}
+
+	var backends []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, field := range strings.Split(line, ",") {
+			if strings.TrimSpace(field) == "" {
+				continue
+			}
+			backendURL, err := NormalizeBackendURL(field)
+			if err != nil {
+				return nil, err
+			}
+			backends = append(backends, backendURL)
+		}
+	}
+	return backends, nil
+}
+
+// SRVBackendSource resolves backend URLs from a DNS SRV record.
+type SRVBackendSource struct {
+	Name   string // Full SRV name, e.g. _cas._tcp.example.com
+	Scheme string // URL scheme of the backends, http if empty
+}
+
+// Backends looks up the SRV record and returns a URL per target, sorted.
+func (s SRVBackendSource) Backends(ctx context.Context) ([]string, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", s.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up SRV record %s: %w", s.Name, err)
+	}
+
+	scheme := s.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	backends := make([]string, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		backends = append(backends, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+	}
+	sort.Strings(backends)
+	return backends, nil
+}
+
+// BackendWatcher periodically reads a backend source and synchronizes the backend manager
+// with it. Backends added or removed through the admin API are overridden on the next sync.
+type BackendWatcher struct {
+	manager  *BackendManager
+	source   BackendSource
+	interval time.Duration
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewBackendWatcher creates a watcher syncing manager with source every interval.
+func NewBackendWatcher(manager *BackendManager, source BackendSource, interval time.Duration) *BackendWatcher {
+	if interval <= 0 {
+		interval = DefaultBackendWatchInterval
+	}
+	return &BackendWatcher{
+		manager:  manager,
+		source:   source,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start synchronizes the backends once and then keeps watching the source in the background.
+func (w *BackendWatcher) Start() {
+	w.sync()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stopCh:
+				return
+			case <-ticker.C:
+				w.sync()
+			}
+		}
+	}()
+}
+
+// Stop stops watching the source.
+func (w *BackendWatcher) Stop() {
+	close(w.stopCh)
+	w.wg.Wait()
+}
+
+// sync reads the source and applies it. Errors and empty results keep the current backends,
+// so a broken file or a DNS outage does not remove every backend.
+func (w *BackendWatcher) sync() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.manager.healthCheckTimeout)
+	defer cancel()
+
+	backends, err := w.source.Backends(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read backend source, keeping current backends")
+		return
+	}
+	if len(backends) == 0 {
+		log.Warn().Msg("Backend source returned no backends, keeping current backends")
+		return
+	}
+	w.manager.SyncBackends(backends)
+}
@@ -0,0 +1,92 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// WatcherTestSuite tests backend sources and the watcher syncing them
+type WatcherTestSuite struct {
+	suite.Suite
+}
+
+// staticSource is a backend source returning preset backends or an error
+type staticSource struct {
+	mu       sync.Mutex
+	backends []string
+	err      error
+}
+
+// Backends returns the preset backends
+func (s *staticSource) Backends(_ context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.backends, s.err
+}
+
+// set replaces the preset backends and error
+func (s *staticSource) set(backends []string, err error) {
+	s.mu.Lock()
+	s.backends = backends
+	s.err = err
+	s.mu.Unlock()
+}
+
+// TestFileSourceParsing tests that comments and blank lines are skipped and URLs normalized
+func (s *WatcherTestSuite) TestFileSourceParsing() {
+	path := filepath.Join(s.T().TempDir(), "backends")
+	content := "# CAS servers\nhttp://server1:8080/\n\n  http://server2:8080, https://server3:8443\n"
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+
+	backends, err := FileBackendSource{Path: path}.Backends(context.Background())
+	s.Require().NoError(err)
+	s.Equal([]string{"http://server1:8080", "http://server2:8080", "https://server3:8443"}, backends)
+
+	s.Require().NoError(os.WriteFile(path, []byte("server1:8080\n"), 0o600))
+	_, err = FileBackendSource{Path: path}.Backends(context.Background())
+	s.ErrorIs(err, ErrInvalidBackendURL)
+
+	_, err = FileBackendSource{Path: filepath.Join(s.T().TempDir(), "missing")}.Backends(context.Background())
+	s.Error(err)
+}
+
+// TestWatcherSyncsManager tests that the watcher applies the source and keeps the backends when it fails
+func (s *WatcherTestSuite) TestWatcherSyncsManager() {
+	first, second := newBlobBackend(), newBlobBackend()
+	defer first.server.Close()
+	defer second.server.Close()
+
+	manager := NewBackendManager([]string{"http://initial:8080"}, time.Minute, 5*time.Second)
+	source := &staticSource{backends: []string{first.server.URL}}
+	watcher := NewBackendWatcher(manager, source, 20*time.Millisecond)
+	watcher.Start()
+	defer watcher.Stop()
+
+	// The first sync runs in Start
+	s.Equal([]string{first.server.URL}, manager.AllBackendURLs())
+
+	source.set(nil, errors.New("lookup failed"))
+	time.Sleep(60 * time.Millisecond)
+	s.Equal([]string{first.server.URL}, manager.AllBackendURLs())
+
+	source.set([]string{}, nil)
+	time.Sleep(60 * time.Millisecond)
+	s.Equal([]string{first.server.URL}, manager.AllBackendURLs())
+
+	source.set([]string{second.server.URL}, nil)
+	s.Eventually(func() bool {
+		status, ok := manager.GetBackendStatus(second.server.URL)
+		return ok && status.Online && manager.BackendCount() == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWatcherSuite(t *testing.T) {
+	suite.Run(t, new(WatcherTestSuite))
+}
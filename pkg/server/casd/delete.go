@@ -15,25 +15,29 @@ import (
 func (cas *CASServer) deleteFile(ctx echo.Context) error {
 	hash := ctx.Param("hash")
 
-	log.Debug().
+	log.Ctx(ctx.Request().Context()).Debug().
 		Str("hash", hash).
 		Str("method", "DELETE").
 		Str("path", ctx.Request().URL.Path).
 		Msg("File delete request")
 
+	if rejected, err := cas.rejectDelete(ctx); rejected {
+		return err
+	}
+
 	// Normalize hash to lowercase for consistent handling
 	hash = strings.ToLower(hash)
 
 	// Validate hash format
 	if !cas.store.ValidateHash(hash) {
-		log.Warn().Str("hash", hash).Msg("Invalid hash format for delete")
+		log.Ctx(ctx.Request().Context()).Warn().Str("hash", hash).Msg("Invalid hash format for delete")
 		return ctx.JSON(http.StatusBadRequest, map[string]string{
 			"error": "Invalid hash format",
 		})
 	}
 
 	// Delete the file
-	if err := cas.store.Delete(hash); err != nil {
+	if err := cas.store.Delete(ctx.Request().Context(), hash); err != nil {
 		var (
 			fileNotFoundErr store.FileNotFoundError
 			invalidHashErr  store.InvalidHashError
@@ -41,24 +45,24 @@ func (cas *CASServer) deleteFile(ctx echo.Context) error {
 
 		switch {
 		case errors.As(err, &fileNotFoundErr):
-			log.Warn().Str("hash", hash).Msg("File not found for delete")
+			log.Ctx(ctx.Request().Context()).Warn().Str("hash", hash).Msg("File not found for delete")
 			return ctx.JSON(http.StatusNotFound, map[string]string{
 				"error": "File not found",
 			})
 		case errors.As(err, &invalidHashErr):
-			log.Warn().Str("hash", hash).Msg("Invalid hash for delete")
+			log.Ctx(ctx.Request().Context()).Warn().Str("hash", hash).Msg("Invalid hash for delete")
 			return ctx.JSON(http.StatusBadRequest, map[string]string{
 				"error": "Invalid hash format",
 			})
 		default:
-			log.Error().Err(err).Str("hash", hash).Msg("Delete failed")
+			log.Ctx(ctx.Request().Context()).Error().Err(err).Str("hash", hash).Msg("Delete failed")
 			return ctx.JSON(http.StatusInternalServerError, map[string]string{
 				"error": "Internal server error",
 			})
 		}
 	}
 
-	log.Debug().Str("hash", hash).Msg("File deleted successfully")
+	log.Ctx(ctx.Request().Context()).Debug().Str("hash", hash).Msg("File deleted successfully")
 	return ctx.JSON(http.StatusOK, map[string]string{
 		"message": "File deleted successfully",
 		"hash":    hash,
@@ -1,6 +1,7 @@
 package casd
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -260,11 +261,11 @@ type MockStoreDeleteError struct {
 	errorType string
 }
 
-func (m *MockStoreDeleteError) UploadWithHash(tempFilePath, hash, filename string) (*models.UploadResponse, error) {
-	return m.MockStore.UploadWithHash(tempFilePath, hash, filename)
+func (m *MockStoreDeleteError) UploadWithHash(ctx context.Context, tempFilePath, hash, filename string) (*models.UploadResponse, error) {
+	return m.MockStore.UploadWithHash(ctx, tempFilePath, hash, filename)
 }
 
-func (m *MockStoreDeleteError) Delete(hash string) error {
+func (m *MockStoreDeleteError) Delete(ctx context.Context, hash string) error {
 	switch m.errorType {
 	case "not_found":
 		return store.FileNotFoundError{Hash: hash}
@@ -273,7 +274,7 @@ func (m *MockStoreDeleteError) Delete(hash string) error {
 	case "generic":
 		return io.ErrUnexpectedEOF
 	default:
-		return m.MockStore.Delete(hash)
+		return m.MockStore.Delete(ctx, hash)
 	}
 }
 
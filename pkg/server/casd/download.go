@@ -12,9 +12,9 @@ import (
 
 func (cas *CASServer) downloadFile(ctx echo.Context) error {
 	hash := ctx.Param("hash")
-	log.Debug().Str("hash", hash).Msg("File download request")
+	log.Ctx(ctx.Request().Context()).Debug().Str("hash", hash).Msg("File download request")
 
-	reader, err := cas.store.DownloadStream(hash)
+	reader, err := cas.store.DownloadStream(ctx.Request().Context(), hash)
 	if err != nil {
 		var notFoundErr store.FileNotFoundError
 		if errors.As(err, &notFoundErr) {
@@ -28,7 +28,7 @@ func (cas *CASServer) downloadFile(ctx echo.Context) error {
 				"error": "invalid hash format",
 			})
 		}
-		log.Error().Err(err).Msg("Failed to download file")
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Msg("Failed to download file")
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "failed to download file",
 		})
@@ -37,11 +37,11 @@ func (cas *CASServer) downloadFile(ctx echo.Context) error {
 	// Ensure reader is closed after serving to cleanup mount resources
 	defer func() {
 		if err := reader.Close(); err != nil {
-			log.Error().Err(err).Str("hash", hash).Msg("Failed to close streaming reader")
+			log.Ctx(ctx.Request().Context()).Error().Err(err).Str("hash", hash).Msg("Failed to close streaming reader")
 		}
 	}()
 
-	log.Debug().Str("hash", hash).Msg("Serving streaming file download")
+	log.Ctx(ctx.Request().Context()).Debug().Str("hash", hash).Msg("Serving streaming file download")
 
 	// Stream the file directly to the client
 	return ctx.Stream(http.StatusOK, "application/octet-stream", reader)
@@ -2,6 +2,7 @@ package casd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -224,11 +225,11 @@ type MockStoreDownloadError struct {
 	errorType string
 }
 
-func (m *MockStoreDownloadError) UploadWithHash(tempFilePath, hash, filename string) (*models.UploadResponse, error) {
-	return m.MockStore.UploadWithHash(tempFilePath, hash, filename)
+func (m *MockStoreDownloadError) UploadWithHash(ctx context.Context, tempFilePath, hash, filename string) (*models.UploadResponse, error) {
+	return m.MockStore.UploadWithHash(ctx, tempFilePath, hash, filename)
 }
 
-func (m *MockStoreDownloadError) DownloadStream(hash string) (io.ReadCloser, error) {
+func (m *MockStoreDownloadError) DownloadStream(ctx context.Context, hash string) (io.ReadCloser, error) {
 	switch m.errorType {
 	case "not_found":
 		return nil, store.FileNotFoundError{Hash: hash}
@@ -237,7 +238,7 @@ func (m *MockStoreDownloadError) DownloadStream(hash string) (io.ReadCloser, err
 	case "generic":
 		return nil, io.ErrUnexpectedEOF
 	default:
-		return m.MockStore.DownloadStream(hash)
+		return m.MockStore.DownloadStream(ctx, hash)
 	}
 }
 
@@ -282,11 +283,11 @@ type MockStoreCloseError struct {
 	*MockStore
 }
 
-func (m *MockStoreCloseError) UploadWithHash(tempFilePath, hash, filename string) (*models.UploadResponse, error) {
-	return m.MockStore.UploadWithHash(tempFilePath, hash, filename)
+func (m *MockStoreCloseError) UploadWithHash(ctx context.Context, tempFilePath, hash, filename string) (*models.UploadResponse, error) {
+	return m.MockStore.UploadWithHash(ctx, tempFilePath, hash, filename)
 }
 
-func (m *MockStoreCloseError) DownloadStream(hash string) (io.ReadCloser, error) {
+func (m *MockStoreCloseError) DownloadStream(_ context.Context, hash string) (io.ReadCloser, error) {
 	data, exists := m.files[hash]
 	if !exists {
 		return nil, store.FileNotFoundError{Hash: hash}
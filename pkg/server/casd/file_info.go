@@ -13,9 +13,9 @@ import (
 
 func (cas *CASServer) getFileInfo(ctx echo.Context) error {
 	hash := ctx.Param("hash")
-	log.Debug().Str("hash", hash).Msg("File info request")
+	log.Ctx(ctx.Request().Context()).Debug().Str("hash", hash).Msg("File info request")
 
-	fileInfo, err := cas.store.GetFileInfo(hash)
+	fileInfo, err := cas.store.GetFileInfo(ctx.Request().Context(), hash)
 	if err != nil {
 		var notFoundErr store.FileNotFoundError
 		if errors.As(err, &notFoundErr) {
@@ -29,16 +29,16 @@ func (cas *CASServer) getFileInfo(ctx echo.Context) error {
 				"error": "invalid hash format",
 			})
 		}
-		log.Error().Err(err).Msg("Failed to get file info")
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Msg("Failed to get file info")
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "failed to get file info",
 		})
 	}
 
 	// Get disk usage information for this specific file's loop filesystem
-	diskUsage, err := cas.store.GetDiskUsage(hash)
+	diskUsage, err := cas.store.GetDiskUsage(ctx.Request().Context(), hash)
 	if err != nil {
-		log.Error().Err(err).Str("hash", hash).Msg("Failed to get disk usage")
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Str("hash", hash).Msg("Failed to get disk usage")
 		// Return file info without disk usage if it fails
 		return ctx.JSON(http.StatusOK, map[string]interface{}{
 			"hash":       fileInfo.Hash,
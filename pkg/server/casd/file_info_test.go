@@ -1,6 +1,7 @@
 package casd
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -303,11 +304,11 @@ type MockStoreFileInfoError struct {
 	errorType string
 }
 
-func (m *MockStoreFileInfoError) UploadWithHash(tempFilePath, hash, filename string) (*models.UploadResponse, error) {
-	return m.MockStore.UploadWithHash(tempFilePath, hash, filename)
+func (m *MockStoreFileInfoError) UploadWithHash(ctx context.Context, tempFilePath, hash, filename string) (*models.UploadResponse, error) {
+	return m.MockStore.UploadWithHash(ctx, tempFilePath, hash, filename)
 }
 
-func (m *MockStoreFileInfoError) GetFileInfo(hash string) (*models.FileInfo, error) {
+func (m *MockStoreFileInfoError) GetFileInfo(ctx context.Context, hash string) (*models.FileInfo, error) {
 	switch m.errorType {
 	case "not_found":
 		return nil, store.FileNotFoundError{Hash: hash}
@@ -316,15 +317,15 @@ func (m *MockStoreFileInfoError) GetFileInfo(hash string) (*models.FileInfo, err
 	case "generic":
 		return nil, io.ErrUnexpectedEOF
 	default:
-		return m.MockStore.GetFileInfo(hash)
+		return m.MockStore.GetFileInfo(ctx, hash)
 	}
 }
 
-func (m *MockStoreFileInfoError) GetDiskUsage(hash string) (*models.DiskUsage, error) {
+func (m *MockStoreFileInfoError) GetDiskUsage(ctx context.Context, hash string) (*models.DiskUsage, error) {
 	if m.errorType == "diskusage" {
 		return nil, store.FileNotFoundError{Hash: hash}
 	}
-	return m.MockStore.GetDiskUsage(hash)
+	return m.MockStore.GetDiskUsage(ctx, hash)
 }
 
 // TestGetFileInfoStoreError tests file info when store returns generic error
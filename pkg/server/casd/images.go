@@ -0,0 +1,140 @@
+package casd
+
+import (
+	"errors"
+	"net/http"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+	"loopfs/pkg/store"
+	"loopfs/pkg/store/loop"
+
+	"github.com/labstack/echo/v4"
+)
+
+// loopStore returns the loop store backing the server, or nil if the server uses another store.
+func (cas *CASServer) loopStore() *loop.Store {
+	if loopStore, ok := cas.store.(*loop.Store); ok {
+		return loopStore
+	}
+	if cas.storeMgr != nil {
+		if loopStore, ok := cas.storeMgr.GetStore().(*loop.Store); ok {
+			return loopStore
+		}
+	}
+	return nil
+}
+
+// requireLoopStore returns the loop store or writes a 501 response if the server does not use one.
+func (cas *CASServer) requireLoopStore(ctx echo.Context) (*loop.Store, error) {
+	loopStore := cas.loopStore()
+	if loopStore == nil {
+		return nil, ctx.JSON(http.StatusNotImplemented, map[string]string{
+			"error": "image administration requires the loop store",
+		})
+	}
+	return loopStore, nil
+}
+
+// listImages handles GET /admin/images.
+func (cas *CASServer) listImages(ctx echo.Context) error {
+	loopStore, respErr := cas.requireLoopStore(ctx)
+	if loopStore == nil {
+		return respErr
+	}
+
+	images, err := loopStore.ListImages()
+	if err != nil {
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Msg("Failed to list loop images")
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list images",
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, models.ImageListResponse{Images: images})
+}
+
+// mountImage handles POST /admin/images/:prefix/mount.
+func (cas *CASServer) mountImage(ctx echo.Context) error {
+	loopStore, respErr := cas.requireLoopStore(ctx)
+	if loopStore == nil {
+		return respErr
+	}
+
+	prefix := ctx.Param("prefix")
+	if err := loopStore.MountImage(ctx.Request().Context(), prefix); err != nil {
+		return cas.handleImageError(ctx, prefix, err)
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{
+		"message": "image mounted",
+		"prefix":  prefix,
+	})
+}
+
+// unmountImage handles POST /admin/images/:prefix/unmount.
+func (cas *CASServer) unmountImage(ctx echo.Context) error {
+	loopStore, respErr := cas.requireLoopStore(ctx)
+	if loopStore == nil {
+		return respErr
+	}
+
+	prefix := ctx.Param("prefix")
+	if err := loopStore.UnmountImage(ctx.Request().Context(), prefix); err != nil {
+		return cas.handleImageError(ctx, prefix, err)
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{
+		"message": "image unmounted",
+		"prefix":  prefix,
+	})
+}
+
+// fsckImage handles POST /admin/images/:prefix/fsck.
+// The check is read-only unless repair=true is given.
+func (cas *CASServer) fsckImage(ctx echo.Context) error {
+	loopStore, respErr := cas.requireLoopStore(ctx)
+	if loopStore == nil {
+		return respErr
+	}
+
+	prefix := ctx.Param("prefix")
+	check := loopStore.CheckImage
+	if ctx.QueryParam("repair") == "true" {
+		check = loopStore.RepairImage
+	}
+	result, err := check(ctx.Request().Context(), prefix)
+	if err != nil {
+		return cas.handleImageError(ctx, prefix, err)
+	}
+
+	return ctx.JSON(http.StatusOK, result)
+}
+
+// handleImageError maps image administration errors to JSON responses.
+func (cas *CASServer) handleImageError(ctx echo.Context, prefix string, err error) error {
+	var (
+		invalidHashErr  store.InvalidHashError
+		fileNotFoundErr store.FileNotFoundError
+	)
+
+	switch {
+	case errors.As(err, &invalidHashErr):
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid image prefix",
+		})
+	case errors.As(err, &fileNotFoundErr):
+		return ctx.JSON(http.StatusNotFound, map[string]string{
+			"error": "image not found",
+		})
+	case errors.Is(err, loop.ErrImageBusy):
+		return ctx.JSON(http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+	default:
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Str("prefix", prefix).Msg("Image operation failed")
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "image operation failed",
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package casd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"loopfs/pkg/manager"
+	"loopfs/pkg/models"
+	"loopfs/pkg/store/loop"
+)
+
+// ImagesTestSuite tests the image administration endpoints
+type ImagesTestSuite struct {
+	suite.Suite
+	tempDir string
+	server  *CASServer
+}
+
+// SetupTest runs before each test
+func (s *ImagesTestSuite) SetupTest() {
+	s.tempDir = s.T().TempDir()
+	loopStore := loop.NewWithDefaults(s.tempDir, 10)
+	s.server = NewCASServer(s.tempDir, s.tempDir, "test-v1.0.0", manager.New(loopStore, manager.DefaultBufferSize), false, "")
+	s.server.setupRoutes()
+}
+
+// serve sends a request through the router
+func (s *ImagesTestSuite) serve(method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = testLoopbackAddr
+	rec := httptest.NewRecorder()
+	s.server.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestLoopStoreHelper tests resolving the loop store directly and through the manager
+func (s *ImagesTestSuite) TestLoopStoreHelper() {
+	s.NotNil(s.server.loopStore())
+
+	direct := NewCASServer(s.tempDir, s.tempDir, "test", loop.NewWithDefaults(s.tempDir, 10), false, "")
+	s.NotNil(direct.loopStore())
+
+	mock := NewCASServer(s.tempDir, s.tempDir, "test", NewMockStore(), false, "")
+	s.Nil(mock.loopStore())
+}
+
+// TestListImages tests listing images
+func (s *ImagesTestSuite) TestListImages() {
+	loopDir := filepath.Join(s.tempDir, "ab", "cd")
+	s.Require().NoError(os.MkdirAll(loopDir, 0750))
+	s.Require().NoError(os.WriteFile(filepath.Join(loopDir, "loop.img"), make([]byte, 512), 0600))
+
+	rec := s.serve(http.MethodGet, "/admin/images")
+	s.Equal(http.StatusOK, rec.Code)
+
+	var response models.ImageListResponse
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &response))
+	s.Require().Len(response.Images, 1)
+	s.Equal("abcd", response.Images[0].Prefix)
+	s.Equal(int64(512), response.Images[0].Size)
+	s.False(response.Images[0].Mounted)
+}
+
+// TestImageOperationErrors tests error mapping for image operations
+func (s *ImagesTestSuite) TestImageOperationErrors() {
+	for _, action := range []string{"mount", "unmount", "fsck"} {
+		rec := s.serve(http.MethodPost, "/admin/images/zzzz/"+action)
+		s.Equal(http.StatusBadRequest, rec.Code, action)
+
+		rec = s.serve(http.MethodPost, "/admin/images/abcd/"+action)
+		s.Equal(http.StatusNotFound, rec.Code, action)
+	}
+}
+
+// TestUnmountImage tests unmounting an image that is not mounted
+func (s *ImagesTestSuite) TestUnmountImage() {
+	loopDir := filepath.Join(s.tempDir, "ab", "cd")
+	s.Require().NoError(os.MkdirAll(loopDir, 0750))
+	s.Require().NoError(os.WriteFile(filepath.Join(loopDir, "loop.img"), nil, 0600))
+
+	rec := s.serve(http.MethodPost, "/admin/images/abcd/unmount")
+	s.Equal(http.StatusOK, rec.Code)
+	s.Contains(rec.Body.String(), "image unmounted")
+}
+
+// TestImagesRequireLoopStore tests that other stores get 501
+func (s *ImagesTestSuite) TestImagesRequireLoopStore() {
+	s.server = NewCASServer(s.tempDir, s.tempDir, "test", NewMockStore(), false, "")
+	s.server.setupRoutes()
+
+	s.Equal(http.StatusNotImplemented, s.serve(http.MethodGet, "/admin/images").Code)
+	s.Equal(http.StatusNotImplemented, s.serve(http.MethodPost, "/admin/images/abcd/mount").Code)
+}
+
+// TestImagesRequireAdminToken tests that image endpoints are behind admin authentication
+func (s *ImagesTestSuite) TestImagesRequireAdminToken() {
+	s.server.SetAdminToken("secret")
+	s.Equal(http.StatusUnauthorized, s.serve(http.MethodGet, "/admin/images").Code)
+}
+
+// TestImagesTestSuite runs the images test suite
+func TestImagesTestSuite(t *testing.T) {
+	suite.Run(t, new(ImagesTestSuite))
+}
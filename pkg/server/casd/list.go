@@ -0,0 +1,47 @@
+package casd
+
+import (
+	"net/http"
+	"strings"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// listPrefixes handles GET /file/list.
+// It returns the hash prefixes of the node's loop images without mounting them.
+func (cas *CASServer) listPrefixes(ctx echo.Context) error {
+	loopStore, respErr := cas.requireLoopStore(ctx)
+	if loopStore == nil {
+		return respErr
+	}
+
+	prefixes, err := loopStore.ListPrefixes()
+	if err != nil {
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Msg("Failed to list image prefixes")
+		return ctx.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to list prefixes",
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, models.PrefixListResponse{Prefixes: prefixes})
+}
+
+// listHashes handles GET /file/list/:prefix.
+// It returns the hashes stored in the loop image for a 4-character prefix.
+func (cas *CASServer) listHashes(ctx echo.Context) error {
+	loopStore, respErr := cas.requireLoopStore(ctx)
+	if loopStore == nil {
+		return respErr
+	}
+
+	prefix := strings.ToLower(ctx.Param("prefix"))
+	hashes, err := loopStore.ListHashes(ctx.Request().Context(), prefix)
+	if err != nil {
+		return cas.handleImageError(ctx, prefix, err)
+	}
+
+	return ctx.JSON(http.StatusOK, models.HashListResponse{Prefix: prefix, Hashes: hashes})
+}
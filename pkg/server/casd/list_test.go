@@ -0,0 +1,81 @@
+package casd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"loopfs/pkg/manager"
+	"loopfs/pkg/models"
+	"loopfs/pkg/store/loop"
+)
+
+// ListTestSuite tests the hash listing endpoints
+type ListTestSuite struct {
+	suite.Suite
+	tempDir string
+	server  *CASServer
+}
+
+// SetupTest runs before each test
+func (s *ListTestSuite) SetupTest() {
+	s.tempDir = s.T().TempDir()
+	loopStore := loop.NewWithDefaults(s.tempDir, 10)
+	s.server = NewCASServer(s.tempDir, s.tempDir, "test-v1.0.0", manager.New(loopStore, manager.DefaultBufferSize), false, "")
+	s.server.setupRoutes()
+}
+
+// serve sends a GET request through the router
+func (s *ListTestSuite) serve(path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	s.server.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestListPrefixes tests listing the prefixes of existing images
+func (s *ListTestSuite) TestListPrefixes() {
+	for _, prefix := range []string{"ef01", "abcd"} {
+		loopDir := filepath.Join(s.tempDir, prefix[:2], prefix[2:])
+		s.Require().NoError(os.MkdirAll(loopDir, 0750))
+		s.Require().NoError(os.WriteFile(filepath.Join(loopDir, "loop.img"), make([]byte, 512), 0600))
+	}
+
+	rec := s.serve("/file/list")
+	s.Equal(http.StatusOK, rec.Code)
+
+	var response models.PrefixListResponse
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &response))
+	s.Equal([]string{"abcd", "ef01"}, response.Prefixes)
+}
+
+// TestListHashesErrors tests error mapping when listing the hashes of an image
+func (s *ListTestSuite) TestListHashesErrors() {
+	rec := s.serve("/file/list/zzzz")
+	s.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = s.serve("/file/list/abcd")
+	s.Equal(http.StatusNotFound, rec.Code)
+}
+
+// TestListRequiresLoopStore tests that listing is unavailable without the loop store
+func (s *ListTestSuite) TestListRequiresLoopStore() {
+	server := NewCASServer(s.tempDir, s.tempDir, "test", NewMockStore(), false, "")
+	server.setupRoutes()
+
+	for _, path := range []string{"/file/list", "/file/list/abcd"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		server.echo.ServeHTTP(rec, req)
+		s.Equal(http.StatusNotImplemented, rec.Code, path)
+	}
+}
+
+func TestListSuite(t *testing.T) {
+	suite.Run(t, new(ListTestSuite))
+}
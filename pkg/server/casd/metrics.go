@@ -0,0 +1,86 @@
+package casd
+
+import (
+	"errors"
+	"os"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/manager"
+	"loopfs/pkg/metrics"
+	"loopfs/pkg/store"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	httpRequestsTotal = metrics.NewCounterVec("loopfs_casd_http_requests_total",
+		"HTTP requests by method, route and status code.", "method", "route", "code")
+	httpRequestDuration = metrics.NewHistogramVec("loopfs_casd_http_request_duration_seconds",
+		"HTTP request latency by method and route.", metrics.DefBuckets, "method", "route")
+	uploadsTotal = metrics.NewCounterVec("loopfs_casd_uploads_total",
+		"Uploads by result: stored, duplicate, rejected or error.", "result")
+	uploadBytesTotal = metrics.NewCounter("loopfs_casd_upload_bytes_total",
+		"Bytes of newly stored objects.")
+	dedupHitsTotal = metrics.NewCounter("loopfs_casd_dedup_hits_total",
+		"Uploads of objects that were already stored.")
+	tempDirBytes = metrics.NewGauge("loopfs_casd_temp_dir_bytes",
+		"Bytes held by upload temp files, updated when metrics are collected.")
+	tempDirFiles = metrics.NewGauge("loopfs_casd_temp_dir_files",
+		"Upload temp files present, updated when metrics are collected.")
+	reservedBytes = metrics.NewGauge("loopfs_casd_reserved_bytes",
+		"Storage reserved by in-flight uploads, updated when metrics are collected.")
+	activeReservations = metrics.NewGauge("loopfs_casd_active_reservations",
+		"In-flight uploads holding a storage reservation, updated when metrics are collected.")
+)
+
+// observeUpload counts an upload of size bytes by its outcome.
+func observeUpload(size int64, err error) {
+	var fileExistsErr store.FileExistsError
+	switch {
+	case err == nil:
+		uploadsTotal.WithLabelValues("stored").Inc()
+		uploadBytesTotal.Add(float64(size))
+	case errors.As(err, &fileExistsErr):
+		uploadsTotal.WithLabelValues("duplicate").Inc()
+		dedupHitsTotal.Inc()
+	case errors.Is(err, ErrObjectTooLarge), errors.Is(err, ErrInsufficientStorage),
+		errors.Is(err, manager.ErrReadOnly), errors.Is(err, manager.ErrInsufficientCapacity):
+		uploadsTotal.WithLabelValues("rejected").Inc()
+	default:
+		uploadsTotal.WithLabelValues("error").Inc()
+	}
+}
+
+// getMetrics handles the GET /metrics endpoint.
+func (cas *CASServer) getMetrics(ctx echo.Context) error {
+	cas.updateMetrics()
+	ctx.Response().Header().Set(echo.HeaderContentType, metrics.ContentType)
+	return metrics.Default.WriteText(ctx.Response())
+}
+
+// updateMetrics refreshes the gauges derived from server and store state.
+func (cas *CASServer) updateMetrics() {
+	reserved, count := cas.reservations.snapshot()
+	reservedBytes.Set(float64(reserved))
+	activeReservations.Set(float64(count))
+
+	entries, err := os.ReadDir(cas.tempDir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Str("temp_dir", cas.tempDir).Msg("Failed to read temp directory for metrics")
+	}
+	var files, size int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files++
+		size += info.Size()
+	}
+	tempDirFiles.Set(float64(files))
+	tempDirBytes.Set(float64(size))
+
+	if loopStore := cas.loopStore(); loopStore != nil {
+		loopStore.UpdateMetrics()
+	}
+}
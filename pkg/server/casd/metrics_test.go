@@ -0,0 +1,97 @@
+package casd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"loopfs/pkg/metrics"
+	"loopfs/pkg/store"
+)
+
+// MetricsTestSuite tests the metrics endpoint and upload instrumentation
+type MetricsTestSuite struct {
+	suite.Suite
+	tempDir   string
+	server    *CASServer
+	mockStore *MockStore
+}
+
+// SetupTest runs before each test
+func (s *MetricsTestSuite) SetupTest() {
+	s.tempDir = s.T().TempDir()
+	s.mockStore = NewMockStore()
+	s.server = NewCASServer(s.tempDir, s.tempDir, "test-v1.0.0", s.mockStore, false, "")
+	s.server.setupRoutes()
+}
+
+// serve sends a request through the router
+func (s *MetricsTestSuite) serve(method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.server.echo.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+// TestMetricsEndpoint tests that metrics are served in the text format
+func (s *MetricsTestSuite) TestMetricsEndpoint() {
+	s.serve(http.MethodGet, "/node/info")
+
+	rec := s.serve(http.MethodGet, "/metrics")
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(metrics.ContentType, rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	s.Contains(body, "# TYPE loopfs_casd_uploads_total counter")
+	s.Contains(body, "# TYPE loopfs_loop_mounts_total counter")
+	s.Contains(body, "# TYPE loopfs_manager_verify_block_total counter")
+	s.Contains(body, `loopfs_casd_http_requests_total{method="GET",route="/node/info",code="200"}`)
+}
+
+// TestRequestsLabelledByRoute tests that hashes do not become label values
+func (s *MetricsTestSuite) TestRequestsLabelledByRoute() {
+	before := httpRequestsTotal.WithLabelValues(http.MethodGet, "/file/:hash/info", "400").Value()
+
+	s.serve(http.MethodGet, "/file/not-a-hash/info")
+
+	s.InDelta(before+1, httpRequestsTotal.WithLabelValues(http.MethodGet, "/file/:hash/info", "400").Value(), 0.0001)
+}
+
+// TestObserveUpload tests that uploads are counted by outcome
+func (s *MetricsTestSuite) TestObserveUpload() {
+	stored := uploadsTotal.WithLabelValues("stored").Value()
+	storedBytes := uploadBytesTotal.Value()
+	duplicates := uploadsTotal.WithLabelValues("duplicate").Value()
+	dedupHits := dedupHitsTotal.Value()
+	rejected := uploadsTotal.WithLabelValues("rejected").Value()
+
+	observeUpload(100, nil)
+	observeUpload(0, store.FileExistsError{Hash: "abcd"})
+	observeUpload(0, ErrObjectTooLarge)
+
+	s.InDelta(stored+1, uploadsTotal.WithLabelValues("stored").Value(), 0.0001)
+	s.InDelta(storedBytes+100, uploadBytesTotal.Value(), 0.0001)
+	s.InDelta(duplicates+1, uploadsTotal.WithLabelValues("duplicate").Value(), 0.0001)
+	s.InDelta(dedupHits+1, dedupHitsTotal.Value(), 0.0001)
+	s.InDelta(rejected+1, uploadsTotal.WithLabelValues("rejected").Value(), 0.0001)
+}
+
+// TestTempDirUsage tests the temp directory gauges
+func (s *MetricsTestSuite) TestTempDirUsage() {
+	s.Require().NoError(s.server.ensureTempDir())
+	s.Require().NoError(os.WriteFile(filepath.Join(s.server.tempDir, "upload-1.tmp"), make([]byte, 300), 0600))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.server.tempDir, "upload-2.tmp"), make([]byte, 200), 0600))
+
+	s.server.updateMetrics()
+
+	s.InDelta(2, tempDirFiles.Value(), 0.0001)
+	s.InDelta(500, tempDirBytes.Value(), 0.0001)
+}
+
+// TestMetricsTestSuite runs the metrics test suite
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(MetricsTestSuite))
+}
@@ -0,0 +1,177 @@
+package casd
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrWritesDisabled is returned when a write is rejected because of the node mode.
+var ErrWritesDisabled = errors.New("writes are disabled on this node")
+
+// modeRequest is the body accepted by PUT /admin/mode.
+type modeRequest struct {
+	Mode models.NodeMode `json:"mode"`
+}
+
+// modeResponse is returned by the admin mode endpoints.
+type modeResponse struct {
+	Mode           models.NodeMode `json:"mode"`
+	ConfiguredMode models.NodeMode `json:"configured_mode"`
+	AcceptsWrites  bool            `json:"accepts_writes"`
+}
+
+// SetMode switches the node between normal, read-only and draining mode.
+func (cas *CASServer) SetMode(mode models.NodeMode) error {
+	if !mode.Valid() {
+		return fmt.Errorf("invalid node mode %q", mode)
+	}
+
+	cas.modeMu.Lock()
+	previous := cas.mode
+	cas.mode = mode
+	cas.modeMu.Unlock()
+
+	if previous != mode {
+		log.Info().Str("mode", string(mode)).Str("previous_mode", string(previous)).Msg("Node mode changed")
+	}
+	return nil
+}
+
+// SetAdminToken sets the bearer token required by the admin API. Without a token the admin API
+// only serves loopback clients.
+func (cas *CASServer) SetAdminToken(token string) {
+	cas.adminToken = token
+}
+
+// configuredMode returns the mode set by the operator.
+func (cas *CASServer) configuredMode() models.NodeMode {
+	cas.modeMu.RLock()
+	defer cas.modeMu.RUnlock()
+	if cas.mode == "" {
+		return models.NodeModeNormal
+	}
+	return cas.mode
+}
+
+// effectiveMode returns the mode the node currently operates in.
+// A node above its storage high-water mark is read-only regardless of the configured mode.
+func (cas *CASServer) effectiveMode() models.NodeMode {
+	mode := cas.configuredMode()
+	if mode == models.NodeModeNormal && cas.storeMgr != nil && cas.storeMgr.ReadOnly() {
+		return models.NodeModeReadOnly
+	}
+	return mode
+}
+
+// rejectUpload returns a 503 response if the node does not accept uploads in its current mode.
+func (cas *CASServer) rejectUpload(ctx echo.Context) (bool, error) {
+	mode := cas.effectiveMode()
+	if mode == models.NodeModeNormal {
+		return false, nil
+	}
+	return true, cas.writesDisabledResponse(ctx, mode)
+}
+
+// rejectDelete returns a 503 response if the node does not accept deletes in its current mode.
+// Draining nodes still accept deletes so data can be moved off them.
+func (cas *CASServer) rejectDelete(ctx echo.Context) (bool, error) {
+	mode := cas.effectiveMode()
+	if mode != models.NodeModeReadOnly {
+		return false, nil
+	}
+	return true, cas.writesDisabledResponse(ctx, mode)
+}
+
+// writesDisabledResponse writes the 503 response for a write rejected by the node mode.
+func (cas *CASServer) writesDisabledResponse(ctx echo.Context, mode models.NodeMode) error {
+	log.Ctx(ctx.Request().Context()).Warn().
+		Str("mode", string(mode)).
+		Str("method", ctx.Request().Method).
+		Str("path", ctx.Request().URL.Path).
+		Msg("Rejecting write, node does not accept writes")
+	return ctx.JSON(http.StatusServiceUnavailable, map[string]string{
+		"error": ErrWritesDisabled.Error(),
+		"mode":  string(mode),
+	})
+}
+
+// adminAuth requires the configured bearer token on admin endpoints. Without a token, they
+// are only served to loopback clients, since casd listens where the balancers reach it.
+func (cas *CASServer) adminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if cas.adminToken == "" {
+			if loopbackClient(ctx.Request()) {
+				return next(ctx)
+			}
+			log.Warn().
+				Str("path", ctx.Request().URL.Path).
+				Str("remote_addr", ctx.Request().RemoteAddr).
+				Msg("Refusing admin request from a non-loopback client without an admin token")
+			return ctx.JSON(http.StatusForbidden, map[string]string{
+				"error": "admin API is only served to loopback clients when no admin token is set",
+			})
+		}
+
+		token, found := strings.CutPrefix(ctx.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(cas.adminToken)) != 1 {
+			log.Warn().Str("path", ctx.Request().URL.Path).Msg("Unauthorized admin request")
+			return ctx.JSON(http.StatusUnauthorized, map[string]string{
+				"error": "unauthorized",
+			})
+		}
+		return next(ctx)
+	}
+}
+
+// loopbackClient reports whether the connection of req comes from a loopback address.
+// Forwarding headers are ignored since any client can set them.
+func loopbackClient(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// getMode handles GET /admin/mode.
+func (cas *CASServer) getMode(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, cas.modeStatus())
+}
+
+// putMode handles PUT /admin/mode.
+func (cas *CASServer) putMode(ctx echo.Context) error {
+	var req modeRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	if err := cas.SetMode(req.Mode); err != nil {
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, cas.modeStatus())
+}
+
+// modeStatus builds the admin mode response.
+func (cas *CASServer) modeStatus() modeResponse {
+	mode := cas.effectiveMode()
+	return modeResponse{
+		Mode:           mode,
+		ConfiguredMode: cas.configuredMode(),
+		AcceptsWrites:  mode == models.NodeModeNormal,
+	}
+}
@@ -0,0 +1,182 @@
+package casd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"loopfs/pkg/models"
+)
+
+const (
+	modeTestHash = "a1b2c3d4e5f67890123456789abcdef0123456789abcdef0123456789abcdef0"
+	// testLoopbackAddr is the remote address of admin requests made from the node itself
+	testLoopbackAddr = "127.0.0.1:40000"
+)
+
+// ModeTestSuite tests node modes and the admin mode API
+type ModeTestSuite struct {
+	suite.Suite
+	server    *CASServer
+	mockStore *MockStore
+}
+
+// SetupTest runs before each test
+func (s *ModeTestSuite) SetupTest() {
+	tempDir := s.T().TempDir()
+	s.mockStore = NewMockStore()
+	s.server = NewCASServer(tempDir, tempDir, "test-v1.0.0", s.mockStore, false, "")
+	s.server.setupRoutes()
+}
+
+// serve sends a request through the router
+func (s *ModeTestSuite) serve(method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = testLoopbackAddr
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.server.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestDefaultMode tests that a new server runs in normal mode
+func (s *ModeTestSuite) TestDefaultMode() {
+	s.Equal(models.NodeModeNormal, s.server.effectiveMode())
+
+	info, err := s.server.collectNodeInfo()
+	s.Require().NoError(err)
+	s.Equal(models.NodeModeNormal, info.Mode)
+	s.True(info.AcceptsWrites)
+}
+
+// TestSetModeInvalid tests that unknown modes are rejected
+func (s *ModeTestSuite) TestSetModeInvalid() {
+	s.Error(s.server.SetMode("maintenance"))
+	s.Equal(models.NodeModeNormal, s.server.configuredMode())
+}
+
+// TestNodeInfoReflectsMode tests that node info reports the mode
+func (s *ModeTestSuite) TestNodeInfoReflectsMode() {
+	s.Require().NoError(s.server.SetMode(models.NodeModeDraining))
+
+	info, err := s.server.collectNodeInfo()
+	s.Require().NoError(err)
+	s.Equal(models.NodeModeDraining, info.Mode)
+	s.False(info.AcceptsWrites)
+	s.False(info.AcceptsUploads())
+}
+
+// TestPutAndGetMode tests switching modes through the admin API
+func (s *ModeTestSuite) TestPutAndGetMode() {
+	rec := s.serve(http.MethodPut, "/admin/mode", `{"mode":"read-only"}`, "")
+	s.Equal(http.StatusOK, rec.Code)
+
+	rec = s.serve(http.MethodGet, "/admin/mode", "", "")
+	s.Equal(http.StatusOK, rec.Code)
+
+	var response modeResponse
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &response))
+	s.Equal(models.NodeModeReadOnly, response.Mode)
+	s.Equal(models.NodeModeReadOnly, response.ConfiguredMode)
+	s.False(response.AcceptsWrites)
+}
+
+// TestPutModeInvalid tests that the admin API rejects unknown modes
+func (s *ModeTestSuite) TestPutModeInvalid() {
+	rec := s.serve(http.MethodPut, "/admin/mode", `{"mode":"offline"}`, "")
+	s.Equal(http.StatusBadRequest, rec.Code)
+
+	rec = s.serve(http.MethodPut, "/admin/mode", `{not json`, "")
+	s.Equal(http.StatusBadRequest, rec.Code)
+}
+
+// TestAdminToken tests bearer authentication on the admin API
+func (s *ModeTestSuite) TestAdminToken() {
+	s.server.SetAdminToken("secret")
+
+	rec := s.serve(http.MethodGet, "/admin/mode", "", "")
+	s.Equal(http.StatusUnauthorized, rec.Code)
+
+	rec = s.serve(http.MethodPut, "/admin/mode", `{"mode":"draining"}`, "wrong")
+	s.Equal(http.StatusUnauthorized, rec.Code)
+	s.Equal(models.NodeModeNormal, s.server.configuredMode())
+
+	rec = s.serve(http.MethodPut, "/admin/mode", `{"mode":"draining"}`, "secret")
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(models.NodeModeDraining, s.server.configuredMode())
+}
+
+// TestAdminWithoutToken tests that the admin API only serves loopback clients without a token
+func (s *ModeTestSuite) TestAdminWithoutToken() {
+	request := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPut, "/admin/mode", strings.NewReader(`{"mode":"draining"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", "127.0.0.1")
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		s.server.echo.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	s.Equal(http.StatusForbidden, request("192.0.2.10:40000"))
+	s.Equal(http.StatusForbidden, request("invalid"))
+	s.Equal(models.NodeModeNormal, s.server.configuredMode())
+
+	s.Equal(http.StatusOK, request("[::1]:40000"))
+	s.Equal(models.NodeModeDraining, s.server.configuredMode())
+}
+
+// TestUploadRejectedWhenDraining tests that uploads get 503 outside normal mode
+func (s *ModeTestSuite) TestUploadRejectedWhenDraining() {
+	for _, mode := range []models.NodeMode{models.NodeModeDraining, models.NodeModeReadOnly} {
+		s.Require().NoError(s.server.SetMode(mode))
+
+		rec := s.serve(http.MethodPost, "/file/upload", "", "")
+		s.Equal(http.StatusServiceUnavailable, rec.Code, "mode %s", mode)
+		s.Contains(rec.Body.String(), ErrWritesDisabled.Error())
+	}
+}
+
+// TestDeleteByMode tests that deletes are rejected only in read-only mode
+func (s *ModeTestSuite) TestDeleteByMode() {
+	s.mockStore.files[modeTestHash] = []byte("content")
+
+	s.Require().NoError(s.server.SetMode(models.NodeModeReadOnly))
+	rec := s.serve(http.MethodDelete, "/file/"+modeTestHash+"/delete", "", "")
+	s.Equal(http.StatusServiceUnavailable, rec.Code)
+
+	s.Require().NoError(s.server.SetMode(models.NodeModeDraining))
+	rec = s.serve(http.MethodDelete, "/file/"+modeTestHash+"/delete", "", "")
+	s.NotEqual(http.StatusServiceUnavailable, rec.Code)
+}
+
+// TestHealthz tests the health probe reports the mode and fails without storage
+func (s *ModeTestSuite) TestHealthz() {
+	s.Require().NoError(s.server.SetMode(models.NodeModeDraining))
+
+	rec := s.serve(http.MethodGet, "/healthz", "", "")
+	s.Require().Equal(http.StatusOK, rec.Code)
+	var health map[string]string
+	s.Require().NoError(json.Unmarshal(rec.Body.Bytes(), &health))
+	s.Equal("ok", health["status"])
+	s.Equal(string(models.NodeModeDraining), health["mode"])
+
+	s.server.storageDir = filepath.Join(s.T().TempDir(), "missing")
+	rec = s.serve(http.MethodGet, "/healthz", "", "")
+	s.Equal(http.StatusServiceUnavailable, rec.Code)
+}
+
+// TestModeTestSuite runs the mode test suite
+func TestModeTestSuite(t *testing.T) {
+	suite.Run(t, new(ModeTestSuite))
+}
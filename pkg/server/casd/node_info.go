@@ -19,7 +19,7 @@ import (
 func (cas *CASServer) getNodeInfo(ctx echo.Context) error {
 	info, err := cas.collectNodeInfo()
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to collect node information")
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Msg("Failed to collect node information")
 		return ctx.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to collect node information",
 		})
@@ -28,6 +28,25 @@ func (cas *CASServer) getNodeInfo(ctx echo.Context) error {
 	return ctx.JSON(http.StatusOK, info)
 }
 
+// getHealthz handles the GET /healthz endpoint, a cheap liveness probe for the balancer. It
+// only checks that the storage directory can be reached; the node info is fetched separately.
+func (cas *CASServer) getHealthz(ctx echo.Context) error {
+	mode := cas.configuredMode()
+	if _, err := getStorageInfo(cas.storageDir); err != nil {
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Str("storage_dir", cas.storageDir).Msg("Health check failed")
+		return ctx.JSON(http.StatusServiceUnavailable, map[string]string{
+			"status": "unhealthy",
+			"mode":   string(mode),
+			"error":  "Storage directory is not accessible",
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{
+		"status": "ok",
+		"mode":   string(mode),
+	})
+}
+
 // collectNodeInfo gathers system information.
 func (cas *CASServer) collectNodeInfo() (*models.NodeInfo, error) {
 	uptime, err := getUptime()
@@ -50,12 +69,35 @@ func (cas *CASServer) collectNodeInfo() (*models.NodeInfo, error) {
 		return nil, err
 	}
 
+	var capacity *models.CapacityInfo
+	if cas.storeMgr != nil {
+		capacity, err = cas.storeMgr.ProjectedCapacity()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mode := cas.configuredMode()
+	if mode == models.NodeModeNormal && capacity != nil && capacity.ReadOnly {
+		mode = models.NodeModeReadOnly
+	}
+
+	var degraded []models.ImageHealth
+	if loopStore := cas.loopStore(); loopStore != nil {
+		degraded = loopStore.DegradedImages()
+	}
+
 	return &models.NodeInfo{
 		Uptime:        formatUptime(uptime),
 		UptimeSeconds: uptime,
 		LoadAverages:  *loadAvg,
 		Memory:        *memory,
 		Storage:       *storage,
+		Uploads:       cas.reservationInfo(),
+		Capacity:      capacity,
+		Mode:          mode,
+		AcceptsWrites: mode == models.NodeModeNormal,
+		Degraded:      degraded,
 	}, nil
 }
 
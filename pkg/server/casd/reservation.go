@@ -0,0 +1,167 @@
+package casd
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+)
+
+var (
+	// ErrObjectTooLarge is returned when an upload exceeds the configured maximum object size.
+	ErrObjectTooLarge = errors.New("object exceeds maximum allowed size")
+	// ErrInsufficientStorage is returned when the node cannot admit an upload of the requested size.
+	ErrInsufficientStorage = errors.New("insufficient storage for upload")
+)
+
+// reservationTracker keeps track of space reserved by in-flight uploads.
+// An upload is admitted only if the space currently available on the storage directory,
+// minus what other in-flight uploads have already reserved, can hold it.
+type reservationTracker struct {
+	mu       sync.Mutex
+	reserved uint64
+	count    int
+}
+
+// reservation is the space held by one in-flight upload.
+type reservation struct {
+	tracker *reservationTracker
+	size    uint64
+	once    sync.Once
+}
+
+// reserve admits an upload of size bytes against the given available space.
+// The returned reservation must be released once the upload has finished.
+func (rt *reservationTracker) reserve(size, available uint64) (*reservation, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.reserved > available || size > available-rt.reserved {
+		log.Warn().
+			Uint64("size", size).
+			Uint64("available", available).
+			Uint64("reserved", rt.reserved).
+			Int("active_reservations", rt.count).
+			Msg("Rejecting upload, not enough storage")
+		return nil, ErrInsufficientStorage
+	}
+
+	rt.reserved += size
+	rt.count++
+	return &reservation{tracker: rt, size: size}, nil
+}
+
+// renew checks that the available space, minus what other in-flight uploads have reserved,
+// can still hold the reservation. It is used by uploads of unknown length, whose written bytes
+// have already left the available space by the time the next part of the upload is admitted.
+func (r *reservation) renew(available uint64) error {
+	rt := r.tracker
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	others := rt.reserved - r.size
+	if others > available || r.size > available-others {
+		log.Warn().
+			Uint64("size", r.size).
+			Uint64("available", available).
+			Uint64("reserved", rt.reserved).
+			Msg("Stopping upload of unknown length, not enough storage")
+		return ErrInsufficientStorage
+	}
+	return nil
+}
+
+// release returns the reserved space. Calling it more than once has no effect.
+func (r *reservation) release() {
+	r.once.Do(func() {
+		rt := r.tracker
+		rt.mu.Lock()
+		defer rt.mu.Unlock()
+		rt.reserved -= r.size
+		rt.count--
+	})
+}
+
+// snapshot returns the current reservation totals.
+func (rt *reservationTracker) snapshot() (uint64, int) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.reserved, rt.count
+}
+
+// SetMaxObjectSize sets the largest object, in bytes, accepted by the upload endpoint.
+// A value of zero or less means no limit.
+func (cas *CASServer) SetMaxObjectSize(size int64) {
+	cas.maxObjectSize = size
+}
+
+// reserveUpload reserves storage for an upload whose request body is contentLength bytes long.
+// When the length is unknown the maximum object size is reserved instead, or, without one,
+// uploadReservationStep bytes that the upload renews as it streams (see reservingReader).
+//
+// Only the temporary copy of the upload is reserved. The store then writes the object into a
+// loop image, which is allocated in full when it is created, and the space for creating or
+// growing an image is accounted separately by the manager's capacity planning.
+func (cas *CASServer) reserveUpload(contentLength int64) (*reservation, error) {
+	if cas.maxObjectSize > 0 && contentLength > cas.maxObjectSize+multipartOverhead {
+		return nil, ErrObjectTooLarge
+	}
+
+	size := contentLength
+	if size < 0 {
+		size = cas.maxObjectSize
+		if size <= 0 {
+			size = uploadReservationStep
+		}
+	}
+
+	storage, err := getStorageInfo(cas.storageDir)
+	if err != nil {
+		log.Error().Err(err).Str("storage_dir", cas.storageDir).Msg("Failed to read storage information")
+		return nil, err
+	}
+
+	return cas.reservations.reserve(uint64(size), storage.Available) // #nosec G115 - size is non-negative
+}
+
+// reservingReader streams an upload of unknown length that no maximum object size bounds.
+// Each time step more bytes have been read, it checks that the storage directory still has
+// room for the next step and fails with ErrInsufficientStorage otherwise.
+type reservingReader struct {
+	reader      io.Reader
+	reservation *reservation
+	storageDir  string
+	step        int64
+	unchecked   int64
+}
+
+// Read implements io.Reader.
+func (r *reservingReader) Read(buf []byte) (int, error) {
+	n, err := r.reader.Read(buf)
+	r.unchecked += int64(n)
+	if r.unchecked < r.step {
+		return n, err
+	}
+	r.unchecked -= r.step
+
+	storage, statErr := getStorageInfo(r.storageDir)
+	if statErr != nil {
+		return n, statErr
+	}
+	if renewErr := r.reservation.renew(storage.Available); renewErr != nil {
+		return n, renewErr
+	}
+	return n, err
+}
+
+// reservationInfo returns the upload admission state reported in node information.
+func (cas *CASServer) reservationInfo() models.UploadInfo {
+	reserved, count := cas.reservations.snapshot()
+	return models.UploadInfo{
+		MaxObjectSize:      cas.maxObjectSize,
+		ReservedBytes:      reserved,
+		ActiveReservations: count,
+	}
+}
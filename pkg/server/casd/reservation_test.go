@@ -0,0 +1,188 @@
+package casd
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// ReservationTestSuite tests upload space reservations
+type ReservationTestSuite struct {
+	suite.Suite
+	tracker *reservationTracker
+}
+
+// SetupTest runs before each test
+func (s *ReservationTestSuite) SetupTest() {
+	s.tracker = &reservationTracker{}
+}
+
+// TestReserveAndRelease tests that reservations are tracked and released
+func (s *ReservationTestSuite) TestReserveAndRelease() {
+	reserved, err := s.tracker.reserve(100, 1000)
+	s.Require().NoError(err)
+
+	total, count := s.tracker.snapshot()
+	s.Equal(uint64(100), total)
+	s.Equal(1, count)
+
+	reserved.release()
+	// Releasing twice must not underflow the counters
+	reserved.release()
+
+	total, count = s.tracker.snapshot()
+	s.Equal(uint64(0), total)
+	s.Equal(0, count)
+}
+
+// TestReserveAccountsForInFlight tests that in-flight reservations reduce admissible space
+func (s *ReservationTestSuite) TestReserveAccountsForInFlight() {
+	first, err := s.tracker.reserve(600, 1000)
+	s.Require().NoError(err)
+
+	_, err = s.tracker.reserve(500, 1000)
+	s.ErrorIs(err, ErrInsufficientStorage)
+
+	second, err := s.tracker.reserve(400, 1000)
+	s.Require().NoError(err)
+	second.release()
+
+	first.release()
+	third, err := s.tracker.reserve(500, 1000)
+	s.Require().NoError(err)
+	third.release()
+}
+
+// TestReserveWhenReservedExceedsAvailable tests admission after available space shrank below reservations
+func (s *ReservationTestSuite) TestReserveWhenReservedExceedsAvailable() {
+	reserved, err := s.tracker.reserve(800, 1000)
+	s.Require().NoError(err)
+	defer reserved.release()
+
+	_, err = s.tracker.reserve(1, 500)
+	s.ErrorIs(err, ErrInsufficientStorage)
+}
+
+// TestRenew tests that a renewed reservation is checked against other in-flight reservations only
+func (s *ReservationTestSuite) TestRenew() {
+	streaming, err := s.tracker.reserve(400, 1000)
+	s.Require().NoError(err)
+	defer streaming.release()
+
+	other, err := s.tracker.reserve(300, 1000)
+	s.Require().NoError(err)
+
+	// 400 bytes were written, leaving 600 available: 300 for the other upload and 300 free
+	s.ErrorIs(streaming.renew(600), ErrInsufficientStorage)
+	s.NoError(streaming.renew(700))
+
+	other.release()
+	s.NoError(streaming.renew(400))
+
+	total, count := s.tracker.snapshot()
+	s.Equal(uint64(400), total)
+	s.Equal(1, count)
+}
+
+// TestReserveUploadTooLarge tests that a declared length above the maximum is rejected early
+func (s *ReservationTestSuite) TestReserveUploadTooLarge() {
+	tempDir := s.T().TempDir()
+	server := NewCASServer(tempDir, tempDir, "test", NewMockStore(), false, "")
+	server.SetMaxObjectSize(10)
+
+	_, err := server.reserveUpload(10 + multipartOverhead + 1)
+	s.ErrorIs(err, ErrObjectTooLarge)
+
+	reserved, err := server.reserveUpload(5)
+	s.Require().NoError(err)
+	s.Equal(uint64(5), server.reservationInfo().ReservedBytes)
+	reserved.release()
+}
+
+// TestReserveUploadUnknownLength tests that the maximum object size is reserved for unknown lengths
+func (s *ReservationTestSuite) TestReserveUploadUnknownLength() {
+	tempDir := s.T().TempDir()
+	server := NewCASServer(tempDir, tempDir, "test", NewMockStore(), false, "")
+	server.SetMaxObjectSize(1024)
+
+	reserved, err := server.reserveUpload(-1)
+	s.Require().NoError(err)
+	defer reserved.release()
+
+	info := server.reservationInfo()
+	s.Equal(uint64(1024), info.ReservedBytes)
+	s.Equal(1, info.ActiveReservations)
+	s.Equal(int64(1024), info.MaxObjectSize)
+}
+
+// TestReserveUploadUnknownLengthUnlimited tests that one reservation step is reserved without a maximum object size
+func (s *ReservationTestSuite) TestReserveUploadUnknownLengthUnlimited() {
+	tempDir := s.T().TempDir()
+	server := NewCASServer(tempDir, tempDir, "test", NewMockStore(), false, "")
+
+	reserved, err := server.reserveUpload(-1)
+	s.Require().NoError(err)
+	defer reserved.release()
+
+	info := server.reservationInfo()
+	s.Equal(uint64(uploadReservationStep), info.ReservedBytes)
+	s.Equal(1, info.ActiveReservations)
+}
+
+// TestReservingReader tests that free space is checked each time a reservation step is streamed
+func (s *ReservationTestSuite) TestReservingReader() {
+	reserved, err := s.tracker.reserve(4, 1<<40)
+	s.Require().NoError(err)
+	defer reserved.release()
+
+	reader := &reservingReader{
+		reader:      strings.NewReader("0123456789"),
+		reservation: reserved,
+		storageDir:  s.T().TempDir(),
+		step:        4,
+	}
+	data, err := io.ReadAll(reader)
+	s.Require().NoError(err)
+	s.Equal("0123456789", string(data))
+
+	// Another upload holding more than the storage directory has left stops the stream
+	other, err := s.tracker.reserve(1<<62, 1<<63)
+	s.Require().NoError(err)
+	defer other.release()
+
+	reader = &reservingReader{
+		reader:      strings.NewReader("0123456789"),
+		reservation: reserved,
+		storageDir:  s.T().TempDir(),
+		step:        4,
+	}
+	_, err = io.ReadAll(reader)
+	s.ErrorIs(err, ErrInsufficientStorage)
+
+	reader = &reservingReader{
+		reader:      strings.NewReader("0123456789"),
+		reservation: reserved,
+		storageDir:  s.T().TempDir() + "/missing",
+		step:        4,
+	}
+	_, err = io.ReadAll(reader)
+	s.Error(err)
+}
+
+// TestReserveUploadMissingStorageDir tests that storage lookup failures are reported
+func (s *ReservationTestSuite) TestReserveUploadMissingStorageDir() {
+	missingDir := s.T().TempDir() + "/missing"
+	s.NoDirExists(missingDir)
+	server := NewCASServer(missingDir, missingDir, "test", NewMockStore(), false, "")
+
+	_, err := server.reserveUpload(1)
+	s.Error(err)
+	s.NotErrorIs(err, ErrInsufficientStorage)
+}
+
+// TestReservationTestSuite runs the reservation test suite
+func TestReservationTestSuite(t *testing.T) {
+	suite.Run(t, new(ReservationTestSuite))
+}
@@ -9,13 +9,16 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
 	"loopfs/pkg/log"
 	"loopfs/pkg/manager"
+	"loopfs/pkg/metrics"
+	"loopfs/pkg/models"
 	"loopfs/pkg/store"
-	"loopfs/pkg/store/loop"
+	"loopfs/pkg/tracing"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -36,6 +39,12 @@ type CASServer struct {
 	storeMgr   *manager.Manager
 	debug      bool
 	debugAddr  string
+
+	maxObjectSize int64 // Largest accepted upload in bytes, 0 means unlimited
+	reservations  reservationTracker
+	modeMu        sync.RWMutex
+	mode          models.NodeMode // Operator-configured mode, empty means normal
+	adminToken    string          // Bearer token for the admin API, empty restricts it to loopback clients
 }
 
 func NewCASServer(storageDir, webDir, version string, storeImpl store.Store, debug bool, debugAddr string) *CASServer {
@@ -108,7 +117,8 @@ func (cas *CASServer) Shutdown() error {
 	log.Info().Msg("Server gracefully stopped")
 
 	// Unmount all currently mounted loop images
-	if loopStore, ok := cas.store.(*loop.Store); ok {
+	if loopStore := cas.loopStore(); loopStore != nil {
+		loopStore.StopHealthChecks()
 		log.Info().Msg("Unmounting all loop images...")
 		if err := loopStore.UnmountAll(); err != nil {
 			log.Error().Err(err).Msg("Failed to unmount all loop images")
@@ -116,17 +126,6 @@ func (cas *CASServer) Shutdown() error {
 		} else {
 			log.Info().Msg("All loop images unmounted successfully")
 		}
-	} else if cas.storeMgr != nil {
-		// If using store manager, check if the underlying store is a loop store
-		if loopStore, ok := cas.storeMgr.GetStore().(*loop.Store); ok {
-			log.Info().Msg("Unmounting all loop images...")
-			if err := loopStore.UnmountAll(); err != nil {
-				log.Error().Err(err).Msg("Failed to unmount all loop images")
-				// Continue with shutdown even if unmount fails
-			} else {
-				log.Info().Msg("All loop images unmounted successfully")
-			}
-		}
 	}
 
 	// Execute sync command to flush filesystem buffers with a fresh context
@@ -149,10 +148,8 @@ func (cas *CASServer) setupRoutes() {
 	// Echo configuration
 	cas.echo.HideBanner = true
 	cas.echo.HidePort = true
-	// Setup middleware with custom logger
-	cas.echo.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Format: "${time_rfc3339} ${status} ${method} ${uri} (${latency_human})\n",
-	}))
+	// Setup middleware with request IDs and structured request logging
+	cas.echo.Use(log.Middleware())
 
 	//  The server must not gzip every response globally.
 	//  File downloads therefore return compressed bytes whenever the client advertises Accept-Encoding: gzip, i.e., default curl/wget behavior.
@@ -161,13 +158,27 @@ func (cas *CASServer) setupRoutes() {
 	// cas.echo.Use(middleware.Gzip())
 
 	cas.echo.Use(middleware.Recover())
+	cas.echo.Use(tracing.Middleware())
+	cas.echo.Use(metrics.EchoMiddleware(httpRequestsTotal, httpRequestDuration))
 
 	// Setup routes
 	cas.echo.GET("/", cas.serveSwaggerUI)
 	cas.echo.GET("/swagger.yml", cas.serveSwaggerSpec)
 	cas.echo.GET("/node/info", cas.getNodeInfo)
+	cas.echo.GET("/healthz", cas.getHealthz)
+	cas.echo.GET("/metrics", cas.getMetrics)
 	cas.echo.POST("/file/upload", cas.uploadFile)
+	cas.echo.GET("/file/list", cas.listPrefixes)
+	cas.echo.GET("/file/list/:prefix", cas.listHashes)
 	cas.echo.GET("/file/:hash/download", cas.downloadFile)
 	cas.echo.GET("/file/:hash/info", cas.getFileInfo)
 	cas.echo.DELETE("/file/:hash/delete", cas.deleteFile)
+
+	admin := cas.echo.Group("/admin", cas.adminAuth)
+	admin.GET("/mode", cas.getMode)
+	admin.PUT("/mode", cas.putMode)
+	admin.GET("/images", cas.listImages)
+	admin.POST("/images/:prefix/mount", cas.mountImage)
+	admin.POST("/images/:prefix/unmount", cas.unmountImage)
+	admin.POST("/images/:prefix/fsck", cas.fsckImage)
 }
@@ -2,6 +2,7 @@ package casd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -40,7 +41,7 @@ func NewMockStore() *MockStore {
 }
 
 // Upload implementation for mock store
-func (m *MockStore) Upload(reader io.Reader, filename string) (*models.UploadResponse, error) {
+func (m *MockStore) Upload(_ context.Context, reader io.Reader, filename string) (*models.UploadResponse, error) {
 	m.mu.RLock()
 	shouldError := m.shouldError
 	errorType := m.errorType
@@ -50,7 +51,10 @@ func (m *MockStore) Upload(reader io.Reader, filename string) (*models.UploadRes
 		return nil, store.FileExistsError{Hash: "existing"}
 	}
 
-	data, _ := io.ReadAll(reader)
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
 	hash := "abcdef1234567890abcdef1234567890abcdef1234567890abcdef1234567890"
 
 	m.mu.Lock()
@@ -68,7 +72,7 @@ func (m *MockStore) Upload(reader io.Reader, filename string) (*models.UploadRes
 }
 
 // UploadWithHash implementation for mock store
-func (m *MockStore) UploadWithHash(tempFilePath, hash, filename string) (*models.UploadResponse, error) {
+func (m *MockStore) UploadWithHash(_ context.Context, tempFilePath, hash, filename string) (*models.UploadResponse, error) {
 	m.mu.RLock()
 	shouldError := m.shouldError
 	errorType := m.errorType
@@ -99,7 +103,7 @@ func (m *MockStore) UploadWithHash(tempFilePath, hash, filename string) (*models
 }
 
 // DownloadStream implementation for mock store
-func (m *MockStore) DownloadStream(hash string) (io.ReadCloser, error) {
+func (m *MockStore) DownloadStream(_ context.Context, hash string) (io.ReadCloser, error) {
 	m.mu.RLock()
 	shouldError := m.shouldError
 	errorType := m.errorType
@@ -127,7 +131,7 @@ func (m *MockStore) DownloadStream(hash string) (io.ReadCloser, error) {
 }
 
 // GetFileInfo implementation for mock store
-func (m *MockStore) GetFileInfo(hash string) (*models.FileInfo, error) {
+func (m *MockStore) GetFileInfo(_ context.Context, hash string) (*models.FileInfo, error) {
 	m.mu.RLock()
 	shouldError := m.shouldError
 	errorType := m.errorType
@@ -154,7 +158,7 @@ func (m *MockStore) GetFileInfo(hash string) (*models.FileInfo, error) {
 }
 
 // Exists implementation for mock store
-func (m *MockStore) Exists(hash string) (bool, error) {
+func (m *MockStore) Exists(_ context.Context, hash string) (bool, error) {
 	hash = strings.ToLower(hash)
 	if !m.ValidateHash(hash) {
 		return false, store.InvalidHashError{Hash: hash}
@@ -183,7 +187,7 @@ func (m *MockStore) ValidateHash(hash string) bool {
 }
 
 // Delete implementation for mock store
-func (m *MockStore) Delete(hash string) error {
+func (m *MockStore) Delete(_ context.Context, hash string) error {
 	m.mu.RLock()
 	shouldError := m.shouldError
 	errorType := m.errorType
@@ -212,7 +216,7 @@ func (m *MockStore) Delete(hash string) error {
 }
 
 // GetDiskUsage implementation for mock store
-func (m *MockStore) GetDiskUsage(hash string) (*models.DiskUsage, error) {
+func (m *MockStore) GetDiskUsage(_ context.Context, hash string) (*models.DiskUsage, error) {
 	m.mu.RLock()
 	shouldError := m.shouldError
 	errorType := m.errorType
@@ -15,7 +15,7 @@ func (cas *CASServer) serveSwaggerUI(ctx echo.Context) error {
 	tmplPath := filepath.Join(cas.webDir, "swagger-ui.html")
 	tmpl, err := template.ParseFiles(tmplPath)
 	if err != nil {
-		log.Error().Err(err).Str("template_path", tmplPath).Msg("Failed to load template")
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Str("template_path", tmplPath).Msg("Failed to load template")
 		return ctx.String(http.StatusInternalServerError, fmt.Sprintf("Failed to load template: %v", err))
 	}
 
@@ -30,7 +30,7 @@ func (cas *CASServer) serveSwaggerUI(ctx echo.Context) error {
 	ctx.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
 	err = tmpl.Execute(ctx.Response().Writer, data)
 	if err != nil {
-		log.Error().Err(err).Str("template_path", tmplPath).Msg("Failed to execute template")
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Str("template_path", tmplPath).Msg("Failed to execute template")
 		return err
 	}
 	return nil
@@ -1,37 +1,49 @@
 package casd
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 
 	"loopfs/pkg/log"
+	"loopfs/pkg/manager"
 	"loopfs/pkg/models"
 	"loopfs/pkg/store"
+	"loopfs/pkg/tracing"
 
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
-	tempDirPerm = 0750 // Directory permissions for temp directories
+	tempDirPerm       = 0750      // Directory permissions for temp directories
+	multipartOverhead = 64 * 1024 // Allowance for multipart headers and boundaries on top of the object size
+	// Space reserved at a time for uploads of unknown length when no maximum object size is set
+	uploadReservationStep = 64 * 1024 * 1024
 )
 
 // copyAndHashToTempFile copies the reader content to a temp file while calculating SHA256 hash.
-func (cas *CASServer) copyAndHashToTempFile(src io.Reader, tempFile *os.File) (string, error) {
+func (cas *CASServer) copyAndHashToTempFile(ctx context.Context, src io.Reader, tempFile *os.File) (string, error) {
+	_, span := tracing.StartSpan(ctx, "casd.copyAndHashToTempFile")
 	hasher := sha256.New()
 	writer := io.MultiWriter(hasher, tempFile)
 
-	if _, err := io.Copy(writer, src); err != nil {
-		log.Error().Err(err).Msg("Failed to copy and hash file")
+	written, err := io.Copy(writer, src)
+	span.SetAttributes(attribute.Int64("loopfs.size", written))
+	span.End(err)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Failed to copy and hash file")
 		return "", err
 	}
 
 	hash := hex.EncodeToString(hasher.Sum(nil))
-	log.Debug().Str("hash", hash).Msg("Calculated hash for uploaded file")
+	log.Ctx(ctx).Debug().Str("hash", hash).Msg("Calculated hash for uploaded file")
 	return hash, nil
 }
 
@@ -46,7 +58,7 @@ func (cas *CASServer) ensureTempDir() error {
 
 // prepareUploadWithVerification handles the verification process for uploads when Store Manager is available.
 // Returns the hash, temp file path, and cleanup function for efficient upload.
-func (cas *CASServer) prepareUploadWithVerification(src io.Reader) (string, string, func(), error) {
+func (cas *CASServer) prepareUploadWithVerification(ctx context.Context, src io.Reader) (string, string, func(), error) {
 	// Check if store manager is available
 	if cas.storeMgr == nil {
 		return "", "", nil, errors.New("store manager not available for verification")
@@ -60,43 +72,43 @@ func (cas *CASServer) prepareUploadWithVerification(src io.Reader) (string, stri
 	// Create a temporary file in the configured temp directory
 	tempFile, err := os.CreateTemp(cas.tempDir, "upload-*.tmp")
 	if err != nil {
-		log.Error().Err(err).Str("temp_dir", cas.tempDir).Msg("Failed to create temporary file")
+		log.Ctx(ctx).Error().Err(err).Str("temp_dir", cas.tempDir).Msg("Failed to create temporary file")
 		return "", "", nil, err
 	}
 	tempPath := tempFile.Name()
 
 	cleanup := func() {
 		if removeErr := os.Remove(tempPath); removeErr != nil {
-			log.Warn().Err(removeErr).Str("temp_file", tempPath).Msg("Failed to remove temp file")
+			log.Ctx(ctx).Warn().Err(removeErr).Str("temp_file", tempPath).Msg("Failed to remove temp file")
 		}
 	}
 
 	// Copy the uploaded content to the temp file and calculate hash
-	hash, err := cas.copyAndHashToTempFile(src, tempFile)
+	hash, err := cas.copyAndHashToTempFile(ctx, src, tempFile)
 	if closeErr := tempFile.Close(); closeErr != nil {
-		log.Warn().Err(closeErr).Str("temp_file", tempPath).Msg("Failed to close temp file")
+		log.Ctx(ctx).Warn().Err(closeErr).Str("temp_file", tempPath).Msg("Failed to close temp file")
 	}
 	if err != nil {
 		cleanup()
-		log.Error().Err(err).Msg("Failed to save uploaded file to temp")
+		log.Ctx(ctx).Error().Err(err).Msg("Failed to save uploaded file to temp")
 		return "", "", nil, err
 	}
 
 	// Short-circuit: Check if file already exists before expensive VerifyBlock/ResizeBlock
 	// This avoids costly resize operations (including multi-minute rsync) for duplicate uploads
-	if exists, err := cas.storeMgr.Exists(hash); err != nil {
+	if exists, err := cas.storeMgr.Exists(ctx, hash); err != nil {
 		// Log error but continue - the UploadWithHash will catch it later
-		log.Warn().Err(err).Str("hash", hash).Msg("Failed to check file existence, continuing with verification")
+		log.Ctx(ctx).Warn().Err(err).Str("hash", hash).Msg("Failed to check file existence, continuing with verification")
 	} else if exists {
 		// File already exists, no need for space verification
-		log.Debug().Str("hash", hash).Msg("File already exists, skipping block verification")
+		log.Ctx(ctx).Debug().Str("hash", hash).Msg("File already exists, skipping block verification")
 		return hash, tempPath, cleanup, nil
 	}
 
 	// File doesn't exist or check failed - proceed with VerifyBlock to ensure space
-	if err := cas.storeMgr.VerifyBlock(tempPath, hash); err != nil {
+	if err := cas.storeMgr.VerifyBlock(ctx, tempPath, hash); err != nil {
 		cleanup()
-		log.Error().Err(err).Str("hash", hash).Msg("Failed to verify block space")
+		log.Ctx(ctx).Error().Err(err).Str("hash", hash).Msg("Failed to verify block space")
 		return "", "", nil, err
 	}
 
@@ -104,59 +116,133 @@ func (cas *CASServer) prepareUploadWithVerification(src io.Reader) (string, stri
 }
 
 func (cas *CASServer) uploadFile(ctx echo.Context) error {
-	log.Debug().Msg("File upload request received")
+	log.Ctx(ctx.Request().Context()).Debug().Msg("File upload request received")
+
+	if rejected, err := cas.rejectUpload(ctx); rejected {
+		return err
+	}
 
-	file, err := ctx.FormFile("file")
+	req := ctx.Request()
+	reserved, err := cas.reserveUpload(req.ContentLength)
 	if err != nil {
-		log.Error().Err(err).Msg("File parameter is required")
-		return ctx.JSON(http.StatusBadRequest, map[string]string{
-			"error": "file parameter is required",
-		})
+		return cas.handleUploadError(ctx, err)
 	}
+	defer reserved.release()
 
-	src, err := file.Open()
+	if cas.maxObjectSize > 0 {
+		req.Body = http.MaxBytesReader(ctx.Response(), req.Body, cas.maxObjectSize+multipartOverhead)
+	}
+
+	// The file is streamed from the request into the server temp directory, under the storage
+	// directory, instead of being parsed into a multipart form spilled to the system temp directory
+	part, err := uploadPart(req)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return cas.handleUploadError(ctx, ErrObjectTooLarge)
+	}
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to open uploaded file")
-		return ctx.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to open uploaded file",
+		log.Ctx(ctx.Request().Context()).Error().Err(err).Msg("File parameter is required")
+		return ctx.JSON(http.StatusBadRequest, map[string]string{
+			"error": "file parameter is required",
 		})
 	}
-	defer func() {
-		if err := src.Close(); err != nil {
-			log.Error().Err(err).Msg("Failed to close source file")
+	var reader io.Reader = part
+	if req.ContentLength < 0 && cas.maxObjectSize <= 0 {
+		reader = &reservingReader{
+			reader:      part,
+			reservation: reserved,
+			storageDir:  cas.storageDir,
+			step:        uploadReservationStep,
 		}
-	}()
+	}
+	src := &sizeLimitedReader{reader: reader, limit: cas.maxObjectSize}
 
-	result, err := cas.processUpload(src, file.Filename)
+	result, err := cas.processUpload(req.Context(), src, part.FileName())
+	if errors.As(err, &maxBytesErr) {
+		err = ErrObjectTooLarge
+	}
 	if err != nil {
 		return cas.handleUploadError(ctx, err)
 	}
+	observeUpload(src.read, nil)
 
 	return ctx.JSON(http.StatusOK, map[string]string{
 		"hash": result.Hash,
 	})
 }
 
+// uploadPart returns the part of a multipart upload request holding the "file" form file,
+// skipping the parts before it.
+func uploadPart(req *http.Request) (*multipart.Part, error) {
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" && part.FileName() != "" {
+			return part, nil
+		}
+	}
+}
+
+// sizeLimitedReader counts the bytes read from an upload and fails with ErrObjectTooLarge
+// once they exceed limit. A limit of zero or less means no limit.
+type sizeLimitedReader struct {
+	reader io.Reader
+	limit  int64
+	read   int64
+}
+
+// Read implements io.Reader.
+func (r *sizeLimitedReader) Read(buf []byte) (int, error) {
+	n, err := r.reader.Read(buf)
+	r.read += int64(n)
+	if r.limit > 0 && r.read > r.limit {
+		return n, ErrObjectTooLarge
+	}
+	return n, err
+}
+
 // processUpload handles the core upload logic with store manager verification.
-func (cas *CASServer) processUpload(src io.Reader, filename string) (*models.UploadResponse, error) {
+func (cas *CASServer) processUpload(ctx context.Context, src io.Reader, filename string) (response *models.UploadResponse, err error) {
+	ctx, span := tracing.StartSpan(ctx, "casd.processUpload", attribute.String("loopfs.filename", filename))
+	defer func() {
+		var fileExistsErr store.FileExistsError
+		if errors.As(err, &fileExistsErr) {
+			span.SetAttributes(attribute.Bool("loopfs.duplicate", true))
+			span.End(nil)
+			return
+		}
+		span.End(err)
+	}()
+
 	// If we have a Store Manager, use the efficient single-pass upload flow
 	if cas.storeMgr != nil {
-		hash, tempPath, cleanup, prepErr := cas.prepareUploadWithVerification(src)
+		hash, tempPath, cleanup, prepErr := cas.prepareUploadWithVerification(ctx, src)
 		if prepErr != nil {
 			return nil, prepErr
 		}
 		defer cleanup()
 
 		// Use the efficient UploadWithHash method to avoid redundant temp files and hashing
-		return cas.storeMgr.UploadWithHash(tempPath, hash, filename)
+		return cas.storeMgr.UploadWithHash(ctx, tempPath, hash, filename)
 	}
 
 	// Fallback to traditional upload flow for stores without manager
-	return cas.store.Upload(src, filename)
+	return cas.store.Upload(ctx, src, filename)
 }
 
 // handleUploadError handles different types of upload errors and returns appropriate JSON responses.
 func (cas *CASServer) handleUploadError(ctx echo.Context, err error) error {
+	observeUpload(0, err)
+
 	var fileExistsErr store.FileExistsError
 	if errors.As(err, &fileExistsErr) {
 		return ctx.JSON(http.StatusConflict, map[string]string{
@@ -170,7 +256,23 @@ func (cas *CASServer) handleUploadError(ctx echo.Context, err error) error {
 			"error": "invalid hash",
 		})
 	}
-	log.Error().Err(err).Msg("Failed to upload file")
+	if errors.Is(err, ErrObjectTooLarge) {
+		log.Ctx(ctx.Request().Context()).Warn().Int64("max_object_size", cas.maxObjectSize).Msg("Rejecting upload larger than maximum object size")
+		return ctx.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+			"error": "file exceeds maximum object size",
+		})
+	}
+	if errors.Is(err, manager.ErrReadOnly) {
+		return ctx.JSON(http.StatusServiceUnavailable, map[string]string{
+			"error": "node is read-only",
+		})
+	}
+	if errors.Is(err, ErrInsufficientStorage) || errors.Is(err, manager.ErrInsufficientCapacity) {
+		return ctx.JSON(http.StatusInsufficientStorage, map[string]string{
+			"error": "insufficient storage",
+		})
+	}
+	log.Ctx(ctx.Request().Context()).Error().Err(err).Msg("Failed to upload file")
 	return ctx.JSON(http.StatusInternalServerError, map[string]string{
 		"error": "failed to upload file",
 	})
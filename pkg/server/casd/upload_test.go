@@ -2,6 +2,7 @@ package casd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/stretchr/testify/suite"
 
+	"loopfs/pkg/manager"
 	"loopfs/pkg/models"
 	"loopfs/pkg/store"
 )
@@ -251,7 +253,7 @@ func (s *UploadTestSuite) TestCopyAndHashToTempFile() {
 		os.Remove(tempFile.Name())
 	}()
 
-	hash, err := s.server.copyAndHashToTempFile(reader, tempFile)
+	hash, err := s.server.copyAndHashToTempFile(context.Background(), reader, tempFile)
 	s.NoError(err)
 	s.NotEmpty(hash)
 	s.Len(hash, 64) // SHA256 hash should be 64 characters
@@ -274,7 +276,7 @@ func (s *UploadTestSuite) TestCopyAndHashToTempFileReadError() {
 		os.Remove(tempFile.Name())
 	}()
 
-	_, err = s.server.copyAndHashToTempFile(errorReader, tempFile)
+	_, err = s.server.copyAndHashToTempFile(context.Background(), errorReader, tempFile)
 	s.Error(err)
 	s.Equal(io.ErrUnexpectedEOF, err)
 }
@@ -286,7 +288,7 @@ func (s *UploadTestSuite) TestPrepareUploadWithVerification() {
 	reader := strings.NewReader(content)
 
 	// Test without store manager - should return error
-	hash, tempPath, cleanup, err := s.server.prepareUploadWithVerification(reader)
+	hash, tempPath, cleanup, err := s.server.prepareUploadWithVerification(context.Background(), reader)
 	s.Error(err) // Should fail without store manager
 	s.Empty(hash)
 	s.Empty(tempPath)
@@ -299,7 +301,7 @@ func (s *UploadTestSuite) TestPrepareUploadWithVerificationError() {
 	reader := strings.NewReader(content)
 
 	// Test without store manager
-	hash, tempPath, cleanup, err := s.server.prepareUploadWithVerification(reader)
+	hash, tempPath, cleanup, err := s.server.prepareUploadWithVerification(context.Background(), reader)
 	s.Error(err) // Should fail without store manager
 	s.Empty(hash)
 	s.Empty(tempPath)
@@ -318,7 +320,7 @@ func (s *UploadTestSuite) TestPrepareUploadWithVerificationReadError() {
 	errorReader := &uploadErrorReader{}
 
 	// Test with error reader
-	hash, tempPath, cleanup, err := s.server.prepareUploadWithVerification(errorReader)
+	hash, tempPath, cleanup, err := s.server.prepareUploadWithVerification(context.Background(), errorReader)
 	s.Error(err)
 	s.Empty(hash)
 	s.Empty(tempPath)
@@ -343,11 +345,11 @@ type MockStoreInvalidHash struct {
 	*MockStore
 }
 
-func (m *MockStoreInvalidHash) Upload(reader io.Reader, filename string) (*models.UploadResponse, error) {
+func (m *MockStoreInvalidHash) Upload(_ context.Context, reader io.Reader, filename string) (*models.UploadResponse, error) {
 	return nil, store.InvalidHashError{Hash: "invalid"}
 }
 
-func (m *MockStoreInvalidHash) UploadWithHash(tempFilePath, hash, filename string) (*models.UploadResponse, error) {
+func (m *MockStoreInvalidHash) UploadWithHash(_ context.Context, tempFilePath, hash, filename string) (*models.UploadResponse, error) {
 	return nil, store.InvalidHashError{Hash: "invalid"}
 }
 
@@ -386,11 +388,11 @@ type MockStoreGenericError struct {
 	*MockStore
 }
 
-func (m *MockStoreGenericError) Upload(reader io.Reader, filename string) (*models.UploadResponse, error) {
+func (m *MockStoreGenericError) Upload(_ context.Context, reader io.Reader, filename string) (*models.UploadResponse, error) {
 	return nil, io.ErrUnexpectedEOF
 }
 
-func (m *MockStoreGenericError) UploadWithHash(tempFilePath, hash, filename string) (*models.UploadResponse, error) {
+func (m *MockStoreGenericError) UploadWithHash(_ context.Context, tempFilePath, hash, filename string) (*models.UploadResponse, error) {
 	return nil, io.ErrUnexpectedEOF
 }
 
@@ -497,6 +499,87 @@ func (s *UploadTestSuite) TestUploadFileConcurrentRequests() {
 	}
 }
 
+// TestUploadFileTooLarge tests that uploads above the maximum object size are rejected
+func (s *UploadTestSuite) TestUploadFileTooLarge() {
+	s.server.SetMaxObjectSize(10)
+	defer s.server.SetMaxObjectSize(0)
+
+	body := &bytes.Buffer{}
+	body.WriteString("------WebKitFormBoundary7MA4YWxkTrZu0gW\r\n")
+	body.WriteString("Content-Disposition: form-data; name=\"file\"; filename=\"big.txt\"\r\n")
+	body.WriteString("Content-Type: text/plain\r\n\r\n")
+	body.WriteString("this content is longer than ten bytes")
+	body.WriteString("\r\n------WebKitFormBoundary7MA4YWxkTrZu0gW--\r\n")
+
+	req := httptest.NewRequest(http.MethodPost, "/file/upload", body)
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=----WebKitFormBoundary7MA4YWxkTrZu0gW")
+
+	rec := httptest.NewRecorder()
+	c := s.server.echo.NewContext(req, rec)
+
+	err := s.server.uploadFile(c)
+	s.NoError(err)
+	s.Equal(http.StatusRequestEntityTooLarge, rec.Code)
+	s.Contains(rec.Body.String(), "maximum object size")
+	s.Equal(uint64(0), s.server.reservationInfo().ReservedBytes)
+}
+
+// TestUploadFileUnknownLength tests uploads of unknown length with and without a maximum object size
+func (s *UploadTestSuite) TestUploadFileUnknownLength() {
+	newRequest := func() *http.Request {
+		body := &bytes.Buffer{}
+		body.WriteString("------WebKitFormBoundary7MA4YWxkTrZu0gW\r\n")
+		body.WriteString("Content-Disposition: form-data; name=\"note\"\r\n\r\n")
+		body.WriteString("streamed")
+		body.WriteString("\r\n------WebKitFormBoundary7MA4YWxkTrZu0gW\r\n")
+		body.WriteString("Content-Disposition: form-data; name=\"file\"; filename=\"chunked.txt\"\r\n")
+		body.WriteString("Content-Type: text/plain\r\n\r\n")
+		body.WriteString("chunked content")
+		body.WriteString("\r\n------WebKitFormBoundary7MA4YWxkTrZu0gW--\r\n")
+
+		req := httptest.NewRequest(http.MethodPost, "/file/upload", body)
+		req.Header.Set("Content-Type", "multipart/form-data; boundary=----WebKitFormBoundary7MA4YWxkTrZu0gW")
+		req.ContentLength = -1
+		return req
+	}
+
+	rec := httptest.NewRecorder()
+	s.Require().NoError(s.server.uploadFile(s.server.echo.NewContext(newRequest(), rec)))
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(uint64(0), s.server.reservationInfo().ReservedBytes)
+
+	s.server.SetMaxObjectSize(1024)
+	defer s.server.SetMaxObjectSize(0)
+	rec = httptest.NewRecorder()
+	s.Require().NoError(s.server.uploadFile(s.server.echo.NewContext(newRequest(), rec)))
+	s.Equal(http.StatusOK, rec.Code)
+	s.Equal(uint64(0), s.server.reservationInfo().ReservedBytes)
+}
+
+// TestUploadFileInsufficientStorageError tests the response for uploads the node cannot hold
+func (s *UploadTestSuite) TestUploadFileInsufficientStorageError() {
+	req := httptest.NewRequest(http.MethodPost, "/file/upload", nil)
+	rec := httptest.NewRecorder()
+	c := s.server.echo.NewContext(req, rec)
+
+	err := s.server.handleUploadError(c, ErrInsufficientStorage)
+	s.NoError(err)
+	s.Equal(http.StatusInsufficientStorage, rec.Code)
+	s.Contains(rec.Body.String(), "insufficient storage")
+}
+
+// TestUploadFileReadOnlyError tests the response for uploads to a node above its high-water mark
+func (s *UploadTestSuite) TestUploadFileReadOnlyError() {
+	req := httptest.NewRequest(http.MethodPost, "/file/upload", nil)
+	rec := httptest.NewRecorder()
+	c := s.server.echo.NewContext(req, rec)
+
+	err := s.server.handleUploadError(c, manager.ErrReadOnly)
+	s.NoError(err)
+	s.Equal(http.StatusServiceUnavailable, rec.Code)
+	s.Contains(rec.Body.String(), "read-only")
+}
+
 // TestUploadSuite runs the upload test suite
 func TestUploadSuite(t *testing.T) {
 	suite.Run(t, new(UploadTestSuite))
@@ -0,0 +1,34 @@
+package loop
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+
+	"loopfs/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// runCommand runs an external command inside a span named after the executable, started as a
+// child of the span in ctx.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	_, span := tracing.StartSpan(ctx, "exec "+filepath.Base(cmd.Args[0]),
+		attribute.StringSlice("process.command_args", cmd.Args))
+	err := cmd.Run()
+	if cmd.ProcessState != nil {
+		span.SetAttributes(attribute.Int("process.exit.code", cmd.ProcessState.ExitCode()))
+	}
+	span.End(err)
+	return err
+}
+
+// runCommandCombinedOutput runs an external command like runCommand and returns its combined output.
+func runCommandCombinedOutput(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := runCommand(ctx, cmd)
+	return output.Bytes(), err
+}
@@ -1,6 +1,8 @@
 package loop
 
 import (
+	"context"
+	"errors"
 	"os"
 	"strings"
 
@@ -10,7 +12,7 @@ import (
 
 // Delete removes a file with the given hash from storage.
 // Optimized to use a single mount operation instead of separate existence check and delete.
-func (s *Store) Delete(hash string) error {
+func (s *Store) Delete(ctx context.Context, hash string) error {
 	hash = strings.ToLower(hash)
 	if !s.ValidateHash(hash) {
 		log.Debug().Str("hash", hash).Msg("Invalid hash format for delete")
@@ -33,8 +35,13 @@ func (s *Store) Delete(hash string) error {
 	}
 
 	// Use withMountedLoopUnlocked since we already hold the lock
-	return s.withMountedLoopUnlocked(hash, func() error {
+	return s.withMountedLoopUnlocked(ctx, hash, func() error {
 		filePath, err := s.findFileInLoop(hash)
+		var notFoundErr store.FileNotFoundError
+		if errors.As(err, &notFoundErr) {
+			// Small blobs may live in the image pack instead of their own file
+			return s.deletePackedWithinMountedLoop(hash)
+		}
 		if err != nil {
 			// If findFileInLoop fails, it likely means file doesn't exist
 			if os.IsNotExist(err) {
@@ -1,6 +1,7 @@
 package loop
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -51,14 +52,14 @@ func (s *DeleteTestSuite) TearDownTest() {
 
 // TestDeleteInvalidHash tests Delete with invalid hash
 func (s *DeleteTestSuite) TestDeleteInvalidHash() {
-	err := s.store.Delete("invalid")
+	err := s.store.Delete(context.Background(), "invalid")
 	s.Error(err)
 	s.IsType(store.InvalidHashError{}, err)
 }
 
 // TestDeleteFileNotFound tests Delete when file doesn't exist
 func (s *DeleteTestSuite) TestDeleteFileNotFound() {
-	err := s.store.Delete(s.testHash)
+	err := s.store.Delete(context.Background(), s.testHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err)
 }
@@ -68,7 +69,7 @@ func (s *DeleteTestSuite) TestDeleteCaseInsensitive() {
 	upperHash := "A1B2C3D4E5F67890123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0"
 
 	// Should normalize to lowercase and then check existence
-	err := s.store.Delete(upperHash)
+	err := s.store.Delete(context.Background(), upperHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err) // File doesn't exist, not invalid hash
 }
@@ -89,7 +90,7 @@ func (s *DeleteTestSuite) TestDeleteHashValidation() {
 
 	for _, tc := range testCases {
 		s.Run(tc.name, func() {
-			err := s.store.Delete(tc.hash)
+			err := s.store.Delete(context.Background(), tc.hash)
 			s.Error(err)
 			s.IsType(tc.errorType, err)
 		})
@@ -106,7 +107,7 @@ func (s *DeleteTestSuite) TestDeleteExistsError() {
 
 		restrictedStore := NewWithDefaults(restrictedDir, 10)
 
-		err = restrictedStore.Delete(s.testHash)
+		err = restrictedStore.Delete(context.Background(), s.testHash)
 		s.Error(err)
 		// Should propagate the error from Exists
 		s.Contains(err.Error(), "permission denied")
@@ -127,7 +128,7 @@ func (s *DeleteTestSuite) TestDeleteWithLoopFileButNoTargetFile() {
 	s.NoError(err)
 
 	// Delete should fail because file doesn't exist (Exists will return false)
-	err = s.store.Delete(s.testHash)
+	err = s.store.Delete(context.Background(), s.testHash)
 	// In test environment, this might fail differently due to mount issues
 	s.Error(err)
 }
@@ -150,7 +151,7 @@ func (s *DeleteTestSuite) TestDeleteSuccessfulDeletion() {
 	s.NoError(err)
 
 	// This will likely fail in test environment due to mounting issues
-	err = s.store.Delete(s.testHash)
+	err = s.store.Delete(context.Background(), s.testHash)
 	s.Error(err) // Expected to fail in test environment
 	s.T().Logf("Delete failed as expected in test environment: %v", err)
 }
@@ -164,7 +165,7 @@ func (s *DeleteTestSuite) TestDeleteConcurrentAccess() {
 			defer func() { done <- true }()
 
 			// Each goroutine tries to delete the same file
-			err := s.store.Delete(s.testHash)
+			err := s.store.Delete(context.Background(), s.testHash)
 			// Should fail with FileNotFoundError
 			s.Error(err)
 			s.T().Logf("Goroutine %d: Delete failed as expected: %v", index, err)
@@ -187,7 +188,7 @@ func (s *DeleteTestSuite) TestDeleteDifferentHashes() {
 
 	for _, hash := range testHashes {
 		s.Run("delete_"+hash[:8], func() {
-			err := s.store.Delete(hash)
+			err := s.store.Delete(context.Background(), hash)
 			s.Error(err)
 			s.IsType(store.FileNotFoundError{}, err)
 		})
@@ -208,7 +209,7 @@ func (s *DeleteTestSuite) TestDeleteWithMountError() {
 
 	// Create a mock file that claims to exist but will cause issues during mount
 	// We can't easily create this scenario without more complex mocking
-	err = s.store.Delete(s.testHash)
+	err = s.store.Delete(context.Background(), s.testHash)
 	s.Error(err)
 	s.T().Logf("Delete failed as expected: %v", err)
 }
@@ -246,7 +247,7 @@ func (s *DeleteTestSuite) TestDeleteErrorHandling() {
 	for _, tc := range testCases {
 		s.Run(tc.name, func() {
 			hash := tc.setupFunc()
-			err := s.store.Delete(hash)
+			err := s.store.Delete(context.Background(), hash)
 			if tc.expectErr {
 				s.Error(err)
 			} else {
@@ -269,12 +270,12 @@ func (s *DeleteTestSuite) TestDeleteInterface() {
 // TestDeleteLogMessages tests that appropriate log messages are generated
 func (s *DeleteTestSuite) TestDeleteLogMessages() {
 	// Test with invalid hash - should generate debug log
-	err := s.store.Delete("invalid")
+	err := s.store.Delete(context.Background(), "invalid")
 	s.Error(err)
 	s.IsType(store.InvalidHashError{}, err)
 
 	// Test with valid but non-existent hash - should generate debug log
-	err = s.store.Delete(s.testHash)
+	err = s.store.Delete(context.Background(), s.testHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err)
 }
@@ -299,7 +300,7 @@ func (s *DeleteTestSuite) TestDeletePanicRecovery() {
 			}()
 
 			// Should not panic, may error
-			_ = s.store.Delete(input)
+			_ = s.store.Delete(context.Background(), input)
 		})
 	}
 }
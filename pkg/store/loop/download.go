@@ -1,10 +1,13 @@
 package loop
 
 import (
+	"context"
+	"errors"
 	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"loopfs/pkg/log"
 	"loopfs/pkg/store"
@@ -13,14 +16,34 @@ import (
 // streamingReader is a ReadCloser that manages the mount lifecycle for streaming downloads.
 type streamingReader struct {
 	file       *os.File
+	reader     io.Reader // Optional reader limited to a packed blob; reads go to file when nil
 	store      *Store
 	hash       string
 	mountPoint string
 	resizeLock *sync.RWMutex // Hold resize read lock for the duration of streaming
+	openedAt   time.Time
+}
+
+// newStreamingReader creates a streaming reader and counts it as an open stream.
+func (s *Store) newStreamingReader(file *os.File, reader io.Reader, hash, mountPoint string,
+	resizeLock *sync.RWMutex) *streamingReader {
+	activeStreams.Inc()
+	return &streamingReader{
+		file:       file,
+		reader:     reader,
+		store:      s,
+		hash:       hash,
+		mountPoint: mountPoint,
+		resizeLock: resizeLock,
+		openedAt:   time.Now(),
+	}
 }
 
 // Read implements io.Reader.
 func (sr *streamingReader) Read(p []byte) (n int, err error) {
+	if sr.reader != nil {
+		return sr.reader.Read(p)
+	}
 	return sr.file.Read(p)
 }
 
@@ -43,12 +66,14 @@ func (sr *streamingReader) Close() error {
 		sr.resizeLock.RUnlock()
 	}
 
+	activeStreams.Dec()
+	streamDuration.Observe(time.Since(sr.openedAt).Seconds())
 	return fileErr
 }
 
 // DownloadStream retrieves a file by its hash and returns a streaming reader.
 // The caller must call Close() on the returned reader to clean up resources.
-func (s *Store) DownloadStream(hash string) (io.ReadCloser, error) {
+func (s *Store) DownloadStream(ctx context.Context, hash string) (io.ReadCloser, error) {
 	hash = strings.ToLower(hash)
 	if !s.ValidateHash(hash) {
 		log.Error().Str("hash", hash).Msg("Invalid hash format")
@@ -75,12 +100,12 @@ func (s *Store) DownloadStream(hash string) (io.ReadCloser, error) {
 	}
 
 	// Ensure a loop file exists and create if needed
-	if err := s.ensureLoopFileExistsUnlocked(hash); err != nil {
+	if err := s.ensureLoopFileExistsUnlocked(ctx, hash); err != nil {
 		resizeLock.RUnlock()
 		return nil, err
 	}
 
-	if err := s.prepareMountForStreaming(hash, mountPoint); err != nil {
+	if err := s.prepareMountForStreaming(ctx, hash, mountPoint); err != nil {
 		resizeLock.RUnlock()
 		return nil, err
 	}
@@ -89,7 +114,7 @@ func (s *Store) DownloadStream(hash string) (io.ReadCloser, error) {
 }
 
 // ensureLoopFileExistsUnlocked handles loop file creation assuming resize lock is already held.
-func (s *Store) ensureLoopFileExistsUnlocked(hash string) error {
+func (s *Store) ensureLoopFileExistsUnlocked(ctx context.Context, hash string) error {
 	loopFilePath := s.getLoopFilePath(hash)
 
 	// Get per-loop-file mutex to synchronize creation
@@ -99,7 +124,7 @@ func (s *Store) ensureLoopFileExistsUnlocked(hash string) error {
 
 	// Check if loop file exists, create if not (synchronized)
 	if _, err := os.Stat(loopFilePath); os.IsNotExist(err) {
-		if err := s.createLoopFile(hash); err != nil {
+		if err := s.createLoopFile(ctx, hash); err != nil {
 			return err
 		}
 	} else if err != nil {
@@ -112,11 +137,11 @@ func (s *Store) ensureLoopFileExistsUnlocked(hash string) error {
 }
 
 // prepareMountForStreaming handles mounting with reference counting.
-func (s *Store) prepareMountForStreaming(hash, mountPoint string) error {
+func (s *Store) prepareMountForStreaming(ctx context.Context, hash, mountPoint string) error {
 	// Increment reference count - mount only if this is the first reference
 	shouldMount := s.incrementRefCount(mountPoint)
 	if shouldMount {
-		if err := s.mountLoopFile(hash); err != nil {
+		if err := s.mountLoopFile(ctx, hash); err != nil {
 			s.signalMountReady(mountPoint, err)
 			// If mount fails, decrement the reference count we just added
 			s.decrementRefCount(mountPoint)
@@ -136,6 +161,10 @@ func (s *Store) prepareMountForStreaming(hash, mountPoint string) error {
 func (s *Store) openStreamingReaderWithLock(hash, mountPoint string, resizeLock *sync.RWMutex) (io.ReadCloser, error) {
 	// Find and open the file within the mounted loop filesystem
 	filePath, err := s.findFileInLoop(hash)
+	var notFoundErr store.FileNotFoundError
+	if errors.As(err, &notFoundErr) {
+		return s.openPackedStreamingReader(hash, mountPoint, resizeLock)
+	}
 	if err != nil {
 		s.cleanupAfterErrorWithLock(mountPoint, resizeLock)
 		log.Debug().Str("hash", hash).Msg("File not found in loop")
@@ -153,13 +182,21 @@ func (s *Store) openStreamingReaderWithLock(hash, mountPoint string, resizeLock
 	log.Debug().Str("hash", hash).Str("file_path", filePath).Msg("Started streaming download")
 
 	// Return the streaming reader that will manage cleanup and lock release
-	return &streamingReader{
-		file:       file,
-		store:      s,
-		hash:       hash,
-		mountPoint: mountPoint,
-		resizeLock: resizeLock,
-	}, nil
+	return s.newStreamingReader(file, nil, hash, mountPoint, resizeLock), nil
+}
+
+// openPackedStreamingReader creates the streaming reader for a blob stored in the image pack.
+func (s *Store) openPackedStreamingReader(hash, mountPoint string, resizeLock *sync.RWMutex) (io.ReadCloser, error) {
+	file, reader, err := s.openPackedReader(hash)
+	if err != nil {
+		s.cleanupAfterErrorWithLock(mountPoint, resizeLock)
+		log.Debug().Err(err).Str("hash", hash).Msg("File not found in loop")
+		return nil, err
+	}
+
+	log.Debug().Str("hash", hash).Str("pack_file", file.Name()).Msg("Started streaming packed download")
+
+	return s.newStreamingReader(file, reader, hash, mountPoint, resizeLock), nil
 }
 
 // cleanupAfterErrorWithLock handles cleanup when streaming setup fails, including lock release.
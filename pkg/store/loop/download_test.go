@@ -1,6 +1,7 @@
 package loop
 
 import (
+	"context"
 	"io"
 	"os"
 	"path/filepath"
@@ -53,7 +54,7 @@ func (s *DownloadTestSuite) TearDownTest() {
 
 // TestDownloadStreamInvalidHash tests DownloadStream with invalid hash
 func (s *DownloadTestSuite) TestDownloadStreamInvalidHash() {
-	reader, err := s.store.DownloadStream("invalid")
+	reader, err := s.store.DownloadStream(context.Background(), "invalid")
 	s.Error(err)
 	s.Nil(reader)
 	s.IsType(store.InvalidHashError{}, err)
@@ -61,7 +62,7 @@ func (s *DownloadTestSuite) TestDownloadStreamInvalidHash() {
 
 // TestDownloadStreamNoLoopFile tests DownloadStream when loop file doesn't exist
 func (s *DownloadTestSuite) TestDownloadStreamNoLoopFile() {
-	reader, err := s.store.DownloadStream(s.testHash)
+	reader, err := s.store.DownloadStream(context.Background(), s.testHash)
 	s.Error(err)
 	s.Nil(reader)
 	s.IsType(store.FileNotFoundError{}, err)
@@ -71,7 +72,7 @@ func (s *DownloadTestSuite) TestDownloadStreamNoLoopFile() {
 func (s *DownloadTestSuite) TestDownloadStreamCaseInsensitive() {
 	upperHash := "A1B2C3D4E5F67890123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0"
 
-	reader, err := s.store.DownloadStream(upperHash)
+	reader, err := s.store.DownloadStream(context.Background(), upperHash)
 	s.Error(err)
 	s.Nil(reader)
 	s.IsType(store.FileNotFoundError{}, err)
@@ -100,7 +101,7 @@ func (s *DownloadTestSuite) TestDownloadStreamWithLoopFileButNoTargetFile() {
 	s.NoError(err)
 
 	// DownloadStream should fail because file doesn't exist in loop
-	reader, err := s.store.DownloadStream(s.testHash)
+	reader, err := s.store.DownloadStream(context.Background(), s.testHash)
 	s.Error(err)
 	s.Nil(reader)
 	s.T().Logf("DownloadStream failed as expected: %v", err)
@@ -188,7 +189,7 @@ func (s *DownloadTestSuite) TestStreamingReaderCloseWithoutFile() {
 // TestEnsureLoopFileExistsUnlocked tests ensureLoopFileExistsUnlocked helper function
 func (s *DownloadTestSuite) TestEnsureLoopFileExistsUnlocked() {
 	// Test with non-existent loop file - will try to create it
-	err := s.store.ensureLoopFileExistsUnlocked(s.testHash)
+	err := s.store.ensureLoopFileExistsUnlocked(context.Background(), s.testHash)
 	// May succeed or fail depending on test environment
 	if err != nil {
 		s.T().Logf("ensureLoopFileExistsUnlocked failed as expected: %v", err)
@@ -200,7 +201,7 @@ func (s *DownloadTestSuite) TestPrepareMountForStreaming() {
 	mountPoint := s.store.getMountPoint(s.testHash)
 
 	// This will likely fail in test environment due to mount issues
-	err := s.store.prepareMountForStreaming(s.testHash, mountPoint)
+	err := s.store.prepareMountForStreaming(context.Background(), s.testHash, mountPoint)
 	s.Error(err) // Expected to fail in test environment
 	s.T().Logf("prepareMountForStreaming failed as expected: %v", err)
 }
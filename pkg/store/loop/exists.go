@@ -1,6 +1,7 @@
 package loop
 
 import (
+	"context"
 	"os"
 	"strings"
 
@@ -8,7 +9,7 @@ import (
 )
 
 // Exists checks if a file with the given hash exists in storage.
-func (s *Store) Exists(hash string) (bool, error) {
+func (s *Store) Exists(ctx context.Context, hash string) (bool, error) {
 	hash = strings.ToLower(hash)
 	if !s.ValidateHash(hash) {
 		return false, store.InvalidHashError{Hash: hash}
@@ -31,7 +32,7 @@ func (s *Store) Exists(hash string) (bool, error) {
 
 	var exists bool
 	// Use withMountedLoopUnlocked since we already hold the resize lock
-	err := s.withMountedLoopUnlocked(hash, func() error {
+	err := s.withMountedLoopUnlocked(ctx, hash, func() error {
 		filePath := s.getFilePath(hash)
 		if filePath == "" {
 			return store.InvalidHashError{Hash: hash}
@@ -39,8 +40,9 @@ func (s *Store) Exists(hash string) (bool, error) {
 
 		_, err := os.Stat(filePath)
 		if os.IsNotExist(err) {
-			exists = false
-			return nil
+			// Small blobs may live in the image pack instead of their own file
+			_, exists, err = s.packedEntry(hash)
+			return err
 		}
 		if err != nil {
 			return err
@@ -1,6 +1,7 @@
 package loop
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -51,7 +52,7 @@ func (s *ExistsTestSuite) TearDownTest() {
 
 // TestExistsInvalidHash tests Exists with invalid hash
 func (s *ExistsTestSuite) TestExistsInvalidHash() {
-	exists, err := s.store.Exists("invalid")
+	exists, err := s.store.Exists(context.Background(), "invalid")
 	s.Error(err)
 	s.False(exists)
 	s.IsType(store.InvalidHashError{}, err)
@@ -59,7 +60,7 @@ func (s *ExistsTestSuite) TestExistsInvalidHash() {
 
 // TestExistsNoLoopFile tests Exists when loop file doesn't exist
 func (s *ExistsTestSuite) TestExistsNoLoopFile() {
-	exists, err := s.store.Exists(s.testHash)
+	exists, err := s.store.Exists(context.Background(), s.testHash)
 	s.NoError(err)
 	s.False(exists)
 }
@@ -76,7 +77,7 @@ func (s *ExistsTestSuite) TestExistsLoopFileExistsButFileDoesNot() {
 	s.NoError(err)
 
 	// Test exists - should return false but no error
-	exists, err := s.store.Exists(s.testHash)
+	exists, err := s.store.Exists(context.Background(), s.testHash)
 	// This will likely fail in test environment due to mount issues, but should not panic
 	if err != nil {
 		s.T().Logf("Exists failed as expected in test environment: %v", err)
@@ -96,7 +97,7 @@ func (s *ExistsTestSuite) TestExistsStatError() {
 		// Change the store to point to the restricted directory
 		restrictedStore := NewWithDefaults(restrictedDir, 10)
 
-		exists, err := restrictedStore.Exists(s.testHash)
+		exists, err := restrictedStore.Exists(context.Background(), s.testHash)
 		s.Error(err)
 		s.False(exists)
 		s.Contains(err.Error(), "permission denied")
@@ -110,7 +111,7 @@ func (s *ExistsTestSuite) TestExistsCaseInsensitive() {
 	upperHash := "A1B2C3D4E5F67890123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0"
 
 	// Should not error because hash is converted to lowercase internally
-	exists, err := s.store.Exists(upperHash)
+	exists, err := s.store.Exists(context.Background(), upperHash)
 	s.NoError(err)
 	s.False(exists) // File doesn't exist, but no validation error
 }
@@ -119,7 +120,7 @@ func (s *ExistsTestSuite) TestExistsCaseInsensitive() {
 func (s *ExistsTestSuite) TestExistsHashTooShort() {
 	shortHash := "abc123" // Less than minimum required
 
-	exists, err := s.store.Exists(shortHash)
+	exists, err := s.store.Exists(context.Background(), shortHash)
 	s.Error(err)
 	s.False(exists)
 	s.IsType(store.InvalidHashError{}, err)
@@ -130,7 +131,7 @@ func (s *ExistsTestSuite) TestExistsValidHashMinimumLength() {
 	// Create a 64-character hash (minimum for SHA256)
 	validHash := "abcd123456789012345678901234567890123456789012345678901234567890"
 
-	exists, err := s.store.Exists(validHash)
+	exists, err := s.store.Exists(context.Background(), validHash)
 	s.NoError(err)  // Should not error on validation
 	s.False(exists) // File doesn't exist
 }
@@ -144,7 +145,7 @@ func (s *ExistsTestSuite) TestExistsConcurrentAccess() {
 			defer func() { done <- true }()
 
 			// Each goroutine tries Exists operation
-			exists, err := s.store.Exists(s.testHash)
+			exists, err := s.store.Exists(context.Background(), s.testHash)
 			// Either succeeds with false or fails gracefully
 			if err != nil {
 				s.T().Logf("Goroutine %d: Exists failed as expected: %v", index, err)
@@ -179,7 +180,7 @@ func (s *ExistsTestSuite) TestExistsWithMockLoopFile() {
 	s.NoError(err)
 
 	// Test exists - this will likely fail in test environment but should fail gracefully
-	exists, err := s.store.Exists(s.testHash)
+	exists, err := s.store.Exists(context.Background(), s.testHash)
 	if err != nil {
 		s.T().Logf("Exists with mock loop file failed as expected: %v", err)
 	} else {
@@ -205,7 +206,7 @@ func (s *ExistsTestSuite) TestExistsHashValidation() {
 
 	for _, tc := range testCases {
 		s.Run(tc.name, func() {
-			exists, err := s.store.Exists(tc.hash)
+			exists, err := s.store.Exists(context.Background(), tc.hash)
 			if tc.expectError {
 				s.Error(err)
 				s.False(exists)
@@ -242,7 +243,7 @@ func (s *ExistsTestSuite) TestExistsWithValidButNonExistentPath() {
 	err = os.WriteFile(loopFile, []byte("test"), 0644)
 	s.NoError(err)
 
-	exists, err := s.store.Exists(minimumHash)
+	exists, err := s.store.Exists(context.Background(), minimumHash)
 	// Should either fail due to mount issues or return false
 	if err != nil {
 		s.T().Logf("Exists failed as expected: %v", err)
@@ -262,7 +263,7 @@ func (s *ExistsTestSuite) TestExistsErrorRecovery() {
 
 	for _, hash := range testHashes {
 		s.Run("error_recovery_"+hash[:8], func() {
-			exists, err := s.store.Exists(hash)
+			exists, err := s.store.Exists(context.Background(), hash)
 			// Should either succeed with false or fail gracefully
 			if err != nil {
 				s.T().Logf("Exists failed for hash %s: %v", hash[:8], err)
@@ -1,6 +1,7 @@
 package loop
 
 import (
+	"context"
 	"os"
 	"strings"
 	"syscall"
@@ -11,7 +12,7 @@ import (
 )
 
 // GetDiskUsage returns disk space information for a specific file's loop filesystem.
-func (s *Store) GetDiskUsage(hash string) (*models.DiskUsage, error) {
+func (s *Store) GetDiskUsage(ctx context.Context, hash string) (*models.DiskUsage, error) {
 	hash = strings.ToLower(hash)
 
 	// Validate hash
@@ -38,7 +39,7 @@ func (s *Store) GetDiskUsage(hash string) (*models.DiskUsage, error) {
 	var diskUsage *models.DiskUsage
 
 	// Use withMountedLoopUnlocked since we already hold the resize lock
-	err := s.withMountedLoopUnlocked(hash, func() error {
+	err := s.withMountedLoopUnlocked(ctx, hash, func() error {
 		mountPoint := s.getMountPoint(hash)
 
 		// Get filesystem statistics for this mount point
@@ -1,6 +1,8 @@
 package loop
 
 import (
+	"context"
+	"errors"
 	"os"
 	"strings"
 
@@ -10,7 +12,7 @@ import (
 )
 
 // GetFileInfo retrieves metadata about a stored file.
-func (s *Store) GetFileInfo(hash string) (*models.FileInfo, error) {
+func (s *Store) GetFileInfo(ctx context.Context, hash string) (*models.FileInfo, error) {
 	hash = strings.ToLower(hash)
 	if !s.ValidateHash(hash) {
 		log.Error().Str("hash", hash).Msg("Invalid hash format")
@@ -35,8 +37,13 @@ func (s *Store) GetFileInfo(hash string) (*models.FileInfo, error) {
 
 	var fileInfo *models.FileInfo
 	// Use withMountedLoopUnlocked since we already hold the resize lock
-	err := s.withMountedLoopUnlocked(hash, func() error {
+	err := s.withMountedLoopUnlocked(ctx, hash, func() error {
 		filePath, err := s.findFileInLoop(hash)
+		var notFoundErr store.FileNotFoundError
+		if errors.As(err, &notFoundErr) {
+			fileInfo, err = s.packedFileInfo(hash)
+			return err
+		}
 		if err != nil {
 			log.Debug().Str("hash", hash).Msg("File not found in loop")
 			return err
@@ -64,3 +71,22 @@ func (s *Store) GetFileInfo(hash string) (*models.FileInfo, error) {
 
 	return fileInfo, nil
 }
+
+// packedFileInfo builds file metadata for a blob stored in the image pack of an already-mounted loop filesystem.
+func (s *Store) packedFileInfo(hash string) (*models.FileInfo, error) {
+	entry, found, err := s.packedEntry(hash)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		log.Debug().Str("hash", hash).Msg("File not found in loop")
+		return nil, store.FileNotFoundError{Hash: hash}
+	}
+
+	log.Debug().Str("hash", hash).Int64("size", entry.size).Msg("Packed file info retrieved")
+	return &models.FileInfo{
+		Hash:      hash,
+		Size:      entry.size,
+		CreatedAt: entry.createdAt,
+	}, nil
+}
@@ -1,6 +1,7 @@
 package loop
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -53,7 +54,7 @@ func (s *GetFileInfoTestSuite) TearDownTest() {
 
 // TestGetFileInfoInvalidHash tests GetFileInfo with invalid hash
 func (s *GetFileInfoTestSuite) TestGetFileInfoInvalidHash() {
-	fileInfo, err := s.store.GetFileInfo("invalid")
+	fileInfo, err := s.store.GetFileInfo(context.Background(), "invalid")
 	s.Error(err)
 	s.Nil(fileInfo)
 	s.IsType(store.InvalidHashError{}, err)
@@ -61,7 +62,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoInvalidHash() {
 
 // TestGetFileInfoNoLoopFile tests GetFileInfo when loop file doesn't exist
 func (s *GetFileInfoTestSuite) TestGetFileInfoNoLoopFile() {
-	fileInfo, err := s.store.GetFileInfo(s.testHash)
+	fileInfo, err := s.store.GetFileInfo(context.Background(), s.testHash)
 	s.Error(err)
 	s.Nil(fileInfo)
 	s.IsType(store.FileNotFoundError{}, err)
@@ -71,7 +72,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoNoLoopFile() {
 func (s *GetFileInfoTestSuite) TestGetFileInfoCaseInsensitive() {
 	upperHash := "A1B2C3D4E5F67890123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0"
 
-	fileInfo, err := s.store.GetFileInfo(upperHash)
+	fileInfo, err := s.store.GetFileInfo(context.Background(), upperHash)
 	s.Error(err)
 	s.Nil(fileInfo)
 	s.IsType(store.FileNotFoundError{}, err) // Should normalize hash but file doesn't exist
@@ -93,7 +94,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoHashValidation() {
 
 	for _, tc := range testCases {
 		s.Run(tc.name, func() {
-			fileInfo, err := s.store.GetFileInfo(tc.hash)
+			fileInfo, err := s.store.GetFileInfo(context.Background(), tc.hash)
 			s.Error(err)
 			s.Nil(fileInfo)
 			s.IsType(tc.errorType, err)
@@ -110,7 +111,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoStatError() {
 
 		restrictedStore := NewWithDefaults(restrictedDir, 10)
 
-		fileInfo, err := restrictedStore.GetFileInfo(s.testHash)
+		fileInfo, err := restrictedStore.GetFileInfo(context.Background(), s.testHash)
 		s.Error(err)
 		s.Nil(fileInfo)
 		s.Contains(err.Error(), "permission denied")
@@ -131,7 +132,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoLoopFileExistsButFileDoesNot() {
 	s.NoError(err)
 
 	// GetFileInfo should fail because the actual file doesn't exist in the loop
-	fileInfo, err := s.store.GetFileInfo(s.testHash)
+	fileInfo, err := s.store.GetFileInfo(context.Background(), s.testHash)
 	s.Error(err)
 	s.Nil(fileInfo)
 	// Will likely fail due to mount issues in test environment
@@ -156,7 +157,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoWithMockFileSystem() {
 	s.NoError(err)
 
 	// This will likely fail in test environment due to mounting issues
-	fileInfo, err := s.store.GetFileInfo(s.testHash)
+	fileInfo, err := s.store.GetFileInfo(context.Background(), s.testHash)
 	s.Error(err) // Expected to fail in test environment
 	s.Nil(fileInfo)
 	s.T().Logf("GetFileInfo with mock failed as expected: %v", err)
@@ -165,7 +166,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoWithMockFileSystem() {
 // TestGetFileInfoReturnType tests the structure of returned FileInfo
 func (s *GetFileInfoTestSuite) TestGetFileInfoReturnType() {
 	// Even though we can't get a successful result, test that the error handling is correct
-	fileInfo, err := s.store.GetFileInfo(s.testHash)
+	fileInfo, err := s.store.GetFileInfo(context.Background(), s.testHash)
 	s.Error(err)
 	s.Nil(fileInfo)
 
@@ -189,7 +190,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoConcurrentAccess() {
 		go func(index int) {
 			defer func() { done <- true }()
 
-			fileInfo, err := s.store.GetFileInfo(s.testHash)
+			fileInfo, err := s.store.GetFileInfo(context.Background(), s.testHash)
 			s.Error(err) // Should fail because file doesn't exist
 			s.Nil(fileInfo)
 			s.T().Logf("Goroutine %d: GetFileInfo failed as expected: %v", index, err)
@@ -212,7 +213,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoDifferentHashes() {
 
 	for _, hash := range testHashes {
 		s.Run("get_file_info_"+hash[:8], func() {
-			fileInfo, err := s.store.GetFileInfo(hash)
+			fileInfo, err := s.store.GetFileInfo(context.Background(), hash)
 			s.Error(err)
 			s.Nil(fileInfo)
 			s.IsType(store.FileNotFoundError{}, err)
@@ -232,7 +233,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoErrorPropagation() {
 	err = os.WriteFile(loopFile, []byte(""), 0644)
 	s.NoError(err)
 
-	fileInfo, err := s.store.GetFileInfo(s.testHash)
+	fileInfo, err := s.store.GetFileInfo(context.Background(), s.testHash)
 	s.Error(err)
 	s.Nil(fileInfo)
 	// Error should be propagated from withMountedLoop
@@ -249,7 +250,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoInterface() {
 func (s *GetFileInfoTestSuite) TestGetFileInfoHashNormalization() {
 	mixedCaseHash := "A1b2C3d4E5f67890123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0"
 
-	fileInfo, err := s.store.GetFileInfo(mixedCaseHash)
+	fileInfo, err := s.store.GetFileInfo(context.Background(), mixedCaseHash)
 	s.Error(err) // File doesn't exist
 	s.Nil(fileInfo)
 	s.IsType(store.FileNotFoundError{}, err) // Not InvalidHashError
@@ -292,7 +293,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoErrorHandling() {
 	for _, tc := range testCases {
 		s.Run(tc.name, func() {
 			hash := tc.setupFunc()
-			fileInfo, err := s.store.GetFileInfo(hash)
+			fileInfo, err := s.store.GetFileInfo(context.Background(), hash)
 			if tc.expectErr {
 				s.Error(err)
 				s.Nil(fileInfo)
@@ -323,7 +324,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoPanicRecovery() {
 			}()
 
 			// Should not panic, may error
-			_, _ = s.store.GetFileInfo(input)
+			_, _ = s.store.GetFileInfo(context.Background(), input)
 		})
 	}
 }
@@ -331,12 +332,12 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoPanicRecovery() {
 // TestGetFileInfoLogMessages tests that appropriate log messages are generated
 func (s *GetFileInfoTestSuite) TestGetFileInfoLogMessages() {
 	// Test with invalid hash - should generate error log
-	fileInfo, err := s.store.GetFileInfo("invalid")
+	fileInfo, err := s.store.GetFileInfo(context.Background(), "invalid")
 	s.Error(err)
 	s.Nil(fileInfo)
 
 	// Test with valid but non-existent hash - should generate info log
-	fileInfo, err = s.store.GetFileInfo(s.testHash)
+	fileInfo, err = s.store.GetFileInfo(context.Background(), s.testHash)
 	s.Error(err)
 	s.Nil(fileInfo)
 }
@@ -353,7 +354,7 @@ func (s *GetFileInfoTestSuite) TestGetFileInfoWithExistingLoopButStatError() {
 	s.NoError(err)
 
 	// Test should fail during mounting or file finding
-	fileInfo, err := s.store.GetFileInfo(s.testHash)
+	fileInfo, err := s.store.GetFileInfo(context.Background(), s.testHash)
 	s.Error(err)
 	s.Nil(fileInfo)
 }
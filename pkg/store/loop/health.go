@@ -0,0 +1,327 @@
+package loop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+)
+
+const (
+	// dirtyMarkerName marks a loop image as mounted; it is removed after a clean unmount.
+	// A marker found before mounting means the previous mount did not end cleanly.
+	dirtyMarkerName = "loop.dirty"
+	// degradedMarkerName marks a loop image with filesystem errors that were left uncorrected.
+	// It holds the failed check and is removed only by a successful repair.
+	degradedMarkerName = "loop.degraded"
+	// fsckUncorrectedExit is the lowest e2fsck exit code that reports errors left uncorrected.
+	fsckUncorrectedExit = 4
+	// fsckNiceness is the scheduling priority for background filesystem checks.
+	fsckNiceness = "19"
+	// DefaultFsckInterval is the default interval between background checks of idle images.
+	DefaultFsckInterval = 24 * time.Hour
+)
+
+// ErrImageDegraded is returned when a loop image has filesystem errors that could not be corrected.
+var ErrImageDegraded = errors.New("loop image filesystem is degraded")
+
+// healthChecker holds per-image filesystem check results and the background check loop.
+type healthChecker struct {
+	mu      sync.Mutex
+	results map[string]models.ImageHealth // keyed by 4-character prefix
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// getDirtyMarkerPath returns the dirty marker path for the loop image holding hash.
+func (s *Store) getDirtyMarkerPath(hash string) string {
+	loopFilePath := s.getLoopFilePath(hash)
+	if loopFilePath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(loopFilePath), dirtyMarkerName)
+}
+
+// markDirty records that the loop image holding hash is about to be mounted.
+func (s *Store) markDirty(hash string) error {
+	markerPath := s.getDirtyMarkerPath(hash)
+	marker, err := os.OpenFile(markerPath, os.O_CREATE|os.O_WRONLY, packFilePerm)
+	if err != nil {
+		log.Error().Err(err).Str("marker", markerPath).Msg("Failed to create dirty marker")
+		return err
+	}
+	if s.syncOnWrite {
+		err = marker.Sync()
+	}
+	if closeErr := marker.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// markClean removes the dirty marker of the image mounted at mountPoint after a clean unmount.
+func (s *Store) markClean(mountPoint string) {
+	markerPath := filepath.Join(filepath.Dir(mountPoint), dirtyMarkerName)
+	if err := os.Remove(markerPath); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Str("marker", markerPath).Msg("Failed to remove dirty marker")
+	}
+}
+
+// getDegradedMarkerPath returns the degraded marker path for the loop image of prefix.
+func (s *Store) getDegradedMarkerPath(prefix string) string {
+	loopFilePath := s.getLoopFilePath(prefix)
+	if loopFilePath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(loopFilePath), degradedMarkerName)
+}
+
+// writeDegradedMarker persists the degraded state of an image so it survives restarts.
+func (s *Store) writeDegradedMarker(health models.ImageHealth) error {
+	data, err := json.Marshal(health)
+	if err != nil {
+		return err
+	}
+
+	markerPath := s.getDegradedMarkerPath(health.Prefix)
+	marker, err := os.OpenFile(markerPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, packFilePerm)
+	if err != nil {
+		return err
+	}
+	_, err = marker.Write(data)
+	if err == nil && s.syncOnWrite {
+		err = marker.Sync()
+	}
+	if closeErr := marker.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// checkDegradedImage returns ErrImageDegraded if the image holding hash is marked degraded.
+func (s *Store) checkDegradedImage(hash string) error {
+	prefix := hash[:minHashLength]
+	if _, err := os.Stat(s.getDegradedMarkerPath(prefix)); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: prefix %s must be repaired before it can be mounted", ErrImageDegraded, prefix)
+}
+
+// loadDegradedImages restores the degraded state recorded by markers in the storage directory.
+func (s *Store) loadDegradedImages() {
+	paths, err := filepath.Glob(filepath.Join(s.storageDir, "*", "*", degradedMarkerName))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list degraded markers")
+		return
+	}
+
+	for _, path := range paths {
+		loopDir := filepath.Dir(path)
+		prefix := filepath.Base(filepath.Dir(loopDir)) + filepath.Base(loopDir)
+		if len(prefix) != minHashLength || !s.validatePrefix(prefix) {
+			continue
+		}
+
+		var health models.ImageHealth
+		//nolint:gosec // path is found under the storage directory and its prefix is validated
+		if data, err := os.ReadFile(path); err != nil || json.Unmarshal(data, &health) != nil {
+			log.Warn().Str("marker", path).Msg("Degraded marker is unreadable, keeping the image degraded")
+		}
+		health.Prefix = prefix
+		health.Degraded = true
+
+		s.health.mu.Lock()
+		if s.health.results == nil {
+			s.health.results = make(map[string]models.ImageHealth)
+		}
+		s.health.results[prefix] = health
+		s.health.mu.Unlock()
+		log.Warn().Str("prefix", prefix).Msg("Loop image is degraded and will not be mounted until repaired")
+	}
+}
+
+// checkDirtyImage runs e2fsck in preen mode on an unmounted image that was not cleanly unmounted.
+// It returns ErrImageDegraded if errors remain that preen mode could not correct.
+// The caller must hold the image's mount lock.
+func (s *Store) checkDirtyImage(ctx context.Context, hash string) error {
+	if _, err := os.Stat(s.getDirtyMarkerPath(hash)); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	prefix := hash[:minHashLength]
+	log.Warn().Str("prefix", prefix).Msg("Loop image was not cleanly unmounted, checking filesystem before mount")
+
+	result, err := s.runFsck(ctx, prefix, false, "-p")
+	if err != nil {
+		return err
+	}
+	s.recordFsckResult(result, false)
+
+	if result.ExitCode >= fsckUncorrectedExit {
+		return fmt.Errorf("%w: e2fsck exit code %d for prefix %s", ErrImageDegraded, result.ExitCode, prefix)
+	}
+	return nil
+}
+
+// recordFsckResult stores the outcome of a filesystem check for the image it ran on.
+// A degraded image stays degraded, on disk and in memory, until a repair completes without
+// leaving errors uncorrected; a read-only check that finds no errors does not clear it.
+func (s *Store) recordFsckResult(result *models.FsckResult, repair bool) {
+	health := models.ImageHealth{
+		Prefix:    result.Prefix,
+		LastCheck: time.Now(),
+		Clean:     result.Clean,
+		ExitCode:  result.ExitCode,
+		Degraded:  result.ExitCode >= fsckUncorrectedExit,
+	}
+
+	markerPath := s.getDegradedMarkerPath(result.Prefix)
+	switch {
+	case health.Degraded:
+		log.Error().Str("prefix", result.Prefix).Int("exit_code", result.ExitCode).Msg("Loop image filesystem is degraded")
+		if err := s.writeDegradedMarker(health); err != nil {
+			log.Error().Err(err).Str("marker", markerPath).Msg("Failed to write degraded marker")
+		}
+	case repair:
+		if err := os.Remove(markerPath); err != nil && !os.IsNotExist(err) {
+			log.Warn().Err(err).Str("marker", markerPath).Msg("Failed to remove degraded marker")
+		}
+	default:
+		if _, err := os.Stat(markerPath); err == nil {
+			health.Degraded = true
+		}
+	}
+
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	if s.health.results == nil {
+		s.health.results = make(map[string]models.ImageHealth)
+	}
+	if previous, found := s.health.results[result.Prefix]; found && previous.Degraded && !repair {
+		health.Degraded = true
+	}
+	s.health.results[result.Prefix] = health
+}
+
+// imageHealth returns the last recorded check of the image for prefix.
+func (s *Store) imageHealth(prefix string) (models.ImageHealth, bool) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+	health, found := s.health.results[prefix]
+	return health, found
+}
+
+// DegradedImages returns the images whose last filesystem check found uncorrected errors.
+func (s *Store) DegradedImages() []models.ImageHealth {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	var degraded []models.ImageHealth
+	for _, health := range s.health.results {
+		if health.Degraded {
+			degraded = append(degraded, health)
+		}
+	}
+	return degraded
+}
+
+// StartHealthChecks starts a background loop that checks idle, unmounted images every interval.
+// Checks run read-only at low CPU priority; images in use are skipped until the next round.
+func (s *Store) StartHealthChecks(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	s.health.mu.Lock()
+	if s.health.stop != nil {
+		s.health.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	s.health.stop = stop
+	s.health.done = done
+	s.health.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.checkIdleImages(interval, stop)
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", interval).Msg("Started background filesystem checks")
+}
+
+// StopHealthChecks stops the background check loop and waits for a running check to finish.
+func (s *Store) StopHealthChecks() {
+	s.health.mu.Lock()
+	stop, done := s.health.stop, s.health.done
+	s.health.stop, s.health.done = nil, nil
+	s.health.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// checkIdleImages checks every idle image that has not been checked within interval.
+func (s *Store) checkIdleImages(interval time.Duration, stop <-chan struct{}) {
+	images, err := s.ListImages()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list loop images for background check")
+		return
+	}
+
+	for _, image := range images {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if image.Mounted || image.RefCount > 0 {
+			continue
+		}
+		if health, found := s.imageHealth(image.Prefix); found && time.Since(health.LastCheck) < interval {
+			continue
+		}
+
+		err := s.withExclusiveImage(image.Prefix, func(mountPoint string) error {
+			// Re-check under the exclusive lock; the image may have been mounted since it was listed
+			if s.isMounted(mountPoint) {
+				return ErrImageBusy
+			}
+			result, err := s.runFsck(context.Background(), image.Prefix, true, "-n", "-f")
+			if err != nil {
+				return err
+			}
+			s.recordFsckResult(result, false)
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrImageBusy) {
+			log.Warn().Err(err).Str("prefix", image.Prefix).Msg("Background filesystem check failed")
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package loop
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"loopfs/pkg/models"
+)
+
+// HealthTestSuite tests dirty tracking and filesystem checks of loop images
+type HealthTestSuite struct {
+	suite.Suite
+	tempDir string
+	store   *Store
+}
+
+// SetupTest runs before each test
+func (s *HealthTestSuite) SetupTest() {
+	s.tempDir = s.T().TempDir()
+	s.store = NewWithDefaults(s.tempDir, 10)
+}
+
+// TearDownTest runs after each test
+func (s *HealthTestSuite) TearDownTest() {
+	s.store.StopHealthChecks()
+}
+
+// createFormattedImage creates an ext4 image for prefix, skipping the test if mkfs.ext4 is unavailable
+func (s *HealthTestSuite) createFormattedImage(prefix string) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		s.T().Skip("mkfs.ext4 not available")
+	}
+	if _, err := exec.LookPath("e2fsck"); err != nil {
+		s.T().Skip("e2fsck not available")
+	}
+
+	loopFilePath := s.store.getLoopFilePath(prefix)
+	s.Require().NoError(os.MkdirAll(filepath.Dir(loopFilePath), dirPerm))
+	s.Require().NoError(os.WriteFile(loopFilePath, make([]byte, 4*bytesToMB), 0600))
+	s.Require().NoError(exec.Command("mkfs.ext4", "-q", "-F", loopFilePath).Run())
+}
+
+// createGarbageImage creates an image file that is not a valid filesystem
+func (s *HealthTestSuite) createGarbageImage(prefix string) {
+	if _, err := exec.LookPath("e2fsck"); err != nil {
+		s.T().Skip("e2fsck not available")
+	}
+
+	loopFilePath := s.store.getLoopFilePath(prefix)
+	s.Require().NoError(os.MkdirAll(filepath.Dir(loopFilePath), dirPerm))
+	s.Require().NoError(os.WriteFile(loopFilePath, make([]byte, bytesToMB), 0600))
+}
+
+// TestDirtyMarker tests creating and removing the dirty marker
+func (s *HealthTestSuite) TestDirtyMarker() {
+	hash := "abcd1234"
+	s.Require().NoError(os.MkdirAll(filepath.Dir(s.store.getLoopFilePath(hash)), dirPerm))
+
+	markerPath := s.store.getDirtyMarkerPath(hash)
+	s.Equal(filepath.Join(s.tempDir, "ab", "cd", dirtyMarkerName), markerPath)
+
+	s.Require().NoError(s.store.markDirty(hash))
+	s.FileExists(markerPath)
+
+	s.store.markClean(s.store.getMountPoint(hash))
+	s.NoFileExists(markerPath)
+
+	// Removing a missing marker is not an error
+	s.store.markClean(s.store.getMountPoint(hash))
+}
+
+// TestCheckDirtyImageWithoutMarker tests that clean images are not checked
+func (s *HealthTestSuite) TestCheckDirtyImageWithoutMarker() {
+	s.NoError(s.store.checkDirtyImage(context.Background(), "abcd1234"))
+	_, found := s.store.imageHealth("abcd")
+	s.False(found)
+}
+
+// TestCheckDirtyImageClean tests the pre-mount check of a dirty but intact image
+func (s *HealthTestSuite) TestCheckDirtyImageClean() {
+	s.createFormattedImage("abcd")
+	s.Require().NoError(s.store.markDirty("abcd"))
+
+	s.NoError(s.store.checkDirtyImage(context.Background(), "abcd1234"))
+
+	health, found := s.store.imageHealth("abcd")
+	s.True(found)
+	s.False(health.Degraded)
+	s.Empty(s.store.DegradedImages())
+}
+
+// TestCheckDirtyImageDegraded tests that a dirty image with uncorrectable errors is refused
+func (s *HealthTestSuite) TestCheckDirtyImageDegraded() {
+	s.createGarbageImage("abcd")
+	s.Require().NoError(s.store.markDirty("abcd"))
+
+	err := s.store.checkDirtyImage(context.Background(), "abcd1234")
+	s.ErrorIs(err, ErrImageDegraded)
+
+	degraded := s.store.DegradedImages()
+	s.Require().Len(degraded, 1)
+	s.Equal("abcd", degraded[0].Prefix)
+	s.GreaterOrEqual(degraded[0].ExitCode, fsckUncorrectedExit)
+}
+
+// TestRecordFsckResult tests that only a repair clears the degraded state of an image
+func (s *HealthTestSuite) TestRecordFsckResult() {
+	s.Require().NoError(os.MkdirAll(filepath.Dir(s.store.getLoopFilePath("abcd")), dirPerm))
+	markerPath := s.store.getDegradedMarkerPath("abcd")
+
+	s.store.recordFsckResult(&models.FsckResult{Prefix: "abcd", ExitCode: 8}, false)
+	s.store.recordFsckResult(&models.FsckResult{Prefix: "cdef", Clean: true}, false)
+	s.Len(s.store.DegradedImages(), 1)
+	s.FileExists(markerPath)
+
+	// A check that finds nothing left to correct does not clear the degraded state
+	s.store.recordFsckResult(&models.FsckResult{Prefix: "abcd", ExitCode: 1}, false)
+	s.Len(s.store.DegradedImages(), 1)
+	s.FileExists(markerPath)
+
+	s.store.recordFsckResult(&models.FsckResult{Prefix: "abcd", ExitCode: 1}, true)
+	s.Empty(s.store.DegradedImages())
+	s.NoFileExists(markerPath)
+
+	health, found := s.store.imageHealth("abcd")
+	s.True(found)
+	s.Equal(1, health.ExitCode)
+	s.WithinDuration(time.Now(), health.LastCheck, time.Second)
+}
+
+// TestDegradedMarkerPersists tests that a degraded image is remembered across restarts and not mounted
+func (s *HealthTestSuite) TestDegradedMarkerPersists() {
+	s.Require().NoError(os.MkdirAll(filepath.Dir(s.store.getLoopFilePath("abcd")), dirPerm))
+	s.store.recordFsckResult(&models.FsckResult{Prefix: "abcd", ExitCode: 8}, false)
+	s.ErrorIs(s.store.checkDegradedImage("abcd1234"), ErrImageDegraded)
+	s.NoError(s.store.checkDegradedImage("cdef1234"))
+
+	restarted := NewWithDefaults(s.tempDir, 10)
+	degraded := restarted.DegradedImages()
+	s.Require().Len(degraded, 1)
+	s.Equal("abcd", degraded[0].Prefix)
+	s.Equal(8, degraded[0].ExitCode)
+
+	err := restarted.mountLoopFile(context.Background(), "abcd1234")
+	s.ErrorIs(err, ErrImageDegraded)
+	s.NoFileExists(restarted.getDirtyMarkerPath("abcd1234"))
+
+	// An unreadable marker still keeps the image degraded
+	s.Require().NoError(os.WriteFile(s.store.getDegradedMarkerPath("abcd"), []byte("{"), 0600))
+	degraded = NewWithDefaults(s.tempDir, 10).DegradedImages()
+	s.Require().Len(degraded, 1)
+	s.True(degraded[0].Degraded)
+}
+
+// TestCheckIdleImages tests the background check of idle images
+func (s *HealthTestSuite) TestCheckIdleImages() {
+	s.createFormattedImage("abcd")
+	s.createGarbageImage("cdef")
+
+	s.store.checkIdleImages(time.Hour, make(chan struct{}))
+
+	health, found := s.store.imageHealth("abcd")
+	s.True(found)
+	s.True(health.Clean)
+
+	degraded := s.store.DegradedImages()
+	s.Require().Len(degraded, 1)
+	s.Equal("cdef", degraded[0].Prefix)
+
+	images, err := s.store.ListImages()
+	s.Require().NoError(err)
+	s.Require().Len(images, 2)
+	s.Require().NotNil(images[1].Health)
+	s.True(images[1].Health.Degraded)
+}
+
+// TestCheckIdleImagesSkipsRecentAndBusy tests that recently checked and busy images are skipped
+func (s *HealthTestSuite) TestCheckIdleImagesSkipsRecentAndBusy() {
+	s.createGarbageImage("abcd")
+	s.createGarbageImage("cdef")
+
+	s.store.recordFsckResult(&models.FsckResult{Prefix: "abcd", Clean: true}, false)
+	s.store.getOrCreateRefCount(s.store.getMountPoint("cdef")).Store(1)
+
+	s.store.checkIdleImages(time.Hour, make(chan struct{}))
+
+	s.Empty(s.store.DegradedImages())
+	_, found := s.store.imageHealth("cdef")
+	s.False(found)
+}
+
+// TestStartStopHealthChecks tests that the background loop starts once and stops cleanly
+func (s *HealthTestSuite) TestStartStopHealthChecks() {
+	s.store.StartHealthChecks(0)
+	s.Nil(s.store.health.stop)
+
+	s.store.StartHealthChecks(time.Hour)
+	stop := s.store.health.stop
+	s.NotNil(stop)
+
+	s.store.StartHealthChecks(time.Hour)
+	s.Equal(stop, s.store.health.stop)
+
+	s.store.StopHealthChecks()
+	s.Nil(s.store.health.stop)
+	s.store.StopHealthChecks()
+}
+
+// TestHealthTestSuite runs the health test suite
+func TestHealthTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthTestSuite))
+}
@@ -0,0 +1,421 @@
+package loop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/models"
+	"loopfs/pkg/store"
+)
+
+const (
+	loopFileName   = "loop.img"
+	lostFoundDir   = "lost+found"
+	percentFactor  = 100
+	prefixDirChars = 2
+)
+
+// ErrImageBusy is returned when an image operation needs exclusive access but the image is in use.
+var ErrImageBusy = errors.New("loop image is in use")
+
+// ListPrefixes returns the 4-character hash prefixes of every loop image under the storage
+// directory, sorted. Images are not mounted.
+func (s *Store) ListPrefixes() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(s.storageDir, "*", "*", loopFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := make([]string, 0, len(paths))
+	for _, path := range paths {
+		loopDir := filepath.Dir(path)
+		prefix := filepath.Base(filepath.Dir(loopDir)) + filepath.Base(loopDir)
+		if len(prefix) != minHashLength || !s.validatePrefix(prefix) {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+// ListImages returns every loop image under the storage directory with its mount state.
+// Utilization and blob counts are only reported for images that are currently mounted.
+func (s *Store) ListImages() ([]models.ImageInfo, error) {
+	prefixes, err := s.ListPrefixes()
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]models.ImageInfo, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		info, err := s.imageInfo(prefix)
+		if err != nil {
+			var notFoundErr store.FileNotFoundError
+			if errors.As(err, &notFoundErr) {
+				// Removed or being swapped by a resize since the glob
+				continue
+			}
+			return nil, err
+		}
+		images = append(images, *info)
+	}
+
+	return images, nil
+}
+
+// ListHashes returns the hashes of the standalone and packed blobs in the loop image for a
+// 4-character hash prefix, sorted. The image is mounted for the listing like for any request.
+func (s *Store) ListHashes(ctx context.Context, prefix string) ([]string, error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) != minHashLength || !s.validatePrefix(prefix) {
+		return nil, store.InvalidHashError{Hash: prefix}
+	}
+
+	resizeLock := s.getResizeLock(s.getLoopFilePath(prefix))
+	resizeLock.RLock()
+	defer resizeLock.RUnlock()
+
+	var hashes []string
+	err := s.withMountedLoopUnlocked(ctx, prefix, func() error {
+		var err error
+		hashes, err = s.blobHashes(prefix)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// blobHashes collects the hashes of the blobs in a mounted loop filesystem.
+// Standalone blobs are stored as mountpoint/<hash[4:6]>/<hash[6:8]>/<hash[8:]>.
+func (s *Store) blobHashes(prefix string) ([]string, error) {
+	mountPoint := s.getMountPoint(prefix)
+
+	hashes := []string{}
+	err := filepath.WalkDir(mountPoint, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			name := entry.Name()
+			if path != mountPoint && (name == lostFoundDir || name == packDirName || len(name) != prefixDirChars) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(mountPoint, path)
+		if err != nil {
+			return err
+		}
+		hash := prefix + strings.ReplaceAll(rel, string(filepath.Separator), "")
+		if s.ValidateHash(hash) {
+			hashes = append(hashes, hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := s.getPackIndex(prefix)
+	if err != nil {
+		return nil, err
+	}
+	index.mu.RLock()
+	for hash := range index.entries {
+		hashes = append(hashes, hash)
+	}
+	index.mu.RUnlock()
+
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+// imageInfo collects the state of the loop image for a 4-character hash prefix.
+func (s *Store) imageInfo(prefix string) (*models.ImageInfo, error) {
+	loopFilePath := s.getLoopFilePath(prefix)
+	mountPoint := s.getMountPoint(prefix)
+
+	fileInfo, err := os.Stat(loopFilePath)
+	if os.IsNotExist(err) {
+		return nil, store.FileNotFoundError{Hash: prefix}
+	} else if err != nil {
+		return nil, err
+	}
+
+	info := &models.ImageInfo{
+		Prefix:     prefix,
+		Path:       loopFilePath,
+		Size:       fileInfo.Size(),
+		MountPoint: mountPoint,
+		RefCount:   s.getCurrentRefCount(mountPoint),
+	}
+	if health, found := s.imageHealth(prefix); found {
+		info.Health = &health
+	}
+
+	s.timerMutex.Lock()
+	if deadline, exists := s.unmountDeadlines[mountPoint]; exists {
+		info.UnmountAt = &deadline
+	}
+	s.timerMutex.Unlock()
+
+	// Pin a mounted image with a reference so it stays mounted while it is inspected. The
+	// mount lock is only held to check the mount; counting the blobs of a large image takes
+	// a while and must not block mounting and unmounting it
+	if !s.pinMount(mountPoint) {
+		return info, nil
+	}
+	defer s.decrementRefCount(mountPoint)
+	info.Mounted = true
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(mountPoint, &stat); err != nil {
+		log.Warn().Err(err).Str("mount_point", mountPoint).Msg("Failed to get stats for mount point")
+		return info, nil
+	}
+	bsize := uint64(max(stat.Bsize, 0)) //nolint:gosec // Safe conversion after clamping
+	total := stat.Blocks * bsize
+	used := total - stat.Bfree*bsize
+	info.SpaceTotal = int64(total) //nolint:gosec // Safe in practice for disk sizes
+	info.SpaceUsed = int64(used)   //nolint:gosec // Safe in practice for disk sizes
+	if total > 0 {
+		info.Utilization = float64(used) * percentFactor / float64(total)
+	}
+
+	blobCount, err := s.countBlobs(prefix)
+	if err != nil {
+		log.Warn().Err(err).Str("mount_point", mountPoint).Msg("Failed to count blobs in loop image")
+		return info, nil
+	}
+	info.BlobCount = &blobCount
+	return info, nil
+}
+
+// pinMount takes a reference to the mount of an image if it is mounted, keeping it mounted
+// until the reference is released with decrementRefCount. It reports whether it did.
+func (s *Store) pinMount(mountPoint string) bool {
+	mountLock := s.getMountLock(mountPoint)
+	mountLock.Lock()
+	defer mountLock.Unlock()
+
+	if !s.isMounted(mountPoint) {
+		return false
+	}
+	if s.incrementRefCount(mountPoint) {
+		// The image is mounted already; operations taking a reference meanwhile need not wait
+		s.signalMountReady(mountPoint, nil)
+	}
+	return true
+}
+
+// countBlobs counts the standalone and packed blobs of a mounted loop filesystem.
+func (s *Store) countBlobs(prefix string) (int64, error) {
+	mountPoint := s.getMountPoint(prefix)
+
+	var count int64
+	err := filepath.WalkDir(mountPoint, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			name := entry.Name()
+			if path != mountPoint && (name == lostFoundDir || name == packDirName || len(name) != prefixDirChars) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	index, err := s.getPackIndex(prefix)
+	if err != nil {
+		return 0, err
+	}
+	index.mu.RLock()
+	count += int64(len(index.entries))
+	index.mu.RUnlock()
+
+	return count, nil
+}
+
+// MountImage mounts the loop image for a 4-character hash prefix.
+// The image stays mounted for the mount TTL like any image mounted by a request.
+func (s *Store) MountImage(ctx context.Context, prefix string) error {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) != minHashLength || !s.validatePrefix(prefix) {
+		return store.InvalidHashError{Hash: prefix}
+	}
+
+	resizeLock := s.getResizeLock(s.getLoopFilePath(prefix))
+	resizeLock.RLock()
+	defer resizeLock.RUnlock()
+
+	err := s.withMountedLoopUnlocked(ctx, prefix, func() error {
+		return nil
+	})
+	if err == nil {
+		log.Info().Str("prefix", prefix).Msg("Loop image mounted by admin request")
+	}
+	return err
+}
+
+// UnmountImage unmounts the loop image for a 4-character hash prefix.
+// It returns ErrImageBusy if operations are using the image.
+func (s *Store) UnmountImage(ctx context.Context, prefix string) error {
+	return s.withExclusiveImage(prefix, func(mountPoint string) error {
+		s.stopMountTimer(mountPoint)
+		if err := s.unmountMountPoint(ctx, mountPoint); err != nil {
+			return err
+		}
+		log.Info().Str("prefix", prefix).Msg("Loop image unmounted by admin request")
+		return nil
+	})
+}
+
+// CheckImage runs a read-only filesystem check on the loop image for a 4-character hash prefix.
+// The image is unmounted first; it returns ErrImageBusy if operations are using the image.
+func (s *Store) CheckImage(ctx context.Context, prefix string) (*models.FsckResult, error) {
+	return s.fsckImage(ctx, prefix, false, "-n", "-f")
+}
+
+// RepairImage runs e2fsck on the loop image for a 4-character hash prefix, fixing all errors it finds.
+// A repair that leaves no errors uncorrected clears the degraded marker so the image can be mounted again.
+func (s *Store) RepairImage(ctx context.Context, prefix string) (*models.FsckResult, error) {
+	return s.fsckImage(ctx, prefix, true, "-y", "-f")
+}
+
+// fsckImage unmounts the image for prefix and runs e2fsck with options, recording the result.
+// Only a repair may clear the degraded state of the image.
+func (s *Store) fsckImage(ctx context.Context, prefix string, repair bool, options ...string) (*models.FsckResult, error) {
+	var result *models.FsckResult
+	err := s.withExclusiveImage(prefix, func(mountPoint string) error {
+		s.stopMountTimer(mountPoint)
+		if err := s.unmountMountPoint(ctx, mountPoint); err != nil {
+			return err
+		}
+
+		var err error
+		result, err = s.runFsck(ctx, strings.ToLower(prefix), false, options...)
+		if err != nil {
+			return err
+		}
+		s.recordFsckResult(result, repair)
+		return nil
+	})
+	return result, err
+}
+
+// withExclusiveImage runs callback while holding the image's resize lock exclusively,
+// so no operation can mount or use the image.
+func (s *Store) withExclusiveImage(prefix string, callback func(mountPoint string) error) error {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) != minHashLength || !s.validatePrefix(prefix) {
+		return store.InvalidHashError{Hash: prefix}
+	}
+
+	loopFilePath := s.getLoopFilePath(prefix)
+	mountPoint := s.getMountPoint(prefix)
+
+	if _, err := os.Stat(loopFilePath); os.IsNotExist(err) {
+		return store.FileNotFoundError{Hash: prefix}
+	} else if err != nil {
+		return err
+	}
+
+	// Do not wait behind in-flight operations; the caller is diagnosing and should see the image is busy
+	resizeLock := s.getResizeLock(loopFilePath)
+	if !resizeLock.TryLock() {
+		return ErrImageBusy
+	}
+	defer resizeLock.Unlock()
+
+	if s.getCurrentRefCount(mountPoint) > 0 {
+		return ErrImageBusy
+	}
+
+	return callback(mountPoint)
+}
+
+// runFsck runs e2fsck with the given options on the unmounted loop image for prefix.
+// lowPriority runs the check under nice so it does not compete with request handling.
+// The caller must ensure the image is not mounted.
+func (s *Store) runFsck(ctx context.Context, prefix string, lowPriority bool, options ...string) (*models.FsckResult, error) {
+	loopFilePath := s.getLoopFilePath(prefix)
+
+	var size int64
+	if info, err := os.Stat(loopFilePath); err == nil {
+		size = info.Size()
+	}
+
+	fsckTimeout := s.getMkfsTimeout(size)
+	fsckCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fsckTimeout)
+	defer cancel()
+
+	name := "e2fsck"
+	args := append(append([]string{}, options...), loopFilePath)
+	if lowPriority {
+		name = "nice"
+		args = append([]string{"-n", fsckNiceness, "e2fsck"}, args...)
+	}
+	//nolint:gosec // loopFilePath is constructed from validated prefix, options are fixed by callers
+	cmd := exec.CommandContext(fsckCtx, name, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	start := time.Now()
+	runErr := runCommand(fsckCtx, cmd)
+	duration := time.Since(start)
+
+	result := &models.FsckResult{
+		Prefix:   prefix,
+		Output:   output.String(),
+		Duration: duration.String(),
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil:
+		result.Clean = true
+	case errors.As(runErr, &exitErr):
+		// e2fsck reports findings through its exit code rather than failing
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		log.Error().Err(runErr).Str("loop_file", loopFilePath).Dur("timeout", fsckTimeout).Msg("Failed to run e2fsck")
+		observeFsck(nil, runErr)
+		return nil, runErr
+	}
+	observeFsck(result, nil)
+
+	log.Info().
+		Str("loop_file", loopFilePath).
+		Bool("clean", result.Clean).
+		Int("exit_code", result.ExitCode).
+		Dur("duration", duration).
+		Msg("Filesystem check completed")
+	return result, nil
+}
@@ -0,0 +1,219 @@
+package loop
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"loopfs/pkg/store"
+)
+
+// ImagesTestSuite tests loop image introspection and administration
+type ImagesTestSuite struct {
+	suite.Suite
+	tempDir string
+	store   *Store
+}
+
+// SetupTest runs before each test
+func (s *ImagesTestSuite) SetupTest() {
+	s.tempDir = s.T().TempDir()
+	s.store = NewWithDefaults(s.tempDir, 10)
+}
+
+// TearDownTest runs after each test
+func (s *ImagesTestSuite) TearDownTest() {
+	s.store.timerMutex.Lock()
+	for _, timer := range s.store.mountTimers {
+		timer.Stop()
+	}
+	s.store.timerMutex.Unlock()
+}
+
+// createImage creates an unformatted image file for prefix
+func (s *ImagesTestSuite) createImage(prefix string, size int) {
+	loopFilePath := s.store.getLoopFilePath(prefix)
+	s.Require().NoError(os.MkdirAll(filepath.Dir(loopFilePath), dirPerm))
+	s.Require().NoError(os.WriteFile(loopFilePath, make([]byte, size), 0600))
+}
+
+// TestListImagesEmpty tests listing when no images exist
+func (s *ImagesTestSuite) TestListImagesEmpty() {
+	images, err := s.store.ListImages()
+	s.Require().NoError(err)
+	s.Empty(images)
+}
+
+// TestListImages tests that images are listed sorted with their state
+func (s *ImagesTestSuite) TestListImages() {
+	s.createImage("cdef", 2048)
+	s.createImage("abcd", 1024)
+
+	// Directories that do not form a hex prefix are ignored
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.tempDir, "te", "mp"), dirPerm))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.tempDir, "te", "mp", loopFileName), nil, 0600))
+
+	images, err := s.store.ListImages()
+	s.Require().NoError(err)
+	s.Require().Len(images, 2)
+
+	s.Equal("abcd", images[0].Prefix)
+	s.Equal(int64(1024), images[0].Size)
+	s.Equal(s.store.getLoopFilePath("abcd"), images[0].Path)
+	s.Equal(s.store.getMountPoint("abcd"), images[0].MountPoint)
+	s.False(images[0].Mounted)
+	s.Nil(images[0].BlobCount)
+	s.Nil(images[0].UnmountAt)
+
+	s.Equal("cdef", images[1].Prefix)
+	s.Equal(int64(2048), images[1].Size)
+}
+
+// TestListImagesReportsDeadlineAndRefCount tests that idle-unmount deadlines and ref counts are reported
+func (s *ImagesTestSuite) TestListImagesReportsDeadlineAndRefCount() {
+	s.createImage("abcd", 1024)
+	mountPoint := s.store.getMountPoint("abcd")
+
+	before := time.Now()
+	s.store.scheduleUnmount(mountPoint)
+	s.store.getOrCreateRefCount(mountPoint).Store(2)
+
+	images, err := s.store.ListImages()
+	s.Require().NoError(err)
+	s.Require().Len(images, 1)
+	s.Require().NotNil(images[0].UnmountAt)
+	s.WithinDuration(before.Add(s.store.idleTTL()), *images[0].UnmountAt, time.Second)
+	s.Equal(2, images[0].RefCount)
+
+	s.store.stopMountTimer(mountPoint)
+	images, err = s.store.ListImages()
+	s.Require().NoError(err)
+	s.Nil(images[0].UnmountAt)
+}
+
+// TestPinMountNotMounted tests that an image that is not mounted is not pinned
+func (s *ImagesTestSuite) TestPinMountNotMounted() {
+	s.createImage("abcd", 1024)
+	mountPoint := s.store.getMountPoint("abcd")
+
+	s.False(s.store.pinMount(mountPoint))
+	s.Zero(s.store.getCurrentRefCount(mountPoint))
+
+	images, err := s.store.ListImages()
+	s.Require().NoError(err)
+	s.Require().Len(images, 1)
+	s.False(images[0].Mounted)
+	s.Zero(s.store.getCurrentRefCount(mountPoint))
+}
+
+// TestUnmountImageNotMounted tests unmounting an image that is not mounted
+func (s *ImagesTestSuite) TestUnmountImageNotMounted() {
+	s.createImage("abcd", 1024)
+	mountPoint := s.store.getMountPoint("abcd")
+	s.store.scheduleUnmount(mountPoint)
+
+	s.NoError(s.store.UnmountImage(context.Background(), "ABCD"))
+
+	// The pending idle unmount is cancelled
+	s.store.timerMutex.Lock()
+	_, exists := s.store.mountTimers[mountPoint]
+	s.store.timerMutex.Unlock()
+	s.False(exists)
+}
+
+// TestUnmountImageBusy tests that images in use are not unmounted
+func (s *ImagesTestSuite) TestUnmountImageBusy() {
+	s.createImage("abcd", 1024)
+	s.store.getOrCreateRefCount(s.store.getMountPoint("abcd")).Store(1)
+
+	s.ErrorIs(s.store.UnmountImage(context.Background(), "abcd"), ErrImageBusy)
+
+	_, err := s.store.CheckImage(context.Background(), "abcd")
+	s.ErrorIs(err, ErrImageBusy)
+}
+
+// TestUnmountImageResizing tests that images locked by a resize are reported busy
+func (s *ImagesTestSuite) TestUnmountImageResizing() {
+	s.createImage("abcd", 1024)
+	resizeLock := s.store.getResizeLock(s.store.getLoopFilePath("abcd"))
+	resizeLock.Lock()
+	defer resizeLock.Unlock()
+
+	s.ErrorIs(s.store.UnmountImage(context.Background(), "abcd"), ErrImageBusy)
+}
+
+// TestImageOperationsMissingImage tests operations on images that do not exist
+func (s *ImagesTestSuite) TestImageOperationsMissingImage() {
+	s.ErrorAs(s.store.UnmountImage(context.Background(), "abcd"), &store.FileNotFoundError{})
+	s.ErrorAs(s.store.MountImage(context.Background(), "abcd"), &store.FileNotFoundError{})
+
+	_, err := s.store.CheckImage(context.Background(), "abcd")
+	s.ErrorAs(err, &store.FileNotFoundError{})
+}
+
+// TestImageOperationsInvalidPrefix tests operations with invalid prefixes
+func (s *ImagesTestSuite) TestImageOperationsInvalidPrefix() {
+	for _, prefix := range []string{"", "abc", "abcde", "zzzz", "../a"} {
+		s.ErrorAs(s.store.UnmountImage(context.Background(), prefix), &store.InvalidHashError{}, "prefix %q", prefix)
+		s.ErrorAs(s.store.MountImage(context.Background(), prefix), &store.InvalidHashError{}, "prefix %q", prefix)
+
+		_, err := s.store.CheckImage(context.Background(), prefix)
+		s.ErrorAs(err, &store.InvalidHashError{}, "prefix %q", prefix)
+	}
+}
+
+// TestListPrefixes tests that image prefixes are listed sorted without mounting
+func (s *ImagesTestSuite) TestListPrefixes() {
+	s.createImage("cdef", 512)
+	s.createImage("abcd", 512)
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.tempDir, "te", "mp"), dirPerm))
+	s.Require().NoError(os.WriteFile(filepath.Join(s.tempDir, "te", "mp", loopFileName), nil, 0600))
+
+	prefixes, err := s.store.ListPrefixes()
+	s.Require().NoError(err)
+	s.Equal([]string{"abcd", "cdef"}, prefixes)
+	s.False(s.store.isMounted(s.store.getMountPoint("abcd")))
+}
+
+// TestBlobHashes tests that standalone and packed blobs are listed by full hash
+func (s *ImagesTestSuite) TestBlobHashes() {
+	standalone := "abcd1234" + strings.Repeat("0", hashLength-8)
+	packed := "abcd5678" + strings.Repeat("f", hashLength-8)
+
+	filePath := s.store.getFilePath(standalone)
+	s.Require().NoError(os.MkdirAll(filepath.Dir(filePath), dirPerm))
+	s.Require().NoError(os.WriteFile(filePath, []byte("standalone"), 0600))
+
+	// Stray files and system directories are not blobs
+	mountPoint := s.store.getMountPoint("abcd")
+	s.Require().NoError(os.WriteFile(filepath.Join(filepath.Dir(filePath), "not-a-hash"), nil, 0600))
+	s.Require().NoError(os.MkdirAll(filepath.Join(mountPoint, lostFoundDir), dirPerm))
+	s.Require().NoError(os.WriteFile(filepath.Join(mountPoint, lostFoundDir, "#12"), nil, 0600))
+
+	index, err := s.store.getPackIndex("abcd")
+	s.Require().NoError(err)
+	s.Require().NoError(index.add(packed, strings.NewReader("packed"), int64(len("packed")), false))
+
+	hashes, err := s.store.blobHashes("abcd")
+	s.Require().NoError(err)
+	s.Equal([]string{standalone, packed}, hashes)
+}
+
+// TestListHashesErrors tests listing hashes of missing images and invalid prefixes
+func (s *ImagesTestSuite) TestListHashesErrors() {
+	_, err := s.store.ListHashes(context.Background(), "abcd")
+	s.ErrorAs(err, &store.FileNotFoundError{})
+
+	_, err = s.store.ListHashes(context.Background(), "zzzz")
+	s.ErrorAs(err, &store.InvalidHashError{})
+}
+
+// TestImagesTestSuite runs the images test suite
+func TestImagesTestSuite(t *testing.T) {
+	suite.Run(t, new(ImagesTestSuite))
+}
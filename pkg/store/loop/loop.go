@@ -13,6 +13,9 @@ import (
 
 	"loopfs/pkg/log"
 	"loopfs/pkg/store"
+	"loopfs/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -68,20 +71,24 @@ type Store struct {
 	storageDir         string
 	tempDir            string // Directory for temporary files during uploads
 	loopFileSize       int64
-	timeouts           TimeoutConfig
-	mountTTL           time.Duration
-	syncOnWrite        bool // Whether to fsync after each file write for durability
-	mountLocks         sync.Map // map[string]*sync.Mutex - per-mount-point locks for concurrent mounts
-	creationLocks      sync.Map // map[string]*sync.Mutex - uses sync.Map for lock-free access
-	refCounts          sync.Map // map[string]*atomic.Int64 - atomic reference counts per mount point
+	timeouts           atomic.Pointer[TimeoutConfig] // Replaced as a whole by SetTimeouts
+	mountTTL           atomic.Int64                  // Idle duration in nanoseconds before an image is unmounted
+	syncOnWrite        bool                          // Whether to fsync after each file write for durability
+	packThreshold      atomic.Int64                  // Blobs smaller than this many bytes are appended to the image pack (0 disables)
+	mountLocks         sync.Map                      // map[string]*sync.Mutex - per-mount-point locks for concurrent mounts
+	creationLocks      sync.Map                      // map[string]*sync.Mutex - uses sync.Map for lock-free access
+	refCounts          sync.Map                      // map[string]*atomic.Int64 - atomic reference counts per mount point
 	timerMutex         sync.Mutex
 	mountTimers        map[string]*time.Timer
+	unmountDeadlines   map[string]time.Time // When each scheduled idle unmount fires, protected by timerMutex
 	statusMutex        sync.Mutex
 	mountStatuses      map[string]*mountStatus
 	quiescenceMutex    sync.Mutex
 	quiescenceCond     *sync.Cond // Condition variable for waiting on ref count reaching zero
 	deduplicationLocks sync.Map   // map[string]*sync.Mutex - uses sync.Map for lock-free access
 	resizeLocks        sync.Map   // map[string]*sync.RWMutex - uses sync.Map for lock-free access
+	packIndexes        sync.Map   // map[string]*packIndex - pack indexes of mounted loop filesystems
+	health             healthChecker
 }
 
 type mountStatus struct {
@@ -114,15 +121,17 @@ func NewWithOptions(storageDir, tempDir string, loopFileSize int64, timeouts Tim
 		storageDir:   storageDir,
 		tempDir:      tempDir,
 		loopFileSize: loopFileSize,
-		timeouts:     timeouts,
-		mountTTL:     mountTTL,
 		syncOnWrite:  syncOnWrite,
 		// creationLocks, deduplicationLocks, resizeLocks, mountLocks, and refCounts are sync.Map, no initialization needed
-		mountTimers:   make(map[string]*time.Timer),
-		mountStatuses: make(map[string]*mountStatus),
+		mountTimers:      make(map[string]*time.Timer),
+		unmountDeadlines: make(map[string]time.Time),
+		mountStatuses:    make(map[string]*mountStatus),
 	}
+	store.SetTimeouts(timeouts)
+	store.mountTTL.Store(int64(mountTTL))
 	// Initialize quiescence condition variable with the mutex
 	store.quiescenceCond = sync.NewCond(&store.quiescenceMutex)
+	store.loadDegradedImages()
 	return store
 }
 
@@ -138,6 +147,31 @@ func (s *Store) SetSyncOnWrite(enabled bool) {
 	s.syncOnWrite = enabled
 }
 
+// SetMountTTL sets how long an idle image stays mounted. A TTL of zero or less restores the
+// default. This can be changed at runtime; images already waiting keep their deadline.
+func (s *Store) SetMountTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultMountCacheTTL
+	}
+	s.mountTTL.Store(int64(ttl))
+}
+
+// SetTimeouts replaces the timeouts of loop operations.
+// This can be changed at runtime; running operations keep their timeout.
+func (s *Store) SetTimeouts(timeouts TimeoutConfig) {
+	s.timeouts.Store(&timeouts)
+}
+
+// idleTTL returns how long an idle image stays mounted.
+func (s *Store) idleTTL() time.Duration {
+	return time.Duration(s.mountTTL.Load())
+}
+
+// timeoutConfig returns the current timeouts of loop operations.
+func (s *Store) timeoutConfig() TimeoutConfig {
+	return *s.timeouts.Load()
+}
+
 // UnmountAll unmounts all currently mounted loop images.
 // This is called during server shutdown to ensure clean unmounting.
 func (s *Store) UnmountAll() error {
@@ -156,19 +190,20 @@ func (s *Store) ensureTempDir() error {
 
 // calculateTimeout calculates appropriate timeout for operations based on file size and operation type.
 func (s *Store) calculateTimeout(sizeInBytes int64, timeoutPerGB time.Duration) time.Duration {
+	timeouts := s.timeoutConfig()
 	if sizeInBytes <= 0 {
-		return s.timeouts.MinLongOpTimeout
+		return timeouts.MinLongOpTimeout
 	}
 
 	sizeInGB := float64(sizeInBytes) / bytesToGB
 	timeout := time.Duration(sizeInGB * float64(timeoutPerGB))
 
 	// Ensure timeout is within reasonable bounds
-	if timeout < s.timeouts.MinLongOpTimeout {
-		timeout = s.timeouts.MinLongOpTimeout
+	if timeout < timeouts.MinLongOpTimeout {
+		timeout = timeouts.MinLongOpTimeout
 	}
-	if timeout > s.timeouts.MaxLongOpTimeout {
-		timeout = s.timeouts.MaxLongOpTimeout
+	if timeout > timeouts.MaxLongOpTimeout {
+		timeout = timeouts.MaxLongOpTimeout
 	}
 
 	return timeout
@@ -176,17 +211,17 @@ func (s *Store) calculateTimeout(sizeInBytes int64, timeoutPerGB time.Duration)
 
 // getDDTimeout returns appropriate timeout for dd operations based on file size.
 func (s *Store) getDDTimeout(sizeInBytes int64) time.Duration {
-	return s.calculateTimeout(sizeInBytes, s.timeouts.DDTimeoutPerGB)
+	return s.calculateTimeout(sizeInBytes, s.timeoutConfig().DDTimeoutPerGB)
 }
 
 // getMkfsTimeout returns appropriate timeout for mkfs operations based on file size.
 func (s *Store) getMkfsTimeout(sizeInBytes int64) time.Duration {
-	return s.calculateTimeout(sizeInBytes, s.timeouts.MkfsTimeoutPerGB)
+	return s.calculateTimeout(sizeInBytes, s.timeoutConfig().MkfsTimeoutPerGB)
 }
 
 // getRsyncTimeout returns appropriate timeout for rsync operations based on estimated data size.
 func (s *Store) getRsyncTimeout(sizeInBytes int64) time.Duration {
-	return s.calculateTimeout(sizeInBytes, s.timeouts.RsyncTimeoutPerGB)
+	return s.calculateTimeout(sizeInBytes, s.timeoutConfig().RsyncTimeoutPerGB)
 }
 
 // getLoopFilePath returns the loop file path for a given hash in hierarchical structure.
@@ -403,7 +438,7 @@ func (s *Store) decrementRefCount(mountPoint string) {
 		// Signal any waiters (e.g., resize operations) that ref count is zero
 		s.quiescenceCond.Broadcast()
 
-		if s.mountTTL <= 0 {
+		if s.idleTTL() <= 0 {
 			unmountNow = true
 		} else {
 			s.scheduleUnmount(mountPoint)
@@ -411,7 +446,7 @@ func (s *Store) decrementRefCount(mountPoint string) {
 	}
 
 	if unmountNow {
-		if err := s.unmountMountPoint(mountPoint); err != nil {
+		if err := s.unmountMountPoint(context.Background(), mountPoint); err != nil {
 			log.Error().Err(err).Str("mount_point", mountPoint).Msg("Failed to unmount loop file during cleanup")
 		}
 	}
@@ -443,12 +478,14 @@ func (s *Store) stopMountTimer(mountPoint string) {
 		timer.Stop()
 		delete(s.mountTimers, mountPoint)
 	}
+	delete(s.unmountDeadlines, mountPoint)
 }
 
 // scheduleUnmount schedules an unmount after the mount TTL expires.
 // Protected by timerMutex.
 func (s *Store) scheduleUnmount(mountPoint string) {
-	if s.mountTTL <= 0 {
+	ttl := s.idleTTL()
+	if ttl <= 0 {
 		return
 	}
 
@@ -459,10 +496,11 @@ func (s *Store) scheduleUnmount(mountPoint string) {
 		timer.Stop()
 	}
 
-	timer := time.AfterFunc(s.mountTTL, func() {
+	timer := time.AfterFunc(ttl, func() {
 		s.handleMountTimeout(mountPoint)
 	})
 	s.mountTimers[mountPoint] = timer
+	s.unmountDeadlines[mountPoint] = time.Now().Add(ttl)
 }
 
 func (s *Store) handleMountTimeout(mountPoint string) {
@@ -474,14 +512,24 @@ func (s *Store) handleMountTimeout(mountPoint string) {
 	// Clean up timer entry
 	s.timerMutex.Lock()
 	delete(s.mountTimers, mountPoint)
+	delete(s.unmountDeadlines, mountPoint)
 	s.timerMutex.Unlock()
 
-	if err := s.unmountMountPoint(mountPoint); err != nil {
+	// Check again under the mount lock: a reference taken meanwhile, such as one pinning the
+	// mount while it is inspected, keeps the image mounted
+	mountLock := s.getMountLock(mountPoint)
+	mountLock.Lock()
+	defer mountLock.Unlock()
+	if s.getCurrentRefCount(mountPoint) > 0 {
+		return
+	}
+
+	if err := s.unmountMountPointLocked(context.Background(), mountPoint); err != nil {
 		log.Error().Err(err).Str("mount_point", mountPoint).Msg("Failed to unmount idle loop file")
 		return
 	}
 
-	log.Debug().Str("mount_point", mountPoint).Dur("idle_ttl", s.mountTTL).Msg("Unmounted idle loop file after inactivity")
+	log.Debug().Str("mount_point", mountPoint).Dur("idle_ttl", s.idleTTL()).Msg("Unmounted idle loop file after inactivity")
 }
 
 // findFileInLoop searches for a file in the mounted loop filesystem and returns the actual file path.
@@ -510,7 +558,7 @@ func (s *Store) findFileInLoop(hash string) (string, error) {
 }
 
 // createLoopFile creates a new loop file and formats it with ext4.
-func (s *Store) createLoopFile(hash string) error {
+func (s *Store) createLoopFile(ctx context.Context, hash string) error {
 	loopFilePath := s.getLoopFilePath(hash)
 
 	// Create directory structure for loop file
@@ -525,10 +573,10 @@ func (s *Store) createLoopFile(hash string) error {
 
 	// Create the loop file with size-based timeout
 	ddTimeout := s.getDDTimeout(fileSizeBytes)
-	ctx, cancel := context.WithTimeout(context.Background(), ddTimeout)
+	ddCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ddTimeout)
 	defer cancel()
 	//nolint:gosec // loopFilePath is constructed from validated hash, not user input
-	cmd := exec.CommandContext(ctx, "dd", "if=/dev/zero",
+	cmd := exec.CommandContext(ddCtx, "dd", "if=/dev/zero",
 		"of="+loopFilePath,
 		"bs="+blockSize,
 		fmt.Sprintf("count=%d", s.loopFileSize))
@@ -539,17 +587,17 @@ func (s *Store) createLoopFile(hash string) error {
 		Dur("timeout", ddTimeout).
 		Msg("Creating loop file with calculated timeout")
 
-	if err := cmd.Run(); err != nil {
+	if err := runCommand(ddCtx, cmd); err != nil {
 		log.Error().Err(err).Str("loop_file", loopFilePath).Dur("timeout", ddTimeout).Msg("Failed to create loop file")
 		return err
 	}
 
 	// Format with ext4 using size-based timeout
 	mkfsTimeout := s.getMkfsTimeout(fileSizeBytes)
-	ctx2, cancel2 := context.WithTimeout(context.Background(), mkfsTimeout)
+	mkfsCtx, cancel2 := context.WithTimeout(context.WithoutCancel(ctx), mkfsTimeout)
 	defer cancel2()
 	//nolint:gosec // loopFilePath is constructed from validated hash, not user input
-	cmd = exec.CommandContext(ctx2, "mkfs.ext4", "-q", loopFilePath)
+	cmd = exec.CommandContext(mkfsCtx, "mkfs.ext4", "-q", loopFilePath)
 
 	log.Debug().
 		Str("loop_file", loopFilePath).
@@ -557,7 +605,7 @@ func (s *Store) createLoopFile(hash string) error {
 		Dur("timeout", mkfsTimeout).
 		Msg("Formatting loop file with calculated timeout")
 
-	if err := cmd.Run(); err != nil {
+	if err := runCommand(mkfsCtx, cmd); err != nil {
 		log.Error().Err(err).Str("loop_file", loopFilePath).Dur("timeout", mkfsTimeout).Msg("Failed to format loop file")
 		if removeErr := os.Remove(loopFilePath); removeErr != nil {
 			log.Error().Err(removeErr).Str("loop_file", loopFilePath).Msg("Failed to remove loop file during cleanup")
@@ -565,6 +613,7 @@ func (s *Store) createLoopFile(hash string) error {
 		return err
 	}
 
+	imagesCreatedTotal.Inc()
 	log.Debug().
 		Str("loop_file", loopFilePath).
 		Int64("size_mb", s.loopFileSize).
@@ -576,10 +625,15 @@ func (s *Store) createLoopFile(hash string) error {
 
 // mountLoopFile mounts a loop file to its mount point.
 // Uses per-mount-point locking to allow parallel mounts to different mount points.
-func (s *Store) mountLoopFile(hash string) error {
+func (s *Store) mountLoopFile(ctx context.Context, hash string) (err error) {
 	loopFilePath := s.getLoopFilePath(hash)
 	mountPoint := s.getMountPoint(hash)
 
+	ctx, span := tracing.StartSpan(ctx, "loop.mount", attribute.String("loopfs.mount_point", mountPoint))
+	defer func() {
+		span.End(err)
+	}()
+
 	// Use per-mount-point lock instead of global lock
 	mountLock := s.getMountLock(mountPoint)
 	mountLock.Lock()
@@ -597,34 +651,59 @@ func (s *Store) mountLoopFile(hash string) error {
 		return nil
 	}
 
+	// A degraded image stays unmounted until it is repaired, and an image that was not
+	// cleanly unmounted is checked before it is mounted again
+	if err := s.checkDegradedImage(hash); err != nil {
+		return err
+	}
+	if err := s.checkDirtyImage(ctx, hash); err != nil {
+		return err
+	}
+	if err := s.markDirty(hash); err != nil {
+		return err
+	}
+
 	// Mount the loop file using base timeout (mount is fast)
-	ctx, cancel := context.WithTimeout(context.Background(), s.timeouts.BaseCommandTimeout)
+	mountCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeoutConfig().BaseCommandTimeout)
 	defer cancel()
 	//nolint:gosec // loopFilePath and mountPoint are constructed from validated hash, not user input
-	cmd := exec.CommandContext(ctx, "mount", "-o", "loop", loopFilePath, mountPoint)
-	if err := cmd.Run(); err != nil {
+	cmd := exec.CommandContext(mountCtx, "mount", "-o", "loop", loopFilePath, mountPoint)
+	if err := runCommand(mountCtx, cmd); err != nil {
 		log.Error().Err(err).Str("loop_file", loopFilePath).Str("mount_point", mountPoint).Msg("Failed to mount loop file")
+		s.markClean(mountPoint)
+		mountsTotal.WithLabelValues(resultFailure).Inc()
 		return err
 	}
+	mountsTotal.WithLabelValues(resultSuccess).Inc()
 
 	log.Debug().Str("loop_file", loopFilePath).Str("mount_point", mountPoint).Msg("Loop file mounted")
 	return nil
 }
 
 // unmountLoopFile unmounts a loop file from its mount point.
-func (s *Store) unmountLoopFile(hash string) error {
+func (s *Store) unmountLoopFile(ctx context.Context, hash string) error {
 	mountPoint := s.getMountPoint(hash)
-	return s.unmountMountPoint(mountPoint)
+	return s.unmountMountPoint(ctx, mountPoint)
 }
 
 // unmountMountPoint unmounts a specific mount point.
 // Uses per-mount-point locking to allow parallel unmounts to different mount points.
-func (s *Store) unmountMountPoint(mountPoint string) error {
+func (s *Store) unmountMountPoint(ctx context.Context, mountPoint string) error {
 	// Use per-mount-point lock instead of global lock
 	mountLock := s.getMountLock(mountPoint)
 	mountLock.Lock()
 	defer mountLock.Unlock()
 
+	return s.unmountMountPointLocked(ctx, mountPoint)
+}
+
+// unmountMountPointLocked unmounts a mount point. The mount lock of the mount point must be held.
+func (s *Store) unmountMountPointLocked(ctx context.Context, mountPoint string) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "loop.unmount", attribute.String("loopfs.mount_point", mountPoint))
+	defer func() {
+		span.End(err)
+	}()
+
 	// Check if mounted
 	if !s.isMounted(mountPoint) {
 		log.Debug().Str("mount_point", mountPoint).Msg("Loop file not mounted")
@@ -632,14 +711,18 @@ func (s *Store) unmountMountPoint(mountPoint string) error {
 	}
 
 	// Unmount using base timeout (unmount is fast)
-	ctx, cancel := context.WithTimeout(context.Background(), s.timeouts.BaseCommandTimeout)
+	umountCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeoutConfig().BaseCommandTimeout)
 	defer cancel()
 	//nolint:gosec // mountPoint is constructed from validated hash, not user input
-	cmd := exec.CommandContext(ctx, "umount", mountPoint)
-	if err := cmd.Run(); err != nil {
+	cmd := exec.CommandContext(umountCtx, "umount", mountPoint)
+	if err := runCommand(umountCtx, cmd); err != nil {
 		log.Error().Err(err).Str("mount_point", mountPoint).Msg("Failed to unmount loop file")
+		unmountsTotal.WithLabelValues(resultFailure).Inc()
 		return err
 	}
+	unmountsTotal.WithLabelValues(resultSuccess).Inc()
+	s.dropPackIndex(mountPoint)
+	s.markClean(mountPoint)
 
 	log.Debug().Str("mount_point", mountPoint).Msg("Loop file unmounted")
 	return nil
@@ -670,7 +753,7 @@ func (s *Store) isMounted(mountPoint string) bool {
 // withMountedLoop executes a function with the loop file mounted, ensuring cleanup.
 // Uses reference counting to prevent premature unmounting when multiple operations are concurrent.
 // Coordinates with resize operations to prevent conflicts.
-func (s *Store) withMountedLoop(hash string, callback func() error) error {
+func (s *Store) withMountedLoop(ctx context.Context, hash string, callback func() error) error {
 	loopFilePath := s.getLoopFilePath(hash)
 	mountPoint := s.getMountPoint(hash)
 
@@ -688,7 +771,7 @@ func (s *Store) withMountedLoop(hash string, callback func() error) error {
 
 	// Check if loop file exists, create if not (synchronized)
 	if _, err := os.Stat(loopFilePath); os.IsNotExist(err) {
-		if err := s.createLoopFile(hash); err != nil {
+		if err := s.createLoopFile(ctx, hash); err != nil {
 			creationMutex.Unlock()
 			return err
 		}
@@ -702,7 +785,7 @@ func (s *Store) withMountedLoop(hash string, callback func() error) error {
 	// Increment reference count - mount only if this is the first reference
 	shouldMount := s.incrementRefCount(mountPoint)
 	if shouldMount {
-		if err := s.mountLoopFile(hash); err != nil {
+		if err := s.mountLoopFile(ctx, hash); err != nil {
 			s.signalMountReady(mountPoint, err)
 			// If mount fails, decrement the reference count we just added
 			s.decrementRefCount(mountPoint)
@@ -727,7 +810,7 @@ func (s *Store) withMountedLoop(hash string, callback func() error) error {
 // but assumes the resize lock has already been acquired by the caller.
 // This is used to avoid double-locking in methods that need to check existence before mounting.
 // This version does NOT create the loop file if it doesn't exist.
-func (s *Store) withMountedLoopUnlocked(hash string, callback func() error) error {
+func (s *Store) withMountedLoopUnlocked(ctx context.Context, hash string, callback func() error) error {
 	loopFilePath := s.getLoopFilePath(hash)
 	mountPoint := s.getMountPoint(hash)
 
@@ -752,7 +835,7 @@ func (s *Store) withMountedLoopUnlocked(hash string, callback func() error) erro
 	// Increment reference count - mount only if this is the first reference
 	shouldMount := s.incrementRefCount(mountPoint)
 	if shouldMount {
-		if err := s.mountLoopFile(hash); err != nil {
+		if err := s.mountLoopFile(ctx, hash); err != nil {
 			s.signalMountReady(mountPoint, err)
 			// If mount fails, decrement the reference count we just added
 			s.decrementRefCount(mountPoint)
@@ -797,6 +880,7 @@ func (s *Store) collectMountPoints() []string {
 	}
 	// Clear the timers map
 	s.mountTimers = make(map[string]*time.Timer)
+	s.unmountDeadlines = make(map[string]time.Time)
 	s.timerMutex.Unlock()
 
 	// Convert map to slice
@@ -813,7 +897,7 @@ func (s *Store) unmountAllMountPoints(mountPoints []string) error {
 	var lastErr error
 	for _, mountPoint := range mountPoints {
 		log.Debug().Str("mount_point", mountPoint).Msg("Unmounting loop image during shutdown")
-		if err := s.unmountMountPoint(mountPoint); err != nil {
+		if err := s.unmountMountPoint(context.Background(), mountPoint); err != nil {
 			log.Error().Err(err).Str("mount_point", mountPoint).Msg("Failed to unmount loop image during shutdown")
 			lastErr = err
 			// Continue unmounting others even if one fails
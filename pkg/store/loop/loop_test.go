@@ -1,6 +1,7 @@
 package loop
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -203,14 +204,14 @@ func (s *LoopStoreTestSuite) TestValidateHash() {
 
 // TestExistsWhenFileDoesNotExist tests Exists method when file doesn't exist
 func (s *LoopStoreTestSuite) TestExistsWhenFileDoesNotExist() {
-	exists, err := s.store.Exists(s.testHash)
+	exists, err := s.store.Exists(context.Background(), s.testHash)
 	s.NoError(err)
 	s.False(exists)
 }
 
 // TestExistsWithInvalidHash tests Exists method with invalid hash
 func (s *LoopStoreTestSuite) TestExistsWithInvalidHash() {
-	exists, err := s.store.Exists("invalid")
+	exists, err := s.store.Exists(context.Background(), "invalid")
 	s.Error(err)
 	s.False(exists)
 	s.IsType(store.InvalidHashError{}, err)
@@ -218,42 +219,42 @@ func (s *LoopStoreTestSuite) TestExistsWithInvalidHash() {
 
 // TestGetFileInfoWithInvalidHash tests GetFileInfo with invalid hash
 func (s *LoopStoreTestSuite) TestGetFileInfoWithInvalidHash() {
-	_, err := s.store.GetFileInfo("invalid")
+	_, err := s.store.GetFileInfo(context.Background(), "invalid")
 	s.Error(err)
 	s.IsType(store.InvalidHashError{}, err)
 }
 
 // TestGetFileInfoWhenFileDoesNotExist tests GetFileInfo when file doesn't exist
 func (s *LoopStoreTestSuite) TestGetFileInfoWhenFileDoesNotExist() {
-	_, err := s.store.GetFileInfo(s.testHash)
+	_, err := s.store.GetFileInfo(context.Background(), s.testHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err)
 }
 
 // TestGetDiskUsageWithInvalidHash tests GetDiskUsage with invalid hash
 func (s *LoopStoreTestSuite) TestGetDiskUsageWithInvalidHash() {
-	_, err := s.store.GetDiskUsage("invalid")
+	_, err := s.store.GetDiskUsage(context.Background(), "invalid")
 	s.Error(err)
 	s.IsType(store.InvalidHashError{}, err)
 }
 
 // TestGetDiskUsageWhenFileDoesNotExist tests GetDiskUsage when file doesn't exist
 func (s *LoopStoreTestSuite) TestGetDiskUsageWhenFileDoesNotExist() {
-	_, err := s.store.GetDiskUsage(s.testHash)
+	_, err := s.store.GetDiskUsage(context.Background(), s.testHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err)
 }
 
 // TestDeleteWithInvalidHash tests Delete with invalid hash
 func (s *LoopStoreTestSuite) TestDeleteWithInvalidHash() {
-	err := s.store.Delete("invalid")
+	err := s.store.Delete(context.Background(), "invalid")
 	s.Error(err)
 	s.IsType(store.InvalidHashError{}, err)
 }
 
 // TestDeleteWhenFileDoesNotExist tests Delete when file doesn't exist
 func (s *LoopStoreTestSuite) TestDeleteWhenFileDoesNotExist() {
-	err := s.store.Delete(s.testHash)
+	err := s.store.Delete(context.Background(), s.testHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err)
 }
@@ -270,7 +271,7 @@ func (s *LoopStoreTestSuite) TestUploadBasic() {
 	reader := strings.NewReader(content)
 	filename := "test.txt"
 
-	result, err := s.store.Upload(reader, filename)
+	result, err := s.store.Upload(context.Background(), reader, filename)
 	if err != nil {
 		// If upload fails due to mount issues, we expect specific errors
 		s.T().Logf("Upload failed (expected in test env): %v", err)
@@ -292,14 +293,14 @@ func (e errorReader) Read(p []byte) (n int, err error) {
 // TestUploadErrorConditions tests upload error conditions that don't require root
 func (s *LoopStoreTestSuite) TestUploadErrorConditions() {
 	// Test with error reader to test error handling path
-	result, err := s.store.Upload(errorReader{}, "test.txt")
+	result, err := s.store.Upload(context.Background(), errorReader{}, "test.txt")
 	s.Error(err)
 	s.Nil(result)
 	s.Contains(err.Error(), "test read error")
 
 	// Test with valid content but expect failure due to mount issues
 	reader := strings.NewReader("test content")
-	result, err = s.store.Upload(reader, "test.txt")
+	result, err = s.store.Upload(context.Background(), reader, "test.txt")
 	// Will typically fail due to mount issues, but accept either outcome
 	if err != nil {
 		s.Nil(result)
@@ -320,16 +321,16 @@ func (s *LoopStoreTestSuite) TestCaseInsensitiveHash() {
 
 	// Store operations should handle case conversion internally
 	// Both upper and lower case hashes should work the same way now
-	_, err1 := s.store.Exists(upperHash)
-	_, err2 := s.store.Exists(lowerHash)
+	_, err1 := s.store.Exists(context.Background(), upperHash)
+	_, err2 := s.store.Exists(context.Background(), lowerHash)
 
 	// Both should return the same result (nil for non-existent file) since case is normalized
 	s.NoError(err1)
 	s.NoError(err2)
 
 	// Test Delete with mixed case - both should work the same
-	err3 := s.store.Delete(upperHash)
-	err4 := s.store.Delete(lowerHash)
+	err3 := s.store.Delete(context.Background(), upperHash)
+	err4 := s.store.Delete(context.Background(), lowerHash)
 
 	// Both should return FileNotFoundError since file doesn't exist
 	s.IsType(store.FileNotFoundError{}, err3)
@@ -350,10 +351,10 @@ func (s *LoopStoreTestSuite) TestConcurrentAccess() {
 			// Each goroutine tries different operations
 			hash := s.testHash
 
-			s.store.Exists(hash)
+			s.store.Exists(context.Background(), hash)
 			s.store.ValidateHash(hash)
-			s.store.GetFileInfo(hash)  // Expected to fail
-			s.store.GetDiskUsage(hash) // Expected to fail
+			s.store.GetFileInfo(context.Background(), hash)  // Expected to fail
+			s.store.GetDiskUsage(context.Background(), hash) // Expected to fail
 		}(i)
 	}
 
@@ -406,7 +407,7 @@ func (s *LoopStoreTestSuite) TestIsMounted() {
 func (s *LoopStoreTestSuite) TestCreateLoopFile() {
 	// Test with valid hash but may succeed in test environment
 	validHash := "abcd123456789012345678901234567890123456789012345678901234567890"
-	err := s.store.createLoopFile(validHash)
+	err := s.store.createLoopFile(context.Background(), validHash)
 	// Either succeeds or fails gracefully, both are acceptable in test env
 	if err != nil {
 		s.T().Logf("createLoopFile failed as expected: %v", err)
@@ -418,7 +419,7 @@ func (s *LoopStoreTestSuite) TestCreateLoopFile() {
 	if os.Getuid() != 0 {
 		// Create store with restricted directory
 		restrictedStore := NewWithDefaults("/root/restricted", 10)
-		err := restrictedStore.createLoopFile(validHash)
+		err := restrictedStore.createLoopFile(context.Background(), validHash)
 		s.Error(err) // Should fail due to permission denied
 	}
 }
@@ -428,11 +429,11 @@ func (s *LoopStoreTestSuite) TestMountUnmountOperations() {
 	validHash := "abcd123456789012345678901234567890123456789012345678901234567890"
 
 	// Test mount without existing loop file
-	err := s.store.mountLoopFile(validHash)
+	err := s.store.mountLoopFile(context.Background(), validHash)
 	s.Error(err) // Should fail because loop file doesn't exist
 
 	// Test unmount on non-mounted path
-	err = s.store.unmountLoopFile(validHash)
+	err = s.store.unmountLoopFile(context.Background(), validHash)
 	s.NoError(err) // Should succeed (idempotent)
 }
 
@@ -442,7 +443,7 @@ func (s *LoopStoreTestSuite) TestWithMountedLoop() {
 
 	// Test with callback that should fail due to missing loop file
 	callbackCalled := false
-	err := s.store.withMountedLoop(validHash, func() error {
+	err := s.store.withMountedLoop(context.Background(), validHash, func() error {
 		callbackCalled = true
 		return nil
 	})
@@ -457,7 +458,7 @@ func (s *LoopStoreTestSuite) TestExistsEdgeCases() {
 	validHash := "abcd123456789012345678901234567890123456789012345678901234567890"
 
 	// Test with valid hash but missing loop file
-	exists, err := s.store.Exists(validHash)
+	exists, err := s.store.Exists(context.Background(), validHash)
 	s.NoError(err) // Should not error, just return false
 	s.False(exists)
 }
@@ -467,7 +468,7 @@ func (s *LoopStoreTestSuite) TestGetFileInfoEdgeCases() {
 	validHash := "abcd123456789012345678901234567890123456789012345678901234567890"
 
 	// Test with valid hash but missing loop file
-	_, err := s.store.GetFileInfo(validHash)
+	_, err := s.store.GetFileInfo(context.Background(), validHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err)
 }
@@ -477,7 +478,7 @@ func (s *LoopStoreTestSuite) TestGetDiskUsageEdgeCases() {
 	validHash := "abcd123456789012345678901234567890123456789012345678901234567890"
 
 	// Test with valid hash but missing loop file
-	_, err := s.store.GetDiskUsage(validHash)
+	_, err := s.store.GetDiskUsage(context.Background(), validHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err)
 }
@@ -487,7 +488,7 @@ func (s *LoopStoreTestSuite) TestDeleteEdgeCases() {
 	validHash := "abcd123456789012345678901234567890123456789012345678901234567890"
 
 	// Test deleting non-existent file
-	err := s.store.Delete(validHash)
+	err := s.store.Delete(context.Background(), validHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err)
 }
@@ -510,6 +511,22 @@ func (s *LoopStoreTestSuite) TestConstants() {
 	s.Equal(defaultMaxLongTimeoutMins*time.Minute, defaultTimeouts.MaxLongOpTimeout)
 }
 
+// TestSetTimeoutsAndMountTTL tests changing timeouts and the mount TTL at runtime
+func (s *LoopStoreTestSuite) TestSetTimeoutsAndMountTTL() {
+	s.Equal(defaultMountCacheTTL, s.store.idleTTL())
+	s.store.SetMountTTL(time.Minute)
+	s.Equal(time.Minute, s.store.idleTTL())
+	s.store.SetMountTTL(0)
+	s.Equal(defaultMountCacheTTL, s.store.idleTTL())
+
+	timeouts := DefaultTimeoutConfig()
+	timeouts.DDTimeoutPerGB = time.Hour
+	timeouts.MaxLongOpTimeout = 2 * time.Hour
+	s.store.SetTimeouts(timeouts)
+	s.Equal(time.Hour, s.store.getDDTimeout(1<<30))
+	s.Equal(timeouts.MinLongOpTimeout, s.store.getDDTimeout(0))
+}
+
 // TestErrorTypes tests custom error type handling
 func (s *LoopStoreTestSuite) TestErrorTypes() {
 	// Test InvalidHashError
@@ -600,7 +617,7 @@ func (s *LoopStoreTestSuite) TestExistsWithMountedLoop() {
 	validHash := s.testHash
 
 	// Test with valid hash but no loop file - should return false, no error
-	exists, err := s.store.Exists(validHash)
+	exists, err := s.store.Exists(context.Background(), validHash)
 	s.NoError(err)
 	s.False(exists)
 }
@@ -610,7 +627,7 @@ func (s *LoopStoreTestSuite) TestGetFileInfoWithMountedLoop() {
 	validHash := s.testHash
 
 	// Test with valid hash but no loop file
-	_, err := s.store.GetFileInfo(validHash)
+	_, err := s.store.GetFileInfo(context.Background(), validHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err)
 }
@@ -620,7 +637,7 @@ func (s *LoopStoreTestSuite) TestGetDiskUsageWithMountedLoop() {
 	validHash := s.testHash
 
 	// Test with valid hash but no loop file
-	_, err := s.store.GetDiskUsage(validHash)
+	_, err := s.store.GetDiskUsage(context.Background(), validHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err)
 }
@@ -630,7 +647,7 @@ func (s *LoopStoreTestSuite) TestDeleteWithMountedLoop() {
 	validHash := s.testHash
 
 	// Test with a valid hash but no loop file
-	err := s.store.Delete(validHash)
+	err := s.store.Delete(context.Background(), validHash)
 	s.Error(err)
 	s.IsType(store.FileNotFoundError{}, err)
 }
@@ -646,7 +663,7 @@ func (s *LoopStoreTestSuite) TestWithMountedLoopCallback() {
 	validHash := s.testHash
 
 	// Test callback that returns an error
-	err := s.store.withMountedLoop(validHash, func() error {
+	err := s.store.withMountedLoop(context.Background(), validHash, func() error {
 		return fmt.Errorf("callback error")
 	})
 	// Should get the callback error or mount error
@@ -654,7 +671,7 @@ func (s *LoopStoreTestSuite) TestWithMountedLoopCallback() {
 	s.T().Logf("withMountedLoop callback error: %v", err)
 
 	// Test callback that succeeds (will fail at mount stage)
-	err = s.store.withMountedLoop(validHash, func() error {
+	err = s.store.withMountedLoop(context.Background(), validHash, func() error {
 		return nil
 	})
 	// Should get mount error in test environment
@@ -667,7 +684,7 @@ func (s *LoopStoreTestSuite) TestUnmountLoopFileNotMounted() {
 	validHash := s.testHash
 
 	// Test unmounting when not mounted - should succeed silently
-	err := s.store.unmountLoopFile(validHash)
+	err := s.store.unmountLoopFile(context.Background(), validHash)
 	s.NoError(err)
 }
 
@@ -0,0 +1,104 @@
+package loop
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"loopfs/pkg/metrics"
+	"loopfs/pkg/models"
+)
+
+// Metric result labels.
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	mountsTotal = metrics.NewCounterVec("loopfs_loop_mounts_total",
+		"Loop image mounts by result.", "result")
+	unmountsTotal = metrics.NewCounterVec("loopfs_loop_unmounts_total",
+		"Loop image unmounts by result.", "result")
+	mountedImages = metrics.NewGauge("loopfs_loop_mounted_images",
+		"Loop images currently mounted, updated when metrics are collected.")
+	imagesCreatedTotal = metrics.NewCounter("loopfs_loop_images_created_total",
+		"Loop images created and formatted.")
+	resizeDuration = metrics.NewHistogramVec("loopfs_loop_resize_duration_seconds",
+		"Duration of loop image resizes by result.", metrics.ExponentialBuckets(1, 2, 12), "result")
+	rsyncBytesTotal = metrics.NewCounter("loopfs_loop_rsync_bytes_total",
+		"Bytes of filesystem data copied by rsync during resizes.")
+	activeStreams = metrics.NewGauge("loopfs_loop_active_streams",
+		"Streaming download readers currently open.")
+	streamDuration = metrics.NewHistogram("loopfs_loop_stream_duration_seconds",
+		"Lifetime of streaming download readers from open to close.", metrics.ExponentialBuckets(0.001, 4, 10))
+	fsckTotal = metrics.NewCounterVec("loopfs_loop_fsck_total",
+		"Filesystem checks by outcome: clean, corrected, degraded or failed.", "result")
+	degradedImages = metrics.NewGauge("loopfs_loop_degraded_images",
+		"Loop images whose last filesystem check found uncorrected errors, updated when metrics are collected.")
+)
+
+// rsyncTransferredRe matches the transferred size line of rsync --stats output.
+var rsyncTransferredRe = regexp.MustCompile(`Total transferred file size: ([\d,]+) bytes`)
+
+// resultLabel maps an operation error to a metric result label.
+func resultLabel(err error) string {
+	if err != nil {
+		return resultFailure
+	}
+	return resultSuccess
+}
+
+// observeResize records the duration and outcome of a resize started at start.
+func observeResize(start time.Time, err error) {
+	resizeDuration.WithLabelValues(resultLabel(err)).Observe(time.Since(start).Seconds())
+}
+
+// observeFsck counts a filesystem check by outcome.
+func observeFsck(result *models.FsckResult, err error) {
+	outcome := "failed"
+	switch {
+	case err != nil:
+	case result.Clean:
+		outcome = "clean"
+	case result.ExitCode >= fsckUncorrectedExit:
+		outcome = "degraded"
+	default:
+		outcome = "corrected"
+	}
+	fsckTotal.WithLabelValues(outcome).Inc()
+}
+
+// UpdateMetrics refreshes the gauges that are derived from the store state rather than
+// maintained as operations happen. It is called before metrics are exposed.
+func (s *Store) UpdateMetrics() {
+	paths, err := filepath.Glob(filepath.Join(s.storageDir, "*", "*", loopFileName))
+	if err == nil {
+		mounted := 0
+		for _, path := range paths {
+			loopDir := filepath.Dir(path)
+			prefix := filepath.Base(filepath.Dir(loopDir)) + filepath.Base(loopDir)
+			if s.isMounted(s.getMountPoint(prefix)) {
+				mounted++
+			}
+		}
+		mountedImages.Set(float64(mounted))
+	}
+
+	degradedImages.Set(float64(len(s.DegradedImages())))
+}
+
+// parseRsyncTransferred extracts the transferred byte count from rsync --stats output.
+func parseRsyncTransferred(output string) int64 {
+	match := rsyncTransferredRe.FindStringSubmatch(output)
+	if match == nil {
+		return 0
+	}
+	transferred, err := strconv.ParseInt(strings.ReplaceAll(match[1], ",", ""), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return transferred
+}
@@ -0,0 +1,86 @@
+package loop
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"loopfs/pkg/models"
+)
+
+// MetricsTestSuite tests loop store instrumentation
+type MetricsTestSuite struct {
+	suite.Suite
+	tempDir string
+	store   *Store
+}
+
+// SetupTest runs before each test
+func (s *MetricsTestSuite) SetupTest() {
+	s.tempDir = s.T().TempDir()
+	s.store = NewWithDefaults(s.tempDir, 10)
+}
+
+// TestParseRsyncTransferred tests parsing of rsync --stats output
+func (s *MetricsTestSuite) TestParseRsyncTransferred() {
+	output := "Number of files: 12 (reg: 10, dir: 2)\n" +
+		"Total file size: 2,345,678 bytes\n" +
+		"Total transferred file size: 1,234,567 bytes\n"
+	s.Equal(int64(1234567), parseRsyncTransferred(output))
+	s.Equal(int64(0), parseRsyncTransferred("rsync: no stats"))
+}
+
+// TestObserveFsck tests that checks are counted by outcome
+func (s *MetricsTestSuite) TestObserveFsck() {
+	clean := fsckTotal.WithLabelValues("clean").Value()
+	corrected := fsckTotal.WithLabelValues("corrected").Value()
+	degraded := fsckTotal.WithLabelValues("degraded").Value()
+	failed := fsckTotal.WithLabelValues("failed").Value()
+
+	observeFsck(&models.FsckResult{Clean: true}, nil)
+	observeFsck(&models.FsckResult{ExitCode: 1}, nil)
+	observeFsck(&models.FsckResult{ExitCode: fsckUncorrectedExit}, nil)
+	observeFsck(nil, errors.New("e2fsck not found"))
+
+	s.InDelta(clean+1, fsckTotal.WithLabelValues("clean").Value(), 0.0001)
+	s.InDelta(corrected+1, fsckTotal.WithLabelValues("corrected").Value(), 0.0001)
+	s.InDelta(degraded+1, fsckTotal.WithLabelValues("degraded").Value(), 0.0001)
+	s.InDelta(failed+1, fsckTotal.WithLabelValues("failed").Value(), 0.0001)
+}
+
+// TestUpdateMetrics tests the gauges derived from store state
+func (s *MetricsTestSuite) TestUpdateMetrics() {
+	loopDir := filepath.Join(s.tempDir, "ab", "cd")
+	s.Require().NoError(os.MkdirAll(filepath.Join(loopDir, "loopmount"), 0750))
+	s.Require().NoError(os.WriteFile(filepath.Join(loopDir, loopFileName), nil, 0600))
+	s.store.recordFsckResult(&models.FsckResult{Prefix: "abcd", ExitCode: fsckUncorrectedExit}, false)
+
+	s.store.UpdateMetrics()
+
+	s.InDelta(0, mountedImages.Value(), 0.0001)
+	s.InDelta(1, degradedImages.Value(), 0.0001)
+}
+
+// TestStreamingReaderMetrics tests that open streams are tracked until closed
+func (s *MetricsTestSuite) TestStreamingReaderMetrics() {
+	file, err := os.CreateTemp(s.tempDir, "stream-*")
+	s.Require().NoError(err)
+
+	active := activeStreams.Value()
+	observed := streamDuration.Count()
+
+	reader := s.store.newStreamingReader(file, nil, "abcd", filepath.Join(s.tempDir, "ab", "cd", "loopmount"), nil)
+	s.InDelta(active+1, activeStreams.Value(), 0.0001)
+
+	s.Require().NoError(reader.Close())
+	s.InDelta(active, activeStreams.Value(), 0.0001)
+	s.Equal(observed+1, streamDuration.Count())
+}
+
+// TestMetricsTestSuite runs the metrics test suite
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(MetricsTestSuite))
+}
@@ -0,0 +1,572 @@
+package loop
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/store"
+)
+
+const (
+	// packDirName is the directory inside each mounted loop filesystem that holds the pack files.
+	packDirName = ".pack"
+	// packDataName is the append-only file holding the packed blob contents.
+	packDataName = "pack.dat"
+	// packIndexName is the append-only index describing where each packed blob lives.
+	packIndexName = "pack.idx"
+	// packFilePerm is the permission used for pack data and index files.
+	packFilePerm = 0640
+	// packRecordPut marks an index record that adds a blob to the pack.
+	packRecordPut = "P"
+	// packRecordDelete marks an index record that removes a blob from the pack.
+	packRecordDelete = "D"
+	// packPutFields is the number of fields in a put record: op, hash, offset, size, created_at.
+	packPutFields = 5
+	// packDeleteFields is the number of fields in a delete record: op, hash.
+	packDeleteFields = 2
+	// minRepackDeadBytes is the amount of dead data a pack must hold before it is compacted automatically.
+	minRepackDeadBytes = 1024 * 1024
+	// packNewSuffix and packOldSuffix name the sibling directories used while swapping in a repacked pack.
+	packNewSuffix = ".new"
+	packOldSuffix = ".old"
+	// repackDeadRatio triggers an automatic repack once dead bytes exceed 1/repackDeadRatio of the pack.
+	repackDeadRatio = 2
+)
+
+// packEntry describes the location of a single blob within a pack file.
+type packEntry struct {
+	offset    int64
+	size      int64
+	createdAt time.Time
+}
+
+// packIndex is the in-memory view of the pack stored in one loop filesystem.
+// It is loaded lazily from pack.idx and dropped when the loop file is unmounted.
+type packIndex struct {
+	mu        sync.RWMutex
+	dir       string
+	entries   map[string]packEntry
+	dataSize  int64 // Total bytes in pack.dat, including dead entries
+	deadBytes int64 // Bytes in pack.dat that belong to deleted or orphaned entries
+}
+
+// SetPackThreshold sets the size in bytes below which blobs are appended to the per-image pack file
+// instead of being stored as individual files. A value of zero or less disables packing for new uploads;
+// blobs that are already packed keep being served.
+func (s *Store) SetPackThreshold(threshold int64) {
+	s.packThreshold.Store(threshold)
+}
+
+// shouldPack reports whether a blob of the given size should be stored in the pack file.
+func (s *Store) shouldPack(size int64) bool {
+	threshold := s.packThreshold.Load()
+	return threshold > 0 && size < threshold
+}
+
+// getPackDir returns the pack directory within the mounted loop filesystem for a given hash.
+func (s *Store) getPackDir(hash string) string {
+	mountPoint := s.getMountPoint(hash)
+	if mountPoint == "" {
+		return ""
+	}
+	return filepath.Join(mountPoint, packDirName)
+}
+
+// getPackIndex returns the pack index for the loop filesystem holding hash, loading it on first use.
+// The loop filesystem must already be mounted.
+func (s *Store) getPackIndex(hash string) (*packIndex, error) {
+	mountPoint := s.getMountPoint(hash)
+	if value, ok := s.packIndexes.Load(mountPoint); ok {
+		if index, ok := value.(*packIndex); ok {
+			return index, nil
+		}
+	}
+
+	index, err := loadPackIndex(s.getPackDir(hash))
+	if err != nil {
+		log.Error().Err(err).Str("mount_point", mountPoint).Msg("Failed to load pack index")
+		return nil, err
+	}
+
+	value, _ := s.packIndexes.LoadOrStore(mountPoint, index)
+	result, ok := value.(*packIndex)
+	if !ok {
+		// This should never happen as we control what's stored
+		s.packIndexes.Store(mountPoint, index)
+		result = index
+	}
+	return result, nil
+}
+
+// dropPackIndex forgets the cached pack index for a mount point.
+// Called whenever the loop filesystem is unmounted so the next mount reloads it from disk.
+func (s *Store) dropPackIndex(mountPoint string) {
+	s.packIndexes.Delete(mountPoint)
+}
+
+// packedEntry looks up a blob in the pack of an already-mounted loop filesystem.
+func (s *Store) packedEntry(hash string) (packEntry, bool, error) {
+	index, err := s.getPackIndex(hash)
+	if err != nil {
+		return packEntry{}, false, err
+	}
+	entry, found := index.lookup(hash)
+	return entry, found, nil
+}
+
+// savePackedWithinMountedLoop appends size bytes from src to the pack of an already-mounted loop filesystem.
+func (s *Store) savePackedWithinMountedLoop(hash string, src io.Reader, size int64) error {
+	index, err := s.getPackIndex(hash)
+	if err != nil {
+		return err
+	}
+
+	if err := index.add(hash, src, size, s.syncOnWrite); err != nil {
+		log.Error().Err(err).Str("hash", hash).Str("pack_dir", index.dir).Msg("Failed to append blob to pack")
+		return err
+	}
+
+	log.Debug().Str("hash", hash).Int64("size", size).Str("pack_dir", index.dir).Msg("Blob appended to pack")
+	return nil
+}
+
+// openPackedReader opens a reader over a packed blob of an already-mounted loop filesystem.
+// The returned file must be closed by the caller; the reader is limited to the blob's bytes.
+func (s *Store) openPackedReader(hash string) (*os.File, io.Reader, error) {
+	index, err := s.getPackIndex(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return index.open(hash)
+}
+
+// deletePackedWithinMountedLoop removes a blob from the pack and compacts the pack when enough space is dead.
+func (s *Store) deletePackedWithinMountedLoop(hash string) error {
+	index, err := s.getPackIndex(hash)
+	if err != nil {
+		return err
+	}
+
+	removed, err := index.remove(hash, s.syncOnWrite)
+	if err != nil {
+		log.Error().Err(err).Str("hash", hash).Str("pack_dir", index.dir).Msg("Failed to remove blob from pack")
+		return err
+	}
+	if !removed {
+		return store.FileNotFoundError{Hash: hash}
+	}
+
+	log.Debug().Str("hash", hash).Str("pack_dir", index.dir).Msg("Packed blob deleted")
+
+	if index.needsRepack() {
+		if err := index.repack(s.syncOnWrite); err != nil {
+			// The delete itself succeeded; compaction will be retried on the next delete or explicit repack
+			log.Warn().Err(err).Str("pack_dir", index.dir).Msg("Failed to repack after delete")
+		}
+	}
+	return nil
+}
+
+// Repack compacts the pack file of the loop image holding hash, dropping deleted and orphaned entries.
+// Only the first four characters of hash are used to locate the image.
+func (s *Store) Repack(ctx context.Context, hash string) error {
+	hash = strings.ToLower(hash)
+	if !s.validatePrefix(hash) {
+		return store.InvalidHashError{Hash: hash}
+	}
+
+	loopFilePath := s.getLoopFilePath(hash)
+
+	resizeLock := s.getResizeLock(loopFilePath)
+	resizeLock.RLock()
+	defer resizeLock.RUnlock()
+
+	if _, err := os.Stat(loopFilePath); os.IsNotExist(err) {
+		return store.FileNotFoundError{Hash: hash}
+	} else if err != nil {
+		return err
+	}
+
+	return s.withMountedLoopUnlocked(ctx, hash, func() error {
+		index, err := s.getPackIndex(hash)
+		if err != nil {
+			return err
+		}
+		return index.repack(s.syncOnWrite)
+	})
+}
+
+// loadPackIndex reads the pack index from dir. A missing pack directory yields an empty index.
+func loadPackIndex(dir string) (*packIndex, error) {
+	index := &packIndex{
+		dir:     dir,
+		entries: make(map[string]packEntry),
+	}
+
+	if err := recoverPackDir(dir); err != nil {
+		return nil, err
+	}
+
+	dataInfo, err := os.Stat(filepath.Join(dir, packDataName))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	index.dataSize = dataInfo.Size()
+
+	//nolint:gosec // dir is constructed from validated hash, not user input
+	indexFile, err := os.Open(filepath.Join(dir, packIndexName))
+	if os.IsNotExist(err) {
+		index.deadBytes = index.dataSize
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := indexFile.Close(); err != nil {
+			log.Warn().Err(err).Str("pack_dir", dir).Msg("Failed to close pack index")
+		}
+	}()
+
+	if err := index.replay(indexFile); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// replay rebuilds the entry map from index records. Malformed records, such as a torn final line
+// after a crash, are skipped; data they describe is treated as dead and reclaimed by the next repack.
+func (p *packIndex) replay(reader io.Reader) error {
+	var liveBytes int64
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case fields[0] == packRecordPut && len(fields) == packPutFields:
+			entry, ok := parsePutRecord(fields)
+			if !ok || entry.offset+entry.size > p.dataSize {
+				continue
+			}
+			if old, exists := p.entries[fields[1]]; exists {
+				liveBytes -= old.size
+			}
+			p.entries[fields[1]] = entry
+			liveBytes += entry.size
+		case fields[0] == packRecordDelete && len(fields) == packDeleteFields:
+			if old, exists := p.entries[fields[1]]; exists {
+				liveBytes -= old.size
+				delete(p.entries, fields[1])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read pack index: %w", err)
+	}
+
+	p.deadBytes = p.dataSize - liveBytes
+	return nil
+}
+
+// parsePutRecord parses the offset, size and creation time of a put record.
+func parsePutRecord(fields []string) (packEntry, bool) {
+	offset, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || offset < 0 {
+		return packEntry{}, false
+	}
+	size, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil || size < 0 {
+		return packEntry{}, false
+	}
+	createdAt, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return packEntry{}, false
+	}
+	return packEntry{offset: offset, size: size, createdAt: time.Unix(0, createdAt)}, true
+}
+
+// lookup returns the entry for hash if it is present in the pack.
+func (p *packIndex) lookup(hash string) (packEntry, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	entry, found := p.entries[hash]
+	return entry, found
+}
+
+// add appends size bytes from src to pack.dat and records them in pack.idx.
+// Data is written before the index record so a crash can only leave orphaned bytes, never a dangling record.
+func (p *packIndex) add(hash string, src io.Reader, size int64, syncOnWrite bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := os.MkdirAll(p.dir, dirPerm); err != nil {
+		return err
+	}
+
+	dataFile, err := os.OpenFile(filepath.Join(p.dir, packDataName), os.O_CREATE|os.O_WRONLY, packFilePerm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := dataFile.Close(); err != nil {
+			log.Warn().Err(err).Str("pack_dir", p.dir).Msg("Failed to close pack data file")
+		}
+	}()
+
+	offset := p.dataSize
+	if _, err := dataFile.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	written, err := io.Copy(dataFile, io.LimitReader(src, size))
+	p.dataSize += written
+	if err == nil && written != size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && syncOnWrite {
+		err = dataFile.Sync()
+	}
+	if err != nil {
+		p.deadBytes += written
+		return err
+	}
+
+	createdAt := time.Now()
+	record := fmt.Sprintf("%s %s %d %d %d\n", packRecordPut, hash, offset, size, createdAt.UnixNano())
+	if err := p.appendRecord(record, syncOnWrite); err != nil {
+		p.deadBytes += written
+		return err
+	}
+
+	if old, exists := p.entries[hash]; exists {
+		p.deadBytes += old.size
+	}
+	p.entries[hash] = packEntry{offset: offset, size: size, createdAt: createdAt}
+	return nil
+}
+
+// remove records the deletion of hash. It returns false if hash is not in the pack.
+func (p *packIndex) remove(hash string, syncOnWrite bool) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, exists := p.entries[hash]
+	if !exists {
+		return false, nil
+	}
+
+	if err := p.appendRecord(fmt.Sprintf("%s %s\n", packRecordDelete, hash), syncOnWrite); err != nil {
+		return false, err
+	}
+
+	delete(p.entries, hash)
+	p.deadBytes += entry.size
+	return true, nil
+}
+
+// appendRecord appends a single record to pack.idx. Callers must hold p.mu.
+func (p *packIndex) appendRecord(record string, syncOnWrite bool) error {
+	indexFile, err := os.OpenFile(filepath.Join(p.dir, packIndexName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, packFilePerm)
+	if err != nil {
+		return err
+	}
+
+	_, err = indexFile.WriteString(record)
+	if err == nil && syncOnWrite {
+		err = indexFile.Sync()
+	}
+	if closeErr := indexFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// open returns the pack data file and a reader limited to the blob's bytes.
+func (p *packIndex) open(hash string) (*os.File, io.Reader, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, exists := p.entries[hash]
+	if !exists {
+		return nil, nil, store.FileNotFoundError{Hash: hash}
+	}
+
+	//nolint:gosec // p.dir is constructed from validated hash, not user input
+	dataFile, err := os.Open(filepath.Join(p.dir, packDataName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The section reader keeps working even if a repack replaces pack.dat, since it reads through this descriptor
+	return dataFile, io.NewSectionReader(dataFile, entry.offset, entry.size), nil
+}
+
+// needsRepack reports whether enough of the pack is dead to make compaction worthwhile.
+func (p *packIndex) needsRepack() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.deadBytes >= minRepackDeadBytes && p.deadBytes*repackDeadRatio > p.dataSize
+}
+
+// repack rewrites pack.dat and pack.idx with only the live entries.
+// The compacted pack is built in a sibling directory and swapped in with renames,
+// so a crash leaves either the old or the new pack in place (see recoverPackDir).
+func (p *packIndex) repack(syncOnWrite bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.deadBytes == 0 {
+		return nil
+	}
+
+	newDir := p.dir + packNewSuffix
+	oldDir := p.dir + packOldSuffix
+	if err := os.RemoveAll(newDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(newDir, dirPerm); err != nil {
+		return err
+	}
+
+	newEntries, newSize, err := p.writeCompacted(newDir, syncOnWrite)
+	if err != nil {
+		p.removeQuietly(newDir)
+		return err
+	}
+
+	if err := os.RemoveAll(oldDir); err != nil {
+		p.removeQuietly(newDir)
+		return err
+	}
+	if err := os.Rename(p.dir, oldDir); err != nil {
+		p.removeQuietly(newDir)
+		return err
+	}
+	if err := os.Rename(newDir, p.dir); err != nil {
+		if restoreErr := os.Rename(oldDir, p.dir); restoreErr != nil {
+			log.Error().Err(restoreErr).Str("pack_dir", p.dir).Msg("Failed to restore pack directory after failed repack")
+		}
+		return err
+	}
+	// Readers holding the old pack.dat open keep reading through their descriptors
+	p.removeQuietly(oldDir)
+
+	log.Debug().
+		Str("pack_dir", p.dir).
+		Int64("old_size", p.dataSize).
+		Int64("new_size", newSize).
+		Int("entries", len(newEntries)).
+		Msg("Pack compacted")
+
+	p.entries = newEntries
+	p.dataSize = newSize
+	p.deadBytes = 0
+	return nil
+}
+
+// writeCompacted copies live entries into new data and index files in newDir. Callers must hold p.mu.
+func (p *packIndex) writeCompacted(newDir string, syncOnWrite bool) (map[string]packEntry, int64, error) {
+	//nolint:gosec // p.dir is constructed from validated hash, not user input
+	oldData, err := os.Open(filepath.Join(p.dir, packDataName))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if err := oldData.Close(); err != nil {
+			log.Warn().Err(err).Str("pack_dir", p.dir).Msg("Failed to close old pack data file")
+		}
+	}()
+
+	newData, err := os.OpenFile(filepath.Join(newDir, packDataName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, packFilePerm)
+	if err != nil {
+		return nil, 0, err
+	}
+	newIndex, err := os.OpenFile(filepath.Join(newDir, packIndexName), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, packFilePerm)
+	if err != nil {
+		_ = newData.Close()
+		return nil, 0, err
+	}
+
+	newEntries := make(map[string]packEntry, len(p.entries))
+	indexWriter := bufio.NewWriter(newIndex)
+	var offset int64
+	for hash, entry := range p.entries {
+		if err = copyWithBuffer(newData, io.NewSectionReader(oldData, entry.offset, entry.size)); err != nil {
+			break
+		}
+		if _, err = fmt.Fprintf(indexWriter, "%s %s %d %d %d\n",
+			packRecordPut, hash, offset, entry.size, entry.createdAt.UnixNano()); err != nil {
+			break
+		}
+		newEntries[hash] = packEntry{offset: offset, size: entry.size, createdAt: entry.createdAt}
+		offset += entry.size
+	}
+
+	if err == nil {
+		err = indexWriter.Flush()
+	}
+	if err == nil && syncOnWrite {
+		err = errors.Join(newData.Sync(), newIndex.Sync())
+	}
+	if closeErr := errors.Join(newData.Close(), newIndex.Close()); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return newEntries, offset, nil
+}
+
+// removeQuietly removes a temporary pack directory, logging failures.
+func (p *packIndex) removeQuietly(path string) {
+	if err := os.RemoveAll(path); err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("Failed to remove temporary pack directory")
+	}
+}
+
+// recoverPackDir finishes or rolls back a repack that was interrupted between its directory renames.
+func recoverPackDir(dir string) error {
+	newDir := dir + packNewSuffix
+	oldDir := dir + packOldSuffix
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		// The old pack was moved aside; prefer the fully written new pack, fall back to the old one
+		for _, candidate := range []string{newDir, oldDir} {
+			if _, statErr := os.Stat(candidate); statErr == nil {
+				log.Warn().Str("pack_dir", dir).Str("recovered_from", candidate).Msg("Recovering pack after interrupted repack")
+				if err := os.Rename(candidate, dir); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// Anything left over belongs to an abandoned or completed repack
+	for _, leftover := range []string{newDir, oldDir} {
+		if err := os.RemoveAll(leftover); err != nil {
+			return err
+		}
+	}
+	return nil
+}
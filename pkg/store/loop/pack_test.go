@@ -0,0 +1,288 @@
+package loop
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"loopfs/pkg/store"
+)
+
+const (
+	packTestHashA = "abcd1234567890abcdef1234567890abcdef1234567890abcdef1234567890ab"
+	packTestHashB = "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"
+	packTestHashC = "abcd000000000000000000000000000000000000000000000000000000000000"
+)
+
+// PackTestSuite tests the pack file index used for small blobs
+type PackTestSuite struct {
+	suite.Suite
+	tempDir string
+	packDir string
+}
+
+// SetupTest runs before each test
+func (s *PackTestSuite) SetupTest() {
+	s.tempDir = s.T().TempDir()
+	s.packDir = filepath.Join(s.tempDir, packDirName)
+}
+
+// addBlob adds content to the index under hash
+func (s *PackTestSuite) addBlob(index *packIndex, hash, content string) {
+	s.Require().NoError(index.add(hash, strings.NewReader(content), int64(len(content)), false))
+}
+
+// readBlob reads a blob back from the index
+func (s *PackTestSuite) readBlob(index *packIndex, hash string) string {
+	file, reader, err := index.open(hash)
+	s.Require().NoError(err)
+	defer file.Close()
+
+	data, err := io.ReadAll(reader)
+	s.Require().NoError(err)
+	return string(data)
+}
+
+// TestLoadMissingPack tests that a missing pack directory yields an empty index
+func (s *PackTestSuite) TestLoadMissingPack() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+	s.Empty(index.entries)
+	s.Equal(int64(0), index.dataSize)
+	s.Equal(int64(0), index.deadBytes)
+}
+
+// TestAddAndOpen tests that added blobs can be read back
+func (s *PackTestSuite) TestAddAndOpen() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+
+	s.addBlob(index, packTestHashA, "hello")
+	s.addBlob(index, packTestHashB, "world!")
+
+	entry, found := index.lookup(packTestHashB)
+	s.True(found)
+	s.Equal(int64(5), entry.offset)
+	s.Equal(int64(6), entry.size)
+	s.False(entry.createdAt.IsZero())
+
+	s.Equal("hello", s.readBlob(index, packTestHashA))
+	s.Equal("world!", s.readBlob(index, packTestHashB))
+}
+
+// TestOpenMissing tests that opening an unknown blob returns FileNotFoundError
+func (s *PackTestSuite) TestOpenMissing() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+
+	_, _, err = index.open(packTestHashA)
+	s.ErrorAs(err, &store.FileNotFoundError{})
+}
+
+// TestAddShortSource tests that a source shorter than the declared size is rejected
+func (s *PackTestSuite) TestAddShortSource() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+
+	err = index.add(packTestHashA, strings.NewReader("abc"), 10, false)
+	s.ErrorIs(err, io.ErrUnexpectedEOF)
+
+	_, found := index.lookup(packTestHashA)
+	s.False(found)
+	s.Equal(int64(3), index.deadBytes)
+}
+
+// TestReloadFromDisk tests that puts and deletes survive reloading the index
+func (s *PackTestSuite) TestReloadFromDisk() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+
+	s.addBlob(index, packTestHashA, "first")
+	s.addBlob(index, packTestHashB, "second")
+	removed, err := index.remove(packTestHashA, false)
+	s.Require().NoError(err)
+	s.True(removed)
+
+	reloaded, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+
+	_, found := reloaded.lookup(packTestHashA)
+	s.False(found)
+	s.Equal("second", s.readBlob(reloaded, packTestHashB))
+	s.Equal(int64(len("first")), reloaded.deadBytes)
+}
+
+// TestRemoveMissing tests that removing an unknown blob reports false
+func (s *PackTestSuite) TestRemoveMissing() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+
+	removed, err := index.remove(packTestHashA, false)
+	s.Require().NoError(err)
+	s.False(removed)
+}
+
+// TestReplaySkipsTornRecord tests that a partially written index record is ignored on load
+func (s *PackTestSuite) TestReplaySkipsTornRecord() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+	s.addBlob(index, packTestHashA, "intact")
+
+	// Simulate a crash after the data write but during the index write
+	dataFile, err := os.OpenFile(filepath.Join(s.packDir, packDataName), os.O_WRONLY|os.O_APPEND, packFilePerm)
+	s.Require().NoError(err)
+	_, err = dataFile.WriteString("orphan")
+	s.Require().NoError(err)
+	s.Require().NoError(dataFile.Close())
+	s.Require().NoError(index.appendRecord(packRecordPut+" "+packTestHashB+" 6", false))
+
+	reloaded, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+
+	_, found := reloaded.lookup(packTestHashB)
+	s.False(found)
+	s.Equal("intact", s.readBlob(reloaded, packTestHashA))
+	s.Equal(int64(len("orphan")), reloaded.deadBytes)
+}
+
+// TestReplaySkipsOutOfRangeRecord tests that records pointing past the data file are ignored
+func (s *PackTestSuite) TestReplaySkipsOutOfRangeRecord() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+	s.addBlob(index, packTestHashA, "data")
+	s.Require().NoError(index.appendRecord(packRecordPut+" "+packTestHashB+" 2 100 0\n", false))
+
+	reloaded, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+
+	_, found := reloaded.lookup(packTestHashB)
+	s.False(found)
+	s.Len(reloaded.entries, 1)
+}
+
+// TestNeedsRepack tests the automatic compaction threshold
+func (s *PackTestSuite) TestNeedsRepack() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+
+	blob := string(bytes.Repeat([]byte("x"), minRepackDeadBytes))
+	s.addBlob(index, packTestHashA, blob)
+	s.addBlob(index, packTestHashB, "small")
+	s.False(index.needsRepack())
+
+	_, err = index.remove(packTestHashA, false)
+	s.Require().NoError(err)
+	s.True(index.needsRepack())
+}
+
+// TestRepack tests that compaction drops dead data and keeps live blobs readable
+func (s *PackTestSuite) TestRepack() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+
+	s.addBlob(index, packTestHashA, "dead")
+	s.addBlob(index, packTestHashB, "alive")
+	s.addBlob(index, packTestHashC, "also alive")
+	_, err = index.remove(packTestHashA, false)
+	s.Require().NoError(err)
+
+	s.Require().NoError(index.repack(true))
+
+	s.Equal(int64(0), index.deadBytes)
+	s.Equal(int64(len("alive")+len("also alive")), index.dataSize)
+	s.Equal("alive", s.readBlob(index, packTestHashB))
+	s.Equal("also alive", s.readBlob(index, packTestHashC))
+	s.NoDirExists(s.packDir + packNewSuffix)
+	s.NoDirExists(s.packDir + packOldSuffix)
+
+	reloaded, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+	s.Len(reloaded.entries, 2)
+	s.Equal(int64(0), reloaded.deadBytes)
+	s.Equal("also alive", s.readBlob(reloaded, packTestHashC))
+}
+
+// TestOpenReaderSurvivesRepack tests that an open reader keeps serving data after a repack
+func (s *PackTestSuite) TestOpenReaderSurvivesRepack() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+
+	s.addBlob(index, packTestHashA, "dead")
+	s.addBlob(index, packTestHashB, "streaming")
+	file, reader, err := index.open(packTestHashB)
+	s.Require().NoError(err)
+	defer file.Close()
+
+	_, err = index.remove(packTestHashA, false)
+	s.Require().NoError(err)
+	s.Require().NoError(index.repack(false))
+
+	data, err := io.ReadAll(reader)
+	s.Require().NoError(err)
+	s.Equal("streaming", string(data))
+}
+
+// TestRecoverFromInterruptedRepack tests recovery when the crash happened between the directory renames
+func (s *PackTestSuite) TestRecoverFromInterruptedRepack() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+	s.addBlob(index, packTestHashA, "content")
+
+	// The old pack was moved aside but the new one was never renamed into place
+	s.Require().NoError(os.Rename(s.packDir, s.packDir+packOldSuffix))
+
+	reloaded, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+	s.Equal("content", s.readBlob(reloaded, packTestHashA))
+	s.NoDirExists(s.packDir + packOldSuffix)
+}
+
+// TestRecoverDiscardsPartialNewPack tests that a half-built new pack is removed when the old pack is intact
+func (s *PackTestSuite) TestRecoverDiscardsPartialNewPack() {
+	index, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+	s.addBlob(index, packTestHashA, "content")
+
+	s.Require().NoError(os.MkdirAll(s.packDir+packNewSuffix, dirPerm))
+
+	reloaded, err := loadPackIndex(s.packDir)
+	s.Require().NoError(err)
+	s.Equal("content", s.readBlob(reloaded, packTestHashA))
+	s.NoDirExists(s.packDir + packNewSuffix)
+}
+
+// TestShouldPack tests the pack threshold
+func (s *PackTestSuite) TestShouldPack() {
+	loopStore := NewWithDefaults(s.tempDir, 10)
+	s.False(loopStore.shouldPack(1))
+
+	loopStore.SetPackThreshold(100)
+	s.True(loopStore.shouldPack(0))
+	s.True(loopStore.shouldPack(99))
+	s.False(loopStore.shouldPack(100))
+
+	loopStore.SetPackThreshold(0)
+	s.False(loopStore.shouldPack(1))
+}
+
+// TestRepackInvalidHash tests that Repack rejects invalid hash prefixes
+func (s *PackTestSuite) TestRepackInvalidHash() {
+	loopStore := NewWithDefaults(s.tempDir, 10)
+
+	err := loopStore.Repack(context.Background(), "zz")
+	s.ErrorAs(err, &store.InvalidHashError{})
+
+	err = loopStore.Repack(context.Background(), "abcg")
+	s.ErrorAs(err, &store.InvalidHashError{})
+}
+
+// TestPackTestSuite runs the pack test suite
+func TestPackTestSuite(t *testing.T) {
+	suite.Run(t, new(PackTestSuite))
+}
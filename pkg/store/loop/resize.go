@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"time"
 
 	"loopfs/pkg/log"
+	"loopfs/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -15,17 +19,17 @@ const (
 )
 
 // createNewLoopFile creates and formats a new loop file.
-func (s *Store) createNewLoopFile(newLoopFilePath string, sizeInMB int64) error {
+func (s *Store) createNewLoopFile(ctx context.Context, newLoopFilePath string, sizeInMB int64) error {
 	// Calculate file size in bytes for timeout calculation
 	fileSizeBytes := sizeInMB * bytesToMB
 
 	// Create the new loop file with size-based timeout
 	ddTimeout := s.getDDTimeout(fileSizeBytes)
-	ctx, cancel := context.WithTimeout(context.Background(), ddTimeout)
+	ddCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ddTimeout)
 	defer cancel()
 
 	//nolint:gosec // newLoopFilePath is constructed from validated hash, not user input
-	cmd := exec.CommandContext(ctx, "dd", "if=/dev/zero",
+	cmd := exec.CommandContext(ddCtx, "dd", "if=/dev/zero",
 		"of="+newLoopFilePath,
 		"bs="+blockSize,
 		fmt.Sprintf("count=%d", sizeInMB))
@@ -36,17 +40,17 @@ func (s *Store) createNewLoopFile(newLoopFilePath string, sizeInMB int64) error
 		Dur("timeout", ddTimeout).
 		Msg("Creating new loop file for resize with calculated timeout")
 
-	if err := cmd.Run(); err != nil {
+	if err := runCommand(ddCtx, cmd); err != nil {
 		log.Error().Err(err).Str("new_loop_file", newLoopFilePath).Dur("timeout", ddTimeout).Msg("Failed to create new loop file")
 		return fmt.Errorf("failed to create new loop file: %w", err)
 	}
 
 	// Format the new loop file with ext4 using size-based timeout
 	mkfsTimeout := s.getMkfsTimeout(fileSizeBytes)
-	ctx2, cancel2 := context.WithTimeout(context.Background(), mkfsTimeout)
+	mkfsCtx, cancel2 := context.WithTimeout(context.WithoutCancel(ctx), mkfsTimeout)
 	defer cancel2()
 	//nolint:gosec // newLoopFilePath is constructed from validated hash, not user input
-	cmd = exec.CommandContext(ctx2, "mkfs.ext4", "-q", newLoopFilePath)
+	cmd = exec.CommandContext(mkfsCtx, "mkfs.ext4", "-q", newLoopFilePath)
 
 	log.Debug().
 		Str("new_loop_file", newLoopFilePath).
@@ -54,7 +58,7 @@ func (s *Store) createNewLoopFile(newLoopFilePath string, sizeInMB int64) error
 		Dur("timeout", mkfsTimeout).
 		Msg("Formatting new loop file for resize with calculated timeout")
 
-	if err := cmd.Run(); err != nil {
+	if err := runCommand(mkfsCtx, cmd); err != nil {
 		log.Error().Err(err).Str("new_loop_file", newLoopFilePath).Dur("timeout", mkfsTimeout).Msg("Failed to format new loop file")
 		return fmt.Errorf("failed to format new loop file: %w", err)
 	}
@@ -63,7 +67,7 @@ func (s *Store) createNewLoopFile(newLoopFilePath string, sizeInMB int64) error
 }
 
 // mountNewLoopFile mounts the new loop file.
-func (s *Store) mountNewLoopFile(newLoopFilePath, newMountPoint string) error {
+func (s *Store) mountNewLoopFile(ctx context.Context, newLoopFilePath, newMountPoint string) error {
 	// Create mount point for new loop file
 	if err := os.MkdirAll(newMountPoint, dirPerm); err != nil {
 		log.Error().Err(err).Str("new_mount_point", newMountPoint).Msg("Failed to create new mount point")
@@ -71,11 +75,11 @@ func (s *Store) mountNewLoopFile(newLoopFilePath, newMountPoint string) error {
 	}
 
 	// Mount the new loop file using base timeout (mount is fast)
-	ctx, cancel := context.WithTimeout(context.Background(), s.timeouts.BaseCommandTimeout)
+	mountCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeoutConfig().BaseCommandTimeout)
 	defer cancel()
 	//nolint:gosec // newLoopFilePath and newMountPoint are constructed from validated hash, not user input
-	cmd := exec.CommandContext(ctx, "mount", "-o", "loop", newLoopFilePath, newMountPoint)
-	if err := cmd.Run(); err != nil {
+	cmd := exec.CommandContext(mountCtx, "mount", "-o", "loop", newLoopFilePath, newMountPoint)
+	if err := runCommand(mountCtx, cmd); err != nil {
 		log.Error().Err(err).Str("new_loop_file", newLoopFilePath).Str("new_mount_point", newMountPoint).
 			Msg("Failed to mount new loop file")
 		return fmt.Errorf("failed to mount new loop file: %w", err)
@@ -85,18 +89,18 @@ func (s *Store) mountNewLoopFile(newLoopFilePath, newMountPoint string) error {
 }
 
 // syncDataBetweenLoops uses rsync to copy data between mounted loop filesystems.
-func (s *Store) syncDataBetweenLoops(mountPoint, newMountPoint string, estimatedDataSize int64) error {
+func (s *Store) syncDataBetweenLoops(ctx context.Context, mountPoint, newMountPoint string, estimatedDataSize int64) error {
 	// Add trailing slashes to ensure directory contents are copied
 	sourcePath := mountPoint + "/"
 	destPath := newMountPoint + "/"
 
 	// Use intelligent timeout based on estimated data size
 	rsyncTimeout := s.getRsyncTimeout(estimatedDataSize)
-	ctx, cancel := context.WithTimeout(context.Background(), rsyncTimeout)
+	rsyncCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rsyncTimeout)
 	defer cancel()
 
 	//nolint:gosec // sourcePath and destPath are constructed from validated hash, not user input
-	cmd := exec.CommandContext(ctx, "rsync", "-au", sourcePath, destPath)
+	cmd := exec.CommandContext(rsyncCtx, "rsync", "-au", "--stats", sourcePath, destPath)
 
 	log.Debug().
 		Str("source", sourcePath).
@@ -105,12 +109,13 @@ func (s *Store) syncDataBetweenLoops(mountPoint, newMountPoint string, estimated
 		Dur("timeout", rsyncTimeout).
 		Msg("Starting rsync with calculated timeout")
 
-	output, err := cmd.CombinedOutput()
+	output, err := runCommandCombinedOutput(rsyncCtx, cmd)
 	if err != nil {
 		log.Error().Err(err).Str("source", sourcePath).Str("dest", destPath).
 			Str("output", string(output)).Dur("timeout", rsyncTimeout).Msg("Failed to rsync data to new loop file")
 		return fmt.Errorf("failed to rsync data: %w (output: %s)", err, string(output))
 	}
+	rsyncBytesTotal.Add(float64(parseRsyncTransferred(string(output))))
 
 	log.Debug().
 		Str("source", sourcePath).
@@ -122,12 +127,12 @@ func (s *Store) syncDataBetweenLoops(mountPoint, newMountPoint string, estimated
 }
 
 // unmountLoopFile unmounts a specific loop file.
-func (s *Store) unmountSpecificLoopFile(mountPoint string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), s.timeouts.BaseCommandTimeout)
+func (s *Store) unmountSpecificLoopFile(ctx context.Context, mountPoint string) error {
+	umountCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.timeoutConfig().BaseCommandTimeout)
 	defer cancel()
 	//nolint:gosec // mountPoint is constructed from validated hash, not user input
-	cmd := exec.CommandContext(ctx, "umount", mountPoint)
-	if err := cmd.Run(); err != nil {
+	cmd := exec.CommandContext(umountCtx, "umount", mountPoint)
+	if err := runCommand(umountCtx, cmd); err != nil {
 		log.Error().Err(err).Str("mount_point", mountPoint).Msg("Failed to unmount loop file")
 		return fmt.Errorf("failed to unmount loop file: %w", err)
 	}
@@ -232,22 +237,22 @@ func (s *Store) logResizeCompletion(hash, loopFilePath string, newSize int64) {
 }
 
 // performResizeOperations performs the main resize operations steps.
-func (s *Store) performResizeOperations(hash, mountPoint, loopFilePath, newLoopFilePath, newMountPoint string, newSize int64) error {
+func (s *Store) performResizeOperations(ctx context.Context, hash, mountPoint, loopFilePath, newLoopFilePath, newMountPoint string, newSize int64) error {
 	// Step 2: Create and format new image file
 	sizeInMB := newSize / bytesPerMB
 	if sizeInMB <= 0 {
 		sizeInMB = 1 // Minimum 1MB
 	}
-	if err := s.createNewLoopFile(newLoopFilePath, sizeInMB); err != nil {
+	if err := s.createNewLoopFile(ctx, newLoopFilePath, sizeInMB); err != nil {
 		return err
 	}
 
 	// Step 3: Mount new image file
-	if err := s.mountNewLoopFile(newLoopFilePath, newMountPoint); err != nil {
+	if err := s.mountNewLoopFile(ctx, newLoopFilePath, newMountPoint); err != nil {
 		return err
 	}
 	defer func() {
-		if err := s.unmountSpecificLoopFile(newMountPoint); err != nil {
+		if err := s.unmountSpecificLoopFile(ctx, newMountPoint); err != nil {
 			log.Error().Err(err).Str("new_mount_point", newMountPoint).
 				Msg("Failed to unmount new loop file after resize")
 		}
@@ -268,15 +273,15 @@ func (s *Store) performResizeOperations(hash, mountPoint, loopFilePath, newLoopF
 	}
 
 	// Step 4: Sync data between loops with intelligent timeout
-	if err := s.syncDataBetweenLoops(mountPoint, newMountPoint, estimatedDataSize); err != nil {
+	if err := s.syncDataBetweenLoops(ctx, mountPoint, newMountPoint, estimatedDataSize); err != nil {
 		return err
 	}
 
 	// Step 5: Unmount both loops
-	if err := s.unmountSpecificLoopFile(newMountPoint); err != nil {
+	if err := s.unmountSpecificLoopFile(ctx, newMountPoint); err != nil {
 		return err
 	}
-	if err := s.unmountLoopFile(hash); err != nil {
+	if err := s.unmountLoopFile(ctx, hash); err != nil {
 		return fmt.Errorf("failed to unmount existing loop file: %w", err)
 	}
 
@@ -308,13 +313,19 @@ func (s *Store) waitForQuiescence(mountPoint string) {
 // 5. Uses rsync to copy data from the existing to the new image
 // 6. Unmounts both images
 // 7. Moves the new image over the old one.
-func (s *Store) ResizeBlock(hash string, newSize int64) error {
+func (s *Store) ResizeBlock(ctx context.Context, hash string, newSize int64) (err error) {
 	// Validate and prepare
 	loopFilePath, mountPoint, newLoopFilePath, newMountPoint, err := s.validateAndPrepareResize(hash, newSize)
 	if err != nil {
 		return err
 	}
 
+	ctx, span := tracing.StartSpan(ctx, "loop.ResizeBlock",
+		attribute.String("loopfs.hash", hash), attribute.Int64("loopfs.new_size", newSize))
+	defer func() {
+		span.End(err)
+	}()
+
 	// CRITICAL: Acquire exclusive write lock for resize coordination
 	// This prevents new file operations from starting while we resize
 	resizeLock := s.getResizeLock(loopFilePath)
@@ -331,22 +342,27 @@ func (s *Store) ResizeBlock(hash string, newSize int64) error {
 	log.Debug().Str("hash", hash).Str("mount_point", mountPoint).
 		Msg("All active operations completed, proceeding with resize")
 
+	start := time.Now()
+	defer func() {
+		observeResize(start, err)
+	}()
+
 	// Set up a cleanup handler
 	defer s.setupCleanupHandler(loopFilePath, newLoopFilePath, newMountPoint)()
 
 	// Step 1: Mount existing loop image directly (no reference counting needed since we're exclusive)
-	if err := s.mountLoopFile(hash); err != nil {
+	if err := s.mountLoopFile(ctx, hash); err != nil {
 		log.Error().Err(err).Str("hash", hash).Msg("Failed to mount existing loop file for resize")
 		return fmt.Errorf("failed to mount existing loop file: %w", err)
 	}
 	defer func() {
-		if err := s.unmountLoopFile(hash); err != nil {
+		if err := s.unmountLoopFile(ctx, hash); err != nil {
 			log.Error().Err(err).Str("hash", hash).Msg("Failed to unmount existing loop file after resize")
 		}
 	}()
 
 	// Perform main operations
-	if err := s.performResizeOperations(hash, mountPoint, loopFilePath, newLoopFilePath, newMountPoint, newSize); err != nil {
+	if err := s.performResizeOperations(ctx, hash, mountPoint, loopFilePath, newLoopFilePath, newMountPoint, newSize); err != nil {
 		return err
 	}
 
@@ -1,6 +1,7 @@
 package loop
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -58,7 +59,7 @@ func (s *ResizeTestSuite) TestCreateNewLoopFile() {
 	newLoopFilePath := filepath.Join(s.tempDir, "test_new_loop.img")
 	sizeInMB := int64(1)
 
-	err := s.store.createNewLoopFile(newLoopFilePath, sizeInMB)
+	err := s.store.createNewLoopFile(context.Background(), newLoopFilePath, sizeInMB)
 	if err != nil {
 		// Expected in test environments without proper filesystem support
 		s.T().Logf("createNewLoopFile failed (expected in test env): %v", err)
@@ -77,7 +78,7 @@ func (s *ResizeTestSuite) TestCreateNewLoopFileInvalidPath() {
 	invalidPath := "/root/restricted/invalid.img"
 	sizeInMB := int64(1)
 
-	err := s.store.createNewLoopFile(invalidPath, sizeInMB)
+	err := s.store.createNewLoopFile(context.Background(), invalidPath, sizeInMB)
 	s.Error(err)
 	s.Contains(err.Error(), "failed to create new loop file")
 }
@@ -98,7 +99,7 @@ func (s *ResizeTestSuite) TestMountNewLoopFile() {
 
 	newMountPoint := filepath.Join(s.tempDir, "test_mount")
 
-	err = s.store.mountNewLoopFile(tempFile, newMountPoint)
+	err = s.store.mountNewLoopFile(context.Background(), tempFile, newMountPoint)
 	if err != nil {
 		// Expected failure in test environment
 		s.T().Logf("mountNewLoopFile failed (expected): %v", err)
@@ -111,7 +112,7 @@ func (s *ResizeTestSuite) TestMountNewLoopFileInvalidFile() {
 	invalidFile := "/nonexistent/file.img"
 	newMountPoint := filepath.Join(s.tempDir, "test_mount")
 
-	err := s.store.mountNewLoopFile(invalidFile, newMountPoint)
+	err := s.store.mountNewLoopFile(context.Background(), invalidFile, newMountPoint)
 	s.Error(err)
 	s.Contains(err.Error(), "failed to mount new loop file")
 }
@@ -134,7 +135,7 @@ func (s *ResizeTestSuite) TestSyncDataBetweenLoops() {
 
 	// Use 1GB as estimated data size for test
 	estimatedDataSize := int64(1024 * 1024 * 1024)
-	err = s.store.syncDataBetweenLoops(sourceDir, destDir, estimatedDataSize)
+	err = s.store.syncDataBetweenLoops(context.Background(), sourceDir, destDir, estimatedDataSize)
 	if err != nil {
 		// rsync might not be available or might fail in test environment
 		s.T().Logf("syncDataBetweenLoops failed (might be expected): %v", err)
@@ -156,7 +157,7 @@ func (s *ResizeTestSuite) TestSyncDataBetweenLoopsInvalidSource() {
 
 	// Use 1GB as estimated data size for test
 	estimatedDataSize := int64(1024 * 1024 * 1024)
-	err = s.store.syncDataBetweenLoops(invalidSource, validDest, estimatedDataSize)
+	err = s.store.syncDataBetweenLoops(context.Background(), invalidSource, validDest, estimatedDataSize)
 	s.Error(err)
 	s.Contains(err.Error(), "failed to rsync data")
 }
@@ -166,7 +167,7 @@ func (s *ResizeTestSuite) TestUnmountSpecificLoopFile() {
 	// Test with non-mounted directory
 	testMountPoint := filepath.Join(s.tempDir, "not_mounted")
 
-	err := s.store.unmountSpecificLoopFile(testMountPoint)
+	err := s.store.unmountSpecificLoopFile(context.Background(), testMountPoint)
 	if err != nil {
 		// Expected error for non-mounted path
 		s.T().Logf("unmountSpecificLoopFile failed as expected: %v", err)
@@ -321,7 +322,7 @@ func (s *ResizeTestSuite) TestPerformResizeOperations() {
 	err := os.MkdirAll(mountPoint, dirPerm)
 	s.NoError(err)
 
-	err = s.store.performResizeOperations(s.testHash, mountPoint, loopFilePath, newLoopFilePath, newMountPoint, 2048*1024*1024)
+	err = s.store.performResizeOperations(context.Background(), s.testHash, mountPoint, loopFilePath, newLoopFilePath, newMountPoint, 2048*1024*1024)
 	// This will fail in test environment due to mount issues
 	s.Error(err)
 	s.T().Logf("performResizeOperations failed as expected: %v", err)
@@ -330,12 +331,12 @@ func (s *ResizeTestSuite) TestPerformResizeOperations() {
 // TestResizeBlock tests the main ResizeBlock function
 func (s *ResizeTestSuite) TestResizeBlock() {
 	// Test with invalid hash
-	err := s.store.ResizeBlock("invalid", 1024)
+	err := s.store.ResizeBlock(context.Background(), "invalid", 1024)
 	s.Error(err)
 	s.Contains(err.Error(), "invalid hash format")
 
 	// Test with valid hash but non-existent loop file
-	err = s.store.ResizeBlock(s.testHash, 1024)
+	err = s.store.ResizeBlock(context.Background(), s.testHash, 1024)
 	s.Error(err)
 	s.Contains(err.Error(), "loop file not found")
 
@@ -353,7 +354,7 @@ func (s *ResizeTestSuite) TestResizeBlock() {
 	err = os.WriteFile(loopFile, []byte("test loop file"), 0644)
 	s.NoError(err)
 
-	err = s.store.ResizeBlock(s.testHash, 2048*1024*1024)
+	err = s.store.ResizeBlock(context.Background(), s.testHash, 2048*1024*1024)
 	// This will fail due to mount issues in test environment
 	s.Error(err)
 	s.T().Logf("ResizeBlock failed as expected: %v", err)
@@ -370,13 +371,13 @@ func (s *ResizeTestSuite) TestResizeBlockZeroSize() {
 	s.NoError(err)
 
 	// Test with zero size
-	err = s.store.ResizeBlock(s.testHash, 0)
+	err = s.store.ResizeBlock(context.Background(), s.testHash, 0)
 	if err != nil {
 		s.T().Logf("ResizeBlock with zero size failed as expected: %v", err)
 	}
 
 	// Test with negative size
-	err = s.store.ResizeBlock(s.testHash, -1024)
+	err = s.store.ResizeBlock(context.Background(), s.testHash, -1024)
 	if err != nil {
 		s.T().Logf("ResizeBlock with negative size failed as expected: %v", err)
 	}
@@ -397,7 +398,7 @@ func (s *ResizeTestSuite) TestMountNewLoopFileCreateDirError() {
 	// Try to create mount point in non-existent parent directory
 	invalidMountPoint := "/nonexistent/parent/mount"
 
-	err = s.store.mountNewLoopFile(tempFile, invalidMountPoint)
+	err = s.store.mountNewLoopFile(context.Background(), tempFile, invalidMountPoint)
 	s.Error(err)
 	s.Contains(err.Error(), "failed to create new mount point")
 }
@@ -412,7 +413,7 @@ func (s *ResizeTestSuite) TestCreateNewLoopFileZeroSize() {
 
 	newLoopFilePath := filepath.Join(s.tempDir, "zero_size.img")
 
-	err := s.store.createNewLoopFile(newLoopFilePath, 0)
+	err := s.store.createNewLoopFile(context.Background(), newLoopFilePath, 0)
 	if err != nil {
 		// Expected to fail with zero size
 		s.T().Logf("createNewLoopFile with zero size failed as expected: %v", err)
@@ -435,7 +436,7 @@ func (s *ResizeTestSuite) TestSyncDataBetweenLoopsTimeout() {
 	// We can't easily test actual timeout, but we can verify the function runs
 	// Use 1GB as estimated data size for test
 	estimatedDataSize := int64(1024 * 1024 * 1024)
-	err = s.store.syncDataBetweenLoops(sourceDir, destDir, estimatedDataSize)
+	err = s.store.syncDataBetweenLoops(context.Background(), sourceDir, destDir, estimatedDataSize)
 	// May succeed or fail depending on rsync availability
 	if err != nil {
 		s.T().Logf("syncDataBetweenLoops error (may be expected): %v", err)
@@ -452,7 +453,7 @@ func (s *ResizeTestSuite) TestResizeWithCleanup() {
 	err = os.WriteFile(loopFile, []byte("test loop file"), 0644)
 	s.NoError(err)
 
-	err = s.store.ResizeBlock(s.testHash, 2048*1024*1024)
+	err = s.store.ResizeBlock(context.Background(), s.testHash, 2048*1024*1024)
 	// Should fail but cleanup should still happen
 	s.Error(err)
 
@@ -1,8 +1,10 @@
 package loop
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
@@ -11,6 +13,9 @@ import (
 	"loopfs/pkg/log"
 	"loopfs/pkg/models"
 	"loopfs/pkg/store"
+	"loopfs/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -43,7 +48,7 @@ func copyWithBuffer(dst io.Writer, src io.Reader) error {
 }
 
 // Upload stores a file from the given reader and returns its hash.
-func (s *Store) Upload(reader io.Reader, filename string) (*models.UploadResponse, error) {
+func (s *Store) Upload(ctx context.Context, reader io.Reader, filename string) (*models.UploadResponse, error) {
 	log.Debug().Str("filename", filename).Msg("Processing file upload")
 
 	hash, tempFile, err := s.processAndHashFile(reader)
@@ -53,7 +58,7 @@ func (s *Store) Upload(reader io.Reader, filename string) (*models.UploadRespons
 	defer s.cleanupTempFile(tempFile)
 
 	// Atomic check-and-create with single mount operation to prevent race conditions
-	created, err := s.atomicCheckAndCreateWithTempFile(hash, tempFile)
+	created, err := s.atomicCheckAndCreateWithTempFile(ctx, hash, tempFile)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +101,7 @@ func (s *Store) processAndHashFile(reader io.Reader) (string, *os.File, error) {
 // atomicCheckAndCreate performs atomic check-and-create operation for deduplication.
 // Uses a single mount operation to minimize expensive mount/unmount cycles.
 // The createFunc should perform the actual file creation within the mounted filesystem.
-func (s *Store) atomicCheckAndCreate(hash string, createFunc func() error) (bool, error) {
+func (s *Store) atomicCheckAndCreate(ctx context.Context, hash string, createFunc func() error) (bool, error) {
 	// Get per-hash mutex for atomic check-and-create
 	deduplicationMutex := s.getDeduplicationMutex(hash)
 	deduplicationMutex.Lock()
@@ -111,7 +116,7 @@ func (s *Store) atomicCheckAndCreate(hash string, createFunc func() error) (bool
 	// 2. Loop file exists: we check for existing content
 	// This eliminates the race condition where resize temporarily renames the loop file.
 	var created bool
-	err := s.withMountedLoop(hash, func() error {
+	err := s.withMountedLoop(ctx, hash, func() error {
 		// Check if file exists within the mounted filesystem
 		exists, err := s.existsWithinMountedLoop(hash)
 		if err != nil {
@@ -137,16 +142,16 @@ func (s *Store) atomicCheckAndCreate(hash string, createFunc func() error) (bool
 
 // atomicCheckAndCreateWithTempFile performs atomic check-and-create operation for deduplication
 // using a temp file. Returns true if the file was created, false if it already existed.
-func (s *Store) atomicCheckAndCreateWithTempFile(hash string, tempFile *os.File) (bool, error) {
-	return s.atomicCheckAndCreate(hash, func() error {
+func (s *Store) atomicCheckAndCreateWithTempFile(ctx context.Context, hash string, tempFile *os.File) (bool, error) {
+	return s.atomicCheckAndCreate(ctx, hash, func() error {
 		return s.saveFileWithinMountedLoop(hash, tempFile)
 	})
 }
 
 // atomicCheckAndCreateWithPath performs atomic check-and-create operation for deduplication
 // using a file path. Returns true if the file was created, false if it already existed.
-func (s *Store) atomicCheckAndCreateWithPath(hash, sourcePath string) (bool, error) {
-	return s.atomicCheckAndCreate(hash, func() error {
+func (s *Store) atomicCheckAndCreateWithPath(ctx context.Context, hash, sourcePath string) (bool, error) {
+	return s.atomicCheckAndCreate(ctx, hash, func() error {
 		return s.saveFileFromPathWithinMountedLoop(hash, sourcePath)
 	})
 }
@@ -161,7 +166,9 @@ func (s *Store) existsWithinMountedLoop(hash string) (bool, error) {
 
 	_, err := os.Stat(filePath)
 	if os.IsNotExist(err) {
-		return false, nil
+		// Small blobs may live in the image pack instead of their own file
+		_, packed, packErr := s.packedEntry(hash)
+		return packed, packErr
 	}
 	if err != nil {
 		return false, err
@@ -206,6 +213,15 @@ func (s *Store) saveFileWithinMountedLoop(hash string, tempFile *os.File) error
 		return store.InvalidHashError{Hash: hash}
 	}
 
+	if _, err := tempFile.Seek(0, 0); err != nil {
+		log.Error().Err(err).Msg("Failed to seek to beginning of temporary file")
+		return err
+	}
+
+	if packed, err := s.savePackedIfSmall(hash, tempFile); packed || err != nil {
+		return err
+	}
+
 	// Create directory structure for the file
 	targetDir := filepath.Dir(targetPath)
 	if err := os.MkdirAll(targetDir, dirPerm); err != nil {
@@ -213,11 +229,6 @@ func (s *Store) saveFileWithinMountedLoop(hash string, tempFile *os.File) error
 		return err
 	}
 
-	if _, err := tempFile.Seek(0, 0); err != nil {
-		log.Error().Err(err).Msg("Failed to seek to beginning of temporary file")
-		return err
-	}
-
 	//nolint:gosec // targetPath is constructed from validated hash, not user input
 	dst, err := os.Create(targetPath)
 	if err != nil {
@@ -243,13 +254,6 @@ func (s *Store) saveFileFromPathWithinMountedLoop(hash string, sourcePath string
 		return store.InvalidHashError{Hash: hash}
 	}
 
-	// Create directory structure for the file
-	targetDir := filepath.Dir(targetPath)
-	if err := os.MkdirAll(targetDir, dirPerm); err != nil {
-		log.Error().Err(err).Str("target_dir", targetDir).Msg("Failed to create target directory")
-		return err
-	}
-
 	//nolint:gosec // sourcePath comes from validated temp file, not user input
 	src, err := os.Open(sourcePath)
 	if err != nil {
@@ -262,6 +266,17 @@ func (s *Store) saveFileFromPathWithinMountedLoop(hash string, sourcePath string
 		}
 	}()
 
+	if packed, err := s.savePackedIfSmall(hash, src); packed || err != nil {
+		return err
+	}
+
+	// Create directory structure for the file
+	targetDir := filepath.Dir(targetPath)
+	if err := os.MkdirAll(targetDir, dirPerm); err != nil {
+		log.Error().Err(err).Str("target_dir", targetDir).Msg("Failed to create target directory")
+		return err
+	}
+
 	//nolint:gosec // targetPath is constructed from validated hash, not user input
 	dst, err := os.Create(targetPath)
 	if err != nil {
@@ -277,9 +292,40 @@ func (s *Store) saveFileFromPathWithinMountedLoop(hash string, sourcePath string
 	return s.copyAndSyncFile(dst, src, targetPath)
 }
 
+// savePackedIfSmall appends src to the image pack when it is below the pack threshold.
+// It returns true if the blob was handled by the pack, in which case no standalone file must be written.
+func (s *Store) savePackedIfSmall(hash string, src *os.File) (bool, error) {
+	if s.packThreshold.Load() <= 0 {
+		return false, nil
+	}
+
+	info, err := src.Stat()
+	if err != nil {
+		log.Error().Err(err).Str("source_path", src.Name()).Msg("Failed to stat source file")
+		return false, err
+	}
+	if !s.shouldPack(info.Size()) {
+		return false, nil
+	}
+
+	return true, s.savePackedWithinMountedLoop(hash, src, info.Size())
+}
+
 // UploadWithHash stores a file using a pre-calculated hash and temp file path.
 // This method is more efficient as it avoids redundant hashing and temp file creation.
-func (s *Store) UploadWithHash(tempFilePath, hash, filename string) (*models.UploadResponse, error) {
+func (s *Store) UploadWithHash(ctx context.Context, tempFilePath, hash, filename string) (response *models.UploadResponse, err error) {
+	ctx, span := tracing.StartSpan(ctx, "loop.UploadWithHash", attribute.String("loopfs.hash", hash))
+	defer func() {
+		// A duplicate is a successful outcome for content-addressed storage
+		var existsErr store.FileExistsError
+		if errors.As(err, &existsErr) {
+			span.SetAttributes(attribute.Bool("loopfs.duplicate", true))
+			span.End(nil)
+			return
+		}
+		span.End(err)
+	}()
+
 	log.Debug().Str("filename", filename).Str("hash", hash).Msg("Processing file upload with pre-calculated hash")
 
 	// Validate the provided hash
@@ -288,7 +334,7 @@ func (s *Store) UploadWithHash(tempFilePath, hash, filename string) (*models.Upl
 	}
 
 	// Atomic check-and-create with single mount operation to prevent race conditions
-	created, err := s.atomicCheckAndCreateWithPath(hash, tempFilePath)
+	created, err := s.atomicCheckAndCreateWithPath(ctx, hash, tempFilePath)
 
 	if err != nil {
 		return nil, err
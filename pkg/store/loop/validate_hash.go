@@ -14,3 +14,19 @@ func (s *Store) ValidateHash(hash string) bool {
 
 	return true
 }
+
+// validatePrefix checks that hash starts with the four hex characters that select a loop image.
+// Used by operations that address a whole image rather than a single blob.
+func (s *Store) validatePrefix(hash string) bool {
+	if len(hash) < minHashLength {
+		return false
+	}
+
+	for _, char := range hash[:minHashLength] {
+		if (char < '0' || char > '9') && (char < 'a' || char > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,44 +1,47 @@
 package store
 
 import (
+	"context"
 	"io"
+
 	"loopfs/pkg/models"
 )
 
 // Store defines the interface for content-addressable storage operations.
+// Operations take the context of the request they serve, which carries its trace span.
 type Store interface {
 	// Upload stores a file from the given reader and returns its hash.
 	// If the file already exists, it returns an error with the existing hash.
-	Upload(reader io.Reader, filename string) (*models.UploadResponse, error)
+	Upload(ctx context.Context, reader io.Reader, filename string) (*models.UploadResponse, error)
 
 	// UploadWithHash stores a file using a pre-calculated hash and temp file path.
 	// This method is more efficient as it avoids redundant hashing and temp file creation.
 	// The tempFilePath should point to a file containing the content to be stored.
 	// If the file already exists, it returns an error with the existing hash.
-	UploadWithHash(tempFilePath, hash, filename string) (*models.UploadResponse, error)
+	UploadWithHash(ctx context.Context, tempFilePath, hash, filename string) (*models.UploadResponse, error)
 
 	// DownloadStream retrieves a file by its hash and returns a streaming reader.
 	// The caller must call Close() on the returned reader to cleanup resources.
 	// Returns an error if the file doesn't exist or hash is invalid.
-	DownloadStream(hash string) (io.ReadCloser, error)
+	DownloadStream(ctx context.Context, hash string) (io.ReadCloser, error)
 
 	// GetFileInfo retrieves metadata about a stored file.
 	// Returns an error if the file doesn't exist or hash is invalid.
-	GetFileInfo(hash string) (*models.FileInfo, error)
+	GetFileInfo(ctx context.Context, hash string) (*models.FileInfo, error)
 
 	// Exists checks if a file with the given hash exists in storage.
-	Exists(hash string) (bool, error)
+	Exists(ctx context.Context, hash string) (bool, error)
 
 	// ValidateHash checks if a hash string is valid format.
 	ValidateHash(hash string) bool
 
 	// Delete removes a file with the given hash from storage.
 	// Returns an error if the file doesn't exist or hash is invalid.
-	Delete(hash string) error
+	Delete(ctx context.Context, hash string) error
 
 	// GetDiskUsage returns disk space information for a specific file's loop filesystem.
 	// Returns an error if the file doesn't exist or hash is invalid.
-	GetDiskUsage(hash string) (*models.DiskUsage, error)
+	GetDiskUsage(ctx context.Context, hash string) (*models.DiskUsage, error)
 }
 
 // FileExistsError is returned when trying to upload a file that already exists.
@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serverErrorStatus is the lowest status code recorded as a span error.
+const serverErrorStatus = 500
+
+// Middleware starts a server span for each request, continuing the trace from incoming
+// W3C trace-context headers. The span is stored in the request context, which handlers pass
+// to the stores so their spans become children of it.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			parent := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			route := ctx.Path()
+			if route == "" {
+				route = req.URL.Path
+			}
+			spanCtx, span := Tracer().Start(parent, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", req.Method),
+					attribute.String("http.route", route),
+					attribute.String("url.path", req.URL.Path),
+				))
+			defer span.End()
+
+			ctx.SetRequest(req.WithContext(spanCtx))
+
+			err := next(ctx)
+
+			status := ctx.Response().Status
+			if httpErr, ok := err.(*echo.HTTPError); ok { //nolint:errorlint // echo returns unwrapped HTTP errors
+				status = httpErr.Code
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			if status >= serverErrorStatus {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			RecordError(span, err)
+			return err
+		}
+	}
+}
+
+// Transport returns a RoundTripper that starts a client span for each request and injects
+// W3C trace-context headers so the receiving server continues the trace.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next}
+}
+
+// transport is the RoundTripper returned by Transport.
+type transport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Tracer().Start(req.Context(), fmt.Sprintf("%s %s", req.Method, req.URL.Host),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+			attribute.String("url.full", req.URL.String()),
+		))
+	defer span.End()
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		RecordError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= serverErrorStatus {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
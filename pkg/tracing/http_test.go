@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// HTTPTestSuite tests trace propagation through the middleware and transport
+type HTTPTestSuite struct {
+	suite.Suite
+	exporter   *tracetest.InMemoryExporter
+	previous   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// SetupTest installs an in-memory tracer provider and the W3C propagator
+func (s *HTTPTestSuite) SetupTest() {
+	s.exporter = tracetest.NewInMemoryExporter()
+	s.previous = otel.GetTracerProvider()
+	s.propagator = otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(s.exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// TearDownTest restores the previous provider and propagator
+func (s *HTTPTestSuite) TearDownTest() {
+	otel.SetTracerProvider(s.previous)
+	otel.SetTextMapPropagator(s.propagator)
+}
+
+// TestMiddlewareContinuesTrace tests that server spans continue incoming traces
+func (s *HTTPTestSuite) TestMiddlewareContinuesTrace() {
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/file/:hash/info", func(ctx echo.Context) error {
+		// Spans started by stores during the request are children of the server span
+		_, span := StartSpan(ctx.Request().Context(), "store")
+		span.End(nil)
+		return ctx.NoContent(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/file/abc/info", nil)
+	req.Header.Set("traceparent", testTraceParent)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := s.exporter.GetSpans()
+	s.Require().Len(spans, 2)
+	storeSpan, serverSpan := spans[0], spans[1]
+	s.Equal("GET /file/:hash/info", serverSpan.Name)
+	s.Equal(trace.SpanKindServer, serverSpan.SpanKind)
+	s.Equal("4bf92f3577b34da6a3ce929d0e0e4736", serverSpan.SpanContext.TraceID().String())
+	s.Equal("00f067aa0ba902b7", serverSpan.Parent.SpanID().String())
+	s.Equal(codes.Error, serverSpan.Status.Code)
+	s.Equal(serverSpan.SpanContext.SpanID(), storeSpan.Parent.SpanID())
+}
+
+// TestTransportInjectsTraceContext tests that outbound requests carry the trace
+func (s *HTTPTestSuite) TestTransportInjectsTraceContext() {
+	var received string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	ctx, parent := StartSpan(context.Background(), "handler")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, backend.URL+"/node/info", nil)
+	s.Require().NoError(err)
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	s.Require().NoError(err)
+	s.Require().NoError(resp.Body.Close())
+	parent.End(nil)
+
+	s.Empty(req.Header.Get("traceparent"), "the caller's request must not be modified")
+	spans := s.exporter.GetSpans()
+	s.Require().Len(spans, 2)
+	clientSpan := spans[0]
+	s.Equal(trace.SpanKindClient, clientSpan.SpanKind)
+	s.Contains(received, clientSpan.SpanContext.TraceID().String())
+	s.Contains(received, clientSpan.SpanContext.SpanID().String())
+}
+
+// TestHTTPTestSuite runs the HTTP tracing test suite
+func TestHTTPTestSuite(t *testing.T) {
+	suite.Run(t, new(HTTPTestSuite))
+}
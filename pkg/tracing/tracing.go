@@ -0,0 +1,141 @@
+// Package tracing sets up OpenTelemetry tracing with W3C trace-context propagation.
+//
+// Spans are carried in contexts: the middleware stores the server span in the request context,
+// and the loop store, store manager and metadata store take that context and start their
+// spans around mount, dd, mkfs, rsync and SQL calls as its children.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"loopfs/pkg/log"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies loopfs spans.
+const instrumentationName = "loopfs"
+
+// Config configures the trace exporter.
+type Config struct {
+	ServiceName string
+	Version     string
+	// Endpoint is the OTLP/HTTP collector URL, e.g. http://localhost:4318. Tracing is disabled when empty.
+	Endpoint string
+	// SampleRatio is the fraction of new traces that are recorded. Incoming sampled traces are always recorded.
+	SampleRatio float64
+}
+
+// Init installs the global tracer provider and propagator.
+// It returns a function that flushes and stops the exporter.
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	options, err := exporterOptions(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(cfg.Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	log.Info().
+		Str("endpoint", cfg.Endpoint).
+		Str("service", cfg.ServiceName).
+		Float64("sample_ratio", cfg.SampleRatio).
+		Msg("OpenTelemetry tracing enabled")
+	return provider.Shutdown, nil
+}
+
+// exporterOptions converts a collector URL into OTLP/HTTP exporter options.
+func exporterOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(parsed.Host)}
+	switch parsed.Scheme {
+	case "http":
+		options = append(options, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("invalid OTLP endpoint scheme %q", parsed.Scheme)
+	}
+	if path := strings.TrimSuffix(parsed.Path, "/"); path != "" {
+		options = append(options, otlptracehttp.WithURLPath(path))
+	}
+	return options, nil
+}
+
+// Tracer returns the loopfs tracer from the global provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Span is a span started by StartSpan.
+type Span struct {
+	span trace.Span
+}
+
+// StartSpan starts a span as a child of the span in ctx, if any. It returns the span and a
+// context holding it, which nested operations pass on so their spans become its children.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, *Span) {
+	ctx, span := Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, &Span{span: span}
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...attribute.KeyValue) {
+	s.span.SetAttributes(attrs...)
+}
+
+// End records err on the span, if any, and ends it.
+func (s *Span) End(err error) {
+	RecordError(s.span, err)
+	s.span.End()
+}
+
+// RecordError marks span as failed with err. A nil error leaves the span unchanged.
+func RecordError(span trace.Span, err error) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingTestSuite tests span creation and nesting through contexts
+type TracingTestSuite struct {
+	suite.Suite
+	exporter *tracetest.InMemoryExporter
+	previous trace.TracerProvider
+}
+
+// SetupTest installs an in-memory tracer provider
+func (s *TracingTestSuite) SetupTest() {
+	s.exporter = tracetest.NewInMemoryExporter()
+	s.previous = otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(s.exporter)))
+}
+
+// TearDownTest restores the previous tracer provider
+func (s *TracingTestSuite) TearDownTest() {
+	otel.SetTracerProvider(s.previous)
+}
+
+// TestStartSpanNesting tests that spans become children of the span in their context
+func (s *TracingTestSuite) TestStartSpanNesting() {
+	ctx, parent := StartSpan(context.Background(), "parent")
+	childCtx, child := StartSpan(ctx, "child")
+	s.Equal(trace.SpanContextFromContext(childCtx), child.span.SpanContext())
+	child.End(errors.New("child failed"))
+	parent.End(nil)
+
+	// Spans started from another context do not join the trace
+	_, other := StartSpan(context.Background(), "other")
+	other.End(nil)
+
+	spans := s.exporter.GetSpans()
+	s.Require().Len(spans, 3)
+	childSpan, parentSpan, otherSpan := spans[0], spans[1], spans[2]
+	s.Equal("child", childSpan.Name)
+	s.Equal(parentSpan.SpanContext.SpanID(), childSpan.Parent.SpanID())
+	s.Equal(codes.Error, childSpan.Status.Code)
+	s.Equal(codes.Unset, parentSpan.Status.Code)
+	s.False(otherSpan.Parent.IsValid())
+	s.NotEqual(parentSpan.SpanContext.TraceID(), otherSpan.SpanContext.TraceID())
+}
+
+// TestStartSpanDisabled tests that spans are no-ops without a recording provider
+func (s *TracingTestSuite) TestStartSpanDisabled() {
+	otel.SetTracerProvider(trace.NewNoopTracerProvider()) //nolint:staticcheck // noop provider is what we want to test
+
+	ctx, span := StartSpan(context.Background(), "noop")
+	s.False(trace.SpanContextFromContext(ctx).IsValid())
+	span.End(nil)
+	s.Empty(s.exporter.GetSpans())
+}
+
+// TestRecordErrorIgnoresCancellation tests that cancelled requests are not recorded as errors
+func (s *TracingTestSuite) TestRecordErrorIgnoresCancellation() {
+	_, span := StartSpan(context.Background(), "cancelled")
+	span.End(context.Canceled)
+
+	spans := s.exporter.GetSpans()
+	s.Require().Len(spans, 1)
+	s.Equal(codes.Unset, spans[0].Status.Code)
+}
+
+// TestInitDisabled tests that an empty endpoint disables exporting
+func (s *TracingTestSuite) TestInitDisabled() {
+	shutdown, err := Init(context.Background(), Config{ServiceName: "test"})
+	s.Require().NoError(err)
+	s.NoError(shutdown(context.Background()))
+}
+
+// TestExporterOptions tests collector URL validation
+func (s *TracingTestSuite) TestExporterOptions() {
+	options, err := exporterOptions("http://localhost:4318")
+	s.Require().NoError(err)
+	s.Len(options, 2)
+
+	options, err = exporterOptions("https://collector.example.com/custom/v1/traces")
+	s.Require().NoError(err)
+	s.Len(options, 2)
+
+	_, err = exporterOptions("localhost:4318")
+	s.Error(err)
+	_, err = exporterOptions("grpc://localhost:4317")
+	s.Error(err)
+}
+
+// TestTracingTestSuite runs the tracing test suite
+func TestTracingTestSuite(t *testing.T) {
+	suite.Run(t, new(TracingTestSuite))
+}
@@ -0,0 +1,340 @@
+// Package webhook delivers bucket and object change events to HTTP endpoints.
+//
+// Events are read from the outbox in the metadata database, so deliveries resume after a
+// restart. Each webhook URL keeps its own cursor; an event is retried with exponential backoff
+// and moved to the dead-letter table once all attempts fail, so one bad event cannot block the
+// events after it.
+//
+// When balancers replicate their metadata, only the leader delivers. The other balancers keep
+// their cursors trailing the outbox by standbyLag, so a balancer taking over redelivers the
+// events of the last moments before the failover rather than losing them.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"loopfs/pkg/log"
+	"loopfs/pkg/metrics"
+	"loopfs/pkg/models"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-LoopFS-Event"
+	HeaderDelivery  = "X-LoopFS-Delivery"
+	HeaderTimestamp = "X-LoopFS-Timestamp"
+	HeaderSignature = "X-LoopFS-Signature"
+)
+
+const (
+	// signaturePrefix identifies the signature algorithm.
+	signaturePrefix = "sha256="
+	// batchSize is the number of events read from the outbox at a time.
+	batchSize = 100
+	// pruneInterval is how often expired events are removed.
+	pruneInterval = time.Hour
+	// standbyLag is how far the cursors of an inactive dispatcher trail the outbox.
+	standbyLag = time.Minute
+)
+
+var (
+	deliveriesTotal = metrics.NewCounterVec("loopfs_webhook_deliveries_total",
+		"Webhook delivery attempts by result.", "result")
+	deadLettersTotal = metrics.NewCounter("loopfs_webhook_dead_letters_total",
+		"Events moved to the dead-letter table after all delivery attempts failed.")
+)
+
+// EventStore is the outbox the dispatcher reads events from.
+type EventStore interface {
+	EventsAfter(ctx context.Context, afterID int64, limit int) ([]models.Event, error)
+	WebhookCursor(ctx context.Context, url string) (int64, error)
+	SetWebhookCursor(ctx context.Context, url string, eventID int64) error
+	DeadLetterWebhookEvent(ctx context.Context, url string, eventID int64, attempts int, lastErr error) error
+	PruneEvents(ctx context.Context, cutoff time.Time, activeURLs []string) (int64, error)
+}
+
+// Config configures webhook delivery.
+type Config struct {
+	URLs []string
+	// Secret signs each delivery with HMAC-SHA256. Deliveries are unsigned when empty.
+	Secret       string
+	MaxAttempts  int
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+	Timeout      time.Duration
+	// Retention is how long delivered events are kept in the outbox. Zero keeps them forever.
+	Retention time.Duration
+}
+
+// DefaultConfig returns the default delivery settings without any URLs.
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:  8,
+		MinBackoff:   time.Second,
+		MaxBackoff:   5 * time.Minute,
+		PollInterval: time.Second,
+		Timeout:      10 * time.Second,
+		Retention:    7 * 24 * time.Hour,
+	}
+}
+
+// Dispatcher delivers events from the outbox to every configured webhook.
+type Dispatcher struct {
+	store  EventStore
+	config Config
+	client *http.Client
+	active func() bool
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher creates a dispatcher reading events from store.
+func NewDispatcher(store EventStore, config Config) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		stop:   make(chan struct{}),
+	}
+}
+
+// Sign returns the signature of a delivery body sent at timestamp.
+// Receivers recompute it over the X-LoopFS-Timestamp header, a period and the raw body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SetActive makes the dispatcher deliver only while active reports true. It must be called
+// before Start.
+func (d *Dispatcher) SetActive(active func() bool) {
+	d.active = active
+}
+
+// isActive reports whether the dispatcher delivers events.
+func (d *Dispatcher) isActive() bool {
+	return d.active == nil || d.active()
+}
+
+// Start starts one delivery worker per webhook and the outbox pruner.
+func (d *Dispatcher) Start() {
+	for _, url := range d.config.URLs {
+		d.wg.Add(1)
+		go d.run(url)
+	}
+	if d.config.Retention > 0 {
+		d.wg.Add(1)
+		go d.pruneLoop()
+	}
+	if len(d.config.URLs) > 0 {
+		log.Info().Strs("urls", d.config.URLs).Msg("Webhook dispatcher started")
+	}
+}
+
+// Stop stops all workers and waits for in-flight deliveries to finish.
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+}
+
+// wait sleeps for duration and reports false if the dispatcher was stopped meanwhile.
+func (d *Dispatcher) wait(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-d.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// run delivers events to url in order until the dispatcher stops.
+func (d *Dispatcher) run(url string) {
+	defer d.wg.Done()
+
+	var cursor int64
+	for {
+		var err error
+		if cursor, err = d.store.WebhookCursor(context.Background(), url); err == nil {
+			break
+		}
+		log.Error().Err(err).Str("url", url).Msg("Failed to load webhook cursor")
+		if !d.wait(d.config.PollInterval) {
+			return
+		}
+	}
+
+	for {
+		if !d.isActive() {
+			cursor = d.trail(url, cursor)
+			if !d.wait(d.config.PollInterval) {
+				return
+			}
+			continue
+		}
+
+		events, err := d.store.EventsAfter(context.Background(), cursor, batchSize)
+		if err != nil {
+			log.Error().Err(err).Str("url", url).Msg("Failed to read events")
+		}
+		if len(events) == 0 {
+			if !d.wait(d.config.PollInterval) {
+				return
+			}
+			continue
+		}
+
+		for i := range events {
+			if !d.deliverWithRetry(url, &events[i]) {
+				return
+			}
+			cursor = events[i].ID
+		}
+	}
+}
+
+// trail advances the cursor of url past the events older than standbyLag without delivering
+// them, as the active dispatcher of another balancer delivers them. It returns the new cursor.
+func (d *Dispatcher) trail(url string, cursor int64) int64 {
+	cutoff := time.Now().Add(-standbyLag)
+	trailed := cursor
+	for {
+		events, err := d.store.EventsAfter(context.Background(), trailed, batchSize)
+		if err != nil {
+			log.Error().Err(err).Str("url", url).Msg("Failed to read events")
+			break
+		}
+		for _, event := range events {
+			if !event.Time.Before(cutoff) {
+				break
+			}
+			trailed = event.ID
+		}
+		if len(events) < batchSize || trailed != events[len(events)-1].ID {
+			break
+		}
+	}
+
+	if trailed != cursor {
+		if err := d.store.SetWebhookCursor(context.Background(), url, trailed); err != nil {
+			log.Error().Err(err).Str("url", url).Int64("event_id", trailed).Msg("Failed to save webhook cursor")
+		}
+	}
+	return trailed
+}
+
+// deliverWithRetry delivers event until it succeeds or all attempts fail, then advances the
+// webhook cursor. It reports false if the dispatcher was stopped before the event was handled.
+func (d *Dispatcher) deliverWithRetry(url string, event *models.Event) bool {
+	backoff := d.config.MinBackoff
+	var lastErr error
+	for attempt := 1; attempt <= d.config.MaxAttempts; attempt++ {
+		lastErr = d.deliver(url, event)
+		if lastErr == nil {
+			deliveriesTotal.WithLabelValues("success").Inc()
+			if err := d.store.SetWebhookCursor(context.Background(), url, event.ID); err != nil {
+				// The event will be delivered again after a restart
+				log.Error().Err(err).Str("url", url).Int64("event_id", event.ID).Msg("Failed to save webhook cursor")
+			}
+			return true
+		}
+
+		deliveriesTotal.WithLabelValues("failure").Inc()
+		log.Warn().
+			Err(lastErr).
+			Str("url", url).
+			Int64("event_id", event.ID).
+			Int("attempt", attempt).
+			Msg("Webhook delivery failed")
+		if attempt == d.config.MaxAttempts {
+			break
+		}
+		if !d.wait(backoff) {
+			return false
+		}
+		backoff = min(2*backoff, d.config.MaxBackoff)
+	}
+
+	deadLettersTotal.Inc()
+	log.Error().
+		Err(lastErr).
+		Str("url", url).
+		Int64("event_id", event.ID).
+		Msg("Webhook delivery abandoned, event moved to dead letters")
+	if err := d.store.DeadLetterWebhookEvent(context.Background(), url, event.ID, d.config.MaxAttempts, lastErr); err != nil {
+		log.Error().Err(err).Str("url", url).Int64("event_id", event.ID).Msg("Failed to record dead letter")
+	}
+	return true
+}
+
+// deliver sends event to url once.
+func (d *Dispatcher) deliver(url string, event *models.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body)) //nolint:noctx // bounded by the client timeout
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if d.config.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(d.config.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// pruneLoop periodically removes delivered events older than the retention period.
+func (d *Dispatcher) pruneLoop() {
+	defer d.wg.Done()
+	for {
+		d.prune()
+		if !d.wait(pruneInterval) {
+			return
+		}
+	}
+}
+
+// prune removes delivered events older than the retention period.
+func (d *Dispatcher) prune() {
+	deleted, err := d.store.PruneEvents(context.Background(), time.Now().Add(-d.config.Retention), d.config.URLs)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to prune events")
+		return
+	}
+	if deleted > 0 {
+		log.Info().Int64("deleted", deleted).Msg("Pruned expired events")
+	}
+}
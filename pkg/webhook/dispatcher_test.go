@@ -0,0 +1,254 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loopfs/pkg/bucket"
+	"loopfs/pkg/models"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	testSecret = "s3cret"
+	testHash   = "a1b2c3d4e5f67890123456789abcdef0123456789abcdef0123456789abcdef0"
+)
+
+// receiver records webhook deliveries
+type receiver struct {
+	mu        sync.Mutex
+	events    []models.Event
+	headers   []http.Header
+	bodies    [][]byte
+	failFirst atomic.Int32
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.failFirst.Add(-1) >= 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	var event models.Event
+	_ = json.Unmarshal(body, &event)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	r.headers = append(r.headers, req.Header.Clone())
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *receiver) received() []models.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.Event(nil), r.events...)
+}
+
+// DispatcherTestSuite tests webhook delivery from the bucket store outbox
+type DispatcherTestSuite struct {
+	suite.Suite
+	dbPath   string
+	store    *bucket.Store
+	receiver *receiver
+	server   *httptest.Server
+}
+
+// SetupTest creates a store and a webhook receiver
+func (s *DispatcherTestSuite) SetupTest() {
+	s.dbPath = filepath.Join(s.T().TempDir(), "buckets.db")
+	var err error
+	s.store, err = bucket.NewStore(s.dbPath)
+	s.Require().NoError(err)
+	s.receiver = &receiver{}
+	s.server = httptest.NewServer(s.receiver)
+}
+
+// TearDownTest releases resources
+func (s *DispatcherTestSuite) TearDownTest() {
+	s.server.Close()
+	_ = s.store.Close()
+}
+
+// config returns a fast delivery configuration for the test receiver
+func (s *DispatcherTestSuite) config() Config {
+	config := DefaultConfig()
+	config.URLs = []string{s.server.URL}
+	config.Secret = testSecret
+	config.MaxAttempts = 3
+	config.MinBackoff = time.Millisecond
+	config.MaxBackoff = 5 * time.Millisecond
+	config.PollInterval = 5 * time.Millisecond
+	config.Retention = 0
+	return config
+}
+
+// cursor returns the stored cursor of the test receiver
+func (s *DispatcherTestSuite) cursor() int64 {
+	cursor, err := s.store.WebhookCursor(context.Background(), s.server.URL)
+	s.Require().NoError(err)
+	return cursor
+}
+
+// TestDeliversSignedEvents tests ordered, signed delivery of new events
+func (s *DispatcherTestSuite) TestDeliversSignedEvents() {
+	_, err := s.store.CreateBucket(context.Background(), "old", "alice", nil)
+	s.Require().NoError(err)
+
+	dispatcher := NewDispatcher(s.store, s.config())
+	dispatcher.Start()
+	defer dispatcher.Stop()
+	s.Eventually(func() bool { return s.cursor() == 1 }, time.Second, 5*time.Millisecond)
+
+	_, err = s.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().NoError(err)
+	_, err = s.store.PutObject(context.Background(), "photos", "a.jpg", testHash, 3, "", nil)
+	s.Require().NoError(err)
+
+	s.Eventually(func() bool { return len(s.receiver.received()) == 2 }, time.Second, 5*time.Millisecond)
+	events := s.receiver.received()
+	s.Equal(models.EventBucketCreated, events[0].Type, "events created before the webhook existed are not replayed")
+	s.Equal("photos", events[0].Bucket)
+	s.Equal(models.EventObjectCreated, events[1].Type)
+	s.Equal(testHash, events[1].Hash)
+
+	s.receiver.mu.Lock()
+	header, body := s.receiver.headers[1], s.receiver.bodies[1]
+	s.receiver.mu.Unlock()
+	s.Equal(models.EventObjectCreated, header.Get(HeaderEvent))
+	s.Equal("3", header.Get(HeaderDelivery))
+	s.Equal(Sign(testSecret, header.Get(HeaderTimestamp), body), header.Get(HeaderSignature))
+	s.Eventually(func() bool { return s.cursor() == 3 }, time.Second, 5*time.Millisecond)
+}
+
+// TestRetriesWithBackoff tests that failed deliveries are retried
+func (s *DispatcherTestSuite) TestRetriesWithBackoff() {
+	s.receiver.failFirst.Store(2)
+	s.Require().NoError(s.store.SetWebhookCursor(context.Background(), s.server.URL, 0))
+	_, err := s.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().NoError(err)
+	before := deliveriesTotal.WithLabelValues("failure").Value()
+
+	dispatcher := NewDispatcher(s.store, s.config())
+	dispatcher.Start()
+	defer dispatcher.Stop()
+
+	s.Eventually(func() bool { return len(s.receiver.received()) == 1 }, time.Second, 5*time.Millisecond)
+	s.InDelta(2, deliveriesTotal.WithLabelValues("failure").Value()-before, 0)
+}
+
+// TestDeadLetter tests that an undeliverable event does not block later events
+func (s *DispatcherTestSuite) TestDeadLetter() {
+	s.receiver.failFirst.Store(3)
+	s.Require().NoError(s.store.SetWebhookCursor(context.Background(), s.server.URL, 0))
+	_, err := s.store.CreateBucket(context.Background(), "first", "alice", nil)
+	s.Require().NoError(err)
+	_, err = s.store.CreateBucket(context.Background(), "second", "alice", nil)
+	s.Require().NoError(err)
+	before := deadLettersTotal.Value()
+
+	dispatcher := NewDispatcher(s.store, s.config())
+	dispatcher.Start()
+	defer dispatcher.Stop()
+
+	s.Eventually(func() bool { return len(s.receiver.received()) == 1 }, time.Second, 5*time.Millisecond)
+	s.Equal("second", s.receiver.received()[0].Bucket)
+	s.InDelta(1, deadLettersTotal.Value()-before, 0)
+	s.Eventually(func() bool { return s.cursor() == 2 }, time.Second, 5*time.Millisecond)
+}
+
+// TestResumesAfterRestart tests that undelivered events survive a restart
+func (s *DispatcherTestSuite) TestResumesAfterRestart() {
+	s.Require().NoError(s.store.SetWebhookCursor(context.Background(), s.server.URL, 0))
+	_, err := s.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(s.store.Close())
+
+	s.store, err = bucket.NewStore(s.dbPath)
+	s.Require().NoError(err)
+	dispatcher := NewDispatcher(s.store, s.config())
+	dispatcher.Start()
+	defer dispatcher.Stop()
+
+	s.Eventually(func() bool { return len(s.receiver.received()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+// TestStopDuringBackoff tests that Stop does not wait for the retry backoff
+func (s *DispatcherTestSuite) TestStopDuringBackoff() {
+	s.receiver.failFirst.Store(100)
+	s.Require().NoError(s.store.SetWebhookCursor(context.Background(), s.server.URL, 0))
+	_, err := s.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().NoError(err)
+
+	config := s.config()
+	config.MinBackoff = time.Hour
+	dispatcher := NewDispatcher(s.store, config)
+	dispatcher.Start()
+	s.Eventually(func() bool { return s.receiver.failFirst.Load() < 100 }, time.Second, 5*time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		dispatcher.Stop()
+		close(stopped)
+	}()
+	s.Eventually(func() bool {
+		select {
+		case <-stopped:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 5*time.Millisecond)
+	s.Equal(int64(0), s.cursor(), "an undelivered event must stay in the outbox")
+}
+
+// TestInactive tests that an inactive dispatcher holds back recent events and delivers them
+// once active
+func (s *DispatcherTestSuite) TestInactive() {
+	s.Require().NoError(s.store.SetWebhookCursor(context.Background(), s.server.URL, 0))
+	_, err := s.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().NoError(err)
+
+	var active atomic.Bool
+	dispatcher := NewDispatcher(s.store, s.config())
+	dispatcher.SetActive(active.Load)
+	dispatcher.Start()
+	defer dispatcher.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	s.Empty(s.receiver.received())
+	s.Equal(int64(0), s.cursor(), "recent events may not have been delivered by the leader yet")
+
+	active.Store(true)
+	s.Eventually(func() bool { return len(s.receiver.received()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+// TestPrune tests that the dispatcher prunes expired events
+func (s *DispatcherTestSuite) TestPrune() {
+	_, err := s.store.CreateBucket(context.Background(), "photos", "alice", nil)
+	s.Require().NoError(err)
+
+	config := s.config()
+	config.URLs = nil
+	config.Retention = -time.Hour
+	NewDispatcher(s.store, config).prune()
+
+	events, err := s.store.EventsAfter(context.Background(), 0, batchSize)
+	s.Require().NoError(err)
+	s.Empty(events)
+}
+
+// TestDispatcherTestSuite runs the dispatcher test suite
+func TestDispatcherTestSuite(t *testing.T) {
+	suite.Run(t, new(DispatcherTestSuite))
+}